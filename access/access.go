@@ -0,0 +1,151 @@
+// Package access restricts API keys to a subset of coins. The coins a
+// request may read travel in its context, and every query run with that
+// context against a table with a coin column is limited to them
+package access
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/notblessy/dexlite/symbols"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CATEGORY_PREFIX marks a grant entry naming a category rather than a coin,
+// e.g. @majors
+const CATEGORY_PREFIX = "@"
+
+// Scope is the set of coins a request may read
+type Scope map[string]bool
+
+// Allows reports whether coin is in the scope
+func (s Scope) Allows(coin string) bool {
+	return s[coin]
+}
+
+// Coins returns the coins in the scope, sorted
+func (s Scope) Coins() []string {
+	coins := make([]string, 0, len(s))
+	for coin := range s {
+		coins = append(coins, coin)
+	}
+	slices.Sort(coins)
+	return coins
+}
+
+// NewScope creates a scope of coins
+func NewScope(coins ...string) Scope {
+	scope := make(Scope, len(coins))
+	for _, coin := range symbols.NormalizeAll(coins) {
+		scope[coin] = true
+	}
+	return scope
+}
+
+// Policy maps API keys to the coins they are scoped to. Keys it doesn't list
+// are not restricted
+type Policy struct {
+	scopes map[string]Scope
+}
+
+// NewPolicy resolves grants, each a list of coins and @category names, into
+// scopes per key using the coins of each category
+func NewPolicy(grants map[string][]string, categories map[string][]string) (*Policy, error) {
+	policy := &Policy{scopes: make(map[string]Scope, len(grants))}
+
+	var errs []error
+	for key, grant := range grants {
+		var coins []string
+		for _, entry := range grant {
+			if name, ok := strings.CutPrefix(entry, CATEGORY_PREFIX); ok {
+				members, ok := categories[name]
+				if !ok {
+					errs = append(errs, fmt.Errorf("unknown coin category %q", name))
+					continue
+				}
+				coins = append(coins, members...)
+				continue
+			}
+			coins = append(coins, entry)
+		}
+		policy.scopes[key] = NewScope(coins...)
+	}
+	return policy, errors.Join(errs...)
+}
+
+// Scope returns the scope of key, false when the key is unrestricted
+func (p *Policy) Scope(key string) (Scope, bool) {
+	scope, ok := p.scopes[key]
+	return scope, ok
+}
+
+// Len returns how many keys are scoped
+func (p *Policy) Len() int {
+	return len(p.scopes)
+}
+
+type scopeKey struct{}
+
+// WithScope returns a context restricted to scope
+func WithScope(ctx context.Context, scope Scope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// ScopeFrom returns the scope of ctx, false when it is unrestricted
+func ScopeFrom(ctx context.Context) (Scope, bool) {
+	scope, ok := ctx.Value(scopeKey{}).(Scope)
+	return scope, ok
+}
+
+// Allowed reports whether ctx may read coin
+func Allowed(ctx context.Context, coin string) bool {
+	scope, ok := ScopeFrom(ctx)
+	return !ok || scope.Allows(coin)
+}
+
+// GORMPlugin limits every read of a model with a coin column to the scope in
+// the statement's context. Only queries run with WithContext are restricted
+type GORMPlugin struct{}
+
+func (GORMPlugin) Name() string {
+	return "access"
+}
+
+func (GORMPlugin) Initialize(database *gorm.DB) error {
+	callbacks := database.Callback()
+
+	return errors.Join(
+		callbacks.Query().Before("gorm:query").Register("access:scope_query", scopeCoins),
+		callbacks.Row().Before("gorm:row").Register("access:scope_row", scopeCoins),
+	)
+}
+
+func scopeCoins(tx *gorm.DB) {
+	if tx.Statement.Context == nil || tx.Statement.Schema == nil {
+		return
+	}
+	scope, ok := ScopeFrom(tx.Statement.Context)
+	if !ok {
+		return
+	}
+	field := tx.Statement.Schema.LookUpField("Coin")
+	if field == nil || field.DBName == "" {
+		return
+	}
+
+	coins := scope.Coins()
+	values := make([]interface{}, len(coins))
+	for i, coin := range coins {
+		values[i] = coin
+	}
+	// An empty scope matches nothing rather than everything
+	var condition clause.Expression = clause.Expr{SQL: "1 = 0"}
+	if len(values) > 0 {
+		condition = clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Values: values}
+	}
+	tx.Statement.AddClause(clause.Where{Exprs: []clause.Expression{condition}})
+}
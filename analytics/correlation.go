@@ -0,0 +1,180 @@
+// Package analytics holds computations too expensive for a synchronous
+// request, run as background jobs
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/symbols"
+	"gorm.io/gorm"
+)
+
+const (
+	DEFAULT_CORRELATION_WINDOW   = 30 * 24 * time.Hour
+	DEFAULT_CORRELATION_INTERVAL = "1h"
+	// MAX_CORRELATION_WINDOW bounds how far back a correlation can look
+	MAX_CORRELATION_WINDOW = 365 * 24 * time.Hour
+	MAX_CORRELATION_COINS  = 20
+	// MIN_CORRELATION_SAMPLES is how many shared returns a pair needs for a
+	// coefficient, fewer leave it null
+	MIN_CORRELATION_SAMPLES = 3
+)
+
+// CorrelationParams asks for the correlation of coins' returns between From
+// and To, from candles of Interval averaged across Sources or every venue
+type CorrelationParams struct {
+	Coins    []string  `json:"coins"`
+	Sources  []string  `json:"sources,omitempty"`
+	Interval string    `json:"interval"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+}
+
+// Normalize fills in defaults relative to now and checks the params
+func (p *CorrelationParams) Normalize(now time.Time) error {
+	p.Coins = symbols.NormalizeAll(p.Coins)
+	slices.Sort(p.Coins)
+	p.Coins = slices.Compact(p.Coins)
+	if len(p.Coins) < 2 || len(p.Coins) > MAX_CORRELATION_COINS {
+		return fmt.Errorf("coins must list 2 to %d distinct coins", MAX_CORRELATION_COINS)
+	}
+
+	if p.Interval == "" {
+		p.Interval = DEFAULT_CORRELATION_INTERVAL
+	}
+	if _, ok := models.CANDLE_INTERVALS[p.Interval]; !ok {
+		return fmt.Errorf("unsupported interval %q", p.Interval)
+	}
+
+	if p.To.IsZero() {
+		p.To = now
+	}
+	if p.From.IsZero() {
+		p.From = p.To.Add(-DEFAULT_CORRELATION_WINDOW)
+	}
+	if !p.From.Before(p.To) {
+		return errors.New("from must be before to")
+	}
+	if p.To.Sub(p.From) > MAX_CORRELATION_WINDOW {
+		return fmt.Errorf("from/to span %s, over the maximum of %s", p.To.Sub(p.From), MAX_CORRELATION_WINDOW)
+	}
+	return nil
+}
+
+// CorrelationResult holds the Pearson correlation of log returns between
+// every pair of coins, in the order of Coins. Samples counts the returns each
+// pair shared, a coefficient is null when there were too few
+type CorrelationResult struct {
+	Coins    []string     `json:"coins"`
+	Interval string       `json:"interval"`
+	From     time.Time    `json:"from"`
+	To       time.Time    `json:"to"`
+	Matrix   [][]*float64 `json:"matrix"`
+	Samples  [][]int      `json:"samples"`
+}
+
+// Correlation computes the correlation matrix of normalized params
+func Correlation(ctx context.Context, database *gorm.DB, params CorrelationParams) (CorrelationResult, error) {
+	var rows []struct {
+		Coin     string
+		OpenTime time.Time
+		Close    float64
+	}
+	query := database.WithContext(ctx).Model(&models.CoinCandle{}).
+		Select("coin, open_time, AVG(close) AS close").
+		Where("resolution = ? AND coin IN ? AND open_time >= ? AND open_time < ?", params.Interval, params.Coins, params.From, params.To)
+	if len(params.Sources) > 0 {
+		query = query.Where("exchange IN ?", params.Sources)
+	}
+	err := query.Group("coin, open_time").Order("open_time ASC").Scan(&rows).Error
+	if err != nil {
+		return CorrelationResult{}, err
+	}
+
+	// Returns are only taken between adjacent candles so gaps don't turn
+	// into one large move
+	interval := models.CANDLE_INTERVALS[params.Interval]
+	closes := make(map[string]map[time.Time]float64, len(params.Coins))
+	returns := make(map[string]map[time.Time]float64, len(params.Coins))
+	for _, coin := range params.Coins {
+		closes[coin] = make(map[time.Time]float64)
+		returns[coin] = make(map[time.Time]float64)
+	}
+	for _, row := range rows {
+		if row.Close <= 0 {
+			continue
+		}
+		openTime := row.OpenTime.UTC()
+		closes[row.Coin][openTime] = row.Close
+		if previous, ok := closes[row.Coin][openTime.Add(-interval)]; ok {
+			returns[row.Coin][openTime] = math.Log(row.Close / previous)
+		}
+	}
+
+	result := CorrelationResult{
+		Coins:    params.Coins,
+		Interval: params.Interval,
+		From:     params.From,
+		To:       params.To,
+		Matrix:   make([][]*float64, len(params.Coins)),
+		Samples:  make([][]int, len(params.Coins)),
+	}
+	for i := range params.Coins {
+		result.Matrix[i] = make([]*float64, len(params.Coins))
+		result.Samples[i] = make([]int, len(params.Coins))
+	}
+	for i, a := range params.Coins {
+		for j := i; j < len(params.Coins); j++ {
+			if err := ctx.Err(); err != nil {
+				return CorrelationResult{}, err
+			}
+			coefficient, samples := pearson(returns[a], returns[params.Coins[j]])
+			result.Matrix[i][j], result.Matrix[j][i] = coefficient, coefficient
+			result.Samples[i][j], result.Samples[j][i] = samples, samples
+		}
+	}
+	return result, nil
+}
+
+// pearson correlates two return series over the times they share
+func pearson(a, b map[time.Time]float64) (*float64, int) {
+	var xs, ys []float64
+	for at, x := range a {
+		if y, ok := b[at]; ok {
+			xs = append(xs, x)
+			ys = append(ys, y)
+		}
+	}
+	if len(xs) < MIN_CORRELATION_SAMPLES {
+		return nil, len(xs)
+	}
+
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= float64(len(xs))
+	meanY /= float64(len(ys))
+
+	var cov, varX, varY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	// A coin that never moved has no defined correlation
+	if varX == 0 || varY == 0 {
+		return nil, len(xs)
+	}
+
+	coefficient := cov / math.Sqrt(varX*varY)
+	return &coefficient, len(xs)
+}
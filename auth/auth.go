@@ -0,0 +1,175 @@
+// Package auth issues and verifies the HS256 JSON Web Tokens user accounts
+// sign in with, and hashes their passwords
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TOKEN_ISSUER is the iss claim of every token signing a user in
+const TOKEN_ISSUER = "dexlite"
+
+// EMAIL_TOKEN_ISSUER is the iss claim of tokens confirming an email address.
+// They can't sign anyone in
+const EMAIL_TOKEN_ISSUER = "dexlite:email"
+
+// EMAIL_TOKEN_TTL is how long an email confirmation link works
+const EMAIL_TOKEN_TTL = 24 * time.Hour
+
+// MIN_PASSWORD_LENGTH is the shortest password accepted at registration
+const MIN_PASSWORD_LENGTH = 8
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Claims are what a token asserts. Subject is the user ID, Email the address
+// an email token confirms
+type Claims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Email     string `json:"email,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// UserID returns the user the token was issued to
+func (c Claims) UserID() (uint, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	return uint(id), nil
+}
+
+// Tokens signs and verifies tokens with one secret
+type Tokens struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewTokens creates tokens signed with secret and valid for ttl
+func NewTokens(secret string, ttl time.Duration) *Tokens {
+	return &Tokens{
+		secret: []byte(secret),
+		ttl:    ttl,
+	}
+}
+
+// Issue returns a token for userID and when it expires
+func (t *Tokens) Issue(userID uint) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(t.ttl)
+
+	token, err := t.issue(Claims{
+		Issuer:    TOKEN_ISSUER,
+		Subject:   strconv.FormatUint(uint64(userID), 10),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	return token, expiresAt, err
+}
+
+// IssueEmail returns a token confirming that userID receives mail at email,
+// valid for EMAIL_TOKEN_TTL
+func (t *Tokens) IssueEmail(userID uint, email string) (string, error) {
+	now := time.Now()
+	return t.issue(Claims{
+		Issuer:    EMAIL_TOKEN_ISSUER,
+		Subject:   strconv.FormatUint(uint64(userID), 10),
+		Email:     email,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(EMAIL_TOKEN_TTL).Unix(),
+	})
+}
+
+func (t *Tokens) issue(claims Claims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + t.sign(unsigned), nil
+}
+
+// Verify checks the signature and expiry of token and returns its claims.
+// Only HS256 tokens issued by dexlite to sign in are accepted
+func (t *Tokens) Verify(token string) (Claims, error) {
+	return t.verify(token, TOKEN_ISSUER)
+}
+
+// VerifyEmail checks an email confirmation token like Verify does
+func (t *Tokens) VerifyEmail(token string) (Claims, error) {
+	claims, err := t.verify(token, EMAIL_TOKEN_ISSUER)
+	if err == nil && claims.Email == "" {
+		return Claims{}, ErrInvalidToken
+	}
+	return claims, err
+}
+
+func (t *Tokens) verify(token, issuer string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return Claims{}, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(t.sign(parts[0]+"."+parts[1]))) {
+		return Claims{}, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Issuer != issuer {
+		return Claims{}, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return Claims{}, ErrExpiredToken
+	}
+	return claims, nil
+}
+
+func (t *Tokens) sign(unsigned string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// jwtHeader is the encoded {"alg":"HS256","typ":"JWT"} header. Tokens with
+// any other header, such as alg none, are rejected outright
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// HashPassword returns the bcrypt hash of password
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches hash
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// dummyHash is compared against when a login names an unknown user, so the
+// response takes as long as for a wrong password
+var dummyHash, _ = HashPassword("dexlite-unknown-user")
+
+// CheckUnknownUser spends the time of a password check without a user
+func CheckUnknownUser(password string) {
+	CheckPassword(dummyHash, password)
+}
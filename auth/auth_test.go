@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "test-secret"
+
+// issue returns a token for user 42 signed with tokens
+func issue(t *testing.T, tokens *Tokens) string {
+	t.Helper()
+
+	token, _, err := tokens.Issue(42)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	return token
+}
+
+// forge signs claims under header with secret, the way an attacker holding
+// or guessing the secret would
+func forge(header string, claims Claims, secret string) string {
+	payload, _ := json.Marshal(claims)
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + NewTokens(secret, time.Hour).sign(unsigned)
+}
+
+// validClaims returns unexpired claims for user 42
+func validClaims() Claims {
+	now := time.Now()
+	return Claims{
+		Issuer:    TOKEN_ISSUER,
+		Subject:   "42",
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Hour).Unix(),
+	}
+}
+
+func TestVerifyIssued(t *testing.T) {
+	tokens := NewTokens(testSecret, time.Hour)
+
+	claims, err := tokens.Verify(issue(t, tokens))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if id, err := claims.UserID(); err != nil || id != 42 {
+		t.Fatalf("UserID() = %d, %v, want 42", id, err)
+	}
+	if claims.Issuer != TOKEN_ISSUER {
+		t.Fatalf("Issuer = %q, want %q", claims.Issuer, TOKEN_ISSUER)
+	}
+}
+
+func TestVerifyBadSignature(t *testing.T) {
+	tokens := NewTokens(testSecret, time.Hour)
+	token := issue(t, tokens)
+	parts := strings.Split(token, ".")
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{
+			name:  "other secret",
+			token: issue(t, NewTokens("other-secret", time.Hour)),
+		},
+		{
+			name:  "forged with other secret",
+			token: forge(jwtHeader, validClaims(), "other-secret"),
+		},
+		{
+			name:  "signature altered",
+			token: parts[0] + "." + parts[1] + "." + strings.ToUpper(parts[2]),
+		},
+		{
+			name:  "signature missing",
+			token: parts[0] + "." + parts[1] + ".",
+		},
+		{
+			name:  "signature dropped",
+			token: parts[0] + "." + parts[1],
+		},
+		{
+			name:  "extra segment",
+			token: token + "." + parts[2],
+		},
+		{
+			name:  "empty",
+			token: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tokens.Verify(tt.token); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("Verify error = %v, want %v", err, ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestVerifyWrongHeader(t *testing.T) {
+	tokens := NewTokens(testSecret, time.Hour)
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "alg none", header: `{"alg":"none","typ":"JWT"}`},
+		{name: "alg HS512", header: `{"alg":"HS512","typ":"JWT"}`},
+		{name: "alg RS256", header: `{"alg":"RS256","typ":"JWT"}`},
+		{name: "reordered", header: `{"typ":"JWT","alg":"HS256"}`},
+		{name: "whitespace", header: `{"alg": "HS256", "typ": "JWT"}`},
+		{name: "not json", header: `HS256`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Signed with the right secret, so only the header is wrong
+			header := base64.RawURLEncoding.EncodeToString([]byte(tt.header))
+			if _, err := tokens.Verify(forge(header, validClaims(), testSecret)); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("Verify error = %v, want %v", err, ErrInvalidToken)
+			}
+		})
+	}
+
+	t.Run("alg none unsigned", func(t *testing.T) {
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+		payload, _ := json.Marshal(validClaims())
+		token := header + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+		if _, err := tokens.Verify(token); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("Verify error = %v, want %v", err, ErrInvalidToken)
+		}
+	})
+}
+
+func TestVerifyExpired(t *testing.T) {
+	tokens := NewTokens(testSecret, time.Hour)
+
+	expired := validClaims()
+	expired.ExpiresAt = time.Now().Add(-time.Second).Unix()
+	if _, err := tokens.Verify(forge(jwtHeader, expired, testSecret)); !errors.Is(err, ErrExpiredToken) {
+		t.Fatalf("Verify error = %v, want %v", err, ErrExpiredToken)
+	}
+
+	// A token expires at the second it names
+	expiring := validClaims()
+	expiring.ExpiresAt = time.Now().Unix()
+	if _, err := tokens.Verify(forge(jwtHeader, expiring, testSecret)); !errors.Is(err, ErrExpiredToken) {
+		t.Fatalf("Verify error = %v, want %v", err, ErrExpiredToken)
+	}
+
+	// No expiry reads as the epoch, long past
+	unbounded := validClaims()
+	unbounded.ExpiresAt = 0
+	if _, err := tokens.Verify(forge(jwtHeader, unbounded, testSecret)); !errors.Is(err, ErrExpiredToken) {
+		t.Fatalf("Verify error = %v, want %v", err, ErrExpiredToken)
+	}
+
+	// Issued with a ttl already over
+	if _, err := NewTokens(testSecret, -time.Minute).Verify(issue(t, NewTokens(testSecret, -time.Minute))); !errors.Is(err, ErrExpiredToken) {
+		t.Fatalf("Verify error = %v, want %v", err, ErrExpiredToken)
+	}
+}
+
+func TestVerifyTamperedPayload(t *testing.T) {
+	tokens := NewTokens(testSecret, time.Hour)
+	parts := strings.Split(issue(t, tokens), ".")
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("decoding payload: %v", err)
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatalf("unmarshaling payload: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(c *Claims)
+	}{
+		{name: "other user", tamper: func(c *Claims) { c.Subject = "1" }},
+		{name: "extended expiry", tamper: func(c *Claims) { c.ExpiresAt += 365 * 24 * 60 * 60 }},
+		{name: "other issuer", tamper: func(c *Claims) { c.Issuer = "someone-else" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := claims
+			tt.tamper(&tampered)
+			encoded, _ := json.Marshal(tampered)
+
+			// The original signature over a changed payload
+			token := parts[0] + "." + base64.RawURLEncoding.EncodeToString(encoded) + "." + parts[2]
+			if _, err := tokens.Verify(token); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("Verify error = %v, want %v", err, ErrInvalidToken)
+			}
+		})
+	}
+
+	t.Run("payload not base64", func(t *testing.T) {
+		unsigned := parts[0] + ".!!!"
+		if _, err := tokens.Verify(unsigned + "." + tokens.sign(unsigned)); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("Verify error = %v, want %v", err, ErrInvalidToken)
+		}
+	})
+
+	t.Run("payload not json", func(t *testing.T) {
+		unsigned := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte("not json"))
+		if _, err := tokens.Verify(unsigned + "." + tokens.sign(unsigned)); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("Verify error = %v, want %v", err, ErrInvalidToken)
+		}
+	})
+
+	t.Run("signed other issuer", func(t *testing.T) {
+		other := validClaims()
+		other.Issuer = "someone-else"
+		if _, err := tokens.Verify(forge(jwtHeader, other, testSecret)); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("Verify error = %v, want %v", err, ErrInvalidToken)
+		}
+	})
+
+	t.Run("signed non numeric subject", func(t *testing.T) {
+		other := validClaims()
+		other.Subject = "admin"
+		verified, err := tokens.Verify(forge(jwtHeader, other, testSecret))
+		if err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+		if _, err := verified.UserID(); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("UserID error = %v, want %v", err, ErrInvalidToken)
+		}
+	})
+}
+
+func TestEmailTokens(t *testing.T) {
+	tokens := NewTokens(testSecret, time.Hour)
+
+	token, err := tokens.IssueEmail(42, "user@example.com")
+	if err != nil {
+		t.Fatalf("IssueEmail: %v", err)
+	}
+	claims, err := tokens.VerifyEmail(token)
+	if err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	if id, err := claims.UserID(); err != nil || id != 42 || claims.Email != "user@example.com" {
+		t.Fatalf("claims = %+v, want user 42 at user@example.com", claims)
+	}
+
+	// Neither kind of token passes for the other
+	if _, err := tokens.Verify(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Verify of an email token error = %v, want %v", err, ErrInvalidToken)
+	}
+	if _, err := tokens.VerifyEmail(issue(t, tokens)); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("VerifyEmail of a sign in token error = %v, want %v", err, ErrInvalidToken)
+	}
+
+	// An email token must name the address it confirms
+	bare := validClaims()
+	bare.Issuer = EMAIL_TOKEN_ISSUER
+	if _, err := tokens.VerifyEmail(forge(jwtHeader, bare, testSecret)); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("VerifyEmail without an address error = %v, want %v", err, ErrInvalidToken)
+	}
+
+	expired := bare
+	expired.Email = "user@example.com"
+	expired.ExpiresAt = time.Now().Add(-time.Second).Unix()
+	if _, err := tokens.VerifyEmail(forge(jwtHeader, expired, testSecret)); !errors.Is(err, ErrExpiredToken) {
+		t.Fatalf("VerifyEmail of an expired token error = %v, want %v", err, ErrExpiredToken)
+	}
+}
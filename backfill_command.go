@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/notblessy/dexlite/config"
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/symbols"
+	"github.com/notblessy/dexlite/workers"
+	"github.com/spf13/cobra"
+)
+
+// backfillFlags are the flags of `dexlite backfill`
+type backfillFlags struct {
+	since   time.Duration
+	history bool
+	coins   string
+}
+
+func newBackfillCommand(cfg *config.Config) *cobra.Command {
+	var flags backfillFlags
+	cmd := &cobra.Command{
+		Use:         "backfill",
+		Short:       "rebuild candles, filling price gaps from exchange history with --history",
+		Args:        cobra.NoArgs,
+		Annotations: persistent,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exit(runBackfill(cfg, flags))
+		},
+	}
+	cmd.Flags().DurationVar(&flags.since, "since", cfg.Retention.RawPrices, "rebuild from prices stored in this window")
+	cmd.Flags().BoolVar(&flags.history, "history", false, "fill missing prices from exchange candle history first")
+	cmd.Flags().StringVar(&flags.coins, "coins", "", "comma separated coins to fill with --history, every tracked coin when empty")
+	return cmd
+}
+
+// runBackfill implements `dexlite backfill`, rebuilding candles and session
+// bars from the raw prices stored over a window, e.g. after `verify --repair`
+// or a dead letter replay added prices the candle builder had passed. With
+// --history it first fills intervals without a price from exchange candle
+// history, and exits 1 if some coins couldn't be filled
+func runBackfill(cfg *config.Config, flags backfillFlags) int {
+	if flags.since <= 0 {
+		fmt.Fprintln(os.Stderr, "backfill: --since must be positive")
+		return 2
+	}
+
+	database := db.New(cfg.Database.Driver, cfg.Database.DSN)
+	prepareSchema(cfg, database)
+	sessions, err := newSessions(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "backfill: %v\n", err)
+		return 2
+	}
+
+	startedAt := time.Now()
+	from := startedAt.Add(-flags.since)
+	status := 0
+	if flags.history {
+		var coins []string
+		for _, coin := range strings.Split(flags.coins, ",") {
+			if coin = strings.TrimSpace(coin); coin != "" {
+				coins = append(coins, symbols.Normalize(coin))
+			}
+		}
+		if len(coins) == 0 {
+			if err := database.Model(&models.TrackedCoin{}).Order("coin ASC").Pluck("coin", &coins).Error; err != nil {
+				fmt.Fprintf(os.Stderr, "backfill: loading tracked coins: %v\n", err)
+				return 2
+			}
+		}
+
+		registry, err := newRegistry(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "backfill: creating price sources: %v\n", err)
+			return 2
+		}
+		persister := db.NewPersister(database, cfg.Database.DeadLetterFile)
+		if cfg.Server.Region != "" {
+			persister.SetRegion(cfg.Server.Region)
+		}
+		backfiller := workers.NewBackfiller(database, db.NewWriteGate(database), persister, registry, nil, cfg.Fetcher.Interval, flags.since, 0)
+
+		prices, err := backfiller.Backfill(coins, from, startedAt)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "backfill: %v\n", err)
+			status = 1
+		}
+		fmt.Printf("Filled %d prices of %d coins from candle history\n", prices, len(coins))
+	}
+
+	builder := workers.NewCandleBuilder(database, db.NewWriteGate(database), sessions, cfg.Fetcher.CandleInterval, cfg.Retention.RawPrices)
+	rows, err := builder.Rebuild(from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "backfill: stopped after %d candles: %v\n", rows, err)
+		return 2
+	}
+
+	fmt.Printf("Rebuilt %d candles in %s\n", rows, time.Since(startedAt).Round(time.Millisecond))
+	return status
+}
@@ -0,0 +1,100 @@
+// Package cache keeps encoded API responses in Redis, grouped by coin so that
+// storing a new price invalidates every cached response about that coin
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/notblessy/dexlite/redis"
+)
+
+// Cache stores responses under a per-coin generation. Invalidating a coin
+// bumps its generation, so entries from before are never read again and
+// simply expire
+type Cache struct {
+	client *redis.Client
+	prefix string
+}
+
+// New creates a cache keeping entries under prefix
+func New(client *redis.Client, prefix string) *Cache {
+	return &Cache{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Entry is where a looked up response is cached. On a miss the response is
+// stored there with Set
+type Entry struct {
+	key string
+}
+
+// getScript reads the generation of the coin in KEYS[1] and the entry ARGV[1]
+// under it in one round trip, returning {generation, value}
+const getScript = `
+local generation = redis.call('GET', KEYS[1]) or '0'
+return {generation, redis.call('GET', KEYS[1] .. ':' .. generation .. ':' .. ARGV[1])}
+`
+
+// invalidateScript bumps the generation of every coin in KEYS
+const invalidateScript = `
+for _, key in ipairs(KEYS) do
+	redis.call('INCR', key)
+end
+return #KEYS
+`
+
+// Get looks up key among the entries of coin and decodes a hit into dest
+func (c *Cache) Get(ctx context.Context, coin, key string, dest any) (Entry, bool, error) {
+	reply, err := c.client.Eval(ctx, getScript, []string{c.generationKey(coin)}, key)
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	values, _ := reply.([]any)
+	if len(values) != 2 {
+		return Entry{}, false, redis.Error("unexpected cache script reply")
+	}
+	generation, _ := values[0].(string)
+	entry := Entry{key: c.generationKey(coin) + ":" + generation + ":" + key}
+
+	value, ok := values[1].(string)
+	if !ok {
+		return entry, false, nil
+	}
+	if err := json.Unmarshal([]byte(value), dest); err != nil {
+		// A value that no longer decodes, e.g. after an upgrade, is a miss
+		return entry, false, nil
+	}
+	return entry, true, nil
+}
+
+// Set stores value in entry for ttl. A value looked up before the coin was
+// invalidated lands under the old generation and is never served
+func (c *Cache) Set(ctx context.Context, entry Entry, value any, ttl time.Duration) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, entry.key, string(encoded), ttl)
+}
+
+// Invalidate drops every cached entry of coins
+func (c *Cache) Invalidate(ctx context.Context, coins ...string) error {
+	if len(coins) == 0 {
+		return nil
+	}
+	keys := make([]string, len(coins))
+	for i, coin := range coins {
+		keys[i] = c.generationKey(coin)
+	}
+	_, err := c.client.Eval(ctx, invalidateScript, keys)
+	return err
+}
+
+func (c *Cache) generationKey(coin string) string {
+	return c.prefix + coin
+}
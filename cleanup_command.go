@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/notblessy/dexlite/config"
+	"github.com/notblessy/dexlite/db"
+	"github.com/spf13/cobra"
+)
+
+func newCleanupCommand(cfg *config.Config) *cobra.Command {
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:         "cleanup",
+		Short:       "delete expired rows once, or count them with --dry-run",
+		Args:        cobra.NoArgs,
+		Annotations: persistent,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exit(runCleanup(cfg, dryRun))
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "count the expired rows without deleting them")
+	return cmd
+}
+
+// runCleanup implements `dexlite cleanup`, one pass of the cleanup worker
+// under the configured retention. With --dry-run it lists how many rows each
+// retention rule would delete instead
+func runCleanup(cfg *config.Config, dryRun bool) int {
+	database := db.New(cfg.Database.Driver, cfg.Database.DSN)
+	prepareSchema(cfg, database)
+
+	sessions, err := newSessions(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cleanup: %v\n", err)
+		return 2
+	}
+	cleanup := newCleanupWorker(cfg, database, db.NewWriteGate(database), newRetentionRules(cfg), sessions)
+
+	ctx := context.Background()
+	if !dryRun {
+		if err := cleanup.Cleanup(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "cleanup: %v\n", err)
+			return 2
+		}
+		return 0
+	}
+
+	expiring, err := cleanup.DryRun(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cleanup: %v\n", err)
+		return 2
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RULE\tKEEP\tBEFORE\tROWS")
+	for _, rule := range expiring {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", rule.Rule, rule.Rule.Keep, rule.Cutoff.UTC().Format(time.RFC3339), rule.Rows)
+	}
+	w.Flush()
+	return 0
+}
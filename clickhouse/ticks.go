@@ -0,0 +1,165 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/notblessy/dexlite/metrics"
+	"github.com/notblessy/dexlite/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DEFAULT_TICKS_TABLE    = "ticks"
+	DEFAULT_FLUSH_INTERVAL = 5 * time.Second
+	// MAX_PENDING_TICKS caps the ticks held while ClickHouse is unreachable,
+	// the oldest are dropped beyond it
+	MAX_PENDING_TICKS = 500000
+	// shutdownFlushTimeout bounds the last flush once the sink is stopped
+	shutdownFlushTimeout = 10 * time.Second
+)
+
+// tickRow is one row of the ticks table. At is in the basic DateTime64
+// format, read as UTC
+type tickRow struct {
+	Coin     string  `json:"coin"`
+	Exchange string  `json:"exchange"`
+	Region   string  `json:"region"`
+	Price    float64 `json:"price"`
+	At       string  `json:"at"`
+}
+
+// TickSink copies ticks to a ClickHouse table in batches. The table is
+// created on the first flush, partitioned by month and expiring rows after
+// the retention it was created with
+type TickSink struct {
+	client    *Client
+	table     string
+	retention time.Duration
+	interval  time.Duration
+	region    string
+
+	mu       sync.Mutex
+	pending  []tickRow
+	migrated bool
+}
+
+// NewTickSink creates a sink writing to table every interval and keeping
+// ticks for retention
+func NewTickSink(client *Client, table string, retention, interval time.Duration) *TickSink {
+	return &TickSink{
+		client:    client,
+		table:     table,
+		retention: retention,
+		interval:  interval,
+	}
+}
+
+// SetRegion tags every tick with the region this instance collects from
+func (s *TickSink) SetRegion(region string) {
+	s.region = region
+}
+
+// Write queues prices for the next flush. It never blocks on ClickHouse
+func (s *TickSink) Write(prices []models.CoinPrice) {
+	if len(prices) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, price := range prices {
+		s.pending = append(s.pending, tickRow{
+			Coin:     price.Coin,
+			Exchange: price.Exchange,
+			Region:   s.region,
+			Price:    price.Price,
+			At:       price.CreatedAt.UTC().Format("2006-01-02 15:04:05.000"),
+		})
+	}
+	s.trim()
+}
+
+// Start flushes queued ticks every interval until ctx is cancelled, then
+// flushes once more
+func (s *TickSink) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+			s.flush(flushCtx)
+			cancel()
+			log.Info().Msg("ClickHouse tick sink shutting down")
+			return
+		case <-ticker.C:
+			s.flush(ctx)
+		}
+	}
+}
+
+// Migrate creates the ticks table if it doesn't exist. Changing the
+// retention later needs an ALTER TABLE ... MODIFY TTL by hand
+func (s *TickSink) Migrate(ctx context.Context) error {
+	return s.client.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	coin LowCardinality(String),
+	exchange LowCardinality(String),
+	region LowCardinality(String),
+	price Float64,
+	at DateTime64(3, 'UTC')
+) ENGINE = MergeTree
+PARTITION BY toYYYYMM(at)
+ORDER BY (coin, exchange, at)
+TTL toDateTime(at) + INTERVAL %d SECOND`, s.table, int64(s.retention.Seconds())))
+}
+
+// flush inserts the queued ticks in one request. They are queued again when
+// the insert fails, to be retried with the next flush
+func (s *TickSink) flush(ctx context.Context) {
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = nil
+	migrated := s.migrated
+	s.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	var err error
+	if !migrated {
+		err = s.Migrate(ctx)
+	}
+	if err == nil {
+		rows := make([]any, len(batch))
+		for i := range batch {
+			rows[i] = batch[i]
+		}
+		err = s.client.Insert(ctx, s.table, rows)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		log.Error().Err(err).Int("rows", len(batch)).Msg("Error writing ticks to ClickHouse")
+		s.pending = append(batch, s.pending...)
+		s.trim()
+		return
+	}
+	s.migrated = true
+	metrics.ClickHouseTicksTotal.WithLabelValues(metrics.TICKS_STORED).Add(float64(len(batch)))
+}
+
+// trim drops the oldest queued ticks beyond MAX_PENDING_TICKS. Callers hold mu
+func (s *TickSink) trim() {
+	if over := len(s.pending) - MAX_PENDING_TICKS; over > 0 {
+		s.pending = s.pending[over:]
+		metrics.ClickHouseTicksTotal.WithLabelValues(metrics.TICKS_DROPPED).Add(float64(over))
+	}
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	sqlite "github.com/glebarez/go-sqlite"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrPricesRejected wraps insert errors the database would return again on
+// every attempt, like a constraint violation or a value out of range, for
+// prices that were dead-lettered while the rest of their batch was stored
+var ErrPricesRejected = errors.New("prices rejected by the database")
+
+// How a failed insert is handled
+type errorClass int
+
+const (
+	// errorUnknown is not retried but dead-lettered, so the prices can be
+	// replayed once whatever went wrong is fixed
+	errorUnknown errorClass = iota
+	// errorTransient is a lost connection, a serialization failure or a
+	// busy database, retried and then dead-lettered
+	errorTransient
+	// errorPermanent is bad data, not retried but stored row by row so only
+	// the bad rows are dead-lettered
+	errorPermanent
+)
+
+// Primary SQLite result codes, the extended ones carry them in the low byte
+const (
+	sqliteBusy       = 5
+	sqliteLocked     = 6
+	sqliteTooBig     = 18
+	sqliteConstraint = 19
+	sqliteMismatch   = 20
+	sqliteRange      = 25
+)
+
+// MySQL lock wait timeout, reported with the generic HY000 SQLSTATE
+const mysqlLockWaitTimeout = 1205
+
+// classify tells how an insert that failed with err is handled
+func classify(err error) errorClass {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return errorUnknown
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return classifySQLState(pgErr.Code)
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		if mysqlErr.Number == mysqlLockWaitTimeout {
+			return errorTransient
+		}
+		return classifySQLState(string(mysqlErr.SQLState[:]))
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() & 0xff {
+		case sqliteBusy, sqliteLocked:
+			return errorTransient
+		case sqliteTooBig, sqliteConstraint, sqliteMismatch, sqliteRange:
+			return errorPermanent
+		}
+		return errorUnknown
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, mysql.ErrInvalidConn) || pgconn.SafeToRetry(err) {
+		return errorTransient
+	}
+	return errorUnknown
+}
+
+// classifySQLState classifies by SQLSTATE class: connection exceptions,
+// transaction rollbacks like serialization failures and deadlocks, and an
+// overloaded or restarting server are transient, data exceptions and
+// integrity constraint violations are permanent
+func classifySQLState(state string) errorClass {
+	switch {
+	case strings.HasPrefix(state, "08"), strings.HasPrefix(state, "40"), strings.HasPrefix(state, "53"),
+		state == "57P01", state == "57P02", state == "57P03":
+		return errorTransient
+	case strings.HasPrefix(state, "22"), strings.HasPrefix(state, "23"):
+		return errorPermanent
+	}
+	return errorUnknown
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// mysqlState returns a MySQL error with an SQLSTATE
+func mysqlState(number uint16, state string) *mysql.MySQLError {
+	err := &mysql.MySQLError{Number: number}
+	copy(err.SQLState[:], state)
+	return err
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want errorClass
+	}{
+		{name: "postgres serialization failure", err: &pgconn.PgError{Code: "40001"}, want: errorTransient},
+		{name: "postgres deadlock", err: &pgconn.PgError{Code: "40P01"}, want: errorTransient},
+		{name: "postgres connection failure", err: &pgconn.PgError{Code: "08006"}, want: errorTransient},
+		{name: "postgres too many connections", err: &pgconn.PgError{Code: "53300"}, want: errorTransient},
+		{name: "postgres admin shutdown", err: &pgconn.PgError{Code: "57P01"}, want: errorTransient},
+		{name: "postgres unique violation", err: &pgconn.PgError{Code: "23505"}, want: errorPermanent},
+		{name: "postgres numeric out of range", err: &pgconn.PgError{Code: "22003"}, want: errorPermanent},
+		{name: "postgres undefined table", err: &pgconn.PgError{Code: "42P01"}, want: errorUnknown},
+		{name: "postgres query canceled", err: &pgconn.PgError{Code: "57014"}, want: errorUnknown},
+		{name: "mysql lock wait timeout", err: mysqlState(1205, "HY000"), want: errorTransient},
+		{name: "mysql deadlock", err: mysqlState(1213, "40001"), want: errorTransient},
+		{name: "mysql duplicate entry", err: mysqlState(1062, "23000"), want: errorPermanent},
+		{name: "mysql out of range", err: mysqlState(1264, "22003"), want: errorPermanent},
+		{name: "mysql unknown column", err: mysqlState(1054, "42S22"), want: errorUnknown},
+		{name: "mysql invalid connection", err: mysql.ErrInvalidConn, want: errorTransient},
+		{name: "bad connection", err: driver.ErrBadConn, want: errorTransient},
+		{name: "connection cut", err: io.ErrUnexpectedEOF, want: errorTransient},
+		{name: "network error", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, want: errorTransient},
+		{name: "wrapped", err: fmt.Errorf("inserting: %w", &pgconn.PgError{Code: "23505"}), want: errorPermanent},
+		{name: "canceled", err: context.Canceled, want: errorUnknown},
+		{name: "deadline", err: fmt.Errorf("inserting: %w", context.DeadlineExceeded), want: errorUnknown},
+		{name: "anything else", err: errors.New("something broke"), want: errorUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classify(tt.err); got != tt.want {
+				t.Fatalf("classify(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,413 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/notblessy/dexlite/models"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SCHEMA_LOCK_TTL is how long a schema_locks row outlives the last heartbeat
+// of its process
+const SCHEMA_LOCK_TTL = 1 * time.Minute
+
+// SCHEMA_LOCK_POLL is how often a blocked worker or migration checks again,
+// and how often a writing process checks for a migration
+const SCHEMA_LOCK_POLL = 1 * time.Second
+
+// SCHEMA_LOCK_IDLE is how long a process keeps its row after its last write,
+// so steady writes don't touch the row each time
+const SCHEMA_LOCK_IDLE = 10 * time.Second
+
+// MIGRATION_DRAIN_TIMEOUT is how long a migration waits for the workers of
+// other processes before giving up
+const MIGRATION_DRAIN_TIMEOUT = 5 * time.Minute
+
+// ErrMigrationRunning is returned by Pause while another process migrates
+var ErrMigrationRunning = errors.New("another migration is running")
+
+var gates atomic.Int64
+
+// WriteGate keeps workers from writing while a migration changes the schema,
+// in this process and in every other one sharing the database. Workers hold
+// the gate around their writes, so Pause waits for in-flight writes to finish
+// and blocks new ones until Resume is called. Across processes the gate goes
+// through the schema_locks table, `dexlite migrate` takes it as well. Only the
+// first writer of a process checks the table, the others are counted in
+// memory while one heartbeat keeps the process's row alive and watches for a
+// migration. A nil gate never blocks
+type WriteGate struct {
+	mu sync.RWMutex
+	db *gorm.DB
+	// holder names this gate's row in schema_locks
+	holder string
+
+	// lockMu guards the fields below and serializes writes to the row
+	lockMu   sync.Mutex
+	prepared bool
+	// writers counts the writes of this process in flight
+	writers int
+	// writing is open while the row says this process writes, closing it
+	// stops the heartbeat
+	writing chan struct{}
+	// migrator names another process's migration the heartbeat saw, new
+	// writes wait for it while set
+	migrator  string
+	lastLeave time.Time
+	// migrating stops the heartbeat of the migration row
+	migrating chan struct{}
+}
+
+// NewWriteGate creates a gate coordinating through database. A gate without a
+// database only holds off the workers of its own process
+func NewWriteGate(database *gorm.DB) *WriteGate {
+	host, _ := os.Hostname()
+
+	return &WriteGate{
+		db:     database,
+		holder: fmt.Sprintf("%s:%d:%d", host, os.Getpid(), gates.Add(1)),
+	}
+}
+
+// Enter is called by a worker before it starts writing. It waits while a
+// migration holds the schema
+func (g *WriteGate) Enter() {
+	if g == nil {
+		return
+	}
+	g.mu.RLock()
+	if g.db == nil {
+		return
+	}
+
+	for waiting := false; ; waiting = true {
+		migrator, err := g.register()
+		if err != nil {
+			// The worker's own writes fail as well if the database is down
+			log.Error().Err(err).Msg("Error registering with the schema lock, writing anyway")
+			return
+		}
+		if migrator == "" {
+			return
+		}
+		if !waiting {
+			log.Info().Str("migrator", migrator).Msg("Waiting for a migration to finish")
+		}
+		time.Sleep(SCHEMA_LOCK_POLL)
+	}
+}
+
+// Leave is called by a worker once its writes are done. The process's row
+// is released by the heartbeat once it has been idle for a while, or as soon
+// as a migration waits for it
+func (g *WriteGate) Leave() {
+	if g == nil {
+		return
+	}
+	if g.db != nil {
+		g.lockMu.Lock()
+		g.writers--
+		g.lastLeave = time.Now()
+		g.lockMu.Unlock()
+	}
+	g.mu.RUnlock()
+}
+
+// Pause blocks until running writes finish and holds off new ones, here and
+// in other processes. It fails when another process migrates, or when the
+// workers of another process are still writing after MIGRATION_DRAIN_TIMEOUT
+func (g *WriteGate) Pause() error {
+	g.mu.Lock()
+	if g.db == nil {
+		return nil
+	}
+
+	if err := g.lockSchema(); err != nil {
+		g.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Resume lets workers write again
+func (g *WriteGate) Resume() {
+	if g.db != nil {
+		g.unlockSchema()
+	}
+	g.mu.Unlock()
+}
+
+// register counts a write of this process in, unless another process holds
+// the schema, in which case its migrator is returned. Only the first write
+// since the row was released goes to the database
+func (g *WriteGate) register() (string, error) {
+	g.lockMu.Lock()
+	defer g.lockMu.Unlock()
+
+	if g.writing != nil {
+		if g.migrator != "" {
+			return g.migrator, nil
+		}
+		g.writers++
+		return "", nil
+	}
+
+	migrator, err := g.tryRegister()
+	if migrator != "" {
+		return migrator, nil
+	}
+
+	g.writers++
+	g.writing = make(chan struct{})
+	go g.watch(g.writing)
+	return "", err
+}
+
+// errSchemaHeld rolls back a registration that found the schema held
+var errSchemaHeld = errors.New("schema held by a migration")
+
+func (g *WriteGate) tryRegister() (string, error) {
+	if err := g.prepare(); err != nil {
+		return "", err
+	}
+
+	var migrator string
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		// The row is written before the migration row is read, so on SQLite,
+		// which has no row locks, the write lock orders this against a
+		// migration taking the schema
+		err := tx.Save(&models.SchemaLock{Holder: g.holder, Writers: 1, HeartbeatAt: time.Now()}).Error
+		if err != nil {
+			return err
+		}
+
+		// The migration takes the same row before waiting for writers, so
+		// either it sees this process or this process sees it
+		var lock models.SchemaLock
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("holder = ?", models.SCHEMA_LOCK_MIGRATION).
+			Take(&lock).Error
+		if err != nil {
+			return err
+		}
+		if g.held(lock) {
+			migrator = lock.Migrator
+			return errSchemaHeld
+		}
+		return nil
+	})
+	if errors.Is(err, errSchemaHeld) {
+		return migrator, nil
+	}
+	return "", err
+}
+
+// held reports whether the migration row is held by another live process
+func (g *WriteGate) held(lock models.SchemaLock) bool {
+	return lock.Migrator != "" && lock.Migrator != g.holder && time.Since(lock.HeartbeatAt) < SCHEMA_LOCK_TTL
+}
+
+// watch keeps this process's row alive while it writes, and releases it once
+// no write is in flight and either a migration is waiting or the process has
+// been idle for SCHEMA_LOCK_IDLE. It checks the migration row every
+// SCHEMA_LOCK_POLL
+func (g *WriteGate) watch(stop chan struct{}) {
+	ticker := time.NewTicker(SCHEMA_LOCK_POLL)
+	defer ticker.Stop()
+	beatAt := time.Now()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		var lock models.SchemaLock
+		err := g.db.Where("holder = ?", models.SCHEMA_LOCK_MIGRATION).Take(&lock).Error
+		if err != nil {
+			log.Warn().Err(err).Msg("Error checking the migration lock")
+		}
+
+		g.lockMu.Lock()
+		if err == nil && g.held(lock) {
+			g.migrator = lock.Migrator
+		} else if err == nil {
+			g.migrator = ""
+		}
+		if g.writers == 0 && (g.migrator != "" || time.Since(g.lastLeave) >= SCHEMA_LOCK_IDLE) {
+			close(g.writing)
+			g.writing = nil
+			g.migrator = ""
+			err := g.db.Save(&models.SchemaLock{Holder: g.holder, HeartbeatAt: time.Now()}).Error
+			g.lockMu.Unlock()
+			if err != nil {
+				log.Error().Err(err).Msg("Error releasing the schema lock")
+			}
+			return
+		}
+		g.lockMu.Unlock()
+
+		if time.Since(beatAt) >= SCHEMA_LOCK_TTL/4 {
+			beatAt = time.Now()
+			err := g.db.Model(&models.SchemaLock{}).Where("holder = ?", g.holder).Update("heartbeat_at", beatAt).Error
+			if err != nil {
+				log.Warn().Err(err).Str("holder", g.holder).Msg("Error refreshing the schema lock")
+			}
+		}
+	}
+}
+
+// prepare creates the schema_locks table and its migration row on first use
+func (g *WriteGate) prepare() error {
+	if g.prepared {
+		return nil
+	}
+	if err := g.db.AutoMigrate(&models.SchemaLock{}); err != nil {
+		return err
+	}
+	err := g.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.SchemaLock{Holder: models.SCHEMA_LOCK_MIGRATION, HeartbeatAt: time.Now()}).Error
+	if err != nil {
+		return err
+	}
+	g.prepared = true
+	return nil
+}
+
+// lockSchema takes the migration row and waits for the writers of other
+// processes to finish
+func (g *WriteGate) lockSchema() error {
+	g.lockMu.Lock()
+	defer g.lockMu.Unlock()
+
+	if err := g.prepare(); err != nil {
+		return err
+	}
+
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		var lock models.SchemaLock
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("holder = ?", models.SCHEMA_LOCK_MIGRATION).
+			Take(&lock).Error
+		if err != nil {
+			return err
+		}
+		if g.held(lock) {
+			return fmt.Errorf("%w: %s", ErrMigrationRunning, lock.Migrator)
+		}
+
+		return tx.Model(&lock).Updates(map[string]interface{}{
+			"migrator":     g.holder,
+			"heartbeat_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	g.migrating = make(chan struct{})
+	go g.beat(models.SCHEMA_LOCK_MIGRATION, g.migrating)
+
+	// Rows of processes that are gone are dropped, idle live ones are saved
+	// again on their next write
+	err = g.db.Where("holder <> ? AND heartbeat_at < ?", models.SCHEMA_LOCK_MIGRATION, time.Now().Add(-SCHEMA_LOCK_TTL)).
+		Delete(&models.SchemaLock{}).Error
+	if err != nil {
+		log.Warn().Err(err).Msg("Error pruning stale schema locks")
+	}
+
+	deadline := time.Now().Add(MIGRATION_DRAIN_TIMEOUT)
+	for waiting := false; ; waiting = true {
+		writers, err := g.otherWriters()
+		if err != nil {
+			g.release()
+			return err
+		}
+		if writers == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			g.release()
+			return fmt.Errorf("%d other processes still writing after %s", writers, MIGRATION_DRAIN_TIMEOUT)
+		}
+		if !waiting {
+			log.Info().Int("processes", writers).Msg("Waiting for the workers of other processes to finish")
+		}
+		time.Sleep(SCHEMA_LOCK_POLL)
+	}
+}
+
+// otherWriters counts the other live processes that are writing
+func (g *WriteGate) otherWriters() (int, error) {
+	var locks []models.SchemaLock
+	err := g.db.Where("holder NOT IN ? AND writers > 0", []string{models.SCHEMA_LOCK_MIGRATION, g.holder}).
+		Find(&locks).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var writers int
+	for _, lock := range locks {
+		if time.Since(lock.HeartbeatAt) < SCHEMA_LOCK_TTL {
+			writers += lock.Writers
+		}
+	}
+	return writers, nil
+}
+
+func (g *WriteGate) unlockSchema() {
+	g.lockMu.Lock()
+	defer g.lockMu.Unlock()
+
+	g.release()
+}
+
+// release gives up the migration row. Should it fail, the row expires once
+// its heartbeat is older than SCHEMA_LOCK_TTL
+func (g *WriteGate) release() {
+	close(g.migrating)
+	g.migrating = nil
+
+	err := g.db.Model(&models.SchemaLock{}).
+		Where("holder = ? AND migrator = ?", models.SCHEMA_LOCK_MIGRATION, g.holder).
+		Update("migrator", "").Error
+	if err != nil {
+		log.Error().Err(err).Msg("Error releasing the migration lock")
+	}
+}
+
+// beat keeps holder's row alive until stop is closed
+func (g *WriteGate) beat(holder string, stop chan struct{}) {
+	ticker := time.NewTicker(SCHEMA_LOCK_TTL / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := g.db.Model(&models.SchemaLock{}).Where("holder = ?", holder).Update("heartbeat_at", time.Now()).Error
+			if err != nil {
+				log.Warn().Err(err).Str("holder", holder).Msg("Error refreshing the schema lock")
+			}
+		}
+	}
+}
+
+// MigrateWithGate pauses workers, migrates, then resumes them
+func MigrateWithGate(database *gorm.DB, gate *WriteGate) error {
+	if err := gate.Pause(); err != nil {
+		return err
+	}
+	defer gate.Resume()
+
+	return Migrate(database)
+}
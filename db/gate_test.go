@@ -0,0 +1,117 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// gateWait is long enough for a gate blocked on another process to have
+// checked the schema_locks table at least once
+const gateWait = SCHEMA_LOCK_POLL + 500*time.Millisecond
+
+// async runs fn and returns a channel that yields its error once it returns
+func async(fn func() error) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	return done
+}
+
+// blocked fails the test when done yields within gateWait
+func blocked(t *testing.T, done <-chan error, what string) {
+	t.Helper()
+
+	select {
+	case err := <-done:
+		t.Fatalf("%s returned (%v) while it should wait", what, err)
+	case <-time.After(gateWait):
+	}
+}
+
+// unblocked fails the test when done doesn't yield within a few polls
+func unblocked(t *testing.T, done <-chan error, what string) {
+	t.Helper()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+	case <-time.After(5 * SCHEMA_LOCK_POLL):
+		t.Fatalf("%s still waiting", what)
+	}
+}
+
+func TestWriteGate(t *testing.T) {
+	tests := []struct {
+		name string
+		// shared runs the worker and the migration through one gate, as in one
+		// process, rather than through one gate each, as in two
+		shared bool
+		// migrateFirst pauses the gate before the worker enters it
+		migrateFirst bool
+	}{
+		{name: "migration waits for a writer", shared: true},
+		{name: "writer waits for a migration", shared: true, migrateFirst: true},
+		{name: "migration waits for a writer of another process"},
+		{name: "writer waits for a migration of another process", migrateFirst: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := testDB(t)
+			worker := NewWriteGate(database)
+			migration := worker
+			if !tt.shared {
+				migration = NewWriteGate(database)
+			}
+
+			enter := func() error {
+				worker.Enter()
+				return nil
+			}
+
+			if tt.migrateFirst {
+				if err := migration.Pause(); err != nil {
+					t.Fatalf("Pause: %v", err)
+				}
+				entered := async(enter)
+				blocked(t, entered, "Enter")
+
+				migration.Resume()
+				unblocked(t, entered, "Enter")
+				worker.Leave()
+				return
+			}
+
+			worker.Enter()
+			paused := async(migration.Pause)
+			blocked(t, paused, "Pause")
+
+			worker.Leave()
+			unblocked(t, paused, "Pause")
+			migration.Resume()
+		})
+	}
+}
+
+func TestPauseWhileMigrating(t *testing.T) {
+	database := testDB(t)
+	first := NewWriteGate(database)
+	second := NewWriteGate(database)
+
+	if err := first.Pause(); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if err := second.Pause(); !errors.Is(err, ErrMigrationRunning) {
+		t.Fatalf("second Pause error = %v, want %v", err, ErrMigrationRunning)
+	}
+	first.Resume()
+
+	// Once released the schema can be taken again
+	if err := MigrateWithGate(database, second); err != nil {
+		t.Fatalf("MigrateWithGate: %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package db
+
+import (
+	"time"
+
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+)
+
+// VenueIncidents returns the status page incidents of exchanges that were
+// ongoing at some point between from and to, oldest first
+func VenueIncidents(database *gorm.DB, exchanges []string, from, to time.Time) ([]models.VenueIncident, error) {
+	var incidents []models.VenueIncident
+	if len(exchanges) == 0 {
+		return incidents, nil
+	}
+
+	err := database.Where("exchange IN ? AND started_at <= ? AND (resolved_at IS NULL OR resolved_at >= ?)", exchanges, to, from).
+		Order("started_at ASC, id ASC").
+		Find(&incidents).Error
+	return incidents, err
+}
@@ -0,0 +1,26 @@
+package db
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// LatestPer narrows query to the newest row of each group of columns, e.g.
+// LatestPer(query, "coin", "exchange"), ordered by the columns. query must
+// name its model. Postgres uses DISTINCT ON, other drivers rank the matching
+// rows with a window function
+func LatestPer(query *gorm.DB, columns ...string) *gorm.DB {
+	partition := strings.Join(columns, ", ")
+	order := strings.Join(columns, " ASC, ") + " ASC"
+
+	if IsPostgres(query) {
+		return query.Select("DISTINCT ON (" + partition + ") *").Order(order + ", created_at DESC")
+	}
+
+	ranked := query.Select("*, ROW_NUMBER() OVER (PARTITION BY " + partition + " ORDER BY created_at DESC, id DESC) AS latest_rank")
+	return query.Session(&gorm.Session{NewDB: true}).
+		Table("(?) AS latest", ranked).
+		Where("latest_rank = 1").
+		Order(order)
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// MEMORY_DSN names the in-memory SQLite database every connection of the
+// process shares. The memdb VFS keeps it in memory while letting connections
+// lock it like a file, so writers wait for each other as with NewSQLite
+const MEMORY_DSN = "file:/dexlite?vfs=memdb&_pragma=busy_timeout(5000)&_txlock=immediate"
+
+// DEFAULT_MEMORY_CAPACITY is how many rows of each series the memory driver
+// keeps when no capacity is configured
+const DEFAULT_MEMORY_CAPACITY = 1000
+
+// boundedSeries lists the tables BoundSeries caps. An insert trims the
+// series, partitioned by partition and ordered by order, of the key values
+// it wrote
+var boundedSeries = map[string]struct{ key, partition, order string }{
+	"coin_prices":         {"coin", "coin, exchange, region", "created_at"},
+	"funding_rates":       {"coin", "coin, exchange", "created_at"},
+	"mark_prices":         {"coin", "coin, exchange", "created_at"},
+	"index_prices":        {"coin", "coin", "created_at"},
+	"orderbook_snapshots": {"coin", "coin, exchange", "created_at"},
+	"coin_candles":        {"coin", "coin, exchange, resolution", "open_time"},
+	"spread_alerts":       {"coin", "coin", "detected_at"},
+	"dead_letters":        {"coin", "coin, exchange", "created_at"},
+	"worker_runs":         {"worker", "worker", "started_at"},
+	"jobs":                {"kind", "kind", "created_at"},
+	"venue_incidents":     {"exchange", "exchange", "started_at"},
+	"source_slas":         {"exchange", "exchange", "month"},
+	"source_scores":       {"exchange", "exchange", "hour"},
+}
+
+// managedTables only grow as users, admins or config add rows, each capped
+// by its API, so the memory driver keeps them whole
+var managedTables = map[string]bool{
+	"tracked_coins":            true,
+	"notification_channels":    true,
+	"price_alerts":             true,
+	"users":                    true,
+	"watchlist_coins":          true,
+	"notification_preferences": true,
+}
+
+// NewMemory opens a database that only lives in process memory, for demo and
+// edge deployments serving live prices without persistence. It speaks SQLite,
+// so everything that runs on NewSQLite runs on it, and is gone on exit
+func NewMemory() *gorm.DB {
+	db, err := gorm.Open(openMemory(), &gorm.Config{})
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+func openMemory() gorm.Dialector {
+	return sqlite.Open(MEMORY_DSN)
+}
+
+// BoundSeries turns every table the workers append to into ring buffers of
+// capacity rows: each insert deletes the oldest rows beyond capacity of the
+// series it wrote to. It fails for a table that is neither bounded nor
+// managed, so a new table can't grow without limit in memory
+func BoundSeries(database *gorm.DB, capacity int) error {
+	for _, model := range Models() {
+		statement := &gorm.Statement{DB: database}
+		if err := statement.Parse(model); err != nil {
+			return err
+		}
+		if _, ok := boundedSeries[statement.Table]; !ok && !managedTables[statement.Table] {
+			return fmt.Errorf("table %s has no bound for the memory driver", statement.Table)
+		}
+	}
+
+	return database.Callback().Create().After("gorm:create").Register("dexlite:bound_series", func(tx *gorm.DB) {
+		series, ok := boundedSeries[tx.Statement.Table]
+		if tx.Error != nil || !ok || tx.Statement.Schema == nil {
+			return
+		}
+		keys := insertedKeys(tx, series.key)
+		if len(keys) == 0 {
+			return
+		}
+
+		err := tx.Session(&gorm.Session{NewDB: true}).Exec(fmt.Sprintf(`DELETE FROM %[1]s WHERE id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY %[2]s ORDER BY %[3]s DESC, id DESC) AS age
+				FROM %[1]s
+				WHERE %[4]s IN ?
+			) ranked
+			WHERE age > ?
+		)`, tx.Statement.Table, series.partition, series.order, series.key), keys, capacity).Error
+		if err != nil {
+			tx.AddError(fmt.Errorf("bounding %s: %w", tx.Statement.Table, err))
+		}
+	})
+}
+
+// insertedKeys returns the distinct values of column in the rows a create
+// statement wrote
+func insertedKeys(tx *gorm.DB, column string) []string {
+	field := tx.Statement.Schema.LookUpField(column)
+	if field == nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var keys []string
+	add := func(row reflect.Value) {
+		value, _ := field.ValueOf(tx.Statement.Context, row)
+		if key, ok := value.(string); ok && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	rows := reflect.Indirect(tx.Statement.ReflectValue)
+	switch rows.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rows.Len(); i++ {
+			add(reflect.Indirect(rows.Index(i)))
+		}
+	case reflect.Struct:
+		add(rows)
+	}
+	return keys
+}
@@ -0,0 +1,386 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+)
+
+// Models lists every model Migrate creates a table for
+func Models() []interface{} {
+	return []interface{}{
+		&models.CoinPrice{},
+		&models.SourceSLA{},
+		&models.WorkerRun{},
+		&models.DeadLetter{},
+		&models.TrackedCoin{},
+		&models.NotificationChannel{},
+		&models.CoinCandle{},
+		&models.SpreadAlert{},
+		&models.PriceAlert{},
+		&models.FundingRate{},
+		&models.IndexPrice{},
+		&models.MarkPrice{},
+		&models.OrderbookSnapshot{},
+		&models.User{},
+		&models.WatchlistCoin{},
+		&models.SourceScore{},
+		&models.Job{},
+		&models.VenueIncident{},
+		&models.NotificationPreference{},
+	}
+}
+
+// Migration is one versioned schema change. Migrations apply in the order
+// Migrations lists them, each in a transaction with its record in
+// schema_migrations, and roll back in reverse. Rollback is nil for changes
+// that can't be undone. MySQL commits DDL on its own, so a migration that
+// fails there halfway must be finished or undone by hand
+type Migration struct {
+	ID          string
+	Description string
+	Migrate     func(tx *gorm.DB) error
+	Rollback    func(tx *gorm.DB) error
+}
+
+// Migrations lists every schema change, oldest first. New changes are
+// appended with the next number, shipped ones are never edited or reordered.
+// The first ones bring databases created before migrations were versioned
+// up to date and do nothing on new ones
+func Migrations() []Migration {
+	return []Migration{
+		{
+			ID:          "0001_backfill_exchange",
+			Description: "tag prices stored before they carried an exchange",
+			Migrate:     backfillExchange,
+			// The tagged prices keep their exchange, which older versions
+			// read as well
+			Rollback: func(tx *gorm.DB) error { return nil },
+		},
+		{
+			ID:          "0002_backfill_bucket",
+			Description: "add the bucket column to prices stored before it existed",
+			Migrate:     backfillBucket,
+			Rollback:    dropBucket,
+		},
+		{
+			ID:          "0003_create_tables",
+			Description: "create every table",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(tables0003()...)
+			},
+			// Databases upgraded to it already held some of these tables,
+			// coin_prices among them, so dropping them would lose data
+			// stored before migrations were versioned
+			Rollback: nil,
+		},
+		{
+			ID:          "0004_drop_replaced_indexes",
+			Description: "drop the unique price indexes without region and bucket",
+			Migrate:     dropReplacedIndexes,
+			// The dropped indexes would reject prices stored since, and no
+			// version needs them, so they are not restored
+			Rollback: func(tx *gorm.DB) error { return nil },
+		},
+		{
+			ID:          "0005_create_venue_incidents",
+			Description: "create the table of exchange status page incidents",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.VenueIncident{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.VenueIncident{})
+			},
+		},
+		{
+			ID:          "0006_index_price_writes",
+			Description: "index prices by coin and write time for long polls",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.Exec("CREATE INDEX " + PRICE_WRITES_INDEX + " ON coin_prices (coin, updated_at)").Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropIndex(models.CoinPrice{}.TableName(), PRICE_WRITES_INDEX)
+			},
+		},
+		{
+			ID:          "0007_notification_preferences",
+			Description: "add alert severities and per-user notification preferences",
+			Migrate: func(tx *gorm.DB) error {
+				if err := tx.Migrator().AddColumn(&priceAlertSeverity0007{}, "Severity"); err != nil {
+					return err
+				}
+				return tx.AutoMigrate(&notificationPreference0007{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				if err := tx.Migrator().DropTable(&notificationPreference0007{}); err != nil {
+					return err
+				}
+				return tx.Migrator().DropColumn(&priceAlertSeverity0007{}, "Severity")
+			},
+		},
+		{
+			ID:          "0008_confirm_notification_targets",
+			Description: "confirm email addresses and link Telegram chats before notifying them",
+			Migrate: func(tx *gorm.DB) error {
+				migrator := tx.Migrator()
+				for _, column := range []string{"EmailConfirmedAt", "ConfirmationSentAt"} {
+					if err := migrator.AddColumn(&userConfirmation0008{}, column); err != nil {
+						return err
+					}
+				}
+				for _, column := range []string{"TelegramLinkCode", "TelegramLinkExpiresAt"} {
+					if err := migrator.AddColumn(&telegramLink0008{}, column); err != nil {
+						return err
+					}
+				}
+				if err := migrator.CreateIndex(&telegramLink0008{}, "TelegramLinkCode"); err != nil {
+					return err
+				}
+				// No address or chat was confirmed before, they are turned off
+				// until their owners confirm them
+				return tx.Table("notification_preferences").Where("1 = 1").
+					Updates(map[string]interface{}{"email": false, "telegram_chat_id": ""}).Error
+			},
+			// The addresses and chats turned off stay off
+			Rollback: func(tx *gorm.DB) error {
+				migrator := tx.Migrator()
+				if err := migrator.DropIndex(&telegramLink0008{}, "TelegramLinkCode"); err != nil {
+					return err
+				}
+				if err := migrator.DropColumn(&telegramLink0008{}, "TelegramLinkExpiresAt"); err != nil {
+					return err
+				}
+				if err := migrator.DropColumn(&telegramLink0008{}, "TelegramLinkCode"); err != nil {
+					return err
+				}
+				if err := migrator.DropColumn(&userConfirmation0008{}, "ConfirmationSentAt"); err != nil {
+					return err
+				}
+				return migrator.DropColumn(&userConfirmation0008{}, "EmailConfirmedAt")
+			},
+		},
+		{
+			ID:          "0009_widen_coin_columns",
+			Description: "widen coin columns to hold dex-prefixed and long symbols",
+			Migrate: func(tx *gorm.DB) error {
+				return resizeCoinColumns0009(tx, 32)
+			},
+			// Fails while a stored coin is longer than the old width
+			Rollback: func(tx *gorm.DB) error {
+				return resizeCoinColumns0009(tx, 10)
+			},
+		},
+	}
+}
+
+// PRICE_WRITES_INDEX orders a coin's prices by when they were written
+const PRICE_WRITES_INDEX = "idx_coin_prices_coin_updated_at"
+
+// ErrIrreversible is returned when rolling back a migration without Rollback
+var ErrIrreversible = errors.New("migration can't be rolled back")
+
+// MigrationState is a migration and when it was applied, nil while pending
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrate applies every pending migration
+func Migrate(db *gorm.DB) error {
+	_, err := MigrateUp(db)
+	return err
+}
+
+// MigrateUp applies the pending migrations in order and returns the IDs of
+// those applied. It stops at the first that fails
+func MigrateUp(db *gorm.DB) ([]string, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, migration := range Migrations() {
+		if _, ok := applied[migration.ID]; ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Migrate(tx); err != nil {
+				return err
+			}
+			return tx.Create(&models.SchemaMigration{ID: migration.ID, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return ids, fmt.Errorf("migration %s: %w", migration.ID, err)
+		}
+		ids = append(ids, migration.ID)
+	}
+	return ids, nil
+}
+
+// MigrateDown rolls back the last steps applied migrations, newest first, and
+// returns the IDs of those rolled back. It stops at the first that can't be
+// rolled back, including migrations applied by a newer version
+func MigrateDown(db *gorm.DB, steps int) ([]string, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make(map[string]Migration)
+	for _, migration := range Migrations() {
+		migrations[migration.ID] = migration
+	}
+	newest := make([]string, 0, len(applied))
+	for id := range applied {
+		newest = append(newest, id)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(newest)))
+
+	var ids []string
+	for _, id := range newest {
+		if len(ids) == steps {
+			break
+		}
+		migration, ok := migrations[id]
+		if !ok {
+			return ids, fmt.Errorf("migration %s was applied by a newer version, roll it back with that version", id)
+		}
+		if migration.Rollback == nil {
+			return ids, fmt.Errorf("migration %s: %w", id, ErrIrreversible)
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Rollback(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&models.SchemaMigration{ID: id}).Error
+		})
+		if err != nil {
+			return ids, fmt.Errorf("migration %s: %w", id, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// MigrationStates reports every migration and whether it was applied
+func MigrationStates(db *gorm.DB) ([]MigrationState, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	for _, migration := range Migrations() {
+		state := MigrationState{Migration: migration}
+		if at, ok := applied[migration.ID]; ok {
+			state.AppliedAt = &at
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// appliedMigrations returns when each applied migration was applied,
+// creating schema_migrations on first use
+func appliedMigrations(db *gorm.DB) (map[string]time.Time, error) {
+	if err := db.AutoMigrate(&models.SchemaMigration{}); err != nil {
+		return nil, err
+	}
+
+	var records []models.SchemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[string]time.Time, len(records))
+	for _, record := range records {
+		applied[record.ID] = record.AppliedAt
+	}
+	return applied, nil
+}
+
+// REGIONLESS_INDEX is the unique index prices had before they carried a region
+const REGIONLESS_INDEX = "idx_coin_prices_coin_exchange_created_at"
+
+// UNBUCKETED_INDEX is the unique index prices had before they were bucketed
+const UNBUCKETED_INDEX = "idx_coin_prices_coin_exchange_region_created_at"
+
+// dropReplacedIndexes removes the unique indexes prices had before they
+// carried a region, which would reject the same tick collected in two
+// regions, and before they were bucketed
+func dropReplacedIndexes(db *gorm.DB) error {
+	for _, index := range []string{REGIONLESS_INDEX, UNBUCKETED_INDEX} {
+		if !db.Migrator().HasIndex(&models.CoinPrice{}, index) {
+			continue
+		}
+		if err := db.Migrator().DropIndex(&models.CoinPrice{}, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillBucket adds the bucket column to prices stored before it existed,
+// each in a bucket of its own, so it can become NOT NULL and part of the
+// unique index
+func backfillBucket(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.CoinPrice{}) || db.Migrator().HasColumn(&models.CoinPrice{}, "Bucket") {
+		return nil
+	}
+
+	// The column type follows the driver, as AutoMigrate would create it
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&models.CoinPrice{}); err != nil {
+		return err
+	}
+	columnType := db.Dialector.DataTypeOf(stmt.Schema.LookUpField("Bucket"))
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("ALTER TABLE coin_prices ADD COLUMN bucket " + columnType).Error; err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE coin_prices SET bucket = created_at").Error
+	})
+}
+
+// dropBucket removes the bucket column backfillBucket added
+func dropBucket(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.CoinPrice{}) || !db.Migrator().HasColumn(&models.CoinPrice{}, "Bucket") {
+		return nil
+	}
+	return db.Migrator().DropColumn(&models.CoinPrice{}, "Bucket")
+}
+
+// backfillExchange tags rows stored before prices carried an exchange, so the
+// column can become NOT NULL and part of the unique index
+func backfillExchange(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.CoinPrice{}) || !db.Migrator().HasColumn(&models.CoinPrice{}, "Exchange") {
+		return nil
+	}
+
+	return db.Unscoped().Model(&models.CoinPrice{}).
+		Where("exchange IS NULL OR exchange = ''").
+		Update("exchange", models.DEFAULT_EXCHANGE).Error
+}
+
+// SeedTrackedCoins fills an empty tracked_coins table with the configured
+// coins. Once coins are managed through the API the table wins over config
+func SeedTrackedCoins(db *gorm.DB, coins []string) error {
+	var count int64
+	if err := db.Model(&models.TrackedCoin{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	tracked := make([]models.TrackedCoin, len(coins))
+	for i, coin := range coins {
+		tracked[i] = models.TrackedCoin{Coin: coin}
+	}
+	return db.Create(&tracked).Error
+}
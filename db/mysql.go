@@ -0,0 +1,34 @@
+package db
+
+import (
+	"strings"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// MYSQL_PARAMS are added to DSNs that don't set parseTime, so DATETIME
+// columns scan into time.Time and are read and written in UTC
+const MYSQL_PARAMS = "parseTime=true&loc=UTC"
+
+// NewMySQL opens a MySQL or MariaDB database from a go-sql-driver DSN, e.g.
+// dexlite:secret@tcp(localhost:3306)/dexlite. MySQL 8 or MariaDB 10.6 is
+// needed for window functions and SKIP LOCKED
+func NewMySQL(dsn string) *gorm.DB {
+	db, err := gorm.Open(openMySQL(dsn), &gorm.Config{})
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+func openMySQL(dsn string) gorm.Dialector {
+	if !strings.Contains(dsn, "parseTime=") {
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		dsn += separator + MYSQL_PARAMS
+	}
+	return mysql.Open(dsn)
+}
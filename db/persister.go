@@ -0,0 +1,471 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/notblessy/dexlite/cache"
+	"github.com/notblessy/dexlite/metrics"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/stream"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	PERSIST_ATTEMPTS = 3
+	PERSIST_BACKOFF  = 200 * time.Millisecond
+	// PERSIST_BATCH_SIZE is how many prices go into one INSERT statement
+	PERSIST_BATCH_SIZE = 500
+
+	DEFAULT_DEAD_LETTER_FILE = "dead_letters.jsonl"
+)
+
+// upsertPrice replaces the price a venue already has in a bucket, so a
+// restart fetching straight away can't store a second sample for the interval
+var upsertPrice = clause.OnConflict{
+	Columns:   []clause.Column{{Name: "coin"}, {Name: "exchange"}, {Name: "region"}, {Name: "bucket"}},
+	DoUpdates: clause.AssignmentColumns([]string{"price", "confidence", "labels", "source_time", "created_at", "updated_at", "deleted_at"}),
+}
+
+// UpsertPrices inserts prices in batches, replacing any a venue already has in
+// the same bucket
+func UpsertPrices(tx *gorm.DB, prices []models.CoinPrice) error {
+	return tx.Clauses(upsertPrice).CreateInBatches(&prices, PERSIST_BATCH_SIZE).Error
+}
+
+// InsertMissingPrices inserts prices in batches, skipping those whose bucket a
+// venue already has a price in, and returns how many were inserted
+func InsertMissingPrices(tx *gorm.DB, prices []models.CoinPrice) (int64, error) {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&prices, PERSIST_BATCH_SIZE)
+	return result.RowsAffected, result.Error
+}
+
+// Mirror receives a copy of every price stored, e.g. to dual-write a new
+// storage backend. Write must not block on the mirror's own storage
+type Mirror interface {
+	Write(prices []models.CoinPrice)
+}
+
+// Persister stores prices with retries. Prices that still fail are kept as
+// dead letters in the database, or appended to a file when the database
+// itself is unavailable, so no fetched data is silently lost
+type Persister struct {
+	db   *gorm.DB
+	file string
+	// region tags every stored price with where this collector runs
+	region string
+
+	// changed is closed and replaced whenever prices are stored
+	mu      sync.Mutex
+	changed chan struct{}
+	// version is the highest price ID stored so far
+	version uint64
+
+	// hub receives every stored price, nil when nothing streams them
+	hub *stream.Hub
+	// cache is invalidated for every coin stored, nil when responses aren't cached
+	cache *cache.Cache
+	// mirror gets a copy of every price stored, nil when not dual-writing
+	mirror Mirror
+}
+
+func NewPersister(db *gorm.DB, file string) *Persister {
+	if file == "" {
+		file = DEFAULT_DEAD_LETTER_FILE
+	}
+
+	p := &Persister{
+		db:      db,
+		file:    file,
+		changed: make(chan struct{}),
+	}
+
+	var version uint64
+	if err := db.Model(&models.CoinPrice{}).Select("COALESCE(MAX(id), 0)").Scan(&version).Error; err != nil {
+		log.Warn().Err(err).Msg("Failed to read dataset version")
+	}
+	p.version = version
+
+	return p
+}
+
+// SetRegion tags prices stored from now on with region, unless they already
+// carry one
+func (p *Persister) SetRegion(region string) {
+	p.region = region
+}
+
+// SetHub publishes every price stored from now on to hub
+func (p *Persister) SetHub(hub *stream.Hub) {
+	p.hub = hub
+}
+
+// SetCache invalidates cached responses about every coin stored from now on
+func (p *Persister) SetCache(cache *cache.Cache) {
+	p.cache = cache
+}
+
+// SetMirror copies every price stored from now on to mirror
+func (p *Persister) SetMirror(mirror Mirror) {
+	p.mirror = mirror
+}
+
+// Version returns the dataset version, the highest price ID stored so far. It
+// only grows, so two responses with the same version saw the same data
+func (p *Persister) Version() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.version
+}
+
+// Changed returns a channel that is closed the next time prices are stored.
+// Take it before reading so a write in between isn't missed
+func (p *Persister) Changed() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.changed
+}
+
+// notify bumps the dataset version and wakes everyone waiting on Changed
+func (p *Persister) notify(prices ...models.CoinPrice) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, price := range prices {
+		p.version = max(p.version, uint64(price.ID))
+	}
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// invalidate drops cached responses about the coins of prices. A failure
+// only leaves responses stale until their TTL runs out
+func (p *Persister) invalidate(ctx context.Context, prices []models.CoinPrice) {
+	if p.cache == nil {
+		return
+	}
+
+	var coins []string
+	for _, price := range prices {
+		if !slices.Contains(coins, price.Coin) {
+			coins = append(coins, price.Coin)
+		}
+	}
+	if err := p.cache.Invalidate(ctx, coins...); err != nil {
+		log.Warn().Err(err).Strs("coins", coins).Msg("Failed to invalidate cached responses")
+	}
+}
+
+// Save stores prices in one transaction, inserted in batches. Connection and
+// serialization failures are retried with backoff and dead-lettered when they
+// persist, as are errors that can't be told apart. When the database rejects
+// the data itself, like a constraint violation or a value out of range, the
+// prices are stored one by one instead so only the bad ones are left out.
+// Those are dead-lettered for inspection and the error returned wraps
+// ErrPricesRejected, with the ID set only on the prices that were stored
+func (p *Persister) Save(prices []models.CoinPrice) error {
+	return p.SaveContext(context.Background(), prices)
+}
+
+// SaveContext is Save with the inserts traced as part of ctx
+func (p *Persister) SaveContext(ctx context.Context, prices []models.CoinPrice) error {
+	if len(prices) == 0 {
+		return nil
+	}
+
+	// Stamp the fetch time, bucket and region now so retries and replays keep them
+	p.stamp(prices)
+
+	var err error
+	backoff := PERSIST_BACKOFF
+	attempt := 1
+	for ; ; attempt++ {
+		// IDs and write times of a rolled back attempt are cleared before
+		// retrying, polls order ticks by when they were written
+		for i := range prices {
+			prices[i].ID = 0
+			prices[i].UpdatedAt = time.Time{}
+		}
+		err = p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return UpsertPrices(tx, prices)
+		})
+		if err == nil {
+			p.stored(ctx, prices)
+			return nil
+		}
+
+		// Only a failure that may clear up is retried
+		class := classify(err)
+		if class == errorPermanent {
+			return p.saveEach(ctx, prices, err)
+		}
+		if class != errorTransient || attempt == PERSIST_ATTEMPTS {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	metrics.InsertErrorsTotal.Inc()
+	p.deadLetter(prices, err, attempt)
+	return err
+}
+
+// saveEach stores prices one at a time after the database rejected them
+// together with cause, and dead-letters the ones it rejects again
+func (p *Persister) saveEach(ctx context.Context, prices []models.CoinPrice, cause error) error {
+	var stored []models.CoinPrice
+	rejected := 0
+	for i := range prices {
+		prices[i].ID = 0
+		prices[i].UpdatedAt = time.Time{}
+		row := prices[i : i+1]
+		err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return UpsertPrices(tx, row)
+		})
+		if err != nil {
+			row[0].ID = 0
+			p.deadLetter(row, err, 1)
+			rejected++
+			continue
+		}
+		stored = append(stored, prices[i])
+	}
+	if len(stored) > 0 {
+		p.stored(ctx, stored)
+	}
+
+	metrics.RejectedInsertsTotal.Add(float64(rejected))
+	log.Error().Err(cause).Int("rows", len(prices)).Int("rejected", rejected).Msg("Database rejected prices, stored the rest one by one")
+	if rejected == 0 {
+		// The batch failed on something the rows don't do alone, such as
+		// two of them sharing a bucket
+		return nil
+	}
+	return fmt.Errorf("%w: %d of %d prices: %w", ErrPricesRejected, rejected, len(prices), cause)
+}
+
+// InsertMissing stores the prices whose bucket their venue has no price in
+// yet, leaving the stored ones as they are, and passes them on like Save
+// does. It returns how many were stored
+func (p *Persister) InsertMissing(ctx context.Context, prices []models.CoinPrice) (int64, error) {
+	if len(prices) == 0 {
+		return 0, nil
+	}
+	p.stamp(prices)
+
+	// Prices already stored are left out up front, so the IDs the insert
+	// returns belong to the prices passed on
+	missing, err := p.missing(ctx, prices)
+	if err != nil || len(missing) == 0 {
+		return 0, err
+	}
+
+	inserted, err := InsertMissingPrices(p.db.WithContext(ctx), missing)
+	if err != nil {
+		return 0, err
+	}
+	p.stored(ctx, missing)
+	return inserted, nil
+}
+
+// missing returns the prices whose bucket has no price of their series yet
+func (p *Persister) missing(ctx context.Context, prices []models.CoinPrice) ([]models.CoinPrice, error) {
+	type series struct{ coin, exchange, region string }
+	buckets := make(map[series][]time.Time)
+	for _, price := range prices {
+		key := series{price.Coin, price.Exchange, price.Region}
+		buckets[key] = append(buckets[key], price.Bucket)
+	}
+
+	taken := make(map[series]map[int64]bool, len(buckets))
+	for key, times := range buckets {
+		var existing []time.Time
+		// Soft-deleted prices still hold their bucket in the unique index
+		err := p.db.WithContext(ctx).Unscoped().Model(&models.CoinPrice{}).
+			Where("coin = ? AND exchange = ? AND region = ? AND bucket BETWEEN ? AND ?",
+				key.coin, key.exchange, key.region, slices.MinFunc(times, time.Time.Compare), slices.MaxFunc(times, time.Time.Compare)).
+			Pluck("bucket", &existing).Error
+		if err != nil {
+			return nil, err
+		}
+		taken[key] = make(map[int64]bool, len(existing))
+		for _, bucket := range existing {
+			taken[key][bucket.UnixNano()] = true
+		}
+	}
+
+	var missing []models.CoinPrice
+	for _, price := range prices {
+		key := series{price.Coin, price.Exchange, price.Region}
+		if !taken[key][price.Bucket.UnixNano()] {
+			taken[key][price.Bucket.UnixNano()] = true
+			missing = append(missing, price)
+		}
+	}
+	return missing, nil
+}
+
+// stamp sets the fetch time, bucket and region of prices that have none
+func (p *Persister) stamp(prices []models.CoinPrice) {
+	now := time.Now()
+	for i := range prices {
+		if prices[i].CreatedAt.IsZero() {
+			prices[i].CreatedAt = now
+		}
+		if prices[i].Bucket.IsZero() {
+			prices[i].Bucket = prices[i].CreatedAt
+		}
+		if prices[i].Region == "" {
+			prices[i].Region = p.region
+		}
+	}
+}
+
+// stored bumps the version, drops cached responses and passes prices on to
+// the hub and the mirror once they are stored
+func (p *Persister) stored(ctx context.Context, prices []models.CoinPrice) {
+	p.notify(prices...)
+	p.invalidate(ctx, prices)
+	if p.hub != nil {
+		p.hub.Publish(prices)
+	}
+	if p.mirror != nil {
+		p.mirror.Write(prices)
+	}
+}
+
+// deadLetter records prices that could not be stored after attempts
+func (p *Persister) deadLetter(prices []models.CoinPrice, cause error, attempts int) {
+	letters := make([]models.DeadLetter, len(prices))
+	for i, price := range prices {
+		letters[i] = models.NewDeadLetter(price, cause, attempts)
+	}
+
+	if err := p.db.Create(&letters).Error; err == nil {
+		log.Warn().Err(cause).Int("rows", len(letters)).Msg("Dead-lettered prices")
+		return
+	}
+
+	if err := p.appendFile(letters); err != nil {
+		log.Error().Err(err).Int("rows", len(letters)).Str("file", p.file).Msg("Error writing dead letters, data lost")
+		return
+	}
+
+	log.Warn().Err(cause).Int("rows", len(letters)).Str("file", p.file).Msg("Dead-lettered prices to file")
+}
+
+// appendFile writes letters as JSON lines to the dead-letter file
+func (p *Persister) appendFile(letters []models.DeadLetter) error {
+	f, err := os.OpenFile(p.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	for _, letter := range letters {
+		if err := encoder.Encode(letter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportFile moves dead letters from the file into the dead_letters table so
+// they can be inspected and replayed through the API. The file is removed once
+// every line has been imported
+func (p *Persister) ImportFile() (int, error) {
+	f, err := os.Open(p.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var letters []models.DeadLetter
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var letter models.DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			f.Close()
+			return 0, fmt.Errorf("invalid dead letter line: %w", err)
+		}
+		letter.ID = 0
+		letters = append(letters, letter)
+	}
+	f.Close()
+
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(letters) > 0 {
+		if err := p.db.Create(&letters).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	return len(letters), os.Remove(p.file)
+}
+
+// Replay stores the given dead letters as prices and deletes them. With no ids
+// every dead letter is replayed. A letter whose bucket got a price since is
+// deleted without replacing it, the stored price being newer. It returns how
+// many were stored
+func (p *Persister) Replay(ids []uint) (int, error) {
+	var letters []models.DeadLetter
+
+	query := p.db.Order("id ASC")
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+	if err := query.Find(&letters).Error; err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	var stored []models.CoinPrice
+	for _, letter := range letters {
+		price := letter.CoinPrice()
+
+		if price.Bucket.IsZero() {
+			price.Bucket = price.CreatedAt
+		}
+
+		batch := []models.CoinPrice{price}
+		var inserted int64
+		err := p.db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if inserted, err = InsertMissingPrices(tx, batch); err != nil {
+				return err
+			}
+			return tx.Delete(&letter).Error
+		})
+		if err != nil {
+			return replayed, fmt.Errorf("replaying dead letter %d: %w", letter.ID, err)
+		}
+		if inserted == 0 {
+			log.Info().Uint("dead_letter", letter.ID).Str("coin", price.Coin).Str("exchange", price.Exchange).
+				Msg("Dropped dead letter, its bucket has a newer price")
+			continue
+		}
+		replayed++
+		stored = append(stored, batch[0])
+	}
+
+	if replayed > 0 {
+		p.stored(context.Background(), stored)
+	}
+
+	return replayed, nil
+}
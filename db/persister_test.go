@@ -0,0 +1,298 @@
+package db
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB opens a migrated in-memory SQLite database of the test's own, shared
+// by its connections like the memory driver's
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	dsn := fmt.Sprintf("file:/%s_%d?vfs=memdb&_pragma=busy_timeout(5000)&_txlock=immediate", name, time.Now().UnixNano())
+	database, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := Migrate(database); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return database
+}
+
+// bucket returns a time minutes after a fixed base
+func bucket(minutes int) time.Time {
+	return time.Date(2026, 1, 1, 0, minutes, 0, 0, time.UTC)
+}
+
+func TestUpsertPrices(t *testing.T) {
+	first := models.CoinPrice{Coin: "BTC", Exchange: "binance", Price: 100, Bucket: bucket(0), CreatedAt: bucket(0)}
+
+	tests := []struct {
+		name   string
+		second models.CoinPrice
+		// deleted soft-deletes the first price before the second is stored
+		deleted bool
+		// wantRows is how many prices are stored afterwards
+		wantRows int64
+	}{
+		{
+			name:     "same bucket replaces",
+			second:   models.CoinPrice{Coin: "BTC", Exchange: "binance", Price: 101, Bucket: bucket(0), CreatedAt: bucket(0).Add(time.Second)},
+			wantRows: 1,
+		},
+		{
+			name:     "same bucket replaces a deleted price",
+			second:   models.CoinPrice{Coin: "BTC", Exchange: "binance", Price: 101, Bucket: bucket(0), CreatedAt: bucket(0).Add(time.Second)},
+			deleted:  true,
+			wantRows: 1,
+		},
+		{
+			name:     "next bucket",
+			second:   models.CoinPrice{Coin: "BTC", Exchange: "binance", Price: 101, Bucket: bucket(1), CreatedAt: bucket(1)},
+			wantRows: 2,
+		},
+		{
+			name:     "other exchange",
+			second:   models.CoinPrice{Coin: "BTC", Exchange: "coinbase", Price: 101, Bucket: bucket(0), CreatedAt: bucket(0)},
+			wantRows: 2,
+		},
+		{
+			name:     "other region",
+			second:   models.CoinPrice{Coin: "BTC", Exchange: "binance", Region: "eu", Price: 101, Bucket: bucket(0), CreatedAt: bucket(0)},
+			wantRows: 2,
+		},
+		{
+			name:     "other coin",
+			second:   models.CoinPrice{Coin: "ETH", Exchange: "binance", Price: 101, Bucket: bucket(0), CreatedAt: bucket(0)},
+			wantRows: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := testDB(t)
+
+			if err := UpsertPrices(database, []models.CoinPrice{first}); err != nil {
+				t.Fatalf("UpsertPrices first: %v", err)
+			}
+			if tt.deleted {
+				if err := database.Where("coin = ?", first.Coin).Delete(&models.CoinPrice{}).Error; err != nil {
+					t.Fatalf("deleting first: %v", err)
+				}
+			}
+			if err := UpsertPrices(database, []models.CoinPrice{tt.second}); err != nil {
+				t.Fatalf("UpsertPrices second: %v", err)
+			}
+
+			var rows []models.CoinPrice
+			if err := database.Order("id ASC").Find(&rows).Error; err != nil {
+				t.Fatalf("reading prices: %v", err)
+			}
+			if int64(len(rows)) != tt.wantRows {
+				t.Fatalf("stored %d prices, want %d", len(rows), tt.wantRows)
+			}
+
+			// The second price is stored as sent, in place of the first when
+			// they share a bucket
+			last := rows[len(rows)-1]
+			if last.Price != tt.second.Price || last.Exchange != tt.second.Exchange || last.Region != tt.second.Region ||
+				!last.CreatedAt.Equal(tt.second.CreatedAt) {
+				t.Fatalf("stored %+v, want %+v", last, tt.second)
+			}
+		})
+	}
+}
+
+func TestInsertMissingPrices(t *testing.T) {
+	database := testDB(t)
+
+	stored := models.CoinPrice{Coin: "BTC", Exchange: "binance", Price: 100, Bucket: bucket(0), CreatedAt: bucket(0)}
+	if err := UpsertPrices(database, []models.CoinPrice{stored}); err != nil {
+		t.Fatalf("UpsertPrices: %v", err)
+	}
+
+	inserted, err := InsertMissingPrices(database, []models.CoinPrice{
+		{Coin: "BTC", Exchange: "binance", Price: 200, Bucket: bucket(0), CreatedAt: bucket(0)},
+		{Coin: "BTC", Exchange: "binance", Price: 201, Bucket: bucket(1), CreatedAt: bucket(1)},
+	})
+	if err != nil {
+		t.Fatalf("InsertMissingPrices: %v", err)
+	}
+	if inserted != 1 {
+		t.Fatalf("inserted %d prices, want 1", inserted)
+	}
+
+	// The stored price keeps its bucket
+	var kept models.CoinPrice
+	if err := database.Where("bucket = ?", bucket(0)).Take(&kept).Error; err != nil {
+		t.Fatalf("reading stored price: %v", err)
+	}
+	if kept.Price != stored.Price {
+		t.Fatalf("stored price = %v, want %v", kept.Price, stored.Price)
+	}
+}
+
+// rejectNegativePrices makes the database reject negative prices the way it
+// rejects values out of range, with a constraint error
+func rejectNegativePrices(t *testing.T, database *gorm.DB) {
+	t.Helper()
+
+	err := database.Exec(`CREATE TRIGGER reject_negative_prices BEFORE INSERT ON coin_prices
+		WHEN NEW.price < 0 BEGIN SELECT RAISE(ABORT, 'negative price'); END`).Error
+	if err != nil {
+		t.Fatalf("creating trigger: %v", err)
+	}
+}
+
+// failPriceInserts makes every insert into coin_prices fail with err
+func failPriceInserts(t *testing.T, database *gorm.DB, err error) {
+	t.Helper()
+
+	callback := func(tx *gorm.DB) {
+		if tx.Statement.Table == (models.CoinPrice{}).TableName() {
+			tx.AddError(err)
+		}
+	}
+	if err := database.Callback().Create().Before("gorm:create").Register("test:fail_prices", callback); err != nil {
+		t.Fatalf("registering callback: %v", err)
+	}
+}
+
+func TestClassifySQLite(t *testing.T) {
+	database := testDB(t)
+	rejectNegativePrices(t, database)
+
+	err := UpsertPrices(database, []models.CoinPrice{{Coin: "BTC", Exchange: "binance", Price: -1, Bucket: bucket(0)}})
+	if err == nil {
+		t.Fatal("UpsertPrices of a negative price succeeded")
+	}
+	if class := classify(err); class != errorPermanent {
+		t.Fatalf("classify(%v) = %d, want permanent", err, class)
+	}
+}
+
+func TestSaveDeadLetters(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup makes the database fail some inserts
+		setup  func(t *testing.T, database *gorm.DB)
+		prices []float64
+		// wantStored and wantLetters are the prices stored and dead-lettered
+		wantStored   int
+		wantLetters  int
+		wantAttempts int
+		wantErr      error
+	}{
+		{
+			name:       "stored",
+			setup:      func(t *testing.T, database *gorm.DB) {},
+			prices:     []float64{1, 2, 3},
+			wantStored: 3,
+		},
+		{
+			name:         "permanent error dead-letters only the bad rows",
+			setup:        rejectNegativePrices,
+			prices:       []float64{1, -2, 3},
+			wantStored:   2,
+			wantLetters:  1,
+			wantAttempts: 1,
+			wantErr:      ErrPricesRejected,
+		},
+		{
+			name:         "permanent error on every row",
+			setup:        rejectNegativePrices,
+			prices:       []float64{-1, -2},
+			wantLetters:  2,
+			wantAttempts: 1,
+			wantErr:      ErrPricesRejected,
+		},
+		{
+			name: "transient error is retried, then dead-lettered",
+			setup: func(t *testing.T, database *gorm.DB) {
+				failPriceInserts(t, database, driver.ErrBadConn)
+			},
+			prices:       []float64{1, 2},
+			wantLetters:  2,
+			wantAttempts: PERSIST_ATTEMPTS,
+			wantErr:      driver.ErrBadConn,
+		},
+		{
+			name: "unknown error is dead-lettered at once",
+			setup: func(t *testing.T, database *gorm.DB) {
+				failPriceInserts(t, database, errUnknownInsert)
+			},
+			prices:       []float64{1, 2},
+			wantLetters:  2,
+			wantAttempts: 1,
+			wantErr:      errUnknownInsert,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := testDB(t)
+			tt.setup(t, database)
+			persister := NewPersister(database, t.TempDir()+"/dead_letters.jsonl")
+
+			prices := make([]models.CoinPrice, len(tt.prices))
+			for i, price := range tt.prices {
+				prices[i] = models.CoinPrice{Coin: "BTC", Exchange: "binance", Price: price, Bucket: bucket(i)}
+			}
+			err := persister.Save(prices)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Save error = %v, want %v", err, tt.wantErr)
+			}
+
+			// Only stored prices carry an ID
+			withID := 0
+			for _, price := range prices {
+				if price.ID != 0 {
+					withID++
+				}
+			}
+			var stored int64
+			if err := database.Model(&models.CoinPrice{}).Count(&stored).Error; err != nil {
+				t.Fatalf("counting prices: %v", err)
+			}
+			if int(stored) != tt.wantStored || withID != tt.wantStored {
+				t.Fatalf("stored %d prices, %d with an ID, want %d", stored, withID, tt.wantStored)
+			}
+
+			var letters []models.DeadLetter
+			if err := database.Find(&letters).Error; err != nil {
+				t.Fatalf("reading dead letters: %v", err)
+			}
+			if len(letters) != tt.wantLetters {
+				t.Fatalf("dead-lettered %d prices, want %d", len(letters), tt.wantLetters)
+			}
+			for _, letter := range letters {
+				if letter.Attempts != tt.wantAttempts || letter.Error == "" {
+					t.Fatalf("dead letter %+v, want %d attempts and an error", letter, tt.wantAttempts)
+				}
+			}
+		})
+	}
+}
+
+var errUnknownInsert = errors.New("unknown insert failure")
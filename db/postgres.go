@@ -1,14 +1,66 @@
 package db
 
 import (
-	"os"
-
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-func NewPostgres() *gorm.DB {
-	dsn := os.Getenv("DATABASE_URL")
+// Database drivers, selected with database.driver
+const (
+	DRIVER_POSTGRES = "postgres"
+	DRIVER_SQLITE   = "sqlite"
+	DRIVER_MYSQL    = "mysql"
+	DRIVER_MEMORY   = "memory"
+)
+
+// New opens the database for driver, Postgres unless it is sqlite, mysql or
+// memory. The memory driver ignores dsn
+func New(driver, dsn string) *gorm.DB {
+	switch driver {
+	case DRIVER_SQLITE:
+		return NewSQLite(dsn)
+	case DRIVER_MYSQL:
+		return NewMySQL(dsn)
+	case DRIVER_MEMORY:
+		return NewMemory()
+	}
+	return NewPostgres(dsn)
+}
+
+// Open returns the dialector of driver without connecting
+func Open(driver, dsn string) gorm.Dialector {
+	switch driver {
+	case DRIVER_SQLITE:
+		return openSQLite(dsn)
+	case DRIVER_MYSQL:
+		return openMySQL(dsn)
+	case DRIVER_MEMORY:
+		return openMemory()
+	}
+	return postgres.Open(dsn)
+}
+
+// IsPostgres reports whether db runs on Postgres, for the queries other
+// drivers spell differently
+func IsPostgres(db *gorm.DB) bool {
+	return db.Dialector.Name() == DRIVER_POSTGRES
+}
+
+// IsMySQL reports whether db runs on MySQL or MariaDB
+func IsMySQL(db *gorm.DB) bool {
+	return db.Dialector.Name() == DRIVER_MYSQL
+}
+
+// Excluded refers to column of the row an upsert tried to insert, in its
+// update assignments
+func Excluded(db *gorm.DB, column string) string {
+	if IsMySQL(db) {
+		return "VALUES(" + column + ")"
+	}
+	return "excluded." + column
+}
+
+func NewPostgres(dsn string) *gorm.DB {
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
 		panic(err)
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+)
+
+// DeclaredAlert is an alert declared in config, routed to the declared
+// channel named Channel if set
+type DeclaredAlert struct {
+	Alert   models.PriceAlert
+	Channel string
+}
+
+// ReconcileAlerting makes the managed channels and alerts match the ones
+// declared in config, matched by name: new ones are created, changed ones
+// updated and managed rows no longer declared deleted. Rows created through
+// the API are left alone
+func ReconcileAlerting(database *gorm.DB, channels []models.NotificationChannel, alerts []DeclaredAlert) error {
+	return database.Transaction(func(tx *gorm.DB) error {
+		channelIDs, err := reconcileChannels(tx, channels)
+		if err != nil {
+			return err
+		}
+		return reconcileAlerts(tx, alerts, channelIDs)
+	})
+}
+
+// reconcileChannels returns the ID of every declared channel by name
+func reconcileChannels(tx *gorm.DB, declared []models.NotificationChannel) (map[string]uint, error) {
+	var existing []models.NotificationChannel
+	if err := tx.Where("managed = ?", true).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	byName := make(map[string]models.NotificationChannel, len(existing))
+	for _, channel := range existing {
+		byName[channel.Name] = channel
+	}
+
+	ids := make(map[string]uint, len(declared))
+	for _, channel := range declared {
+		channel.Managed = true
+		current, found := byName[channel.Name]
+		delete(byName, channel.Name)
+
+		if !found {
+			if err := createManaged(tx, &channel, channel.Enabled); err != nil {
+				return nil, err
+			}
+			ids[channel.Name] = channel.ID
+			continue
+		}
+
+		channel.ID = current.ID
+		channel.CreatedAt = current.CreatedAt
+		if err := tx.Save(&channel).Error; err != nil {
+			return nil, err
+		}
+		ids[channel.Name] = channel.ID
+	}
+
+	for _, stale := range byName {
+		if err := tx.Delete(&stale).Error; err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+func reconcileAlerts(tx *gorm.DB, declared []DeclaredAlert, channelIDs map[string]uint) error {
+	var existing []models.PriceAlert
+	if err := tx.Where("managed = ?", true).Find(&existing).Error; err != nil {
+		return err
+	}
+	byName := make(map[string]models.PriceAlert, len(existing))
+	for _, alert := range existing {
+		byName[alert.Name] = alert
+	}
+
+	for _, declaredAlert := range declared {
+		alert := declaredAlert.Alert
+		alert.Managed = true
+		if declaredAlert.Channel != "" {
+			id, ok := channelIDs[declaredAlert.Channel]
+			if !ok {
+				return fmt.Errorf("alert %q routes to undeclared channel %q", alert.Name, declaredAlert.Channel)
+			}
+			alert.ChannelID = &id
+		}
+		current, found := byName[alert.Name]
+		delete(byName, alert.Name)
+
+		if !found {
+			if err := createManaged(tx, &alert, alert.Enabled); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Keep the evaluation state of unchanged rules so a restart doesn't
+		// fire them again
+		if current.SameRule(alert) {
+			continue
+		}
+		alert.ID = current.ID
+		alert.CreatedAt = current.CreatedAt
+		if err := tx.Save(&alert).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, stale := range byName {
+		if err := tx.Delete(&stale).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createManaged inserts row. enabled is written explicitly afterwards when
+// false, since the column default would otherwise win over the zero value
+func createManaged(tx *gorm.DB, row interface{}, enabled bool) error {
+	if err := tx.Create(row).Error; err != nil {
+		return err
+	}
+	if enabled {
+		return nil
+	}
+	return tx.Model(row).Update("enabled", false).Error
+}
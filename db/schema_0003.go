@@ -0,0 +1,277 @@
+package db
+
+import (
+	"time"
+
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+)
+
+// The tables as migration 0003_create_tables created them. They are frozen
+// copies of the models at that version, so the migration does the same on
+// every database no matter how the models change later. Later changes get a
+// migration of their own
+
+type coinPrice0003 struct {
+	ID         uint     `gorm:"primarykey"`
+	Coin       string   `gorm:"type:varchar(10);not null;index;uniqueIndex:idx_coin_prices_coin_exchange_region_bucket,priority:1"`
+	Exchange   string   `gorm:"type:varchar(32);not null;default:'hyperliquid';index;uniqueIndex:idx_coin_prices_coin_exchange_region_bucket,priority:2"`
+	Region     string   `gorm:"type:varchar(32);not null;default:'';index;uniqueIndex:idx_coin_prices_coin_exchange_region_bucket,priority:3"`
+	Price      float64  `gorm:"type:decimal(20,8);not null"`
+	Confidence *float64 `gorm:"type:decimal(20,8)"`
+	Labels     models.Labels
+	SourceTime *time.Time
+	Bucket     time.Time `gorm:"not null;uniqueIndex:idx_coin_prices_coin_exchange_region_bucket,priority:4"`
+	CreatedAt  time.Time `gorm:"index"`
+	UpdatedAt  time.Time
+	DeletedAt  gorm.DeletedAt `gorm:"index"`
+}
+
+func (coinPrice0003) TableName() string { return "coin_prices" }
+
+type sourceSLA0003 struct {
+	ID               uint   `gorm:"primarykey"`
+	Exchange         string `gorm:"type:varchar(32);not null;uniqueIndex:idx_source_sla_exchange_month"`
+	Month            string `gorm:"type:char(7);not null;uniqueIndex:idx_source_sla_exchange_month"`
+	Cycles           int64  `gorm:"not null;default:0"`
+	SuccessfulCycles int64  `gorm:"not null;default:0"`
+	RequestedPrices  int64  `gorm:"not null;default:0"`
+	ReceivedPrices   int64  `gorm:"not null;default:0"`
+	LastSuccessAt    *time.Time
+	MaxGapSeconds    float64 `gorm:"not null;default:0"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+func (sourceSLA0003) TableName() string { return "source_slas" }
+
+type workerRun0003 struct {
+	ID          uint      `gorm:"primarykey"`
+	Worker      string    `gorm:"type:varchar(64);not null;index:idx_worker_runs_worker_started_at,priority:1"`
+	StartedAt   time.Time `gorm:"not null;index:idx_worker_runs_worker_started_at,priority:2"`
+	FinishedAt  time.Time `gorm:"not null"`
+	DurationMs  int64     `gorm:"not null"`
+	RowsWritten int64     `gorm:"not null;default:0"`
+	Error       string    `gorm:"type:text"`
+	CreatedAt   time.Time
+}
+
+func (workerRun0003) TableName() string { return "worker_runs" }
+
+type deadLetter0003 struct {
+	ID         uint     `gorm:"primarykey"`
+	Coin       string   `gorm:"type:varchar(10);not null;index"`
+	Exchange   string   `gorm:"type:varchar(32);not null"`
+	Region     string   `gorm:"type:varchar(32);not null;default:''"`
+	Price      float64  `gorm:"type:decimal(20,8);not null"`
+	Confidence *float64 `gorm:"type:decimal(20,8)"`
+	Labels     models.Labels
+	SourceTime *time.Time
+	TickAt     time.Time `gorm:"not null"`
+	Bucket     *time.Time
+	Error      string    `gorm:"type:text;not null"`
+	Attempts   int       `gorm:"not null"`
+	CreatedAt  time.Time `gorm:"index"`
+}
+
+func (deadLetter0003) TableName() string { return "dead_letters" }
+
+type trackedCoin0003 struct {
+	ID        uint   `gorm:"primarykey"`
+	Coin      string `gorm:"type:varchar(10);not null;uniqueIndex"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (trackedCoin0003) TableName() string { return "tracked_coins" }
+
+type notificationChannel0003 struct {
+	ID        uint   `gorm:"primarykey"`
+	Name      string `gorm:"type:varchar(64);not null"`
+	Type      string `gorm:"type:varchar(16);not null;index"`
+	Target    string `gorm:"type:text;not null"`
+	Token     string `gorm:"type:text"`
+	Enabled   bool   `gorm:"not null;default:true"`
+	Managed   bool   `gorm:"not null;default:false"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (notificationChannel0003) TableName() string { return "notification_channels" }
+
+type coinCandle0003 struct {
+	ID        uint      `gorm:"primarykey"`
+	Coin      string    `gorm:"type:varchar(10);not null;uniqueIndex:idx_coin_candles_bucket,priority:1"`
+	Exchange  string    `gorm:"type:varchar(32);not null;uniqueIndex:idx_coin_candles_bucket,priority:2"`
+	Interval  string    `gorm:"column:resolution;type:varchar(8);not null;uniqueIndex:idx_coin_candles_bucket,priority:3"`
+	OpenTime  time.Time `gorm:"not null;uniqueIndex:idx_coin_candles_bucket,priority:4"`
+	Open      float64   `gorm:"type:decimal(20,8);not null"`
+	High      float64   `gorm:"type:decimal(20,8);not null"`
+	Low       float64   `gorm:"type:decimal(20,8);not null"`
+	Close     float64   `gorm:"type:decimal(20,8);not null"`
+	Count     int64     `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (coinCandle0003) TableName() string { return "coin_candles" }
+
+type spreadAlert0003 struct {
+	ID           uint      `gorm:"primarykey"`
+	Coin         string    `gorm:"type:varchar(10);not null;index:idx_spread_alerts_coin_detected_at,priority:1"`
+	BuyExchange  string    `gorm:"type:varchar(32);not null"`
+	BuyPrice     float64   `gorm:"type:decimal(20,8);not null"`
+	SellExchange string    `gorm:"type:varchar(32);not null"`
+	SellPrice    float64   `gorm:"type:decimal(20,8);not null"`
+	SpreadBps    float64   `gorm:"not null"`
+	DetectedAt   time.Time `gorm:"not null;index:idx_spread_alerts_coin_detected_at,priority:2"`
+	CreatedAt    time.Time
+}
+
+func (spreadAlert0003) TableName() string { return "spread_alerts" }
+
+type priceAlert0003 struct {
+	ID            uint                     `gorm:"primarykey"`
+	Name          string                   `gorm:"type:varchar(64);not null"`
+	Coin          string                   `gorm:"type:varchar(10);not null;index"`
+	Exchange      string                   `gorm:"type:varchar(32);not null;default:''"`
+	Condition     string                   `gorm:"type:varchar(16);not null"`
+	Threshold     float64                  `gorm:"type:decimal(20,8);not null"`
+	WindowMinutes int                      `gorm:"not null;default:0"`
+	WebhookURL    models.Text              `gorm:"not null;default:''"`
+	ChannelID     *uint                    `gorm:"index"`
+	Channel       *notificationChannel0003 `gorm:"constraint:OnDelete:SET NULL"`
+	Enabled       bool                     `gorm:"not null;default:true"`
+	Triggered     bool                     `gorm:"not null;default:false"`
+	LastFiredAt   *time.Time
+	Managed       bool `gorm:"not null;default:false"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (priceAlert0003) TableName() string { return "price_alerts" }
+
+type fundingRate0003 struct {
+	ID            uint      `gorm:"primarykey"`
+	Coin          string    `gorm:"type:varchar(10);not null;index:idx_funding_rates_coin_exchange_created_at,priority:1"`
+	Exchange      string    `gorm:"type:varchar(32);not null;index:idx_funding_rates_coin_exchange_created_at,priority:2"`
+	Rate          float64   `gorm:"type:decimal(20,12);not null"`
+	Premium       *float64  `gorm:"type:decimal(20,12)"`
+	IntervalHours float64   `gorm:"not null"`
+	CreatedAt     time.Time `gorm:"index:idx_funding_rates_coin_exchange_created_at,priority:3"`
+}
+
+func (fundingRate0003) TableName() string { return "funding_rates" }
+
+type indexPrice0003 struct {
+	ID         uint    `gorm:"primarykey"`
+	Coin       string  `gorm:"type:varchar(10);not null;index:idx_index_prices_coin_created_at,priority:1"`
+	Price      float64 `gorm:"type:decimal(20,8);not null"`
+	Sources    int     `gorm:"not null"`
+	Quorum     int     `gorm:"not null"`
+	Degraded   bool    `gorm:"not null;default:false"`
+	Components models.VenuePrices
+	CreatedAt  time.Time `gorm:"index:idx_index_prices_coin_created_at,priority:2"`
+}
+
+func (indexPrice0003) TableName() string { return "index_prices" }
+
+type markPrice0003 struct {
+	ID            uint      `gorm:"primarykey"`
+	Coin          string    `gorm:"type:varchar(10);not null;index:idx_mark_prices_coin_exchange_created_at,priority:1"`
+	Exchange      string    `gorm:"type:varchar(32);not null;index:idx_mark_prices_coin_exchange_created_at,priority:2"`
+	Mark          float64   `gorm:"type:decimal(20,8);not null"`
+	Oracle        float64   `gorm:"type:decimal(20,8);not null"`
+	DivergenceBps float64   `gorm:"not null"`
+	CreatedAt     time.Time `gorm:"index:idx_mark_prices_coin_exchange_created_at,priority:3"`
+}
+
+func (markPrice0003) TableName() string { return "mark_prices" }
+
+type orderbookSnapshot0003 struct {
+	ID        uint              `gorm:"primarykey"`
+	Coin      string            `gorm:"type:varchar(10);not null;index:idx_orderbook_snapshots_coin_exchange_created_at,priority:1"`
+	Exchange  string            `gorm:"type:varchar(32);not null;index:idx_orderbook_snapshots_coin_exchange_created_at,priority:2"`
+	Mid       float64           `gorm:"type:decimal(20,8);not null"`
+	Bids      models.BookLevels `gorm:"not null"`
+	Asks      models.BookLevels `gorm:"not null"`
+	CreatedAt time.Time         `gorm:"index:idx_orderbook_snapshots_coin_exchange_created_at,priority:3"`
+}
+
+func (orderbookSnapshot0003) TableName() string { return "orderbook_snapshots" }
+
+type user0003 struct {
+	ID           uint   `gorm:"primarykey"`
+	Email        string `gorm:"type:varchar(254);not null;uniqueIndex"`
+	PasswordHash string `gorm:"type:varchar(72);not null"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (user0003) TableName() string { return "users" }
+
+type watchlistCoin0003 struct {
+	ID        uint   `gorm:"primarykey"`
+	UserID    uint   `gorm:"not null;uniqueIndex:idx_watchlist_coins_user_coin,priority:1"`
+	Coin      string `gorm:"type:varchar(10);not null;uniqueIndex:idx_watchlist_coins_user_coin,priority:2;index"`
+	CreatedAt time.Time
+}
+
+func (watchlistCoin0003) TableName() string { return "watchlist_coins" }
+
+type sourceScore0003 struct {
+	ID               uint      `gorm:"primarykey"`
+	Exchange         string    `gorm:"type:varchar(32);not null;uniqueIndex:idx_source_scores_exchange_hour,priority:1"`
+	Hour             time.Time `gorm:"not null;uniqueIndex:idx_source_scores_exchange_hour,priority:2;index"`
+	Cycles           int64     `gorm:"not null;default:0"`
+	SuccessfulCycles int64     `gorm:"not null;default:0"`
+	LatencyMs        float64   `gorm:"not null;default:0"`
+	StalenessSeconds float64   `gorm:"not null;default:0"`
+	StalenessSamples int64     `gorm:"not null;default:0"`
+	Compared         int64     `gorm:"not null;default:0"`
+	Outliers         int64     `gorm:"not null;default:0"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+func (sourceScore0003) TableName() string { return "source_scores" }
+
+type job0003 struct {
+	ID         string `gorm:"type:varchar(32);primarykey"`
+	Kind       string `gorm:"type:varchar(32);not null"`
+	Status     string `gorm:"type:varchar(16);not null;index:idx_jobs_status_created_at,priority:1"`
+	Params     models.RawJSON
+	Result     models.RawJSON
+	Error      string `gorm:"type:text"`
+	Scope      models.RawJSON
+	CreatedAt  time.Time `gorm:"index:idx_jobs_status_created_at,priority:2"`
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+	ExpiresAt  *time.Time `gorm:"index"`
+}
+
+func (job0003) TableName() string { return "jobs" }
+
+// tables0003 lists the tables of 0003_create_tables in creation order. Tables
+// referenced by another come before it
+func tables0003() []interface{} {
+	return []interface{}{
+		&coinPrice0003{},
+		&sourceSLA0003{},
+		&workerRun0003{},
+		&deadLetter0003{},
+		&trackedCoin0003{},
+		&notificationChannel0003{},
+		&coinCandle0003{},
+		&spreadAlert0003{},
+		&priceAlert0003{},
+		&fundingRate0003{},
+		&indexPrice0003{},
+		&markPrice0003{},
+		&orderbookSnapshot0003{},
+		&user0003{},
+		&watchlistCoin0003{},
+		&sourceScore0003{},
+		&job0003{},
+	}
+}
@@ -0,0 +1,31 @@
+package db
+
+import (
+	"time"
+)
+
+// The tables and columns as migration 0007_notification_preferences created
+// them, frozen like those of 0003
+
+type notificationPreference0007 struct {
+	ID             uint      `gorm:"primarykey"`
+	UserID         uint      `gorm:"not null;uniqueIndex"`
+	User           *user0003 `gorm:"constraint:OnDelete:CASCADE"`
+	Email          bool      `gorm:"not null;default:false"`
+	TelegramChatID string    `gorm:"type:varchar(64);not null;default:''"`
+	MinSeverity    string    `gorm:"type:varchar(16);not null;default:'info'"`
+	QuietStart     string    `gorm:"type:varchar(5);not null;default:''"`
+	QuietEnd       string    `gorm:"type:varchar(5);not null;default:''"`
+	Timezone       string    `gorm:"type:varchar(64);not null;default:'UTC'"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (notificationPreference0007) TableName() string { return "notification_preferences" }
+
+// priceAlertSeverity0007 is the column 0007 adds to price_alerts
+type priceAlertSeverity0007 struct {
+	Severity string `gorm:"type:varchar(16);not null;default:'warning'"`
+}
+
+func (priceAlertSeverity0007) TableName() string { return "price_alerts" }
@@ -0,0 +1,24 @@
+package db
+
+import (
+	"time"
+)
+
+// The columns as migration 0008_confirm_notification_targets added them,
+// frozen like those of 0003
+
+// userConfirmation0008 is the columns 0008 adds to users
+type userConfirmation0008 struct {
+	EmailConfirmedAt   *time.Time
+	ConfirmationSentAt *time.Time
+}
+
+func (userConfirmation0008) TableName() string { return "users" }
+
+// telegramLink0008 is the columns 0008 adds to notification_preferences
+type telegramLink0008 struct {
+	TelegramLinkCode      string `gorm:"type:varchar(64);not null;default:'';index"`
+	TelegramLinkExpiresAt *time.Time
+}
+
+func (telegramLink0008) TableName() string { return "notification_preferences" }
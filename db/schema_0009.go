@@ -0,0 +1,43 @@
+package db
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// coinTables0009 are the tables with a coin column when migration
+// 0009_widen_coin_columns ran, frozen like the structs of 0003
+var coinTables0009 = []string{
+	"coin_prices",
+	"dead_letters",
+	"tracked_coins",
+	"coin_candles",
+	"spread_alerts",
+	"price_alerts",
+	"funding_rates",
+	"index_prices",
+	"mark_prices",
+	"orderbook_snapshots",
+	"watchlist_coins",
+}
+
+// resizeCoinColumns0009 sets the width of every coin column. SQLite doesn't
+// enforce varchar widths, so its columns are left as they are
+func resizeCoinColumns0009(tx *gorm.DB, width int) error {
+	for _, table := range coinTables0009 {
+		var statement string
+		switch {
+		case IsPostgres(tx):
+			statement = fmt.Sprintf("ALTER TABLE %s ALTER COLUMN coin TYPE varchar(%d)", table, width)
+		case IsMySQL(tx):
+			statement = fmt.Sprintf("ALTER TABLE %s MODIFY coin varchar(%d) NOT NULL", table, width)
+		default:
+			return nil
+		}
+		if err := tx.Exec(statement).Error; err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+	}
+	return nil
+}
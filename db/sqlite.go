@@ -0,0 +1,38 @@
+package db
+
+import (
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// DEFAULT_SQLITE_PATH is the database file used when no DSN is set
+const DEFAULT_SQLITE_PATH = "dexlite.db"
+
+// SQLITE_PARAMS are added to DSNs without parameters of their own. WAL lets
+// the API read while a worker writes, writers wait for each other instead of
+// failing, and transactions take the write lock up front so two of them
+// can't deadlock upgrading it
+const SQLITE_PARAMS = "_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate"
+
+// NewSQLite opens a SQLite database file, for local and single-host
+// deployments without a Postgres server. Timestamps are stored as text in the
+// process time zone, which must not change between runs
+func NewSQLite(path string) *gorm.DB {
+	db, err := gorm.Open(openSQLite(path), &gorm.Config{})
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+func openSQLite(path string) gorm.Dialector {
+	if path == "" {
+		path = DEFAULT_SQLITE_PATH
+	}
+	if !strings.Contains(path, "?") {
+		path += "?" + SQLITE_PARAMS
+	}
+	return sqlite.Open(path)
+}
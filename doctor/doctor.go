@@ -0,0 +1,441 @@
+// Package doctor checks that a deployment can run: its configuration, the
+// database and its schema, the reachability of every source and the clocks
+// involved. Every problem comes with what to do about it
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/notblessy/dexlite/config"
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/services"
+	"gorm.io/gorm"
+)
+
+// Check statuses, from best to worst
+const (
+	STATUS_OK   = "ok"
+	STATUS_WARN = "warn"
+	STATUS_FAIL = "fail"
+	STATUS_SKIP = "skip"
+)
+
+const (
+	// CLOCK_SKEW_WARN and CLOCK_SKEW_FAIL bound the offset of a venue or the
+	// database from the local clock
+	CLOCK_SKEW_WARN = 5 * time.Second
+	CLOCK_SKEW_FAIL = 30 * time.Second
+	// SLOW_SOURCE flags a source answering slower than this
+	SLOW_SOURCE = 5 * time.Second
+)
+
+// Check is the outcome of one diagnostic. Fix says what to do when the
+// status isn't ok
+type Check struct {
+	Group  string `json:"group"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// Report lists every check in the order they ran
+type Report struct {
+	Checks []Check `json:"checks"`
+}
+
+// Count returns how many checks ended with status
+func (r *Report) Count(status string) int {
+	count := 0
+	for _, check := range r.Checks {
+		if check.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// add records a check. Multi-line details, e.g. joined errors, are folded
+// into one line
+func (r *Report) add(group, name, status, detail, fix string) {
+	var folded strings.Builder
+	for _, line := range strings.Split(detail, "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if folded.Len() > 0 {
+			if strings.HasSuffix(folded.String(), ":") {
+				folded.WriteString(" ")
+			} else {
+				folded.WriteString("; ")
+			}
+		}
+		folded.WriteString(line)
+	}
+
+	r.Checks = append(r.Checks, Check{
+		Group:  group,
+		Name:   name,
+		Status: status,
+		Detail: folded.String(),
+		Fix:    fix,
+	})
+}
+
+// Options controls what the doctor checks
+type Options struct {
+	// Timeout bounds each source probe and database query
+	Timeout time.Duration
+	// SkipSources leaves out the source probes, e.g. on a host without egress
+	SkipSources bool
+}
+
+// Doctor runs the checks. Each part is optional so the rest can still be
+// checked when, say, the configuration doesn't validate
+type Doctor struct {
+	cfg       *config.Config
+	configErr error
+	database  *gorm.DB
+	dbErr     error
+	registry  *services.Registry
+	regErr    error
+}
+
+// New creates a doctor for cfg. configErr is what loading or validating the
+// configuration reported
+func New(cfg *config.Config, configErr error) *Doctor {
+	return &Doctor{
+		cfg:       cfg,
+		configErr: configErr,
+	}
+}
+
+// SetDatabase sets the database to check, or the error connecting to it
+func (d *Doctor) SetDatabase(database *gorm.DB, err error) {
+	if err != nil {
+		database = nil
+	}
+	d.database = database
+	d.dbErr = err
+}
+
+// SetRegistry sets the sources to probe, or the error creating them
+func (d *Doctor) SetRegistry(registry *services.Registry, err error) {
+	if err != nil {
+		registry = nil
+	}
+	d.registry = registry
+	d.regErr = err
+}
+
+// Run performs every check
+func (d *Doctor) Run(ctx context.Context, opts Options) *Report {
+	report := &Report{}
+	d.checkConfig(report)
+	d.checkDatabase(ctx, report, opts)
+
+	if opts.SkipSources {
+		report.add("sources", "reachability", STATUS_SKIP, "source probes skipped", "")
+		return report
+	}
+	d.checkSources(report, opts)
+	return report
+}
+
+// checkConfig reports validation errors and settings that are valid on their
+// own but don't work together
+func (d *Doctor) checkConfig(report *Report) {
+	if d.configErr != nil {
+		for _, line := range strings.Split(d.configErr.Error(), "\n") {
+			report.add("config", "validation", STATUS_FAIL, line,
+				"fix the setting in "+config.DEFAULT_CONFIG_FILE+" (or CONFIG_FILE) or its environment variable, see config.example.yaml")
+		}
+	} else {
+		report.add("config", "validation", STATUS_OK, "configuration is valid", "")
+	}
+	if d.cfg == nil {
+		return
+	}
+	cfg := d.cfg
+
+	consistent := true
+	warn := func(name, detail, fix string) {
+		consistent = false
+		report.add("config", name, STATUS_WARN, detail, fix)
+	}
+
+	if cfg.Retention.RawPrices > 0 && cfg.Retention.RawPrices < 2*cfg.Fetcher.Interval {
+		warn("retention",
+			fmt.Sprintf("retention.raw_prices %s keeps fewer than two fetches at fetcher.interval %s", cfg.Retention.RawPrices, cfg.Fetcher.Interval),
+			"raise retention.raw_prices (RETENTION_RAW_PRICES) or lower fetcher.interval (FETCH_INTERVAL)")
+	}
+	if cfg.Retention.RawPrices > 0 && cfg.Retention.RawPrices < 24*time.Hour {
+		warn("retention",
+			fmt.Sprintf("retention.raw_prices %s is under 24h, 24h comparisons and stats will be partial", cfg.Retention.RawPrices),
+			"set retention.raw_prices (RETENTION_RAW_PRICES) to 24h or more")
+	}
+	if cfg.Spreads.MaxAge > 0 && cfg.Spreads.MaxAge < cfg.Fetcher.Interval {
+		warn("spreads",
+			fmt.Sprintf("spreads.max_age %s is shorter than fetcher.interval %s, venues will mostly count as stale", cfg.Spreads.MaxAge, cfg.Fetcher.Interval),
+			"raise spreads.max_age (SPREAD_MAX_AGE) above the fetch interval")
+	}
+	if cfg.Index.MaxAge > 0 && cfg.Index.MaxAge < cfg.Fetcher.Interval {
+		warn("index",
+			fmt.Sprintf("index.max_age %s is shorter than fetcher.interval %s, index prices will be degraded", cfg.Index.MaxAge, cfg.Fetcher.Interval),
+			"raise index.max_age (INDEX_MAX_AGE) above the fetch interval")
+	}
+	if cfg.Index.Quorum > len(cfg.Exchanges.Enabled) {
+		warn("index",
+			fmt.Sprintf("index.quorum %d is more than the %d enabled exchanges, every index price will be degraded", cfg.Index.Quorum, len(cfg.Exchanges.Enabled)),
+			"lower index.quorum (INDEX_QUORUM) or enable more exchanges")
+	}
+
+	tracked := make(map[string]bool, len(cfg.Fetcher.Coins))
+	for _, coin := range cfg.Fetcher.Coins {
+		tracked[strings.ToUpper(coin)] = true
+	}
+	var untracked []string
+	for _, rule := range cfg.Alerts.Rules {
+		if !tracked[strings.ToUpper(rule.Coin)] {
+			untracked = append(untracked, "alert "+rule.Name+" ("+rule.Coin+")")
+		}
+	}
+	if cfg.Snapshots.WebhookURL != "" {
+		for _, coin := range cfg.Snapshots.Coins {
+			if !tracked[strings.ToUpper(coin)] {
+				untracked = append(untracked, "snapshot coin "+coin)
+			}
+		}
+	}
+	if len(untracked) > 0 {
+		warn("coins",
+			"not in fetcher.coins: "+strings.Join(untracked, ", "),
+			"add the coins to fetcher.coins (TRACKED_COINS) unless they are tracked through POST /api/admin/coins")
+	}
+
+	if consistent {
+		report.add("config", "consistency", STATUS_OK, "settings are consistent with each other", "")
+	}
+}
+
+// checkDatabase checks the connection, the database clock and the schema
+func (d *Doctor) checkDatabase(ctx context.Context, report *Report, opts Options) {
+	fix := "check database.dsn (DATABASE_URL), that the database server is running and that this host can reach it"
+	if d.database == nil {
+		detail := "no database configured"
+		if d.dbErr != nil {
+			detail = d.dbErr.Error()
+		}
+		report.add("database", "connection", STATUS_FAIL, detail, fix)
+		report.add("database", "migrations", STATUS_SKIP, "needs a database connection", "")
+		return
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	database := d.database.WithContext(queryCtx)
+
+	var version string
+	var dbNow time.Time
+	sentAt := time.Now()
+	var err error
+	switch {
+	case db.IsPostgres(database):
+		err = database.Raw("SELECT version(), now()").Row().Scan(&version, &dbNow)
+	case db.IsMySQL(database):
+		err = database.Raw("SELECT CONCAT('MySQL ', VERSION()), UTC_TIMESTAMP(3)").Row().Scan(&version, &dbNow)
+	default:
+		// An embedded database shares our clock
+		err = database.Raw("SELECT 'SQLite ' || sqlite_version()").Row().Scan(&version)
+		dbNow = time.Now()
+	}
+	if err != nil {
+		report.add("database", "connection", STATUS_FAIL, err.Error(), fix)
+		report.add("database", "migrations", STATUS_SKIP, "needs a database connection", "")
+		return
+	}
+	roundTrip := time.Since(sentAt)
+	report.add("database", "connection", STATUS_OK,
+		fmt.Sprintf("connected in %s: %s", roundTrip.Round(time.Millisecond), strings.SplitN(version, ",", 2)[0]), "")
+
+	skew := dbNow.Sub(sentAt.Add(roundTrip / 2))
+	checkSkew(report, "database", "clock", "database", skew,
+		"sync the clocks of this host and the database server with NTP")
+
+	// The in-memory database starts empty and is migrated on every start
+	if d.cfg != nil && d.cfg.Database.Driver == db.DRIVER_MEMORY {
+		report.add("database", "migrations", STATUS_SKIP, "the memory driver migrates on start", "")
+		return
+	}
+	d.checkSchema(database, report)
+}
+
+// checkSchema compares the tables and columns in the database with the models
+func (d *Doctor) checkSchema(database *gorm.DB, report *Report) {
+	migrator := database.Migrator()
+	fix := "start dexlite once to migrate, or run `dexlite migrate up`"
+
+	var missing []string
+	for _, model := range db.Models() {
+		stmt := &gorm.Statement{DB: database}
+		if err := stmt.Parse(model); err != nil {
+			report.add("database", "migrations", STATUS_FAIL, err.Error(), "")
+			return
+		}
+		table := stmt.Schema.Table
+
+		if !migrator.HasTable(model) {
+			missing = append(missing, "table "+table)
+			continue
+		}
+		columns, err := migrator.ColumnTypes(model)
+		if err != nil {
+			report.add("database", "migrations", STATUS_FAIL, fmt.Sprintf("%s: %v", table, err), fix)
+			return
+		}
+		existing := make(map[string]bool, len(columns))
+		for _, column := range columns {
+			existing[column.Name()] = true
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !existing[field.DBName] {
+				missing = append(missing, table+"."+field.DBName)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		report.add("database", "migrations", STATUS_FAIL, "schema is behind: missing "+strings.Join(missing, ", "), fix)
+		return
+	}
+	if migrator.HasIndex(&models.CoinPrice{}, db.REGIONLESS_INDEX) {
+		report.add("database", "migrations", STATUS_WARN,
+			"the pre-region unique index "+db.REGIONLESS_INDEX+" is still present and rejects multi-region ticks", fix)
+		return
+	}
+	if migrator.HasIndex(&models.CoinPrice{}, db.UNBUCKETED_INDEX) {
+		report.add("database", "migrations", STATUS_WARN,
+			"the pre-bucket unique index "+db.UNBUCKETED_INDEX+" is still present and lets a restart store two samples per interval", fix)
+		return
+	}
+	report.add("database", "migrations", STATUS_OK, fmt.Sprintf("all %d tables are up to date", len(db.Models())), "")
+
+	var tracked int64
+	if err := database.Model(&models.TrackedCoin{}).Count(&tracked).Error; err == nil && tracked == 0 {
+		report.add("database", "tracked_coins", STATUS_WARN, "no coins are tracked yet",
+			"start dexlite to seed fetcher.coins, or add coins with POST /api/admin/coins")
+	}
+}
+
+// checkSources fetches the first tracked coin from every source at once,
+// measuring each venue's clock from its responses
+func (d *Doctor) checkSources(report *Report, opts Options) {
+	if d.registry == nil {
+		detail := "no sources configured"
+		if d.regErr != nil {
+			detail = d.regErr.Error()
+		}
+		report.add("sources", "registry", STATUS_FAIL, detail, "check exchanges.enabled (ENABLED_EXCHANGES) and source credentials")
+		return
+	}
+
+	coin := "BTC"
+	if d.cfg != nil && len(d.cfg.Fetcher.Coins) > 0 {
+		coin = strings.ToUpper(d.cfg.Fetcher.Coins[0])
+	}
+
+	clock := services.NewClockMonitor()
+	clock.Instrument(d.registry)
+
+	sources := d.registry.Sources()
+	if fallback := d.registry.Fallback(); fallback != nil {
+		sources = append(sources, fallback)
+	}
+
+	probes := make([]probe, len(sources))
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			probes[i] = probeSource(source, coin, opts.Timeout)
+		}()
+	}
+	wg.Wait()
+
+	for i, source := range sources {
+		name := source.Name()
+		switch result := probes[i]; {
+		case result.err != nil:
+			report.add("sources", name, STATUS_FAIL, result.err.Error(),
+				"check this host can reach "+name+" and its credentials, or remove it from exchanges.enabled")
+		case result.took > SLOW_SOURCE:
+			report.add("sources", name, STATUS_WARN, fmt.Sprintf("%s answered in %s", coin, result.took.Round(time.Millisecond)),
+				"check network latency to "+name+", slow sources delay every fetch cycle")
+		default:
+			report.add("sources", name, STATUS_OK, fmt.Sprintf("%s answered in %s", coin, result.took.Round(time.Millisecond)), "")
+		}
+	}
+
+	skews := clock.Skews()
+	if len(skews) == 0 {
+		report.add("clock", "venues", STATUS_SKIP, "no venue reported its time", "")
+	}
+	for _, skew := range skews {
+		checkSkew(report, "clock", skew.Source, skew.Source, skew.Skew,
+			"sync this host's clock with NTP, venue timestamps are corrected by this offset")
+	}
+}
+
+// probe is how one source answered
+type probe struct {
+	took time.Duration
+	err  error
+}
+
+// probeSource fetches coin from source, giving up after timeout. Sources
+// don't take a context, so a probe that times out is left to finish on its own
+func probeSource(source services.PriceSource, coin string, timeout time.Duration) probe {
+	var result probe
+	done := make(chan error, 1)
+	startedAt := time.Now()
+	go func() {
+		quotes, err := services.FetchQuotes(source, []string{coin})
+		if err == nil {
+			if _, ok := quotes[coin]; !ok {
+				err = fmt.Errorf("no price for %s", coin)
+			}
+		}
+		done <- err
+	}()
+
+	select {
+	case result.err = <-done:
+	case <-time.After(timeout):
+		result.err = fmt.Errorf("no answer within %s", timeout)
+	}
+	result.took = time.Since(startedAt)
+	return result
+}
+
+func checkSkew(report *Report, group, name, subject string, skew time.Duration, fix string) {
+	offset := skew
+	if offset < 0 {
+		offset = -offset
+	}
+	detail := fmt.Sprintf("%s clock is %s from local", subject, skew.Round(time.Millisecond))
+
+	switch {
+	case offset >= CLOCK_SKEW_FAIL:
+		report.add(group, name, STATUS_FAIL, detail, fix)
+	case offset >= CLOCK_SKEW_WARN:
+		report.add(group, name, STATUS_WARN, detail, fix)
+	default:
+		report.add(group, name, STATUS_OK, detail, "")
+	}
+}
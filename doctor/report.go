@@ -0,0 +1,31 @@
+package doctor
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteText prints the checks grouped by what they cover, with the fix under
+// every check that isn't ok, followed by a summary line
+func (r *Report) WriteText(w io.Writer) error {
+	group := ""
+	for _, check := range r.Checks {
+		if check.Group != group {
+			if group != "" {
+				fmt.Fprintln(w)
+			}
+			group = check.Group
+			fmt.Fprintf(w, "%s\n", strings.ToUpper(group))
+		}
+
+		fmt.Fprintf(w, "  [%-4s] %-14s %s\n", check.Status, check.Name, check.Detail)
+		if check.Fix != "" {
+			fmt.Fprintf(w, "         %-14s -> %s\n", "", check.Fix)
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "\n%d ok, %d warnings, %d failed, %d skipped\n",
+		r.Count(STATUS_OK), r.Count(STATUS_WARN), r.Count(STATUS_FAIL), r.Count(STATUS_SKIP))
+	return err
+}
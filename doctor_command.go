@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/notblessy/dexlite/config"
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/doctor"
+	"github.com/notblessy/dexlite/logging"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// doctorFlags are the flags of `dexlite doctor`
+type doctorFlags struct {
+	timeout     time.Duration
+	skipSources bool
+	asJSON      bool
+}
+
+func newDoctorCommand() *cobra.Command {
+	var flags doctorFlags
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "self-test the configuration and what it connects to",
+		Args:  cobra.NoArgs,
+		// Replaces the root's hook, doctor reports an invalid configuration
+		// instead of stopping on it
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			logging.Setup("error", "console")
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exit(runDoctor(flags))
+		},
+	}
+	cmd.Flags().DurationVar(&flags.timeout, "timeout", 10*time.Second, "how long each source probe and database query may take")
+	cmd.Flags().BoolVar(&flags.skipSources, "skip-sources", false, "don't probe the sources, e.g. on a host without internet access")
+	cmd.Flags().BoolVar(&flags.asJSON, "json", false, "print the report as JSON")
+	return cmd
+}
+
+// runDoctor implements `dexlite doctor`, a self-test of the deployment to run
+// before filing an issue. It loads the configuration itself so invalid
+// settings are reported next to everything else instead of stopping startup.
+// It exits 0 when nothing failed, 1 when a check failed and 2 on usage errors
+func runDoctor(flags doctorFlags) int {
+	if flags.timeout <= 0 {
+		fmt.Fprintln(os.Stderr, "doctor: --timeout must be positive")
+		return 2
+	}
+
+	cfg, err := config.LoadUnchecked()
+	if err == nil {
+		err = cfg.Validate()
+	}
+	d := doctor.New(cfg, err)
+
+	if cfg != nil {
+		if cfg.Database.DSN != "" || cfg.Database.Driver == db.DRIVER_SQLITE || cfg.Database.Driver == db.DRIVER_MEMORY {
+			// Connection errors are part of the report, not the log
+			d.SetDatabase(gorm.Open(db.Open(cfg.Database.Driver, cfg.Database.DSN), &gorm.Config{Logger: logger.Discard}))
+		} else {
+			d.SetDatabase(nil, errors.New("database.dsn (DATABASE_URL) is not set"))
+		}
+
+		// Credentials from a secret store are used like at startup
+		var registryErr error
+		if store := newSecretStore(cfg); store != nil {
+			registryErr = applySecrets(context.Background(), store, cfg)
+		}
+		if registryErr == nil {
+			d.SetRegistry(newRegistry(cfg))
+		} else {
+			d.SetRegistry(nil, registryErr)
+		}
+	}
+
+	report := d.Run(context.Background(), doctor.Options{
+		Timeout:     flags.timeout,
+		SkipSources: flags.skipSources,
+	})
+
+	if flags.asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "doctor: %v\n", err)
+		return 2
+	}
+
+	if report.Count(doctor.STATUS_FAIL) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/notblessy/dexlite/config"
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/workers"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func newFetchCommand(cfg *config.Config) *cobra.Command {
+	var once bool
+	cmd := &cobra.Command{
+		Use:   "fetch",
+		Short: "fetch prices without the HTTP server, once with --once",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exit(runFetch(cfg, once))
+		},
+	}
+	cmd.Flags().BoolVar(&once, "once", false, "fetch one cycle and exit")
+	return cmd
+}
+
+// runFetch implements `dexlite fetch`, the price fetcher on its own, without
+// the HTTP server or other workers. With --once it fetches one cycle and
+// exits 1 if anything went wrong
+func runFetch(cfg *config.Config, once bool) int {
+	database := openDatabase(cfg)
+	prepareSchema(cfg, database)
+	if err := db.SeedTrackedCoins(database, cfg.Fetcher.Coins); err != nil {
+		fmt.Fprintf(os.Stderr, "fetch: seeding tracked coins: %v\n", err)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if store := newSecretStore(cfg); store != nil {
+		if err := applySecrets(ctx, store, cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "fetch: loading secrets: %v\n", err)
+			return 2
+		}
+	}
+	registry, err := newRegistry(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fetch: creating price sources: %v\n", err)
+		return 2
+	}
+
+	persister := db.NewPersister(database, cfg.Database.DeadLetterFile)
+	if cfg.Server.Region != "" {
+		persister.SetRegion(cfg.Server.Region)
+	}
+	fetcher := workers.NewPriceFetcher(database, registry, db.NewWriteGate(database), persister, cfg.Fetcher.Coins, cfg.Fetcher.Interval)
+
+	if err := fetcher.FetchPrices(); err != nil {
+		log.Warn().Err(err).Msg("Price fetch incomplete")
+		if once {
+			return 1
+		}
+	}
+	if once {
+		return 0
+	}
+
+	log.Info().Dur("interval", cfg.Fetcher.Interval).Msg("Fetching prices until interrupted")
+	fetcher.Start(ctx)
+	return 0
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/notblessy/dexlite/config"
+	"github.com/notblessy/dexlite/services"
+	"github.com/notblessy/dexlite/symbols"
+	"github.com/spf13/cobra"
+)
+
+// DEFAULT_FIXTURES_DIR is where `dexlite fixtures capture` writes by default
+const DEFAULT_FIXTURES_DIR = "testdata/fixtures"
+
+// fixturesFlags are the flags of `dexlite fixtures capture`
+type fixturesFlags struct {
+	out       string
+	version   string
+	coins     string
+	exchanges string
+}
+
+func newFixturesCommand(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fixtures",
+		Short: "capture live source responses as test data",
+		Args:  cobra.NoArgs,
+		RunE:  groupOnly,
+	}
+
+	var flags fixturesFlags
+	capture := &cobra.Command{
+		Use:   "capture",
+		Short: "save the responses of every enabled source",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exit(runFixtures(cfg, flags))
+		},
+	}
+	capture.Flags().StringVar(&flags.out, "out", DEFAULT_FIXTURES_DIR, "directory fixtures are written under, as <source>/<version>/")
+	capture.Flags().StringVar(&flags.version, "version", time.Now().UTC().Format("20060102"), "version directory name, today's date by default")
+	capture.Flags().StringVar(&flags.coins, "coins", strings.Join(cfg.Fetcher.Coins, ","), "comma separated coins to request")
+	capture.Flags().StringVar(&flags.exchanges, "exchanges", "", "comma separated sources to capture, all enabled when empty")
+
+	cmd.AddCommand(capture)
+	return cmd
+}
+
+// runFixtures implements `dexlite fixtures capture`, which calls every
+// enabled source the way the workers do and saves the raw responses as
+// versioned test data. It exits 0 when everything was captured, 1 when some
+// calls failed and 2 on usage or write errors
+func runFixtures(cfg *config.Config, flags fixturesFlags) int {
+	coins := symbols.NormalizeAll(strings.Split(flags.coins, ","))
+	if len(coins) == 0 {
+		fmt.Fprintln(os.Stderr, "fixtures: --coins must list at least one coin")
+		return 2
+	}
+
+	// Credentials from a secret store are used, and scrubbed, like at startup
+	if store := newSecretStore(cfg); store != nil {
+		if err := applySecrets(context.Background(), store, cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "fixtures: %v\n", err)
+			return 2
+		}
+	}
+
+	registry, err := newRegistry(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fixtures: %v\n", err)
+		return 2
+	}
+
+	recorder := services.NewFixtureRecorder(fixtureSecrets(cfg))
+	recorder.Instrument(registry)
+
+	sources := registry.Sources()
+	if fallback := registry.Fallback(); fallback != nil {
+		sources = append(sources, fallback)
+	}
+
+	var only []string
+	if flags.exchanges != "" {
+		only = strings.Split(flags.exchanges, ",")
+	}
+
+	failed := false
+	for _, source := range sources {
+		if len(only) > 0 && !slices.Contains(only, source.Name()) {
+			continue
+		}
+		if err := captureSource(source, coins); err != nil {
+			fmt.Fprintf(os.Stderr, "fixtures: %s: %v\n", source.Name(), err)
+			failed = true
+		}
+	}
+
+	files, err := recorder.Save(flags.out, flags.version)
+	for _, file := range files {
+		fmt.Println(file)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fixtures: %v\n", err)
+		return 2
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// captureSource makes every call the workers make to source. Errors are
+// collected so one unsupported call doesn't hide the rest
+func captureSource(source services.PriceSource, coins []string) error {
+	var errs []error
+
+	if _, err := services.FetchQuotes(source, coins); err != nil {
+		errs = append(errs, fmt.Errorf("prices: %w", err))
+	}
+	if lister, ok := source.(services.MarketLister); ok {
+		if _, err := lister.ListMarkets(); err != nil {
+			errs = append(errs, fmt.Errorf("markets: %w", err))
+		}
+	}
+	if funding, ok := source.(services.FundingSource); ok {
+		if _, err := funding.GetFundingRates(coins); err != nil {
+			errs = append(errs, fmt.Errorf("funding: %w", err))
+		}
+	}
+	if marks, ok := source.(services.MarkSource); ok {
+		if _, err := marks.GetMarkPrices(coins); err != nil {
+			errs = append(errs, fmt.Errorf("marks: %w", err))
+		}
+	}
+	if books, ok := source.(services.OrderBookSource); ok {
+		if _, err := books.GetOrderBook(coins[0], 0); err != nil {
+			errs = append(errs, fmt.Errorf("orderbook: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// fixtureSecrets lists the configured credentials that must not end up in
+// fixtures. An RPC URL often carries its key in the path, so that is
+// scrubbed on its own as well
+func fixtureSecrets(cfg *config.Config) []string {
+	secrets := []string{cfg.Exchanges.CoinGecko.APIKey}
+
+	if rpcURL := cfg.Exchanges.Chainlink.RPCURL; rpcURL != "" {
+		secrets = append(secrets, rpcURL)
+		if parsed, err := url.Parse(rpcURL); err == nil && len(parsed.Path) > 1 {
+			secrets = append(secrets, strings.TrimPrefix(parsed.Path, "/"))
+		}
+	}
+	return secrets
+}
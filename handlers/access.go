@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/access"
+)
+
+// ScopeCoins restricts requests made with an API key policy scopes to its
+// coins. A :coin outside the scope is answered 403, and every query run with
+// the request context only sees the scope's coins. With requireKey, requests
+// without a scoped key are refused
+func ScopeCoins(policy *access.Policy, requireKey bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// Responses differ by key, shared caches must keep them apart
+			c.Response().Header().Add(echo.HeaderVary, HEADER_API_KEY)
+
+			scope, ok := policy.Scope(c.Request().Header.Get(HEADER_API_KEY))
+			if !ok {
+				if requireKey {
+					return c.JSON(http.StatusUnauthorized, map[string]string{
+						"error": "a valid " + HEADER_API_KEY + " header is required",
+					})
+				}
+				return next(c)
+			}
+
+			c.SetRequest(c.Request().WithContext(access.WithScope(c.Request().Context(), scope)))
+			if coin := c.Param("coin"); coin != "" && !scope.Allows(coin) {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": "coin " + coin + " is not available to this API key",
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+// coinAllowed reports whether the request may read coin
+func coinAllowed(c echo.Context, coin string) bool {
+	return access.Allowed(c.Request().Context(), coin)
+}
+
+// scopedCoins returns the coins the request may read
+func scopedCoins(c echo.Context, coins []string) []string {
+	allowed := make([]string, 0, len(coins))
+	for _, coin := range coins {
+		if coinAllowed(c, coin) {
+			allowed = append(allowed, coin)
+		}
+	}
+	return allowed
+}
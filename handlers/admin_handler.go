@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/services"
+	"github.com/notblessy/dexlite/symbols"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+type AdminHandler struct {
+	db        *gorm.DB
+	gate      *db.WriteGate
+	persister *db.Persister
+	registry  *services.Registry
+}
+
+func NewAdminHandler(database *gorm.DB, gate *db.WriteGate, persister *db.Persister, registry *services.Registry) *AdminHandler {
+	return &AdminHandler{
+		db:        database,
+		gate:      gate,
+		persister: persister,
+		registry:  registry,
+	}
+}
+
+// RequireAdmin answers 401 unless the request carries token as a bearer
+// token. Responses are marked private
+func RequireAdmin(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			sent, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "a valid admin token is required",
+				})
+			}
+
+			c.Response().Header().Set(echo.HeaderCacheControl, "private, no-store")
+			return next(c)
+		}
+	}
+}
+
+// RunMigrations pauses worker writes and migrates the schema
+// POST /api/admin/migrate
+func (h *AdminHandler) RunMigrations(c echo.Context) error {
+	log.Info().Msg("Migration triggered by admin, pausing workers")
+
+	if err := db.MigrateWithGate(h.db, h.gate); err != nil {
+		log.Error().Err(err).Msg("Admin migration failed")
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to migrate database",
+		})
+	}
+
+	log.Info().Msg("Admin migration completed, workers resumed")
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"status": "migrated",
+	})
+}
+
+// GetWorkerRuns returns the most recent runs of a background worker
+// GET /api/admin/workers/:name/runs?limit=50
+func (h *AdminHandler) GetWorkerRuns(c echo.Context) error {
+	name := c.Param("name")
+
+	limit := 50
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "limit must be between 1 and 500",
+			})
+		}
+		limit = parsed
+	}
+
+	var runs []models.WorkerRun
+	if err := h.db.Where("worker = ?", name).Order("started_at DESC").Limit(limit).Find(&runs).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch worker runs",
+		})
+	}
+
+	return c.JSON(http.StatusOK, runs)
+}
+
+// GetDeadLetters returns prices that failed to persist, oldest first
+// GET /api/admin/dead-letters?limit=100
+func (h *AdminHandler) GetDeadLetters(c echo.Context) error {
+	limit := 100
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "limit must be between 1 and 1000",
+			})
+		}
+		limit = parsed
+	}
+
+	var letters []models.DeadLetter
+	var count int64
+
+	if err := h.db.Model(&models.DeadLetter{}).Count(&count).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to count dead letters",
+		})
+	}
+
+	if err := h.db.Order("id ASC").Limit(limit).Find(&letters).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch dead letters",
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"dead_letters": letters,
+		"count":        count,
+	})
+}
+
+type ReplayDeadLettersRequest struct {
+	// IDs to replay, all dead letters are replayed when empty
+	IDs []uint `json:"ids"`
+}
+
+// ReplayDeadLetters stores dead letters as prices and removes them
+// POST /api/admin/dead-letters/replay
+func (h *AdminHandler) ReplayDeadLetters(c echo.Context) error {
+	var req ReplayDeadLettersRequest
+	if c.Request().ContentLength > 0 {
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "invalid request body",
+			})
+		}
+	}
+
+	h.gate.Enter()
+	replayed, err := h.persister.Replay(req.IDs)
+	h.gate.Leave()
+
+	if err != nil {
+		log.Error().Err(err).Int("rows", replayed).Msg("Dead letter replay failed")
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error":    "failed to replay dead letters",
+			"replayed": replayed,
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]int{
+		"replayed": replayed,
+	})
+}
+
+type TrackCoinRequest struct {
+	Coin string `json:"coin"`
+}
+
+// normalizeTrackedCoin returns the canonical symbol, checking it fits the
+// tracked_coins column
+func normalizeTrackedCoin(raw string) (string, error) {
+	coin := symbols.Normalize(raw)
+	if coin == "" || len(coin) > symbols.MAX_LENGTH {
+		return "", fmt.Errorf("coin must be 1 to %d characters", symbols.MAX_LENGTH)
+	}
+	return coin, nil
+}
+
+// GetTrackedCoins lists the coins the price fetcher collects
+// GET /api/admin/coins
+func (h *AdminHandler) GetTrackedCoins(c echo.Context) error {
+	var coins []models.TrackedCoin
+	if err := h.db.Order("coin ASC").Find(&coins).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch tracked coins",
+		})
+	}
+
+	return c.JSON(http.StatusOK, coins)
+}
+
+// TrackCoin adds a coin to the fetcher, taking effect on its next cycle
+// POST /api/admin/coins
+func (h *AdminHandler) TrackCoin(c echo.Context) error {
+	var req TrackCoinRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	coin, err := normalizeTrackedCoin(req.Coin)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	var existing int64
+	if err := h.db.Model(&models.TrackedCoin{}).Where("coin = ?", coin).Count(&existing).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to check tracked coins",
+		})
+	}
+	if existing > 0 {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "coin is already tracked",
+		})
+	}
+
+	tracked := models.TrackedCoin{Coin: coin}
+	if err := h.db.Create(&tracked).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to track coin",
+		})
+	}
+
+	return c.JSON(http.StatusCreated, tracked)
+}
+
+// UntrackCoin stops the fetcher collecting a coin. Stored prices are kept
+// DELETE /api/admin/coins/:coin
+func (h *AdminHandler) UntrackCoin(c echo.Context) error {
+	coin := c.Param("coin")
+
+	result := h.db.Where("coin = ?", coin).Delete(&models.TrackedCoin{})
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to untrack coin",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "coin is not tracked",
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Per-coin outcomes of a bulk import
+const (
+	BULK_ADDED      = "added"
+	BULK_EXISTS     = "exists"
+	BULK_INVALID    = "invalid"
+	BULK_NOT_LISTED = "not_listed"
+)
+
+// BulkTrackRequest names coins explicitly, selects every market on an exchange
+// with at least MinVolume of 24h notional volume, or both
+type BulkTrackRequest struct {
+	Coins     []string `json:"coins"`
+	Exchange  string   `json:"exchange"`
+	MinVolume float64  `json:"min_volume"`
+}
+
+type BulkTrackResult struct {
+	Coin   string `json:"coin"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type BulkTrackResponse struct {
+	Added   int               `json:"added"`
+	Results []BulkTrackResult `json:"results"`
+}
+
+// BulkTrackCoins adds many coins at once and reports what happened to each.
+// When the primary source can list every price, coins it doesn't list are
+// rejected as not_listed, except pre-launch markets listed by exchange which
+// have no price there yet
+// POST /api/admin/coins/bulk
+func (h *AdminHandler) BulkTrackCoins(c echo.Context) error {
+	var req BulkTrackRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+	if len(req.Coins) == 0 && req.Exchange == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "coins or exchange is required",
+		})
+	}
+
+	candidates := req.Coins
+	preLaunch := make(map[string]bool)
+	if req.Exchange != "" {
+		source, exists := h.registry.Get(req.Exchange)
+		if !exists {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("exchange %s is not enabled", req.Exchange),
+			})
+		}
+		lister, ok := source.(services.MarketLister)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("exchange %s can't list its markets", req.Exchange),
+			})
+		}
+
+		markets, err := lister.ListMarkets()
+		if err != nil && len(markets) > 0 {
+			log.Warn().Err(err).Str("exchange", req.Exchange).Msg("Some markets could not be listed")
+		} else if err != nil {
+			log.Error().Err(err).Str("exchange", req.Exchange).Msg("Error listing markets")
+			return c.JSON(http.StatusBadGateway, map[string]string{
+				"error": fmt.Sprintf("failed to list %s markets", req.Exchange),
+			})
+		}
+		for _, market := range markets {
+			if market.Volume24h >= req.MinVolume {
+				candidates = append(candidates, market.Coin)
+			}
+			if market.PreLaunch {
+				preLaunch[symbols.Normalize(market.Coin)] = true
+			}
+		}
+	}
+
+	if err := checkCoins(c, len(candidates)); err != nil {
+		return badRequest(c, err)
+	}
+
+	// Coins the primary source prices, nil when it can't list them all
+	var listed map[string]float64
+	if batch, ok := h.registry.Primary().(services.BatchSource); ok {
+		prices, err := batch.GetAllPrices()
+		if prices == nil {
+			log.Error().Err(err).Msg("Error listing primary source prices")
+			return c.JSON(http.StatusBadGateway, map[string]string{
+				"error": "failed to list coins on the primary source",
+			})
+		}
+		listed = prices
+	}
+
+	var tracked []string
+	if err := h.db.Model(&models.TrackedCoin{}).Pluck("coin", &tracked).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch tracked coins",
+		})
+	}
+	seen := make(map[string]bool, len(tracked))
+	for _, coin := range tracked {
+		seen[coin] = true
+	}
+
+	response := BulkTrackResponse{Results: []BulkTrackResult{}}
+	var added []models.TrackedCoin
+	for _, raw := range candidates {
+		coin, err := normalizeTrackedCoin(raw)
+		switch {
+		case err != nil:
+			response.Results = append(response.Results, BulkTrackResult{Coin: raw, Status: BULK_INVALID, Error: err.Error()})
+		case seen[coin]:
+			response.Results = append(response.Results, BulkTrackResult{Coin: coin, Status: BULK_EXISTS})
+		case listed != nil && !preLaunch[coin] && !isListed(listed, coin):
+			response.Results = append(response.Results, BulkTrackResult{Coin: coin, Status: BULK_NOT_LISTED})
+		default:
+			seen[coin] = true
+			added = append(added, models.TrackedCoin{Coin: coin})
+			response.Results = append(response.Results, BulkTrackResult{Coin: coin, Status: BULK_ADDED})
+		}
+	}
+
+	if len(added) > 0 {
+		if err := h.db.Create(&added).Error; err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to track coins",
+			})
+		}
+	}
+	response.Added = len(added)
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// isListed reports whether coin appears among a source's prices, comparing
+// canonical symbols so aliases match
+func isListed(prices map[string]float64, coin string) bool {
+	if _, exists := prices[coin]; exists {
+		return true
+	}
+	for listed := range prices {
+		if symbols.Normalize(listed) == coin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/access"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/symbols"
+	"github.com/notblessy/dexlite/workers"
+	"gorm.io/gorm"
+)
+
+type AlertHandler struct {
+	db *gorm.DB
+	// evaluator holds the alerts in memory and is refreshed on every change
+	evaluator *workers.AlertEvaluator
+}
+
+func NewAlertHandler(db *gorm.DB, evaluator *workers.AlertEvaluator) *AlertHandler {
+	return &AlertHandler{
+		db:        db,
+		evaluator: evaluator,
+	}
+}
+
+// AlertRequest creates or replaces a price alert
+type AlertRequest struct {
+	Name          string  `json:"name"`
+	Coin          string  `json:"coin"`
+	Exchange      string  `json:"exchange"`
+	Condition     string  `json:"condition"`
+	Threshold     float64 `json:"threshold"`
+	WindowMinutes int     `json:"window_minutes"`
+	Severity      string  `json:"severity"`
+	WebhookURL    string  `json:"webhook_url"`
+	ChannelID     *uint   `json:"channel_id"`
+	Enabled       *bool   `json:"enabled"`
+}
+
+// apply copies the request onto alert and checks the channel it routes to
+// exists. Any change re-arms the alert so the new condition is evaluated from
+// scratch
+func (r AlertRequest) apply(database *gorm.DB, alert *models.PriceAlert) error {
+	coin, err := normalizeTrackedCoin(r.Coin)
+	if err != nil {
+		return err
+	}
+	if !access.Allowed(database.Statement.Context, coin) {
+		return fmt.Errorf("coin %s is not available to this API key", coin)
+	}
+
+	alert.Name = r.Name
+	alert.Coin = coin
+	alert.Exchange = r.Exchange
+	alert.Condition = r.Condition
+	alert.Threshold = r.Threshold
+	alert.WindowMinutes = r.WindowMinutes
+	alert.Severity = r.Severity
+	if alert.Severity == "" {
+		alert.Severity = models.SEVERITY_WARNING
+	}
+	alert.WebhookURL = models.Text(r.WebhookURL)
+	alert.ChannelID = r.ChannelID
+	if r.Enabled != nil {
+		alert.Enabled = *r.Enabled
+	}
+	alert.Triggered = false
+
+	if err := alert.Validate(); err != nil {
+		return err
+	}
+
+	if alert.ChannelID != nil {
+		var count int64
+		if err := database.Model(&models.NotificationChannel{}).Where("id = ?", *alert.ChannelID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return errors.New("channel_id does not match a channel")
+		}
+	}
+	return nil
+}
+
+// GetAlerts lists price alerts, optionally for one coin or channel
+// GET /api/alerts?coin=BTC&channel_id=
+func (h *AlertHandler) GetAlerts(c echo.Context) error {
+	query := h.db.WithContext(c.Request().Context()).Order("id ASC")
+	if coin := c.QueryParam("coin"); coin != "" {
+		query = query.Where("coin = ?", symbols.Normalize(coin))
+	}
+	if channel := c.QueryParam("channel_id"); channel != "" {
+		channelID, err := strconv.ParseUint(channel, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "invalid channel_id",
+			})
+		}
+		query = query.Where("channel_id = ?", channelID)
+	}
+
+	var alerts []models.PriceAlert
+	if err := query.Find(&alerts).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch alerts",
+		})
+	}
+
+	return c.JSON(http.StatusOK, alerts)
+}
+
+// GetAlert returns a single price alert
+// GET /api/alerts/:id
+func (h *AlertHandler) GetAlert(c echo.Context) error {
+	alert, found, err := h.find(c)
+	if !found {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, alert)
+}
+
+// CreateAlert adds a price alert, enabled unless stated otherwise
+// POST /api/alerts
+func (h *AlertHandler) CreateAlert(c echo.Context) error {
+	var req AlertRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	alert := models.PriceAlert{Enabled: true}
+	if err := req.apply(h.db.WithContext(c.Request().Context()), &alert); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.db.WithContext(c.Request().Context()).Create(&alert).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to create alert",
+		})
+	}
+	h.evaluator.Refresh()
+
+	return c.JSON(http.StatusCreated, alert)
+}
+
+// UpdateAlert replaces a price alert's settings
+// PUT /api/alerts/:id
+func (h *AlertHandler) UpdateAlert(c echo.Context) error {
+	alert, found, err := h.find(c)
+	if !found {
+		return err
+	}
+	if alert.Managed {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "alert is managed in the config file",
+		})
+	}
+
+	var req AlertRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+	if err := req.apply(h.db.WithContext(c.Request().Context()), alert); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.db.WithContext(c.Request().Context()).Save(alert).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to update alert",
+		})
+	}
+	h.evaluator.Refresh()
+
+	return c.JSON(http.StatusOK, alert)
+}
+
+// DeleteAlert removes a price alert
+// DELETE /api/alerts/:id
+func (h *AlertHandler) DeleteAlert(c echo.Context) error {
+	alert, found, err := h.find(c)
+	if !found {
+		return err
+	}
+	if alert.Managed {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "alert is managed in the config file",
+		})
+	}
+
+	if err := h.db.WithContext(c.Request().Context()).Delete(alert).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to delete alert",
+		})
+	}
+	h.evaluator.Refresh()
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// find loads the alert named by the :id parameter. When found is false the
+// error response has already been written and err is what the handler returns
+func (h *AlertHandler) find(c echo.Context) (alert *models.PriceAlert, found bool, err error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, false, c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid alert id",
+		})
+	}
+
+	alert = &models.PriceAlert{}
+	if err := h.db.WithContext(c.Request().Context()).First(alert, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, c.JSON(http.StatusNotFound, map[string]string{
+				"error": "alert not found",
+			})
+		}
+		return nil, false, c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch alert",
+		})
+	}
+
+	return alert, true, nil
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Audit headers added to signed responses
+const (
+	HEADER_AUDIT_TIMESTAMP = "X-Dexlite-Timestamp"
+	HEADER_AUDIT_VERSION   = "X-Dexlite-Dataset-Version"
+	HEADER_AUDIT_SIGNATURE = "X-Dexlite-Signature"
+)
+
+// SignPayload returns the hex HMAC-SHA256 of timestamp, version and body joined
+// by newlines, which is what X-Dexlite-Signature carries
+func SignPayload(key []byte, timestamp, version string, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(version))
+	mac.Write([]byte("\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Audit signs successful GET responses so archived copies can prove what the
+// API returned and when. version reports the dataset version, the newest
+// stored price ID, at the time of the response
+func Audit(key []byte, version func() uint64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Method != http.MethodGet {
+				return next(c)
+			}
+
+			res := c.Response()
+			original := res.Writer
+			buffer := &bufferedWriter{ResponseWriter: original}
+			res.Writer = buffer
+
+			err := next(c)
+			res.Writer = original
+
+			status := buffer.status
+			if err != nil {
+				// Let echo write the error unless the handler already responded
+				if status != 0 {
+					original.WriteHeader(status)
+					original.Write(buffer.body.Bytes())
+				}
+				return err
+			}
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			if status == http.StatusOK {
+				timestamp := time.Now().UTC().Format(time.RFC3339Nano)
+				datasetVersion := strconv.FormatUint(version(), 10)
+
+				header := original.Header()
+				header.Set(HEADER_AUDIT_TIMESTAMP, timestamp)
+				header.Set(HEADER_AUDIT_VERSION, datasetVersion)
+				header.Set(HEADER_AUDIT_SIGNATURE, SignPayload(key, timestamp, datasetVersion, buffer.body.Bytes()))
+			}
+
+			original.WriteHeader(status)
+			_, err = original.Write(buffer.body.Bytes())
+			return err
+		}
+	}
+}
+
+// bufferedWriter holds the response until it can be signed. Headers are
+// shared with the real writer
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
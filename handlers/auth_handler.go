@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/auth"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/notifiers"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// CONTEXT_USER_ID is the echo context key RequireUser stores the signed in
+// user's ID under
+const CONTEXT_USER_ID = "user_id"
+
+// MAX_PASSWORD_LENGTH is the longest password bcrypt hashes in full
+const MAX_PASSWORD_LENGTH = 72
+
+type AuthHandler struct {
+	db     *gorm.DB
+	tokens *auth.Tokens
+	// smtp mails confirmation links, to publicURL when set, nil when the
+	// server has no mail server
+	smtp      *notifiers.SMTPServer
+	publicURL string
+}
+
+func NewAuthHandler(db *gorm.DB, tokens *auth.Tokens) *AuthHandler {
+	return &AuthHandler{
+		db:     db,
+		tokens: tokens,
+	}
+}
+
+// SetMailer mails email confirmation links through server. Links point at
+// publicURL, an empty one mails the token to post instead
+func (h *AuthHandler) SetMailer(server *notifiers.SMTPServer, publicURL string) {
+	h.smtp = server
+	h.publicURL = strings.TrimSuffix(publicURL, "/")
+}
+
+// Credentials register or sign in a user
+type Credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// TokenResponse is a signed in user and the bearer token to send as
+// Authorization: Bearer <token>
+type TokenResponse struct {
+	User      models.User `json:"user"`
+	Token     string      `json:"token"`
+	ExpiresAt time.Time   `json:"expires_at"`
+}
+
+// Register creates an account and signs it in
+// POST /api/auth/register
+func (h *AuthHandler) Register(c echo.Context) error {
+	var req Credentials
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		return badRequest(c, err)
+	}
+	if len(req.Password) < auth.MIN_PASSWORD_LENGTH || len(req.Password) > MAX_PASSWORD_LENGTH {
+		return badRequest(c, fmt.Errorf("password must be %d to %d characters", auth.MIN_PASSWORD_LENGTH, MAX_PASSWORD_LENGTH))
+	}
+
+	ctx := c.Request().Context()
+	var existing int64
+	if err := h.db.WithContext(ctx).Model(&models.User{}).Where("email = ?", email).Count(&existing).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to check users",
+		})
+	}
+	if existing > 0 {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "email is already registered",
+		})
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to hash password",
+		})
+	}
+	user := models.User{Email: email, PasswordHash: hash}
+	if err := h.db.WithContext(ctx).Create(&user).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to create user",
+		})
+	}
+
+	return h.respondWithToken(c, http.StatusCreated, user)
+}
+
+// Login exchanges an email and password for a token
+// POST /api/auth/login
+func (h *AuthHandler) Login(c echo.Context) error {
+	var req Credentials
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	invalid := map[string]string{
+		"error": "invalid email or password",
+	}
+
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, invalid)
+	}
+
+	var user models.User
+	err = h.db.WithContext(c.Request().Context()).Where("email = ?", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		auth.CheckUnknownUser(req.Password)
+		return c.JSON(http.StatusUnauthorized, invalid)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch user",
+		})
+	}
+	if !auth.CheckPassword(user.PasswordHash, req.Password) {
+		return c.JSON(http.StatusUnauthorized, invalid)
+	}
+
+	return h.respondWithToken(c, http.StatusOK, user)
+}
+
+func (h *AuthHandler) respondWithToken(c echo.Context, status int, user models.User) error {
+	token, expiresAt, err := h.tokens.Issue(user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to issue token",
+		})
+	}
+
+	return c.JSON(status, TokenResponse{
+		User:      user,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// RequireUser answers 401 unless the request carries a valid bearer token,
+// and makes the user's ID available to handlers below it. Responses are
+// marked private
+func RequireUser(tokens *auth.Tokens) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok || token == "" {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "a bearer token is required",
+				})
+			}
+
+			claims, err := tokens.Verify(token)
+			var userID uint
+			if err == nil {
+				userID, err = claims.UserID()
+			}
+			if err != nil {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": err.Error(),
+				})
+			}
+
+			// Per-user responses must never be kept by shared caches
+			c.Response().Header().Set(echo.HeaderCacheControl, "private, no-store")
+			c.Set(CONTEXT_USER_ID, userID)
+			return next(c)
+		}
+	}
+}
+
+// userOf returns the signed in user's ID, set by RequireUser
+func userOf(c echo.Context) uint {
+	id, _ := c.Get(CONTEXT_USER_ID).(uint)
+	return id
+}
+
+// normalizeEmail checks email is a bare address and lowercases it
+func normalizeEmail(raw string) (string, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(raw))
+	if err != nil || address.Name != "" || len(address.Address) > 254 {
+		return "", errors.New("email must be a valid address")
+	}
+	return strings.ToLower(address.Address), nil
+}
+
+// ConfirmEmailRequest carries the token of a confirmation link
+type ConfirmEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// confirmationMail is the body of the mail confirming an address, Link is
+// empty without a public URL
+var confirmationMail = htmltemplate.Must(htmltemplate.New("confirmation").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: -apple-system, 'Segoe UI', Helvetica, Arial, sans-serif; color: #1f2328;">
+<p>Confirm that dexlite may mail price alerts to {{.Email}}{{if .Link}} by opening <a href="{{.Link}}">this link</a>{{else}} by posting this token to /api/auth/confirm-email:</p>
+<p><code>{{.Token}}</code>{{end}}</p>
+<p>It works for {{.Hours}} hours. If you didn't ask for alerts, ignore this mail and none will be sent.</p>
+</body>
+</html>`))
+
+// SendConfirmation mails the signed in user a link confirming their address,
+// at most once per EMAIL_CONFIRMATION_INTERVAL
+// POST /api/me/email/confirm
+func (h *AuthHandler) SendConfirmation(c echo.Context) error {
+	if h.smtp == nil {
+		return badRequest(c, errors.New("email confirmation needs a mail server configured"))
+	}
+
+	ctx := c.Request().Context()
+	var user models.User
+	if err := h.db.WithContext(ctx).Take(&user, userOf(c)).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch user",
+		})
+	}
+	if user.EmailConfirmedAt != nil {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "email is already confirmed",
+		})
+	}
+
+	// Claimed before mailing so concurrent requests send one mail
+	now := time.Now()
+	result := h.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND (confirmation_sent_at IS NULL OR confirmation_sent_at < ?)", user.ID, now.Add(-models.EMAIL_CONFIRMATION_INTERVAL)).
+		Update("confirmation_sent_at", now)
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to update user",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusTooManyRequests, map[string]string{
+			"error": "a confirmation link was sent recently, try again later",
+		})
+	}
+
+	if err := h.mailConfirmation(user); err != nil {
+		log.Warn().Err(err).Uint("user", user.ID).Msg("Failed to mail email confirmation")
+		// Another link may be asked for straight away
+		h.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", user.ID).Update("confirmation_sent_at", user.ConfirmationSentAt)
+		return c.JSON(http.StatusBadGateway, map[string]string{
+			"error": "failed to send the confirmation mail",
+		})
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+// mailConfirmation mails user a token confirming their address
+func (h *AuthHandler) mailConfirmation(user models.User) error {
+	token, err := h.tokens.IssueEmail(user.ID, user.Email)
+	if err != nil {
+		return err
+	}
+
+	data := struct {
+		Email, Token, Link string
+		Hours              int
+	}{
+		Email: user.Email,
+		Token: token,
+		Hours: int(auth.EMAIL_TOKEN_TTL / time.Hour),
+	}
+	if h.publicURL != "" {
+		data.Link = h.publicURL + "/api/auth/confirm-email?token=" + url.QueryEscape(token)
+	}
+
+	var body strings.Builder
+	if err := confirmationMail.Execute(&body, data); err != nil {
+		return err
+	}
+	email, err := notifiers.NewEmail(*h.smtp, []string{user.Email}, "", "")
+	if err != nil {
+		return err
+	}
+	return email.Send("[dexlite] Confirm your email address", body.String())
+}
+
+// ConfirmEmail confirms the address a confirmation link was mailed to, so
+// alerts may be mailed there. The token comes as a query parameter from the
+// link or in the body
+// GET /api/auth/confirm-email
+// POST /api/auth/confirm-email
+func (h *AuthHandler) ConfirmEmail(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		var req ConfirmEmailRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "invalid request body",
+			})
+		}
+		token = req.Token
+	}
+
+	invalid := map[string]string{
+		"error": "the confirmation link is invalid or has expired",
+	}
+	claims, err := h.tokens.VerifyEmail(token)
+	var userID uint
+	if err == nil {
+		userID, err = claims.UserID()
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, invalid)
+	}
+
+	// The address must still be the one the link was mailed to
+	ctx := c.Request().Context()
+	err = h.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND email = ? AND email_confirmed_at IS NULL", userID, claims.Email).
+		Update("email_confirmed_at", time.Now()).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to confirm email",
+		})
+	}
+
+	var user models.User
+	err = h.db.WithContext(ctx).Where("id = ? AND email = ?", userID, claims.Email).Take(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusBadRequest, invalid)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch user",
+		})
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CacheControl sets Cache-Control and Age headers on successful GET/HEAD
+// responses so that caches keep a response until the next fetch cycle is due.
+// lastUpdate reports when stored data last changed
+func CacheControl(interval time.Duration, lastUpdate func() time.Time) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			method := c.Request().Method
+			if method != http.MethodGet && method != http.MethodHead {
+				return next(c)
+			}
+
+			res := c.Response()
+			res.Before(func() {
+				// Handlers serving live data set their own policy
+				if res.Header().Get(echo.HeaderCacheControl) != "" {
+					return
+				}
+
+				if res.Status != http.StatusOK {
+					res.Header().Set(echo.HeaderCacheControl, "no-store")
+					return
+				}
+
+				updated := lastUpdate()
+				if updated.IsZero() {
+					res.Header().Set(echo.HeaderCacheControl, "no-cache")
+					return
+				}
+
+				age := time.Since(updated)
+				maxAge := interval - age
+				if maxAge < 0 {
+					maxAge = 0
+				}
+
+				res.Header().Set(echo.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+				res.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
+			})
+
+			return next(c)
+		}
+	}
+}
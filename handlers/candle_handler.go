@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+)
+
+type CandleHandler struct {
+	db       *gorm.DB
+	sessions *models.Sessions
+}
+
+func NewCandleHandler(db *gorm.DB, sessions *models.Sessions) *CandleHandler {
+	return &CandleHandler{
+		db:       db,
+		sessions: sessions,
+	}
+}
+
+type CandleResponse struct {
+	OpenTime time.Time `json:"open_time"`
+	Open     float64   `json:"open"`
+	High     float64   `json:"high"`
+	Low      float64   `json:"low"`
+	Close    float64   `json:"close"`
+	Count    int64     `json:"count"`
+}
+
+// ExchangeCandles holds one venue's candles, oldest first
+type ExchangeCandles struct {
+	Exchange string           `json:"exchange"`
+	Candles  []CandleResponse `json:"candles"`
+}
+
+type CandlesResponse struct {
+	Coin      string            `json:"coin"`
+	Interval  string            `json:"interval"`
+	From      time.Time         `json:"from"`
+	To        time.Time         `json:"to"`
+	Exchanges []ExchangeCandles `json:"exchanges"`
+}
+
+// GetCandles returns OHLC candles for a coin grouped by exchange. The window
+// defaults to the last 24 hours, or the last year for daily, weekly and
+// monthly bars
+// GET /api/candles/:coin?interval=1h&from=&to=&sources=
+func (h *CandleHandler) GetCandles(c echo.Context) error {
+	coin := c.Param("coin")
+	if coin == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "coin symbol is required",
+		})
+	}
+
+	interval := c.QueryParam("interval")
+	if interval == "" {
+		interval = "1h"
+	}
+	size, ok := models.CANDLE_INTERVALS[interval]
+	sessionSize, session := models.SESSION_INTERVALS[interval]
+	if !ok && !session {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "interval must be one of 1m, 5m, 1h, 1d, 1w, 1M",
+		})
+	}
+
+	window := 24 * time.Hour
+	if session {
+		size = sessionSize
+		window = 365 * 24 * time.Hour
+	}
+
+	from, to, err := timeWindow(c, window)
+	if err != nil {
+		return badRequest(c, err)
+	}
+	if err := checkRows(c, int64(to.Sub(from)/size)); err != nil {
+		return badRequest(c, err)
+	}
+
+	// Include the bar the window starts in
+	start := from.Truncate(size)
+	if session {
+		start = h.sessions.Start(interval, from)
+	}
+
+	var candles []models.CoinCandle
+	err = h.db.WithContext(c.Request().Context()).Where("coin = ? AND resolution = ? AND open_time >= ? AND open_time < ?", coin, interval, start, to).
+		Scopes(scopeSources(sourcesFilter(c))).
+		Order("exchange ASC, open_time ASC").
+		Find(&candles).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch candles",
+		})
+	}
+
+	// Rows arrive ordered by exchange so each venue forms a contiguous run
+	exchanges := []ExchangeCandles{}
+	for _, candle := range candles {
+		if len(exchanges) == 0 || exchanges[len(exchanges)-1].Exchange != candle.Exchange {
+			exchanges = append(exchanges, ExchangeCandles{
+				Exchange: candle.Exchange,
+				Candles:  []CandleResponse{},
+			})
+		}
+
+		group := &exchanges[len(exchanges)-1]
+		group.Candles = append(group.Candles, CandleResponse{
+			OpenTime: candle.OpenTime,
+			Open:     candle.Open,
+			High:     candle.High,
+			Low:      candle.Low,
+			Close:    candle.Close,
+			Count:    candle.Count,
+		})
+	}
+
+	return c.JSON(http.StatusOK, CandlesResponse{
+		Coin:      coin,
+		Interval:  interval,
+		From:      from,
+		To:        to,
+		Exchanges: exchanges,
+	})
+}
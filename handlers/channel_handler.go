@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/notifiers"
+	"github.com/notblessy/dexlite/services"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+type ChannelHandler struct {
+	db      *gorm.DB
+	webhook *services.WebhookClient
+	// smtp sends test mails for email channels, nil when not configured
+	smtp *notifiers.SMTPServer
+}
+
+func NewChannelHandler(db *gorm.DB, smtp *notifiers.SMTPServer) *ChannelHandler {
+	return &ChannelHandler{
+		db:      db,
+		webhook: services.NewWebhookClient(),
+		smtp:    smtp,
+	}
+}
+
+// ChannelRequest creates or replaces a channel. On update an empty token
+// keeps the stored one, since tokens are never returned, and so does an empty
+// or redacted target
+type ChannelRequest struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Target  string `json:"target"`
+	Token   string `json:"token"`
+	Enabled *bool  `json:"enabled"`
+}
+
+// apply copies the request onto channel
+func (r ChannelRequest) apply(channel *models.NotificationChannel) {
+	channel.Name = r.Name
+	if r.Target != "" && (channel.ID == 0 || r.Target != channel.Redacted().Target) {
+		channel.Target = r.Target
+	}
+	channel.Type = r.Type
+	if r.Token != "" {
+		channel.Token = r.Token
+	}
+	if r.Enabled != nil {
+		channel.Enabled = *r.Enabled
+	}
+}
+
+// ChannelTestPayload is what generic webhook channels receive on a test fire
+type ChannelTestPayload struct {
+	Type    string    `json:"type"`
+	Channel string    `json:"channel"`
+	Message string    `json:"message"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+// GetChannels lists every notification channel
+// GET /api/channels
+func (h *ChannelHandler) GetChannels(c echo.Context) error {
+	var channels []models.NotificationChannel
+	if err := h.db.Order("id ASC").Find(&channels).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch channels",
+		})
+	}
+
+	for i := range channels {
+		channels[i] = channels[i].Redacted()
+	}
+	return c.JSON(http.StatusOK, channels)
+}
+
+// GetChannel returns a single notification channel
+// GET /api/channels/:id
+func (h *ChannelHandler) GetChannel(c echo.Context) error {
+	channel, found, err := h.find(c)
+	if !found {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, channel.Redacted())
+}
+
+// CreateChannel adds a notification channel, enabled unless stated otherwise
+// POST /api/channels
+func (h *ChannelHandler) CreateChannel(c echo.Context) error {
+	var req ChannelRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	channel := models.NotificationChannel{Enabled: true}
+	req.apply(&channel)
+
+	if err := channel.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.db.Create(&channel).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to create channel",
+		})
+	}
+
+	return c.JSON(http.StatusCreated, channel.Redacted())
+}
+
+// UpdateChannel replaces a notification channel's settings
+// PUT /api/channels/:id
+func (h *ChannelHandler) UpdateChannel(c echo.Context) error {
+	channel, found, err := h.find(c)
+	if !found {
+		return err
+	}
+	if channel.Managed {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "channel is managed in the config file",
+		})
+	}
+
+	var req ChannelRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+	req.apply(channel)
+
+	if err := channel.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.db.Save(channel).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to update channel",
+		})
+	}
+
+	return c.JSON(http.StatusOK, channel.Redacted())
+}
+
+// DeleteChannel removes a notification channel
+// DELETE /api/channels/:id
+func (h *ChannelHandler) DeleteChannel(c echo.Context) error {
+	channel, found, err := h.find(c)
+	if !found {
+		return err
+	}
+	if channel.Managed {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "channel is managed in the config file",
+		})
+	}
+
+	if err := h.db.Delete(channel).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to delete channel",
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// TestChannel sends a test message so a new channel can be checked without
+// waiting for a real alert. Disabled channels can be tested too
+// POST /api/channels/:id/test
+func (h *ChannelHandler) TestChannel(c echo.Context) error {
+	channel, found, err := h.find(c)
+	if !found {
+		return err
+	}
+
+	message := fmt.Sprintf("dexlite test notification for channel %q", channel.Name)
+
+	switch channel.Type {
+	case models.CHANNEL_SLACK:
+		err = h.webhook.SendSlack(channel.Target, message)
+	case models.CHANNEL_TELEGRAM:
+		err = h.webhook.SendTelegram(channel.Token, channel.Target, message)
+	case models.CHANNEL_DISCORD:
+		err = h.webhook.Send(channel.Target, map[string]string{"content": message})
+	case models.CHANNEL_EMAIL:
+		err = h.sendTestMail(channel, message)
+	default:
+		err = h.webhook.Send(channel.Target, ChannelTestPayload{
+			Type:    "test",
+			Channel: channel.Name,
+			Message: message,
+			SentAt:  time.Now(),
+		})
+	}
+	if err != nil {
+		// What the destination answered stays in the log, it could be any
+		// server the channel points at
+		log.Warn().Err(err).Uint("channel", channel.ID).Str("type", channel.Type).Msg("Test notification failed")
+		return c.JSON(http.StatusBadGateway, map[string]string{
+			"error": "test notification failed, see the server log",
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"status": "sent",
+	})
+}
+
+// sendTestMail mails message to an email channel's recipients
+func (h *ChannelHandler) sendTestMail(channel *models.NotificationChannel, message string) error {
+	if h.smtp == nil {
+		return errors.New("no SMTP server configured")
+	}
+
+	email, err := notifiers.NewEmail(*h.smtp, channel.Recipients(), "", "")
+	if err != nil {
+		return err
+	}
+	return email.Send(message, "<p>"+html.EscapeString(message)+"</p>")
+}
+
+// find loads the channel named by the :id parameter. When found is false the
+// error response has already been written and err is what the handler returns
+func (h *ChannelHandler) find(c echo.Context) (channel *models.NotificationChannel, found bool, err error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, false, c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid channel id",
+		})
+	}
+
+	channel = &models.NotificationChannel{}
+	if err := h.db.First(channel, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, c.JSON(http.StatusNotFound, map[string]string{
+				"error": "channel not found",
+			})
+		}
+		return nil, false, c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch channel",
+		})
+	}
+
+	return channel, true, nil
+}
@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/symbols"
+	"gorm.io/gorm"
+)
+
+// Compatibility modes that can be enabled in config
+const (
+	COMPAT_COINGECKO = "coingecko"
+	COMPAT_CCXT      = "ccxt"
+)
+
+// COMPAT_QUOTES are the quote currencies accepted in CCXT symbols and CoinGecko
+// vs_currencies. Every stored price is a dollar price
+var COMPAT_QUOTES = []string{"USD", "USDT", "USDC"}
+
+// MAX_COMPAT_OHLCV caps how many candles one CCXT OHLCV request returns
+const MAX_COMPAT_OHLCV = 1000
+
+// CompatHandler serves core data in the shapes of the CoinGecko API and the
+// CCXT unified API, so tooling written for those can read from dexlite
+type CompatHandler struct {
+	db *gorm.DB
+	// ids maps coins to CoinGecko IDs and back
+	ids     map[string]string
+	coins   map[string]string
+	primary string
+}
+
+// NewCompatHandler creates a handler answering with ids as CoinGecko coin IDs.
+// CCXT requests without an exchange read from primary
+func NewCompatHandler(db *gorm.DB, ids map[string]string, primary string) *CompatHandler {
+	coins := make(map[string]string, len(ids))
+	for coin, id := range ids {
+		coins[id] = coin
+	}
+
+	return &CompatHandler{
+		db:      db,
+		ids:     ids,
+		coins:   coins,
+		primary: primary,
+	}
+}
+
+// CoinGeckoCoin is an entry of /coins/list
+type CoinGeckoCoin struct {
+	ID     string `json:"id"`
+	Symbol string `json:"symbol"`
+	Name   string `json:"name"`
+}
+
+// CCXTTicker is the CCXT unified ticker structure. Fields dexlite doesn't
+// collect are always null
+type CCXTTicker struct {
+	Symbol        string   `json:"symbol"`
+	Timestamp     int64    `json:"timestamp"`
+	Datetime      string   `json:"datetime"`
+	High          float64  `json:"high"`
+	Low           float64  `json:"low"`
+	Bid           *float64 `json:"bid"`
+	BidVolume     *float64 `json:"bidVolume"`
+	Ask           *float64 `json:"ask"`
+	AskVolume     *float64 `json:"askVolume"`
+	Vwap          *float64 `json:"vwap"`
+	Open          float64  `json:"open"`
+	Close         float64  `json:"close"`
+	Last          float64  `json:"last"`
+	PreviousClose *float64 `json:"previousClose"`
+	Change        float64  `json:"change"`
+	Percentage    float64  `json:"percentage"`
+	Average       float64  `json:"average"`
+	BaseVolume    *float64 `json:"baseVolume"`
+	QuoteVolume   *float64 `json:"quoteVolume"`
+	Info          any      `json:"info"`
+}
+
+// GetCoinGeckoPing answers CoinGecko's health check
+// GET /compat/coingecko/api/v3/ping
+func (h *CompatHandler) GetCoinGeckoPing(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{
+		"gecko_says": "(V3) To the Moon!",
+	})
+}
+
+// GetCoinGeckoCurrencies lists the vs_currencies simple/price accepts
+// GET /compat/coingecko/api/v3/simple/supported_vs_currencies
+func (h *CompatHandler) GetCoinGeckoCurrencies(c echo.Context) error {
+	currencies := make([]string, len(COMPAT_QUOTES))
+	for i, quote := range COMPAT_QUOTES {
+		currencies[i] = strings.ToLower(quote)
+	}
+	return c.JSON(http.StatusOK, currencies)
+}
+
+// GetCoinGeckoCoins lists the coins that have a CoinGecko ID
+// GET /compat/coingecko/api/v3/coins/list
+func (h *CompatHandler) GetCoinGeckoCoins(c echo.Context) error {
+	coins := make([]CoinGeckoCoin, 0, len(h.ids))
+	for coin, id := range h.ids {
+		coins = append(coins, CoinGeckoCoin{ID: id, Symbol: strings.ToLower(coin), Name: coin})
+	}
+	sort.Slice(coins, func(i, j int) bool { return coins[i].ID < coins[j].ID })
+
+	return c.JSON(http.StatusOK, coins)
+}
+
+// GetCoinGeckoSimplePrice returns the median of every venue's latest price
+// per CoinGecko ID, with the median 24h change and last update when asked.
+// Unknown IDs and currencies are left out, as CoinGecko does
+// GET /compat/coingecko/api/v3/simple/price?ids=bitcoin,ethereum&vs_currencies=usd&include_24hr_change=true&include_last_updated_at=true
+func (h *CompatHandler) GetCoinGeckoSimplePrice(c echo.Context) error {
+	ids := splitList(c.QueryParam("ids"))
+	currencies := splitList(c.QueryParam("vs_currencies"))
+	if len(ids) == 0 || len(currencies) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Missing parameter ids or vs_currencies",
+		})
+	}
+	if err := checkCoins(c, len(ids)); err != nil {
+		return badRequest(c, err)
+	}
+	includeChange := c.QueryParam("include_24hr_change") == "true"
+	includeUpdated := c.QueryParam("include_last_updated_at") == "true"
+
+	since := time.Now().Add(-24 * time.Hour)
+	response := make(map[string]map[string]any, len(ids))
+
+	for _, id := range ids {
+		coin, ok := h.coins[strings.ToLower(id)]
+		if !ok {
+			continue
+		}
+
+		rows, err := windowStats(h.db.WithContext(c.Request().Context()), coin, since)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to fetch prices",
+			})
+		}
+		if len(rows) == 0 {
+			continue
+		}
+
+		closes := make([]float64, len(rows))
+		changes := make([]float64, len(rows))
+		var updated time.Time
+		for i, row := range rows {
+			closes[i] = row.Close
+			if row.Open != 0 {
+				changes[i] = (row.Close - row.Open) / row.Open * 100
+			}
+			if row.LastAt.After(updated) {
+				updated = row.LastAt
+			}
+		}
+
+		prices := make(map[string]any)
+		for _, currency := range currencies {
+			currency = strings.ToLower(currency)
+			if !slices.Contains(COMPAT_QUOTES, strings.ToUpper(currency)) {
+				continue
+			}
+			prices[currency] = median(closes)
+			if includeChange {
+				prices[currency+"_24h_change"] = median(changes)
+			}
+		}
+		if len(prices) == 0 {
+			continue
+		}
+		if includeUpdated {
+			prices["last_updated_at"] = updated.Unix()
+		}
+		response[strings.ToLower(id)] = prices
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// GetCCXTTicker returns a CCXT unified ticker over the last 24h of one venue
+// GET /compat/ccxt/ticker?symbol=BTC/USD&exchange=binance
+func (h *CompatHandler) GetCCXTTicker(c echo.Context) error {
+	exchange := h.exchange(c)
+	coin, ok := ccxtCoin(c.QueryParam("symbol"))
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "symbol must be BASE/QUOTE with a USD, USDT or USDC quote",
+		})
+	}
+
+	ticker, found, err := h.ticker(c, coin, c.QueryParam("symbol"), exchange)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch ticker",
+		})
+	}
+	if !found {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "no prices for " + c.QueryParam("symbol") + " on " + exchange,
+		})
+	}
+
+	return c.JSON(http.StatusOK, ticker)
+}
+
+// GetCCXTTickers returns CCXT unified tickers keyed by symbol. Symbols without
+// prices are left out
+// GET /compat/ccxt/tickers?symbols=BTC/USD,ETH/USD&exchange=binance
+func (h *CompatHandler) GetCCXTTickers(c echo.Context) error {
+	exchange := h.exchange(c)
+	requested := splitList(c.QueryParam("symbols"))
+	if err := checkCoins(c, len(requested)); err != nil {
+		return badRequest(c, err)
+	}
+	tickers := make(map[string]CCXTTicker)
+
+	for _, symbol := range requested {
+		coin, ok := ccxtCoin(symbol)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "symbol " + symbol + " must be BASE/QUOTE with a USD, USDT or USDC quote",
+			})
+		}
+
+		ticker, found, err := h.ticker(c, coin, symbol, exchange)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to fetch tickers",
+			})
+		}
+		if found {
+			tickers[symbol] = ticker
+		}
+	}
+
+	return c.JSON(http.StatusOK, tickers)
+}
+
+// GetCCXTOHLCV returns candles as CCXT [timestamp, open, high, low, close,
+// volume] arrays, oldest first. Volume is not collected and always 0
+// GET /compat/ccxt/ohlcv?symbol=BTC/USD&timeframe=1h&since=1700000000000&limit=100&exchange=binance
+func (h *CompatHandler) GetCCXTOHLCV(c echo.Context) error {
+	coin, ok := ccxtCoin(c.QueryParam("symbol"))
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "symbol must be BASE/QUOTE with a USD, USDT or USDC quote",
+		})
+	}
+
+	timeframe := c.QueryParam("timeframe")
+	if timeframe == "" {
+		timeframe = "1m"
+	}
+	if _, ok := models.CANDLE_INTERVALS[timeframe]; !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "timeframe must be 1m, 5m or 1h",
+		})
+	}
+
+	// CCXT clients expect an oversized limit to be clamped, not refused
+	limit := min(MAX_COMPAT_OHLCV, limitsOf(c).MaxRows)
+	if raw := c.QueryParam("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "invalid limit",
+			})
+		}
+		limit = min(parsed, limit)
+	}
+
+	query := h.db.WithContext(c.Request().Context()).
+		Where("coin = ? AND exchange = ? AND resolution = ?", coin, h.exchange(c), timeframe)
+
+	// Like CCXT, without since the most recent candles are returned
+	if raw := c.QueryParam("since"); raw != "" {
+		since, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "since must be a timestamp in milliseconds",
+			})
+		}
+		query = query.Where("open_time >= ?", time.UnixMilli(since)).Order("open_time ASC")
+	} else {
+		query = query.Order("open_time DESC")
+	}
+
+	var candles []models.CoinCandle
+	if err := query.Limit(limit).Find(&candles).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch candles",
+		})
+	}
+	if c.QueryParam("since") == "" {
+		slices.Reverse(candles)
+	}
+
+	ohlcv := make([][6]float64, len(candles))
+	for i, candle := range candles {
+		ohlcv[i] = [6]float64{float64(candle.OpenTime.UnixMilli()), candle.Open, candle.High, candle.Low, candle.Close, 0}
+	}
+
+	return c.JSON(http.StatusOK, ohlcv)
+}
+
+// ticker builds the CCXT ticker of coin on exchange from its last 24h
+func (h *CompatHandler) ticker(c echo.Context, coin, symbol, exchange string) (CCXTTicker, bool, error) {
+	rows, err := windowStats(h.db.WithContext(c.Request().Context()), coin, time.Now().Add(-24*time.Hour), scopeSources([]string{exchange}))
+	if err != nil || len(rows) == 0 {
+		return CCXTTicker{}, false, err
+	}
+
+	row := rows[0]
+	ticker := CCXTTicker{
+		Symbol:    symbol,
+		Timestamp: row.LastAt.UnixMilli(),
+		Datetime:  row.LastAt.UTC().Format("2006-01-02T15:04:05.000Z"),
+		High:      row.High,
+		Low:       row.Low,
+		Open:      row.Open,
+		Close:     row.Close,
+		Last:      row.Close,
+		Change:    row.Close - row.Open,
+		Average:   (row.Open + row.Close) / 2,
+		Info:      map[string]any{"exchange": row.Exchange, "count": row.Count},
+	}
+	if row.Open != 0 {
+		ticker.Percentage = ticker.Change / row.Open * 100
+	}
+	return ticker, true, nil
+}
+
+// exchange is the venue a CCXT request reads from
+func (h *CompatHandler) exchange(c echo.Context) string {
+	if exchange := c.QueryParam("exchange"); exchange != "" {
+		return exchange
+	}
+	return h.primary
+}
+
+// ccxtCoin returns the coin of a CCXT BASE/QUOTE symbol. Perpetual symbols
+// such as BTC/USDT:USDT are accepted too
+func ccxtCoin(symbol string) (string, bool) {
+	base, quote, ok := strings.Cut(symbol, "/")
+	if !ok || base == "" {
+		return "", false
+	}
+	quote, _, _ = strings.Cut(quote, ":")
+	if !slices.Contains(COMPAT_QUOTES, strings.ToUpper(quote)) {
+		return "", false
+	}
+	return symbols.Normalize(base), true
+}
+
+// splitList splits a comma separated query parameter, dropping empty entries
+func splitList(raw string) []string {
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// median returns the middle value of values, which must not be empty
+func median(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+)
+
+// priceCursor marks the last row of a page of prices ordered by exchange
+// ascending, then newest first
+type priceCursor struct {
+	Exchange  string    `json:"e"`
+	CreatedAt time.Time `json:"t"`
+	ID        uint      `json:"i"`
+}
+
+func newPriceCursor(price models.CoinPrice) priceCursor {
+	return priceCursor{
+		Exchange:  price.Exchange,
+		CreatedAt: price.CreatedAt,
+		ID:        price.ID,
+	}
+}
+
+// encode returns the opaque token handed to clients
+func (pc priceCursor) encode() string {
+	bytes, _ := json.Marshal(pc)
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+func decodePriceCursor(token string) (priceCursor, error) {
+	var pc priceCursor
+
+	bytes, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return pc, errors.New("invalid cursor")
+	}
+	if err := json.Unmarshal(bytes, &pc); err != nil || pc.Exchange == "" {
+		return pc, errors.New("invalid cursor")
+	}
+	return pc, nil
+}
+
+// scopeAfter restricts a query ordered by exchange ASC, created_at DESC, id DESC
+// to the rows after the cursor
+func (pc priceCursor) scopeAfter(db *gorm.DB) *gorm.DB {
+	return db.Where(
+		"exchange > ? OR (exchange = ? AND (created_at < ? OR (created_at = ? AND id < ?)))",
+		pc.Exchange, pc.Exchange, pc.CreatedAt, pc.CreatedAt, pc.ID,
+	)
+}
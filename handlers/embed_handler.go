@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+)
+
+// Embed widget defaults
+const (
+	EMBED_INTERVAL     = "5m"
+	EMBED_CHART_POINTS = 72
+	EMBED_REFRESH      = 60 * time.Second
+	EMBED_WIDTH        = 320
+	EMBED_HEIGHT       = 240
+)
+
+//go:embed templates/embed.html
+var embedTemplate string
+
+var embedPage = template.Must(template.New("embed").Parse(embedTemplate))
+
+type EmbedHandler struct {
+	db *gorm.DB
+}
+
+func NewEmbedHandler(db *gorm.DB) *EmbedHandler {
+	return &EmbedHandler{
+		db: db,
+	}
+}
+
+// embedVenue is one row of the widget's price table. Best marks the cheapest venue
+type embedVenue struct {
+	Exchange string
+	Price    string
+	Best     bool
+}
+
+type embedData struct {
+	Coin           string
+	Theme          string
+	Interval       string
+	Window         string
+	RefreshSeconds int
+	ChartWidth     int
+	ChartHeight    int
+	Points         string
+	Venues         []embedVenue
+	UpdatedAt      string
+}
+
+// OEmbedResponse is a rich oEmbed response wrapping the widget in an iframe
+type OEmbedResponse struct {
+	Version      string `json:"version"`
+	Type         string `json:"type"`
+	ProviderName string `json:"provider_name"`
+	Title        string `json:"title"`
+	HTML         string `json:"html"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+// GetEmbed renders a self-refreshing HTML widget with a sparkline of the
+// average candle close across venues and the latest price of each venue,
+// meant to be dropped into an iframe
+// GET /embed/:coin?interval=5m&theme=dark
+func (h *EmbedHandler) GetEmbed(c echo.Context) error {
+	coin := c.Param("coin")
+
+	interval := c.QueryParam("interval")
+	if interval == "" {
+		interval = EMBED_INTERVAL
+	}
+	size, ok := models.CANDLE_INTERVALS[interval]
+	if !ok {
+		return c.String(http.StatusBadRequest, "unsupported interval, use 1m, 5m or 1h")
+	}
+
+	theme := "light"
+	if c.QueryParam("theme") == "dark" {
+		theme = "dark"
+	}
+
+	ctx := c.Request().Context()
+	window := size * EMBED_CHART_POINTS
+
+	var latest []models.CoinPrice
+	query := h.db.WithContext(ctx).Model(&models.CoinPrice{}).Where("coin = ?", coin)
+	err := db.LatestPer(query, "exchange").Find(&latest).Error
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "failed to fetch latest prices")
+	}
+
+	var closes []float64
+	err = h.db.WithContext(ctx).Model(&models.CoinCandle{}).
+		Where("coin = ? AND resolution = ? AND open_time >= ?", coin, interval, time.Now().Add(-window)).
+		Group("open_time").
+		Order("open_time ASC").
+		Pluck("AVG(close)", &closes).Error
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "failed to fetch candles")
+	}
+
+	data := embedData{
+		Coin:           coin,
+		Theme:          theme,
+		Interval:       interval,
+		Window:         strings.TrimSuffix(strings.TrimSuffix(window.String(), "0s"), "0m"),
+		RefreshSeconds: int(EMBED_REFRESH.Seconds()),
+		ChartWidth:     EMBED_CHART_POINTS - 1,
+		ChartHeight:    100,
+		Points:         sparkline(closes, EMBED_CHART_POINTS-1, 100),
+	}
+
+	var newest time.Time
+	for _, price := range latest {
+		data.Venues = append(data.Venues, embedVenue{
+			Exchange: price.Exchange,
+			Price:    strconv.FormatFloat(price.Price, 'f', -1, 64),
+			Best:     len(latest) > 1 && price.Price == cheapest(latest),
+		})
+		if price.CreatedAt.After(newest) {
+			newest = price.CreatedAt
+		}
+	}
+	if !newest.IsZero() {
+		data.UpdatedAt = newest.UTC().Format("2006-01-02 15:04")
+	}
+
+	var page strings.Builder
+	if err := embedPage.Execute(&page, data); err != nil {
+		return c.String(http.StatusInternalServerError, "failed to render widget")
+	}
+
+	// Any site may frame the widget
+	c.Response().Header().Set("Content-Security-Policy", "frame-ancestors *")
+	c.Response().Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(EMBED_REFRESH.Seconds())/2))
+	return c.HTML(http.StatusOK, page.String())
+}
+
+// GetOEmbed describes an /embed URL so oEmbed consumers such as wikis can
+// turn a pasted link into the widget. Only the JSON format is supported
+// GET /oembed?url=https://host/embed/BTC&maxwidth=&maxheight=
+func (h *EmbedHandler) GetOEmbed(c echo.Context) error {
+	if format := c.QueryParam("format"); format != "" && format != "json" {
+		return c.JSON(http.StatusNotImplemented, map[string]string{
+			"error": "only the json format is supported",
+		})
+	}
+
+	target, err := url.Parse(c.QueryParam("url"))
+	if err != nil || !strings.HasPrefix(target.Path, "/embed/") || (target.Scheme != "http" && target.Scheme != "https") {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "url must point at an /embed/:coin widget",
+		})
+	}
+	coin := strings.TrimPrefix(target.Path, "/embed/")
+
+	width := boundedDimension(c.QueryParam("maxwidth"), EMBED_WIDTH)
+	height := boundedDimension(c.QueryParam("maxheight"), EMBED_HEIGHT)
+
+	return c.JSON(http.StatusOK, OEmbedResponse{
+		Version:      "1.0",
+		Type:         "rich",
+		ProviderName: "dexlite",
+		Title:        coin + " prices",
+		HTML: fmt.Sprintf(`<iframe src="%s" width="%d" height="%d" frameborder="0" loading="lazy" title="%s prices"></iframe>`,
+			template.HTMLEscapeString(target.String()), width, height, template.HTMLEscapeString(coin)),
+		Width:  width,
+		Height: height,
+	})
+}
+
+// boundedDimension returns fallback, capped at the requested maximum if any
+func boundedDimension(raw string, fallback int) int {
+	if limit, err := strconv.Atoi(raw); err == nil && limit > 0 && limit < fallback {
+		return limit
+	}
+	return fallback
+}
+
+// cheapest returns the lowest price among prices
+func cheapest(prices []models.CoinPrice) float64 {
+	low := prices[0].Price
+	for _, price := range prices[1:] {
+		if price.Price < low {
+			low = price.Price
+		}
+	}
+	return low
+}
+
+// sparkline scales values into SVG polyline points filling a width by height
+// box, with the y axis pointing down
+func sparkline(values []float64, width, height float64) string {
+	if len(values) < 2 {
+		return ""
+	}
+
+	low, high := values[0], values[0]
+	for _, value := range values {
+		low = min(low, value)
+		high = max(high, value)
+	}
+	spread := high - low
+	if spread == 0 {
+		spread = 1
+	}
+
+	points := make([]string, len(values))
+	step := width / float64(len(values)-1)
+	for i, value := range values {
+		y := height - (value-low)/spread*height
+		points[i] = fmt.Sprintf("%.2f,%.2f", float64(i)*step, y)
+	}
+	return strings.Join(points, " ")
+}
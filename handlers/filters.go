@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/db"
+	"gorm.io/gorm"
+)
+
+// sourcesFilter reads the comma separated sources query parameter, e.g.
+// ?sources=hyperliquid,binance. An empty result means no restriction
+func sourcesFilter(c echo.Context) []string {
+	value := c.QueryParam("sources")
+	if value == "" {
+		return nil
+	}
+
+	var sources []string
+	for _, source := range strings.Split(value, ",") {
+		source = strings.ToLower(strings.TrimSpace(source))
+		if source != "" {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// scopeSources restricts a query on an exchange column to the given sources
+func scopeSources(sources []string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(sources) == 0 {
+			return db
+		}
+		return db.Where("exchange IN ?", sources)
+	}
+}
+
+// REGION_NEAREST selects, per exchange, ticks collected in the region of its
+// matching engine
+const REGION_NEAREST = "nearest"
+
+// scopeRegion restricts a query to ticks collected in region. With
+// REGION_NEAREST, exchanges that have an engine region only return ticks
+// collected there and every other exchange is left unrestricted
+func scopeRegion(region string, engineRegions map[string]string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		switch region {
+		case "":
+			return db
+		case REGION_NEAREST:
+			if len(engineRegions) == 0 {
+				return db
+			}
+
+			exchanges := make([]string, 0, len(engineRegions))
+			for exchange := range engineRegions {
+				exchanges = append(exchanges, exchange)
+			}
+			sort.Strings(exchanges)
+
+			nearest := db.Session(&gorm.Session{NewDB: true}).Where("exchange NOT IN ?", exchanges)
+			for _, exchange := range exchanges {
+				nearest = nearest.Or("exchange = ? AND region = ?", exchange, engineRegions[exchange])
+			}
+			return db.Where(nearest)
+		default:
+			return db.Where("region = ?", region)
+		}
+	}
+}
+
+// labelsFilter reads the labels query parameter as comma separated key:value
+// pairs, e.g. ?labels=role:fallback,network:arbitrum
+func labelsFilter(c echo.Context) map[string]string {
+	value := c.QueryParam("labels")
+	if value == "" {
+		return nil
+	}
+
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || key == "" {
+			continue
+		}
+		labels[key] = val
+	}
+	return labels
+}
+
+// scopeLabels restricts a query to rows whose labels contain every given pair
+func scopeLabels(labels map[string]string) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if len(labels) == 0 {
+			return tx
+		}
+		if !db.IsPostgres(tx) {
+			// MariaDB's json_extract keeps the quotes of strings
+			extract := "json_extract(labels, ?)"
+			if db.IsMySQL(tx) {
+				extract = "JSON_UNQUOTE(JSON_EXTRACT(labels, ?))"
+			}
+			for key, value := range labels {
+				path, _ := json.Marshal(key)
+				tx = tx.Where(extract+" = ?", "$."+string(path), value)
+			}
+			return tx
+		}
+		contains, _ := json.Marshal(labels)
+		return tx.Where("labels @> ?::jsonb", string(contains))
+	}
+}
+
+// timeParam reads a query parameter as RFC3339 or unix seconds. A missing
+// parameter returns fallback
+func timeParam(c echo.Context, name string, fallback time.Time) (time.Time, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be RFC3339 or unix seconds", name)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Freshness tells consumers how old the newest price in a response is. Both
+// fields are null when the response holds no prices
+type Freshness struct {
+	AsOf             *time.Time `json:"as_of"`
+	StalenessSeconds *float64   `json:"staleness_seconds"`
+}
+
+// newFreshness describes data last updated at asOf. A zero asOf means no data
+func newFreshness(asOf time.Time) Freshness {
+	if asOf.IsZero() {
+		return Freshness{}
+	}
+
+	staleness := time.Since(asOf).Seconds()
+	return Freshness{
+		AsOf:             &asOf,
+		StalenessSeconds: &staleness,
+	}
+}
+
+// checkStaleness enforces the optional max_staleness query parameter, given as
+// a duration like 90s or a number of seconds. When the data is older, or
+// missing, it writes a 409 and returns false
+func checkStaleness(c echo.Context, freshness Freshness) (bool, error) {
+	value := c.QueryParam("max_staleness")
+	if value == "" {
+		return true, nil
+	}
+
+	maxStaleness, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.ParseFloat(value, 64)
+		if convErr != nil {
+			return false, c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "max_staleness must be a duration like 90s or a number of seconds",
+			})
+		}
+		maxStaleness = time.Duration(seconds * float64(time.Second))
+	}
+
+	if freshness.StalenessSeconds == nil {
+		return false, c.JSON(http.StatusConflict, map[string]string{
+			"error": "no data available",
+		})
+	}
+
+	if *freshness.StalenessSeconds > maxStaleness.Seconds() {
+		return false, c.JSON(http.StatusConflict, map[string]interface{}{
+			"error":             fmt.Sprintf("data is older than max_staleness %s", maxStaleness),
+			"as_of":             freshness.AsOf,
+			"staleness_seconds": freshness.StalenessSeconds,
+		})
+	}
+
+	return true, nil
+}
@@ -0,0 +1,493 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// DEFAULT_APR_WINDOW is what trailing APRs average over when no window is given
+	DEFAULT_APR_WINDOW = 24 * time.Hour
+	MAX_APR_WINDOW     = 30 * 24 * time.Hour
+
+	DEFAULT_FUNDING_LIMIT = 1000
+)
+
+type FundingHandler struct {
+	db *gorm.DB
+	// changed signals newly stored funding rates for long polls
+	changed func() <-chan struct{}
+}
+
+// NewFundingHandler creates a handler over stored funding rates. changed
+// returns a channel closed when rates are next stored
+func NewFundingHandler(db *gorm.DB, changed func() <-chan struct{}) *FundingHandler {
+	return &FundingHandler{
+		db:      db,
+		changed: changed,
+	}
+}
+
+type FundingRateResponse struct {
+	Rate          float64   `json:"rate"`
+	Premium       *float64  `json:"premium,omitempty"`
+	IntervalHours float64   `json:"interval_hours"`
+	Time          time.Time `json:"time"`
+}
+
+// ExchangeFundingRates holds one venue's rates, newest first
+type ExchangeFundingRates struct {
+	Exchange string                `json:"exchange"`
+	Rates    []FundingRateResponse `json:"rates"`
+}
+
+type FundingRatesResponse struct {
+	Coin      string                 `json:"coin"`
+	From      time.Time              `json:"from"`
+	To        time.Time              `json:"to"`
+	Exchanges []ExchangeFundingRates `json:"exchanges"`
+}
+
+// GetFundingRates returns the stored funding rates of a coin grouped by
+// exchange, as fractions of notional per funding interval. The window
+// defaults to the last 24 hours
+// GET /api/funding/:coin?from=&to=&limit=1000&sources=
+func (h *FundingHandler) GetFundingRates(c echo.Context) error {
+	coin := c.Param("coin")
+	if coin == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "coin symbol is required",
+		})
+	}
+
+	from, to, err := timeWindow(c, 24*time.Hour)
+	if err != nil {
+		return badRequest(c, err)
+	}
+
+	limit, err := rowLimit(c, DEFAULT_FUNDING_LIMIT)
+	if err != nil {
+		return badRequest(c, err)
+	}
+
+	var rates []models.FundingRate
+	err = h.db.WithContext(c.Request().Context()).Where("coin = ? AND created_at >= ? AND created_at < ?", coin, from, to).
+		Scopes(scopeSources(sourcesFilter(c))).
+		Order("exchange ASC, created_at DESC, id DESC").
+		Limit(limit).
+		Find(&rates).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch funding rates",
+		})
+	}
+
+	// Rows arrive ordered by exchange so each venue forms a contiguous run
+	exchanges := []ExchangeFundingRates{}
+	for _, rate := range rates {
+		if len(exchanges) == 0 || exchanges[len(exchanges)-1].Exchange != rate.Exchange {
+			exchanges = append(exchanges, ExchangeFundingRates{
+				Exchange: rate.Exchange,
+				Rates:    []FundingRateResponse{},
+			})
+		}
+
+		group := &exchanges[len(exchanges)-1]
+		group.Rates = append(group.Rates, FundingRateResponse{
+			Rate:          rate.Rate,
+			Premium:       rate.Premium,
+			IntervalHours: rate.IntervalHours,
+			Time:          rate.CreatedAt,
+		})
+	}
+
+	return c.JSON(http.StatusOK, FundingRatesResponse{
+		Coin:      coin,
+		From:      from,
+		To:        to,
+		Exchanges: exchanges,
+	})
+}
+
+// FundingAPRPoint is one funding observation annualized. AvgAPR is the mean
+// APR over the trailing window ending at Time, which smooths the hourly noise
+// for comparison against lending rates
+type FundingAPRPoint struct {
+	Seq    uint      `json:"seq"`
+	Time   time.Time `json:"time"`
+	Rate   float64   `json:"rate"`
+	APR    float64   `json:"apr"`
+	APY    float64   `json:"apy"`
+	AvgAPR float64   `json:"avg_apr"`
+}
+
+// ExchangeFundingAPR holds one venue's series, oldest first
+type ExchangeFundingAPR struct {
+	Exchange string            `json:"exchange"`
+	Points   []FundingAPRPoint `json:"points"`
+}
+
+type FundingAPRResponse struct {
+	Coin      string               `json:"coin"`
+	Window    string               `json:"window"`
+	From      time.Time            `json:"from"`
+	To        time.Time            `json:"to"`
+	Exchanges []ExchangeFundingAPR `json:"exchanges"`
+}
+
+// FundingAPRPollResponse carries the points after since_seq. Seq is the value
+// to send as since_seq on the next poll
+type FundingAPRPollResponse struct {
+	Coin      string               `json:"coin"`
+	Window    string               `json:"window"`
+	Seq       uint                 `json:"seq"`
+	Exchanges []ExchangeFundingAPR `json:"exchanges"`
+}
+
+// GetFundingAPR returns funding annualized as a yield a short collects, per
+// exchange, in percent. APR is simple and APY compounds every funding interval
+// the way lending markets quote. The window defaults to the last 7 days
+// GET /api/funding/:coin/apr?from=&to=&window=24h&sources=
+func (h *FundingHandler) GetFundingAPR(c echo.Context) error {
+	coin := c.Param("coin")
+	if coin == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "coin symbol is required",
+		})
+	}
+
+	window, ok := aprWindow(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "window must be a duration up to 720h, e.g. 24h",
+		})
+	}
+
+	from, to, err := timeWindow(c, 7*24*time.Hour)
+	if err != nil {
+		return badRequest(c, err)
+	}
+
+	exchanges, err := h.series(c.Request().Context(), coin, sourcesFilter(c), from, to, window, 0)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch funding rates",
+		})
+	}
+
+	return c.JSON(http.StatusOK, FundingAPRResponse{
+		Coin:      coin,
+		Window:    window.String(),
+		From:      from,
+		To:        to,
+		Exchanges: exchanges,
+	})
+}
+
+// PollFundingAPR holds the request until funding newer than since_seq is
+// stored or the timeout passes, streaming the APR series the same way prices
+// are polled. Without since_seq it answers immediately with the sequence to
+// start from
+// GET /api/funding/:coin/apr/poll?since_seq=N&timeout=30s&window=24h&sources=
+func (h *FundingHandler) PollFundingAPR(c echo.Context) error {
+	coin := c.Param("coin")
+	if coin == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "coin symbol is required",
+		})
+	}
+
+	window, ok := aprWindow(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "window must be a duration up to 720h, e.g. 24h",
+		})
+	}
+
+	timeout := DEFAULT_POLL_TIMEOUT
+	if value := c.QueryParam("timeout"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 || parsed > MAX_POLL_TIMEOUT {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "timeout must be a duration up to 60s, e.g. 30s",
+			})
+		}
+		timeout = parsed
+	}
+
+	sources := sourcesFilter(c)
+	ctx := c.Request().Context()
+
+	// Poll responses are live data, never let a cache answer them
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+
+	value := c.QueryParam("since_seq")
+	if value == "" {
+		var seq uint
+		err := h.db.WithContext(ctx).Model(&models.FundingRate{}).
+			Select("COALESCE(MAX(id), 0)").
+			Where("coin = ?", coin).
+			Scopes(scopeSources(sources)).
+			Scan(&seq).Error
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to fetch sequence",
+			})
+		}
+		return c.JSON(http.StatusOK, FundingAPRPollResponse{Coin: coin, Window: window.String(), Seq: seq, Exchanges: []ExchangeFundingAPR{}})
+	}
+
+	sinceSeq, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "since_seq must be a non-negative integer",
+		})
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		// Take the signal before querying so a write in between still wakes us
+		changed := h.changed()
+
+		var first models.FundingRate
+		err := h.db.WithContext(ctx).Where("coin = ? AND id > ?", coin, sinceSeq).
+			Scopes(scopeSources(sources)).
+			Order("id ASC").
+			Limit(1).
+			Find(&first).Error
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to fetch funding rates",
+			})
+		}
+
+		if first.ID != 0 {
+			exchanges, err := h.series(ctx, coin, sources, first.CreatedAt, time.Now().Add(time.Second), window, uint(sinceSeq))
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"error": "failed to fetch funding rates",
+				})
+			}
+
+			seq := uint(sinceSeq)
+			for _, exchange := range exchanges {
+				for _, point := range exchange.Points {
+					seq = max(seq, point.Seq)
+				}
+			}
+			return c.JSON(http.StatusOK, FundingAPRPollResponse{Coin: coin, Window: window.String(), Seq: seq, Exchanges: exchanges})
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return c.JSON(http.StatusOK, FundingAPRPollResponse{Coin: coin, Window: window.String(), Seq: uint(sinceSeq), Exchanges: []ExchangeFundingAPR{}})
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// series loads funding rates between from and to grouped by exchange, each
+// point carrying its trailing window average. Rows up to window before from
+// are read only to seed the averages. Points with a seq of afterSeq or lower
+// are left out
+func (h *FundingHandler) series(ctx context.Context, coin string, sources []string, from, to time.Time, window time.Duration, afterSeq uint) ([]ExchangeFundingAPR, error) {
+	var rows []models.FundingRate
+	err := h.db.WithContext(ctx).Where("coin = ? AND created_at >= ? AND created_at < ?", coin, from.Add(-window), to).
+		Scopes(scopeSources(sources)).
+		Order("exchange ASC, created_at ASC, id ASC").
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows arrive ordered by exchange so each venue forms a contiguous run.
+	// start is the first row of the current venue still inside the window
+	exchanges := []ExchangeFundingAPR{}
+	var start int
+	var sum float64
+	for i, rate := range rows {
+		if i == 0 || rows[i-1].Exchange != rate.Exchange {
+			exchanges = append(exchanges, ExchangeFundingAPR{
+				Exchange: rate.Exchange,
+				Points:   []FundingAPRPoint{},
+			})
+			start, sum = i, 0
+		}
+
+		sum += rate.APR()
+		for !rows[start].CreatedAt.After(rate.CreatedAt.Add(-window)) {
+			sum -= rows[start].APR()
+			start++
+		}
+
+		if rate.CreatedAt.Before(from) || rate.ID <= afterSeq {
+			continue
+		}
+
+		group := &exchanges[len(exchanges)-1]
+		group.Points = append(group.Points, FundingAPRPoint{
+			Seq:    rate.ID,
+			Time:   rate.CreatedAt,
+			Rate:   rate.Rate,
+			APR:    rate.APR(),
+			APY:    rate.APY(),
+			AvgAPR: sum / float64(i-start+1),
+		})
+	}
+
+	// Venues whose rows only seeded the averages have nothing to show
+	shown := exchanges[:0]
+	for _, exchange := range exchanges {
+		if len(exchange.Points) > 0 {
+			shown = append(shown, exchange)
+		}
+	}
+	return shown, nil
+}
+
+// aprWindow reads the window query parameter, DEFAULT_APR_WINDOW when missing
+func aprWindow(c echo.Context) (time.Duration, bool) {
+	value := c.QueryParam("window")
+	if value == "" {
+		return DEFAULT_APR_WINDOW, true
+	}
+
+	window, err := time.ParseDuration(value)
+	if err != nil || window <= 0 || window > MAX_APR_WINDOW {
+		return 0, false
+	}
+	return window, true
+}
+
+// FundingPaymentsResponse is the funding a position collected over a window
+// on one venue, in USD. Received is what it collected, Paid what it paid and
+// Net their difference, negative when it paid more than it collected.
+// CoveredHours is how much of the window stored rates cover, a shortfall
+// means the funding fetcher missed some of it
+type FundingPaymentsResponse struct {
+	Coin         string    `json:"coin"`
+	Exchange     string    `json:"exchange"`
+	Notional     float64   `json:"notional"`
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+	Paid         float64   `json:"paid"`
+	Received     float64   `json:"received"`
+	Net          float64   `json:"net"`
+	Rates        int       `json:"rates"`
+	CoveredHours float64   `json:"covered_hours"`
+}
+
+// GetFundingPayments computes the funding a position of notional USD,
+// negative for a short, paid and received on exchange between from and to.
+// Each stored rate applies from when it was read until the next one, for at
+// most its funding interval, prorated by the hour. The window defaults to
+// the last 7 days
+// GET /api/funding/:coin/payments?exchange=hyperliquid&notional=10000&from=&to=
+func (h *FundingHandler) GetFundingPayments(c echo.Context) error {
+	coin := c.Param("coin")
+	if coin == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "coin symbol is required",
+		})
+	}
+
+	exchange := c.QueryParam("exchange")
+	if exchange == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "exchange is required",
+		})
+	}
+
+	notional, err := strconv.ParseFloat(c.QueryParam("notional"), 64)
+	if err != nil || notional == 0 || math.IsNaN(notional) || math.IsInf(notional, 0) {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "notional must be the position size in USD, negative for a short",
+		})
+	}
+
+	from, to, err := timeWindow(c, 7*24*time.Hour)
+	if err != nil {
+		return badRequest(c, err)
+	}
+
+	query := func() *gorm.DB {
+		return h.db.WithContext(c.Request().Context()).Where("coin = ? AND exchange = ?", coin, exchange)
+	}
+
+	// The rate read last before from is still in force when the window opens
+	var rates []models.FundingRate
+	err = query().Where("created_at < ?", from).
+		Order("created_at DESC, id DESC").
+		Limit(1).
+		Find(&rates).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch funding rates",
+		})
+	}
+
+	var window []models.FundingRate
+	err = query().Where("created_at >= ? AND created_at < ?", from, to).
+		Order("created_at ASC, id ASC").
+		Find(&window).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch funding rates",
+		})
+	}
+	rates = append(rates, window...)
+
+	response := FundingPaymentsResponse{
+		Coin:     coin,
+		Exchange: exchange,
+		Notional: notional,
+		From:     from,
+		To:       to,
+		Rates:    len(rates),
+	}
+	for i, rate := range rates {
+		if rate.IntervalHours <= 0 {
+			continue
+		}
+
+		start := rate.CreatedAt
+		if start.Before(from) {
+			start = from
+		}
+		end := to
+		if i+1 < len(rates) {
+			end = rates[i+1].CreatedAt
+		}
+		// A rate isn't carried past its own interval across a gap in the data
+		if limit := rate.CreatedAt.Add(time.Duration(rate.IntervalHours * float64(time.Hour))); end.After(limit) {
+			end = limit
+		}
+		if !end.After(start) {
+			continue
+		}
+
+		hours := end.Sub(start).Hours()
+		response.CoveredHours += hours
+		// Longs pay shorts when the rate is positive
+		payment := -notional * rate.Rate * hours / rate.IntervalHours
+		if payment > 0 {
+			response.Received += payment
+		} else {
+			response.Paid -= payment
+		}
+	}
+	response.Net = response.Received - response.Paid
+
+	return c.JSON(http.StatusOK, response)
+}
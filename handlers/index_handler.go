@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+)
+
+const (
+	DEFAULT_INDEX_LIMIT = 500
+
+	HEADER_INDEX_DEGRADED = "X-Dexlite-Index-Degraded"
+)
+
+type IndexHandler struct {
+	db *gorm.DB
+}
+
+func NewIndexHandler(db *gorm.DB) *IndexHandler {
+	return &IndexHandler{
+		db: db,
+	}
+}
+
+type IndexHistoryResponse struct {
+	Coin   string              `json:"coin"`
+	From   time.Time           `json:"from"`
+	To     time.Time           `json:"to"`
+	Prices []models.IndexPrice `json:"prices"`
+}
+
+// GetIndexPrice returns the latest composite index price of a coin. A
+// degraded index was computed from fewer fresh venues than the quorum and is
+// served with X-Dexlite-Index-Degraded: true so proxies and clients can react
+// without parsing the body
+// GET /api/index/:coin
+func (h *IndexHandler) GetIndexPrice(c echo.Context) error {
+	coin := c.Param("coin")
+	if coin == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "coin symbol is required",
+		})
+	}
+
+	var index models.IndexPrice
+	err := h.db.WithContext(c.Request().Context()).Where("coin = ?", coin).
+		Order("created_at DESC, id DESC").
+		First(&index).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": "no index price for this coin",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch index price",
+		})
+	}
+
+	c.Response().Header().Set(HEADER_INDEX_DEGRADED, strconv.FormatBool(index.Degraded))
+	return c.JSON(http.StatusOK, index)
+}
+
+// GetIndexHistory returns stored index prices of a coin, newest first. The
+// window defaults to the last 24 hours. degraded=false leaves out prices that
+// missed quorum
+// GET /api/index/:coin/history?from=&to=&limit=500&degraded=false
+func (h *IndexHandler) GetIndexHistory(c echo.Context) error {
+	coin := c.Param("coin")
+	if coin == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "coin symbol is required",
+		})
+	}
+
+	from, to, err := timeWindow(c, 24*time.Hour)
+	if err != nil {
+		return badRequest(c, err)
+	}
+
+	limit, err := rowLimit(c, DEFAULT_INDEX_LIMIT)
+	if err != nil {
+		return badRequest(c, err)
+	}
+
+	query := h.db.WithContext(c.Request().Context()).Where("coin = ? AND created_at >= ? AND created_at < ?", coin, from, to)
+	if value := c.QueryParam("degraded"); value != "" {
+		degraded, err := strconv.ParseBool(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "degraded must be true or false",
+			})
+		}
+		query = query.Where("degraded = ?", degraded)
+	}
+
+	prices := []models.IndexPrice{}
+	if err := query.Order("created_at DESC, id DESC").Limit(limit).Find(&prices).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch index prices",
+		})
+	}
+
+	return c.JSON(http.StatusOK, IndexHistoryResponse{
+		Coin:   coin,
+		From:   from,
+		To:     to,
+		Prices: prices,
+	})
+}
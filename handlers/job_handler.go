@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/workers"
+	"gorm.io/gorm"
+)
+
+// JOB_POLL_AFTER is the Retry-After, in seconds, suggested while a job runs
+const JOB_POLL_AFTER = 2
+
+type JobHandler struct {
+	db     *gorm.DB
+	runner *workers.JobRunner
+}
+
+func NewJobHandler(db *gorm.DB, runner *workers.JobRunner) *JobHandler {
+	return &JobHandler{
+		db:     db,
+		runner: runner,
+	}
+}
+
+// JobRequest starts a job of Kind with kind-specific Params
+type JobRequest struct {
+	Kind   string          `json:"kind"`
+	Params json.RawMessage `json:"params"`
+}
+
+// CreateJob queues an expensive computation and answers right away with the
+// job to poll
+// POST /api/jobs
+func (h *JobHandler) CreateJob(c echo.Context) error {
+	var req JobRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+	if len(req.Params) == 0 {
+		req.Params = json.RawMessage("{}")
+	}
+
+	params, err := h.runner.Validate(req.Kind, req.Params)
+	if errors.Is(err, workers.ErrUnknownJobKind) {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+			"kinds": h.runner.Kinds(),
+		})
+	}
+	if err != nil {
+		return badRequest(c, err)
+	}
+
+	job, err := h.runner.Submit(c.Request().Context(), req.Kind, params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to create job",
+		})
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, strings.TrimSuffix(c.Request().URL.Path, "/")+"/"+job.ID)
+	return c.JSON(http.StatusAccepted, job)
+}
+
+// GetJob returns a job's status, with its result once it succeeded. Finished
+// jobs are kept for a while and then answered 404
+// GET /api/jobs/:id
+func (h *JobHandler) GetJob(c echo.Context) error {
+	var job models.Job
+	err := h.db.WithContext(c.Request().Context()).Where("id = ?", c.Param("id")).Take(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "job not found or expired",
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch job",
+		})
+	}
+
+	// The status changes under the client, never let a cache answer for it
+	if !job.Finished() {
+		c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+		c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(JOB_POLL_AFTER))
+	}
+	return c.JSON(http.StatusOK, job)
+}
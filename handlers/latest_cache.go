@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+// LATEST_CACHE_TTL is how long a latest price lookup is served from memory
+const LATEST_CACHE_TTL = 5 * time.Second
+
+type latestEntry struct {
+	prices  []PriceResponse
+	expires time.Time
+}
+
+// latestCache keeps recent latest price lookups in process so dashboards
+// polling the same coin don't each hit the database
+type latestCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]latestEntry
+}
+
+func newLatestCache(ttl time.Duration) *latestCache {
+	return &latestCache{
+		ttl:     ttl,
+		entries: make(map[string]latestEntry),
+	}
+}
+
+func (lc *latestCache) get(key string) ([]PriceResponse, bool) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	entry, exists := lc.entries[key]
+	if !exists || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.prices, true
+}
+
+func (lc *latestCache) set(key string, prices []PriceResponse) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	now := time.Now()
+
+	// Drop expired entries so coins that are no longer requested don't linger
+	for k, entry := range lc.entries {
+		if now.After(entry.expires) {
+			delete(lc.entries, k)
+		}
+	}
+
+	lc.entries[key] = latestEntry{
+		prices:  prices,
+		expires: now.Add(lc.ttl),
+	}
+}
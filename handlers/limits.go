@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CONTEXT_LIMITS is the echo context key ApplyLimits stores the caps under
+const CONTEXT_LIMITS = "limits"
+
+// Limits are server-side caps on what a single request can ask for, so an
+// accidental "give me everything" query can't tie up the database. Requests
+// over a cap are answered 422 Unprocessable Entity
+type Limits struct {
+	// MaxRows caps the rows one response returns
+	MaxRows int
+	// MaxWindow caps the time range one query spans
+	MaxWindow time.Duration
+	// MaxCoins caps how many coins or symbols one batch request names
+	MaxCoins int
+	// MaxExportRows caps how many rows a paginated history can span in total
+	MaxExportRows int64
+}
+
+// DEFAULT_LIMITS apply to routes without ApplyLimits and to zero fields
+var DEFAULT_LIMITS = Limits{
+	MaxRows:       10000,
+	MaxWindow:     366 * 24 * time.Hour,
+	MaxCoins:      500,
+	MaxExportRows: 1000000,
+}
+
+// ApplyLimits makes handlers below it enforce limits, filling zero fields
+// from DEFAULT_LIMITS
+func ApplyLimits(limits Limits) echo.MiddlewareFunc {
+	if limits.MaxRows <= 0 {
+		limits.MaxRows = DEFAULT_LIMITS.MaxRows
+	}
+	if limits.MaxWindow <= 0 {
+		limits.MaxWindow = DEFAULT_LIMITS.MaxWindow
+	}
+	if limits.MaxCoins <= 0 {
+		limits.MaxCoins = DEFAULT_LIMITS.MaxCoins
+	}
+	if limits.MaxExportRows <= 0 {
+		limits.MaxExportRows = DEFAULT_LIMITS.MaxExportRows
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(CONTEXT_LIMITS, limits)
+			return next(c)
+		}
+	}
+}
+
+// limitsOf returns the caps that apply to the request
+func limitsOf(c echo.Context) Limits {
+	if limits, ok := c.Get(CONTEXT_LIMITS).(Limits); ok {
+		return limits
+	}
+	return DEFAULT_LIMITS
+}
+
+// LimitError reports a request that is well formed but over a server-side cap
+type LimitError struct {
+	msg string
+}
+
+func (e *LimitError) Error() string {
+	return e.msg
+}
+
+func limitErrorf(format string, args ...any) error {
+	return &LimitError{msg: fmt.Sprintf(format, args...)}
+}
+
+// badRequest answers with err, as 422 when it is a LimitError and 400 otherwise
+func badRequest(c echo.Context, err error) error {
+	status := http.StatusBadRequest
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		status = http.StatusUnprocessableEntity
+	}
+	return c.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
+
+// rowLimit reads the limit query parameter, fallback when missing. Both are
+// held to the MaxRows cap
+func rowLimit(c echo.Context, fallback int) (int, error) {
+	maxRows := limitsOf(c).MaxRows
+
+	value := c.QueryParam("limit")
+	if value == "" {
+		return min(fallback, maxRows), nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		return 0, errors.New("limit must be a positive integer")
+	}
+	if limit > maxRows {
+		return 0, limitErrorf("limit %d is over the maximum of %d rows per request", limit, maxRows)
+	}
+	return limit, nil
+}
+
+// timeWindow reads the from and to query parameters. to defaults to now and
+// from to span before it, shortened to the MaxWindow cap. An explicit range
+// must not exceed the cap
+func timeWindow(c echo.Context, span time.Duration) (from, to time.Time, err error) {
+	maxWindow := limitsOf(c).MaxWindow
+
+	to, err = timeParam(c, "to", time.Now())
+	if err != nil {
+		return from, to, err
+	}
+	from, err = timeParam(c, "from", to.Add(-min(span, maxWindow)))
+	if err != nil {
+		return from, to, err
+	}
+	if !from.Before(to) {
+		return from, to, errors.New("from must be before to")
+	}
+
+	if to.Sub(from) > maxWindow {
+		return from, to, limitErrorf("from/to span %s, over the maximum window of %s", to.Sub(from), maxWindow)
+	}
+	return from, to, nil
+}
+
+// checkRows fails when a query would return more than MaxRows rows, for
+// endpoints whose row count follows from the request rather than a limit
+func checkRows(c echo.Context, rows int64) error {
+	if maxRows := limitsOf(c).MaxRows; rows > int64(maxRows) {
+		return limitErrorf("request spans %d rows, over the maximum of %d, narrow from/to or use a larger interval", rows, maxRows)
+	}
+	return nil
+}
+
+// checkCoins fails when a batch request names more than MaxCoins coins
+func checkCoins(c echo.Context, coins int) error {
+	if maxCoins := limitsOf(c).MaxCoins; coins > maxCoins {
+		return limitErrorf("request names %d coins, over the maximum of %d per batch", coins, maxCoins)
+	}
+	return nil
+}
+
+// checkExport fails when a paginated history would span more than
+// MaxExportRows rows in total
+func checkExport(c echo.Context, rows int64) error {
+	if maxExport := limitsOf(c).MaxExportRows; rows > maxExport {
+		return limitErrorf("window holds %d rows, over the maximum export of %d, narrow from/to", rows, maxExport)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+)
+
+const DEFAULT_MARK_LIMIT = 500
+
+type MarkHandler struct {
+	db           *gorm.DB
+	thresholdBps float64
+}
+
+// NewMarkHandler serves stored mark and oracle prices, flagging those at
+// least thresholdBps apart as divergent
+func NewMarkHandler(db *gorm.DB, thresholdBps float64) *MarkHandler {
+	return &MarkHandler{
+		db:           db,
+		thresholdBps: thresholdBps,
+	}
+}
+
+type MarkResponse struct {
+	models.MarkPrice
+	Divergent bool `json:"divergent"`
+}
+
+type MarksResponse struct {
+	Coin         string         `json:"coin"`
+	From         time.Time      `json:"from"`
+	To           time.Time      `json:"to"`
+	ThresholdBps float64        `json:"threshold_bps"`
+	Marks        []MarkResponse `json:"marks"`
+}
+
+// GetMarkPrices returns stored mark and oracle prices of a coin, newest
+// first, with how far the mark was from the oracle. The window defaults to
+// the last 24 hours. divergent=true keeps only marks at least the threshold
+// away from the oracle, the stretches worth checking for oracle lag or a
+// pushed mark
+// GET /api/marks/:coin?from=&to=&limit=500&sources=&divergent=true
+func (h *MarkHandler) GetMarkPrices(c echo.Context) error {
+	coin := c.Param("coin")
+	if coin == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "coin symbol is required",
+		})
+	}
+
+	from, to, err := timeWindow(c, 24*time.Hour)
+	if err != nil {
+		return badRequest(c, err)
+	}
+
+	limit, err := rowLimit(c, DEFAULT_MARK_LIMIT)
+	if err != nil {
+		return badRequest(c, err)
+	}
+
+	query := h.db.WithContext(c.Request().Context()).
+		Where("coin = ? AND created_at >= ? AND created_at < ?", coin, from, to).
+		Scopes(scopeSources(sourcesFilter(c)))
+	if value := c.QueryParam("divergent"); value != "" {
+		divergent, err := strconv.ParseBool(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "divergent must be true or false",
+			})
+		}
+		if divergent {
+			query = query.Where("ABS(divergence_bps) >= ?", h.thresholdBps)
+		} else {
+			query = query.Where("ABS(divergence_bps) < ?", h.thresholdBps)
+		}
+	}
+
+	var stored []models.MarkPrice
+	if err := query.Order("created_at DESC, id DESC").Limit(limit).Find(&stored).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch mark prices",
+		})
+	}
+
+	marks := make([]MarkResponse, len(stored))
+	for i, mark := range stored {
+		marks[i] = MarkResponse{
+			MarkPrice: mark,
+			Divergent: math.Abs(mark.DivergenceBps) >= h.thresholdBps,
+		}
+	}
+
+	return c.JSON(http.StatusOK, MarksResponse{
+		Coin:         coin,
+		From:         from,
+		To:           to,
+		ThresholdBps: h.thresholdBps,
+		Marks:        marks,
+	})
+}
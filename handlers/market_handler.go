@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/services"
+	"gorm.io/gorm"
+)
+
+// MARKET_PRICE_DIGITS is how many significant digits a market's price
+// precision is inferred for, capped at MAX_MARKET_PRICE_DECIMALS decimals
+const (
+	MARKET_PRICE_DIGITS       = 6
+	MAX_MARKET_PRICE_DECIMALS = 8
+)
+
+// PriceLimits reports the plausible price range of a coin, the same bounds
+// the fetcher rejects prices outside of
+type PriceLimits interface {
+	Range(coin string) (minPrice, maxPrice float64, ok bool)
+}
+
+// MarketHandler lists every tracked instrument across sources
+type MarketHandler struct {
+	db       *gorm.DB
+	registry *services.Registry
+	coins    func() []string
+	limits   PriceLimits
+}
+
+// NewMarketHandler creates a handler listing the coins returned by coins on
+// every source in registry. limits may be nil
+func NewMarketHandler(db *gorm.DB, registry *services.Registry, coins func() []string, limits PriceLimits) *MarketHandler {
+	return &MarketHandler{
+		db:       db,
+		registry: registry,
+		coins:    coins,
+		limits:   limits,
+	}
+}
+
+// CCXTMarket is the CCXT unified market structure. Fields dexlite can't know,
+// like fees and amount limits, are always null
+type CCXTMarket struct {
+	ID       string  `json:"id"`
+	Exchange string  `json:"exchange"`
+	Symbol   string  `json:"symbol"`
+	Base     string  `json:"base"`
+	Quote    string  `json:"quote"`
+	Settle   *string `json:"settle"`
+	BaseID   string  `json:"baseId"`
+	QuoteID  string  `json:"quoteId"`
+	Type     string  `json:"type"`
+	Spot     bool    `json:"spot"`
+	Swap     bool    `json:"swap"`
+	Contract bool    `json:"contract"`
+	Linear   *bool   `json:"linear"`
+	Inverse  *bool   `json:"inverse"`
+	// ContractSize is what one contract is worth, see services.Instrument
+	ContractSize *float64        `json:"contractSize"`
+	Active       bool            `json:"active"`
+	Taker        *float64        `json:"taker"`
+	Maker        *float64        `json:"maker"`
+	Precision    MarketPrecision `json:"precision"`
+	Limits       MarketLimits    `json:"limits"`
+	Info         MarketInfo      `json:"info"`
+}
+
+// MarketPrecision holds decimal places. Price precision is inferred from the
+// latest stored price, null when there is none yet
+type MarketPrecision struct {
+	Price  *int `json:"price"`
+	Amount *int `json:"amount"`
+}
+
+// MarketRange is a min/max pair, null where unbounded or unknown
+type MarketRange struct {
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+}
+
+// MarketLimits are the price sanity bounds of a coin
+type MarketLimits struct {
+	Price  MarketRange `json:"price"`
+	Amount MarketRange `json:"amount"`
+	Cost   MarketRange `json:"cost"`
+}
+
+// MarketInfo carries what dexlite itself knows about the market
+type MarketInfo struct {
+	// ContractType is linear, inverse or quanto for contracts. CCXT marks
+	// quanto contracts as neither linear nor inverse
+	ContractType string `json:"contract_type,omitempty"`
+	// Builder is the dex that deployed the market, e.g. a Hyperliquid HIP-3
+	// dex, and PreLaunch is set while the market has no order book yet
+	Builder   string     `json:"builder,omitempty"`
+	PreLaunch bool       `json:"pre_launch"`
+	LastPrice *float64   `json:"last_price"`
+	LastAt    *time.Time `json:"last_at"`
+	Primary   bool       `json:"primary"`
+	Fallback  bool       `json:"fallback"`
+}
+
+// GetMarkets lists every tracked coin on every source as a CCXT unified
+// market, so bot frameworks can configure themselves against dexlite. A
+// market is active once it has a stored price. pre_launch=true keeps markets
+// listed before they trade
+// GET /api/markets?exchange=binance&type=spot&pre_launch=
+func (h *MarketHandler) GetMarkets(c echo.Context) error {
+	coins := scopedCoins(c, h.coins())
+	exchange := c.QueryParam("exchange")
+	instrumentType := c.QueryParam("type")
+	preLaunch := c.QueryParam("pre_launch") == "true"
+
+	var latest []models.CoinPrice
+	if len(coins) > 0 {
+		query := h.db.WithContext(c.Request().Context()).Model(&models.CoinPrice{}).Where("coin IN ?", coins)
+		err := db.LatestPer(query, "coin", "exchange").Find(&latest).Error
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to fetch latest prices",
+			})
+		}
+	}
+
+	prices := make(map[string]models.CoinPrice, len(latest))
+	for _, price := range latest {
+		prices[price.Coin+"/"+price.Exchange] = price
+	}
+
+	sources := h.registry.Sources()
+	primary, fallback := h.registry.Primary(), h.registry.Fallback()
+	if fallback != nil {
+		sources = append(sources, fallback)
+	}
+
+	markets := make([]CCXTMarket, 0, len(sources)*len(coins))
+	for _, source := range sources {
+		if exchange != "" && source.Name() != exchange {
+			continue
+		}
+		instrument := instrumentOf(source)
+		if instrumentType != "" && instrument.Type != instrumentType {
+			continue
+		}
+
+		for _, coin := range coins {
+			instrument := marketInstrumentOf(source, coin)
+			if preLaunch && !instrument.PreLaunch {
+				continue
+			}
+			market := h.market(coin, source.Name(), instrument)
+			market.Info.Primary = source == primary
+			market.Info.Fallback = source == fallback
+
+			if price, exists := prices[coin+"/"+source.Name()]; exists {
+				market.Active = true
+				market.Info.LastPrice = &price.Price
+				market.Info.LastAt = &price.CreatedAt
+				decimals := priceDecimals(price.Price)
+				market.Precision.Price = &decimals
+			}
+			markets = append(markets, market)
+		}
+	}
+
+	sort.SliceStable(markets, func(i, j int) bool {
+		if markets[i].Symbol != markets[j].Symbol {
+			return markets[i].Symbol < markets[j].Symbol
+		}
+		return markets[i].Exchange < markets[j].Exchange
+	})
+
+	return c.JSON(http.StatusOK, markets)
+}
+
+// market builds the static part of coin's market on exchange
+func (h *MarketHandler) market(coin, exchange string, instrument services.Instrument) CCXTMarket {
+	market := CCXTMarket{
+		ID:       coin + "-" + instrument.Quote,
+		Exchange: exchange,
+		Symbol:   coin + "/" + instrument.Quote,
+		Base:     coin,
+		Quote:    instrument.Quote,
+		BaseID:   coin,
+		QuoteID:  instrument.Quote,
+		Type:     instrument.Type,
+		Spot:     instrument.Type == services.INSTRUMENT_SPOT,
+		Swap:     instrument.Type == services.INSTRUMENT_SWAP,
+	}
+	market.Info.Builder = instrument.Builder
+	market.Info.PreLaunch = instrument.PreLaunch
+
+	if market.Swap {
+		settle := instrument.SettleAsset(coin)
+		size := instrument.ContractSize
+		if size == 0 {
+			size = 1
+		}
+		linear := instrument.Contract == services.CONTRACT_LINEAR || instrument.Contract == ""
+		inverse := instrument.Contract == services.CONTRACT_INVERSE
+
+		market.Symbol += ":" + settle
+		market.Settle = &settle
+		market.Contract = true
+		market.Linear = &linear
+		market.Inverse = &inverse
+		market.ContractSize = &size
+		market.Info.ContractType = instrument.Contract
+	}
+
+	if h.limits != nil {
+		if minPrice, maxPrice, ok := h.limits.Range(coin); ok {
+			market.Limits.Price = MarketRange{Min: &minPrice, Max: &maxPrice}
+		}
+	}
+
+	return market
+}
+
+// instrumentOf returns what source quotes, treating sources that don't say as
+// USD spot markets
+func instrumentOf(source services.PriceSource) services.Instrument {
+	if instrumented, ok := source.(services.InstrumentSource); ok {
+		return instrumented.Instrument()
+	}
+	return services.Instrument{Type: services.INSTRUMENT_SPOT, Quote: "USD"}
+}
+
+// marketInstrumentOf returns what source quotes for coin's market
+func marketInstrumentOf(source services.PriceSource, coin string) services.Instrument {
+	if instrumented, ok := source.(services.MarketInstrumentSource); ok {
+		return instrumented.MarketInstrument(coin)
+	}
+	return instrumentOf(source)
+}
+
+// priceDecimals infers how many decimals price is quoted to, keeping
+// MARKET_PRICE_DIGITS significant digits
+func priceDecimals(price float64) int {
+	if price <= 0 {
+		return MAX_MARKET_PRICE_DECIMALS
+	}
+	decimals := MARKET_PRICE_DIGITS - 1 - int(math.Floor(math.Log10(price)))
+	return max(0, min(decimals, MAX_MARKET_PRICE_DECIMALS))
+}
+
+// PositionResponse values a position in one market. Values and PnL are in
+// the settle asset, PnLQuote converts PnL to the quote at the exit price and
+// is null for quanto contracts, whose settle asset dexlite doesn't price
+type PositionResponse struct {
+	Exchange     string     `json:"exchange"`
+	Symbol       string     `json:"symbol"`
+	ContractType string     `json:"contract_type,omitempty"`
+	ContractSize float64    `json:"contract_size"`
+	Settle       string     `json:"settle"`
+	Contracts    float64    `json:"contracts"`
+	Entry        float64    `json:"entry"`
+	Exit         float64    `json:"exit"`
+	ExitAt       *time.Time `json:"exit_at,omitempty"`
+	EntryValue   float64    `json:"entry_value"`
+	ExitValue    float64    `json:"exit_value"`
+	PnL          float64    `json:"pnl"`
+	PnLQuote     *float64   `json:"pnl_quote"`
+	// ReturnPct is PnL relative to the entry value
+	ReturnPct float64 `json:"return_pct"`
+}
+
+// GetPosition values a position of contracts contracts, negative for shorts,
+// opened at entry, using the contract type of the market so inverse and
+// quanto perpetuals come out right. exit defaults to the latest stored price
+// GET /api/markets/:exchange/:coin/position?contracts=1&entry=60000&exit=
+func (h *MarketHandler) GetPosition(c echo.Context) error {
+	coin := c.Param("coin")
+	exchange := c.Param("exchange")
+
+	source, ok := h.registry.Get(exchange)
+	if fallback := h.registry.Fallback(); !ok && fallback != nil && fallback.Name() == exchange {
+		source, ok = fallback, true
+	}
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "unknown exchange",
+		})
+	}
+	instrument := marketInstrumentOf(source, coin)
+	market := h.market(coin, exchange, instrument)
+
+	contracts, err := strconv.ParseFloat(c.QueryParam("contracts"), 64)
+	if err != nil || contracts == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "contracts must be a non-zero number, negative for shorts",
+		})
+	}
+	entry, err := strconv.ParseFloat(c.QueryParam("entry"), 64)
+	if err != nil || entry <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "entry must be a positive price",
+		})
+	}
+
+	position := PositionResponse{
+		Exchange:     exchange,
+		Symbol:       market.Symbol,
+		ContractType: instrument.Contract,
+		ContractSize: 1,
+		Settle:       instrument.SettleAsset(coin),
+		Contracts:    contracts,
+		Entry:        entry,
+	}
+	if market.ContractSize != nil {
+		position.ContractSize = *market.ContractSize
+	}
+	if position.Settle == "" {
+		position.Settle = instrument.Quote
+	}
+
+	if value := c.QueryParam("exit"); value != "" {
+		position.Exit, err = strconv.ParseFloat(value, 64)
+		if err != nil || position.Exit <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "exit must be a positive price",
+			})
+		}
+	} else {
+		var latest models.CoinPrice
+		err := h.db.WithContext(c.Request().Context()).
+			Where("coin = ? AND exchange = ?", coin, exchange).
+			Order("created_at DESC").
+			Take(&latest).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": "no price for this market, pass exit",
+			})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to fetch latest price",
+			})
+		}
+		position.Exit = latest.Price
+		position.ExitAt = &latest.CreatedAt
+	}
+
+	position.EntryValue = instrument.Value(contracts, entry)
+	position.ExitValue = instrument.Value(contracts, position.Exit)
+	position.PnL = instrument.PnL(contracts, entry, position.Exit)
+	if position.EntryValue != 0 {
+		position.ReturnPct = position.PnL / math.Abs(position.EntryValue) * 100
+	}
+
+	switch instrument.Contract {
+	case services.CONTRACT_QUANTO:
+		// Settled in an asset dexlite doesn't price
+	case services.CONTRACT_INVERSE:
+		pnl := position.PnL * position.Exit
+		position.PnLQuote = &pnl
+	default:
+		pnl := position.PnL
+		position.PnLQuote = &pnl
+	}
+
+	return c.JSON(http.StatusOK, position)
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TELEGRAM_LINK_TTL is how long a Telegram link code can be sent to the bot
+const TELEGRAM_LINK_TTL = 15 * time.Minute
+
+// NotificationHandler manages how the signed in user is notified of price
+// alerts on their watchlist
+type NotificationHandler struct {
+	db *gorm.DB
+	// email and telegram tell whether the server has a mail server and a
+	// Telegram bot to notify users with
+	email    bool
+	telegram bool
+	// botUsername makes link codes come with a t.me link, empty when unknown
+	botUsername string
+}
+
+func NewNotificationHandler(db *gorm.DB, email, telegram bool, botUsername string) *NotificationHandler {
+	return &NotificationHandler{
+		db:          db,
+		email:       email,
+		telegram:    telegram,
+		botUsername: botUsername,
+	}
+}
+
+// NotificationRequest replaces the user's preferences. Omitted severity and
+// timezone default to info and UTC. Email needs the account's address
+// confirmed, a Telegram chat is linked through the bot instead
+type NotificationRequest struct {
+	Email       bool   `json:"email"`
+	MinSeverity string `json:"min_severity"`
+	QuietStart  string `json:"quiet_start"`
+	QuietEnd    string `json:"quiet_end"`
+	Timezone    string `json:"timezone"`
+}
+
+// TelegramLinkResponse is a code to send the bot as Command from the chat
+// alerts should go to, Link opens the bot with it when the bot is known
+type TelegramLinkResponse struct {
+	Code      string    `json:"code"`
+	Command   string    `json:"command"`
+	Link      string    `json:"link,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// GetNotifications returns the user's notification preferences, the defaults
+// while none are saved, which notify of nothing
+// GET /api/me/notifications
+func (h *NotificationHandler) GetNotifications(c echo.Context) error {
+	preference := models.NotificationPreference{
+		UserID:      userOf(c),
+		MinSeverity: models.SEVERITY_INFO,
+		Timezone:    "UTC",
+	}
+	err := h.db.WithContext(c.Request().Context()).Where("user_id = ?", preference.UserID).Take(&preference).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch notification preferences",
+		})
+	}
+
+	return c.JSON(http.StatusOK, preference)
+}
+
+// UpdateNotifications replaces the user's notification preferences
+// PUT /api/me/notifications
+func (h *NotificationHandler) UpdateNotifications(c echo.Context) error {
+	var req NotificationRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	preference := models.NotificationPreference{
+		UserID:      userOf(c),
+		Email:       req.Email,
+		MinSeverity: req.MinSeverity,
+		QuietStart:  req.QuietStart,
+		QuietEnd:    req.QuietEnd,
+		Timezone:    req.Timezone,
+	}
+	if preference.MinSeverity == "" {
+		preference.MinSeverity = models.SEVERITY_INFO
+	}
+	if preference.Timezone == "" {
+		preference.Timezone = "UTC"
+	}
+	if err := preference.Validate(); err != nil {
+		return badRequest(c, err)
+	}
+	if preference.Email && !h.email {
+		return badRequest(c, errors.New("email notifications need a mail server configured"))
+	}
+
+	ctx := c.Request().Context()
+	if preference.Email {
+		var user models.User
+		if err := h.db.WithContext(ctx).Take(&user, preference.UserID).Error; err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to fetch user",
+			})
+		}
+		if user.EmailConfirmedAt == nil {
+			return badRequest(c, errors.New("confirm your email address before turning on email notifications"))
+		}
+	}
+
+	// The linked Telegram chat is kept
+	err := h.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"email", "min_severity", "quiet_start", "quiet_end", "timezone", "updated_at"}),
+	}).Create(&preference).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to save notification preferences",
+		})
+	}
+
+	return h.GetNotifications(c)
+}
+
+// LinkTelegram returns a code for the user to send the bot from the chat
+// their alerts should go to. A new code replaces the pending one, the linked
+// chat stays until the bot gets the code
+// POST /api/me/telegram
+func (h *NotificationHandler) LinkTelegram(c echo.Context) error {
+	if !h.telegram {
+		return badRequest(c, errors.New("telegram notifications need a bot configured"))
+	}
+
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to create link code",
+		})
+	}
+	code := base64.RawURLEncoding.EncodeToString(secret)
+	expiresAt := time.Now().Add(TELEGRAM_LINK_TTL)
+
+	preference := models.NotificationPreference{
+		UserID:                userOf(c),
+		MinSeverity:           models.SEVERITY_INFO,
+		Timezone:              "UTC",
+		TelegramLinkCode:      models.TelegramLinkHash(code),
+		TelegramLinkExpiresAt: &expiresAt,
+	}
+	err := h.db.WithContext(c.Request().Context()).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"telegram_link_code", "telegram_link_expires_at", "updated_at"}),
+	}).Create(&preference).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to save link code",
+		})
+	}
+
+	response := TelegramLinkResponse{
+		Code:      code,
+		Command:   "/start " + code,
+		ExpiresAt: expiresAt,
+	}
+	if h.botUsername != "" {
+		response.Link = "https://t.me/" + h.botUsername + "?start=" + code
+	}
+	return c.JSON(http.StatusCreated, response)
+}
+
+// UnlinkTelegram stops sending the user's alerts to Telegram
+// DELETE /api/me/telegram
+func (h *NotificationHandler) UnlinkTelegram(c echo.Context) error {
+	err := h.db.WithContext(c.Request().Context()).Model(&models.NotificationPreference{}).
+		Where("user_id = ?", userOf(c)).
+		Updates(map[string]interface{}{
+			"telegram_chat_id":         "",
+			"telegram_link_code":       "",
+			"telegram_link_expires_at": nil,
+		}).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to unlink telegram",
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+)
+
+const (
+	DEFAULT_DEPTH_LIMIT = 500
+	DEFAULT_DEPTH_PCT   = 1.0
+	MAX_DEPTH_PCT       = 50.0
+)
+
+type OrderbookHandler struct {
+	db *gorm.DB
+}
+
+func NewOrderbookHandler(db *gorm.DB) *OrderbookHandler {
+	return &OrderbookHandler{
+		db: db,
+	}
+}
+
+type OrderbookResponse struct {
+	Coin      string                     `json:"coin"`
+	Exchanges []models.OrderbookSnapshot `json:"exchanges"`
+}
+
+// DepthPoint is the liquidity of one snapshot within the requested band, as
+// quote notional
+type DepthPoint struct {
+	Time      time.Time `json:"time"`
+	Mid       float64   `json:"mid"`
+	SpreadBps float64   `json:"spread_bps"`
+	BidDepth  float64   `json:"bid_depth"`
+	AskDepth  float64   `json:"ask_depth"`
+	Depth     float64   `json:"depth"`
+}
+
+// ExchangeDepth holds one venue's depth series, newest first
+type ExchangeDepth struct {
+	Exchange string       `json:"exchange"`
+	Points   []DepthPoint `json:"points"`
+}
+
+type DepthResponse struct {
+	Coin      string          `json:"coin"`
+	Pct       float64         `json:"pct"`
+	From      time.Time       `json:"from"`
+	To        time.Time       `json:"to"`
+	Exchanges []ExchangeDepth `json:"exchanges"`
+}
+
+// GetOrderbook returns the newest stored orderbook snapshot of a coin on each
+// venue
+// GET /api/orderbook/:coin?sources=
+func (h *OrderbookHandler) GetOrderbook(c echo.Context) error {
+	coin := c.Param("coin")
+	if coin == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "coin symbol is required",
+		})
+	}
+
+	snapshots := []models.OrderbookSnapshot{}
+	query := h.db.WithContext(c.Request().Context()).Model(&models.OrderbookSnapshot{}).
+		Where("coin = ?", coin).
+		Scopes(scopeSources(sourcesFilter(c)))
+	err := db.LatestPer(query, "exchange").Find(&snapshots).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch orderbook",
+		})
+	}
+	if len(snapshots) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "no orderbook for this coin",
+		})
+	}
+
+	return c.JSON(http.StatusOK, OrderbookResponse{
+		Coin:      coin,
+		Exchanges: snapshots,
+	})
+}
+
+// GetOrderbookDepth returns how much liquidity rested within pct percent of
+// the mid over time, per venue and side. The window defaults to the last 24
+// hours
+// GET /api/orderbook/:coin/depth?pct=1&from=&to=&limit=500&sources=
+func (h *OrderbookHandler) GetOrderbookDepth(c echo.Context) error {
+	coin := c.Param("coin")
+	if coin == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "coin symbol is required",
+		})
+	}
+
+	pct := DEFAULT_DEPTH_PCT
+	if value := c.QueryParam("pct"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 || parsed > MAX_DEPTH_PCT {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "pct must be a number above 0 and at most 50",
+			})
+		}
+		pct = parsed
+	}
+
+	from, to, err := timeWindow(c, 24*time.Hour)
+	if err != nil {
+		return badRequest(c, err)
+	}
+
+	limit, err := rowLimit(c, DEFAULT_DEPTH_LIMIT)
+	if err != nil {
+		return badRequest(c, err)
+	}
+
+	var snapshots []models.OrderbookSnapshot
+	err = h.db.WithContext(c.Request().Context()).Where("coin = ? AND created_at >= ? AND created_at < ?", coin, from, to).
+		Scopes(scopeSources(sourcesFilter(c))).
+		Order("exchange ASC, created_at DESC, id DESC").
+		Limit(limit).
+		Find(&snapshots).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch orderbook snapshots",
+		})
+	}
+
+	// Rows arrive ordered by exchange so each venue forms a contiguous run
+	exchanges := []ExchangeDepth{}
+	for _, snapshot := range snapshots {
+		if len(exchanges) == 0 || exchanges[len(exchanges)-1].Exchange != snapshot.Exchange {
+			exchanges = append(exchanges, ExchangeDepth{
+				Exchange: snapshot.Exchange,
+				Points:   []DepthPoint{},
+			})
+		}
+
+		bid, ask := snapshot.Depth(pct)
+		group := &exchanges[len(exchanges)-1]
+		group.Points = append(group.Points, DepthPoint{
+			Time:      snapshot.CreatedAt,
+			Mid:       snapshot.Mid,
+			SpreadBps: snapshot.SpreadBps(),
+			BidDepth:  bid,
+			AskDepth:  ask,
+			Depth:     bid + ask,
+		})
+	}
+
+	return c.JSON(http.StatusOK, DepthResponse{
+		Coin:      coin,
+		Pct:       pct,
+		From:      from,
+		To:        to,
+		Exchanges: exchanges,
+	})
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+)
+
+const (
+	DEFAULT_POLL_TIMEOUT = 30 * time.Second
+	MAX_POLL_TIMEOUT     = 60 * time.Second
+
+	// POLL_BATCH_LIMIT caps how many ticks one poll response carries
+	POLL_BATCH_LIMIT = 500
+
+	// POLL_SETTLE is how old a write must be before polls return it. Row IDs
+	// and write times are taken before a transaction commits, so a younger
+	// write may still be followed by an older one becoming visible
+	POLL_SETTLE = 2 * time.Second
+
+	// POLL_RECHECK is how often a waiting poll queries again. Changed only
+	// signals writes made by this process, this catches those of the others
+	POLL_RECHECK = POLL_SETTLE
+)
+
+// PollPrice is a stored tick with its sequence number, the price row ID. A
+// price replaced in its bucket comes again with the same seq
+type PollPrice struct {
+	Seq uint `json:"seq"`
+	PriceResponse
+}
+
+// PollResponse carries the ticks written after cursor. Cursor is the value to
+// send on the next poll and stays unchanged when the poll timed out. Seq is
+// the last tick's seq, accepted as since_seq by clients that predate cursor
+type PollResponse struct {
+	Coin   string      `json:"coin"`
+	Seq    uint        `json:"seq"`
+	Cursor string      `json:"cursor"`
+	Prices []PollPrice `json:"prices"`
+}
+
+// pollCursor is the position of a poll in the order ticks are written
+type pollCursor struct {
+	writtenAt time.Time
+	id        uint
+}
+
+func (p pollCursor) String() string {
+	// Before the first tick the cursor starts at the epoch
+	var nanos int64
+	if !p.writtenAt.IsZero() {
+		nanos = p.writtenAt.UnixNano()
+	}
+	return fmt.Sprintf("%d.%d", nanos, p.id)
+}
+
+func parsePollCursor(value string) (pollCursor, error) {
+	writtenAt, id, ok := strings.Cut(value, ".")
+	if !ok {
+		return pollCursor{}, errors.New("invalid cursor")
+	}
+	nanos, err := strconv.ParseInt(writtenAt, 10, 64)
+	if err != nil {
+		return pollCursor{}, errors.New("invalid cursor")
+	}
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return pollCursor{}, errors.New("invalid cursor")
+	}
+	return pollCursor{writtenAt: time.Unix(0, nanos), id: uint(seq)}, nil
+}
+
+// after narrows a query to ticks written after the cursor, in write order
+func (p pollCursor) after(db *gorm.DB) *gorm.DB {
+	return db.Where("updated_at > ? OR (updated_at = ? AND id > ?)", p.writtenAt, p.writtenAt, p.id).
+		Order("updated_at ASC, id ASC")
+}
+
+// PollPrices holds the request until a tick is written after cursor or the
+// timeout passes, for clients that can't use WebSockets or SSE. Ticks come in
+// the order they were written, replaced ones again, once POLL_SETTLE old.
+// Writes by this process wake the poll at once, those of other processes
+// within POLL_RECHECK.
+// Without cursor or since_seq it answers immediately with the cursor to start
+// from
+// GET /api/prices/:coin/poll?cursor=C&timeout=30s&sources=&region=nearest
+func (h *PriceHandler) PollPrices(c echo.Context) error {
+	coin := c.Param("coin")
+	if coin == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "coin symbol is required",
+		})
+	}
+
+	timeout := DEFAULT_POLL_TIMEOUT
+	if value := c.QueryParam("timeout"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 || parsed > MAX_POLL_TIMEOUT {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "timeout must be a duration up to 60s, e.g. 30s",
+			})
+		}
+		timeout = parsed
+	}
+
+	sources := sourcesFilter(c)
+	region := scopeRegion(c.QueryParam("region"), h.engineRegions)
+	query := func() *gorm.DB {
+		return h.db.WithContext(c.Request().Context()).Model(&models.CoinPrice{}).
+			Where("coin = ?", coin).
+			Scopes(scopeSources(sources), region)
+	}
+
+	// Poll responses are live data, never let a cache answer them
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+
+	var cursor pollCursor
+	switch {
+	case c.QueryParam("cursor") != "":
+		parsed, err := parsePollCursor(c.QueryParam("cursor"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "cursor must be the cursor of a previous poll",
+			})
+		}
+		cursor = parsed
+	case c.QueryParam("since_seq") != "":
+		sinceSeq, err := strconv.ParseUint(c.QueryParam("since_seq"), 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "since_seq must be a non-negative integer",
+			})
+		}
+		// The tick itself, or the last one before it when it expired, was
+		// the last one delivered
+		var last models.CoinPrice
+		err = h.db.WithContext(c.Request().Context()).Unscoped().
+			Where("coin = ? AND id <= ?", coin, sinceSeq).
+			Order("id DESC").
+			Limit(1).
+			Find(&last).Error
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to fetch sequence",
+			})
+		}
+		cursor = pollCursor{writtenAt: last.UpdatedAt, id: uint(sinceSeq)}
+	default:
+		var last models.CoinPrice
+		err := query().Where("updated_at <= ?", time.Now().Add(-POLL_SETTLE)).
+			Order("updated_at DESC, id DESC").
+			Limit(1).
+			Find(&last).Error
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to fetch sequence",
+			})
+		}
+		cursor = pollCursor{writtenAt: last.UpdatedAt, id: last.ID}
+		return c.JSON(http.StatusOK, PollResponse{Coin: coin, Seq: last.ID, Cursor: cursor.String(), Prices: []PollPrice{}})
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	recheck := time.NewTicker(POLL_RECHECK)
+	defer recheck.Stop()
+
+	for {
+		// Take the signal before querying so a write in between still wakes us
+		changed := h.persister.Changed()
+
+		var rows []models.CoinPrice
+		err := query().Scopes(cursor.after).
+			Limit(POLL_BATCH_LIMIT).
+			Find(&rows).Error
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to fetch prices",
+			})
+		}
+
+		// Only settled ticks are returned, the first unsettled one holds the
+		// rest back until it settles
+		settled := time.Now().Add(-POLL_SETTLE)
+		var prices []PollPrice
+		var settling <-chan time.Time
+		for _, price := range rows {
+			if price.UpdatedAt.After(settled) {
+				settling = time.After(price.UpdatedAt.Sub(settled))
+				break
+			}
+			prices = append(prices, PollPrice{
+				Seq:           price.ID,
+				PriceResponse: newPriceResponse(price),
+			})
+			cursor = pollCursor{writtenAt: price.UpdatedAt, id: price.ID}
+		}
+		if len(prices) > 0 {
+			return c.JSON(http.StatusOK, PollResponse{Coin: coin, Seq: cursor.id, Cursor: cursor.String(), Prices: prices})
+		}
+
+		select {
+		case <-changed:
+		case <-settling:
+		case <-recheck.C:
+		case <-timer.C:
+			return c.JSON(http.StatusOK, PollResponse{Coin: coin, Seq: cursor.id, Cursor: cursor.String(), Prices: []PollPrice{}})
+		case <-c.Request().Context().Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB opens a migrated in-memory SQLite database of the test's own, shared
+// by its connections like the memory driver's
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	dsn := fmt.Sprintf("file:/%s_%d?vfs=memdb&_pragma=busy_timeout(5000)&_txlock=immediate", name, time.Now().UnixNano())
+	database, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := db.Migrate(database); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return database
+}
+
+// poll runs PollPrices for coin with query and decodes its response
+func poll(t *testing.T, handler *PriceHandler, coin string, query url.Values) (int, PollResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/prices/"+coin+"/poll?"+query.Encode(), nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("coin")
+	c.SetParamValues(coin)
+
+	if err := handler.PollPrices(c); err != nil {
+		t.Fatalf("PollPrices: %v", err)
+	}
+	var response PollResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+	}
+	return rec.Code, response
+}
+
+// pollSeqs returns the seqs of prices
+func pollSeqs(prices []PollPrice) []uint {
+	out := make([]uint, len(prices))
+	for i, price := range prices {
+		out[i] = price.Seq
+	}
+	return out
+}
+
+func equalPollSeqs(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPollCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor pollCursor
+		want   string
+	}{
+		{name: "zero", cursor: pollCursor{}, want: "0.0"},
+		{name: "epoch", cursor: pollCursor{writtenAt: time.Unix(0, 0)}, want: "0.0"},
+		{name: "nanoseconds", cursor: pollCursor{writtenAt: time.Unix(1767225600, 123456789), id: 42}, want: "1767225600123456789.42"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cursor.String(); got != tt.want {
+				t.Fatalf("String() = %q, want %q", got, tt.want)
+			}
+			parsed, err := parsePollCursor(tt.want)
+			if err != nil {
+				t.Fatalf("parsePollCursor(%q): %v", tt.want, err)
+			}
+			if parsed.String() != tt.want || parsed.id != tt.cursor.id {
+				t.Fatalf("parsePollCursor(%q) = %v, want %v", tt.want, parsed, tt.cursor)
+			}
+		})
+	}
+
+	for _, value := range []string{"", "42", "x.1", "1.x", "1.-1", "1.2.3", ".1", "1."} {
+		t.Run("invalid "+value, func(t *testing.T) {
+			if _, err := parsePollCursor(value); err == nil {
+				t.Fatalf("parsePollCursor(%q) succeeded", value)
+			}
+		})
+	}
+}
+
+// pollRows stores BTC ticks written a minute ago, the first two at the same
+// time, an ETH tick and one BTC tick not yet settled, and returns them
+func pollRows(t *testing.T, database *gorm.DB) []models.CoinPrice {
+	t.Helper()
+
+	writtenAt := time.Now().Add(-time.Minute).UTC()
+	bucket := writtenAt.Truncate(time.Minute)
+	rows := []models.CoinPrice{
+		{Coin: "BTC", Exchange: "binance", Price: 100, Bucket: bucket, UpdatedAt: writtenAt},
+		{Coin: "BTC", Exchange: "coinbase", Price: 101, Bucket: bucket, UpdatedAt: writtenAt},
+		{Coin: "BTC", Exchange: "binance", Price: 102, Bucket: bucket.Add(time.Minute), UpdatedAt: writtenAt.Add(time.Second)},
+		{Coin: "ETH", Exchange: "binance", Price: 10, Bucket: bucket, UpdatedAt: writtenAt.Add(2 * time.Second)},
+		{Coin: "BTC", Exchange: "binance", Price: 103, Bucket: bucket.Add(2 * time.Minute), UpdatedAt: time.Now().UTC()},
+	}
+	for i := range rows {
+		rows[i].CreatedAt = rows[i].UpdatedAt
+	}
+	if err := database.Create(&rows).Error; err != nil {
+		t.Fatalf("storing prices: %v", err)
+	}
+	return rows
+}
+
+func TestPollPrices(t *testing.T) {
+	cursorAt := func(price models.CoinPrice) string {
+		return pollCursor{writtenAt: price.UpdatedAt, id: price.ID}.String()
+	}
+
+	tests := []struct {
+		name string
+		// query builds the request's query from the stored rows
+		query    func(rows []models.CoinPrice) url.Values
+		wantCode int
+		// want picks the rows expected, in order, and the cursor after them
+		want       func(rows []models.CoinPrice) []models.CoinPrice
+		wantCursor func(rows []models.CoinPrice) string
+	}{
+		{
+			name:     "without a cursor",
+			query:    func(rows []models.CoinPrice) url.Values { return url.Values{} },
+			wantCode: http.StatusOK,
+			want:     func(rows []models.CoinPrice) []models.CoinPrice { return nil },
+			// The last settled tick, not the one still settling
+			wantCursor: func(rows []models.CoinPrice) string { return cursorAt(rows[2]) },
+		},
+		{
+			name: "from the start",
+			query: func(rows []models.CoinPrice) url.Values {
+				return url.Values{"cursor": {"0.0"}}
+			},
+			wantCode: http.StatusOK,
+			// Ties on write time come in ID order, the unsettled tick is
+			// held back
+			want: func(rows []models.CoinPrice) []models.CoinPrice {
+				return []models.CoinPrice{rows[0], rows[1], rows[2]}
+			},
+			wantCursor: func(rows []models.CoinPrice) string { return cursorAt(rows[2]) },
+		},
+		{
+			name: "within a tie",
+			query: func(rows []models.CoinPrice) url.Values {
+				return url.Values{"cursor": {cursorAt(rows[0])}}
+			},
+			wantCode: http.StatusOK,
+			want: func(rows []models.CoinPrice) []models.CoinPrice {
+				return []models.CoinPrice{rows[1], rows[2]}
+			},
+			wantCursor: func(rows []models.CoinPrice) string { return cursorAt(rows[2]) },
+		},
+		{
+			name: "since_seq",
+			query: func(rows []models.CoinPrice) url.Values {
+				return url.Values{"since_seq": {fmt.Sprint(rows[1].ID)}}
+			},
+			wantCode: http.StatusOK,
+			want: func(rows []models.CoinPrice) []models.CoinPrice {
+				return []models.CoinPrice{rows[2]}
+			},
+			wantCursor: func(rows []models.CoinPrice) string { return cursorAt(rows[2]) },
+		},
+		{
+			name: "times out unchanged",
+			query: func(rows []models.CoinPrice) url.Values {
+				return url.Values{"cursor": {cursorAt(rows[2])}, "timeout": {"100ms"}}
+			},
+			wantCode:   http.StatusOK,
+			want:       func(rows []models.CoinPrice) []models.CoinPrice { return nil },
+			wantCursor: func(rows []models.CoinPrice) string { return cursorAt(rows[2]) },
+		},
+		{
+			name: "waits for a tick to settle",
+			query: func(rows []models.CoinPrice) url.Values {
+				return url.Values{"cursor": {cursorAt(rows[2])}, "timeout": {"10s"}}
+			},
+			wantCode: http.StatusOK,
+			want: func(rows []models.CoinPrice) []models.CoinPrice {
+				return []models.CoinPrice{rows[4]}
+			},
+			wantCursor: func(rows []models.CoinPrice) string { return cursorAt(rows[4]) },
+		},
+		{
+			name: "other sources",
+			query: func(rows []models.CoinPrice) url.Values {
+				return url.Values{"cursor": {"0.0"}, "sources": {"coinbase"}}
+			},
+			wantCode: http.StatusOK,
+			want: func(rows []models.CoinPrice) []models.CoinPrice {
+				return []models.CoinPrice{rows[1]}
+			},
+			wantCursor: func(rows []models.CoinPrice) string { return cursorAt(rows[1]) },
+		},
+		{
+			name: "invalid cursor",
+			query: func(rows []models.CoinPrice) url.Values {
+				return url.Values{"cursor": {"42"}}
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "timeout too long",
+			query: func(rows []models.CoinPrice) url.Values {
+				return url.Values{"cursor": {"0.0"}, "timeout": {"2m"}}
+			},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := testDB(t)
+			rows := pollRows(t, database)
+			handler := NewPriceHandler(database, db.NewPersister(database, t.TempDir()+"/dead_letters.jsonl"), time.Minute, nil)
+
+			code, response := poll(t, handler, "BTC", tt.query(rows))
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", code, tt.wantCode)
+			}
+			if code != http.StatusOK {
+				return
+			}
+
+			var want []uint
+			for _, row := range tt.want(rows) {
+				want = append(want, row.ID)
+			}
+			if got := pollSeqs(response.Prices); !equalPollSeqs(got, want) {
+				t.Fatalf("seqs = %v, want %v", got, want)
+			}
+			if cursor := tt.wantCursor(rows); response.Cursor != cursor {
+				t.Fatalf("cursor = %q, want %q", response.Cursor, cursor)
+			}
+		})
+	}
+}
+
+func TestPollPricesReplaced(t *testing.T) {
+	database := testDB(t)
+	rows := pollRows(t, database)
+	handler := NewPriceHandler(database, db.NewPersister(database, t.TempDir()+"/dead_letters.jsonl"), time.Minute, nil)
+	cursor := pollCursor{writtenAt: rows[2].UpdatedAt, id: rows[2].ID}.String()
+
+	// Replacing a tick in its bucket writes it again, after the cursor
+	replaced := rows[0]
+	replaced.ID = 0
+	replaced.Price = 99
+	replaced.UpdatedAt = time.Now().Add(-2 * POLL_SETTLE).UTC()
+	if err := db.UpsertPrices(database, []models.CoinPrice{replaced}); err != nil {
+		t.Fatalf("UpsertPrices: %v", err)
+	}
+
+	_, response := poll(t, handler, "BTC", url.Values{"cursor": {cursor}})
+	if len(response.Prices) != 1 || response.Prices[0].Seq != rows[0].ID || response.Prices[0].Price != 99 {
+		t.Fatalf("prices = %+v, want seq %d at 99", response.Prices, rows[0].ID)
+	}
+}
+
+func TestPollPricesRecheck(t *testing.T) {
+	database := testDB(t)
+	rows := pollRows(t, database)
+	handler := NewPriceHandler(database, db.NewPersister(database, t.TempDir()+"/dead_letters.jsonl"), time.Minute, nil)
+	cursor := pollCursor{writtenAt: rows[2].UpdatedAt, id: rows[2].ID}.String()
+	if err := database.Delete(&rows[4]).Error; err != nil {
+		t.Fatalf("deleting unsettled price: %v", err)
+	}
+
+	// A tick written by another process, one this process's persister never
+	// signals, is found on the next recheck
+	written := make(chan models.CoinPrice, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		price := models.CoinPrice{
+			Coin:      "BTC",
+			Exchange:  "coinbase",
+			Price:     104,
+			Bucket:    rows[4].Bucket,
+			CreatedAt: time.Now().Add(-POLL_SETTLE).UTC(),
+			UpdatedAt: time.Now().Add(-POLL_SETTLE).UTC(),
+		}
+		if err := database.Create(&price).Error; err != nil {
+			t.Errorf("storing price: %v", err)
+		}
+		written <- price
+	}()
+
+	started := time.Now()
+	_, response := poll(t, handler, "BTC", url.Values{"cursor": {cursor}, "timeout": {"10s"}})
+	price := <-written
+	if len(response.Prices) != 1 || response.Prices[0].Seq != price.ID {
+		t.Fatalf("prices = %+v, want seq %d", response.Prices, price.ID)
+	}
+	if waited := time.Since(started); waited > POLL_RECHECK+time.Second {
+		t.Fatalf("answered after %s, want within %s", waited, POLL_RECHECK)
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/cache"
+	"github.com/notblessy/dexlite/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// Cached endpoints, as labelled in metrics
+const (
+	CACHE_LATEST     = "latest"
+	CACHE_COMPARISON = "comparison"
+)
+
+// comparisonPage is a cached comparison. Freshness is left out and worked out
+// again on every response
+type comparisonPage struct {
+	From       time.Time        `json:"from"`
+	To         time.Time        `json:"to"`
+	Exchanges  []ExchangePrices `json:"exchanges"`
+	Count      int64            `json:"count"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+	AsOf       time.Time        `json:"as_of"`
+}
+
+// SetCache serves latest prices for latestTTL and comparisons for
+// comparisonTTL from Redis, shared by every instance, instead of the
+// in-process latest cache. Entries of a coin are dropped when a price of it
+// is stored
+func (h *PriceHandler) SetCache(responses *cache.Cache, latestTTL, comparisonTTL time.Duration) {
+	h.responses = responses
+	h.latestTTL = latestTTL
+	h.comparisonTTL = comparisonTTL
+}
+
+// cacheGet looks up a cached response. Redis errors count as a miss so reads
+// keep working against the database
+func (h *PriceHandler) cacheGet(ctx context.Context, endpoint, coin, key string, dest any) (cache.Entry, bool) {
+	entry, hit, err := h.responses.Get(ctx, coin, key, dest)
+	switch {
+	case err != nil:
+		metrics.CacheRequestsTotal.WithLabelValues(endpoint, "error").Inc()
+		log.Warn().Err(err).Str("endpoint", endpoint).Msg("Response cache lookup failed")
+	case hit:
+		metrics.CacheRequestsTotal.WithLabelValues(endpoint, "hit").Inc()
+	default:
+		metrics.CacheRequestsTotal.WithLabelValues(endpoint, "miss").Inc()
+	}
+	return entry, hit
+}
+
+func (h *PriceHandler) cacheSet(ctx context.Context, entry cache.Entry, value any, ttl time.Duration) {
+	if err := h.responses.Set(ctx, entry, value, ttl); err != nil {
+		log.Warn().Err(err).Msg("Failed to cache response")
+	}
+}
+
+// cacheKey identifies a request to endpoint by its query, leaving out
+// max_staleness which is checked against every response. The coin is the
+// scope entries are kept under
+func cacheKey(c echo.Context, endpoint string) string {
+	query := url.Values{}
+	for name, values := range c.QueryParams() {
+		if name != "max_staleness" {
+			query[name] = values
+		}
+	}
+	return endpoint + "?" + query.Encode()
+}
@@ -1,39 +1,134 @@
 package handlers
 
 import (
+	"context"
+	"math"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/cache"
+	"github.com/notblessy/dexlite/db"
 	"github.com/notblessy/dexlite/models"
 	"gorm.io/gorm"
 )
 
+// DEFAULT_PRICE_LIMIT is the page size of price comparisons
+const DEFAULT_PRICE_LIMIT = 1000
+
 type PriceHandler struct {
-	db *gorm.DB
+	db        *gorm.DB
+	persister *db.Persister
+	// interval is how often prices are fetched, used to compute expected coverage
+	interval time.Duration
+	// engineRegions maps exchanges to their matching engine's region for
+	// region=nearest reads
+	engineRegions map[string]string
+	latest        *latestCache
+
+	// responses is the shared Redis cache, nil to use latest
+	responses     *cache.Cache
+	latestTTL     time.Duration
+	comparisonTTL time.Duration
 }
 
-func NewPriceHandler(db *gorm.DB) *PriceHandler {
+func NewPriceHandler(database *gorm.DB, persister *db.Persister, interval time.Duration, engineRegions map[string]string) *PriceHandler {
 	return &PriceHandler{
-		db: db,
+		db:            database,
+		persister:     persister,
+		interval:      interval,
+		engineRegions: engineRegions,
+		latest:        newLatestCache(LATEST_CACHE_TTL),
 	}
 }
 
 type PriceResponse struct {
-	Coin      string    `json:"coin"`
-	Price     float64   `json:"price"`
-	CreatedAt time.Time `json:"created_at"`
+	Coin       string        `json:"coin"`
+	Exchange   string        `json:"exchange"`
+	Region     string        `json:"region,omitempty"`
+	Price      float64       `json:"price"`
+	Confidence *float64      `json:"confidence,omitempty"`
+	Labels     models.Labels `json:"labels,omitempty"`
+	SourceTime *time.Time    `json:"source_time,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+func newPriceResponse(price models.CoinPrice) PriceResponse {
+	return PriceResponse{
+		Coin:       price.Coin,
+		Exchange:   price.Exchange,
+		Region:     price.Region,
+		Price:      price.Price,
+		Confidence: price.Confidence,
+		Labels:     price.Labels,
+		SourceTime: price.SourceTime,
+		CreatedAt:  price.CreatedAt,
+	}
+}
+
+// CoverageResponse describes how complete a series is over the queried window
+type CoverageResponse struct {
+	ExpectedPoints    int64   `json:"expected_points"`
+	ActualPoints      int64   `json:"actual_points"`
+	CoveragePct       float64 `json:"coverage_pct"`
+	LargestGapSeconds float64 `json:"largest_gap_seconds"`
+	// Incidents are the venue's status page incidents ongoing during a gap
+	// of more than two fetch intervals
+	Incidents []IncidentResponse `json:"incidents,omitempty"`
+}
+
+// IncidentResponse is an incident a venue posted on its status page
+type IncidentResponse struct {
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	Impact     string     `json:"impact"`
+	URL        string     `json:"url,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// ExchangePrices holds one venue's prices within a comparison, newest first
+type ExchangePrices struct {
+	Exchange string            `json:"exchange"`
+	Latest   *PriceResponse    `json:"latest"`
+	Prices   []PriceResponse   `json:"prices"`
+	Count    int64             `json:"count"`
+	Coverage *CoverageResponse `json:"coverage,omitempty"`
 }
 
+// PriceComparisonResponse is one page of a comparison. Count and Coverage
+// cover the whole window; Latest describes only the rows on this page
 type PriceComparisonResponse struct {
-	Coin   string          `json:"coin"`
+	Coin string `json:"coin"`
+	Freshness
+	From       time.Time        `json:"from"`
+	To         time.Time        `json:"to"`
+	Exchanges  []ExchangePrices `json:"exchanges"`
+	Count      int64            `json:"count"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+type LatestPriceResponse struct {
+	Coin string `json:"coin"`
+	Freshness
 	Prices []PriceResponse `json:"prices"`
-	Count  int64           `json:"count"`
 }
 
-// GetPriceComparison returns prices for a coin within the last 24 hours
-// GET /api/prices/:coin
-func (h *PriceHandler) GetPriceComparison(c echo.Context) error {
+// newestPrice returns the creation time of the most recent price, zero if none
+func newestPrice(prices []PriceResponse) time.Time {
+	var newest time.Time
+	for _, price := range prices {
+		if price.CreatedAt.After(newest) {
+			newest = price.CreatedAt
+		}
+	}
+	return newest
+}
+
+// GetLatestPrice returns the most recent stored price for a coin from each exchange
+// GET /api/prices/:coin/latest?sources=&region=nearest&max_staleness=90s
+func (h *PriceHandler) GetLatestPrice(c echo.Context) error {
 	coin := c.Param("coin")
 	if coin == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{
@@ -41,44 +136,296 @@ func (h *PriceHandler) GetPriceComparison(c echo.Context) error {
 		})
 	}
 
-	// Calculate 24 hours ago
-	twentyFourHoursAgo := time.Now().Add(-24 * time.Hour)
+	ctx := c.Request().Context()
+	sources := sourcesFilter(c)
+	region := c.QueryParam("region")
+	key := coin + "|" + strings.Join(sources, ",") + "|" + region
 
-	var prices []models.CoinPrice
-	var count int64
+	var prices []PriceResponse
+	var entry cache.Entry
+	var ok bool
+	if h.responses != nil {
+		entry, ok = h.cacheGet(ctx, CACHE_LATEST, coin, key, &prices)
+	} else {
+		prices, ok = h.latest.get(key)
+	}
+	if !ok {
+		var err error
+		if prices, err = h.queryLatest(ctx, coin, sources, region); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to fetch latest prices",
+			})
+		}
+		if h.responses != nil {
+			h.cacheSet(ctx, entry, prices, h.latestTTL)
+		} else {
+			h.latest.set(key, prices)
+		}
+	}
 
-	// Query prices for the coin within the last 24 hours
-	query := h.db.Where("coin = ? AND created_at >= ?", coin, twentyFourHoursAgo)
+	freshness := newFreshness(newestPrice(prices))
+	if fresh, err := checkStaleness(c, freshness); !fresh {
+		return err
+	}
 
-	// Count first
-	if err := query.Model(&models.CoinPrice{}).Count(&count).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to count prices",
-		})
+	return c.JSON(http.StatusOK, LatestPriceResponse{Coin: coin, Freshness: freshness, Prices: prices})
+}
+
+// queryLatest loads the newest row per exchange for a coin
+func (h *PriceHandler) queryLatest(ctx context.Context, coin string, sources []string, region string) ([]PriceResponse, error) {
+	var rows []models.CoinPrice
+	query := h.db.WithContext(ctx).Model(&models.CoinPrice{}).
+		Where("coin = ?", coin).
+		Scopes(scopeSources(sources), scopeRegion(region, h.engineRegions))
+	err := db.LatestPer(query, "exchange").Find(&rows).Error
+	if err != nil {
+		return nil, err
 	}
 
-	// Then fetch the data
-	if err := query.Order("created_at DESC").Find(&prices).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to fetch prices",
+	prices := make([]PriceResponse, len(rows))
+	for i, price := range rows {
+		prices[i] = newPriceResponse(price)
+	}
+	return prices, nil
+}
+
+// GetPriceComparison returns prices for a coin grouped by exchange. The window
+// defaults to the last 24 hours and pages through it with next_cursor
+// GET /api/prices/:coin?from=&to=&limit=1000&cursor=&sources=&region=nearest&labels=key:value&coverage=true&max_staleness=90s
+func (h *PriceHandler) GetPriceComparison(c echo.Context) error {
+	coin := c.Param("coin")
+	if coin == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "coin symbol is required",
 		})
 	}
 
-	// Convert to response format
-	priceResponses := make([]PriceResponse, len(prices))
-	for i, price := range prices {
-		priceResponses[i] = PriceResponse{
-			Coin:      price.Coin,
-			Price:     price.Price,
-			CreatedAt: price.CreatedAt,
+	from, to, err := timeWindow(c, 24*time.Hour)
+	if err != nil {
+		return badRequest(c, err)
+	}
+
+	limit, err := rowLimit(c, DEFAULT_PRICE_LIMIT)
+	if err != nil {
+		return badRequest(c, err)
+	}
+
+	var cursor *priceCursor
+	if value := c.QueryParam("cursor"); value != "" {
+		decoded, err := decodePriceCursor(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
 		}
+		cursor = &decoded
+	}
+
+	ctx := c.Request().Context()
+	var page comparisonPage
+	var entry cache.Entry
+	var ok bool
+	if h.responses != nil {
+		entry, ok = h.cacheGet(ctx, CACHE_COMPARISON, coin, cacheKey(c, CACHE_COMPARISON), &page)
+	}
+	if ok {
+		// Export caps can differ between clients, so a hit is checked too
+		if err := checkExport(c, page.Count); err != nil {
+			return badRequest(c, err)
+		}
+	} else {
+		var prices []models.CoinPrice
+		var count int64
+
+		// Query prices for the coin within the window. The count, the page and
+		// the coverage each start from this query, so it is a session they
+		// branch off rather than a statement they all add to
+		query := h.db.WithContext(ctx).Where("coin = ? AND created_at >= ? AND created_at < ?", coin, from, to).
+			Scopes(scopeSources(sourcesFilter(c)), scopeRegion(c.QueryParam("region"), h.engineRegions), scopeLabels(labelsFilter(c))).
+			Session(&gorm.Session{})
+
+		// Count first, over the whole window rather than the page
+		if err := query.Model(&models.CoinPrice{}).Count(&count).Error; err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to count prices",
+			})
+		}
+		if err := checkExport(c, count); err != nil {
+			return badRequest(c, err)
+		}
+
+		// Then fetch one page, with an extra row to tell whether another follows
+		rows := query.Order("exchange ASC, created_at DESC, id DESC").Limit(limit + 1)
+		if cursor != nil {
+			rows = rows.Scopes(cursor.scopeAfter)
+		}
+		if err := rows.Find(&prices).Error; err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to fetch prices",
+			})
+		}
+
+		var nextCursor string
+		if len(prices) > limit {
+			prices = prices[:limit]
+			nextCursor = newPriceCursor(prices[limit-1]).encode()
+		}
+
+		// Convert to response format, rows arrive ordered by exchange so each
+		// venue forms a contiguous run
+		exchanges := []ExchangePrices{}
+		for _, price := range prices {
+			if len(exchanges) == 0 || exchanges[len(exchanges)-1].Exchange != price.Exchange {
+				exchanges = append(exchanges, ExchangePrices{
+					Exchange: price.Exchange,
+					Prices:   []PriceResponse{},
+				})
+			}
+
+			group := &exchanges[len(exchanges)-1]
+			group.Prices = append(group.Prices, newPriceResponse(price))
+			group.Count++
+		}
+
+		var asOf time.Time
+		var series map[string][]time.Time
+		var incidents []models.VenueIncident
+		withCoverage := c.QueryParam("coverage") == "true"
+		if withCoverage && len(exchanges) > 0 {
+			names := make([]string, len(exchanges))
+			for i, group := range exchanges {
+				names[i] = group.Exchange
+			}
+			// A page ends wherever the limit falls, so coverage reads every
+			// point of its venues in the window rather than the page's rows
+			series, err = coverageSeries(query, names)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"error": "failed to fetch prices",
+				})
+			}
+			incidents, err = db.VenueIncidents(h.db.WithContext(ctx), names, from, to)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"error": "failed to fetch venue incidents",
+				})
+			}
+		}
+		for i := range exchanges {
+			exchanges[i].Latest = &exchanges[i].Prices[0]
+			if exchanges[i].Latest.CreatedAt.After(asOf) {
+				asOf = exchanges[i].Latest.CreatedAt
+			}
+			if withCoverage {
+				exchanges[i].Coverage = h.coverage(exchanges[i].Exchange, series[exchanges[i].Exchange], incidents, from, to)
+			}
+		}
+
+		page = comparisonPage{
+			From:       from,
+			To:         to,
+			Exchanges:  exchanges,
+			Count:      count,
+			NextCursor: nextCursor,
+			AsOf:       asOf,
+		}
+		if h.responses != nil {
+			h.cacheSet(ctx, entry, page, h.comparisonTTL)
+		}
+	}
+
+	freshness := newFreshness(page.AsOf)
+	if fresh, err := checkStaleness(c, freshness); !fresh {
+		return err
 	}
 
 	response := PriceComparisonResponse{
-		Coin:   coin,
-		Prices: priceResponses,
-		Count:  count,
+		Coin:       coin,
+		Freshness:  freshness,
+		From:       page.From,
+		To:         page.To,
+		Exchanges:  page.Exchanges,
+		Count:      page.Count,
+		NextCursor: page.NextCursor,
 	}
 
 	return c.JSON(http.StatusOK, response)
 }
+
+// coverageSeries loads the creation times of every price query matches for
+// exchanges, newest first per exchange
+func coverageSeries(query *gorm.DB, exchanges []string) (map[string][]time.Time, error) {
+	var rows []struct {
+		Exchange  string
+		CreatedAt time.Time
+	}
+	err := query.Model(&models.CoinPrice{}).
+		Select("exchange, created_at").
+		Where("exchange IN ?", exchanges).
+		Order("exchange ASC, created_at DESC").
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	series := make(map[string][]time.Time, len(exchanges))
+	for _, row := range rows {
+		series[row.Exchange] = append(series[row.Exchange], row.CreatedAt)
+	}
+	return series, nil
+}
+
+// coverage compares the points in a newest-first series against what the fetch
+// interval would have produced between from and to. The largest gap includes
+// the edges of the window, so a series that stopped early shows a large gap.
+// Gaps are annotated with the exchange's incidents that overlap them
+func (h *PriceHandler) coverage(exchange string, points []time.Time, incidents []models.VenueIncident, from, to time.Time) *CoverageResponse {
+	expected := int64(to.Sub(from) / h.interval)
+	actual := int64(len(points))
+
+	var largestGap time.Duration
+	var during []IncidentResponse
+	seen := make(map[uint]bool)
+	gap := func(start, end time.Time) {
+		if end.Sub(start) > largestGap {
+			largestGap = end.Sub(start)
+		}
+		if end.Sub(start) <= 2*h.interval {
+			return
+		}
+		for _, incident := range incidents {
+			if incident.Exchange != exchange || seen[incident.ID] || !incident.Overlaps(start, end) {
+				continue
+			}
+			seen[incident.ID] = true
+			during = append(during, IncidentResponse{
+				Name:       incident.Name,
+				Status:     incident.Status,
+				Impact:     incident.Impact,
+				URL:        incident.URL,
+				StartedAt:  incident.StartedAt,
+				ResolvedAt: incident.ResolvedAt,
+			})
+		}
+	}
+
+	previous := to
+	for _, point := range points {
+		gap(point, previous)
+		previous = point
+	}
+	gap(from, previous)
+
+	var coveragePct float64
+	if expected > 0 {
+		coveragePct = math.Min(float64(actual)/float64(expected)*100, 100)
+	}
+
+	return &CoverageResponse{
+		ExpectedPoints:    expected,
+		ActualPoints:      actual,
+		CoveragePct:       coveragePct,
+		LargestGapSeconds: largestGap.Seconds(),
+		Incidents:         during,
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/metrics"
+	"github.com/notblessy/dexlite/ratelimit"
+	"github.com/rs/zerolog/log"
+)
+
+// HEADER_API_KEY identifies a client with its own rate limit
+const HEADER_API_KEY = "X-API-Key"
+
+// Rate limit headers added to every limited response
+const (
+	HEADER_RATELIMIT_LIMIT     = "X-RateLimit-Limit"
+	HEADER_RATELIMIT_REMAINING = "X-RateLimit-Remaining"
+)
+
+// RateLimit gives every client a token bucket per route group and answers
+// 429 with Retry-After once it is empty. Clients sending one of keys as
+// X-API-Key get a bucket of their own, everyone else is limited by IP. A
+// failing store lets requests through rather than taking the API down
+func RateLimit(store ratelimit.Store, group string, limit ratelimit.Limit, keys []string) echo.MiddlewareFunc {
+	known := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		known[key] = true
+	}
+	burst := strconv.Itoa(limit.Burst)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			client := "ip:" + c.RealIP()
+			if key := c.Request().Header.Get(HEADER_API_KEY); key != "" && known[key] {
+				// Keys are hashed so they never end up in a shared store
+				sum := sha256.Sum256([]byte(key))
+				client = "key:" + hex.EncodeToString(sum[:8])
+			}
+
+			decision, err := store.Take(c.Request().Context(), group+":"+client, limit)
+			if err != nil {
+				metrics.RateLimitErrorsTotal.Inc()
+				log.Warn().Err(err).Str("group", group).Msg("Rate limit check failed, allowing request")
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set(HEADER_RATELIMIT_LIMIT, burst)
+			header.Set(HEADER_RATELIMIT_REMAINING, strconv.Itoa(decision.Remaining))
+			if !decision.Allowed {
+				metrics.RateLimitedTotal.WithLabelValues(group).Inc()
+				header.Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+				return c.JSON(http.StatusTooManyRequests, map[string]string{
+					"error": "rate limit exceeded, retry later",
+				})
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/services"
+	"github.com/notblessy/dexlite/workers"
+	"gorm.io/gorm"
+)
+
+// SchemaSeries describes one stored time series: the table it lives in, the
+// endpoint serving it and the fields of its rows
+type SchemaSeries struct {
+	Name      string        `json:"name"`
+	Table     string        `json:"table"`
+	Endpoint  string        `json:"endpoint"`
+	Intervals []string      `json:"intervals,omitempty"`
+	Fields    []SchemaField `json:"fields"`
+	// Retention is how long rows are kept, as a Go duration, empty when they
+	// are never cleaned up
+	Retention string `json:"retention,omitempty"`
+}
+
+// SchemaField is one JSON field of a series row. Type is a JSON Schema type,
+// with Format set for timestamps
+type SchemaField struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Format   string `json:"format,omitempty"`
+	Nullable bool   `json:"nullable"`
+}
+
+// SchemaSource is a configured source and what it can be asked for
+type SchemaSource struct {
+	Name         string   `json:"name"`
+	Role         string   `json:"role"`
+	Type         string   `json:"type"`
+	Quote        string   `json:"quote"`
+	Contract     string   `json:"contract,omitempty"`
+	Capabilities []string `json:"capabilities"`
+}
+
+type SchemaRetention struct {
+	RawPrices       string                `json:"raw_prices"`
+	CleanupInterval string                `json:"cleanup_interval"`
+	Rules           []SchemaRetentionRule `json:"rules,omitempty"`
+}
+
+// SchemaRetentionRule is a configured retention rule, Keep is empty for rows
+// kept forever
+type SchemaRetentionRule struct {
+	Table    string `json:"table"`
+	Coin     string `json:"coin,omitempty"`
+	Interval string `json:"interval,omitempty"`
+	Keep     string `json:"keep,omitempty"`
+}
+
+type SchemaResponse struct {
+	Coins     []string        `json:"coins"`
+	Sources   []SchemaSource  `json:"sources"`
+	Series    []SchemaSeries  `json:"series"`
+	Retention SchemaRetention `json:"retention"`
+}
+
+// schemaSeries lists every series served by the API, the row model is only
+// used for its type
+var schemaSeries = []struct {
+	name     string
+	endpoint string
+	model    interface{ TableName() string }
+}{
+	{"prices", "/api/prices/:coin", models.CoinPrice{}},
+	{"candles", "/api/candles/:coin", models.CoinCandle{}},
+	{"funding_rates", "/api/funding/:coin", models.FundingRate{}},
+	{"index_prices", "/api/index/:coin/history", models.IndexPrice{}},
+	{"mark_prices", "/api/marks/:coin", models.MarkPrice{}},
+	{"orderbook_snapshots", "/api/orderbook/:coin", models.OrderbookSnapshot{}},
+}
+
+// SchemaHandler describes the data model of this instance for client
+// generators and data catalogs
+type SchemaHandler struct {
+	registry        *services.Registry
+	coins           func() []string
+	retention       time.Duration
+	cleanupInterval time.Duration
+	rules           []workers.RetentionRule
+}
+
+// NewSchemaHandler creates a handler describing the coins returned by coins,
+// the sources in registry and the raw price retention
+func NewSchemaHandler(registry *services.Registry, coins func() []string, retention, cleanupInterval time.Duration) *SchemaHandler {
+	return &SchemaHandler{
+		registry:        registry,
+		coins:           coins,
+		retention:       retention,
+		cleanupInterval: cleanupInterval,
+	}
+}
+
+// SetRetentionRules describes the retention rules the cleanup worker applies
+// on top of the raw price retention
+func (h *SchemaHandler) SetRetentionRules(rules []workers.RetentionRule) {
+	h.rules = rules
+}
+
+// GetSchema returns the tracked coins, the sources and their capabilities,
+// and the stored series with their fields and retention. Fields are read
+// from the row models so the schema can't drift from the responses
+// GET /api/schema
+func (h *SchemaHandler) GetSchema(c echo.Context) error {
+	coins := scopedCoins(c, h.coins())
+	sort.Strings(coins)
+
+	series := make([]SchemaSeries, 0, len(schemaSeries))
+	for _, s := range schemaSeries {
+		entry := SchemaSeries{
+			Name:     s.name,
+			Table:    s.model.TableName(),
+			Endpoint: s.endpoint,
+			Fields:   schemaFields(reflect.TypeOf(s.model)),
+		}
+		for _, rule := range h.rules {
+			if rule.Table == s.name && rule.Coin == "" && rule.Interval == "" && rule.Keep > 0 {
+				entry.Retention = rule.Keep.String()
+			}
+		}
+		switch s.model.(type) {
+		case models.CoinPrice:
+			entry.Retention = h.retention.String()
+		case models.CoinCandle:
+			for interval := range models.CANDLE_INTERVALS {
+				entry.Intervals = append(entry.Intervals, interval)
+			}
+			sort.Slice(entry.Intervals, func(i, j int) bool {
+				return models.CANDLE_INTERVALS[entry.Intervals[i]] < models.CANDLE_INTERVALS[entry.Intervals[j]]
+			})
+		}
+		series = append(series, entry)
+	}
+
+	rules := make([]SchemaRetentionRule, 0, len(h.rules))
+	for _, rule := range h.rules {
+		described := SchemaRetentionRule{Table: rule.Table, Coin: rule.Coin, Interval: rule.Interval}
+		if rule.Keep > 0 {
+			described.Keep = rule.Keep.String()
+		}
+		rules = append(rules, described)
+	}
+
+	return c.JSON(http.StatusOK, SchemaResponse{
+		Coins:   coins,
+		Sources: h.sources(),
+		Series:  series,
+		Retention: SchemaRetention{
+			RawPrices:       h.retention.String(),
+			CleanupInterval: h.cleanupInterval.String(),
+			Rules:           rules,
+		},
+	})
+}
+
+func (h *SchemaHandler) sources() []SchemaSource {
+	sources := h.registry.Sources()
+	primary, fallback := h.registry.Primary(), h.registry.Fallback()
+	if fallback != nil {
+		sources = append(sources, fallback)
+	}
+
+	described := make([]SchemaSource, 0, len(sources))
+	for _, source := range sources {
+		instrument := instrumentOf(source)
+		role := "secondary"
+		switch source {
+		case primary:
+			role = "primary"
+		case fallback:
+			role = "fallback"
+		}
+
+		described = append(described, SchemaSource{
+			Name:         source.Name(),
+			Role:         role,
+			Type:         instrument.Type,
+			Quote:        instrument.Quote,
+			Contract:     instrument.Contract,
+			Capabilities: capabilities(source),
+		})
+	}
+	return described
+}
+
+// capabilities lists the optional calls source supports
+func capabilities(source services.PriceSource) []string {
+	capabilities := []string{"prices"}
+	if _, ok := source.(services.FundingSource); ok {
+		capabilities = append(capabilities, "funding")
+	}
+	if _, ok := source.(services.MarkSource); ok {
+		capabilities = append(capabilities, "marks")
+	}
+	if _, ok := source.(services.OrderBookSource); ok {
+		capabilities = append(capabilities, "orderbook")
+	}
+	if _, ok := source.(services.MarketLister); ok {
+		capabilities = append(capabilities, "markets")
+	}
+	return capabilities
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+)
+
+// schemaFields lists the JSON fields of a row model in declaration order
+func schemaFields(model reflect.Type) []SchemaField {
+	fields := make([]SchemaField, 0, model.NumField())
+	for i := 0; i < model.NumField(); i++ {
+		field := model.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		typ := field.Type
+		nullable := strings.Contains(options, "omitempty")
+		if typ.Kind() == reflect.Pointer {
+			typ = typ.Elem()
+			nullable = true
+		}
+
+		schemaType, format := jsonType(typ)
+		if typ == deletedAtType {
+			nullable = true
+		}
+		fields = append(fields, SchemaField{
+			Name:     name,
+			Type:     schemaType,
+			Format:   format,
+			Nullable: nullable,
+		})
+	}
+	return fields
+}
+
+// jsonType maps a Go type to the JSON Schema type it encodes as
+func jsonType(typ reflect.Type) (string, string) {
+	if typ == timeType || typ == deletedAtType {
+		return "string", "date-time"
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		return "string", ""
+	case reflect.Bool:
+		return "boolean", ""
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer", ""
+	case reflect.Float32, reflect.Float64:
+		return "number", ""
+	case reflect.Slice, reflect.Array:
+		return "array", ""
+	default:
+		return "object", ""
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/metrics"
+)
+
+type SLOHandler struct {
+	tracker *metrics.SLOTracker
+	windows []time.Duration
+}
+
+// NewSLOHandler reports the SLOs of tracker over windows, the burn alert
+// windows
+func NewSLOHandler(tracker *metrics.SLOTracker, windows []time.Duration) *SLOHandler {
+	return &SLOHandler{
+		tracker: tracker,
+		windows: windows,
+	}
+}
+
+type SLOResponse struct {
+	Name      string              `json:"name"`
+	Method    string              `json:"method,omitempty"`
+	Route     string              `json:"route"`
+	LatencyMs int64               `json:"latency_ms,omitempty"`
+	TargetPct float64             `json:"target_pct"`
+	Windows   []SLOWindowResponse `json:"windows"`
+}
+
+type SLOWindowResponse struct {
+	Window   string  `json:"window"`
+	Requests int64   `json:"requests"`
+	Bad      int64   `json:"bad"`
+	BurnRate float64 `json:"burn_rate"`
+}
+
+// GetSLOs returns every SLO with its requests and burn rate per window
+// GET /api/slo
+func (h *SLOHandler) GetSLOs(c echo.Context) error {
+	now := time.Now()
+	slos := h.tracker.SLOs()
+	response := make([]SLOResponse, len(slos))
+	for i, slo := range slos {
+		windows := make([]SLOWindowResponse, len(h.windows))
+		for j, window := range h.windows {
+			result := h.tracker.Window(i, window, now)
+			windows[j] = SLOWindowResponse{
+				Window:   window.String(),
+				Requests: result.Requests,
+				Bad:      result.Bad,
+				BurnRate: result.BurnRate,
+			}
+		}
+		response[i] = SLOResponse{
+			Name:      slo.Name,
+			Method:    slo.Method,
+			Route:     slo.Route,
+			LatencyMs: slo.Latency.Milliseconds(),
+			TargetPct: slo.Objective * 100,
+			Windows:   windows,
+		}
+	}
+	return c.JSON(http.StatusOK, response)
+}
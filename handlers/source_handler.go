@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/services"
+	"gorm.io/gorm"
+)
+
+type SourceHandler struct {
+	db      *gorm.DB
+	clock   *services.ClockMonitor
+	breaker *services.CircuitBreaker
+}
+
+func NewSourceHandler(db *gorm.DB, clock *services.ClockMonitor, breaker *services.CircuitBreaker) *SourceHandler {
+	return &SourceHandler{
+		db:      db,
+		clock:   clock,
+		breaker: breaker,
+	}
+}
+
+type SourceSLAResponse struct {
+	Exchange         string     `json:"exchange"`
+	Month            string     `json:"month"`
+	Cycles           int64      `json:"cycles"`
+	SuccessfulCycles int64      `json:"successful_cycles"`
+	UptimePct        float64    `json:"uptime_pct"`
+	CompletenessPct  float64    `json:"completeness_pct"`
+	LastSuccessAt    *time.Time `json:"last_success_at"`
+	MaxGapSeconds    float64    `json:"max_gap_seconds"`
+}
+
+// GetSLA returns monthly uptime and freshness stats per source
+// GET /api/sources/sla?month=YYYY-MM&source=
+func (h *SourceHandler) GetSLA(c echo.Context) error {
+	month := c.QueryParam("month")
+	if month == "" {
+		month = models.SLAMonth(time.Now())
+	}
+
+	if _, err := time.Parse("2006-01", month); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "month must be formatted as YYYY-MM",
+		})
+	}
+
+	query := h.db.Where("month = ?", month)
+	if source := c.QueryParam("source"); source != "" {
+		query = query.Where("exchange = ?", source)
+	}
+
+	var stats []models.SourceSLA
+	if err := query.Order("exchange ASC").Find(&stats).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch SLA stats",
+		})
+	}
+
+	responses := make([]SourceSLAResponse, len(stats))
+	for i, sla := range stats {
+		responses[i] = SourceSLAResponse{
+			Exchange:         sla.Exchange,
+			Month:            sla.Month,
+			Cycles:           sla.Cycles,
+			SuccessfulCycles: sla.SuccessfulCycles,
+			UptimePct:        percentage(sla.SuccessfulCycles, sla.Cycles),
+			CompletenessPct:  percentage(sla.ReceivedPrices, sla.RequestedPrices),
+			LastSuccessAt:    sla.LastSuccessAt,
+			MaxGapSeconds:    sla.MaxGapSeconds,
+		}
+	}
+
+	return c.JSON(http.StatusOK, responses)
+}
+
+// percentage returns part/total in percent, or 0 when total is 0
+func percentage(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
+
+// GetClockSkew returns the measured clock skew of each source. Venue-reported
+// timestamps are stored corrected by these values
+// GET /api/sources/skew
+func (h *SourceHandler) GetClockSkew(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.clock.Skews())
+}
+
+// GetBreakers returns the circuit breaker state of every source fetched so far
+// GET /api/sources/breakers
+func (h *SourceHandler) GetBreakers(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.breaker.Status())
+}
+
+type SourceRankingResponse struct {
+	Rank int `json:"rank"`
+	models.RankedSource
+	Hourly []SourceScorePoint `json:"hourly"`
+}
+
+type SourceScorePoint struct {
+	Hour   time.Time `json:"hour"`
+	Score  float64   `json:"score"`
+	Cycles int64     `json:"cycles"`
+}
+
+// GetRanking ranks sources by quality score over a window, default the last
+// 24 hours, with the hourly scores behind each one
+// GET /api/sources/ranking?from=&to=
+func (h *SourceHandler) GetRanking(c echo.Context) error {
+	from, to, err := timeWindow(c, 24*time.Hour)
+	if err != nil {
+		return badRequest(c, err)
+	}
+
+	var rows []models.SourceScore
+	err = h.db.WithContext(c.Request().Context()).
+		Where("hour >= ? AND hour < ?", from.UTC().Truncate(time.Hour), to).
+		Order("hour ASC").
+		Find(&rows).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch source scores",
+		})
+	}
+
+	hourly := make(map[string][]SourceScorePoint)
+	for _, row := range rows {
+		quality := row.Quality()
+		hourly[row.Exchange] = append(hourly[row.Exchange], SourceScorePoint{
+			Hour:   row.Hour,
+			Score:  quality.Score,
+			Cycles: quality.Cycles,
+		})
+	}
+
+	ranking := models.RankSources(rows)
+	responses := make([]SourceRankingResponse, len(ranking))
+	for i, ranked := range ranking {
+		responses[i] = SourceRankingResponse{
+			Rank:         i + 1,
+			RankedSource: ranked,
+			Hourly:       hourly[ranked.Exchange],
+		}
+	}
+
+	return c.JSON(http.StatusOK, responses)
+}
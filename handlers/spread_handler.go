@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+)
+
+// MAX_SPREAD_ALERTS caps how many flagged spreads one response carries
+const MAX_SPREAD_ALERTS = 100
+
+type SpreadHandler struct {
+	db *gorm.DB
+	// maxAge excludes venues whose latest price is older from the current spread
+	maxAge time.Duration
+}
+
+func NewSpreadHandler(db *gorm.DB, maxAge time.Duration) *SpreadHandler {
+	return &SpreadHandler{
+		db:     db,
+		maxAge: maxAge,
+	}
+}
+
+// CurrentSpread is the widest spread between venues' latest prices
+type CurrentSpread struct {
+	BuyExchange  string          `json:"buy_exchange"`
+	BuyPrice     float64         `json:"buy_price"`
+	SellExchange string          `json:"sell_exchange"`
+	SellPrice    float64         `json:"sell_price"`
+	SpreadBps    float64         `json:"spread_bps"`
+	Venues       []PriceResponse `json:"venues"`
+}
+
+// SpreadPoint is the spread between the cheapest and richest candle close in
+// one bucket
+type SpreadPoint struct {
+	OpenTime     time.Time `json:"open_time"`
+	LowExchange  string    `json:"low_exchange"`
+	Low          float64   `json:"low"`
+	HighExchange string    `json:"high_exchange"`
+	High         float64   `json:"high"`
+	SpreadBps    float64   `json:"spread_bps"`
+	Exchanges    int64     `json:"exchanges"`
+}
+
+type SpreadsResponse struct {
+	Coin     string               `json:"coin"`
+	Interval string               `json:"interval"`
+	From     time.Time            `json:"from"`
+	To       time.Time            `json:"to"`
+	Current  *CurrentSpread       `json:"current"`
+	History  []SpreadPoint        `json:"history"`
+	Alerts   []models.SpreadAlert `json:"alerts"`
+}
+
+// GetSpreads returns the current spread between venues, its history from
+// candle closes and the spreads flagged by the spread monitor in the window.
+// The window defaults to the last 24 hours
+// GET /api/spreads/:coin?interval=1h&from=&to=&sources=
+func (h *SpreadHandler) GetSpreads(c echo.Context) error {
+	coin := c.Param("coin")
+	if coin == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "coin symbol is required",
+		})
+	}
+
+	interval := c.QueryParam("interval")
+	if interval == "" {
+		interval = "1h"
+	}
+	size, ok := models.CANDLE_INTERVALS[interval]
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "interval must be one of 1m, 5m, 1h",
+		})
+	}
+
+	from, to, err := timeWindow(c, 24*time.Hour)
+	if err != nil {
+		return badRequest(c, err)
+	}
+	if err := checkRows(c, int64(to.Sub(from)/size)); err != nil {
+		return badRequest(c, err)
+	}
+
+	ctx := c.Request().Context()
+	sources := sourcesFilter(c)
+
+	var latest []models.CoinPrice
+	query := h.db.WithContext(ctx).Model(&models.CoinPrice{}).
+		Where("coin = ? AND created_at >= ?", coin, time.Now().Add(-h.maxAge)).
+		Scopes(scopeSources(sources))
+	err = db.LatestPer(query, "exchange").Find(&latest).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch latest prices",
+		})
+	}
+
+	var current *CurrentSpread
+	if spread, ok := models.WidestSpread(latest); ok {
+		venues := make([]PriceResponse, len(latest))
+		for i, price := range latest {
+			venues[i] = newPriceResponse(price)
+		}
+		current = &CurrentSpread{
+			BuyExchange:  spread.BuyExchange,
+			BuyPrice:     spread.BuyPrice,
+			SellExchange: spread.SellExchange,
+			SellPrice:    spread.SellPrice,
+			SpreadBps:    spread.SpreadBps,
+			Venues:       venues,
+		}
+	}
+
+	// Spread per bucket across the venues that have a candle in it
+	history := []SpreadPoint{}
+	err = h.db.WithContext(ctx).Model(&models.CoinCandle{}).
+		Select(`open_time,
+			(ARRAY_AGG(exchange ORDER BY close ASC))[1] AS low_exchange,
+			MIN(close) AS low,
+			(ARRAY_AGG(exchange ORDER BY close DESC))[1] AS high_exchange,
+			MAX(close) AS high,
+			COUNT(*) AS exchanges`).
+		Where("coin = ? AND resolution = ? AND open_time >= ? AND open_time < ?", coin, interval, from.Truncate(size), to).
+		Scopes(scopeSources(sources)).
+		Group("open_time").
+		Having("COUNT(*) >= 2").
+		Order("open_time ASC").
+		Scan(&history).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch spread history",
+		})
+	}
+	for i := range history {
+		history[i].SpreadBps = models.SpreadBps(history[i].Low, history[i].High)
+	}
+
+	alerts := []models.SpreadAlert{}
+	err = h.db.WithContext(ctx).Where("coin = ? AND detected_at >= ? AND detected_at < ?", coin, from, to).
+		Order("detected_at DESC").
+		Limit(MAX_SPREAD_ALERTS).
+		Find(&alerts).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch spread alerts",
+		})
+	}
+
+	return c.JSON(http.StatusOK, SpreadsResponse{
+		Coin:     coin,
+		Interval: interval,
+		From:     from,
+		To:       to,
+		Current:  current,
+		History:  history,
+		Alerts:   alerts,
+	})
+}
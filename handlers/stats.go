@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+)
+
+// statsWindow is a trailing period price statistics are reported over
+type statsWindow struct {
+	name   string
+	length time.Duration
+}
+
+// STATS_WINDOWS are the periods returned by GetPriceStats. Windows longer than
+// the raw price retention only cover the prices still stored
+var STATS_WINDOWS = []statsWindow{
+	{name: "1h", length: time.Hour},
+	{name: "24h", length: 24 * time.Hour},
+	{name: "7d", length: 7 * 24 * time.Hour},
+}
+
+// WindowStats summarises one exchange's prices over a trailing window. Open is
+// the oldest price in the window and Close the newest
+type WindowStats struct {
+	Open      float64   `json:"open"`
+	Close     float64   `json:"close"`
+	Change    float64   `json:"change"`
+	ChangePct float64   `json:"change_pct"`
+	High      float64   `json:"high"`
+	Low       float64   `json:"low"`
+	Average   float64   `json:"average"`
+	Count     int64     `json:"count"`
+	FirstAt   time.Time `json:"first_at"`
+	LastAt    time.Time `json:"last_at"`
+}
+
+type ExchangeStats struct {
+	Exchange string                  `json:"exchange"`
+	Windows  map[string]*WindowStats `json:"windows"`
+}
+
+type PriceStatsResponse struct {
+	Coin      string          `json:"coin"`
+	AsOf      time.Time       `json:"as_of"`
+	Exchanges []ExchangeStats `json:"exchanges"`
+}
+
+// statsRow is one exchange's aggregate for a window as returned by SQL
+type statsRow struct {
+	Exchange string
+	Open     float64
+	Close    float64
+	High     float64
+	Low      float64
+	Average  float64
+	Count    int64
+	FirstAt  time.Time
+	LastAt   time.Time
+}
+
+// windowStats aggregates coin's prices stored since since per exchange
+func windowStats(database *gorm.DB, coin string, since time.Time, scopes ...func(*gorm.DB) *gorm.DB) ([]statsRow, error) {
+	var rows []statsRow
+	err := database.Model(&models.CoinPrice{}).
+		Select(`exchange,
+			(ARRAY_AGG(price ORDER BY created_at ASC))[1] AS open,
+			(ARRAY_AGG(price ORDER BY created_at DESC))[1] AS close,
+			MAX(price) AS high,
+			MIN(price) AS low,
+			AVG(price) AS average,
+			COUNT(*) AS count,
+			MIN(created_at) AS first_at,
+			MAX(created_at) AS last_at`).
+		Where("coin = ? AND created_at >= ?", coin, since).
+		Scopes(scopes...).
+		Group("exchange").
+		Order("exchange ASC").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// GetPriceStats returns change, percentage change, high, low and average per
+// exchange over the last 1h, 24h and 7d, aggregated in the database
+// GET /api/prices/:coin/stats?sources=&region=nearest
+func (h *PriceHandler) GetPriceStats(c echo.Context) error {
+	coin := c.Param("coin")
+	if coin == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "coin symbol is required",
+		})
+	}
+
+	now := time.Now()
+	sources := sourcesFilter(c)
+	region := scopeRegion(c.QueryParam("region"), h.engineRegions)
+
+	exchanges := []ExchangeStats{}
+	byExchange := make(map[string]int)
+
+	for _, window := range STATS_WINDOWS {
+		rows, err := windowStats(h.db.WithContext(c.Request().Context()), coin, now.Add(-window.length), scopeSources(sources), region)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to compute price stats",
+			})
+		}
+
+		for _, row := range rows {
+			i, exists := byExchange[row.Exchange]
+			if !exists {
+				i = len(exchanges)
+				byExchange[row.Exchange] = i
+				exchanges = append(exchanges, ExchangeStats{
+					Exchange: row.Exchange,
+					Windows:  make(map[string]*WindowStats, len(STATS_WINDOWS)),
+				})
+			}
+
+			stats := &WindowStats{
+				Open:    row.Open,
+				Close:   row.Close,
+				Change:  row.Close - row.Open,
+				High:    row.High,
+				Low:     row.Low,
+				Average: row.Average,
+				Count:   row.Count,
+				FirstAt: row.FirstAt,
+				LastAt:  row.LastAt,
+			}
+			if row.Open != 0 {
+				stats.ChangePct = stats.Change / row.Open * 100
+			}
+			exchanges[i].Windows[window.name] = stats
+		}
+	}
+
+	return c.JSON(http.StatusOK, PriceStatsResponse{Coin: coin, AsOf: now, Exchanges: exchanges})
+}
@@ -0,0 +1,473 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/access"
+	"github.com/notblessy/dexlite/metrics"
+	"github.com/notblessy/dexlite/stream"
+	"github.com/notblessy/dexlite/symbols"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// STREAM_SEND_BUFFER is how many prices a client can fall behind before
+	// it is disconnected
+	STREAM_SEND_BUFFER = 256
+
+	STREAM_PING_INTERVAL = 30 * time.Second
+	// STREAM_PONG_WAIT is how long a client can go without answering a ping
+	STREAM_PONG_WAIT  = 60 * time.Second
+	STREAM_WRITE_WAIT = 10 * time.Second
+	// STREAM_MAX_MESSAGE caps the size of one client message in bytes
+	STREAM_MAX_MESSAGE = 4096
+)
+
+// Stream operations a client sends
+const (
+	STREAM_OP_SUBSCRIBE   = "subscribe"
+	STREAM_OP_UNSUBSCRIBE = "unsubscribe"
+)
+
+// StreamRequest changes the coins a connection receives. BandPct, when set
+// with subscribe, replaces the connection's band
+type StreamRequest struct {
+	Op      string   `json:"op"`
+	Coins   []string `json:"coins"`
+	BandPct *float64 `json:"band_pct,omitempty"`
+}
+
+// StreamPrice is a stored price pushed to subscribers of its coin. Seq is
+// sent as since_seq when reconnecting to receive the prices missed meanwhile
+type StreamPrice struct {
+	Type     string    `json:"type"`
+	Seq      uint64    `json:"seq"`
+	Coin     string    `json:"coin"`
+	Exchange string    `json:"exchange"`
+	Price    float64   `json:"price"`
+	Time     time.Time `json:"time"`
+}
+
+// StreamStatus answers every request with the coins now subscribed, or the
+// reason it was rejected. Gap is set on connect when since_seq is too old for
+// every missed price to be replayed
+type StreamStatus struct {
+	Type    string   `json:"type"`
+	Coins   []string `json:"coins"`
+	BandPct float64  `json:"band_pct,omitempty"`
+	Gap     bool     `json:"gap,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// StreamOpportunity is a spread opportunity event. Snapshot marks the open
+// opportunities sent when a client connects
+type StreamOpportunity struct {
+	Type         string    `json:"type"`
+	Event        string    `json:"event"`
+	Snapshot     bool      `json:"snapshot,omitempty"`
+	Coin         string    `json:"coin"`
+	BuyExchange  string    `json:"buy_exchange"`
+	BuyPrice     float64   `json:"buy_price"`
+	SellExchange string    `json:"sell_exchange"`
+	SellPrice    float64   `json:"sell_price"`
+	SpreadBps    float64   `json:"spread_bps"`
+	Time         time.Time `json:"time"`
+}
+
+type StreamHandler struct {
+	hub           *stream.Hub
+	opportunities *stream.Opportunities
+	upgrader      websocket.Upgrader
+}
+
+func NewStreamHandler(hub *stream.Hub) *StreamHandler {
+	return &StreamHandler{
+		hub: hub,
+		upgrader: websocket.Upgrader{
+			// The API is open to every origin, as with CORS
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// SetOpportunities serves the spread opportunities published to opportunities
+func (h *StreamHandler) SetOpportunities(opportunities *stream.Opportunities) {
+	h.opportunities = opportunities
+}
+
+// StreamPrices upgrades to a WebSocket pushing every price as it is stored.
+// Clients send {"op":"subscribe","coins":["BTC"]} or "unsubscribe" to change
+// what they receive and get a status message back each time. With band_pct a
+// venue's price of a coin is only pushed once it moved more than that many
+// percent from the last one pushed, subscribe can change it with "band_pct".
+// Each price carries a seq, a client reconnecting with the last one as
+// since_seq first receives the prices of coins it subscribed to on connect
+// that it missed, if they are still in the hub's replay buffer. The server
+// pings every 30s and drops connections that stop answering or fall behind
+// GET /api/ws/prices?coins=BTC,ETH&sources=&band_pct=0.5&since_seq=N
+func (h *StreamHandler) StreamPrices(c echo.Context) error {
+	var initial []string
+	if value := c.QueryParam("coins"); value != "" {
+		initial = symbols.NormalizeAll(strings.Split(value, ","))
+		if err := checkCoins(c, len(initial)); err != nil {
+			return badRequest(c, err)
+		}
+		if allowed := scopedCoins(c, initial); len(allowed) < len(initial) {
+			return c.JSON(http.StatusForbidden, map[string]string{
+				"error": "some coins are not available to this API key",
+			})
+		}
+	}
+	var bandPct float64
+	if value := c.QueryParam("band_pct"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || !validBand(parsed) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "band_pct must be a non-negative number",
+			})
+		}
+		bandPct = parsed
+	}
+	var resume bool
+	var sinceSeq uint64
+	if value := c.QueryParam("since_seq"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "since_seq must be a non-negative integer",
+			})
+		}
+		resume, sinceSeq = true, parsed
+	}
+	ctx := c.Request().Context()
+	sources := sourcesFilter(c)
+	wanted := func(tick stream.Tick) bool {
+		if len(sources) > 0 && !slices.Contains(sources, tick.Exchange) {
+			return false
+		}
+		return access.Allowed(ctx, tick.Coin)
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// The upgrader has already answered the request
+		return nil
+	}
+	defer conn.Close()
+
+	sub := h.hub.Subscribe(STREAM_SEND_BUFFER)
+	defer h.hub.Unsubscribe(sub)
+	sub.SetBand(bandPct)
+	var missed []stream.Tick
+	complete := true
+	if resume {
+		missed, complete = h.hub.Resume(sub, sinceSeq, initial...)
+	} else {
+		sub.Watch(initial...)
+	}
+
+	metrics.StreamClients.Inc()
+	defer metrics.StreamClients.Dec()
+
+	// Only this goroutine writes, the reader hands it replies. quit stops a
+	// reader still holding a reply once writing has failed
+	replies := make(chan StreamStatus, 8)
+	done := make(chan struct{})
+	quit := make(chan struct{})
+	defer close(quit)
+	go h.read(ctx, conn, sub, limitsOf(c).MaxCoins, replies, done, quit)
+
+	conn.SetWriteDeadline(time.Now().Add(STREAM_WRITE_WAIT))
+	if err := conn.WriteJSON(StreamStatus{Type: STREAM_OP_SUBSCRIBE, Coins: watched(sub), BandPct: sub.Band(), Gap: !complete}); err != nil {
+		return nil
+	}
+	for _, tick := range missed {
+		if !wanted(tick) {
+			continue
+		}
+		conn.SetWriteDeadline(time.Now().Add(STREAM_WRITE_WAIT))
+		if err := conn.WriteJSON(streamPrice(tick)); err != nil {
+			return nil
+		}
+		metrics.StreamReplayedTotal.Inc()
+	}
+
+	ping := time.NewTicker(STREAM_PING_INTERVAL)
+	defer ping.Stop()
+
+	for {
+		var message interface{}
+		select {
+		case <-done:
+			return nil
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(STREAM_WRITE_WAIT)); err != nil {
+				return nil
+			}
+			continue
+		case reply := <-replies:
+			message = reply
+		case tick, ok := <-sub.C():
+			if !ok {
+				metrics.StreamDroppedTotal.Inc()
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too slow, reconnect"),
+					time.Now().Add(STREAM_WRITE_WAIT))
+				return nil
+			}
+			if !wanted(tick) {
+				continue
+			}
+			message = streamPrice(tick)
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(STREAM_WRITE_WAIT))
+		if err := conn.WriteJSON(message); err != nil {
+			return nil
+		}
+	}
+}
+
+// StreamOpportunities upgrades to a WebSocket pushing cross-venue spread
+// opportunities as the spread monitor finds them: open when a coin's spread
+// crosses the alert threshold, update as it changes and close when it ends.
+// The opportunities open at connect time come first, marked as a snapshot.
+// coins limits the stream to some coins and min_bps to opportunities once
+// they reach it, after which their updates and close follow. Client messages
+// are ignored
+// GET /api/ws/opportunities?coins=BTC,ETH&min_bps=
+func (h *StreamHandler) StreamOpportunities(c echo.Context) error {
+	var coins []string
+	if value := c.QueryParam("coins"); value != "" {
+		coins = symbols.NormalizeAll(strings.Split(value, ","))
+		if err := checkCoins(c, len(coins)); err != nil {
+			return badRequest(c, err)
+		}
+		if allowed := scopedCoins(c, coins); len(allowed) < len(coins) {
+			return c.JSON(http.StatusForbidden, map[string]string{
+				"error": "some coins are not available to this API key",
+			})
+		}
+	}
+	var minBps float64
+	if value := c.QueryParam("min_bps"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "min_bps must be a non-negative number",
+			})
+		}
+		minBps = parsed
+	}
+	ctx := c.Request().Context()
+
+	conn, err := h.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// The upgrader has already answered the request
+		return nil
+	}
+	defer conn.Close()
+
+	sub, open := h.opportunities.Subscribe(STREAM_SEND_BUFFER)
+	defer h.opportunities.Unsubscribe(sub)
+
+	metrics.OpportunityStreamClients.Inc()
+	defer metrics.OpportunityStreamClients.Dec()
+
+	done := make(chan struct{})
+	go discard(conn, done)
+
+	// Coins whose open event was sent, so their close is sent too
+	sent := make(map[string]bool)
+	wanted := func(opportunity stream.Opportunity) bool {
+		if len(coins) > 0 && !slices.Contains(coins, opportunity.Coin) {
+			return false
+		}
+		if !access.Allowed(ctx, opportunity.Coin) {
+			return false
+		}
+		if sent[opportunity.Coin] {
+			if opportunity.Event == stream.OPPORTUNITY_CLOSE {
+				delete(sent, opportunity.Coin)
+			}
+			return true
+		}
+		if opportunity.Event == stream.OPPORTUNITY_CLOSE || opportunity.SpreadBps < minBps {
+			return false
+		}
+		sent[opportunity.Coin] = true
+		return true
+	}
+
+	for _, opportunity := range open {
+		if !wanted(opportunity) {
+			continue
+		}
+		message := streamOpportunity(opportunity)
+		message.Snapshot = true
+		conn.SetWriteDeadline(time.Now().Add(STREAM_WRITE_WAIT))
+		if err := conn.WriteJSON(message); err != nil {
+			return nil
+		}
+	}
+
+	ping := time.NewTicker(STREAM_PING_INTERVAL)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(STREAM_WRITE_WAIT)); err != nil {
+				return nil
+			}
+		case opportunity, ok := <-sub.C():
+			if !ok {
+				metrics.StreamDroppedTotal.Inc()
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too slow, reconnect"),
+					time.Now().Add(STREAM_WRITE_WAIT))
+				return nil
+			}
+			if !wanted(opportunity) {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(STREAM_WRITE_WAIT))
+			if err := conn.WriteJSON(streamOpportunity(opportunity)); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+func streamPrice(tick stream.Tick) StreamPrice {
+	return StreamPrice{
+		Type:     "price",
+		Seq:      tick.Seq,
+		Coin:     tick.Coin,
+		Exchange: tick.Exchange,
+		Price:    tick.Price,
+		Time:     tick.CreatedAt,
+	}
+}
+
+func streamOpportunity(opportunity stream.Opportunity) StreamOpportunity {
+	return StreamOpportunity{
+		Type:         "opportunity",
+		Event:        opportunity.Event,
+		Coin:         opportunity.Coin,
+		BuyExchange:  opportunity.BuyExchange,
+		BuyPrice:     opportunity.BuyPrice,
+		SellExchange: opportunity.SellExchange,
+		SellPrice:    opportunity.SellPrice,
+		SpreadBps:    opportunity.SpreadBps,
+		Time:         opportunity.At,
+	}
+}
+
+// discard reads and drops client messages, answering pings, until the
+// connection fails or stops answering pings, then closes done
+func discard(conn *websocket.Conn, done chan struct{}) {
+	defer close(done)
+
+	conn.SetReadLimit(STREAM_MAX_MESSAGE)
+	conn.SetReadDeadline(time.Now().Add(STREAM_PONG_WAIT))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(STREAM_PONG_WAIT))
+	})
+
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Debug().Err(err).Msg("Opportunity stream client disconnected")
+			}
+			return
+		}
+	}
+}
+
+// read applies the client's requests to sub until the connection fails or
+// stops answering pings, then closes done. It holds sub to maxCoins coins
+// within the scope of ctx
+func (h *StreamHandler) read(ctx context.Context, conn *websocket.Conn, sub *stream.Subscriber, maxCoins int, replies chan<- StreamStatus, done, quit chan struct{}) {
+	defer close(done)
+
+	conn.SetReadLimit(STREAM_MAX_MESSAGE)
+	conn.SetReadDeadline(time.Now().Add(STREAM_PONG_WAIT))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(STREAM_PONG_WAIT))
+	})
+
+	for {
+		var request StreamRequest
+		if err := conn.ReadJSON(&request); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Debug().Err(err).Msg("Price stream client disconnected")
+			}
+			return
+		}
+
+		coins := symbols.NormalizeAll(request.Coins)
+		status := StreamStatus{Type: request.Op}
+		switch request.Op {
+		case STREAM_OP_SUBSCRIBE:
+			if total := len(watchedWith(sub, coins)); total > maxCoins {
+				status.Error = limitErrorf("subscription would hold %d coins, over the maximum of %d", total, maxCoins).Error()
+				break
+			}
+			if slices.ContainsFunc(coins, func(coin string) bool { return !access.Allowed(ctx, coin) }) {
+				status.Error = "some coins are not available to this API key"
+				break
+			}
+			if request.BandPct != nil && !validBand(*request.BandPct) {
+				status.Error = "band_pct must be a non-negative number"
+				break
+			}
+			sub.Watch(coins...)
+			if request.BandPct != nil {
+				sub.SetBand(*request.BandPct)
+			}
+		case STREAM_OP_UNSUBSCRIBE:
+			sub.Unwatch(coins...)
+		default:
+			status.Type = "error"
+			status.Error = `op must be "subscribe" or "unsubscribe"`
+		}
+		status.Coins = watched(sub)
+		status.BandPct = sub.Band()
+
+		select {
+		case replies <- status:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// validBand reports whether pct can be a price stream band
+func validBand(pct float64) bool {
+	return pct >= 0 && !math.IsInf(pct, 0)
+}
+
+// watched returns the coins sub watches, sorted
+func watched(sub *stream.Subscriber) []string {
+	coins := sub.Coins()
+	slices.Sort(coins)
+	return coins
+}
+
+// watchedWith returns what sub would watch after adding coins
+func watchedWith(sub *stream.Subscriber, coins []string) []string {
+	all := append(sub.Coins(), coins...)
+	slices.Sort(all)
+	return slices.Compact(all)
+}
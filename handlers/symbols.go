@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/symbols"
+)
+
+// SymbolResolver resolves a symbol an exchange lists a coin under, e.g.
+// BTCUSDT, to the coin
+type SymbolResolver interface {
+	Resolve(symbol string) (string, bool)
+}
+
+// NormalizeCoin rewrites the :coin path parameter to its canonical symbol so
+// handlers always query the same series regardless of how the client spelled it.
+// Exchange-native symbols are resolved through natives, which may be nil
+func NormalizeCoin(natives SymbolResolver) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			names := c.ParamNames()
+			values := c.ParamValues()
+
+			for i, name := range names {
+				if name != "coin" || i >= len(values) {
+					continue
+				}
+				if natives != nil {
+					if coin, ok := natives.Resolve(values[i]); ok {
+						values[i] = coin
+						continue
+					}
+				}
+				values[i] = symbols.Normalize(values[i])
+			}
+			c.SetParamValues(values...)
+
+			return next(c)
+		}
+	}
+}
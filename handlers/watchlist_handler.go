@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/services"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// DEFAULT_WATCHLIST_MAX_COINS caps a watchlist when no cap is configured
+const DEFAULT_WATCHLIST_MAX_COINS = 50
+
+// LISTED_COINS_TTL is how long the primary source's coin list is reused to
+// validate watchlisted coins
+const LISTED_COINS_TTL = 5 * time.Minute
+
+// WatchlistHandler manages the signed in user's watchlist. Every watchlisted
+// coin is collected by the price fetcher, so only coins listed on the primary
+// source can be added
+type WatchlistHandler struct {
+	db       *gorm.DB
+	maxCoins int
+	primary  services.PriceSource
+
+	mu       sync.Mutex
+	listed   map[string]float64
+	listedAt time.Time
+}
+
+// NewWatchlistHandler creates a handler holding each watchlist to maxCoins
+// coins and quoting prices from the primary source
+func NewWatchlistHandler(db *gorm.DB, maxCoins int, primary services.PriceSource) *WatchlistHandler {
+	if maxCoins <= 0 {
+		maxCoins = DEFAULT_WATCHLIST_MAX_COINS
+	}
+	return &WatchlistHandler{
+		db:       db,
+		maxCoins: maxCoins,
+		primary:  primary,
+	}
+}
+
+// WatchlistEntry is a watchlisted coin with its latest price on the primary
+// source, null until one is stored
+type WatchlistEntry struct {
+	Coin     string     `json:"coin"`
+	AddedAt  time.Time  `json:"added_at"`
+	Exchange string     `json:"exchange"`
+	Price    *float64   `json:"price"`
+	PriceAt  *time.Time `json:"price_at"`
+}
+
+type WatchlistResponse struct {
+	Coins []WatchlistEntry `json:"coins"`
+}
+
+// WatchlistRequest replaces the whole watchlist
+type WatchlistRequest struct {
+	Coins []string `json:"coins"`
+}
+
+// WatchlistCoinRequest adds one coin
+type WatchlistCoinRequest struct {
+	Coin string `json:"coin"`
+}
+
+// GetWatchlist lists the user's coins in the order they were added
+// GET /api/watchlist
+func (h *WatchlistHandler) GetWatchlist(c echo.Context) error {
+	return h.respond(c, http.StatusOK)
+}
+
+// ReplaceWatchlist sets the user's coins to exactly those requested
+// PUT /api/watchlist
+func (h *WatchlistHandler) ReplaceWatchlist(c echo.Context) error {
+	var req WatchlistRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	coins := make([]string, 0, len(req.Coins))
+	seen := make(map[string]bool, len(req.Coins))
+	for _, raw := range req.Coins {
+		coin, err := normalizeTrackedCoin(raw)
+		if err != nil {
+			return badRequest(c, err)
+		}
+		if !seen[coin] {
+			seen[coin] = true
+			coins = append(coins, coin)
+		}
+	}
+	if len(coins) > h.maxCoins {
+		return badRequest(c, limitErrorf("a watchlist holds at most %d coins", h.maxCoins))
+	}
+	if unlisted, err := h.unlisted(coins); err != nil {
+		log.Error().Err(err).Msg("Error listing primary source prices")
+		return c.JSON(http.StatusBadGateway, map[string]string{
+			"error": "failed to list coins on the primary source",
+		})
+	} else if unlisted != "" {
+		return badRequest(c, fmt.Errorf("coin %s is not listed on %s", unlisted, h.primary.Name()))
+	}
+
+	userID := userOf(c)
+	err := h.db.WithContext(c.Request().Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.WatchlistCoin{}).Error; err != nil {
+			return err
+		}
+		if len(coins) == 0 {
+			return nil
+		}
+		rows := make([]models.WatchlistCoin, len(coins))
+		for i, coin := range coins {
+			rows[i] = models.WatchlistCoin{UserID: userID, Coin: coin}
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to save watchlist",
+		})
+	}
+
+	return h.respond(c, http.StatusOK)
+}
+
+// AddWatchlistCoin adds a coin to the user's watchlist
+// POST /api/watchlist
+func (h *WatchlistHandler) AddWatchlistCoin(c echo.Context) error {
+	var req WatchlistCoinRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	coin, err := normalizeTrackedCoin(req.Coin)
+	if err != nil {
+		return badRequest(c, err)
+	}
+	if unlisted, err := h.unlisted([]string{coin}); err != nil {
+		log.Error().Err(err).Msg("Error listing primary source prices")
+		return c.JSON(http.StatusBadGateway, map[string]string{
+			"error": "failed to list coins on the primary source",
+		})
+	} else if unlisted != "" {
+		return badRequest(c, fmt.Errorf("coin %s is not listed on %s", unlisted, h.primary.Name()))
+	}
+
+	userID := userOf(c)
+	ctx := c.Request().Context()
+	var coins []string
+	if err := h.db.WithContext(ctx).Model(&models.WatchlistCoin{}).Where("user_id = ?", userID).Pluck("coin", &coins).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch watchlist",
+		})
+	}
+	for _, existing := range coins {
+		if existing == coin {
+			return c.JSON(http.StatusConflict, map[string]string{
+				"error": "coin is already on the watchlist",
+			})
+		}
+	}
+	if len(coins) >= h.maxCoins {
+		return badRequest(c, limitErrorf("a watchlist holds at most %d coins", h.maxCoins))
+	}
+
+	if err := h.db.WithContext(ctx).Create(&models.WatchlistCoin{UserID: userID, Coin: coin}).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to add coin",
+		})
+	}
+
+	return h.respond(c, http.StatusCreated)
+}
+
+// RemoveWatchlistCoin removes a coin from the user's watchlist. The fetcher
+// keeps collecting it while it is tracked or on another watchlist
+// DELETE /api/watchlist/:coin
+func (h *WatchlistHandler) RemoveWatchlistCoin(c echo.Context) error {
+	result := h.db.WithContext(c.Request().Context()).
+		Where("user_id = ? AND coin = ?", userOf(c), c.Param("coin")).
+		Delete(&models.WatchlistCoin{})
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to remove coin",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "coin is not on the watchlist",
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// unlisted returns the first coin not listed on the primary source, empty
+// when all are. Coins aren't checked when the source can't list them all
+func (h *WatchlistHandler) unlisted(coins []string) (string, error) {
+	batch, ok := h.primary.(services.BatchSource)
+	if !ok || len(coins) == 0 {
+		return "", nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.listed == nil || time.Since(h.listedAt) > LISTED_COINS_TTL {
+		prices, err := batch.GetAllPrices()
+		if prices == nil {
+			if err == nil {
+				err = errors.New("no coins listed")
+			}
+			return "", err
+		}
+		h.listed = prices
+		h.listedAt = time.Now()
+	}
+
+	for _, coin := range coins {
+		if !isListed(h.listed, coin) {
+			return coin, nil
+		}
+	}
+	return "", nil
+}
+
+// respond writes the user's watchlist with the latest primary price of each
+// coin
+func (h *WatchlistHandler) respond(c echo.Context, status int) error {
+	ctx := c.Request().Context()
+
+	var rows []models.WatchlistCoin
+	if err := h.db.WithContext(ctx).Where("user_id = ?", userOf(c)).Order("created_at ASC, id ASC").Find(&rows).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to fetch watchlist",
+		})
+	}
+
+	coins := make([]string, len(rows))
+	for i, row := range rows {
+		coins[i] = row.Coin
+	}
+
+	latest := make(map[string]models.CoinPrice, len(coins))
+	if len(coins) > 0 {
+		var prices []models.CoinPrice
+		query := h.db.WithContext(ctx).Model(&models.CoinPrice{}).Where("coin IN ? AND exchange = ?", coins, h.primary.Name())
+		err := db.LatestPer(query, "coin").Find(&prices).Error
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to fetch latest prices",
+			})
+		}
+		for _, price := range prices {
+			latest[price.Coin] = price
+		}
+	}
+
+	entries := make([]WatchlistEntry, len(rows))
+	for i, row := range rows {
+		entries[i] = WatchlistEntry{
+			Coin:     row.Coin,
+			AddedAt:  row.CreatedAt,
+			Exchange: h.primary.Name(),
+		}
+		if price, ok := latest[row.Coin]; ok {
+			entries[i].Price = &price.Price
+			entries[i].PriceAt = &price.CreatedAt
+		}
+	}
+
+	return c.JSON(status, WatchlistResponse{Coins: entries})
+}
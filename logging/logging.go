@@ -0,0 +1,75 @@
+// Package logging configures the global zerolog logger used across dexlite
+package logging
+
+import (
+	"fmt"
+	stdlog "log"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Output formats accepted by Setup
+const (
+	FORMAT_JSON    = "json"
+	FORMAT_CONSOLE = "console"
+)
+
+// Setup sets the global log level and output format. Output from libraries
+// using the standard log package is routed through the same logger
+func Setup(level, format string) error {
+	parsed, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+	zerolog.SetGlobalLevel(parsed)
+	zerolog.DurationFieldUnit = time.Millisecond
+
+	switch format {
+	case FORMAT_JSON:
+		log.Logger = zerolog.New(os.Stderr).With().Timestamp().Logger()
+	case FORMAT_CONSOLE:
+		log.Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).With().Timestamp().Logger()
+	default:
+		return fmt.Errorf("invalid log format %q, expected json or console", format)
+	}
+
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(log.Logger)
+
+	return nil
+}
+
+// RequestLogger logs one line per HTTP request with its route and timing
+func RequestLogger() echo.MiddlewareFunc {
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		LogMethod:    true,
+		LogURI:       true,
+		LogRoutePath: true,
+		LogStatus:    true,
+		LogLatency:   true,
+		LogRemoteIP:  true,
+		LogError:     true,
+		HandleError:  true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			event := log.Info()
+			if v.Error != nil {
+				event = log.Error().Err(v.Error)
+			}
+
+			event.
+				Str("method", v.Method).
+				Str("uri", v.URI).
+				Str("route", v.RoutePath).
+				Int("status", v.Status).
+				Dur("duration", v.Latency).
+				Str("remote_ip", v.RemoteIP).
+				Msg("request")
+			return nil
+		},
+	})
+}
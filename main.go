@@ -2,142 +2,285 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"net/http"
 	"os"
-	"os/signal"
-	"sync"
-	"syscall"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
-	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
+	"github.com/notblessy/dexlite/config"
 	"github.com/notblessy/dexlite/db"
-	"github.com/notblessy/dexlite/handlers"
+	"github.com/notblessy/dexlite/logging"
 	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/secrets"
+	"github.com/notblessy/dexlite/services"
+	"github.com/notblessy/dexlite/symbols"
 	"github.com/notblessy/dexlite/workers"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
 )
 
 func init() {
 	err := godotenv.Load()
 	if err != nil {
-		log.Printf("Warning: Error loading .env file: %v", err)
+		log.Warn().Err(err).Msg("Error loading .env file")
 	}
 }
 
 func main() {
-	// Initialize database
-	database := db.NewPostgres()
-
-	// Auto-migrate the schema
-	if err := database.AutoMigrate(&models.CoinPrice{}); err != nil {
-		log.Fatalf("Failed to migrate database: %v", err)
-	}
-
-	log.Println("Database initialized and migrated successfully")
-
-	// Create context for graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Create workers
-	priceFetcher := workers.NewPriceFetcher(database)
-	cleanupWorker := workers.NewCleanupWorker(database)
-
-	// Fetch initial prices synchronously before starting background workers
-	log.Println("Fetching initial coin prices...")
-	priceFetcher.FetchPrices()
-
-	// WaitGroup to wait for all workers to finish
-	var wg sync.WaitGroup
-
-	// Start workers in separate goroutines
-	wg.Add(2)
-	go func() {
-		defer wg.Done()
-		priceFetcher.Start(ctx)
-	}()
-	go func() {
-		defer wg.Done()
-		cleanupWorker.Start(ctx)
-	}()
-
-	log.Println("Workers started successfully")
-	log.Println("Price fetcher running every hour")
-	log.Println("Cleanup worker running every hour")
-
-	// Setup HTTP server with Echo
-	e := echo.New()
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
-	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept},
-	}))
-
-	// Initialize handlers
-	priceHandler := handlers.NewPriceHandler(database)
-
-	// Setup routes
-	api := e.Group("/api")
-	api.GET("/prices/:coin", priceHandler.GetPriceComparison)
-
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	// Start HTTP server in a goroutine
-	server := &http.Server{
-		Addr:    fmt.Sprintf(":%s", port),
-		Handler: e,
-	}
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		log.Printf("HTTP server starting on port %s", port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("HTTP server error: %v", err)
+	os.Exit(execute(os.Args[1:]))
+}
+
+// persistent annotates commands that work on stored data and can't run on
+// the memory driver
+var persistent = map[string]string{"persistent": "true"}
+
+// exitCode ends a command with a status other than 0, once it reported why
+type exitCode int
+
+func (c exitCode) Error() string {
+	return fmt.Sprintf("exit status %d", int(c))
+}
+
+// exit turns the status a command returns into the error cobra expects
+func exit(code int) error {
+	if code == 0 {
+		return nil
+	}
+	return exitCode(code)
+}
+
+// execute runs the command args name, serve when they name none, and returns
+// the process's exit status
+func execute(args []string) int {
+	// doctor reports an invalid configuration itself, the other commands stop
+	// on it. Until then flag defaults come from the default configuration
+	cfg, cfgErr := config.Load()
+	if cfgErr != nil {
+		cfg = config.Default()
+	}
+
+	root := newRootCommand(cfg, cfgErr)
+	root.SetArgs(args)
+	err := root.Execute()
+
+	var code exitCode
+	switch {
+	case errors.As(err, &code):
+		return int(code)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "dexlite: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// groupOnly fails a command that only groups others when it is run without
+// one of them
+func groupOnly(cmd *cobra.Command, args []string) error {
+	return fmt.Errorf("%s needs a command, see %s --help", cmd.Name(), cmd.CommandPath())
+}
+
+// newRootCommand builds dexlite and its subcommands. Run without one, it
+// serves
+func newRootCommand(cfg *config.Config, cfgErr error) *cobra.Command {
+	root := &cobra.Command{
+		Use:           "dexlite",
+		Short:         "DEX price collector and API",
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		CompletionOptions: cobra.CompletionOptions{
+			DisableDefaultCmd: true,
+		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if cfgErr != nil {
+				log.Fatal().Err(cfgErr).Msg("Failed to load configuration")
+			}
+			if err := logging.Setup(cfg.Log.Level, cfg.Log.Format); err != nil {
+				log.Fatal().Err(err).Msg("Failed to configure logging")
+			}
+			for parent := cmd; parent != nil; parent = parent.Parent() {
+				if parent.Annotations["persistent"] != "" && cfg.Database.Driver == db.DRIVER_MEMORY {
+					return fmt.Errorf("%s needs a persistent database, not the memory driver", parent.Name())
+				}
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exit(runServe(cfg))
+		},
+	}
+
+	root.AddCommand(
+		newServeCommand(cfg),
+		newFetchCommand(cfg),
+		newBackfillCommand(cfg),
+		newMigrateCommand(cfg),
+		newCleanupCommand(cfg),
+		newVerifyCommand(cfg),
+		newStorageCommand(cfg),
+		newFixturesCommand(cfg),
+		newDoctorCommand(),
+	)
+	return root
+}
+
+// openDatabase opens the configured database, with its series bounded to
+// the configured capacity on the memory driver
+func openDatabase(cfg *config.Config) *gorm.DB {
+	database := db.New(cfg.Database.Driver, cfg.Database.DSN)
+	if cfg.Database.Driver == db.DRIVER_MEMORY {
+		if err := db.BoundSeries(database, cfg.Database.MemoryCapacity); err != nil {
+			log.Fatal().Err(err).Msg("Failed to bound in-memory series")
 		}
-	}()
+		log.Info().Int("capacity", cfg.Database.MemoryCapacity).Msg("Keeping data in memory only, nothing is persisted")
+	}
+	return database
+}
 
-	// Wait for interrupt signal to gracefully shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
+// prepareSchema applies pending migrations, or with auto_migrate off exits
+// when there are any. An in-memory database starts empty and is always
+// migrated. Migrating waits for the workers of other processes to finish
+// their writes
+func prepareSchema(cfg *config.Config, database *gorm.DB) {
+	if cfg.Database.AutoMigrate || cfg.Database.Driver == db.DRIVER_MEMORY {
+		if err := db.MigrateWithGate(database, db.NewWriteGate(database)); err != nil {
+			log.Fatal().Err(err).Msg("Failed to migrate database")
+		}
+		return
+	}
 
-	log.Println("Shutdown signal received, initiating graceful shutdown...")
+	states, err := db.MigrationStates(database)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to read schema migrations")
+	}
+	var pending []string
+	for _, state := range states {
+		if state.AppliedAt == nil {
+			pending = append(pending, state.ID)
+		}
+	}
+	if len(pending) > 0 {
+		log.Fatal().Strs("pending", pending).Msg("Schema has pending migrations, run `dexlite migrate up`")
+	}
+}
 
-	// Cancel context to signal workers to stop
-	cancel()
+// newSecretStore returns the configured secret store, nil when credentials
+// come from the config file only
+func newSecretStore(cfg *config.Config) secrets.Store {
+	switch cfg.Secrets.Provider {
+	case secrets.PROVIDER_VAULT:
+		return secrets.NewVaultStore(cfg.Secrets.Vault.Address, cfg.Secrets.Vault.Token, cfg.Secrets.Vault.Path)
+	case secrets.PROVIDER_AWS:
+		return secrets.NewAWSStore(cfg.Secrets.AWS.Region, cfg.Secrets.AWS.SecretID)
+	}
+	return nil
+}
 
-	// Shutdown HTTP server
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer shutdownCancel()
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("HTTP server shutdown error: %v", err)
-	} else {
-		log.Println("HTTP server stopped successfully")
+// applySecrets overrides the source credentials in cfg with those in store
+func applySecrets(ctx context.Context, store secrets.Store, cfg *config.Config) error {
+	values, err := store.Fetch(ctx)
+	if err != nil {
+		return err
+	}
+	if apiKey, ok := values[services.SECRET_COINGECKO_API_KEY]; ok {
+		cfg.Exchanges.CoinGecko.APIKey = apiKey
+	}
+	if rpcURL, ok := values[services.SECRET_CHAINLINK_RPC_URL]; ok {
+		cfg.Exchanges.Chainlink.RPCURL = rpcURL
 	}
+	if cfg.ExchangeEnabled(services.CHAINLINK_NAME) && cfg.Exchanges.Chainlink.RPCURL == "" {
+		return fmt.Errorf("%s is required when chainlink is enabled", services.SECRET_CHAINLINK_RPC_URL)
+	}
+	return nil
+}
 
-	// Wait for workers to finish with timeout
-	done := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
+// newSessions anchors daily, weekly and monthly bars to the configured
+// session boundary
+func newSessions(cfg *config.Config) (*models.Sessions, error) {
+	zone, err := time.LoadLocation(cfg.Fetcher.SessionTimezone)
+	if err != nil {
+		return nil, err
+	}
+	return models.NewSessions(zone, cfg.Fetcher.SessionDayStart), nil
+}
+
+// newRetentionRules converts the retention rules in config, normalizing coins
+func newRetentionRules(cfg *config.Config) []workers.RetentionRule {
+	rules := make([]workers.RetentionRule, 0, len(cfg.Retention.Rules))
+	for _, rule := range cfg.Retention.Rules {
+		rules = append(rules, workers.RetentionRule{
+			Table:    rule.Table,
+			Coin:     symbols.Normalize(rule.Coin),
+			Interval: rule.Interval,
+			Keep:     rule.Keep,
+		})
+	}
+	return rules
+}
+
+// newCleanupWorker creates the cleanup worker with the configured schedule,
+// rules and, when on, downsampling into sessions
+func newCleanupWorker(cfg *config.Config, database *gorm.DB, gate *db.WriteGate, rules []workers.RetentionRule, sessions *models.Sessions) *workers.CleanupWorker {
+	cleanup := workers.NewCleanupWorker(database, gate, cfg.Retention.RawPrices, cfg.Retention.CleanupInterval)
+	cleanup.SetSchedule(workers.CleanupSchedule{
+		MinInterval:  cfg.Retention.CleanupMinInterval,
+		MaxInterval:  cfg.Retention.CleanupMaxInterval,
+		MaxBatchSize: cfg.Retention.CleanupBatchSize,
+		MaxBloatPct:  cfg.Retention.CleanupMaxBloatPct,
+	})
+	cleanup.SetRules(rules)
+	if cfg.Retention.Downsample {
+		cleanup.SetDownsampling(sessions)
+	}
+	return cleanup
+}
+
+// newRegistry creates the enabled price sources in configured priority order
+func newRegistry(cfg *config.Config) (*services.Registry, error) {
+	registry := services.NewRegistry()
+
+	for _, name := range cfg.Exchanges.Enabled {
+		switch name {
+		case services.HYPERLIQUID_NAME:
+			registry.Register(services.NewHyperLiquidClient())
+		case services.BINANCE_NAME:
+			registry.Register(services.NewBinanceClient())
+		case services.COINBASE_NAME:
+			registry.Register(services.NewCoinbaseClient())
+		case services.DYDX_NAME:
+			registry.Register(services.NewDydxClient())
+		case services.PYTH_NAME:
+			registry.Register(services.NewPythClient())
+		case "gmx_" + services.GMX_ARBITRUM, "gmx_" + services.GMX_AVALANCHE:
+			gmx, err := services.NewGMXClient(strings.TrimPrefix(name, "gmx_"))
+			if err != nil {
+				return nil, err
+			}
+			registry.Register(gmx)
+		case services.CHAINLINK_NAME:
+			// Chainlink reference prices need an Ethereum RPC endpoint
+			chainlink, err := services.NewChainlinkClient(cfg.Exchanges.Chainlink.RPCURL, cfg.Exchanges.Chainlink.Feeds)
+			if err != nil {
+				return nil, err
+			}
+			registry.Register(chainlink)
+		default:
+			return nil, fmt.Errorf("unknown exchange %q", name)
+		}
+	}
 
-	select {
-	case <-done:
-		log.Println("All workers stopped successfully")
-	case <-time.After(30 * time.Second):
-		log.Println("Timeout waiting for workers to stop, forcing shutdown")
+	// CoinGecko fills in for coins the primary source fails to price
+	if cfg.Exchanges.CoinGecko.Enabled {
+		registry.SetFallback(services.NewCoinGeckoClient(
+			cfg.Exchanges.CoinGecko.APIKey,
+			cfg.Exchanges.CoinGecko.Pro,
+			cfg.Exchanges.CoinGecko.RatePerMinute,
+		))
 	}
 
-	log.Println("Application shutdown complete")
+	return registry, nil
 }
@@ -0,0 +1,292 @@
+// Package metrics defines the Prometheus metrics exported on /metrics
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Fetch results as recorded in FetchesTotal
+const (
+	RESULT_SUCCESS = "success"
+	RESULT_FAILURE = "failure"
+)
+
+// Buffers as recorded in WSBufferBytes
+const (
+	BUFFER_PENDING = "pending"
+)
+
+// Outcomes of copied prices as recorded in ClickHouseTicksTotal and
+// MirroredPricesTotal
+const (
+	TICKS_STORED  = "stored"
+	TICKS_DROPPED = "dropped"
+)
+
+var (
+	// FetchesTotal counts fetches per source. A fetch that returned only some
+	// of the requested coins counts as a failure
+	FetchesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexlite_fetches_total",
+		Help: "Price fetches per exchange by result.",
+	}, []string{"exchange", "result"})
+
+	FetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dexlite_fetch_duration_seconds",
+		Help:    "Time taken to fetch prices from an exchange.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"exchange"})
+
+	// InsertErrorsTotal counts price inserts that failed after every retry
+	InsertErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dexlite_db_insert_errors_total",
+		Help: "Price inserts that failed, after retries when transient, and were dead-lettered.",
+	})
+
+	// RejectedInsertsTotal counts prices the database refused as invalid
+	RejectedInsertsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dexlite_db_rejected_inserts_total",
+		Help: "Prices the database rejected as invalid, dead-lettered while the rest of their batch was stored.",
+	})
+
+	// RejectedPricesTotal counts fetched prices that failed the sanity check
+	// and were never stored
+	RejectedPricesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexlite_rejected_prices_total",
+		Help: "Fetched prices rejected as implausible before insertion, by exchange and reason.",
+	}, []string{"exchange", "reason"})
+
+	// SpreadBps is the latest widest cross-venue spread per coin
+	SpreadBps = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dexlite_spread_bps",
+		Help: "Widest spread between venues' latest prices, in basis points.",
+	}, []string{"coin"})
+
+	// WSBufferBytes is the compressed size of ticks the WebSocket ingestor
+	// holds in memory, by buffer
+	WSBufferBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dexlite_ws_buffer_bytes",
+		Help: "Compressed bytes of streamed ticks held in memory, pending a flush.",
+	}, []string{"buffer"})
+
+	// StreamClients is how many clients are connected to the price stream
+	StreamClients = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dexlite_stream_clients",
+		Help: "Clients connected to the WebSocket price stream.",
+	})
+
+	// OpportunityStreamClients is how many clients are connected to the
+	// spread opportunity stream
+	OpportunityStreamClients = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dexlite_opportunity_stream_clients",
+		Help: "Clients connected to the WebSocket spread opportunity stream.",
+	})
+
+	StreamDroppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dexlite_stream_dropped_total",
+		Help: "Price and opportunity stream clients disconnected for falling behind.",
+	})
+
+	// StreamBandHeldTotal counts prices not pushed to a price stream client
+	// because they stayed within its band
+	StreamBandHeldTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dexlite_stream_band_held_total",
+		Help: "Prices held back from price stream clients for staying within their band.",
+	})
+
+	// StreamReplayedTotal counts prices replayed to price stream clients
+	// resuming after a disconnect
+	StreamReplayedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dexlite_stream_replayed_total",
+		Help: "Prices replayed to price stream clients resuming with since_seq.",
+	})
+
+	// RateLimitedTotal counts requests answered 429, by route group
+	RateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexlite_rate_limited_total",
+		Help: "API requests rejected for exceeding the rate limit.",
+	}, []string{"group"})
+
+	RateLimitErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dexlite_rate_limit_errors_total",
+		Help: "Rate limit checks that failed and let the request through.",
+	})
+
+	// CacheRequestsTotal counts Redis cache lookups of read endpoints by
+	// result: hit, miss or error
+	CacheRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexlite_cache_requests_total",
+		Help: "Response cache lookups by endpoint and result.",
+	}, []string{"endpoint", "result"})
+
+	// JobsTotal counts finished background jobs by kind and status
+	JobsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexlite_jobs_total",
+		Help: "Background jobs finished, by kind and status.",
+	}, []string{"kind", "status"})
+
+	// IndexSources is how many fresh venues the latest index price of a coin
+	// was computed from
+	IndexSources = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dexlite_index_sources",
+		Help: "Fresh venues behind the latest index price.",
+	}, []string{"coin"})
+
+	// IndexDegraded is 1 while a coin's index price is below its source quorum
+	IndexDegraded = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dexlite_index_degraded",
+		Help: "Whether the latest index price missed the quorum of fresh sources.",
+	}, []string{"coin"})
+
+	// MarkDivergenceBps is how far a perpetual's latest mark price is above its
+	// oracle price, negative below
+	MarkDivergenceBps = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dexlite_mark_divergence_bps",
+		Help: "Latest mark price minus oracle price, in basis points of the oracle.",
+	}, []string{"coin", "exchange"})
+
+	// SourceQualityScore is each source's quality score over the ranking window
+	SourceQualityScore = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dexlite_source_quality_score",
+		Help: "Source quality from 0 to 100 combining latency, uptime, staleness and outliers.",
+	}, []string{"exchange"})
+
+	MarkDivergencesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexlite_mark_divergences_total",
+		Help: "Mark prices stored further from the oracle than the divergence threshold.",
+	}, []string{"coin", "exchange"})
+
+	SpreadAlertsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexlite_spread_alerts_total",
+		Help: "Spreads flagged above the alert threshold.",
+	}, []string{"coin"})
+
+	PriceAlertsFiredTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexlite_price_alerts_fired_total",
+		Help: "Price alert webhooks delivered, by coin and condition.",
+	}, []string{"coin", "condition"})
+
+	NotificationFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexlite_notification_failures_total",
+		Help: "Fired alerts a notifier failed to deliver.",
+	}, []string{"notifier"})
+
+	RowsCleanedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexlite_rows_cleaned_total",
+		Help: "Rows deleted by the cleanup worker by series.",
+	}, []string{"table"})
+
+	// ClickHouseTicksTotal counts ticks written to ClickHouse, and those
+	// dropped after queueing too long while it was unreachable
+	ClickHouseTicksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexlite_clickhouse_ticks_total",
+		Help: "Streamed ticks sent to ClickHouse by outcome.",
+	}, []string{"outcome"})
+
+	// MirroredPricesTotal counts prices dual-written to a storage migration
+	// target, and those dropped after queueing too long
+	MirroredPricesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexlite_mirrored_prices_total",
+		Help: "Prices dual-written to the storage migration target by outcome.",
+	}, []string{"outcome"})
+
+	CleanupTableRows = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dexlite_cleanup_table_rows",
+		Help: "Live price rows as last measured by the cleanup worker.",
+	})
+
+	CleanupIntervalSeconds = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dexlite_cleanup_interval_seconds",
+		Help: "Delay the cleanup worker picked before its next run.",
+	})
+
+	CleanupBatchSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dexlite_cleanup_batch_size",
+		Help: "Rows per delete statement the cleanup worker will use next.",
+	})
+
+	// Exchange client transport metrics, gathered with httptrace
+	ExchangeConnectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexlite_exchange_connections_total",
+		Help: "Connections used for exchange requests, by whether they were reused.",
+	}, []string{"exchange", "reused"})
+
+	ExchangeDNSDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dexlite_exchange_dns_seconds",
+		Help:    "DNS lookup time for exchange requests on new connections.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 12),
+	}, []string{"exchange"})
+
+	ExchangeConnectDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dexlite_exchange_connect_seconds",
+		Help:    "TCP connect time for exchange requests on new connections.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 12),
+	}, []string{"exchange"})
+
+	ExchangeTLSDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dexlite_exchange_tls_handshake_seconds",
+		Help:    "TLS handshake time for exchange requests on new connections.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 12),
+	}, []string{"exchange"})
+
+	ExchangeFirstByteDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dexlite_exchange_first_byte_seconds",
+		Help:    "Time from sending an exchange request to the first response byte.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"exchange"})
+
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexlite_http_requests_total",
+		Help: "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dexlite_http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// ObserveFetch records one fetch from exchange that started at startedAt
+func ObserveFetch(exchange string, startedAt time.Time, err error) {
+	FetchDuration.WithLabelValues(exchange).Observe(time.Since(startedAt).Seconds())
+
+	result := RESULT_SUCCESS
+	if err != nil {
+		result = RESULT_FAILURE
+	}
+	FetchesTotal.WithLabelValues(exchange, result).Inc()
+}
+
+// HTTPMiddleware records request counts and latency. Requests are labelled
+// by route pattern, not path, to keep coin symbols out of label values
+func HTTPMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			startedAt := time.Now()
+
+			err := next(c)
+			if err != nil {
+				// Let echo write the error response so the status is final
+				c.Error(err)
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			method := c.Request().Method
+			status := strconv.Itoa(c.Response().Status)
+
+			HTTPRequestsTotal.WithLabelValues(method, route, status).Inc()
+			HTTPRequestDuration.WithLabelValues(method, route).Observe(time.Since(startedAt).Seconds())
+
+			return nil
+		}
+	}
+}
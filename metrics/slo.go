@@ -0,0 +1,163 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Request outcomes as recorded in SLORequestsTotal
+const (
+	SLO_GOOD = "good"
+	SLO_BAD  = "bad"
+)
+
+// sloBucket is the resolution burn rates are computed at
+const sloBucket = time.Minute
+
+var (
+	// SLORequestsTotal counts the requests an SLO covers, bad when they
+	// failed with a 5xx or took longer than its latency
+	SLORequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexlite_slo_requests_total",
+		Help: "Requests covered by an SLO by outcome.",
+	}, []string{"slo", "outcome"})
+
+	// SLOBurnRate is how fast an SLO's error budget is being spent over a
+	// window, 1 spending it exactly by the end of the SLO period
+	SLOBurnRate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dexlite_slo_burn_rate",
+		Help: "Error budget burn rate of an SLO over a window.",
+	}, []string{"slo", "window"})
+)
+
+// SLO is an objective for one API route: the share of its requests that
+// must succeed, within Latency when set. 5xx responses count against it,
+// other statuses are the client's doing and don't
+type SLO struct {
+	Name string
+	// Method narrows the SLO to one HTTP method, any when empty
+	Method string
+	// Route is the route pattern, e.g. /api/prices/:coin
+	Route     string
+	Latency   time.Duration
+	Objective float64
+}
+
+// SLOWindow is an SLO's requests over a window
+type SLOWindow struct {
+	Window   time.Duration
+	Requests int64
+	Bad      int64
+	// BurnRate is the share of bad requests over the error budget, 0
+	// without requests
+	BurnRate float64
+}
+
+// sloCount holds one minute of an SLO's requests
+type sloCount struct {
+	minute    int64
+	good, bad int64
+}
+
+// SLOTracker counts the requests each SLO covers, keeping a minute by minute
+// history of span to compute burn rates from. It is safe for concurrent use
+type SLOTracker struct {
+	slos []SLO
+
+	mu     sync.Mutex
+	counts [][]sloCount
+}
+
+// NewSLOTracker creates a tracker for slos able to report burn rates over
+// windows up to span
+func NewSLOTracker(slos []SLO, span time.Duration) *SLOTracker {
+	buckets := int(span/sloBucket) + 1
+	counts := make([][]sloCount, len(slos))
+	for i := range counts {
+		counts[i] = make([]sloCount, buckets)
+	}
+	return &SLOTracker{
+		slos:   slos,
+		counts: counts,
+	}
+}
+
+// SLOs returns the tracked objectives
+func (t *SLOTracker) SLOs() []SLO {
+	return t.slos
+}
+
+// Middleware records every request to a route with an SLO. Register it ahead
+// of HTTPMiddleware so errors are already turned into their final status
+func (t *SLOTracker) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			startedAt := time.Now()
+
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			took := time.Since(startedAt)
+			for i, slo := range t.slos {
+				if slo.Route != c.Path() || (slo.Method != "" && slo.Method != c.Request().Method) {
+					continue
+				}
+				good := c.Response().Status < 500 && (slo.Latency <= 0 || took <= slo.Latency)
+				t.record(i, good, startedAt)
+			}
+			return nil
+		}
+	}
+}
+
+// record counts one request to the i-th SLO
+func (t *SLOTracker) record(i int, good bool, at time.Time) {
+	outcome := SLO_GOOD
+	if !good {
+		outcome = SLO_BAD
+	}
+	SLORequestsTotal.WithLabelValues(t.slos[i].Name, outcome).Inc()
+
+	minute := at.Unix() / int64(sloBucket/time.Second)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	bucket := &t.counts[i][minute%int64(len(t.counts[i]))]
+	if bucket.minute != minute {
+		*bucket = sloCount{minute: minute}
+	}
+	if good {
+		bucket.good++
+	} else {
+		bucket.bad++
+	}
+}
+
+// Window sums the i-th SLO's requests over the window ending at now. Windows
+// longer than the tracker's span are cut to it
+func (t *SLOTracker) Window(i int, window time.Duration, now time.Time) SLOWindow {
+	newest := now.Unix() / int64(sloBucket/time.Second)
+	oldest := newest - int64(window/sloBucket)
+
+	t.mu.Lock()
+	var good, bad int64
+	for _, bucket := range t.counts[i] {
+		if bucket.minute > oldest && bucket.minute <= newest {
+			good += bucket.good
+			bad += bucket.bad
+		}
+	}
+	t.mu.Unlock()
+
+	result := SLOWindow{Window: window, Requests: good + bad, Bad: bad}
+	if budget := 1 - t.slos[i].Objective; result.Requests > 0 && budget > 0 {
+		result.BurnRate = float64(bad) / float64(result.Requests) / budget
+	}
+	return result
+}
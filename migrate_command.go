@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/notblessy/dexlite/config"
+	"github.com/notblessy/dexlite/db"
+	"github.com/spf13/cobra"
+)
+
+func newMigrateCommand(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:         "migrate",
+		Short:       "apply, roll back or list schema migrations",
+		Args:        cobra.NoArgs,
+		Annotations: persistent,
+		RunE:        groupOnly,
+	}
+
+	var steps int
+	down := &cobra.Command{
+		Use:   "down",
+		Short: "roll back the newest applied migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exit(runMigrate(cfg, "down", steps))
+		},
+	}
+	down.Flags().IntVar(&steps, "steps", 1, "migrations rolled back")
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "up",
+			Short: "apply the pending migrations",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return exit(runMigrate(cfg, "up", 0))
+			},
+		},
+		down,
+		&cobra.Command{
+			Use:   "status",
+			Short: "list the migrations and when they were applied",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return exit(runMigrate(cfg, "status", 0))
+			},
+		},
+	)
+	return cmd
+}
+
+// runMigrate implements `dexlite migrate up`, `dexlite migrate down` and
+// `dexlite migrate status`. It exits 0 on success and 2 on usage or
+// migration errors. Workers of running processes are held off while up or
+// down changes the schema
+func runMigrate(cfg *config.Config, action string, steps int) int {
+	if action == "down" && steps <= 0 {
+		fmt.Fprintln(os.Stderr, "migrate: --steps must be positive")
+		return 2
+	}
+
+	database := db.New(cfg.Database.Driver, cfg.Database.DSN)
+
+	if action != "status" {
+		gate := db.NewWriteGate(database)
+		if err := gate.Pause(); err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+			return 2
+		}
+		defer gate.Resume()
+	}
+
+	switch action {
+	case "up":
+		ids, err := db.MigrateUp(database)
+		for _, id := range ids {
+			fmt.Printf("Applied %s\n", id)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+			return 2
+		}
+		if len(ids) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+	case "down":
+		ids, err := db.MigrateDown(database, steps)
+		for _, id := range ids {
+			fmt.Printf("Rolled back %s\n", id)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+			return 2
+		}
+		if len(ids) == 0 {
+			fmt.Println("No migration applied")
+		}
+	case "status":
+		states, err := db.MigrationStates(database)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+			return 2
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tAPPLIED\tDESCRIPTION")
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = state.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", state.ID, applied, state.Description)
+		}
+		w.Flush()
+	}
+	return 0
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// CANDLE_INTERVALS are the candle sizes the candle builder maintains, keyed by
+// the name used in the API
+var CANDLE_INTERVALS = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+}
+
+// CoinCandle is an OHLC candle rolled up from CoinPrice rows of one exchange.
+// OpenTime is the start of the bucket, truncated to the interval
+type CoinCandle struct {
+	ID       uint      `gorm:"primarykey" json:"id"`
+	Coin     string    `gorm:"type:varchar(32);not null;uniqueIndex:idx_coin_candles_bucket,priority:1" json:"coin"`
+	Exchange string    `gorm:"type:varchar(32);not null;uniqueIndex:idx_coin_candles_bucket,priority:2" json:"exchange"`
+	Interval string    `gorm:"column:resolution;type:varchar(8);not null;uniqueIndex:idx_coin_candles_bucket,priority:3" json:"interval"`
+	OpenTime time.Time `gorm:"not null;uniqueIndex:idx_coin_candles_bucket,priority:4" json:"open_time"`
+	Open     float64   `gorm:"type:decimal(20,8);not null" json:"open"`
+	High     float64   `gorm:"type:decimal(20,8);not null" json:"high"`
+	Low      float64   `gorm:"type:decimal(20,8);not null" json:"low"`
+	Close    float64   `gorm:"type:decimal(20,8);not null" json:"close"`
+	// Count is the number of price rows the candle was built from
+	Count     int64     `gorm:"not null" json:"count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (CoinCandle) TableName() string {
+	return "coin_candles"
+}
@@ -6,16 +6,33 @@ import (
 	"gorm.io/gorm"
 )
 
+// DEFAULT_EXCHANGE is the venue rows stored before multi-exchange support came from
+const DEFAULT_EXCHANGE = "hyperliquid"
+
+// MAX_PRICE is the smallest price the decimal(20,8) price column can't hold
+const MAX_PRICE = 1e12
+
 type CoinPrice struct {
-	ID        uint           `gorm:"primarykey" json:"id"`
-	Coin      string         `gorm:"type:varchar(10);not null;index" json:"coin"`
-	Price     float64        `gorm:"type:decimal(20,8);not null" json:"price"`
-	CreatedAt time.Time      `gorm:"index" json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
+	ID       uint   `gorm:"primarykey" json:"id"`
+	Coin     string `gorm:"type:varchar(32);not null;index;uniqueIndex:idx_coin_prices_coin_exchange_region_bucket,priority:1;index:idx_coin_prices_coin_updated_at,priority:1" json:"coin"`
+	Exchange string `gorm:"type:varchar(32);not null;default:'hyperliquid';index;uniqueIndex:idx_coin_prices_coin_exchange_region_bucket,priority:2" json:"exchange"`
+	// Region is where the collector that fetched the price runs, empty for
+	// single-region deployments
+	Region     string   `gorm:"type:varchar(32);not null;default:'';index;uniqueIndex:idx_coin_prices_coin_exchange_region_bucket,priority:3" json:"region,omitempty"`
+	Price      float64  `gorm:"type:decimal(20,8);not null" json:"price"`
+	Confidence *float64 `gorm:"type:decimal(20,8)" json:"confidence,omitempty"`
+	Labels     Labels   `json:"labels,omitempty"`
+	// SourceTime is when the venue observed the price, corrected to our clock
+	SourceTime *time.Time `json:"source_time,omitempty"`
+	// Bucket is the start of the sampling interval the price belongs to. A
+	// venue stores one price per bucket, a second one replaces the first
+	Bucket    time.Time `gorm:"not null;uniqueIndex:idx_coin_prices_coin_exchange_region_bucket,priority:4" json:"-"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	// UpdatedAt is when the price was last written, polls follow it
+	UpdatedAt time.Time      `gorm:"index:idx_coin_prices_coin_updated_at,priority:2" json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 }
 
 func (CoinPrice) TableName() string {
 	return "coin_prices"
 }
-
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+)
+
+// DeadLetter is a price that could not be stored after retries. TickAt keeps
+// the original fetch time so a replay lands in the right place in the series
+type DeadLetter struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	Coin       string     `gorm:"type:varchar(32);not null;index" json:"coin"`
+	Exchange   string     `gorm:"type:varchar(32);not null" json:"exchange"`
+	Region     string     `gorm:"type:varchar(32);not null;default:''" json:"region,omitempty"`
+	Price      float64    `gorm:"type:decimal(20,8);not null" json:"price"`
+	Confidence *float64   `gorm:"type:decimal(20,8)" json:"confidence,omitempty"`
+	Labels     Labels     `json:"labels,omitempty"`
+	SourceTime *time.Time `json:"source_time,omitempty"`
+	TickAt     time.Time  `gorm:"not null" json:"tick_at"`
+	Bucket     *time.Time `json:"bucket,omitempty"`
+	Error      string     `gorm:"type:text;not null" json:"error"`
+	Attempts   int        `gorm:"not null" json:"attempts"`
+	CreatedAt  time.Time  `gorm:"index" json:"created_at"`
+}
+
+func (DeadLetter) TableName() string {
+	return "dead_letters"
+}
+
+// NewDeadLetter captures a price that failed to persist
+func NewDeadLetter(price CoinPrice, err error, attempts int) DeadLetter {
+	return DeadLetter{
+		Coin:       price.Coin,
+		Exchange:   price.Exchange,
+		Region:     price.Region,
+		Price:      price.Price,
+		Confidence: price.Confidence,
+		Labels:     price.Labels,
+		SourceTime: price.SourceTime,
+		TickAt:     price.CreatedAt,
+		Bucket:     &price.Bucket,
+		Error:      err.Error(),
+		Attempts:   attempts,
+	}
+}
+
+// CoinPrice rebuilds the price the dead letter was created from
+func (d DeadLetter) CoinPrice() CoinPrice {
+	price := CoinPrice{
+		Coin:       d.Coin,
+		Exchange:   d.Exchange,
+		Region:     d.Region,
+		Price:      d.Price,
+		Confidence: d.Confidence,
+		Labels:     d.Labels,
+		SourceTime: d.SourceTime,
+		CreatedAt:  d.TickAt,
+	}
+	if d.Bucket != nil {
+		price.Bucket = *d.Bucket
+	}
+	return price
+}
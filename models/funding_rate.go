@@ -0,0 +1,48 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// HOURS_PER_YEAR annualizes funding, ignoring leap years as venues do
+const HOURS_PER_YEAR = 365 * 24
+
+// FundingRate is a perpetual's funding rate as read from a venue
+type FundingRate struct {
+	ID       uint   `gorm:"primarykey" json:"id"`
+	Coin     string `gorm:"type:varchar(32);not null;index:idx_funding_rates_coin_exchange_created_at,priority:1" json:"coin"`
+	Exchange string `gorm:"type:varchar(32);not null;index:idx_funding_rates_coin_exchange_created_at,priority:2" json:"exchange"`
+	// Rate is the fraction of notional longs pay shorts per interval
+	Rate float64 `gorm:"type:decimal(20,12);not null" json:"rate"`
+	// Premium is the mark to oracle premium the rate was derived from
+	Premium *float64 `gorm:"type:decimal(20,12)" json:"premium,omitempty"`
+	// IntervalHours is how often the venue settles funding
+	IntervalHours float64   `gorm:"not null" json:"interval_hours"`
+	CreatedAt     time.Time `gorm:"index:idx_funding_rates_coin_exchange_created_at,priority:3" json:"created_at"`
+}
+
+func (FundingRate) TableName() string {
+	return "funding_rates"
+}
+
+// periodsPerYear is how many times funding settles in a year
+func (f FundingRate) periodsPerYear() float64 {
+	if f.IntervalHours <= 0 {
+		return 0
+	}
+	return HOURS_PER_YEAR / f.IntervalHours
+}
+
+// APR annualizes the rate in percent without compounding. It is the yield a
+// short collects holding the position for a year at this rate, negative when
+// shorts pay
+func (f FundingRate) APR() float64 {
+	return f.Rate * f.periodsPerYear() * 100
+}
+
+// APY annualizes the rate in percent, compounding every funding interval, the
+// convention lending markets quote yields in
+func (f FundingRate) APY() float64 {
+	return (math.Pow(1+f.Rate, f.periodsPerYear()) - 1) * 100
+}
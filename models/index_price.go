@@ -0,0 +1,75 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// IndexPrice is the composite price of a coin, the median of every venue's
+// fresh latest price. An index computed from fewer venues than the quorum is
+// still stored but marked Degraded, so consumers can tell a single venue's
+// price from a consensus
+type IndexPrice struct {
+	ID    uint    `gorm:"primarykey" json:"id"`
+	Coin  string  `gorm:"type:varchar(32);not null;index:idx_index_prices_coin_created_at,priority:1" json:"coin"`
+	Price float64 `gorm:"type:decimal(20,8);not null" json:"price"`
+	// Sources is how many fresh venues the price was computed from, Quorum
+	// how many were required
+	Sources    int         `gorm:"not null" json:"sources"`
+	Quorum     int         `gorm:"not null" json:"quorum"`
+	Degraded   bool        `gorm:"not null;default:false" json:"degraded"`
+	Components VenuePrices `json:"components"`
+	CreatedAt  time.Time   `gorm:"index:idx_index_prices_coin_created_at,priority:2" json:"created_at"`
+}
+
+func (IndexPrice) TableName() string {
+	return "index_prices"
+}
+
+// VenuePrices maps exchanges to the price each contributed. Stored as JSON
+type VenuePrices map[string]float64
+
+func (VenuePrices) GormDataType() string {
+	return "jsonb"
+}
+
+func (VenuePrices) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	return jsonColumnType(db)
+}
+
+// Value implements driver.Valuer
+func (v VenuePrices) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+// Scan implements sql.Scanner
+func (v *VenuePrices) Scan(value interface{}) error {
+	if value == nil {
+		*v = nil
+		return nil
+	}
+
+	var bytes []byte
+	switch val := value.(type) {
+	case []byte:
+		bytes = val
+	case string:
+		bytes = []byte(val)
+	default:
+		return fmt.Errorf("unsupported venue prices type %T", value)
+	}
+
+	return json.Unmarshal(bytes, v)
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Job statuses. A job is pending until a runner claims it and finished once
+// it succeeded or failed
+const (
+	JOB_PENDING   = "pending"
+	JOB_RUNNING   = "running"
+	JOB_SUCCEEDED = "succeeded"
+	JOB_FAILED    = "failed"
+)
+
+// JOB_CORRELATION computes the return correlation matrix of a set of coins
+const JOB_CORRELATION = "correlation"
+
+// Job is an expensive computation requested through the API and run in the
+// background. Its result is kept until ExpiresAt, after which the job is
+// deleted
+type Job struct {
+	ID     string  `gorm:"type:varchar(32);primarykey" json:"id"`
+	Kind   string  `gorm:"type:varchar(32);not null" json:"kind"`
+	Status string  `gorm:"type:varchar(16);not null;index:idx_jobs_status_created_at,priority:1" json:"status"`
+	Params RawJSON `json:"params"`
+	Result RawJSON `json:"result,omitempty"`
+	Error  string  `gorm:"type:text" json:"error,omitempty"`
+	// Scope lists the coins the job may read when it was requested with a
+	// scoped API key, null otherwise
+	Scope      RawJSON    `json:"-"`
+	CreatedAt  time.Time  `gorm:"index:idx_jobs_status_created_at,priority:2" json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	ExpiresAt  *time.Time `gorm:"index" json:"expires_at,omitempty"`
+}
+
+func (Job) TableName() string {
+	return "jobs"
+}
+
+// Finished reports whether the job succeeded or failed
+func (j Job) Finished() bool {
+	return j.Status == JOB_SUCCEEDED || j.Status == JOB_FAILED
+}
+
+// RawJSON is an encoded JSON document stored as is
+type RawJSON []byte
+
+func (RawJSON) GormDataType() string {
+	return "jsonb"
+}
+
+func (RawJSON) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	return jsonColumnType(db)
+}
+
+// MarshalJSON embeds the document rather than encoding the bytes
+func (r RawJSON) MarshalJSON() ([]byte, error) {
+	if len(r) == 0 {
+		return []byte("null"), nil
+	}
+	return r, nil
+}
+
+// UnmarshalJSON keeps a copy of the document
+func (r *RawJSON) UnmarshalJSON(data []byte) error {
+	*r = append((*r)[:0], data...)
+	return nil
+}
+
+// Value implements driver.Valuer
+func (r RawJSON) Value() (driver.Value, error) {
+	if len(r) == 0 {
+		return nil, nil
+	}
+	return string(r), nil
+}
+
+// Scan implements sql.Scanner
+func (r *RawJSON) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*r = nil
+	case []byte:
+		*r = append(RawJSON(nil), v...)
+	case string:
+		*r = RawJSON(v)
+	default:
+		return fmt.Errorf("unsupported JSON type %T", value)
+	}
+	return nil
+}
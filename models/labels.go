@@ -0,0 +1,66 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Labels are free-form key/value tags a source attaches to a stored price,
+// e.g. {"network": "arbitrum", "role": "fallback"}. Stored as JSON
+type Labels map[string]string
+
+func (Labels) GormDataType() string {
+	return "jsonb"
+}
+
+func (Labels) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	return jsonColumnType(db)
+}
+
+// jsonColumnType is jsonb on Postgres, json on MySQL and text on drivers
+// without it, which still read it with their JSON functions
+func jsonColumnType(db *gorm.DB) string {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return "jsonb"
+	case "mysql":
+		return "json"
+	}
+	return "text"
+}
+
+// Value implements driver.Valuer
+func (l Labels) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return nil, nil
+	}
+	bytes, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+// Scan implements sql.Scanner
+func (l *Labels) Scan(value interface{}) error {
+	if value == nil {
+		*l = nil
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("unsupported labels type %T", value)
+	}
+
+	return json.Unmarshal(bytes, l)
+}
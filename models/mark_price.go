@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// MarkPrice is a perpetual's mark price stored next to the oracle price it is
+// anchored to. A persistent gap between them points to a lagging oracle or a
+// mark being pushed around
+type MarkPrice struct {
+	ID       uint    `gorm:"primarykey" json:"id"`
+	Coin     string  `gorm:"type:varchar(32);not null;index:idx_mark_prices_coin_exchange_created_at,priority:1" json:"coin"`
+	Exchange string  `gorm:"type:varchar(32);not null;index:idx_mark_prices_coin_exchange_created_at,priority:2" json:"exchange"`
+	Mark     float64 `gorm:"type:decimal(20,8);not null" json:"mark"`
+	Oracle   float64 `gorm:"type:decimal(20,8);not null" json:"oracle"`
+	// DivergenceBps is how far the mark is above the oracle, negative below
+	DivergenceBps float64   `gorm:"not null" json:"divergence_bps"`
+	CreatedAt     time.Time `gorm:"index:idx_mark_prices_coin_exchange_created_at,priority:3" json:"created_at"`
+}
+
+func (MarkPrice) TableName() string {
+	return "mark_prices"
+}
+
+// DivergenceBps returns how far mark is above oracle in basis points of oracle
+func DivergenceBps(mark, oracle float64) float64 {
+	if oracle == 0 {
+		return 0
+	}
+	return (mark - oracle) / oracle * 10000
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Notification channel types
+const (
+	CHANNEL_WEBHOOK  = "webhook"
+	CHANNEL_TELEGRAM = "telegram"
+	CHANNEL_SLACK    = "slack"
+	CHANNEL_DISCORD  = "discord"
+	CHANNEL_EMAIL    = "email"
+)
+
+// REDACTED replaces secrets in what the API returns
+const REDACTED = "***"
+
+// NotificationChannel is a destination alerts can be delivered to. Target is
+// the URL for webhook, Slack and Discord channels, the chat ID for Telegram
+// and a comma separated list of addresses for email
+type NotificationChannel struct {
+	ID   uint   `gorm:"primarykey" json:"id"`
+	Name string `gorm:"type:varchar(64);not null" json:"name"`
+	Type string `gorm:"type:varchar(16);not null;index" json:"type"`
+	// Target is redacted by the API for URL targets, see Redacted
+	Target string `gorm:"type:text;not null" json:"target"`
+	// Token is the Telegram bot token. It is never returned by the API
+	Token   string `gorm:"type:text" json:"-"`
+	Enabled bool   `gorm:"not null;default:true" json:"enabled"`
+	// Managed channels are declared in the config file and read-only in the API
+	Managed   bool      `gorm:"not null;default:false" json:"managed"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (NotificationChannel) TableName() string {
+	return "notification_channels"
+}
+
+// Validate checks the channel has what its type needs to deliver a message
+func (n NotificationChannel) Validate() error {
+	if n.Name == "" {
+		return errors.New("name is required")
+	}
+
+	switch n.Type {
+	case CHANNEL_WEBHOOK, CHANNEL_SLACK, CHANNEL_DISCORD:
+		parsed, err := url.Parse(n.Target)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("%s target must be an http(s) URL", n.Type)
+		}
+	case CHANNEL_TELEGRAM:
+		if n.Target == "" {
+			return errors.New("telegram target must be a chat ID")
+		}
+		if n.Token == "" {
+			return errors.New("telegram channels need a bot token")
+		}
+	case CHANNEL_EMAIL:
+		if _, err := mail.ParseAddressList(n.Target); err != nil {
+			return errors.New("email target must be a comma separated list of addresses")
+		}
+	default:
+		return fmt.Errorf("unknown channel type %q", n.Type)
+	}
+
+	return nil
+}
+
+// Redacted returns the channel as the API shows it. Webhook URLs often carry
+// credentials in their path, query or user info, so of a URL target only the
+// scheme and host are shown
+func (n NotificationChannel) Redacted() NotificationChannel {
+	if n.Type != CHANNEL_WEBHOOK && n.Type != CHANNEL_SLACK && n.Type != CHANNEL_DISCORD {
+		return n
+	}
+	parsed, err := url.Parse(n.Target)
+	if err != nil {
+		n.Target = REDACTED
+		return n
+	}
+	n.Target = parsed.Scheme + "://" + parsed.Host + "/" + REDACTED
+	return n
+}
+
+// Recipients returns the addresses of an email channel
+func (n NotificationChannel) Recipients() []string {
+	var recipients []string
+	for _, address := range strings.Split(n.Target, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			recipients = append(recipients, address)
+		}
+	}
+	return recipients
+}
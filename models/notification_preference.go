@@ -0,0 +1,106 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// QUIET_HOURS_LAYOUT is how quiet hours are written, e.g. 22:00
+const QUIET_HOURS_LAYOUT = "15:04"
+
+// NotificationPreference is how a user is told about price alerts on the
+// coins of their watchlist. Email goes to the account's address once it is
+// confirmed and Telegram to the chat that sent the bot the user's link code,
+// both through the server's own mail server and bot, so users can't make the
+// server message anyone who didn't ask for it. Only alerts of MinSeverity or
+// higher are sent, and between QuietStart and QuietEnd in Timezone only
+// critical ones. Users without preferences are not notified
+type NotificationPreference struct {
+	ID     uint  `gorm:"primarykey" json:"-"`
+	UserID uint  `gorm:"not null;uniqueIndex" json:"-"`
+	User   *User `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Email  bool  `gorm:"not null;default:false" json:"email"`
+	// TelegramChatID is set by the bot when the chat sends /start with the
+	// link code, never through the API
+	TelegramChatID string `gorm:"type:varchar(64);not null;default:''" json:"telegram_chat_id"`
+	// TelegramLinkCode is the SHA-256 of the pending link code, hex encoded
+	TelegramLinkCode      string     `gorm:"type:varchar(64);not null;default:'';index" json:"-"`
+	TelegramLinkExpiresAt *time.Time `json:"-"`
+	MinSeverity           string     `gorm:"type:varchar(16);not null;default:'info'" json:"min_severity"`
+	// QuietStart and QuietEnd are times of day as HH:MM, quiet hours are off
+	// when they are equal. A range past midnight, like 22:00 to 07:00, wraps
+	QuietStart string    `gorm:"type:varchar(5);not null;default:''" json:"quiet_start"`
+	QuietEnd   string    `gorm:"type:varchar(5);not null;default:''" json:"quiet_end"`
+	Timezone   string    `gorm:"type:varchar(64);not null;default:'UTC'" json:"timezone"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (NotificationPreference) TableName() string {
+	return "notification_preferences"
+}
+
+// TelegramLinkHash returns what is stored of a Telegram link code, so codes
+// read from the database can't link a chat
+func TelegramLinkHash(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// Validate checks the severity, quiet hours and time zone can be applied
+func (p NotificationPreference) Validate() error {
+	if SeverityRank(p.MinSeverity) < 0 {
+		return fmt.Errorf("min_severity must be one of %v", Severities)
+	}
+	if (p.QuietStart == "") != (p.QuietEnd == "") {
+		return errors.New("quiet_start and quiet_end are set together")
+	}
+	for _, value := range []string{p.QuietStart, p.QuietEnd} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse(QUIET_HOURS_LAYOUT, value); err != nil {
+			return errors.New("quiet hours must be times of day as HH:MM")
+		}
+	}
+	if _, err := time.LoadLocation(p.Timezone); err != nil || p.Timezone == "" {
+		return fmt.Errorf("unknown timezone %q", p.Timezone)
+	}
+	return nil
+}
+
+// Allows reports whether an alert of severity firing at is sent to the user
+func (p NotificationPreference) Allows(severity string, at time.Time) bool {
+	if SeverityRank(severity) < SeverityRank(p.MinSeverity) {
+		return false
+	}
+	return severity == SEVERITY_CRITICAL || !p.Quiet(at)
+}
+
+// Quiet reports whether at falls in the user's quiet hours
+func (p NotificationPreference) Quiet(at time.Time) bool {
+	start, err := time.Parse(QUIET_HOURS_LAYOUT, p.QuietStart)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse(QUIET_HOURS_LAYOUT, p.QuietEnd)
+	if err != nil {
+		return false
+	}
+	location, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	local := at.In(location)
+	now := local.Hour()*60 + local.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+	if from <= to {
+		return from <= now && now < to
+	}
+	return now >= from || now < to
+}
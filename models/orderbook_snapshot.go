@@ -0,0 +1,107 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// OrderbookSnapshot is the top of a coin's orderbook on one venue at a point
+// in time
+type OrderbookSnapshot struct {
+	ID       uint   `gorm:"primarykey" json:"id"`
+	Coin     string `gorm:"type:varchar(32);not null;index:idx_orderbook_snapshots_coin_exchange_created_at,priority:1" json:"coin"`
+	Exchange string `gorm:"type:varchar(32);not null;index:idx_orderbook_snapshots_coin_exchange_created_at,priority:2" json:"exchange"`
+	// Mid is halfway between the best bid and ask
+	Mid       float64    `gorm:"type:decimal(20,8);not null" json:"mid"`
+	Bids      BookLevels `gorm:"not null" json:"bids"`
+	Asks      BookLevels `gorm:"not null" json:"asks"`
+	CreatedAt time.Time  `gorm:"index:idx_orderbook_snapshots_coin_exchange_created_at,priority:3" json:"created_at"`
+}
+
+func (OrderbookSnapshot) TableName() string {
+	return "orderbook_snapshots"
+}
+
+// Depth returns the quote notional resting on each side within pct percent of
+// the mid. Only stored levels count, so a wide band can undercount when the
+// book goes deeper than what was snapshotted
+func (s OrderbookSnapshot) Depth(pct float64) (bid, ask float64) {
+	low := s.Mid * (1 - pct/100)
+	high := s.Mid * (1 + pct/100)
+
+	for _, level := range s.Bids {
+		if level.Price >= low {
+			bid += level.Price * level.Size
+		}
+	}
+	for _, level := range s.Asks {
+		if level.Price <= high {
+			ask += level.Price * level.Size
+		}
+	}
+	return bid, ask
+}
+
+// SpreadBps returns the gap between the best ask and bid in basis points of
+// the mid, 0 when either side is empty
+func (s OrderbookSnapshot) SpreadBps() float64 {
+	if len(s.Bids) == 0 || len(s.Asks) == 0 || s.Mid == 0 {
+		return 0
+	}
+	return (s.Asks[0].Price - s.Bids[0].Price) / s.Mid * 10000
+}
+
+// BookLevel is one price level of an orderbook side
+type BookLevel struct {
+	Price  float64 `json:"price"`
+	Size   float64 `json:"size"`
+	Orders int     `json:"orders,omitempty"`
+}
+
+// BookLevels is one side of an orderbook, best price first. Stored as JSON
+type BookLevels []BookLevel
+
+func (BookLevels) GormDataType() string {
+	return "jsonb"
+}
+
+func (BookLevels) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	return jsonColumnType(db)
+}
+
+// Value implements driver.Valuer
+func (l BookLevels) Value() (driver.Value, error) {
+	if l == nil {
+		l = BookLevels{}
+	}
+	bytes, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+// Scan implements sql.Scanner
+func (l *BookLevels) Scan(value interface{}) error {
+	if value == nil {
+		*l = nil
+		return nil
+	}
+
+	var bytes []byte
+	switch val := value.(type) {
+	case []byte:
+		bytes = val
+	case string:
+		bytes = []byte(val)
+	default:
+		return fmt.Errorf("unsupported book levels type %T", value)
+	}
+
+	return json.Unmarshal(bytes, l)
+}
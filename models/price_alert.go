@@ -0,0 +1,174 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/notblessy/dexlite/symbols"
+)
+
+// Price alert conditions
+const (
+	ALERT_ABOVE  = "above"
+	ALERT_BELOW  = "below"
+	ALERT_CHANGE = "change"
+	// ALERT_MARK_DIVERGENCE fires when a perpetual's mark price is Threshold
+	// basis points or more away from its oracle price, either way
+	ALERT_MARK_DIVERGENCE = "mark_divergence"
+)
+
+// Alert severities, lowest first. Users choose the lowest they are notified of
+const (
+	SEVERITY_INFO     = "info"
+	SEVERITY_WARNING  = "warning"
+	SEVERITY_CRITICAL = "critical"
+)
+
+// Severities lists the alert severities, lowest first
+var Severities = []string{SEVERITY_INFO, SEVERITY_WARNING, SEVERITY_CRITICAL}
+
+// SeverityRank orders severities, -1 for an unknown one
+func SeverityRank(severity string) int {
+	return slices.Index(Severities, severity)
+}
+
+// PriceAlert fires when a coin crosses a price threshold, moves more than
+// Threshold percent over WindowMinutes for change alerts, or its mark strays
+// Threshold basis points from the oracle for mark divergence alerts. It is delivered to
+// WebhookURL, to the notification channel ChannelID routes it to, or both. An
+// alert stays triggered until its condition clears, so it fires once per
+// crossing. Users watching the coin are notified as their preferences allow
+// for the alert's Severity
+type PriceAlert struct {
+	ID   uint   `gorm:"primarykey" json:"id"`
+	Name string `gorm:"type:varchar(64);not null" json:"name"`
+	Coin string `gorm:"type:varchar(32);not null;index" json:"coin"`
+	// Exchange restricts the alert to one venue, empty uses the newest price
+	// from any of them. A change alert compares it with the same venue's
+	// price a window earlier
+	Exchange      string  `gorm:"type:varchar(32);not null;default:''" json:"exchange,omitempty"`
+	Condition     string  `gorm:"type:varchar(16);not null" json:"condition"`
+	Threshold     float64 `gorm:"type:decimal(20,8);not null" json:"threshold"`
+	WindowMinutes int     `gorm:"not null;default:0" json:"window_minutes,omitempty"`
+	Severity      string  `gorm:"type:varchar(16);not null;default:'warning'" json:"severity"`
+	WebhookURL    Text    `gorm:"not null;default:''" json:"webhook_url,omitempty"`
+	// ChannelID routes the alert to a notification channel. Deleting the
+	// channel unroutes the alert
+	ChannelID   *uint                `gorm:"index" json:"channel_id,omitempty"`
+	Channel     *NotificationChannel `gorm:"constraint:OnDelete:SET NULL" json:"-"`
+	Enabled     bool                 `gorm:"not null;default:true" json:"enabled"`
+	Triggered   bool                 `gorm:"not null;default:false" json:"triggered"`
+	LastFiredAt *time.Time           `json:"last_fired_at,omitempty"`
+	// Managed alerts are declared in the config file and read-only in the API
+	Managed   bool      `gorm:"not null;default:false" json:"managed"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (PriceAlert) TableName() string {
+	return "price_alerts"
+}
+
+// Validate checks the alert has what its condition needs to be evaluated
+func (a PriceAlert) Validate() error {
+	if a.Name == "" {
+		return errors.New("name is required")
+	}
+	if a.Coin == "" {
+		return errors.New("coin is required")
+	}
+	if len(a.Coin) > symbols.MAX_LENGTH {
+		return fmt.Errorf("coin must be at most %d characters", symbols.MAX_LENGTH)
+	}
+
+	switch a.Condition {
+	case ALERT_ABOVE, ALERT_BELOW:
+		if a.Threshold <= 0 {
+			return errors.New("threshold must be a positive price")
+		}
+	case ALERT_CHANGE:
+		if a.Threshold <= 0 {
+			return errors.New("threshold must be a positive percentage")
+		}
+		if a.WindowMinutes <= 0 {
+			return errors.New("window_minutes is required for change alerts")
+		}
+	case ALERT_MARK_DIVERGENCE:
+		if a.Threshold <= 0 {
+			return errors.New("threshold must be a positive number of basis points")
+		}
+	default:
+		return fmt.Errorf("unknown condition %q", a.Condition)
+	}
+
+	if SeverityRank(a.Severity) < 0 {
+		return fmt.Errorf("severity must be one of %v", Severities)
+	}
+
+	if a.WebhookURL == "" && a.ChannelID == nil {
+		return errors.New("webhook_url or channel_id is required")
+	}
+	if a.WebhookURL != "" {
+		parsed, err := url.Parse(string(a.WebhookURL))
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return errors.New("webhook_url must be an http(s) URL")
+		}
+	}
+
+	return nil
+}
+
+// Window is how far back change alerts look for the reference price
+func (a PriceAlert) Window() time.Duration {
+	return time.Duration(a.WindowMinutes) * time.Minute
+}
+
+// Breached reports whether price meets the alert's condition. reference is
+// the price WindowMinutes ago for change alerts and the oracle price for mark
+// divergence alerts, both of which trigger in either direction
+func (a PriceAlert) Breached(price, reference float64) bool {
+	switch a.Condition {
+	case ALERT_ABOVE:
+		return price >= a.Threshold
+	case ALERT_BELOW:
+		return price <= a.Threshold
+	case ALERT_CHANGE:
+		if reference == 0 {
+			return false
+		}
+		change := (price - reference) / reference * 100
+		return change >= a.Threshold || change <= -a.Threshold
+	case ALERT_MARK_DIVERGENCE:
+		if reference == 0 {
+			return false
+		}
+		return math.Abs(DivergenceBps(price, reference)) >= a.Threshold
+	}
+	return false
+}
+
+// SameRule reports whether a and b describe the same rule, ignoring their
+// identity and evaluation state
+func (a PriceAlert) SameRule(b PriceAlert) bool {
+	return a.Name == b.Name &&
+		a.Coin == b.Coin &&
+		a.Exchange == b.Exchange &&
+		a.Condition == b.Condition &&
+		a.Threshold == b.Threshold &&
+		a.WindowMinutes == b.WindowMinutes &&
+		a.Severity == b.Severity &&
+		a.WebhookURL == b.WebhookURL &&
+		sameID(a.ChannelID, b.ChannelID) &&
+		a.Enabled == b.Enabled
+}
+
+func sameID(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// SCHEMA_LOCK_MIGRATION is the holder of the row every process locks before
+// writing. Its Migrator names the migration holding the schema, if any
+const SCHEMA_LOCK_MIGRATION = "migration"
+
+// SchemaLock coordinates migrations with the workers of every process sharing
+// the database. Besides the migration row, each process has a row of its own
+// whose Writers is 1 while its workers may be writing. Rows whose heartbeat is
+// older than the lock TTL belong to processes that died and are ignored
+type SchemaLock struct {
+	Holder      string    `gorm:"type:varchar(128);primarykey"`
+	Writers     int       `gorm:"not null;default:0"`
+	Migrator    string    `gorm:"type:varchar(128);not null;default:''"`
+	HeartbeatAt time.Time `gorm:"not null"`
+}
+
+func (SchemaLock) TableName() string {
+	return "schema_locks"
+}
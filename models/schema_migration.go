@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// SchemaMigration records a versioned schema migration once it is applied
+type SchemaMigration struct {
+	ID        string    `gorm:"type:varchar(128);primarykey" json:"id"`
+	AppliedAt time.Time `gorm:"not null" json:"applied_at"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+)
+
+// Session bar intervals, anchored to a timezone and day boundary rather than
+// fixed-length buckets
+const (
+	SESSION_DAY   = "1d"
+	SESSION_WEEK  = "1w"
+	SESSION_MONTH = "1M"
+)
+
+// SESSION_INTERVALS maps each session interval to its longest length, used to
+// bound how many bars a request may span
+var SESSION_INTERVALS = map[string]time.Duration{
+	SESSION_DAY:   24 * time.Hour,
+	SESSION_WEEK:  7 * 24 * time.Hour,
+	SESSION_MONTH: 31 * 24 * time.Hour,
+}
+
+// Sessions places times into daily, weekly and monthly bars. A day starts
+// dayStart after local midnight in loc, a week on Monday and a month on the
+// first
+type Sessions struct {
+	loc      *time.Location
+	dayStart time.Duration
+}
+
+// NewSessions creates sessions anchored to loc with days starting dayStart
+// after midnight, e.g. 17h for a New York close. A nil loc means UTC
+func NewSessions(loc *time.Location, dayStart time.Duration) *Sessions {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &Sessions{
+		loc:      loc,
+		dayStart: dayStart,
+	}
+}
+
+// Start returns the start of the session bar of the given interval containing t
+func (s *Sessions) Start(interval string, t time.Time) time.Time {
+	// Shift so the day boundary falls on midnight, then take the calendar date
+	year, month, day := t.In(s.loc).Add(-s.dayStart).Date()
+
+	switch interval {
+	case SESSION_WEEK:
+		weekday := time.Date(year, month, day, 0, 0, 0, 0, s.loc).Weekday()
+		day -= (int(weekday) + 6) % 7
+	case SESSION_MONTH:
+		day = 1
+	}
+
+	hour := int(s.dayStart / time.Hour)
+	minute := int(s.dayStart % time.Hour / time.Minute)
+	return time.Date(year, month, day, hour, minute, 0, 0, s.loc).UTC()
+}
+
+// End returns the start of the session bar after the one containing t
+func (s *Sessions) End(interval string, t time.Time) time.Time {
+	start := s.Start(interval, t).In(s.loc)
+	switch interval {
+	case SESSION_WEEK:
+		return start.AddDate(0, 0, 7).UTC()
+	case SESSION_MONTH:
+		return start.AddDate(0, 1, 0).UTC()
+	}
+	return start.AddDate(0, 0, 1).UTC()
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Quality score weights, summing to 1
+const (
+	QUALITY_WEIGHT_UPTIME    = 0.4
+	QUALITY_WEIGHT_LATENCY   = 0.2
+	QUALITY_WEIGHT_STALENESS = 0.2
+	QUALITY_WEIGHT_OUTLIERS  = 0.2
+)
+
+// A source at or beyond these scores zero on the component
+const (
+	QUALITY_MAX_LATENCY   = 5 * time.Second
+	QUALITY_MAX_STALENESS = time.Minute
+)
+
+// SourceScore accumulates the quality signals of one source over an hour.
+// Latency and staleness are stored as sums so any window can be averaged
+// exactly
+type SourceScore struct {
+	ID               uint      `gorm:"primarykey" json:"-"`
+	Exchange         string    `gorm:"type:varchar(32);not null;uniqueIndex:idx_source_scores_exchange_hour,priority:1" json:"exchange"`
+	Hour             time.Time `gorm:"not null;uniqueIndex:idx_source_scores_exchange_hour,priority:2;index" json:"hour"`
+	Cycles           int64     `gorm:"not null;default:0" json:"cycles"`
+	SuccessfulCycles int64     `gorm:"not null;default:0" json:"successful_cycles"`
+	LatencyMs        float64   `gorm:"not null;default:0" json:"-"`
+	// StalenessSeconds sums how old venue-timestamped prices were when fetched
+	StalenessSeconds float64 `gorm:"not null;default:0" json:"-"`
+	StalenessSamples int64   `gorm:"not null;default:0" json:"-"`
+	// Compared counts prices checked against the median of other venues and
+	// Outliers those that were too far from it
+	Compared  int64     `gorm:"not null;default:0" json:"-"`
+	Outliers  int64     `gorm:"not null;default:0" json:"-"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+func (SourceScore) TableName() string {
+	return "source_scores"
+}
+
+// Add folds other's counters into s
+func (s *SourceScore) Add(other SourceScore) {
+	s.Cycles += other.Cycles
+	s.SuccessfulCycles += other.SuccessfulCycles
+	s.LatencyMs += other.LatencyMs
+	s.StalenessSeconds += other.StalenessSeconds
+	s.StalenessSamples += other.StalenessSamples
+	s.Compared += other.Compared
+	s.Outliers += other.Outliers
+}
+
+// SourceQuality is a source's quality over some window. Score runs from 0 to
+// 100. StalenessSeconds is null for venues that don't timestamp their prices,
+// which aren't penalized for it
+type SourceQuality struct {
+	Score            float64  `json:"score"`
+	UptimePct        float64  `json:"uptime_pct"`
+	LatencyMs        float64  `json:"latency_ms"`
+	StalenessSeconds *float64 `json:"staleness_seconds"`
+	OutlierPct       float64  `json:"outlier_pct"`
+	Cycles           int64    `json:"cycles"`
+}
+
+// Quality combines the counters into a score
+func (s SourceScore) Quality() SourceQuality {
+	if s.Cycles == 0 {
+		return SourceQuality{}
+	}
+
+	quality := SourceQuality{
+		UptimePct: float64(s.SuccessfulCycles) / float64(s.Cycles) * 100,
+		LatencyMs: s.LatencyMs / float64(s.Cycles),
+		Cycles:    s.Cycles,
+	}
+	staleness := 1.0
+	if s.StalenessSamples > 0 {
+		average := s.StalenessSeconds / float64(s.StalenessSamples)
+		quality.StalenessSeconds = &average
+		staleness = 1 - math.Min(average/QUALITY_MAX_STALENESS.Seconds(), 1)
+	}
+	outliers := 1.0
+	if s.Compared > 0 {
+		quality.OutlierPct = float64(s.Outliers) / float64(s.Compared) * 100
+		outliers = 1 - quality.OutlierPct/100
+	}
+	latency := 1 - math.Min(quality.LatencyMs/float64(QUALITY_MAX_LATENCY.Milliseconds()), 1)
+
+	quality.Score = 100 * (QUALITY_WEIGHT_UPTIME*quality.UptimePct/100 +
+		QUALITY_WEIGHT_LATENCY*latency +
+		QUALITY_WEIGHT_STALENESS*staleness +
+		QUALITY_WEIGHT_OUTLIERS*outliers)
+	return quality
+}
+
+// RankedSource is a source's quality over a window
+type RankedSource struct {
+	Exchange string `json:"exchange"`
+	SourceQuality
+}
+
+// RankSources folds hourly rows into one quality per source, best first
+func RankSources(rows []SourceScore) []RankedSource {
+	totals := make(map[string]*SourceScore)
+	for _, row := range rows {
+		if totals[row.Exchange] == nil {
+			totals[row.Exchange] = &SourceScore{Exchange: row.Exchange}
+		}
+		totals[row.Exchange].Add(row)
+	}
+
+	ranking := make([]RankedSource, 0, len(totals))
+	for exchange, total := range totals {
+		ranking = append(ranking, RankedSource{Exchange: exchange, SourceQuality: total.Quality()})
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		if ranking[i].Score != ranking[j].Score {
+			return ranking[i].Score > ranking[j].Score
+		}
+		return ranking[i].Exchange < ranking[j].Exchange
+	})
+	return ranking
+}
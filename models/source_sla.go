@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// SourceSLA aggregates how reliably a source delivered prices during a month
+type SourceSLA struct {
+	ID               uint       `gorm:"primarykey" json:"id"`
+	Exchange         string     `gorm:"type:varchar(32);not null;uniqueIndex:idx_source_sla_exchange_month" json:"exchange"`
+	Month            string     `gorm:"type:char(7);not null;uniqueIndex:idx_source_sla_exchange_month" json:"month"`
+	Cycles           int64      `gorm:"not null;default:0" json:"cycles"`
+	SuccessfulCycles int64      `gorm:"not null;default:0" json:"successful_cycles"`
+	RequestedPrices  int64      `gorm:"not null;default:0" json:"requested_prices"`
+	ReceivedPrices   int64      `gorm:"not null;default:0" json:"received_prices"`
+	LastSuccessAt    *time.Time `json:"last_success_at"`
+	MaxGapSeconds    float64    `gorm:"not null;default:0" json:"max_gap_seconds"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+func (SourceSLA) TableName() string {
+	return "source_slas"
+}
+
+// SLAMonth formats t as the month key used by SourceSLA
+func SLAMonth(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
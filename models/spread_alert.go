@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+)
+
+// SpreadAlert records a cross-venue spread that crossed the alert threshold:
+// buying on BuyExchange and selling on SellExchange would have captured it
+type SpreadAlert struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	Coin         string    `gorm:"type:varchar(32);not null;index:idx_spread_alerts_coin_detected_at,priority:1" json:"coin"`
+	BuyExchange  string    `gorm:"type:varchar(32);not null" json:"buy_exchange"`
+	BuyPrice     float64   `gorm:"type:decimal(20,8);not null" json:"buy_price"`
+	SellExchange string    `gorm:"type:varchar(32);not null" json:"sell_exchange"`
+	SellPrice    float64   `gorm:"type:decimal(20,8);not null" json:"sell_price"`
+	SpreadBps    float64   `gorm:"not null" json:"spread_bps"`
+	DetectedAt   time.Time `gorm:"not null;index:idx_spread_alerts_coin_detected_at,priority:2" json:"detected_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (SpreadAlert) TableName() string {
+	return "spread_alerts"
+}
+
+// SpreadBps returns how far sell is above buy in basis points of buy
+func SpreadBps(buy, sell float64) float64 {
+	if buy == 0 {
+		return 0
+	}
+	return (sell - buy) / buy * 10000
+}
+
+// VenueSpread is the widest spread between venues' latest prices for a coin
+type VenueSpread struct {
+	BuyExchange  string
+	BuyPrice     float64
+	SellExchange string
+	SellPrice    float64
+	SpreadBps    float64
+}
+
+// WidestSpread finds the cheapest and richest venue among the latest prices,
+// one per exchange. It reports false when fewer than two venues are priced
+func WidestSpread(latest []CoinPrice) (VenueSpread, bool) {
+	if len(latest) < 2 {
+		return VenueSpread{}, false
+	}
+
+	low, high := latest[0], latest[0]
+	for _, price := range latest[1:] {
+		if price.Price < low.Price {
+			low = price
+		}
+		if price.Price > high.Price {
+			high = price
+		}
+	}
+
+	return VenueSpread{
+		BuyExchange:  low.Exchange,
+		BuyPrice:     low.Price,
+		SellExchange: high.Exchange,
+		SellPrice:    high.Price,
+		SpreadBps:    SpreadBps(low.Price, high.Price),
+	}, true
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Text is a string stored in a text column. MySQL refuses defaults on text
+// columns, so there it is a varchar long enough for URLs
+type Text string
+
+func (Text) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	if db.Dialector.Name() == "mysql" {
+		return "varchar(2048)"
+	}
+	return "text"
+}
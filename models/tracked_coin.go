@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// TrackedCoin is a coin the price fetcher collects on every cycle
+type TrackedCoin struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	Coin      string    `gorm:"type:varchar(32);not null;uniqueIndex" json:"coin"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (TrackedCoin) TableName() string {
+	return "tracked_coins"
+}
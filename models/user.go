@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+// User is an account signing in with email and password to keep a watchlist.
+// The address is only mailed alerts once its owner followed the confirmation
+// link sent to it
+type User struct {
+	ID               uint       `gorm:"primarykey" json:"id"`
+	Email            string     `gorm:"type:varchar(254);not null;uniqueIndex" json:"email"`
+	PasswordHash     string     `gorm:"type:varchar(72);not null" json:"-"`
+	EmailConfirmedAt *time.Time `json:"email_confirmed_at"`
+	// ConfirmationSentAt is when the last confirmation link was mailed,
+	// links are sent at most once per EMAIL_CONFIRMATION_INTERVAL
+	ConfirmationSentAt *time.Time `json:"-"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// EMAIL_CONFIRMATION_INTERVAL is how long a user waits before another
+// confirmation link is mailed, so the address can't be flooded
+const EMAIL_CONFIRMATION_INTERVAL = 10 * time.Minute
+
+func (User) TableName() string {
+	return "users"
+}
+
+// WatchlistCoin is a coin on a user's watchlist. Watchlisted coins are
+// collected by the price fetcher like tracked coins
+type WatchlistCoin struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_watchlist_coins_user_coin,priority:1" json:"-"`
+	Coin      string    `gorm:"type:varchar(32);not null;uniqueIndex:idx_watchlist_coins_user_coin,priority:2;index" json:"coin"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (WatchlistCoin) TableName() string {
+	return "watchlist_coins"
+}
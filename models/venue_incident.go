@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+// VenueIncident is an incident an exchange posted on its public status page.
+// ResolvedAt is nil while the incident is ongoing
+type VenueIncident struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	Exchange   string     `gorm:"type:varchar(32);not null;uniqueIndex:idx_venue_incidents_exchange_incident" json:"exchange"`
+	IncidentID string     `gorm:"type:varchar(64);not null;uniqueIndex:idx_venue_incidents_exchange_incident" json:"incident_id"`
+	Name       string     `gorm:"type:text;not null" json:"name"`
+	Status     string     `gorm:"type:varchar(32);not null" json:"status"`
+	Impact     string     `gorm:"type:varchar(32);not null;default:''" json:"impact"`
+	URL        string     `gorm:"type:text;not null;default:''" json:"url,omitempty"`
+	StartedAt  time.Time  `gorm:"not null;index" json:"started_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+func (VenueIncident) TableName() string {
+	return "venue_incidents"
+}
+
+// Overlaps reports whether the incident was ongoing at any point between from
+// and to
+func (i VenueIncident) Overlaps(from, to time.Time) bool {
+	if i.StartedAt.After(to) {
+		return false
+	}
+	return i.ResolvedAt == nil || !i.ResolvedAt.Before(from)
+}
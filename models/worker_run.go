@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// WorkerRun is the audit record of a single background worker cycle
+type WorkerRun struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	Worker      string    `gorm:"type:varchar(64);not null;index:idx_worker_runs_worker_started_at,priority:1" json:"worker"`
+	StartedAt   time.Time `gorm:"not null;index:idx_worker_runs_worker_started_at,priority:2" json:"started_at"`
+	FinishedAt  time.Time `gorm:"not null" json:"finished_at"`
+	DurationMs  int64     `gorm:"not null" json:"duration_ms"`
+	RowsWritten int64     `gorm:"not null;default:0" json:"rows_written"`
+	Error       string    `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (WorkerRun) TableName() string {
+	return "worker_runs"
+}
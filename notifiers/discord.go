@@ -0,0 +1,110 @@
+package notifiers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/services"
+)
+
+// Embed colours, green for upward alerts and red for downward ones
+const (
+	DISCORD_COLOR_UP   = 0x2ecc71
+	DISCORD_COLOR_DOWN = 0xe74c3c
+)
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title     string         `json:"title"`
+	Color     int            `json:"color"`
+	Fields    []discordField `json:"fields"`
+	Timestamp time.Time      `json:"timestamp"`
+}
+
+type discordMessage struct {
+	Username string         `json:"username"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+// Discord posts alerts to a channel webhook as a rich embed
+type Discord struct {
+	client *services.WebhookClient
+	url    string
+}
+
+func NewDiscord(url string) *Discord {
+	return &Discord{
+		client: services.NewWebhookClient(),
+		url:    url,
+	}
+}
+
+func (d *Discord) Name() string {
+	return "discord"
+}
+
+func (d *Discord) Notify(event Event) error {
+	return d.client.Send(d.url, discordMessage{
+		Username: "dexlite",
+		Embeds:   []discordEmbed{discordEmbedFor(event)},
+	})
+}
+
+// discordEmbedFor formats event with one field per detail
+func discordEmbedFor(event Event) discordEmbed {
+	if event.Condition == CONDITION_SLO_BURN {
+		return discordEmbed{
+			Title: fmt.Sprintf("%s: %s", event.Name, event.Route),
+			Color: DISCORD_COLOR_DOWN,
+			Fields: []discordField{
+				{Name: "Burn rate", Value: fmt.Sprintf("%.1fx, alert at %gx", event.BurnRate, event.Threshold), Inline: true},
+				{Name: "Bad requests", Value: fmt.Sprintf("%.2f%% in %dm", event.BadPct, event.WindowMinutes), Inline: true},
+				{Name: "Objective", Value: fmt.Sprintf("%g%%", event.Objective), Inline: true},
+			},
+			Timestamp: event.FiredAt,
+		}
+	}
+
+	color := DISCORD_COLOR_UP
+	if event.Condition == models.ALERT_BELOW || event.ChangePct < 0 {
+		color = DISCORD_COLOR_DOWN
+	}
+
+	fields := []discordField{
+		{Name: "Coin", Value: event.Coin, Inline: true},
+		{Name: "Exchange", Value: event.Exchange, Inline: true},
+		{Name: "Price", Value: fmt.Sprintf("%g", event.Price), Inline: true},
+	}
+	switch {
+	case event.Condition == models.ALERT_MARK_DIVERGENCE:
+		fields[2].Name = "Mark"
+		fields = append(fields,
+			discordField{Name: "Oracle", Value: fmt.Sprintf("%g", event.Reference), Inline: true},
+			discordField{Name: "Divergence", Value: fmt.Sprintf("%+.2f%%, threshold %g bps", event.ChangePct, event.Threshold), Inline: true},
+		)
+	case event.Reference != 0:
+		fields = append(fields,
+			discordField{Name: "Change", Value: fmt.Sprintf("%+.2f%% in %dm", event.ChangePct, event.WindowMinutes), Inline: true},
+			discordField{Name: "From", Value: fmt.Sprintf("%g", event.Reference), Inline: true},
+		)
+	default:
+		fields = append(fields, discordField{
+			Name:   "Threshold",
+			Value:  fmt.Sprintf("%s %g", event.Condition, event.Threshold),
+			Inline: true,
+		})
+	}
+
+	return discordEmbed{
+		Title:     fmt.Sprintf("%s: %s", event.Name, event.Coin),
+		Color:     color,
+		Fields:    fields,
+		Timestamp: event.FiredAt,
+	}
+}
@@ -0,0 +1,205 @@
+package notifiers
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// SMTP connection security modes
+const (
+	SMTP_TLS_NONE     = "none"
+	SMTP_TLS_STARTTLS = "starttls"
+	SMTP_TLS_IMPLICIT = "tls"
+)
+
+const SMTP_TIMEOUT = 15 * time.Second
+
+// DEFAULT_EMAIL_SUBJECT and DEFAULT_EMAIL_TEMPLATE are used when no templates
+// are configured. The subject is a text/template and the body an html/template,
+// both executed with the Event
+const (
+	DEFAULT_EMAIL_SUBJECT = `[dexlite] {{.Name}}: {{if eq .Condition "slo_burn"}}{{.Route}} burning error budget at {{printf "%.1f" .BurnRate}}x{{else}}{{.Coin}} {{.Condition}} {{printf "%g" .Threshold}}{{if eq .Condition "change"}}%{{else if eq .Condition "mark_divergence"}} bps{{end}}{{end}}`
+
+	DEFAULT_EMAIL_TEMPLATE = `<!DOCTYPE html>
+<html>
+<body style="font-family: -apple-system, 'Segoe UI', Helvetica, Arial, sans-serif; color: #1f2328;">
+<h2 style="margin: 0 0 12px;">{{.Name}}</h2>
+<table cellpadding="4" style="border-collapse: collapse;">
+{{if eq .Condition "slo_burn"}}<tr><td style="color: #656d76;">Route</td><td>{{.Route}}</td></tr>
+<tr><td style="color: #656d76;">Burn rate</td><td><strong>{{printf "%.1f" .BurnRate}}x</strong>, alert at {{printf "%g" .Threshold}}x</td></tr>
+<tr><td style="color: #656d76;">Bad requests</td><td>{{printf "%.2f" .BadPct}}% in {{.WindowMinutes}}m</td></tr>
+<tr><td style="color: #656d76;">Objective</td><td>{{printf "%g" .Objective}}%</td></tr>
+{{else}}<tr><td style="color: #656d76;">Coin</td><td>{{.Coin}}</td></tr>
+<tr><td style="color: #656d76;">Exchange</td><td>{{.Exchange}}</td></tr>
+<tr><td style="color: #656d76;">Condition</td><td>{{.Condition}} {{printf "%g" .Threshold}}{{if eq .Condition "change"}}% in {{.WindowMinutes}}m{{else if eq .Condition "mark_divergence"}} bps{{end}}</td></tr>
+<tr><td style="color: #656d76;">Price</td><td><strong>{{printf "%g" .Price}}</strong></td></tr>
+{{if eq .Condition "mark_divergence"}}<tr><td style="color: #656d76;">Oracle</td><td>{{printf "%g" .Reference}}, mark {{printf "%+.2f" .ChangePct}}%</td></tr>
+{{else if .Reference}}<tr><td style="color: #656d76;">Change</td><td>{{printf "%+.2f" .ChangePct}}% from {{printf "%g" .Reference}}</td></tr>
+{{end}}{{end}}<tr><td style="color: #656d76;">Fired at</td><td>{{.FiredAt.UTC.Format "2006-01-02 15:04:05"}} UTC</td></tr>
+</table>
+</body>
+</html>`
+)
+
+// SMTPServer is the mail server alerts are sent through
+type SMTPServer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// TLS is none, starttls or tls for implicit TLS, usually on port 465
+	TLS  string
+	From string
+}
+
+// Email sends alerts as HTML mail to a list of recipients
+type Email struct {
+	server  SMTPServer
+	to      []string
+	subject *template.Template
+	body    *htmltemplate.Template
+}
+
+// NewEmail creates a notifier mailing to. Empty subject or body templates use
+// DEFAULT_EMAIL_SUBJECT and DEFAULT_EMAIL_TEMPLATE
+func NewEmail(server SMTPServer, to []string, subject, body string) (*Email, error) {
+	if len(to) == 0 {
+		return nil, fmt.Errorf("email notifications need at least one recipient")
+	}
+	for _, address := range append([]string{server.From}, to...) {
+		if _, err := mail.ParseAddress(address); err != nil {
+			return nil, fmt.Errorf("invalid email address %q: %w", address, err)
+		}
+	}
+
+	if subject == "" {
+		subject = DEFAULT_EMAIL_SUBJECT
+	}
+	if body == "" {
+		body = DEFAULT_EMAIL_TEMPLATE
+	}
+
+	subjectTemplate, err := template.New("subject").Parse(subject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email subject template: %w", err)
+	}
+	bodyTemplate, err := htmltemplate.New("body").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email body template: %w", err)
+	}
+
+	return &Email{
+		server:  server,
+		to:      to,
+		subject: subjectTemplate,
+		body:    bodyTemplate,
+	}, nil
+}
+
+func (e *Email) Name() string {
+	return "email"
+}
+
+func (e *Email) Notify(event Event) error {
+	var subject, body strings.Builder
+	if err := e.subject.Execute(&subject, event); err != nil {
+		return fmt.Errorf("failed to render email subject: %w", err)
+	}
+	if err := e.body.Execute(&body, event); err != nil {
+		return fmt.Errorf("failed to render email body: %w", err)
+	}
+	return e.Send(subject.String(), body.String())
+}
+
+// Send mails an HTML body to every recipient
+func (e *Email) Send(subject, html string) error {
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", e.server.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	message.WriteString("\r\n")
+	message.WriteString(html)
+
+	return e.server.send(e.to, message.Bytes())
+}
+
+// bareAddress strips the display name from an address validated by NewEmail
+func bareAddress(address string) string {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return address
+	}
+	return parsed.Address
+}
+
+// send delivers message to recipients over a fresh connection
+func (s SMTPServer) send(recipients []string, message []byte) error {
+	address := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	tlsConfig := &tls.Config{ServerName: s.Host}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: SMTP_TIMEOUT}
+	if s.TLS == SMTP_TLS_IMPLICIT {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	conn.SetDeadline(time.Now().Add(SMTP_TIMEOUT))
+
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if s.TLS == SMTP_TLS_STARTTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(bareAddress(s.From)); err != nil {
+		return fmt.Errorf("MAIL FROM rejected: %w", err)
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(bareAddress(recipient)); err != nil {
+			return fmt.Errorf("recipient %s rejected: %w", recipient, err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("DATA rejected: %w", err)
+	}
+	if _, err := writer.Write(message); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("message rejected: %w", err)
+	}
+
+	return client.Quit()
+}
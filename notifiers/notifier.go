@@ -0,0 +1,89 @@
+// Package notifiers delivers fired price alerts to chat apps and webhooks
+package notifiers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/services"
+)
+
+// CONDITION_SLO_BURN is the condition of events raised for an API SLO
+// burning its error budget rather than by a price alert
+const CONDITION_SLO_BURN = "slo_burn"
+
+// Event is a fired price alert, or an SLO burn alert with Route, Objective,
+// BadPct and BurnRate set. It is also the JSON payload posted to an alert's
+// webhook
+type Event struct {
+	AlertID       uint      `json:"alert_id"`
+	Name          string    `json:"name"`
+	Coin          string    `json:"coin"`
+	Exchange      string    `json:"exchange"`
+	Condition     string    `json:"condition"`
+	Severity      string    `json:"severity,omitempty"`
+	Threshold     float64   `json:"threshold"`
+	Price         float64   `json:"price"`
+	Reference     float64   `json:"reference,omitempty"`
+	ChangePct     float64   `json:"change_pct,omitempty"`
+	WindowMinutes int       `json:"window_minutes,omitempty"`
+	PricedAt      time.Time `json:"priced_at"`
+	FiredAt       time.Time `json:"fired_at"`
+	// Route is the API route of an SLO, Objective its target in percent and
+	// BadPct the share of its requests that failed over WindowMinutes, which
+	// burned the error budget BurnRate times faster than sustainable
+	Route     string  `json:"route,omitempty"`
+	Objective float64 `json:"objective,omitempty"`
+	BadPct    float64 `json:"bad_pct,omitempty"`
+	BurnRate  float64 `json:"burn_rate,omitempty"`
+}
+
+// Notifier delivers fired alerts to one destination
+type Notifier interface {
+	// Name identifies the notifier in logs and metrics
+	Name() string
+	Notify(event Event) error
+}
+
+// Webhook posts events as JSON to a URL
+type Webhook struct {
+	client *services.WebhookClient
+	url    string
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		client: services.NewWebhookClient(),
+		url:    url,
+	}
+}
+
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+func (w *Webhook) Notify(event Event) error {
+	return w.client.Send(w.url, event)
+}
+
+// ForChannel returns the notifier delivering to a notification channel. Email
+// channels are sent through smtp and fail without one
+func ForChannel(channel models.NotificationChannel, smtp *SMTPServer) (Notifier, error) {
+	switch channel.Type {
+	case models.CHANNEL_WEBHOOK:
+		return NewWebhook(channel.Target), nil
+	case models.CHANNEL_SLACK:
+		return NewSlack(channel.Target), nil
+	case models.CHANNEL_DISCORD:
+		return NewDiscord(channel.Target), nil
+	case models.CHANNEL_TELEGRAM:
+		return NewTelegram(channel.Token, channel.Target, "")
+	case models.CHANNEL_EMAIL:
+		if smtp == nil {
+			return nil, fmt.Errorf("email channel %q needs an SMTP server configured", channel.Name)
+		}
+		return NewEmail(*smtp, channel.Recipients(), "", "")
+	}
+	return nil, fmt.Errorf("unknown channel type %q", channel.Type)
+}
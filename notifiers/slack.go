@@ -0,0 +1,57 @@
+package notifiers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/services"
+)
+
+// Slack posts alerts to an incoming webhook as mrkdwn text
+type Slack struct {
+	client *services.WebhookClient
+	url    string
+}
+
+func NewSlack(url string) *Slack {
+	return &Slack{
+		client: services.NewWebhookClient(),
+		url:    url,
+	}
+}
+
+func (s *Slack) Name() string {
+	return "slack"
+}
+
+func (s *Slack) Notify(event Event) error {
+	return s.client.SendSlack(s.url, slackText(event))
+}
+
+// slackText formats event as a short mrkdwn message
+func slackText(event Event) string {
+	var text strings.Builder
+	if event.Condition == CONDITION_SLO_BURN {
+		fmt.Fprintf(&text, "*%s*: %s burning its error budget at %.1fx, alert at %gx", event.Name, event.Route, event.BurnRate, event.Threshold)
+		fmt.Fprintf(&text, "\n`%.2f%%` of requests bad in %dm against a %g%% objective", event.BadPct, event.WindowMinutes, event.Objective)
+		return text.String()
+	}
+	fmt.Fprintf(&text, "*%s*: %s %s %g", event.Name, event.Coin, event.Condition, event.Threshold)
+	switch event.Condition {
+	case models.ALERT_CHANGE:
+		fmt.Fprintf(&text, "%% in %dm", event.WindowMinutes)
+	case models.ALERT_MARK_DIVERGENCE:
+		text.WriteString(" bps")
+	}
+
+	if event.Condition == models.ALERT_MARK_DIVERGENCE {
+		fmt.Fprintf(&text, "\nMark `%g` on %s, %+.2f%% from oracle `%g`", event.Price, event.Exchange, event.ChangePct, event.Reference)
+		return text.String()
+	}
+	fmt.Fprintf(&text, "\nPrice `%g` on %s", event.Price, event.Exchange)
+	if event.Reference != 0 {
+		fmt.Fprintf(&text, ", %+.2f%% from `%g`", event.ChangePct, event.Reference)
+	}
+	return text.String()
+}
@@ -0,0 +1,58 @@
+package notifiers
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/notblessy/dexlite/services"
+)
+
+// DEFAULT_TELEGRAM_TEMPLATE is used when no template is configured. Templates
+// are text/template strings executed with the Event
+const DEFAULT_TELEGRAM_TEMPLATE = `{{.Name}}
+{{if eq .Condition "slo_burn"}}{{.Route}} burning its error budget at {{printf "%.1f" .BurnRate}}x, alert at {{printf "%g" .Threshold}}x
+Bad requests: {{printf "%.2f" .BadPct}}% in {{.WindowMinutes}}m, objective {{printf "%g" .Objective}}%{{else}}{{.Coin}} {{.Condition}} {{printf "%g" .Threshold}}{{if eq .Condition "change"}}% in {{.WindowMinutes}}m{{else if eq .Condition "mark_divergence"}} bps{{end}}
+{{if eq .Condition "mark_divergence"}}Mark: {{printf "%g" .Price}} on {{.Exchange}}
+Oracle: {{printf "%g" .Reference}}, {{printf "%+.2f" .ChangePct}}%{{else}}Price: {{printf "%g" .Price}} on {{.Exchange}}{{if .Reference}}
+Change: {{printf "%+.2f" .ChangePct}}% from {{printf "%g" .Reference}}{{end}}{{end}}{{end}}`
+
+// Telegram sends alerts to a chat through a bot
+type Telegram struct {
+	client   *services.WebhookClient
+	token    string
+	chatID   string
+	template *template.Template
+}
+
+// NewTelegram creates a notifier posting as the bot with token to chatID. An
+// empty text uses DEFAULT_TELEGRAM_TEMPLATE
+func NewTelegram(token, chatID, text string) (*Telegram, error) {
+	if text == "" {
+		text = DEFAULT_TELEGRAM_TEMPLATE
+	}
+
+	tmpl, err := template.New("telegram").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid telegram template: %w", err)
+	}
+
+	return &Telegram{
+		client:   services.NewWebhookClient(),
+		token:    token,
+		chatID:   chatID,
+		template: tmpl,
+	}, nil
+}
+
+func (t *Telegram) Name() string {
+	return "telegram"
+}
+
+func (t *Telegram) Notify(event Event) error {
+	var message strings.Builder
+	if err := t.template.Execute(&message, event); err != nil {
+		return fmt.Errorf("failed to render telegram message: %w", err)
+	}
+	return t.client.SendTelegram(t.token, t.chatID, message.String())
+}
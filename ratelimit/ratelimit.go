@@ -0,0 +1,165 @@
+// Package ratelimit throttles API clients with token buckets, kept in memory
+// for a single instance or in Redis to share them between instances
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/notblessy/dexlite/redis"
+)
+
+// Limit is a token bucket refilled at Rate tokens per second and holding at
+// most Burst
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Decision is the outcome of taking one token from a bucket
+type Decision struct {
+	Allowed bool
+	// Remaining is how many whole tokens are left
+	Remaining int
+	// RetryAfter is how long until a token is available when not allowed
+	RetryAfter time.Duration
+}
+
+// Store holds the buckets, one per key
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Decision, error)
+}
+
+// MemoryStore keeps buckets in process memory. It is safe for concurrent use
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	at     time.Time
+	// full is when the bucket will have refilled, after which it can be
+	// forgotten
+	full time.Time
+}
+
+// MEMORY_SWEEP_INTERVAL is how often refilled buckets are dropped
+const MEMORY_SWEEP_INTERVAL = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Decision, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= MEMORY_SWEEP_INTERVAL {
+		for k, b := range s.buckets {
+			if now.After(b.full) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), at: now}
+		s.buckets[key] = b
+	}
+
+	tokens, decision := take(b.tokens, now.Sub(b.at).Seconds(), limit)
+	b.tokens = tokens
+	b.at = now
+	b.full = now.Add(seconds((float64(limit.Burst) - tokens) / limit.Rate))
+	return decision, nil
+}
+
+// take refills tokens for elapsed seconds and takes one if available,
+// returning what is left
+func take(tokens, elapsed float64, limit Limit) (float64, Decision) {
+	tokens = math.Min(float64(limit.Burst), tokens+elapsed*limit.Rate)
+	if tokens >= 1 {
+		tokens--
+		return tokens, Decision{Allowed: true, Remaining: int(tokens)}
+	}
+	return tokens, Decision{RetryAfter: seconds((1 - tokens) / limit.Rate)}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// RedisStore keeps buckets in Redis so every instance behind a load balancer
+// enforces the same limit. Buckets are updated by a script, atomically, on
+// the Redis clock
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore creates a store keeping buckets under prefix
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// takeScript refills and takes from the bucket in KEYS[1] given the rate per
+// second and burst, returning {allowed, remaining, retry after in ms}. An
+// idle bucket expires once it would have refilled
+const takeScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'at')
+local tokens = tonumber(bucket[1]) or burst
+local at = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - at) / 1000 * rate)
+
+local allowed, wait = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate * 1000)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'at', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return {allowed, math.floor(tokens), wait}
+`
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (Decision, error) {
+	reply, err := s.client.Eval(ctx, takeScript, []string{s.prefix + key}, limit.Rate, limit.Burst)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	values, _ := reply.([]any)
+	if len(values) != 3 {
+		return Decision{}, redis.Error("unexpected rate limit script reply")
+	}
+	allowed, _ := values[0].(int64)
+	remaining, _ := values[1].(int64)
+	wait, _ := values[2].(int64)
+
+	return Decision{
+		Allowed:    allowed == 1,
+		Remaining:  int(remaining),
+		RetryAfter: time.Duration(wait) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,335 @@
+// Package redis is a minimal Redis client speaking RESP2 over a small pool
+// of connections, covering the few commands dexlite needs
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_POOL_SIZE    = 8
+	DEFAULT_DIAL_TIMEOUT = 5 * time.Second
+	// DEFAULT_IO_TIMEOUT bounds a command when the context has no deadline
+	DEFAULT_IO_TIMEOUT = 3 * time.Second
+)
+
+// ErrNil is returned for a nil reply, e.g. GET of a missing key
+var ErrNil = errors.New("redis: nil")
+
+// Error is an error reply from the server
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// Client sends commands to one Redis server. It is safe for concurrent use
+type Client struct {
+	addr     string
+	username string
+	password string
+	db       int
+	tls      *tls.Config
+
+	idle chan *conn
+}
+
+// NewClient creates a client for a redis:// or rediss:// URL, e.g.
+// redis://:password@localhost:6379/0. Connections are opened on demand
+func NewClient(rawURL string) (*Client, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("redis: invalid URL: %w", err)
+	}
+
+	client := &Client{
+		addr: parsed.Host,
+		idle: make(chan *conn, DEFAULT_POOL_SIZE),
+	}
+	switch parsed.Scheme {
+	case "redis":
+	case "rediss":
+		client.tls = &tls.Config{ServerName: parsed.Hostname()}
+	default:
+		return nil, fmt.Errorf("redis: URL scheme must be redis or rediss, got %q", parsed.Scheme)
+	}
+	if parsed.Port() == "" {
+		client.addr = net.JoinHostPort(parsed.Hostname(), "6379")
+	}
+
+	if parsed.User != nil {
+		client.username = parsed.User.Username()
+		client.password, _ = parsed.User.Password()
+	}
+	if path := strings.TrimPrefix(parsed.Path, "/"); path != "" {
+		db, err := strconv.Atoi(path)
+		if err != nil || db < 0 {
+			return nil, fmt.Errorf("redis: database %q is not a number", path)
+		}
+		client.db = db
+	}
+
+	return client, nil
+}
+
+// Do sends one command and returns its reply: a string, int64, []any or nil.
+// Error replies are returned as Error
+func (c *Client) Do(ctx context.Context, args ...any) (any, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := cn.do(ctx, args)
+	var replyErr Error
+	if err != nil && !errors.As(err, &replyErr) {
+		// The connection state is unknown after an I/O error
+		cn.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return reply, err
+}
+
+// Ping checks the server is reachable
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Get returns the value of key, or ErrNil when it doesn't exist
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	reply, err := c.Do(ctx, "GET", key)
+	if err != nil {
+		return "", err
+	}
+	if reply == nil {
+		return "", ErrNil
+	}
+	return reply.(string), nil
+}
+
+// Set stores value under key, expiring after ttl when it is positive
+func (c *Client) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	args := []any{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", ttl.Milliseconds())
+	}
+	_, err := c.Do(ctx, args...)
+	return err
+}
+
+// Del removes keys and returns how many existed
+func (c *Client) Del(ctx context.Context, keys ...string) (int64, error) {
+	args := make([]any, 0, len(keys)+1)
+	args = append(args, "DEL")
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := reply.(int64)
+	return n, nil
+}
+
+// Eval runs a Lua script over keys with args
+func (c *Client) Eval(ctx context.Context, script string, keys []string, args ...any) (any, error) {
+	command := make([]any, 0, len(keys)+len(args)+3)
+	command = append(command, "EVAL", script, len(keys))
+	for _, key := range keys {
+		command = append(command, key)
+	}
+	command = append(command, args...)
+	return c.Do(ctx, command...)
+}
+
+// Close closes the idle connections
+func (c *Client) Close() error {
+	for {
+		select {
+		case cn := <-c.idle:
+			cn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// get takes an idle connection or dials a new one
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+
+	dialer := &net.Dialer{Timeout: DEFAULT_DIAL_TIMEOUT}
+	var raw net.Conn
+	var err error
+	if c.tls != nil {
+		raw, err = (&tls.Dialer{NetDialer: dialer, Config: c.tls}).DialContext(ctx, "tcp", c.addr)
+	} else {
+		raw, err = dialer.DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+
+	cn := &conn{Conn: raw, reader: bufio.NewReader(raw)}
+	if c.password != "" {
+		args := []any{"AUTH", c.password}
+		if c.username != "" {
+			args = []any{"AUTH", c.username, c.password}
+		}
+		if _, err := cn.do(ctx, args); err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := cn.do(ctx, []any{"SELECT", c.db}); err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// put returns a healthy connection to the pool, closing it when the pool is full
+func (c *Client) put(cn *conn) {
+	select {
+	case c.idle <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+// conn is a pooled connection, used by one command at a time
+type conn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (cn *conn) do(ctx context.Context, args []any) (any, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DEFAULT_IO_TIMEOUT)
+	}
+	cn.SetDeadline(deadline)
+
+	if _, err := cn.Write(encode(args)); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	return readReply(cn.reader)
+}
+
+// encode writes a command as a RESP array of bulk strings
+func encode(args []any) []byte {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		var value string
+		switch v := arg.(type) {
+		case string:
+			value = v
+		case []byte:
+			value = string(v)
+		case int:
+			value = strconv.Itoa(v)
+		case int64:
+			value = strconv.FormatInt(v, 10)
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			value = fmt.Sprint(v)
+		}
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(value)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, value...)
+		buf = append(buf, '\r', '\n')
+	}
+	return buf
+}
+
+// readReply reads one RESP2 reply
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	payload := line[1:]
+	switch line[0] {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, Error(payload)
+	case ':':
+		n, err := strconv.ParseInt(payload, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid integer reply %q", payload)
+		}
+		return n, nil
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", payload)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length %q", payload)
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		// An error nested in the array fails the reply, but the rest is still
+		// read so the connection stays usable
+		items := make([]any, count)
+		var replyErr error
+		for i := range items {
+			items[i], err = readReply(r)
+			var nested Error
+			if errors.As(err, &nested) {
+				replyErr = err
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if replyErr != nil {
+			return nil, replyErr
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
@@ -0,0 +1,135 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+const awsService = "secretsmanager"
+
+// AWSStore reads a JSON secret from AWS Secrets Manager. Requests are signed
+// with the standard AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and optional
+// AWS_SESSION_TOKEN environment variables, read on every fetch so refreshed
+// session credentials are picked up
+type AWSStore struct {
+	client   *http.Client
+	region   string
+	secretID string
+	endpoint string
+}
+
+// NewAWSStore reads the secret named secretID in region
+func NewAWSStore(region, secretID string) *AWSStore {
+	return &AWSStore{
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		region:   region,
+		secretID: secretID,
+		endpoint: fmt.Sprintf("https://%s.%s.amazonaws.com/", awsService, region),
+	}
+}
+
+type awsSecretValue struct {
+	SecretString string `json:"SecretString"`
+}
+
+func (a *AWSStore) Fetch(ctx context.Context) (map[string]string, error) {
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required")
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": a.secretID})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	a.sign(req, body, accessKey, secretKey, time.Now().UTC())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read AWS secret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("secrets manager returned status %d for %s", resp.StatusCode, a.secretID)
+	}
+
+	var value awsSecretValue
+	if err := json.Unmarshal(respBody, &value); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets manager response: %w", err)
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal([]byte(value.SecretString), &values); err != nil {
+		return nil, fmt.Errorf("secret %s is not a JSON object of key/value pairs", a.secretID)
+	}
+	return stringValues(values), nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req
+func (a *AWSStore) sign(req *http.Request, body []byte, accessKey, secretKey string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	signedHeaders := "content-type;host;x-amz-date;x-amz-target"
+	canonicalHeaders := "content-type:" + req.Header.Get("Content-Type") + "\n" +
+		"host:" + req.URL.Host + "\n" +
+		"x-amz-date:" + amzDate + "\n" +
+		"x-amz-target:" + req.Header.Get("X-Amz-Target") + "\n"
+	if token := req.Header.Get("X-Amz-Security-Token"); token != "" {
+		signedHeaders = "content-type;host;x-amz-date;x-amz-security-token;x-amz-target"
+		canonicalHeaders = "content-type:" + req.Header.Get("Content-Type") + "\n" +
+			"host:" + req.URL.Host + "\n" +
+			"x-amz-date:" + amzDate + "\n" +
+			"x-amz-security-token:" + token + "\n" +
+			"x-amz-target:" + req.Header.Get("X-Amz-Target") + "\n"
+	}
+
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := req.Method + "\n/\n\n" + canonicalHeaders + "\n" + signedHeaders + "\n" + hex.EncodeToString(payloadHash[:])
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + a.region + "/" + awsService + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, a.region)
+	key = hmacSHA256(key, awsService)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,97 @@
+// Package secrets loads source credentials from an external secret store and
+// keeps them up to date as they are rotated
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/notblessy/dexlite/services"
+	"github.com/rs/zerolog/log"
+)
+
+// Providers accepted by the secrets configuration
+const (
+	PROVIDER_VAULT = "vault"
+	PROVIDER_AWS   = "aws"
+)
+
+// Store is a secret store holding credentials as named string values, e.g.
+// COINGECKO_API_KEY
+type Store interface {
+	Fetch(ctx context.Context) (map[string]string, error)
+}
+
+// stringValues converts decoded JSON secret values to strings
+func stringValues(values map[string]any) map[string]string {
+	secrets := make(map[string]string, len(values))
+	for name, value := range values {
+		if s, ok := value.(string); ok {
+			secrets[name] = s
+			continue
+		}
+		secrets[name] = fmt.Sprint(value)
+	}
+	return secrets
+}
+
+// Rotator periodically fetches secrets and hands them to every source in the
+// registry that accepts rotated credentials
+type Rotator struct {
+	store    Store
+	registry *services.Registry
+	interval time.Duration
+}
+
+func NewRotator(store Store, registry *services.Registry, interval time.Duration) *Rotator {
+	return &Rotator{
+		store:    store,
+		registry: registry,
+		interval: interval,
+	}
+}
+
+func (r *Rotator) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Secret rotator shutting down")
+			return
+		case <-ticker.C:
+			if err := r.Rotate(ctx); err != nil {
+				log.Error().Err(err).Msg("Error rotating source credentials, keeping current ones")
+			}
+		}
+	}
+}
+
+// Rotate fetches the current secrets once and applies them
+func (r *Rotator) Rotate(ctx context.Context) error {
+	secrets, err := r.store.Fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	sources := r.registry.Sources()
+	if fallback := r.registry.Fallback(); fallback != nil {
+		sources = append(sources, fallback)
+	}
+
+	var errs []error
+	for _, source := range sources {
+		credentialSource, ok := source.(services.CredentialSource)
+		if !ok {
+			continue
+		}
+		if err := credentialSource.RotateCredentials(secrets); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,72 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VaultStore reads a secret from HashiCorp Vault over its HTTP API. Both KV
+// version 1 and 2 engines are supported
+type VaultStore struct {
+	client  *http.Client
+	address string
+	token   string
+	path    string
+}
+
+// NewVaultStore reads the secret at path, the API path after /v1/, e.g.
+// secret/data/dexlite for a KV v2 engine mounted at secret
+func NewVaultStore(address, token, path string) *VaultStore {
+	return &VaultStore{
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		path:    strings.Trim(path, "/"),
+	}
+}
+
+type vaultResponse struct {
+	Data map[string]any `json:"data"`
+}
+
+func (v *VaultStore) Fetch(ctx context.Context) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", v.address+"/v1/"+v.path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault secret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault returned status %d for %s", resp.StatusCode, v.path)
+	}
+
+	var parsed vaultResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse vault response: %w", err)
+	}
+
+	// KV v2 nests the values one level deeper, next to the version metadata
+	if nested, ok := parsed.Data["data"].(map[string]any); ok {
+		if _, versioned := parsed.Data["metadata"]; versioned {
+			return stringValues(nested), nil
+		}
+	}
+	return stringValues(parsed.Data), nil
+}
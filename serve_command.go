@@ -0,0 +1,925 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/notblessy/dexlite/access"
+	"github.com/notblessy/dexlite/auth"
+	"github.com/notblessy/dexlite/cache"
+	"github.com/notblessy/dexlite/clickhouse"
+	"github.com/notblessy/dexlite/config"
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/handlers"
+	"github.com/notblessy/dexlite/logging"
+	"github.com/notblessy/dexlite/metrics"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/notifiers"
+	"github.com/notblessy/dexlite/ratelimit"
+	"github.com/notblessy/dexlite/redis"
+	"github.com/notblessy/dexlite/secrets"
+	"github.com/notblessy/dexlite/services"
+	"github.com/notblessy/dexlite/storage"
+	"github.com/notblessy/dexlite/stream"
+	"github.com/notblessy/dexlite/symbols"
+	"github.com/notblessy/dexlite/tracing"
+	"github.com/notblessy/dexlite/workers"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+func newServeCommand(cfg *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "run the HTTP API and every worker (default)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exit(runServe(cfg))
+		},
+	}
+}
+
+// server is everything `dexlite serve` runs. Each setup method builds one
+// subsystem from the ones set up before it
+type server struct {
+	cfg      *config.Config
+	database *gorm.DB
+
+	tracing         bool
+	shutdownTracing func(context.Context) error
+
+	secretStore secrets.Store
+	registry    *services.Registry
+	writeGate   *db.WriteGate
+
+	persister     *db.Persister
+	priceStream   *stream.Hub
+	opportunities *stream.Opportunities
+	responseCache *cache.Cache
+	storageMirror *storage.Mirror
+
+	sessions          *models.Sessions
+	retentionRules    []workers.RetentionRule
+	priceFetcher      *workers.PriceFetcher
+	cleanupWorker     *workers.CleanupWorker
+	candleBuilder     *workers.CandleBuilder
+	spreadMonitor     *workers.SpreadMonitor
+	alertEvaluator    *workers.AlertEvaluator
+	fundingFetcher    *workers.FundingFetcher
+	orderbookRecorder *workers.OrderbookRecorder
+	nativeSymbols     *workers.NativeSymbols
+	backfiller        *workers.Backfiller
+	incidentTracker   *workers.IncidentTracker
+	jobRunner         *workers.JobRunner
+
+	alertNotifiers []notifiers.Notifier
+	smtpServer     *notifiers.SMTPServer
+
+	sloTracker *metrics.SLOTracker
+	sloMonitor *workers.SLOMonitor
+	sloWindows []time.Duration
+
+	clockMonitor   *services.ClockMonitor
+	circuitBreaker *services.CircuitBreaker
+	priceBounds    *workers.PriceBounds
+
+	// Workers are grouped by when they stop on shutdown: ingestion first so
+	// nothing new arrives, then the sinks fed by stored prices so their queues
+	// drain, then everything else
+	ingestion  *componentGroup
+	sinks      *componentGroup
+	background *componentGroup
+}
+
+// runServe implements `dexlite serve`, the default command: the HTTP API and
+// every worker until interrupted
+func runServe(cfg *config.Config) int {
+	// Create context for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := &server{cfg: cfg}
+	s.setupDatabase()
+	s.setupSources(ctx)
+	s.setupPersistence()
+	s.setupWorkers()
+	s.setupNotifiers()
+	s.setupSLOs()
+	s.instrumentSources()
+	s.guardPrices()
+	s.startWorkers(ctx)
+	s.serveHTTP(ctx, s.newRouter())
+
+	log.Info().Msg("Application shutdown complete")
+	return 0
+}
+
+// setupDatabase opens and migrates the database and reconciles what config
+// declares into it
+func (s *server) setupDatabase() {
+	cfg := s.cfg
+	s.database = openDatabase(cfg)
+
+	// Export spans for fetches, queries and API requests when a collector is set
+	s.tracing = cfg.Tracing.Endpoint != ""
+	s.shutdownTracing = func(context.Context) error { return nil }
+	if s.tracing {
+		var err error
+		s.shutdownTracing, err = tracing.Setup(context.Background(), cfg.Tracing.Endpoint, cfg.Tracing.SampleRatio)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to set up tracing")
+		}
+		if err := s.database.Use(tracing.GORMPlugin{}); err != nil {
+			log.Fatal().Err(err).Msg("Failed to instrument database")
+		}
+		log.Info().Str("endpoint", cfg.Tracing.Endpoint).Msg("OpenTelemetry tracing enabled")
+	}
+
+	// Requests made with a scoped API key only read their coins
+	if err := s.database.Use(access.GORMPlugin{}); err != nil {
+		log.Fatal().Err(err).Msg("Failed to install coin access scoping")
+	}
+
+	prepareSchema(cfg, s.database)
+
+	// Seed tracked coins from config on first start, the admin API manages them after that
+	if err := db.SeedTrackedCoins(s.database, cfg.Fetcher.Coins); err != nil {
+		log.Fatal().Err(err).Msg("Failed to seed tracked coins")
+	}
+
+	// Alert channels and rules declared in config replace their managed rows
+	declaredChannels, declaredAlerts, err := declaredAlerting(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid alerting configuration")
+	}
+	if err := db.ReconcileAlerting(s.database, declaredChannels, declaredAlerts); err != nil {
+		log.Fatal().Err(err).Msg("Failed to reconcile alerting configuration")
+	}
+
+	log.Info().Msg("Database initialized and migrated successfully")
+
+	// Workers hold this gate while writing so migrations can pause them
+	s.writeGate = db.NewWriteGate(s.database)
+}
+
+// setupSources registers the price sources, with their credentials
+func (s *server) setupSources(ctx context.Context) {
+	cfg := s.cfg
+
+	// Credentials from a secret store take precedence over the config file
+	s.secretStore = newSecretStore(cfg)
+	if s.secretStore != nil {
+		if err := applySecrets(ctx, s.secretStore, cfg); err != nil {
+			log.Fatal().Err(err).Msg("Failed to load secrets")
+		}
+		log.Info().Str("provider", cfg.Secrets.Provider).Msg("Source credentials loaded from secret store")
+	}
+
+	registry, err := newRegistry(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create price sources")
+	}
+	s.registry = registry
+}
+
+// setupPersistence sets up the persister and everything a stored price is
+// passed on to: the stream, the response cache and the storage mirror
+func (s *server) setupPersistence() {
+	cfg := s.cfg
+
+	// Prices that fail to persist are dead-lettered, pick up any left in the
+	// file while the database was unreachable
+	s.persister = db.NewPersister(s.database, cfg.Database.DeadLetterFile)
+	s.priceStream = stream.NewHub()
+	s.persister.SetHub(s.priceStream)
+	if cfg.Server.Region != "" {
+		s.persister.SetRegion(cfg.Server.Region)
+		log.Info().Str("region", cfg.Server.Region).Msg("Tagging collected prices with region")
+	}
+	// Hot reads are cached in Redis when configured, dropped whenever a coin
+	// gets a new price
+	if cfg.Cache.RedisURL != "" {
+		client, err := redis.NewClient(cfg.Cache.RedisURL)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create response cache client")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := client.Ping(ctx); err != nil {
+			// Reads go to the database until Redis is reachable
+			log.Warn().Err(err).Msg("Response cache Redis unreachable")
+		}
+		cancel()
+		s.responseCache = cache.New(client, "dexlite:cache:")
+		s.persister.SetCache(s.responseCache)
+		log.Info().Dur("latest_ttl", cfg.Cache.LatestTTL).Dur("comparison_ttl", cfg.Cache.ComparisonTTL).Msg("Response cache enabled")
+	}
+	// While migrating storage, every price stored is copied to the target too
+	if cfg.StorageMigration.DualWrite {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		target, err := storage.Open(ctx, cfg.StorageMigration.Target, cfg.StorageMigration.TargetDSN, cfg.StorageMigration.TargetTable)
+		cancel()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to open the storage migration target")
+		}
+		s.storageMirror = storage.NewMirror(target, storage.DEFAULT_MIRROR_INTERVAL)
+		s.persister.SetMirror(s.storageMirror)
+		log.Info().Str("target", cfg.StorageMigration.Target).Msg("Dual-writing prices to the storage migration target")
+	}
+	if imported, err := s.persister.ImportFile(); err != nil {
+		log.Warn().Err(err).Msg("Failed to import dead letter file")
+	} else if imported > 0 {
+		log.Info().Int("rows", imported).Msg("Imported dead letters from file")
+	}
+}
+
+// setupWorkers creates the workers, started later by startWorkers
+func (s *server) setupWorkers() {
+	cfg := s.cfg
+	database, gate, registry := s.database, s.writeGate, s.registry
+
+	s.priceFetcher = workers.NewPriceFetcher(database, registry, gate, s.persister, cfg.Fetcher.Coins, cfg.Fetcher.Interval)
+	s.priceFetcher.SetMaxWatched(cfg.Accounts.MaxWatched)
+	coins := s.priceFetcher.Coins
+
+	// Daily, weekly and monthly bars follow the configured session boundary
+	sessions, err := newSessions(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load session timezone")
+	}
+	s.sessions = sessions
+	s.retentionRules = newRetentionRules(cfg)
+	s.cleanupWorker = newCleanupWorker(cfg, database, gate, s.retentionRules, sessions)
+	s.candleBuilder = workers.NewCandleBuilder(database, gate, sessions, cfg.Fetcher.CandleInterval, cfg.Retention.RawPrices)
+	s.spreadMonitor = workers.NewSpreadMonitor(database, gate, coins, cfg.Spreads.ThresholdBps, cfg.Spreads.MaxAge, cfg.Spreads.Interval)
+	s.opportunities = stream.NewOpportunities()
+	s.spreadMonitor.SetOpportunities(s.opportunities)
+	s.alertEvaluator = workers.NewAlertEvaluator(database, gate, s.priceStream, cfg.Alerts.Interval)
+	s.fundingFetcher = workers.NewFundingFetcher(database, gate, registry, coins, cfg.Funding.Interval)
+	s.orderbookRecorder = workers.NewOrderbookRecorder(database, gate, registry, coins, cfg.Orderbook.Levels, cfg.Orderbook.Interval)
+	s.nativeSymbols = workers.NewNativeSymbols(registry, coins, cfg.Exchanges.SymbolsInterval)
+	s.backfiller = workers.NewBackfiller(database, gate, s.persister, registry, coins, cfg.Fetcher.Interval, cfg.Fetcher.HistoryBackfill, workers.DEFAULT_BACKFILL_INTERVAL)
+	s.backfiller.SetCandleBuilder(s.candleBuilder)
+	s.incidentTracker = workers.NewIncidentTracker(database, gate, services.NewStatuspageClient(), cfg.Exchanges.StatusPages, cfg.Exchanges.StatusPagesInterval)
+	// Expensive analytics run as jobs the API hands out and clients poll
+	s.jobRunner = workers.NewJobRunner(database, gate, cfg.Jobs.Workers, cfg.Jobs.Timeout, cfg.Jobs.ResultTTL, cfg.Jobs.PollInterval)
+	s.jobRunner.Register(models.JOB_CORRELATION, workers.NewCorrelationJob(database))
+}
+
+// setupNotifiers creates the configured alert notifiers and hands them to
+// the alert evaluator
+func (s *server) setupNotifiers() {
+	cfg := s.cfg
+
+	if cfg.Alerts.Telegram.BotToken != "" {
+		telegram, err := notifiers.NewTelegram(cfg.Alerts.Telegram.BotToken, cfg.Alerts.Telegram.ChatID, cfg.Alerts.Telegram.Template)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create Telegram notifier")
+		}
+		s.alertNotifiers = append(s.alertNotifiers, telegram)
+		s.alertEvaluator.SetTelegramBot(cfg.Alerts.Telegram.BotToken)
+		log.Info().Str("chat_id", cfg.Alerts.Telegram.ChatID).Msg("Telegram alert notifications enabled")
+	}
+	if cfg.Alerts.Discord.WebhookURL != "" {
+		s.alertNotifiers = append(s.alertNotifiers, notifiers.NewDiscord(cfg.Alerts.Discord.WebhookURL))
+		log.Info().Msg("Discord alert notifications enabled")
+	}
+	if cfg.Alerts.Slack.WebhookURL != "" {
+		s.alertNotifiers = append(s.alertNotifiers, notifiers.NewSlack(cfg.Alerts.Slack.WebhookURL))
+		log.Info().Msg("Slack alert notifications enabled")
+	}
+	if cfg.Alerts.Email.Host != "" {
+		s.smtpServer = &notifiers.SMTPServer{
+			Host:     cfg.Alerts.Email.Host,
+			Port:     cfg.Alerts.Email.Port,
+			Username: cfg.Alerts.Email.Username,
+			Password: cfg.Alerts.Email.Password,
+			TLS:      cfg.Alerts.Email.TLS,
+			From:     cfg.Alerts.Email.From,
+		}
+		s.alertEvaluator.SetSMTPServer(s.smtpServer)
+		if len(cfg.Alerts.Email.To) > 0 {
+			email, err := notifiers.NewEmail(*s.smtpServer, cfg.Alerts.Email.To, cfg.Alerts.Email.Subject, cfg.Alerts.Email.Template)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Failed to create email notifier")
+			}
+			s.alertNotifiers = append(s.alertNotifiers, email)
+		}
+		log.Info().Str("host", cfg.Alerts.Email.Host).Strs("to", cfg.Alerts.Email.To).Msg("Email alert notifications enabled")
+	}
+	for _, notifier := range s.alertNotifiers {
+		s.alertEvaluator.AddNotifier(notifier)
+	}
+}
+
+// setupSLOs tracks SLOs on the API routes and watches their error budgets
+func (s *server) setupSLOs() {
+	cfg := s.cfg
+	if len(cfg.SLO.Objectives) == 0 {
+		return
+	}
+
+	slos := make([]metrics.SLO, len(cfg.SLO.Objectives))
+	for i, objective := range cfg.SLO.Objectives {
+		slos[i] = metrics.SLO{
+			Name:      objective.Name,
+			Method:    strings.ToUpper(objective.Method),
+			Route:     objective.Route,
+			Latency:   objective.Latency,
+			Objective: objective.Target / 100,
+		}
+	}
+	span := time.Hour
+	alerts := make([]workers.BurnAlert, len(cfg.SLO.BurnAlerts))
+	for i, alert := range cfg.SLO.BurnAlerts {
+		alerts[i] = workers.BurnAlert{Long: alert.Long, Short: alert.Short, Rate: alert.Rate}
+		for _, window := range []time.Duration{alert.Short, alert.Long} {
+			if !slices.Contains(s.sloWindows, window) {
+				s.sloWindows = append(s.sloWindows, window)
+			}
+		}
+		if alert.Long > span {
+			span = alert.Long
+		}
+	}
+	s.sloTracker = metrics.NewSLOTracker(slos, span)
+	s.sloMonitor = workers.NewSLOMonitor(s.database, s.writeGate, s.sloTracker, alerts, cfg.SLO.Interval)
+	if cfg.SLO.Notify {
+		for _, notifier := range s.alertNotifiers {
+			s.sloMonitor.AddNotifier(notifier)
+		}
+		s.sloMonitor.SetChannel(cfg.SLO.Channel, s.smtpServer)
+	}
+}
+
+// instrumentSources wraps the transports of the price sources with retries,
+// tracing and the monitors that watch their responses
+func (s *server) instrumentSources() {
+	cfg := s.cfg
+
+	// Report data anomalies to ops when a webhook is configured
+	var detector *workers.AnomalyDetector
+	if cfg.Anomaly.WebhookURL != "" {
+		detector = workers.NewAnomalyDetector(
+			cfg.Anomaly.WebhookURL,
+			cfg.Anomaly.DivergencePct,
+			cfg.Anomaly.JumpPct,
+			cfg.Anomaly.FrozenCycles,
+		)
+		detector.SetThresholds(workers.NewMoveThresholds(cfg.Precision.MinMovePct, cfg.Precision.Coins))
+		s.priceFetcher.SetAnomalyDetector(detector)
+		log.Info().Msg("Anomaly webhook enabled")
+	}
+
+	// Retry transient exchange failures. This wraps the transports first so
+	// the monitors below only see the final response
+	services.RetryPolicy{
+		Attempts:  cfg.Exchanges.Retry.Attempts,
+		BaseDelay: cfg.Exchanges.Retry.BaseDelay,
+		MaxDelay:  cfg.Exchanges.Retry.MaxDelay,
+	}.Instrument(s.registry)
+
+	// Export connection reuse and DNS/TLS timings of exchange clients
+	services.TraceTransports(s.registry)
+
+	// Watch exchange responses for fields appearing or disappearing
+	schemaMonitor := services.NewSchemaMonitor(func(drift services.SchemaDrift) {
+		log.Warn().Str("exchange", drift.Source).Str("endpoint", drift.Endpoint).Strs("added", drift.Added).Strs("removed", drift.Removed).Msg("Schema drift detected")
+		if detector != nil {
+			detector.ReportSchemaDrift(drift)
+		}
+	})
+	schemaMonitor.Instrument(s.registry)
+
+	// Measure each source's clock so venue timestamps can be corrected
+	s.clockMonitor = services.NewClockMonitor()
+	s.clockMonitor.Instrument(s.registry)
+	s.priceFetcher.SetClockMonitor(s.clockMonitor)
+
+	// Span each exchange request including its retries
+	if s.tracing {
+		tracing.InstrumentTransports(s.registry)
+	}
+}
+
+// guardPrices sets up what the price fetcher checks and derives from each
+// fetched price before it is stored
+func (s *server) guardPrices() {
+	cfg := s.cfg
+
+	// Stop polling sources that keep failing until they recover
+	s.circuitBreaker = services.NewCircuitBreaker(cfg.Exchanges.Breaker.Failures, cfg.Exchanges.Breaker.Cooldown)
+	s.priceFetcher.SetCircuitBreaker(s.circuitBreaker)
+
+	// Reject corrupt values such as 0, NaN or 1e15 before they are stored
+	bounds := make(map[string]workers.Bound, len(cfg.Sanity.Coins))
+	for coin, bound := range cfg.Sanity.Coins {
+		bounds[coin] = workers.Bound{Min: bound.Min, Max: bound.Max}
+	}
+	s.priceBounds = workers.NewPriceBounds(bounds, cfg.Sanity.MaxFactor)
+	if err := s.priceBounds.Seed(s.database); err != nil {
+		log.Warn().Err(err).Msg("Failed to seed price bounds from stored prices")
+	}
+	s.priceFetcher.SetPriceBounds(s.priceBounds)
+	s.priceFetcher.SetIndexPricer(workers.NewIndexPricer(s.database, cfg.Index.Quorum, cfg.Index.MaxAge))
+	markTracker := workers.NewMarkTracker(s.database, s.writeGate, s.registry, cfg.Marks.DivergenceBps)
+	markTracker.SetAlertEvaluator(s.alertEvaluator)
+	s.priceFetcher.SetMarkTracker(markTracker)
+
+	// Score sources so the ranking, and with promotion the failover, prefer the best feed
+	qualityScorer := workers.NewQualityScorer(s.database, cfg.Quality.OutlierPct, cfg.Quality.Window)
+	if cfg.Quality.Promote {
+		qualityScorer.SetPromotion(s.registry, cfg.Quality.PromoteMargin)
+		log.Info().Float64("margin", cfg.Quality.PromoteMargin).Msg("Source promotion by quality score enabled")
+	}
+	s.priceFetcher.SetQualityScorer(qualityScorer)
+}
+
+// startWorkers fetches the first prices and starts every worker in its
+// component group
+func (s *server) startWorkers(ctx context.Context) {
+	cfg := s.cfg
+	database, gate := s.database, s.writeGate
+
+	// Fetch initial prices synchronously before starting background workers
+	log.Info().Msg("Fetching initial coin prices")
+	s.priceFetcher.FetchPrices()
+
+	s.ingestion = newComponentGroup(ctx)
+	s.sinks = newComponentGroup(ctx)
+	s.background = newComponentGroup(ctx)
+
+	s.ingestion.Go("price_fetcher", s.priceFetcher.Start)
+	s.ingestion.Go("funding_fetcher", s.fundingFetcher.Start)
+	s.ingestion.Go("orderbook_recorder", s.orderbookRecorder.Start)
+	if cfg.Fetcher.HistoryBackfill > 0 {
+		s.ingestion.Go("backfiller", s.backfiller.Start)
+	}
+	s.background.Go("cleanup", s.cleanupWorker.Start)
+	s.background.Go("candle_builder", s.candleBuilder.Start)
+	s.background.Go("spread_monitor", s.spreadMonitor.Start)
+	s.background.Go("alert_evaluator", s.alertEvaluator.Start)
+	s.background.Go("job_runner", s.jobRunner.Start)
+	s.background.Go("native_symbols", s.nativeSymbols.Start)
+	if len(cfg.Exchanges.StatusPages) > 0 {
+		s.background.Go("incident_tracker", s.incidentTracker.Start)
+	}
+	if s.sloMonitor != nil {
+		s.background.Go("slo_monitor", s.sloMonitor.Start)
+	}
+	// Users link their Telegram chats by messaging the bot
+	if cfg.Accounts.Enabled && cfg.Alerts.Telegram.BotToken != "" {
+		s.background.Go("telegram_linker", workers.NewTelegramLinker(database, gate, cfg.Alerts.Telegram.BotToken).Start)
+	}
+
+	if s.storageMirror != nil {
+		s.sinks.Go("storage_mirror", s.storageMirror.Start)
+	}
+
+	// Stream Hyperliquid mids continuously on top of the hourly poll
+	if cfg.Fetcher.WebSocket {
+		wsIngestor := workers.NewWSIngestor(database, s.priceFetcher.Coins, gate, s.persister, cfg.Fetcher.WebSocketMinInterval)
+		wsIngestor.SetPriceBounds(s.priceBounds)
+		if cfg.Fetcher.WebSocketFlushInterval > 0 {
+			wsIngestor.SetFlushInterval(cfg.Fetcher.WebSocketFlushInterval)
+		}
+		// Tick-level history goes to ClickHouse as well when configured
+		if cfg.ClickHouse.URL != "" {
+			client, err := clickhouse.NewClient(cfg.ClickHouse.URL)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Failed to create ClickHouse client")
+			}
+			tickSink := clickhouse.NewTickSink(client, cfg.ClickHouse.Table, cfg.ClickHouse.Retention, cfg.ClickHouse.FlushInterval)
+			tickSink.SetRegion(cfg.Server.Region)
+			wsIngestor.SetTickSink(tickSink)
+			s.sinks.Go("clickhouse_tick_sink", tickSink.Start)
+			log.Info().Str("table", cfg.ClickHouse.Table).Dur("retention", cfg.ClickHouse.Retention).Msg("ClickHouse tick sink enabled")
+		}
+		s.ingestion.Go("ws_ingestor", wsIngestor.Start)
+		log.Info().Msg("Hyperliquid WebSocket ingestion enabled")
+	}
+
+	// Post scheduled price snapshots for rebalancing tools
+	if cfg.Snapshots.WebhookURL != "" {
+		schedule, _ := cfg.Snapshots.Schedule()
+		coins := s.priceFetcher.Coins
+		if len(cfg.Snapshots.Coins) > 0 {
+			coins = func() []string { return cfg.Snapshots.Coins }
+		}
+		snapshotPoster := workers.NewSnapshotPoster(database, gate, cfg.Snapshots.WebhookURL, schedule, coins)
+		s.background.Go("snapshot_poster", snapshotPoster.Start)
+		log.Info().Strs("times", cfg.Snapshots.Times).Msg("Price snapshots enabled")
+	}
+
+	// Re-read the secret store so rotated credentials reach running sources
+	if s.secretStore != nil {
+		rotator := secrets.NewRotator(s.secretStore, s.registry, cfg.Secrets.Interval)
+		s.background.Go("secret_rotator", rotator.Start)
+		log.Info().Dur("interval", cfg.Secrets.Interval).Msg("Secret rotation enabled")
+	}
+
+	log.Info().Msg("Workers started successfully")
+	log.Info().Dur("interval", s.priceFetcher.Interval()).Strs("coins", s.priceFetcher.Coins()).Msg("Price fetcher running")
+	log.Info().Dur("min_interval", cfg.Retention.CleanupMinInterval).Dur("max_interval", cfg.Retention.CleanupMaxInterval).Dur("retention", cfg.Retention.RawPrices).Int("rules", len(cfg.Retention.Rules)).Bool("downsample", cfg.Retention.Downsample).Msg("Cleanup worker running")
+	log.Info().Dur("interval", cfg.Fetcher.CandleInterval).Msg("Candle builder running")
+	log.Info().Dur("interval", cfg.Spreads.Interval).Float64("threshold_bps", cfg.Spreads.ThresholdBps).Msg("Spread monitor running")
+	log.Info().Dur("interval", cfg.Alerts.Interval).Msg("Alert evaluator watching stored prices")
+	log.Info().Dur("interval", cfg.Orderbook.Interval).Int("levels", cfg.Orderbook.Levels).Msg("Orderbook recorder running")
+}
+
+// newRouter sets up Echo with its middleware and every route
+func (s *server) newRouter() *echo.Echo {
+	cfg := s.cfg
+
+	e := echo.New()
+	if s.tracing {
+		e.Use(tracing.Middleware())
+	}
+	e.Use(logging.RequestLogger())
+	if s.sloTracker != nil {
+		e.Use(s.sloTracker.Middleware())
+	}
+	e.Use(metrics.HTTPMiddleware())
+	e.Use(middleware.Recover())
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:  []string{"*"},
+		AllowMethods:  []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
+		AllowHeaders:  []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, handlers.HEADER_API_KEY},
+		ExposeHeaders: []string{echo.HeaderRetryAfter, handlers.HEADER_RATELIMIT_LIMIT, handlers.HEADER_RATELIMIT_REMAINING},
+	}))
+
+	rateLimit, err := newRateLimiter(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up rate limiting")
+	}
+
+	policy, err := access.NewPolicy(cfg.Access.Keys, cfg.Access.Categories)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up API key scopes")
+	}
+	scopeCoins := handlers.ScopeCoins(policy, cfg.Access.RequireKey)
+	if policy.Len() > 0 {
+		log.Info().Int("keys", policy.Len()).Bool("require_key", cfg.Access.RequireKey).Msg("API keys scoped to coins")
+	}
+
+	// Prometheus scrape endpoint, outside /api so it skips API caching
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+
+	// Embeddable HTML widgets and their oEmbed discovery endpoint
+	embedHandler := handlers.NewEmbedHandler(s.database)
+	e.GET("/embed/:coin", embedHandler.GetEmbed, handlers.NormalizeCoin(s.nativeSymbols))
+	e.GET("/oembed", embedHandler.GetOEmbed)
+
+	limits := handlers.ApplyLimits(handlers.Limits{
+		MaxRows:       cfg.Limits.MaxRows,
+		MaxWindow:     cfg.Limits.MaxWindow,
+		MaxCoins:      cfg.Limits.MaxCoins,
+		MaxExportRows: int64(cfg.Limits.MaxExportRows),
+	})
+	// The stream hijacks the connection, so it stays clear of the caching and
+	// audit middleware the rest of the API sits behind
+	streamHandler := handlers.NewStreamHandler(s.priceStream)
+	streamHandler.SetOpportunities(s.opportunities)
+	e.GET("/api/ws/prices", streamHandler.StreamPrices, rateLimit("stream"), scopeCoins, limits)
+	e.GET("/api/ws/opportunities", streamHandler.StreamOpportunities, rateLimit("stream"), scopeCoins, limits)
+
+	api := e.Group("/api", rateLimit("api"), handlers.NormalizeCoin(s.nativeSymbols), scopeCoins, limits, handlers.CacheControl(s.priceFetcher.Interval(), s.priceFetcher.LastFetchAt))
+
+	// Sign read responses for compliance archives when an audit key is set
+	if cfg.Audit.HMACKey != "" {
+		api.Use(handlers.Audit([]byte(cfg.Audit.HMACKey), s.persister.Version))
+		log.Info().Msg("Audit signing enabled for API responses")
+	}
+
+	s.routeAPI(api)
+	s.routeAccounts(api)
+	s.routeAlerting(api)
+	s.routeCompat(e, rateLimit, scopeCoins, limits)
+	s.routeAdmin(api, rateLimit)
+	return e
+}
+
+// routeAPI registers the public read API. Read endpoints also answer HEAD
+// and are cacheable until the next fetch
+func (s *server) routeAPI(api *echo.Group) {
+	cfg, database := s.cfg, s.database
+
+	priceHandler := handlers.NewPriceHandler(database, s.persister, s.priceFetcher.Interval(), cfg.Exchanges.Regions)
+	if s.responseCache != nil {
+		priceHandler.SetCache(s.responseCache, cfg.Cache.LatestTTL, cfg.Cache.ComparisonTTL)
+	}
+	sourceHandler := handlers.NewSourceHandler(database, s.clockMonitor, s.circuitBreaker)
+	candleHandler := handlers.NewCandleHandler(database, s.sessions)
+	spreadHandler := handlers.NewSpreadHandler(database, cfg.Spreads.MaxAge)
+	indexHandler := handlers.NewIndexHandler(database)
+	markHandler := handlers.NewMarkHandler(database, cfg.Marks.DivergenceBps)
+	orderbookHandler := handlers.NewOrderbookHandler(database)
+	fundingHandler := handlers.NewFundingHandler(database, s.fundingFetcher.Changed)
+	marketHandler := handlers.NewMarketHandler(database, s.registry, s.priceFetcher.Coins, s.priceBounds)
+	jobHandler := handlers.NewJobHandler(database, s.jobRunner)
+	schemaHandler := handlers.NewSchemaHandler(s.registry, s.priceFetcher.Coins, cfg.Retention.RawPrices, cfg.Retention.CleanupInterval)
+	schemaHandler.SetRetentionRules(s.retentionRules)
+
+	read := []string{http.MethodGet, http.MethodHead}
+	api.Match(read, "/prices/:coin", priceHandler.GetPriceComparison)
+	api.Match(read, "/prices/:coin/latest", priceHandler.GetLatestPrice)
+	api.GET("/prices/:coin/poll", priceHandler.PollPrices)
+	api.Match(read, "/prices/:coin/stats", priceHandler.GetPriceStats)
+	api.Match(read, "/candles/:coin", candleHandler.GetCandles)
+	api.Match(read, "/spreads/:coin", spreadHandler.GetSpreads)
+	api.Match(read, "/sources/sla", sourceHandler.GetSLA)
+	api.Match(read, "/sources/skew", sourceHandler.GetClockSkew)
+	api.Match(read, "/sources/breakers", sourceHandler.GetBreakers)
+	api.Match(read, "/sources/ranking", sourceHandler.GetRanking)
+	api.Match(read, "/schema", schemaHandler.GetSchema)
+	if s.sloTracker != nil {
+		api.Match(read, "/slo", handlers.NewSLOHandler(s.sloTracker, s.sloWindows).GetSLOs)
+	}
+	api.Match(read, "/markets", marketHandler.GetMarkets)
+	api.Match(read, "/markets/:exchange/:coin/position", marketHandler.GetPosition)
+	api.Match(read, "/index/:coin", indexHandler.GetIndexPrice)
+	api.Match(read, "/index/:coin/history", indexHandler.GetIndexHistory)
+	api.Match(read, "/marks/:coin", markHandler.GetMarkPrices)
+	api.Match(read, "/orderbook/:coin", orderbookHandler.GetOrderbook)
+	api.Match(read, "/orderbook/:coin/depth", orderbookHandler.GetOrderbookDepth)
+	api.Match(read, "/funding/:coin", fundingHandler.GetFundingRates)
+	api.Match(read, "/funding/:coin/apr", fundingHandler.GetFundingAPR)
+	api.Match(read, "/funding/:coin/payments", fundingHandler.GetFundingPayments)
+	api.GET("/funding/:coin/apr/poll", fundingHandler.PollFundingAPR)
+	api.POST("/jobs", jobHandler.CreateJob)
+	api.Match(read, "/jobs/:id", jobHandler.GetJob)
+}
+
+// routeAccounts registers user accounts, their watchlists and how they are
+// notified
+func (s *server) routeAccounts(api *echo.Group) {
+	cfg := s.cfg
+	if !cfg.Accounts.Enabled {
+		return
+	}
+
+	tokens := auth.NewTokens(cfg.Accounts.JWTSecret, cfg.Accounts.TokenTTL)
+	authHandler := handlers.NewAuthHandler(s.database, tokens)
+	watchlistHandler := handlers.NewWatchlistHandler(s.database, cfg.Accounts.MaxWatchlist, s.registry.Primary())
+
+	if s.smtpServer != nil {
+		authHandler.SetMailer(s.smtpServer, cfg.Accounts.PublicURL)
+	}
+
+	api.POST("/auth/register", authHandler.Register)
+	api.POST("/auth/login", authHandler.Login)
+	api.GET("/auth/confirm-email", authHandler.ConfirmEmail)
+	api.POST("/auth/confirm-email", authHandler.ConfirmEmail)
+
+	watchlist := api.Group("/watchlist", handlers.RequireUser(tokens))
+	watchlist.GET("", watchlistHandler.GetWatchlist)
+	watchlist.PUT("", watchlistHandler.ReplaceWatchlist)
+	watchlist.POST("", watchlistHandler.AddWatchlistCoin)
+	watchlist.DELETE("/:coin", watchlistHandler.RemoveWatchlistCoin)
+
+	notificationHandler := handlers.NewNotificationHandler(s.database, s.smtpServer != nil, cfg.Alerts.Telegram.BotToken != "", cfg.Alerts.Telegram.BotUsername)
+	me := api.Group("/me", handlers.RequireUser(tokens))
+	me.GET("/notifications", notificationHandler.GetNotifications)
+	me.PUT("/notifications", notificationHandler.UpdateNotifications)
+	me.POST("/email/confirm", authHandler.SendConfirmation)
+	me.POST("/telegram", notificationHandler.LinkTelegram)
+	me.DELETE("/telegram", notificationHandler.UnlinkTelegram)
+	log.Info().Dur("token_ttl", cfg.Accounts.TokenTTL).Msg("User accounts enabled")
+}
+
+// routeAlerting registers notification channels and alerts. They make the
+// server send requests wherever they point, so they are managed with the
+// admin token
+func (s *server) routeAlerting(api *echo.Group) {
+	cfg := s.cfg
+	if cfg.Admin.Token == "" {
+		return
+	}
+
+	channelHandler := handlers.NewChannelHandler(s.database, s.smtpServer)
+	alertHandler := handlers.NewAlertHandler(s.database, s.alertEvaluator)
+
+	channels := api.Group("/channels", handlers.RequireAdmin(cfg.Admin.Token))
+	channels.GET("", channelHandler.GetChannels)
+	channels.POST("", channelHandler.CreateChannel)
+	channels.GET("/:id", channelHandler.GetChannel)
+	channels.PUT("/:id", channelHandler.UpdateChannel)
+	channels.DELETE("/:id", channelHandler.DeleteChannel)
+	channels.POST("/:id/test", channelHandler.TestChannel)
+
+	alerts := api.Group("/alerts", handlers.RequireAdmin(cfg.Admin.Token))
+	alerts.GET("", alertHandler.GetAlerts)
+	alerts.POST("", alertHandler.CreateAlert)
+	alerts.GET("/:id", alertHandler.GetAlert)
+	alerts.PUT("/:id", alertHandler.UpdateAlert)
+	alerts.DELETE("/:id", alertHandler.DeleteAlert)
+}
+
+// routeCompat registers CoinGecko and CCXT shaped endpoints for existing
+// tooling, scoped and limited like the API
+func (s *server) routeCompat(e *echo.Echo, rateLimit func(group string) echo.MiddlewareFunc, scopeCoins, limits echo.MiddlewareFunc) {
+	cfg := s.cfg
+	if len(cfg.Compat.Modes) == 0 {
+		return
+	}
+
+	ids := services.CoinGeckoIDs()
+	for coin, id := range cfg.Compat.CoinGeckoIDs {
+		ids[symbols.Normalize(coin)] = id
+	}
+	compatHandler := handlers.NewCompatHandler(s.database, ids, s.registry.Primary().Name())
+
+	for _, mode := range cfg.Compat.Modes {
+		switch mode {
+		case handlers.COMPAT_COINGECKO:
+			coingecko := e.Group("/compat/coingecko/api/v3", rateLimit("compat"), scopeCoins, limits)
+			coingecko.GET("/ping", compatHandler.GetCoinGeckoPing)
+			coingecko.GET("/simple/price", compatHandler.GetCoinGeckoSimplePrice)
+			coingecko.GET("/simple/supported_vs_currencies", compatHandler.GetCoinGeckoCurrencies)
+			coingecko.GET("/coins/list", compatHandler.GetCoinGeckoCoins)
+		case handlers.COMPAT_CCXT:
+			ccxt := e.Group("/compat/ccxt", rateLimit("compat"), scopeCoins, limits)
+			ccxt.GET("/ticker", compatHandler.GetCCXTTicker)
+			ccxt.GET("/tickers", compatHandler.GetCCXTTickers)
+			ccxt.GET("/ohlcv", compatHandler.GetCCXTOHLCV)
+		}
+		log.Info().Str("mode", mode).Msg("Compatibility endpoints enabled")
+	}
+}
+
+// routeAdmin registers the admin API. It changes the schema and what is
+// collected, so it is only served behind a token
+func (s *server) routeAdmin(api *echo.Group, rateLimit func(group string) echo.MiddlewareFunc) {
+	cfg := s.cfg
+	if cfg.Admin.Token == "" {
+		log.Info().Msg("Admin API disabled, set admin.token (ADMIN_TOKEN) to enable it")
+		return
+	}
+
+	adminHandler := handlers.NewAdminHandler(s.database, s.writeGate, s.persister, s.registry)
+	admin := api.Group("/admin", rateLimit("admin"), handlers.RequireAdmin(cfg.Admin.Token))
+	admin.POST("/migrate", adminHandler.RunMigrations)
+	admin.GET("/workers/:name/runs", adminHandler.GetWorkerRuns)
+	admin.GET("/coins", adminHandler.GetTrackedCoins)
+	admin.POST("/coins", adminHandler.TrackCoin)
+	admin.POST("/coins/bulk", adminHandler.BulkTrackCoins)
+	admin.DELETE("/coins/:coin", adminHandler.UntrackCoin)
+	admin.GET("/dead-letters", adminHandler.GetDeadLetters)
+	admin.POST("/dead-letters/replay", adminHandler.ReplayDeadLetters)
+	log.Info().Msg("Admin API enabled")
+}
+
+// serveHTTP serves handler until interrupted, then shuts everything down
+func (s *server) serveHTTP(ctx context.Context, handler http.Handler) {
+	cfg := s.cfg
+	port := cfg.Server.Port
+
+	// Requests inherit their own context so streams and long polls can be
+	// closed on shutdown before the server stops taking requests
+	requestCtx, closeRequests := context.WithCancel(ctx)
+	defer closeRequests()
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%s", port),
+		Handler: handler,
+		BaseContext: func(net.Listener) context.Context {
+			return requestCtx
+		},
+	}
+
+	serverDone := make(chan struct{})
+	go func() {
+		defer close(serverDone)
+		log.Info().Str("port", port).Msg("HTTP server starting")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error().Err(err).Msg("HTTP server error")
+		}
+	}()
+
+	// Wait for interrupt signal to gracefully shutdown
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	<-sigChan
+
+	log.Info().Msg("Shutdown signal received, initiating graceful shutdown")
+
+	// Stop taking in prices before anything downstream of them, so every
+	// price collected is stored and reaches the sinks before they stop
+	shutdown([]shutdownStage{
+		{"ingestion", cfg.Shutdown.Ingestion, s.ingestion.stop},
+		{"persistence", cfg.Shutdown.Persistence, s.sinks.stop},
+		{"workers", cfg.Shutdown.Workers, s.background.stop},
+		{"streams", cfg.Shutdown.Streams, func(ctx context.Context) error {
+			closeRequests()
+			return waitFor(ctx, func() bool {
+				return s.priceStream.Len() == 0 && s.opportunities.Len() == 0
+			})
+		}},
+		{"http", cfg.Shutdown.HTTP, func(ctx context.Context) error {
+			if err := server.Shutdown(ctx); err != nil {
+				return err
+			}
+			<-serverDone
+			return nil
+		}},
+		// Flush spans still buffered for export
+		{"tracing", 5 * time.Second, s.shutdownTracing},
+	})
+}
+
+// declaredAlerting converts the channels and rules in config to the rows they
+// are reconciled into, validating each like the API would
+func declaredAlerting(cfg *config.Config) ([]models.NotificationChannel, []db.DeclaredAlert, error) {
+	var errs []error
+
+	channels := make([]models.NotificationChannel, 0, len(cfg.Alerts.Channels))
+	for _, declared := range cfg.Alerts.Channels {
+		channel := models.NotificationChannel{
+			Name:    declared.Name,
+			Type:    declared.Type,
+			Target:  declared.Target,
+			Token:   declared.Token,
+			Enabled: declared.Enabled == nil || *declared.Enabled,
+		}
+		if err := channel.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("alerts.channels %q: %w", declared.Name, err))
+			continue
+		}
+		channels = append(channels, channel)
+	}
+
+	alerts := make([]db.DeclaredAlert, 0, len(cfg.Alerts.Rules))
+	for _, declared := range cfg.Alerts.Rules {
+		alert := models.PriceAlert{
+			Name:          declared.Name,
+			Coin:          symbols.Normalize(declared.Coin),
+			Exchange:      declared.Exchange,
+			Condition:     declared.Condition,
+			Threshold:     declared.Threshold,
+			WindowMinutes: declared.WindowMinutes,
+			Severity:      declared.Severity,
+			WebhookURL:    models.Text(declared.WebhookURL),
+			Enabled:       declared.Enabled == nil || *declared.Enabled,
+		}
+		if alert.Severity == "" {
+			alert.Severity = models.SEVERITY_WARNING
+		}
+
+		// The channel ID is only known once channels are reconciled
+		check := alert
+		if declared.Channel != "" {
+			check.ChannelID = new(uint)
+		}
+		if err := check.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("alerts.rules %q: %w", declared.Name, err))
+			continue
+		}
+		alerts = append(alerts, db.DeclaredAlert{Alert: alert, Channel: declared.Channel})
+	}
+
+	return channels, alerts, errors.Join(errs...)
+}
+
+// newRateLimiter returns the rate limit middleware of a route group, which
+// lets everything through when rate limiting is off or the group has no limit
+func newRateLimiter(cfg *config.Config) (func(group string) echo.MiddlewareFunc, error) {
+	passthrough := func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+	if !cfg.RateLimit.Enabled {
+		return func(string) echo.MiddlewareFunc { return passthrough }, nil
+	}
+
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.RedisURL != "" {
+		client, err := redis.NewClient(cfg.RateLimit.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := client.Ping(ctx); err != nil {
+			// Requests are let through until Redis is reachable
+			log.Warn().Err(err).Msg("Rate limit Redis unreachable")
+		}
+		store = ratelimit.NewRedisStore(client, "dexlite:ratelimit:")
+	}
+
+	log.Info().Bool("redis", cfg.RateLimit.RedisURL != "").Int("keys", len(cfg.RateLimit.Keys)).Msg("Rate limiting enabled")
+	return func(group string) echo.MiddlewareFunc {
+		limit, ok := cfg.RateLimit.Groups[group]
+		if !ok {
+			return passthrough
+		}
+		return handlers.RateLimit(store, group, ratelimit.Limit{Rate: limit.Rate, Burst: limit.Burst}, cfg.RateLimit.Keys)
+	}, nil
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/notblessy/dexlite/symbols"
+)
+
+const (
+	BINANCE_API_URL     = "https://api.binance.com"
+	BINANCE_NAME        = "binance"
+	BINANCE_QUOTE_ASSET = "USDT"
+)
+
+var (
+	_ PriceSource      = (*BinanceClient)(nil)
+	_ InstrumentSource = (*BinanceClient)(nil)
+	_ SymbolSource     = (*BinanceClient)(nil)
+)
+
+type BinanceClient struct {
+	client  *http.Client
+	baseURL string
+	// symbols overrides the default COIN+USDT mapping for coins that are
+	// listed under a different ticker on Binance
+	symbols map[string]string
+}
+
+// BinanceTickerPrice represents the response from the /api/v3/ticker/price endpoint
+type BinanceTickerPrice struct {
+	Symbol string `json:"symbol"`
+	Price  string `json:"price"`
+}
+
+func NewBinanceClient() *BinanceClient {
+	return &BinanceClient{
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		baseURL: BINANCE_API_URL,
+		symbols: map[string]string{},
+	}
+}
+
+// Name returns the source identifier for Binance
+func (c *BinanceClient) Name() string {
+	return BINANCE_NAME
+}
+
+// Instrument reports the market prices are read from
+func (c *BinanceClient) Instrument() Instrument {
+	return Instrument{
+		Type:  INSTRUMENT_SPOT,
+		Quote: BINANCE_QUOTE_ASSET,
+	}
+}
+
+// HTTPClient exposes the underlying client so its transport can be instrumented
+func (c *BinanceClient) HTTPClient() *http.Client {
+	return c.client
+}
+
+// Symbol maps a coin to its Binance spot symbol, e.g. BTC -> BTCUSDT. Coins
+// quoted per 1000 units map to the underlying, e.g. kPEPE -> PEPEUSDT
+func (c *BinanceClient) Symbol(coin string) string {
+	coin = strings.ToUpper(coin)
+	if symbol, exists := c.symbols[coin]; exists {
+		return symbol
+	}
+
+	base, _ := symbols.Scale(symbols.Normalize(coin))
+	return base + BINANCE_QUOTE_ASSET
+}
+
+// NativeSymbols maps each coin's Binance symbol to the coin
+func (c *BinanceClient) NativeSymbols(coins []string) (map[string]string, error) {
+	natives := make(map[string]string, len(coins))
+	for _, coin := range coins {
+		// kPEPE shares PEPE's market, which stands for PEPE when both are tracked
+		symbol := c.Symbol(coin)
+		if _, taken := natives[symbol]; taken {
+			if _, multiplier := symbols.Scale(coin); multiplier != 1 {
+				continue
+			}
+		}
+		natives[symbol] = coin
+	}
+	return natives, nil
+}
+
+// GetPrices fetches the current price for each of the given coins
+func (c *BinanceClient) GetPrices(coins []string) (map[string]float64, error) {
+	prices := make(map[string]float64, len(coins))
+	var errs []error
+
+	for _, coin := range coins {
+		price, err := c.GetPrice(coin)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", coin, err))
+			continue
+		}
+		prices[coin] = price
+	}
+
+	return prices, errors.Join(errs...)
+}
+
+// GetPrice fetches the current spot price for a given coin symbol
+func (c *BinanceClient) GetPrice(coin string) (float64, error) {
+	symbol := c.Symbol(coin)
+
+	endpoint := fmt.Sprintf("%s/api/v3/ticker/price?symbol=%s", c.baseURL, url.QueryEscape(symbol))
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var ticker BinanceTickerPrice
+	if err := json.Unmarshal(bodyBytes, &ticker); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	price, err := strconv.ParseFloat(ticker.Price, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse price for %s: %w", symbol, err)
+	}
+
+	_, multiplier := symbols.Scale(symbols.Normalize(coin))
+	return price * multiplier, nil
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	BREAKER_CLOSED    = "closed"
+	BREAKER_OPEN      = "open"
+	BREAKER_HALF_OPEN = "half_open"
+)
+
+// BreakerStatus is the state of one source's breaker
+type BreakerStatus struct {
+	Source              string     `json:"source"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+}
+
+type breaker struct {
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// CircuitBreaker stops polling a source after threshold consecutive failed
+// fetches. Once cooldown has passed a single probe fetch is let through; it
+// closes the breaker on success and reopens it on failure
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		breakers:  make(map[string]*breaker),
+	}
+}
+
+// get returns the breaker for source, creating it closed. Callers hold mu
+func (cb *CircuitBreaker) get(source string) *breaker {
+	b, exists := cb.breakers[source]
+	if !exists {
+		b = &breaker{state: BREAKER_CLOSED}
+		cb.breakers[source] = b
+	}
+	return b
+}
+
+// Allow reports whether source may be fetched now. A nil breaker allows all
+func (cb *CircuitBreaker) Allow(source string) bool {
+	if cb == nil {
+		return true
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b := cb.get(source)
+	switch b.state {
+	case BREAKER_OPEN:
+		if time.Since(b.openedAt) < cb.cooldown {
+			return false
+		}
+		b.state = BREAKER_HALF_OPEN
+		return true
+	case BREAKER_HALF_OPEN:
+		// A probe is already in flight
+		return false
+	default:
+		return true
+	}
+}
+
+// Record reports the outcome of a fetch that Allow let through
+func (cb *CircuitBreaker) Record(source string, success bool) {
+	if cb == nil {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b := cb.get(source)
+	if success {
+		b.state = BREAKER_CLOSED
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BREAKER_HALF_OPEN || b.failures >= cb.threshold {
+		b.state = BREAKER_OPEN
+		b.openedAt = time.Now()
+	}
+}
+
+// Status returns every known breaker sorted by source
+func (cb *CircuitBreaker) Status() []BreakerStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	statuses := make([]BreakerStatus, 0, len(cb.breakers))
+	for source, b := range cb.breakers {
+		status := BreakerStatus{
+			Source:              source,
+			State:               b.state,
+			ConsecutiveFailures: b.failures,
+		}
+		if b.state != BREAKER_CLOSED {
+			openedAt := b.openedAt
+			retryAt := openedAt.Add(cb.cooldown)
+			status.OpenedAt = &openedAt
+			status.RetryAt = &retryAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Source < statuses[j].Source
+	})
+	return statuses
+}
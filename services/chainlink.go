@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	CHAINLINK_NAME = "chainlink"
+
+	// Only the two read methods we need from AggregatorV3Interface
+	chainlinkAggregatorABI = `[
+		{"inputs":[],"name":"decimals","outputs":[{"internalType":"uint8","name":"","type":"uint8"}],"stateMutability":"view","type":"function"},
+		{"inputs":[],"name":"latestRoundData","outputs":[{"internalType":"uint80","name":"roundId","type":"uint80"},{"internalType":"int256","name":"answer","type":"int256"},{"internalType":"uint256","name":"startedAt","type":"uint256"},{"internalType":"uint256","name":"updatedAt","type":"uint256"},{"internalType":"uint80","name":"answeredInRound","type":"uint80"}],"stateMutability":"view","type":"function"}
+	]`
+)
+
+// Ethereum mainnet USD aggregators for the coins tracked out of the box
+var chainlinkFeeds = map[string]string{
+	"BTC":  "0xF4030086522a5bEEa4988F8cA5B36dbC97BeE88c",
+	"ETH":  "0x5f4eC3Df9cbd43714FE2740f5E3616155c5b8419",
+	"SOL":  "0x4ffC43a60e009B551865A93d232E33Fce9f01507",
+	"ARB":  "0x31697852a68433DbCc2Ff612c516d69E3D9bd08F",
+	"AVAX": "0xFF3EEb22B5E3dE6e705b44749C2559d704923FD7",
+}
+
+// SECRET_CHAINLINK_RPC_URL names the RPC endpoint in a secret store, for
+// providers that embed an API key in the URL
+const SECRET_CHAINLINK_RPC_URL = "CHAINLINK_RPC_URL"
+
+var (
+	_ PriceSource      = (*ChainlinkClient)(nil)
+	_ CredentialSource = (*ChainlinkClient)(nil)
+	_ InstrumentSource = (*ChainlinkClient)(nil)
+)
+
+type ChainlinkClient struct {
+	abi   abi.ABI
+	feeds map[string]common.Address
+
+	mu       sync.Mutex
+	client   *ethclient.Client
+	rpcURL   string
+	decimals map[common.Address]uint8
+}
+
+// NewChainlinkClient connects to an Ethereum RPC endpoint for reading
+// aggregator contracts. feeds overrides or extends the default aggregator
+// addresses keyed by coin
+func NewChainlinkClient(rpcURL string, feeds map[string]string) (*ChainlinkClient, error) {
+	client, err := ethclient.Dial(rpcURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to RPC: %w", err)
+	}
+
+	parsed, err := abi.JSON(strings.NewReader(chainlinkAggregatorABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse aggregator ABI: %w", err)
+	}
+
+	addresses := make(map[string]common.Address, len(chainlinkFeeds)+len(feeds))
+	for coin, address := range chainlinkFeeds {
+		addresses[coin] = common.HexToAddress(address)
+	}
+	for coin, address := range feeds {
+		if !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("invalid aggregator address for %s: %q", coin, address)
+		}
+		addresses[strings.ToUpper(coin)] = common.HexToAddress(address)
+	}
+
+	return &ChainlinkClient{
+		client:   client,
+		rpcURL:   rpcURL,
+		abi:      parsed,
+		feeds:    addresses,
+		decimals: make(map[common.Address]uint8),
+	}, nil
+}
+
+// RotateCredentials reconnects when the secrets carry a different RPC URL. A
+// read in flight on the old connection fails and is retried next cycle
+func (c *ChainlinkClient) RotateCredentials(secrets map[string]string) error {
+	rpcURL, exists := secrets[SECRET_CHAINLINK_RPC_URL]
+	if !exists || rpcURL == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	unchanged := rpcURL == c.rpcURL
+	c.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	client, err := ethclient.Dial(rpcURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to rotated RPC: %w", err)
+	}
+
+	c.mu.Lock()
+	previous := c.client
+	c.client = client
+	c.rpcURL = rpcURL
+	c.mu.Unlock()
+
+	previous.Close()
+	return nil
+}
+
+// rpc returns the current RPC connection
+func (c *ChainlinkClient) rpc() *ethclient.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.client
+}
+
+// Name returns the source identifier for Chainlink
+func (c *ChainlinkClient) Name() string {
+	return CHAINLINK_NAME
+}
+
+// Instrument reports the market prices are read from
+func (c *ChainlinkClient) Instrument() Instrument {
+	return Instrument{
+		Type:  INSTRUMENT_INDEX,
+		Quote: "USD",
+	}
+}
+
+// GetPrices reads the latest answer from each coin's aggregator
+func (c *ChainlinkClient) GetPrices(coins []string) (map[string]float64, error) {
+	prices := make(map[string]float64, len(coins))
+	var errs []error
+
+	for _, coin := range coins {
+		price, err := c.GetPrice(coin)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", coin, err))
+			continue
+		}
+		prices[coin] = price
+	}
+
+	return prices, errors.Join(errs...)
+}
+
+// GetPrice reads the latest reference price for a given coin symbol
+func (c *ChainlinkClient) GetPrice(coin string) (float64, error) {
+	address, exists := c.feeds[strings.ToUpper(coin)]
+	if !exists {
+		return 0, fmt.Errorf("no Chainlink aggregator mapped for %s", coin)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	contract := bind.NewBoundContract(address, c.abi, c.rpc(), nil, nil)
+
+	decimals, err := c.feedDecimals(ctx, contract, address)
+	if err != nil {
+		return 0, err
+	}
+
+	// latestRoundData returns (roundId, answer, startedAt, updatedAt, answeredInRound)
+	var out []interface{}
+	if err := contract.Call(&bind.CallOpts{Context: ctx}, &out, "latestRoundData"); err != nil {
+		return 0, fmt.Errorf("failed to call latestRoundData: %w", err)
+	}
+
+	answer := abi.ConvertType(out[1], new(big.Int)).(*big.Int)
+	if answer.Sign() <= 0 {
+		return 0, fmt.Errorf("aggregator returned non-positive answer %s", answer)
+	}
+
+	price, _ := new(big.Float).Quo(
+		new(big.Float).SetInt(answer),
+		new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)),
+	).Float64()
+
+	return price, nil
+}
+
+// feedDecimals returns the aggregator's answer precision, reading it once per feed
+func (c *ChainlinkClient) feedDecimals(ctx context.Context, contract *bind.BoundContract, address common.Address) (uint8, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if decimals, exists := c.decimals[address]; exists {
+		return decimals, nil
+	}
+
+	var out []interface{}
+	if err := contract.Call(&bind.CallOpts{Context: ctx}, &out, "decimals"); err != nil {
+		return 0, fmt.Errorf("failed to call decimals: %w", err)
+	}
+
+	decimals := *abi.ConvertType(out[0], new(uint8)).(*uint8)
+	c.decimals[address] = decimals
+	return decimals, nil
+}
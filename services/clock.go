@@ -0,0 +1,143 @@
+package services
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CLOCK_SKEW_SMOOTHING weights each new sample in the moving average. The Date
+// header only has second precision, so single samples are noisy
+const CLOCK_SKEW_SMOOTHING = 0.2
+
+// ClockSkew is the measured offset of a source's clock from ours. A positive
+// skew means the venue's clock is ahead
+type ClockSkew struct {
+	Source    string        `json:"source"`
+	Skew      time.Duration `json:"-"`
+	SkewMs    int64         `json:"skew_ms"`
+	Samples   int64         `json:"samples"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// ClockMonitor estimates each source's clock skew from the Date header of its
+// HTTP responses, compared against the local midpoint of the request
+type ClockMonitor struct {
+	mu    sync.RWMutex
+	skews map[string]*ClockSkew
+}
+
+func NewClockMonitor() *ClockMonitor {
+	return &ClockMonitor{
+		skews: make(map[string]*ClockSkew),
+	}
+}
+
+// Instrument wraps the HTTP transport of every source in the registry that
+// exposes one
+func (m *ClockMonitor) Instrument(registry *Registry) {
+	sources := registry.Sources()
+	if fallback := registry.Fallback(); fallback != nil {
+		sources = append(sources, fallback)
+	}
+
+	for _, source := range sources {
+		httpSource, ok := source.(HTTPSource)
+		if !ok {
+			continue
+		}
+
+		client := httpSource.HTTPClient()
+		base := client.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		client.Transport = &clockTransport{
+			monitor: m,
+			source:  source.Name(),
+			base:    base,
+		}
+	}
+}
+
+// Observe records one sample of a source's clock against the local time
+func (m *ClockMonitor) Observe(source string, remote, local time.Time) {
+	sample := remote.Sub(local)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	skew, exists := m.skews[source]
+	if !exists {
+		skew = &ClockSkew{Source: source, Skew: sample}
+		m.skews[source] = skew
+	} else {
+		skew.Skew += time.Duration(CLOCK_SKEW_SMOOTHING * float64(sample-skew.Skew))
+	}
+	skew.SkewMs = skew.Skew.Milliseconds()
+	skew.Samples++
+	skew.UpdatedAt = local
+}
+
+// Skew returns the current estimate for source and whether one exists
+func (m *ClockMonitor) Skew(source string) (time.Duration, bool) {
+	if m == nil {
+		return 0, false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	skew, exists := m.skews[source]
+	if !exists {
+		return 0, false
+	}
+	return skew.Skew, true
+}
+
+// Correct converts a timestamp reported by source to the local clock
+func (m *ClockMonitor) Correct(source string, reported time.Time) time.Time {
+	skew, _ := m.Skew(source)
+	return reported.Add(-skew)
+}
+
+// Skews returns the estimate for every source seen so far, sorted by name
+func (m *ClockMonitor) Skews() []ClockSkew {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	skews := make([]ClockSkew, 0, len(m.skews))
+	for _, skew := range m.skews {
+		skews = append(skews, *skew)
+	}
+	sort.Slice(skews, func(i, j int) bool {
+		return skews[i].Source < skews[j].Source
+	})
+	return skews
+}
+
+// clockTransport feeds the Date header of every response into the monitor
+type clockTransport struct {
+	monitor *ClockMonitor
+	source  string
+	base    http.RoundTripper
+}
+
+func (t *clockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	sent := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	received := time.Now()
+
+	if remote, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		// The header is truncated to the second, so compare against the
+		// middle of the round trip and add half a second to center the error
+		local := sent.Add(received.Sub(sent) / 2)
+		t.monitor.Observe(t.source, remote.Add(500*time.Millisecond), local)
+	}
+
+	return resp, nil
+}
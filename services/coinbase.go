@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/notblessy/dexlite/symbols"
+	"golang.org/x/time/rate"
+)
+
+const (
+	COINBASE_API_URL     = "https://api.exchange.coinbase.com"
+	COINBASE_NAME        = "coinbase"
+	COINBASE_QUOTE_ASSET = "USD"
+
+	// Coinbase allows 10 public requests per second per IP, stay under it
+	COINBASE_REQUESTS_PER_SECOND = 8
+)
+
+var (
+	_ PriceSource      = (*CoinbaseClient)(nil)
+	_ InstrumentSource = (*CoinbaseClient)(nil)
+	_ SymbolSource     = (*CoinbaseClient)(nil)
+)
+
+type CoinbaseClient struct {
+	client  *http.Client
+	baseURL string
+	limiter *rate.Limiter
+}
+
+// CoinbaseTicker represents the response from the /products/:product_id/ticker endpoint
+type CoinbaseTicker struct {
+	TradeID int64  `json:"trade_id"`
+	Price   string `json:"price"`
+	Size    string `json:"size"`
+	Bid     string `json:"bid"`
+	Ask     string `json:"ask"`
+	Volume  string `json:"volume"`
+	Time    string `json:"time"`
+}
+
+// CoinbaseError is the error body Coinbase returns on non-200 responses
+type CoinbaseError struct {
+	Message string `json:"message"`
+}
+
+func NewCoinbaseClient() *CoinbaseClient {
+	return &CoinbaseClient{
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		baseURL: COINBASE_API_URL,
+		limiter: rate.NewLimiter(rate.Limit(COINBASE_REQUESTS_PER_SECOND), 1),
+	}
+}
+
+// Name returns the source identifier for Coinbase
+func (c *CoinbaseClient) Name() string {
+	return COINBASE_NAME
+}
+
+// Instrument reports the market prices are read from
+func (c *CoinbaseClient) Instrument() Instrument {
+	return Instrument{
+		Type:  INSTRUMENT_SPOT,
+		Quote: COINBASE_QUOTE_ASSET,
+	}
+}
+
+// HTTPClient exposes the underlying client so its transport can be instrumented
+func (c *CoinbaseClient) HTTPClient() *http.Client {
+	return c.client
+}
+
+// ProductID maps a coin to its Coinbase product, e.g. BTC -> BTC-USD. Coins
+// quoted per 1000 units map to the underlying, e.g. kPEPE -> PEPE-USD
+func (c *CoinbaseClient) ProductID(coin string) string {
+	base, _ := symbols.Scale(symbols.Normalize(coin))
+	return strings.ToUpper(base) + "-" + COINBASE_QUOTE_ASSET
+}
+
+// NativeSymbols maps each coin's Coinbase product to the coin
+func (c *CoinbaseClient) NativeSymbols(coins []string) (map[string]string, error) {
+	natives := make(map[string]string, len(coins))
+	for _, coin := range coins {
+		// kPEPE shares PEPE's market, which stands for PEPE when both are tracked
+		symbol := c.ProductID(coin)
+		if _, taken := natives[symbol]; taken {
+			if _, multiplier := symbols.Scale(coin); multiplier != 1 {
+				continue
+			}
+		}
+		natives[symbol] = coin
+	}
+	return natives, nil
+}
+
+// GetPrices fetches the current price for each of the given coins
+func (c *CoinbaseClient) GetPrices(coins []string) (map[string]float64, error) {
+	prices := make(map[string]float64, len(coins))
+	var errs []error
+
+	for _, coin := range coins {
+		price, err := c.GetPrice(coin)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", coin, err))
+			continue
+		}
+		prices[coin] = price
+	}
+
+	return prices, errors.Join(errs...)
+}
+
+// GetPrice fetches the last trade price for a given coin symbol
+func (c *CoinbaseClient) GetPrice(coin string) (float64, error) {
+	productID := c.ProductID(coin)
+
+	if err := c.limiter.Wait(context.Background()); err != nil {
+		return 0, fmt.Errorf("rate limiter: %w", err)
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/products/%s/ticker", c.baseURL, productID), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Coinbase rejects requests without a User-Agent
+	req.Header.Set("User-Agent", "dexlite")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr CoinbaseError
+		if err := json.Unmarshal(bodyBytes, &apiErr); err == nil && apiErr.Message != "" {
+			return 0, fmt.Errorf("API returned status %d for %s: %s", resp.StatusCode, productID, apiErr.Message)
+		}
+		return 0, fmt.Errorf("API returned status %d for %s: %s", resp.StatusCode, productID, string(bodyBytes))
+	}
+
+	var ticker CoinbaseTicker
+	if err := json.Unmarshal(bodyBytes, &ticker); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	price, err := strconv.ParseFloat(ticker.Price, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse price for %s: %w", productID, err)
+	}
+
+	_, multiplier := symbols.Scale(symbols.Normalize(coin))
+	return price * multiplier, nil
+}
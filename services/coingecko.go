@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	COINGECKO_API_URL     = "https://api.coingecko.com/api/v3"
+	COINGECKO_PRO_API_URL = "https://pro-api.coingecko.com/api/v3"
+	COINGECKO_NAME        = "coingecko"
+
+	// SECRET_COINGECKO_API_KEY names the API key in a secret store
+	SECRET_COINGECKO_API_KEY = "COINGECKO_API_KEY"
+
+	// The public API allows roughly 30 calls per minute
+	COINGECKO_DEFAULT_RATE_PER_MINUTE = 30
+)
+
+// Default CoinGecko IDs for the coins tracked out of the box
+var coinGeckoIDs = map[string]string{
+	"BTC":  "bitcoin",
+	"ETH":  "ethereum",
+	"SOL":  "solana",
+	"ARB":  "arbitrum",
+	"AVAX": "avalanche-2",
+}
+
+// CoinGeckoIDs returns a copy of the default coin to CoinGecko ID mapping
+func CoinGeckoIDs() map[string]string {
+	ids := make(map[string]string, len(coinGeckoIDs))
+	for coin, id := range coinGeckoIDs {
+		ids[coin] = id
+	}
+	return ids
+}
+
+var (
+	_ PriceSource      = (*CoinGeckoClient)(nil)
+	_ CredentialSource = (*CoinGeckoClient)(nil)
+	_ InstrumentSource = (*CoinGeckoClient)(nil)
+)
+
+type CoinGeckoClient struct {
+	client    *http.Client
+	baseURL   string
+	keyHeader string
+	limiter   *rate.Limiter
+	ids       map[string]string
+
+	mu     sync.RWMutex
+	apiKey string
+}
+
+// NewCoinGeckoClient creates a client for the simple price API. An empty
+// apiKey uses the keyless public API, pro selects the paid endpoint.
+// requestsPerMinute <= 0 uses the public API limit
+func NewCoinGeckoClient(apiKey string, pro bool, requestsPerMinute int) *CoinGeckoClient {
+	if requestsPerMinute <= 0 {
+		requestsPerMinute = COINGECKO_DEFAULT_RATE_PER_MINUTE
+	}
+
+	c := &CoinGeckoClient{
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		baseURL:   COINGECKO_API_URL,
+		apiKey:    apiKey,
+		keyHeader: "x-cg-demo-api-key",
+		limiter:   rate.NewLimiter(rate.Every(time.Minute/time.Duration(requestsPerMinute)), 1),
+		ids:       coinGeckoIDs,
+	}
+
+	if pro {
+		c.baseURL = COINGECKO_PRO_API_URL
+		c.keyHeader = "x-cg-pro-api-key"
+	}
+
+	return c
+}
+
+// RotateCredentials replaces the API key when the secrets carry a new one
+func (c *CoinGeckoClient) RotateCredentials(secrets map[string]string) error {
+	apiKey, exists := secrets[SECRET_COINGECKO_API_KEY]
+	if !exists {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.apiKey = apiKey
+	return nil
+}
+
+// Name returns the source identifier for CoinGecko
+func (c *CoinGeckoClient) Name() string {
+	return COINGECKO_NAME
+}
+
+// Instrument reports the market prices are read from
+func (c *CoinGeckoClient) Instrument() Instrument {
+	return Instrument{
+		Type:  INSTRUMENT_INDEX,
+		Quote: "USD",
+	}
+}
+
+// HTTPClient exposes the underlying client so its transport can be instrumented
+func (c *CoinGeckoClient) HTTPClient() *http.Client {
+	return c.client
+}
+
+// GetPrice fetches the current USD price for a given coin symbol
+func (c *CoinGeckoClient) GetPrice(coin string) (float64, error) {
+	prices, err := c.GetPrices([]string{coin})
+	if price, exists := prices[coin]; exists {
+		return price, nil
+	}
+	return 0, err
+}
+
+// GetPrices fetches current USD prices for all given coins in a single request
+func (c *CoinGeckoClient) GetPrices(coins []string) (map[string]float64, error) {
+	var errs []error
+	ids := make([]string, 0, len(coins))
+	coinsByID := make(map[string]string, len(coins))
+
+	for _, coin := range coins {
+		id, exists := c.ids[strings.ToUpper(coin)]
+		if !exists {
+			errs = append(errs, fmt.Errorf("%s: no CoinGecko id mapped", coin))
+			continue
+		}
+		ids = append(ids, id)
+		coinsByID[id] = coin
+	}
+
+	if len(ids) == 0 {
+		return map[string]float64{}, errors.Join(errs...)
+	}
+
+	if err := c.limiter.Wait(context.Background()); err != nil {
+		return nil, fmt.Errorf("rate limiter: %w", err)
+	}
+
+	query := url.Values{}
+	query.Set("ids", strings.Join(ids, ","))
+	query.Set("vs_currencies", "usd")
+
+	req, err := http.NewRequest("GET", c.baseURL+"/simple/price?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	c.mu.RLock()
+	if c.apiKey != "" {
+		req.Header.Set(c.keyHeader, c.apiKey)
+	}
+	c.mu.RUnlock()
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	// Response is keyed by id then currency, e.g. {"bitcoin": {"usd": 65000}}
+	var response map[string]map[string]float64
+	if err := json.Unmarshal(bodyBytes, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	prices := make(map[string]float64, len(coinsByID))
+	for id, coin := range coinsByID {
+		price, exists := response[id]["usd"]
+		if !exists {
+			errs = append(errs, fmt.Errorf("%s: missing from response", coin))
+			continue
+		}
+		prices[coin] = price
+	}
+
+	return prices, errors.Join(errs...)
+}
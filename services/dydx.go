@@ -0,0 +1,232 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DYDX_INDEXER_URL = "https://indexer.dydx.trade/v4"
+	DYDX_NAME        = "dydx"
+)
+
+var (
+	_ PriceSource      = (*DydxClient)(nil)
+	_ QuoteSource      = (*DydxClient)(nil)
+	_ InstrumentSource = (*DydxClient)(nil)
+	_ SymbolSource     = (*DydxClient)(nil)
+)
+
+type DydxClient struct {
+	client  *http.Client
+	baseURL string
+}
+
+// DydxPerpetualMarket is a single market from the /perpetualMarkets endpoint
+type DydxPerpetualMarket struct {
+	Ticker      string `json:"ticker"`
+	Status      string `json:"status"`
+	OraclePrice string `json:"oraclePrice"`
+}
+
+type DydxPerpetualMarketsResponse struct {
+	Markets map[string]DydxPerpetualMarket `json:"markets"`
+}
+
+type DydxOrderbookLevel struct {
+	Price string `json:"price"`
+	Size  string `json:"size"`
+}
+
+// DydxOrderbookResponse represents the response from the /orderbooks/perpetualMarket/:ticker endpoint
+type DydxOrderbookResponse struct {
+	Bids []DydxOrderbookLevel `json:"bids"`
+	Asks []DydxOrderbookLevel `json:"asks"`
+}
+
+func NewDydxClient() *DydxClient {
+	return &DydxClient{
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		baseURL: DYDX_INDEXER_URL,
+	}
+}
+
+// Name returns the source identifier for dYdX
+func (c *DydxClient) Name() string {
+	return DYDX_NAME
+}
+
+// Instrument reports that dYdX perps are quoted in USD and margined in USDC
+func (c *DydxClient) Instrument() Instrument {
+	return Instrument{
+		Type:         INSTRUMENT_SWAP,
+		Quote:        "USD",
+		Settle:       "USDC",
+		Contract:     CONTRACT_LINEAR,
+		ContractSize: 1,
+	}
+}
+
+// HTTPClient exposes the underlying client so its transport can be instrumented
+func (c *DydxClient) HTTPClient() *http.Client {
+	return c.client
+}
+
+// Ticker maps a coin to its dYdX perpetual market, e.g. BTC -> BTC-USD
+func (c *DydxClient) Ticker(coin string) string {
+	return strings.ToUpper(coin) + "-USD"
+}
+
+// NativeSymbols maps each coin's dYdX market to the coin
+func (c *DydxClient) NativeSymbols(coins []string) (map[string]string, error) {
+	natives := make(map[string]string, len(coins))
+	for _, coin := range coins {
+		natives[c.Ticker(coin)] = coin
+	}
+	return natives, nil
+}
+
+// GetPrices fetches the mid price for each of the given coins, falling back to
+// the oracle price for markets with an empty book
+func (c *DydxClient) GetPrices(coins []string) (map[string]float64, error) {
+	quotes, err := c.GetQuotes(coins)
+
+	prices := make(map[string]float64, len(quotes))
+	for coin, quote := range quotes {
+		prices[coin] = quote.Price
+	}
+	return prices, err
+}
+
+// GetQuotes works like GetPrices but labels each quote with the price type
+// used, "mid" or "oracle"
+func (c *DydxClient) GetQuotes(coins []string) (map[string]Quote, error) {
+	oracles, err := c.GetOraclePrices(coins)
+	if oracles == nil {
+		return nil, err
+	}
+
+	quotes := make(map[string]Quote, len(coins))
+	// A market with a bad oracle price is still quoted from its book
+	errs := []error{err}
+
+	for _, coin := range coins {
+		mid, err := c.GetMidPrice(coin)
+		if err == nil {
+			quotes[coin] = Quote{Price: mid, Labels: map[string]string{"price_type": "mid"}}
+			continue
+		}
+
+		if oracle, exists := oracles[coin]; exists {
+			quotes[coin] = Quote{Price: oracle, Labels: map[string]string{"price_type": "oracle"}}
+			continue
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", coin, err))
+	}
+
+	return quotes, errors.Join(errs...)
+}
+
+// GetPrice fetches the mid price for a given coin symbol, falling back to the
+// oracle price when the book is empty
+func (c *DydxClient) GetPrice(coin string) (float64, error) {
+	prices, err := c.GetPrices([]string{coin})
+	if price, exists := prices[coin]; exists {
+		return price, nil
+	}
+	return 0, err
+}
+
+// GetOraclePrices fetches oracle prices for the given coins in a single request.
+// Coins without a dYdX market are omitted, markets whose price can't be parsed
+// are left out and reported in the returned error
+func (c *DydxClient) GetOraclePrices(coins []string) (map[string]float64, error) {
+	var response DydxPerpetualMarketsResponse
+	if err := c.get("/perpetualMarkets", &response); err != nil {
+		return nil, err
+	}
+
+	prices := make(map[string]float64, len(coins))
+	var errs []error
+	for _, coin := range coins {
+		market, exists := response.Markets[c.Ticker(coin)]
+		if !exists {
+			continue
+		}
+
+		price, err := strconv.ParseFloat(market.OraclePrice, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to parse oracle price for %s: %w", coin, err))
+			continue
+		}
+		prices[coin] = price
+	}
+
+	return prices, errors.Join(errs...)
+}
+
+// GetMidPrice computes the mid price from the top of the dYdX orderbook
+func (c *DydxClient) GetMidPrice(coin string) (float64, error) {
+	ticker := c.Ticker(coin)
+
+	var book DydxOrderbookResponse
+	if err := c.get("/orderbooks/perpetualMarket/"+ticker, &book); err != nil {
+		return 0, err
+	}
+
+	if len(book.Bids) == 0 || len(book.Asks) == 0 {
+		return 0, fmt.Errorf("orderbook for %s is empty", ticker)
+	}
+
+	bid, err := strconv.ParseFloat(book.Bids[0].Price, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse best bid for %s: %w", ticker, err)
+	}
+
+	ask, err := strconv.ParseFloat(book.Asks[0].Price, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse best ask for %s: %w", ticker, err)
+	}
+
+	return (bid + ask) / 2, nil
+}
+
+// get performs a GET against the indexer and decodes the JSON response into out
+func (c *DydxClient) get(path string, out interface{}) error {
+	req, err := http.NewRequest("GET", c.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	if err := json.Unmarshal(bodyBytes, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
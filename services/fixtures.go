@@ -0,0 +1,252 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FIXTURE_REDACTED replaces secrets in captured fixtures
+const FIXTURE_REDACTED = "REDACTED"
+
+// Query parameters whose value is replaced in captured URLs
+var fixtureSecretParam = regexp.MustCompile(`(?i)key|token|secret|signature|password|auth`)
+
+// Fixture is one captured request to a venue and the response it got
+type Fixture struct {
+	Source      string          `json:"source"`
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	RequestBody json.RawMessage `json:"request_body,omitempty"`
+	Status      int             `json:"status"`
+	Body        json.RawMessage `json:"body"`
+	CapturedAt  time.Time       `json:"captured_at"`
+}
+
+// FixtureRecorder captures every response sources receive so they can be
+// saved as parser test data. Captures are sanitized: headers are never kept,
+// credential-looking query parameters are replaced and every configured secret
+// is scrubbed from URLs and bodies
+type FixtureRecorder struct {
+	secrets []string
+
+	mu       sync.Mutex
+	fixtures []Fixture
+}
+
+// NewFixtureRecorder creates a recorder scrubbing secrets, e.g. API keys and
+// RPC URLs, from what it captures
+func NewFixtureRecorder(secrets []string) *FixtureRecorder {
+	var nonEmpty []string
+	for _, secret := range secrets {
+		if secret != "" {
+			nonEmpty = append(nonEmpty, secret)
+		}
+	}
+	return &FixtureRecorder{
+		secrets: nonEmpty,
+	}
+}
+
+// Instrument wraps the HTTP transport of every source in the registry that
+// exposes one
+func (r *FixtureRecorder) Instrument(registry *Registry) {
+	sources := registry.Sources()
+	if fallback := registry.Fallback(); fallback != nil {
+		sources = append(sources, fallback)
+	}
+
+	for _, source := range sources {
+		httpSource, ok := source.(HTTPSource)
+		if !ok {
+			continue
+		}
+
+		client := httpSource.HTTPClient()
+		base := client.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		client.Transport = &fixtureTransport{
+			recorder: r,
+			source:   source.Name(),
+			base:     base,
+		}
+	}
+}
+
+// Fixtures returns what was captured so far, in order
+func (r *FixtureRecorder) Fixtures() []Fixture {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Fixture(nil), r.fixtures...)
+}
+
+// Save writes every capture as indented JSON under dir/<source>/<version>,
+// replacing an earlier capture of the same version, and returns the files
+// written
+func (r *FixtureRecorder) Save(dir, version string) ([]string, error) {
+	written := make(map[string]bool)
+	counts := make(map[string]int)
+
+	var files []string
+	for _, fixture := range r.Fixtures() {
+		sourceDir := filepath.Join(dir, fixture.Source, version)
+		if !written[sourceDir] {
+			if err := os.RemoveAll(sourceDir); err != nil {
+				return files, err
+			}
+			if err := os.MkdirAll(sourceDir, 0o755); err != nil {
+				return files, err
+			}
+			written[sourceDir] = true
+		}
+
+		counts[fixture.Source]++
+		name := fmt.Sprintf("%03d_%s.json", counts[fixture.Source], fixtureSlug(fixture))
+		path := filepath.Join(sourceDir, name)
+
+		// Keep URLs readable, & would otherwise be escaped
+		var data bytes.Buffer
+		encoder := json.NewEncoder(&data)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(fixture); err != nil {
+			return files, err
+		}
+		if err := os.WriteFile(path, data.Bytes(), 0o644); err != nil {
+			return files, err
+		}
+		files = append(files, path)
+	}
+
+	return files, nil
+}
+
+// record stores one exchange after sanitizing it
+func (r *FixtureRecorder) record(fixture Fixture) {
+	fixture.URL = r.scrub(sanitizeURL(fixture.URL))
+	fixture.RequestBody = r.scrubJSON(fixture.RequestBody)
+	fixture.Body = r.scrubJSON(fixture.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fixtures = append(r.fixtures, fixture)
+}
+
+func (r *FixtureRecorder) scrub(value string) string {
+	for _, secret := range r.secrets {
+		value = strings.ReplaceAll(value, secret, FIXTURE_REDACTED)
+	}
+	return value
+}
+
+// scrubJSON scrubs secrets from a body, storing bodies that aren't JSON as a
+// JSON string so the fixture stays valid
+func (r *FixtureRecorder) scrubJSON(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+
+	scrubbed := r.scrub(string(body))
+	if json.Valid([]byte(scrubbed)) {
+		return json.RawMessage(scrubbed)
+	}
+	quoted, _ := json.Marshal(scrubbed)
+	return quoted
+}
+
+// sanitizeURL replaces the value of credential-looking query parameters and
+// drops any user info
+func sanitizeURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	parsed.User = nil
+
+	query := parsed.Query()
+	for name := range query {
+		if fixtureSecretParam.MatchString(name) {
+			query.Set(name, FIXTURE_REDACTED)
+		}
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// fixtureSlug names a fixture file after its endpoint, and the request type
+// and dex for venues like Hyperliquid that serve everything from one path
+func fixtureSlug(fixture Fixture) string {
+	slug := fixture.Method
+	if parsed, err := url.Parse(fixture.URL); err == nil {
+		slug += "_" + parsed.Path
+	}
+
+	var request struct {
+		Type   string `json:"type"`
+		Method string `json:"method"`
+		Dex    string `json:"dex"`
+	}
+	if json.Unmarshal(fixture.RequestBody, &request) == nil {
+		slug += "_" + request.Type + request.Method
+		if request.Dex != "" {
+			slug += "_" + request.Dex
+		}
+	}
+
+	slug = strings.ToLower(nonSlug.ReplaceAllString(slug, "_"))
+	return strings.Trim(slug, "_")
+}
+
+var nonSlug = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// fixtureTransport captures every request and response passing through it
+type fixtureTransport struct {
+	recorder *FixtureRecorder
+	source   string
+	base     http.RoundTripper
+}
+
+func (t *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var requestBody []byte
+	if req.Body != nil && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			requestBody, _ = io.ReadAll(body)
+			body.Close()
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	t.recorder.record(Fixture{
+		Source:      t.source,
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		RequestBody: requestBody,
+		Status:      resp.StatusCode,
+		Body:        body,
+		CapturedAt:  time.Now().UTC(),
+	})
+
+	return resp, nil
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	GMX_ARBITRUM  = "arbitrum"
+	GMX_AVALANCHE = "avalanche"
+
+	// GMX scales USD prices to 30 decimals minus the token's own decimals
+	GMX_PRICE_PRECISION = 30
+)
+
+var gmxAPIURLs = map[string]string{
+	GMX_ARBITRUM:  "https://arbitrum-api.gmxinfra.io",
+	GMX_AVALANCHE: "https://avalanche-api.gmxinfra.io",
+}
+
+var (
+	_ PriceSource      = (*GMXClient)(nil)
+	_ QuoteSource      = (*GMXClient)(nil)
+	_ InstrumentSource = (*GMXClient)(nil)
+)
+
+type GMXClient struct {
+	client  *http.Client
+	baseURL string
+	network string
+
+	mu       sync.Mutex
+	decimals map[string]int
+}
+
+// GMXTicker is a single entry from the /prices/tickers endpoint
+type GMXTicker struct {
+	TokenAddress string `json:"tokenAddress"`
+	TokenSymbol  string `json:"tokenSymbol"`
+	MinPrice     string `json:"minPrice"`
+	MaxPrice     string `json:"maxPrice"`
+	UpdatedAt    int64  `json:"updatedAt"`
+}
+
+// GMXSignedPrice is a single entry from the /signed_prices/latest endpoint.
+// Keepers submit these on-chain, so the price fields come with a signature
+type GMXSignedPrice struct {
+	TokenSymbol  string `json:"tokenSymbol"`
+	TokenAddress string `json:"tokenAddress"`
+	MinPriceFull string `json:"minPriceFull"`
+	MaxPriceFull string `json:"maxPriceFull"`
+	Signer       string `json:"signer"`
+	Signature    string `json:"signature"`
+	CreatedAt    string `json:"createdAt"`
+}
+
+type GMXSignedPricesResponse struct {
+	SignedPrices []GMXSignedPrice `json:"signedPrices"`
+}
+
+type GMXToken struct {
+	Symbol   string `json:"symbol"`
+	Address  string `json:"address"`
+	Decimals int    `json:"decimals"`
+}
+
+type GMXTokensResponse struct {
+	Tokens []GMXToken `json:"tokens"`
+}
+
+// NewGMXClient creates a client for the GMX v2 deployment on the given
+// network, either "arbitrum" or "avalanche"
+func NewGMXClient(network string) (*GMXClient, error) {
+	baseURL, exists := gmxAPIURLs[network]
+	if !exists {
+		return nil, fmt.Errorf("unsupported GMX network %q", network)
+	}
+
+	return &GMXClient{
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		baseURL:  baseURL,
+		network:  network,
+		decimals: make(map[string]int),
+	}, nil
+}
+
+// Name returns the source identifier, one per GMX deployment
+func (c *GMXClient) Name() string {
+	return "gmx_" + c.network
+}
+
+// Instrument reports that GMX perps are priced in USD, positions are usually collateralised in USDC
+func (c *GMXClient) Instrument() Instrument {
+	return Instrument{
+		Type:         INSTRUMENT_SWAP,
+		Quote:        "USD",
+		Settle:       "USDC",
+		Contract:     CONTRACT_LINEAR,
+		ContractSize: 1,
+	}
+}
+
+// HTTPClient exposes the underlying client so its transport can be instrumented
+func (c *GMXClient) HTTPClient() *http.Client {
+	return c.client
+}
+
+// GetPrice fetches the current mark price for a given coin symbol
+func (c *GMXClient) GetPrice(coin string) (float64, error) {
+	prices, err := c.GetPrices([]string{coin})
+	if price, exists := prices[coin]; exists {
+		return price, nil
+	}
+	return 0, err
+}
+
+// GetPrices fetches mark prices (the midpoint of GMX's min/max oracle price)
+// for the given coins. The signed price feed is used when tickers are unavailable
+func (c *GMXClient) GetPrices(coins []string) (map[string]float64, error) {
+	quotes, err := c.GetQuotes(coins)
+
+	prices := make(map[string]float64, len(quotes))
+	for coin, quote := range quotes {
+		prices[coin] = quote.Price
+	}
+	return prices, err
+}
+
+// GetQuotes works like GetPrices but labels each quote with the network and
+// the feed that served it, "tickers" or "signed_prices"
+func (c *GMXClient) GetQuotes(coins []string) (map[string]Quote, error) {
+	feed := "tickers"
+	raw, err := c.getTickerQuotes()
+	if err != nil {
+		signed, signedErr := c.getSignedQuotes()
+		if signedErr != nil {
+			return nil, errors.Join(err, signedErr)
+		}
+		raw = signed
+		feed = "signed_prices"
+	}
+
+	decimals, err := c.tokenDecimals()
+	if err != nil {
+		return nil, err
+	}
+
+	quotes := make(map[string]Quote, len(coins))
+	var errs []error
+
+	for _, coin := range coins {
+		symbol := strings.ToUpper(coin)
+		quote, exists := raw[symbol]
+		if !exists {
+			errs = append(errs, fmt.Errorf("%s: not listed on GMX %s", coin, c.network))
+			continue
+		}
+
+		tokenDecimals, exists := decimals[symbol]
+		if !exists {
+			errs = append(errs, fmt.Errorf("%s: unknown token decimals", coin))
+			continue
+		}
+
+		price, err := gmxMarkPrice(quote[0], quote[1], tokenDecimals)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", coin, err))
+			continue
+		}
+		quotes[coin] = Quote{
+			Price:  price,
+			Labels: map[string]string{"network": c.network, "feed": feed},
+		}
+	}
+
+	return quotes, errors.Join(errs...)
+}
+
+// getTickerQuotes returns raw min/max prices keyed by token symbol
+func (c *GMXClient) getTickerQuotes() (map[string][2]string, error) {
+	var tickers []GMXTicker
+	if err := c.get("/prices/tickers", &tickers); err != nil {
+		return nil, err
+	}
+
+	quotes := make(map[string][2]string, len(tickers))
+	for _, ticker := range tickers {
+		quotes[strings.ToUpper(ticker.TokenSymbol)] = [2]string{ticker.MinPrice, ticker.MaxPrice}
+	}
+	return quotes, nil
+}
+
+// getSignedQuotes returns raw min/max prices from the keeper-signed feed keyed by token symbol
+func (c *GMXClient) getSignedQuotes() (map[string][2]string, error) {
+	var response GMXSignedPricesResponse
+	if err := c.get("/signed_prices/latest", &response); err != nil {
+		return nil, err
+	}
+
+	quotes := make(map[string][2]string, len(response.SignedPrices))
+	for _, signed := range response.SignedPrices {
+		quotes[strings.ToUpper(signed.TokenSymbol)] = [2]string{signed.MinPriceFull, signed.MaxPriceFull}
+	}
+	return quotes, nil
+}
+
+// tokenDecimals returns decimals keyed by token symbol, loading them once per client
+func (c *GMXClient) tokenDecimals() (map[string]int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.decimals) > 0 {
+		return c.decimals, nil
+	}
+
+	var response GMXTokensResponse
+	if err := c.get("/tokens", &response); err != nil {
+		return nil, err
+	}
+
+	for _, token := range response.Tokens {
+		c.decimals[strings.ToUpper(token.Symbol)] = token.Decimals
+	}
+	return c.decimals, nil
+}
+
+// gmxMarkPrice converts GMX's scaled integer min/max prices into a USD midpoint
+func gmxMarkPrice(minPrice, maxPrice string, tokenDecimals int) (float64, error) {
+	low, ok := new(big.Float).SetString(minPrice)
+	if !ok {
+		return 0, fmt.Errorf("invalid min price %q", minPrice)
+	}
+
+	high, ok := new(big.Float).SetString(maxPrice)
+	if !ok {
+		return 0, fmt.Errorf("invalid max price %q", maxPrice)
+	}
+
+	scale := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(GMX_PRICE_PRECISION-tokenDecimals)), nil))
+	mid := new(big.Float).Add(low, high)
+	mid.Quo(mid, big.NewFloat(2))
+	mid.Quo(mid, scale)
+
+	price, _ := mid.Float64()
+	return price, nil
+}
+
+// get performs a GET against the GMX API and decodes the JSON response into out
+func (c *GMXClient) get(path string, out interface{}) error {
+	req, err := http.NewRequest("GET", c.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	if err := json.Unmarshal(bodyBytes, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
@@ -3,21 +3,72 @@ package services
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/notblessy/dexlite/symbols"
 )
 
 const (
 	HYPERLIQUID_API_URL = "https://api.hyperliquid.xyz/info"
+	HYPERLIQUID_NAME    = "hyperliquid"
+
+	// HYPERLIQUID_SPOT_QUOTE is the quote of the spot pairs that stand for a
+	// tracked coin
+	HYPERLIQUID_SPOT_QUOTE = "USDC"
+
+	// Hyperliquid settles funding every hour
+	HYPERLIQUID_FUNDING_INTERVAL = time.Hour
 )
 
+var (
+	_ PriceSource            = (*HyperLiquidClient)(nil)
+	_ QuoteSource            = (*HyperLiquidClient)(nil)
+	_ BatchSource            = (*HyperLiquidClient)(nil)
+	_ MarketLister           = (*HyperLiquidClient)(nil)
+	_ InstrumentSource       = (*HyperLiquidClient)(nil)
+	_ MarketInstrumentSource = (*HyperLiquidClient)(nil)
+	_ FundingSource          = (*HyperLiquidClient)(nil)
+	_ MarkSource             = (*HyperLiquidClient)(nil)
+	_ OrderBookSource        = (*HyperLiquidClient)(nil)
+	_ SymbolSource           = (*HyperLiquidClient)(nil)
+	_ HistorySource          = (*HyperLiquidClient)(nil)
+)
+
+// hyperliquidCandleSizes are the candle sizes candleSnapshot serves below a
+// day, smallest first
+var hyperliquidCandleSizes = []struct {
+	name string
+	size time.Duration
+}{
+	{"1m", time.Minute},
+	{"3m", 3 * time.Minute},
+	{"5m", 5 * time.Minute},
+	{"15m", 15 * time.Minute},
+	{"30m", 30 * time.Minute},
+	{"1h", time.Hour},
+	{"2h", 2 * time.Hour},
+	{"4h", 4 * time.Hour},
+	{"8h", 8 * time.Hour},
+	{"12h", 12 * time.Hour},
+	{"1d", 24 * time.Hour},
+}
+
+// HyperLiquidClient prices Hyperliquid's own perps and the builder-deployed
+// (HIP-3) ones, named dex:TICKER, each dex having a universe of its own
 type HyperLiquidClient struct {
 	client  *http.Client
 	baseURL string
+
+	mu sync.Mutex
+	// preLaunch holds the markets last seen without an order book
+	preLaunch map[string]bool
 }
 
 type MarketDataResponse struct {
@@ -67,155 +118,805 @@ func NewHyperLiquidClient() *HyperLiquidClient {
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		baseURL: HYPERLIQUID_API_URL,
+		baseURL:   HYPERLIQUID_API_URL,
+		preLaunch: make(map[string]bool),
 	}
 }
 
+// Name returns the source identifier for Hyperliquid
+func (c *HyperLiquidClient) Name() string {
+	return HYPERLIQUID_NAME
+}
+
+// Instrument reports that Hyperliquid perps are quoted in USD and margined in USDC
+func (c *HyperLiquidClient) Instrument() Instrument {
+	return Instrument{
+		Type:         INSTRUMENT_SWAP,
+		Quote:        "USD",
+		Settle:       "USDC",
+		Contract:     CONTRACT_LINEAR,
+		ContractSize: 1,
+	}
+}
+
+// MarketInstrument flags builder-deployed markets with their dex, and those
+// last seen without an order book as pre-launch
+func (c *HyperLiquidClient) MarketInstrument(coin string) Instrument {
+	instrument := c.Instrument()
+	instrument.Builder, _ = symbols.SplitDex(coin)
+
+	c.mu.Lock()
+	instrument.PreLaunch = c.preLaunch[coin]
+	c.mu.Unlock()
+	return instrument
+}
+
+// setPreLaunch records whether coin's market trades yet
+func (c *HyperLiquidClient) setPreLaunch(coin string, preLaunch bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if preLaunch {
+		c.preLaunch[coin] = true
+	} else {
+		delete(c.preLaunch, coin)
+	}
+}
+
+// HTTPClient exposes the underlying client so its transport can be instrumented
+func (c *HyperLiquidClient) HTTPClient() *http.Client {
+	return c.client
+}
+
+// GetPrices fetches the current price for each of the given coins, see
+// GetQuotes
+func (c *HyperLiquidClient) GetPrices(coins []string) (map[string]float64, error) {
+	quotes, err := c.GetQuotes(coins)
+	prices := make(map[string]float64, len(quotes))
+	for coin, quote := range quotes {
+		prices[coin] = quote.Price
+	}
+	return prices, err
+}
+
+// GetQuotes prices coins on Hyperliquid's own universe with a single allMids
+// request, and those of each builder-deployed dex from its asset contexts,
+// labelled with the dex. A market without an order book yet is pre-launch
+// and priced at its mark, so it has a price from the minute it is listed
+func (c *HyperLiquidClient) GetQuotes(coins []string) (map[string]Quote, error) {
+	quotes := make(map[string]Quote, len(coins))
+	var errs []error
+
+	for dex, group := range groupByDex(coins) {
+		if dex == "" {
+			mids, err := c.fetchMids("")
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for _, coin := range group {
+				price, err := lookupMid(mids, coin)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", coin, err))
+					continue
+				}
+				quotes[coin] = Quote{Price: price}
+			}
+			continue
+		}
+
+		byName, err := c.fetchAssetCtxsByName(dex)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("dex %s: %w", dex, err))
+			continue
+		}
+		for _, coin := range group {
+			ctx, exists := byName[strings.ToUpper(coin)]
+			if !exists {
+				errs = append(errs, fmt.Errorf("%s: not listed", coin))
+				continue
+			}
+			quote, err := ctx.quote(dex)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to parse price for %s: %w", coin, err))
+				continue
+			}
+			c.setPreLaunch(coin, ctx.MidPx == nil)
+			quotes[coin] = quote
+		}
+	}
+
+	return quotes, errors.Join(errs...)
+}
+
+// groupByDex splits coins by the dex they are listed on, "" for Hyperliquid's
+// own universe
+func groupByDex(coins []string) map[string][]string {
+	groups := make(map[string][]string)
+	for _, coin := range coins {
+		dex, _ := symbols.SplitDex(coin)
+		groups[dex] = append(groups[dex], coin)
+	}
+	return groups
+}
+
+// GetAllPrices fetches the mid price of every coin listed on Hyperliquid and
+// on every builder-deployed dex, one allMids request each. Coins whose price
+// can't be parsed are left out and reported in the returned error
+func (c *HyperLiquidClient) GetAllPrices() (map[string]float64, error) {
+	dexes, err := c.fetchPerpDexs()
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make(map[string]float64)
+	var errs []error
+
+	for _, dex := range append([]string{""}, dexes...) {
+		mids, err := c.fetchMids(dex)
+		if err != nil {
+			if dex == "" {
+				return nil, err
+			}
+			errs = append(errs, fmt.Errorf("dex %s: %w", dex, err))
+			continue
+		}
+
+		for coin, priceStr := range mids {
+			// allMids also lists spot pairs, keyed by their index, as @107
+			if dex != "" && !strings.HasPrefix(coin, dex+symbols.DEX_SEPARATOR) {
+				continue
+			}
+			price, err := strconv.ParseFloat(priceStr, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to parse price for %s: %w", coin, err))
+				continue
+			}
+			prices[coin] = price
+		}
+	}
+
+	return prices, errors.Join(errs...)
+}
+
 // GetPrice fetches the current price for a given coin symbol
 func (c *HyperLiquidClient) GetPrice(coin string) (float64, error) {
-	// HyperLiquid uses coin names like "BTC", "ETH", etc.
-	// We need to get all mids and find the one matching our coin
+	quotes, err := c.GetQuotes([]string{coin})
+	quote, exists := quotes[coin]
+	if !exists {
+		return 0, err
+	}
+	return quote.Price, nil
+}
+
+// lookupMid finds a coin in the mids map, falling back to a case-insensitive match
+func lookupMid(mids map[string]string, coin string) (float64, error) {
+	priceStr, exists := mids[coin]
+	if !exists {
+		coinUpper := strings.ToUpper(coin)
+		for key, value := range mids {
+			if strings.ToUpper(key) == coinUpper {
+				priceStr, exists = value, true
+				break
+			}
+		}
+	}
+	if !exists {
+		return 0, fmt.Errorf("coin %s not found in response", coin)
+	}
+
+	price, err := strconv.ParseFloat(priceStr, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse price for %s: %w", coin, err)
+	}
+	return price, nil
+}
 
+// fetchMids downloads the allMids payload of dex, empty for Hyperliquid's own
+// universe, and returns the mid price string for every coin it lists
+func (c *HyperLiquidClient) fetchMids(dex string) (map[string]string, error) {
 	// HyperLiquid API expects POST with body containing the request
 	body := map[string]interface{}{
 		"type": "allMids",
 	}
+	if dex != "" {
+		body["dex"] = dex
+	}
 
 	bodyBytes, err := json.Marshal(body)
 	if err != nil {
-		return 0, fmt.Errorf("failed to marshal request body: %w", err)
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
 	req, err := http.NewRequest("POST", c.baseURL, bytes.NewReader(bodyBytes))
 	if err != nil {
-		return 0, fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return 0, fmt.Errorf("failed to make request: %w", err)
+		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return 0, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(bodyBytes))
 	}
 
 	// Read the response body first to allow multiple parsing attempts
 	bodyBytes, err = io.ReadAll(resp.Body)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	// Try Format 1: Direct map[string]string (most common format for allMids)
 	var directMids map[string]string
 	if err := json.Unmarshal(bodyBytes, &directMids); err == nil && len(directMids) > 0 {
-		// Try exact match first
-		if priceStr, exists := directMids[coin]; exists {
-			price, err := strconv.ParseFloat(priceStr, 64)
-			if err != nil {
-				return 0, fmt.Errorf("failed to parse price for %s: %w", coin, err)
-			}
-			return price, nil
-		}
-		// Try case-insensitive match
-		coinUpper := strings.ToUpper(coin)
-		for key, priceStr := range directMids {
-			if strings.ToUpper(key) == coinUpper {
-				price, err := strconv.ParseFloat(priceStr, 64)
-				if err != nil {
-					return 0, fmt.Errorf("failed to parse price for %s: %w", coin, err)
-				}
-				return price, nil
-			}
-		}
+		return directMids, nil
 	}
 
 	// Try Format 2: Wrapped response (like WebSocket format: { data: { mids: {...} } })
 	var wrappedResponse WrappedAllMidsResponse
-	if err := json.Unmarshal(bodyBytes, &wrappedResponse); err == nil && wrappedResponse.Data.Mids != nil {
-		if priceStr, exists := wrappedResponse.Data.Mids[coin]; exists {
-			price, err := strconv.ParseFloat(priceStr, 64)
-			if err != nil {
-				return 0, fmt.Errorf("failed to parse price for %s: %w", coin, err)
-			}
-			return price, nil
-		}
-		// Try case-insensitive match
-		coinUpper := strings.ToUpper(coin)
-		for key, priceStr := range wrappedResponse.Data.Mids {
-			if strings.ToUpper(key) == coinUpper {
-				price, err := strconv.ParseFloat(priceStr, 64)
-				if err != nil {
-					return 0, fmt.Errorf("failed to parse price for %s: %w", coin, err)
-				}
-				return price, nil
-			}
-		}
+	if err := json.Unmarshal(bodyBytes, &wrappedResponse); err == nil && len(wrappedResponse.Data.Mids) > 0 {
+		return wrappedResponse.Data.Mids, nil
 	}
 
 	// Try Format 3: Direct AllMidsResponse with mids
 	var response AllMidsResponse
 	if err := json.Unmarshal(bodyBytes, &response); err == nil {
 		// Try Format 3a: Direct mids map
-		if response.Mids != nil {
-			if priceStr, exists := response.Mids[coin]; exists {
-				price, err := strconv.ParseFloat(priceStr, 64)
-				if err != nil {
-					return 0, fmt.Errorf("failed to parse price for %s: %w", coin, err)
-				}
-				return price, nil
-			}
-			// Try case-insensitive match
-			coinUpper := strings.ToUpper(coin)
-			for key, priceStr := range response.Mids {
-				if strings.ToUpper(key) == coinUpper {
-					price, err := strconv.ParseFloat(priceStr, 64)
-					if err != nil {
-						return 0, fmt.Errorf("failed to parse price for %s: %w", coin, err)
-					}
-					return price, nil
-				}
-			}
+		if len(response.Mids) > 0 {
+			return response.Mids, nil
 		}
 
 		// Try Format 3b: Nested structure with PerpInfo
-		if response.Data != nil {
-			if perpInfo, exists := response.Data[coin]; exists {
-				// Parse the midPx as float64
-				price, err := strconv.ParseFloat(perpInfo.MidPx, 64)
-				if err != nil {
-					return 0, fmt.Errorf("failed to parse price for %s: %w", coin, err)
-				}
-				return price, nil
-			}
-			// Try case-insensitive match
-			coinUpper := strings.ToUpper(coin)
-			for key, perpInfo := range response.Data {
-				if strings.ToUpper(key) == coinUpper {
-					price, err := strconv.ParseFloat(perpInfo.MidPx, 64)
-					if err != nil {
-						return 0, fmt.Errorf("failed to parse price for %s: %w", coin, err)
-					}
-					return price, nil
-				}
+		if len(response.Data) > 0 {
+			mids := make(map[string]string, len(response.Data))
+			for coin, perpInfo := range response.Data {
+				mids[coin] = perpInfo.MidPx
 			}
+			return mids, nil
 		}
 	}
 
 	// If all parsing attempts failed, try to get debug info
 	var genericResponse map[string]interface{}
 	if err := json.Unmarshal(bodyBytes, &genericResponse); err == nil {
-		// Extract all available coin symbols for debugging
-		availableCoins := getMapKeys(genericResponse)
-		return 0, fmt.Errorf("coin %s not found in response. Available coins in response: %v", coin, availableCoins)
+		return nil, fmt.Errorf("no mids found in response. Keys in response: %v", getMapKeys(genericResponse))
 	}
 
 	// Last resort: try to parse as array or other structure
-	return 0, fmt.Errorf("coin %s not found. Response (first 500 chars): %s", coin, string(bodyBytes[:min(500, len(bodyBytes))]))
+	return nil, fmt.Errorf("no mids found. Response (first 500 chars): %s", string(bodyBytes[:min(500, len(bodyBytes))]))
+}
+
+// HyperliquidAssetCtx is the per-market state returned by metaAndAssetCtxs,
+// in the same order as the universe
+type HyperliquidAssetCtx struct {
+	DayNtlVlm string `json:"dayNtlVlm"`
+	Funding   string `json:"funding"`
+	MarkPx    string `json:"markPx"`
+	// MidPx is null while the market has no order book
+	MidPx    *string `json:"midPx"`
+	OraclePx string  `json:"oraclePx"`
+	Premium  string  `json:"premium"`
+}
+
+// quote prices a market of dex at its mid, or at its mark before it trades
+func (ctx HyperliquidAssetCtx) quote(dex string) (Quote, error) {
+	labels := map[string]string{"dex": dex}
+	if ctx.MidPx != nil {
+		price, err := strconv.ParseFloat(*ctx.MidPx, 64)
+		labels["price_type"] = "mid"
+		return Quote{Price: price, Labels: labels}, err
+	}
+
+	price, err := strconv.ParseFloat(ctx.MarkPx, 64)
+	labels["price_type"] = "mark"
+	labels["pre_launch"] = "true"
+	return Quote{Price: price, Labels: labels}, err
+}
+
+// HyperliquidPerpDex is a builder-deployed perp dex as listed by perpDexs
+type HyperliquidPerpDex struct {
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+	Deployer string `json:"deployer"`
+}
+
+// ListMarkets returns every perp market, Hyperliquid's own and those of every
+// builder-deployed dex, with its 24h notional volume. Builder markets are
+// flagged with their dex and markets without an order book as pre-launch
+func (c *HyperLiquidClient) ListMarkets() ([]Market, error) {
+	dexes, err := c.fetchPerpDexs()
+	if err != nil {
+		return nil, err
+	}
+
+	var markets []Market
+	var errs []error
+	for _, dex := range append([]string{""}, dexes...) {
+		meta, ctxs, err := c.fetchAssetCtxs(dex)
+		if err != nil {
+			if dex == "" {
+				return nil, err
+			}
+			errs = append(errs, fmt.Errorf("dex %s: %w", dex, err))
+			continue
+		}
+
+		for i, item := range meta.Universe {
+			volume, _ := strconv.ParseFloat(ctxs[i].DayNtlVlm, 64)
+			preLaunch := ctxs[i].MidPx == nil
+			c.setPreLaunch(item.Name, preLaunch)
+			markets = append(markets, Market{
+				Coin:      item.Name,
+				Volume24h: volume,
+				Builder:   dex,
+				PreLaunch: preLaunch,
+			})
+		}
+	}
+
+	return markets, errors.Join(errs...)
+}
+
+// HyperliquidSpotMeta is the spotMeta response. Pairs refer to their base and
+// quote by index into Tokens
+type HyperliquidSpotMeta struct {
+	Tokens   []HyperliquidSpotToken `json:"tokens"`
+	Universe []HyperliquidSpotPair  `json:"universe"`
+}
+
+type HyperliquidSpotToken struct {
+	Name  string `json:"name"`
+	Index int    `json:"index"`
+}
+
+type HyperliquidSpotPair struct {
+	// Name is @ followed by Index for all but the first pairs listed,
+	// which go by BASE/QUOTE
+	Name   string `json:"name"`
+	Tokens [2]int `json:"tokens"`
+	Index  int    `json:"index"`
+}
+
+// NativeSymbols maps the spot pairs whose base is one of coins, e.g. @107 for
+// HYPE/USDC, to the coin. Perps go by the coin itself
+func (c *HyperLiquidClient) NativeSymbols(coins []string) (map[string]string, error) {
+	bodyBytes, err := json.Marshal(map[string]interface{}{
+		"type": "spotMeta",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var meta HyperliquidSpotMeta
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	tokens := make(map[int]string, len(meta.Tokens))
+	for _, token := range meta.Tokens {
+		tokens[token.Index] = token.Name
+	}
+	tracked := make(map[string]bool, len(coins))
+	for _, coin := range coins {
+		tracked[coin] = true
+	}
+
+	natives := make(map[string]string)
+	for _, pair := range meta.Universe {
+		// Only USDC pairs, the quote tracked prices are in
+		if tokens[pair.Tokens[1]] != HYPERLIQUID_SPOT_QUOTE {
+			continue
+		}
+		coin := symbols.Normalize(tokens[pair.Tokens[0]])
+		if tracked[coin] {
+			natives[pair.Name] = coin
+		}
+	}
+	return natives, nil
+}
+
+// fetchPerpDexs returns the names of the builder-deployed dexes
+func (c *HyperLiquidClient) fetchPerpDexs() ([]string, error) {
+	bodyBytes, err := json.Marshal(map[string]interface{}{
+		"type": "perpDexs",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	// The first entry stands for Hyperliquid's own dex and is null
+	var response []*HyperliquidPerpDex
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	dexes := make([]string, 0, len(response))
+	for _, dex := range response {
+		if dex != nil && dex.Name != "" {
+			dexes = append(dexes, dex.Name)
+		}
+	}
+	return dexes, nil
+}
+
+// assetCtxsOf returns the asset context of every market listed on the dexes
+// coins belong to, keyed by upper-cased name, with one request per dex
+func (c *HyperLiquidClient) assetCtxsOf(coins []string) (map[string]HyperliquidAssetCtx, error) {
+	byName := make(map[string]HyperliquidAssetCtx, len(coins))
+	var errs []error
+
+	for dex := range groupByDex(coins) {
+		ctxs, err := c.fetchAssetCtxsByName(dex)
+		if err != nil {
+			if dex == "" {
+				return nil, err
+			}
+			errs = append(errs, fmt.Errorf("dex %s: %w", dex, err))
+			continue
+		}
+		for name, ctx := range ctxs {
+			byName[name] = ctx
+		}
+	}
+
+	return byName, errors.Join(errs...)
+}
+
+// fetchAssetCtxsByName returns the asset context of every market of dex,
+// keyed by upper-cased name
+func (c *HyperLiquidClient) fetchAssetCtxsByName(dex string) (map[string]HyperliquidAssetCtx, error) {
+	meta, ctxs, err := c.fetchAssetCtxs(dex)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]HyperliquidAssetCtx, len(meta.Universe))
+	for i, item := range meta.Universe {
+		byName[strings.ToUpper(item.Name)] = ctxs[i]
+	}
+	return byName, nil
+}
+
+// GetFundingRates returns the current hourly funding rate of each coin from
+// one metaAndAssetCtxs request per dex
+func (c *HyperLiquidClient) GetFundingRates(coins []string) (map[string]Funding, error) {
+	byName, err := c.assetCtxsOf(coins)
+	if byName == nil {
+		return nil, err
+	}
+
+	rates := make(map[string]Funding, len(coins))
+	errs := []error{err}
+
+	for _, coin := range coins {
+		ctx, exists := byName[strings.ToUpper(coin)]
+		if !exists {
+			errs = append(errs, fmt.Errorf("%s: not listed", coin))
+			continue
+		}
+		rate, err := strconv.ParseFloat(ctx.Funding, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to parse funding for %s: %w", coin, err))
+			continue
+		}
+		funding := Funding{
+			Rate:     rate,
+			Interval: HYPERLIQUID_FUNDING_INTERVAL,
+		}
+		// Premium is null for markets without a recent impact price
+		if premium, err := strconv.ParseFloat(ctx.Premium, 64); err == nil {
+			funding.Premium = &premium
+		}
+		rates[coin] = funding
+	}
+
+	return rates, errors.Join(errs...)
+}
+
+// GetMarkPrices returns the mark and oracle price of each coin from one
+// metaAndAssetCtxs request per dex
+func (c *HyperLiquidClient) GetMarkPrices(coins []string) (map[string]MarkPrice, error) {
+	byName, err := c.assetCtxsOf(coins)
+	if byName == nil {
+		return nil, err
+	}
+
+	marks := make(map[string]MarkPrice, len(coins))
+	errs := []error{err}
+
+	for _, coin := range coins {
+		ctx, exists := byName[strings.ToUpper(coin)]
+		if !exists {
+			errs = append(errs, fmt.Errorf("%s: not listed", coin))
+			continue
+		}
+		mark, err := strconv.ParseFloat(ctx.MarkPx, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to parse mark price for %s: %w", coin, err))
+			continue
+		}
+		oracle, err := strconv.ParseFloat(ctx.OraclePx, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to parse oracle price for %s: %w", coin, err))
+			continue
+		}
+		marks[coin] = MarkPrice{Mark: mark, Oracle: oracle}
+	}
+
+	return marks, errors.Join(errs...)
+}
+
+// fetchAssetCtxs downloads the perp universe of dex, empty for Hyperliquid's
+// own, together with each market's current state
+func (c *HyperLiquidClient) fetchAssetCtxs(dex string) (Meta, []HyperliquidAssetCtx, error) {
+	var meta Meta
+
+	body := map[string]interface{}{
+		"type": "metaAndAssetCtxs",
+	}
+	if dex != "" {
+		body["dex"] = dex
+	}
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return meta, nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return meta, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return meta, nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return meta, nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	// The response is a two element array: [meta, assetCtxs]
+	var parts []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&parts); err != nil {
+		return meta, nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(parts) != 2 {
+		return meta, nil, fmt.Errorf("expected [meta, assetCtxs], got %d elements", len(parts))
+	}
+
+	if err := json.Unmarshal(parts[0], &meta); err != nil {
+		return meta, nil, fmt.Errorf("failed to decode meta: %w", err)
+	}
+	var ctxs []HyperliquidAssetCtx
+	if err := json.Unmarshal(parts[1], &ctxs); err != nil {
+		return meta, nil, fmt.Errorf("failed to decode asset contexts: %w", err)
+	}
+	if len(ctxs) != len(meta.Universe) {
+		return meta, nil, fmt.Errorf("universe has %d markets but %d asset contexts", len(meta.Universe), len(ctxs))
+	}
+
+	return meta, ctxs, nil
+}
+
+// HyperliquidL2Book is the l2Book response. Levels holds the bids then the asks
+type HyperliquidL2Book struct {
+	Coin   string                  `json:"coin"`
+	Time   int64                   `json:"time"`
+	Levels [2][]HyperliquidL2Level `json:"levels"`
+}
+
+type HyperliquidL2Level struct {
+	Px string `json:"px"`
+	Sz string `json:"sz"`
+	N  int    `json:"n"`
+}
+
+// GetOrderBook returns the top levels of coin's book per side. l2Book serves
+// at most 20 levels per side
+func (c *HyperLiquidClient) GetOrderBook(coin string, levels int) (OrderBook, error) {
+	var book OrderBook
+
+	bodyBytes, err := json.Marshal(map[string]interface{}{
+		"type": "l2Book",
+		"coin": coin,
+	})
+	if err != nil {
+		return book, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return book, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return book, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return book, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	// An unknown coin is answered with null
+	var response *HyperliquidL2Book
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return book, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if response == nil {
+		return book, fmt.Errorf("%s: not listed", coin)
+	}
+
+	book.Time = time.UnixMilli(response.Time)
+	if book.Bids, err = parseL2Levels(response.Levels[0], levels); err != nil {
+		return book, fmt.Errorf("failed to parse bids for %s: %w", coin, err)
+	}
+	if book.Asks, err = parseL2Levels(response.Levels[1], levels); err != nil {
+		return book, fmt.Errorf("failed to parse asks for %s: %w", coin, err)
+	}
+
+	return book, nil
+}
+
+// HyperliquidCandle is one candle of a candleSnapshot response, times in
+// milliseconds. CloseTime is the last millisecond of the candle
+type HyperliquidCandle struct {
+	OpenTime  int64  `json:"t"`
+	CloseTime int64  `json:"T"`
+	Open      string `json:"o"`
+	High      string `json:"h"`
+	Low       string `json:"l"`
+	Close     string `json:"c"`
+	Volume    string `json:"v"`
+}
+
+// GetCandles returns coin's candles from candleSnapshot, which serves the
+// 5000 most recent candles of each size. The candle still in progress is left
+// out
+func (c *HyperLiquidClient) GetCandles(coin string, size time.Duration, from, to time.Time) ([]Candle, error) {
+	interval := hyperliquidCandleSizes[0]
+	for _, candidate := range hyperliquidCandleSizes {
+		if candidate.size <= size {
+			interval = candidate
+		}
+	}
+
+	bodyBytes, err := json.Marshal(map[string]interface{}{
+		"type": "candleSnapshot",
+		"req": map[string]interface{}{
+			"coin":      coin,
+			"interval":  interval.name,
+			"startTime": from.UnixMilli(),
+			"endTime":   to.UnixMilli(),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var response []HyperliquidCandle
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	now := time.Now()
+	candles := make([]Candle, 0, len(response))
+	for _, raw := range response {
+		candle := Candle{
+			OpenAt:  time.UnixMilli(raw.OpenTime),
+			CloseAt: time.UnixMilli(raw.CloseTime + 1),
+		}
+		if candle.CloseAt.After(now) {
+			continue
+		}
+		values := []struct {
+			raw    string
+			target *float64
+		}{
+			{raw.Open, &candle.Open},
+			{raw.High, &candle.High},
+			{raw.Low, &candle.Low},
+			{raw.Close, &candle.Close},
+			{raw.Volume, &candle.Volume},
+		}
+		for _, value := range values {
+			if *value.target, err = strconv.ParseFloat(value.raw, 64); err != nil {
+				return nil, fmt.Errorf("failed to parse candle for %s: %w", coin, err)
+			}
+		}
+		candles = append(candles, candle)
+	}
+
+	return candles, nil
+}
+
+// parseL2Levels converts the first limit levels of one side of an l2Book
+func parseL2Levels(levels []HyperliquidL2Level, limit int) ([]BookLevel, error) {
+	if limit > 0 && len(levels) > limit {
+		levels = levels[:limit]
+	}
+
+	parsed := make([]BookLevel, len(levels))
+	for i, level := range levels {
+		price, err := strconv.ParseFloat(level.Px, 64)
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseFloat(level.Sz, 64)
+		if err != nil {
+			return nil, err
+		}
+		parsed[i] = BookLevel{Price: price, Size: size, Orders: level.N}
+	}
+	return parsed, nil
 }
 
 // getAvailableCoins extracts available coin symbols from the response for debugging
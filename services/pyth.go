@@ -0,0 +1,196 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PYTH_HERMES_URL = "https://hermes.pyth.network"
+	PYTH_NAME       = "pyth"
+)
+
+// Pyth price feed IDs for the USD pairs of the coins tracked out of the box
+var pythFeedIDs = map[string]string{
+	"BTC":  "e62df6c8b4a85fe1a67db44dc12de5db330f7ac66b72dc658afedf0f4a415b43",
+	"ETH":  "ff61491a931112ddf1bd8147cd1b641375f79f5825126d665480874634fd0ace",
+	"SOL":  "ef0d8b6fda2ceba41da15d4095d1da392a0d2f8ed0c6c7bc0f4cfac8c280b56d",
+	"ARB":  "3fa4252848f9f0a1480be62745a4629d9eb1322aebab8a791e344b3b9c1adcf5",
+	"AVAX": "93da3352f9f1d105fdfe4971cfa80e9dd777bfc5d0f683ebb6e1294b92137bb7",
+}
+
+var (
+	_ PriceSource      = (*PythClient)(nil)
+	_ QuoteSource      = (*PythClient)(nil)
+	_ InstrumentSource = (*PythClient)(nil)
+)
+
+type PythClient struct {
+	client  *http.Client
+	baseURL string
+	feedIDs map[string]string
+}
+
+// PythPrice is a fixed-point price: the real value is Price * 10^Expo
+type PythPrice struct {
+	Price       string `json:"price"`
+	Conf        string `json:"conf"`
+	Expo        int    `json:"expo"`
+	PublishTime int64  `json:"publish_time"`
+}
+
+type PythParsedUpdate struct {
+	ID       string    `json:"id"`
+	Price    PythPrice `json:"price"`
+	EmaPrice PythPrice `json:"ema_price"`
+}
+
+// PythLatestResponse represents the response from the /v2/updates/price/latest endpoint
+type PythLatestResponse struct {
+	Parsed []PythParsedUpdate `json:"parsed"`
+}
+
+func NewPythClient() *PythClient {
+	return &PythClient{
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		baseURL: PYTH_HERMES_URL,
+		feedIDs: pythFeedIDs,
+	}
+}
+
+// Name returns the source identifier for Pyth
+func (c *PythClient) Name() string {
+	return PYTH_NAME
+}
+
+// Instrument reports the market prices are read from
+func (c *PythClient) Instrument() Instrument {
+	return Instrument{
+		Type:  INSTRUMENT_INDEX,
+		Quote: "USD",
+	}
+}
+
+// HTTPClient exposes the underlying client so its transport can be instrumented
+func (c *PythClient) HTTPClient() *http.Client {
+	return c.client
+}
+
+// GetPrice fetches the current oracle price for a given coin symbol
+func (c *PythClient) GetPrice(coin string) (float64, error) {
+	prices, err := c.GetPrices([]string{coin})
+	if price, exists := prices[coin]; exists {
+		return price, nil
+	}
+	return 0, err
+}
+
+// GetPrices fetches current oracle prices for the given coins
+func (c *PythClient) GetPrices(coins []string) (map[string]float64, error) {
+	quotes, err := c.GetQuotes(coins)
+
+	prices := make(map[string]float64, len(quotes))
+	for coin, quote := range quotes {
+		prices[coin] = quote.Price
+	}
+	return prices, err
+}
+
+// GetQuotes fetches current oracle prices with their confidence intervals in a single request
+func (c *PythClient) GetQuotes(coins []string) (map[string]Quote, error) {
+	var errs []error
+	query := url.Values{}
+	coinsByID := make(map[string]string, len(coins))
+
+	for _, coin := range coins {
+		id, exists := c.feedIDs[strings.ToUpper(coin)]
+		if !exists {
+			errs = append(errs, fmt.Errorf("%s: no Pyth feed mapped", coin))
+			continue
+		}
+		query.Add("ids[]", id)
+		coinsByID[id] = coin
+	}
+
+	if len(coinsByID) == 0 {
+		return map[string]Quote{}, errors.Join(errs...)
+	}
+
+	req, err := http.NewRequest("GET", c.baseURL+"/v2/updates/price/latest?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var response PythLatestResponse
+	if err := json.Unmarshal(bodyBytes, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	quotes := make(map[string]Quote, len(response.Parsed))
+	for _, update := range response.Parsed {
+		coin, exists := coinsByID[strings.TrimPrefix(update.ID, "0x")]
+		if !exists {
+			continue
+		}
+
+		price, err := scalePythValue(update.Price.Price, update.Price.Expo)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to parse price: %w", coin, err))
+			continue
+		}
+
+		conf, err := scalePythValue(update.Price.Conf, update.Price.Expo)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to parse confidence: %w", coin, err))
+			continue
+		}
+
+		quotes[coin] = Quote{
+			Price:      price,
+			Confidence: &conf,
+			Timestamp:  time.Unix(update.Price.PublishTime, 0),
+		}
+	}
+
+	for id, coin := range coinsByID {
+		if _, exists := quotes[coin]; !exists {
+			errs = append(errs, fmt.Errorf("%s: feed %s missing from response", coin, id))
+		}
+	}
+
+	return quotes, errors.Join(errs...)
+}
+
+// scalePythValue converts a Pyth fixed-point integer string into a float
+func scalePythValue(value string, expo int) (float64, error) {
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return float64(parsed) * math.Pow10(expo), nil
+}
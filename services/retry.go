@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how failed exchange requests are retried. Delays grow
+// exponentially from BaseDelay up to MaxDelay, with full jitter
+type RetryPolicy struct {
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Instrument wraps the HTTP transport of every source in the registry that
+// exposes one. Call it before other instrumentation so that sits outside the
+// retries
+func (p RetryPolicy) Instrument(registry *Registry) {
+	if p.Attempts <= 1 {
+		return
+	}
+
+	sources := registry.Sources()
+	if fallback := registry.Fallback(); fallback != nil {
+		sources = append(sources, fallback)
+	}
+
+	for _, source := range sources {
+		httpSource, ok := source.(HTTPSource)
+		if !ok {
+			continue
+		}
+
+		client := httpSource.HTTPClient()
+		base := client.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		client.Transport = &retryTransport{
+			policy: p,
+			base:   base,
+		}
+	}
+}
+
+// delay returns how long to wait before the given retry, counting from 1
+func (p RetryPolicy) delay(retry int) time.Duration {
+	ceiling := p.BaseDelay << (retry - 1)
+	if ceiling <= 0 || ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling)
+}
+
+// retryTransport retries requests that failed on the network, were rate
+// limited or hit a server error
+type retryTransport struct {
+	policy RetryPolicy
+	base   http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for retry := 0; ; retry++ {
+		attempt := req
+		if retry > 0 {
+			// The body was consumed by the previous attempt
+			if req.Body != nil && req.GetBody == nil {
+				return nil, errors.New("request body can't be replayed for a retry")
+			}
+			attempt = req.Clone(req.Context())
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				attempt.Body = body
+			}
+		}
+
+		resp, err := t.base.RoundTrip(attempt)
+		if retry+1 >= t.policy.Attempts || !retryable(resp, err) {
+			return resp, err
+		}
+
+		wait := t.policy.delay(retry + 1)
+		if resp != nil {
+			if after := retryAfter(resp); after > wait {
+				wait = after
+				if wait > t.policy.MaxDelay {
+					wait = t.policy.MaxDelay
+				}
+			}
+			resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retryable reports whether a response or error is worth another attempt
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		// Network errors and timeouts; a cancelled request is not retried
+		return !errors.Is(err, context.Canceled)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// retryAfter reads a Retry-After header given in seconds
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
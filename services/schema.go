@@ -0,0 +1,260 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Objects with more keys than this are treated as maps keyed by coin or market
+// rather than structs, so listings and delistings don't count as drift
+const SCHEMA_MAP_KEY_THRESHOLD = 48
+
+// HTTPSource is implemented by sources that talk to their venue over HTTP,
+// letting the transport be instrumented from outside the client
+type HTTPSource interface {
+	HTTPClient() *http.Client
+}
+
+// SchemaDrift describes a change in the structure of a source's responses
+type SchemaDrift struct {
+	Source      string    `json:"source"`
+	Endpoint    string    `json:"endpoint"`
+	Added       []string  `json:"added,omitempty"`
+	Removed     []string  `json:"removed,omitempty"`
+	Fingerprint string    `json:"fingerprint"`
+	DetectedAt  time.Time `json:"detected_at"`
+}
+
+// SchemaMonitor fingerprints the JSON structure of every source response and
+// reports when fields appear or disappear compared to the last seen structure
+type SchemaMonitor struct {
+	onDrift func(SchemaDrift)
+
+	mu        sync.Mutex
+	baselines map[string]map[string]string
+}
+
+func NewSchemaMonitor(onDrift func(SchemaDrift)) *SchemaMonitor {
+	return &SchemaMonitor{
+		onDrift:   onDrift,
+		baselines: make(map[string]map[string]string),
+	}
+}
+
+// Instrument wraps the HTTP transport of every source in the registry that
+// exposes one
+func (m *SchemaMonitor) Instrument(registry *Registry) {
+	sources := registry.Sources()
+	if fallback := registry.Fallback(); fallback != nil {
+		sources = append(sources, fallback)
+	}
+
+	for _, source := range sources {
+		httpSource, ok := source.(HTTPSource)
+		if !ok {
+			continue
+		}
+
+		client := httpSource.HTTPClient()
+		base := client.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		client.Transport = &schemaTransport{
+			monitor: m,
+			source:  source.Name(),
+			base:    base,
+		}
+	}
+}
+
+// Observe records the structure of one response body
+func (m *SchemaMonitor) Observe(source, endpoint string, body []byte) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return
+	}
+
+	paths := make(map[string]string)
+	collectShape(value, "$", paths)
+
+	key := source + " " + endpoint
+
+	m.mu.Lock()
+	baseline, exists := m.baselines[key]
+	if !exists {
+		m.baselines[key] = paths
+		m.mu.Unlock()
+		return
+	}
+
+	var added, removed []string
+	for path, kind := range baseline {
+		newKind, ok := paths[path]
+		if !ok && underEmptyArray(path, paths) {
+			// An empty array says nothing about its elements, keep what we knew
+			paths[path] = kind
+			continue
+		}
+		if !ok || !sameKind(kind, newKind) {
+			removed = append(removed, path+":"+kind)
+		}
+	}
+	for path, kind := range paths {
+		if baseKind, ok := baseline[path]; !ok || !sameKind(baseKind, kind) {
+			added = append(added, path+":"+kind)
+		}
+	}
+
+	m.baselines[key] = paths
+	// onDrift stores and notifies, it runs unlocked so a slow callback doesn't
+	// hold up the responses of every other source
+	m.mu.Unlock()
+
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+
+	m.onDrift(SchemaDrift{
+		Source:      source,
+		Endpoint:    endpoint,
+		Added:       added,
+		Removed:     removed,
+		Fingerprint: fingerprint(paths),
+		DetectedAt:  time.Now(),
+	})
+}
+
+// schemaTransport tees successful JSON responses into the monitor
+type schemaTransport struct {
+	monitor *SchemaMonitor
+	source  string
+	base    http.RoundTripper
+}
+
+func (t *schemaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := requestEndpoint(req)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	t.monitor.Observe(t.source, endpoint, body)
+	return resp, nil
+}
+
+// requestEndpoint identifies the kind of request. Hyperliquid serves every
+// query from one path, so the "type" field of a JSON body is included
+func requestEndpoint(req *http.Request) string {
+	endpoint := req.Method + " " + req.URL.Path
+
+	if req.GetBody == nil {
+		return endpoint
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return endpoint
+	}
+	defer body.Close()
+
+	var payload struct {
+		Type string `json:"type"`
+	}
+	if err := json.NewDecoder(body).Decode(&payload); err == nil && payload.Type != "" {
+		endpoint += " " + payload.Type
+	}
+	return endpoint
+}
+
+// collectShape records every path in value with its JSON kind
+func collectShape(value interface{}, path string, paths map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		paths[path] = "object"
+		if len(v) > SCHEMA_MAP_KEY_THRESHOLD {
+			for _, child := range v {
+				collectShape(child, path+".*", paths)
+			}
+			return
+		}
+		for key, child := range v {
+			collectShape(child, path+"."+key, paths)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			paths[path] = "empty_array"
+			return
+		}
+		paths[path] = "array"
+		for _, child := range v {
+			collectShape(child, path+"[]", paths)
+		}
+	case string:
+		paths[path] = "string"
+	case float64:
+		paths[path] = "number"
+	case bool:
+		paths[path] = "bool"
+	case nil:
+		if _, exists := paths[path]; !exists {
+			paths[path] = "null"
+		}
+	}
+}
+
+// sameKind treats null as compatible with anything, since optional fields
+// flip between null and a value without the schema changing. Likewise an
+// empty array is still an array
+func sameKind(a, b string) bool {
+	if a == b || a == "null" || b == "null" {
+		return true
+	}
+	return (a == "array" && b == "empty_array") || (a == "empty_array" && b == "array")
+}
+
+// underEmptyArray reports whether path lies below an array that is empty in paths
+func underEmptyArray(path string, paths map[string]string) bool {
+	for i := strings.Index(path, "[]"); i >= 0; {
+		if paths[path[:i]] == "empty_array" {
+			return true
+		}
+		next := strings.Index(path[i+2:], "[]")
+		if next < 0 {
+			break
+		}
+		i += 2 + next
+	}
+	return false
+}
+
+// fingerprint returns a stable checksum of a set of paths
+func fingerprint(paths map[string]string) string {
+	keys := make([]string, 0, len(paths))
+	for path, kind := range paths {
+		keys = append(keys, path+":"+kind)
+	}
+	sort.Strings(keys)
+
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,370 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PriceSource is implemented by every venue dexlite can pull prices from
+type PriceSource interface {
+	// Name returns the identifier the source is known by, e.g. "hyperliquid"
+	Name() string
+
+	// GetPrice fetches the current price for a single coin symbol
+	GetPrice(coin string) (float64, error)
+
+	// GetPrices fetches current prices for several coins. Coins that could not
+	// be priced are left out of the map and reported in the returned error, so
+	// callers should keep whatever prices came back even when err != nil
+	GetPrices(coins []string) (map[string]float64, error)
+}
+
+// Quote is a price together with optional metadata some sources provide
+type Quote struct {
+	Price float64
+	// Confidence is the oracle's confidence interval around Price, if reported
+	Confidence *float64
+	// Labels describe how the price was obtained, e.g. which endpoint served it
+	Labels map[string]string
+	// Timestamp is when the venue says the price was observed, by its own clock
+	Timestamp time.Time
+}
+
+// QuoteSource is implemented by sources that report more than a bare price.
+// The fetcher prefers GetQuotes over GetPrices when it is available
+type QuoteSource interface {
+	GetQuotes(coins []string) (map[string]Quote, error)
+}
+
+// BatchSource is implemented by sources that return every listed coin from a
+// single request. The fetcher uses it to make one call per cycle however many
+// coins are tracked
+type BatchSource interface {
+	GetAllPrices() (map[string]float64, error)
+}
+
+// Market is a tradable market as listed by a venue
+type Market struct {
+	Coin string
+	// Volume24h is the notional volume over the last day in USD
+	Volume24h float64
+	// Builder and PreLaunch are as on Instrument
+	Builder   string
+	PreLaunch bool
+}
+
+// MarketLister is implemented by sources that can enumerate their markets,
+// used to onboard coins in bulk
+type MarketLister interface {
+	ListMarkets() ([]Market, error)
+}
+
+// SymbolSource is implemented by venues that list markets under symbols of
+// their own, e.g. BTCUSDT. NativeSymbols maps the symbol of each of coins'
+// markets to the coin, leaving out coins the venue doesn't list
+type SymbolSource interface {
+	NativeSymbols(coins []string) (map[string]string, error)
+}
+
+// Instrument types, following CCXT market types
+const (
+	INSTRUMENT_SPOT  = "spot"
+	INSTRUMENT_SWAP  = "swap"
+	INSTRUMENT_INDEX = "index"
+)
+
+// Contract types of derivatives, which decide how a position is valued
+const (
+	// CONTRACT_LINEAR contracts are worth ContractSize base units, margined
+	// and settled in the quote or a stablecoin
+	CONTRACT_LINEAR = "linear"
+	// CONTRACT_INVERSE contracts are worth ContractSize units of the quote,
+	// margined and settled in the base coin
+	CONTRACT_INVERSE = "inverse"
+	// CONTRACT_QUANTO contracts pay ContractSize units of the settle asset per
+	// point of the price, whatever the settle asset is worth
+	CONTRACT_QUANTO = "quanto"
+)
+
+// Instrument describes what a source's prices are quotes of
+type Instrument struct {
+	// Type is spot, swap for perpetuals or index for oracles and aggregators
+	Type  string
+	Quote string
+	// Settle is the margin asset of perpetuals, empty otherwise. Inverse
+	// contracts leave it empty as each market settles in its own base coin
+	Settle string
+	// Contract is the contract type of swaps, empty otherwise
+	Contract string
+	// ContractSize is what one contract is worth, see the contract types. 0
+	// is treated as 1
+	ContractSize float64
+	// Builder is the dex that deployed the market, such as a Hyperliquid HIP-3
+	// dex, empty for the venue's own markets
+	Builder string
+	// PreLaunch marks a market listed before it trades, priced at its mark
+	PreLaunch bool
+}
+
+// SettleAsset returns what a position in coin's market is settled in
+func (i Instrument) SettleAsset(coin string) string {
+	if i.Contract == CONTRACT_INVERSE && i.Settle == "" {
+		return coin
+	}
+	return i.Settle
+}
+
+// Value returns what contracts contracts are worth at price, in the settle
+// asset. Spot and index instruments count contracts as base units priced in
+// the quote
+func (i Instrument) Value(contracts, price float64) float64 {
+	size := i.ContractSize
+	if size == 0 {
+		size = 1
+	}
+
+	if i.Contract == CONTRACT_INVERSE {
+		if price == 0 {
+			return 0
+		}
+		return contracts * size / price
+	}
+	return contracts * size * price
+}
+
+// PnL returns the profit of holding contracts contracts from entry to exit, in
+// the settle asset. Short positions have negative contracts
+func (i Instrument) PnL(contracts, entry, exit float64) float64 {
+	// An inverse long gains as each contract is worth less of the base coin
+	if i.Contract == CONTRACT_INVERSE {
+		return i.Value(contracts, entry) - i.Value(contracts, exit)
+	}
+	return i.Value(contracts, exit) - i.Value(contracts, entry)
+}
+
+// InstrumentSource is implemented by sources that know what kind of market
+// their prices come from
+type InstrumentSource interface {
+	Instrument() Instrument
+}
+
+// MarketInstrumentSource is implemented by sources whose markets differ from
+// one another, refining Instrument per coin
+type MarketInstrumentSource interface {
+	MarketInstrument(coin string) Instrument
+}
+
+// Funding is a perpetual's current funding rate
+type Funding struct {
+	// Rate is the fraction of notional longs pay shorts each Interval,
+	// negative when shorts pay
+	Rate     float64
+	Interval time.Duration
+	// Premium is the mark to oracle premium the rate was derived from, if
+	// reported
+	Premium *float64
+}
+
+// MarkPrice is a perpetual's mark price next to the oracle price it is
+// anchored to
+type MarkPrice struct {
+	Mark   float64
+	Oracle float64
+}
+
+// MarkSource is implemented by perpetual venues that report mark and oracle
+// prices. Coins that could not be read are reported in the returned error
+type MarkSource interface {
+	GetMarkPrices(coins []string) (map[string]MarkPrice, error)
+}
+
+// BookLevel is one price level of an orderbook
+type BookLevel struct {
+	Price  float64 `json:"price"`
+	Size   float64 `json:"size"`
+	Orders int     `json:"orders,omitempty"`
+}
+
+// OrderBook is the top of a coin's book, bids highest first and asks lowest
+// first. Time is when the venue produced it
+type OrderBook struct {
+	Bids []BookLevel
+	Asks []BookLevel
+	Time time.Time
+}
+
+// OrderBookSource is implemented by venues that serve orderbook snapshots.
+// GetOrderBook returns at most levels levels per side
+type OrderBookSource interface {
+	GetOrderBook(coin string, levels int) (OrderBook, error)
+}
+
+// FundingSource is implemented by perpetual venues that report funding rates.
+// Like GetPrices, coins that could not be read are left out of the map and
+// reported in the returned error
+type FundingSource interface {
+	GetFundingRates(coins []string) (map[string]Funding, error)
+}
+
+// Candle is one interval of a venue's trading history. CloseAt is when the
+// interval ended
+type Candle struct {
+	OpenAt  time.Time
+	CloseAt time.Time
+	Open    float64
+	High    float64
+	Low     float64
+	Close   float64
+	Volume  float64
+}
+
+// HistorySource is implemented by venues that serve historical candles.
+// GetCandles returns coin's candles opening between from and to, oldest first,
+// in the largest size the venue serves that is no longer than size
+type HistorySource interface {
+	GetCandles(coin string, size time.Duration, from, to time.Time) ([]Candle, error)
+}
+
+// CredentialSource is implemented by sources whose credentials can be replaced
+// while running, e.g. after rotation in a secret store. Each source picks the
+// secrets it uses by name and ignores the rest
+type CredentialSource interface {
+	RotateCredentials(secrets map[string]string) error
+}
+
+// FetchQuotes fetches quotes from source, wrapping bare prices for sources that
+// don't implement QuoteSource
+func FetchQuotes(source PriceSource, coins []string) (map[string]Quote, error) {
+	if quoteSource, ok := source.(QuoteSource); ok {
+		return quoteSource.GetQuotes(coins)
+	}
+
+	if batchSource, ok := source.(BatchSource); ok {
+		return fetchBatch(batchSource, coins)
+	}
+
+	prices, err := source.GetPrices(coins)
+	quotes := make(map[string]Quote, len(prices))
+	for coin, price := range prices {
+		quotes[coin] = Quote{Price: price}
+	}
+	return quotes, err
+}
+
+// fetchBatch filters a BatchSource's full price list down to coins. Coins the
+// source didn't return are reported in the error
+func fetchBatch(source BatchSource, coins []string) (map[string]Quote, error) {
+	prices, err := source.GetAllPrices()
+	if prices == nil {
+		return nil, err
+	}
+
+	quotes := make(map[string]Quote, len(coins))
+	var errs []error
+	for _, coin := range coins {
+		price, ok := prices[coin]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: not listed", coin))
+			continue
+		}
+		quotes[coin] = Quote{Price: price}
+	}
+
+	return quotes, errors.Join(errs...)
+}
+
+// Registry holds the set of price sources the workers iterate over
+type Registry struct {
+	mu       sync.RWMutex
+	sources  []PriceSource
+	fallback PriceSource
+}
+
+func NewRegistry(sources ...PriceSource) *Registry {
+	r := &Registry{}
+	for _, source := range sources {
+		r.Register(source)
+	}
+	return r
+}
+
+// Register adds a source, replacing any existing source with the same name
+func (r *Registry) Register(source PriceSource) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, existing := range r.sources {
+		if existing.Name() == source.Name() {
+			r.sources[i] = source
+			return
+		}
+	}
+	r.sources = append(r.sources, source)
+}
+
+// Promote moves the named source to the front, making it the primary source
+// the fallback fills in for. It reports whether the source is registered
+func (r *Registry) Promote(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, source := range r.sources {
+		if source.Name() == name {
+			copy(r.sources[1:i+1], r.sources[:i])
+			r.sources[0] = source
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the source registered under name
+func (r *Registry) Get(name string) (PriceSource, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, source := range r.sources {
+		if source.Name() == name {
+			return source, true
+		}
+	}
+	return nil, false
+}
+
+// SetFallback sets the source used for coins the primary source failed to price.
+// The fallback is not polled on its own
+func (r *Registry) SetFallback(source PriceSource) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = source
+}
+
+// Fallback returns the fallback source, or nil if none is set
+func (r *Registry) Fallback() PriceSource {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.fallback
+}
+
+// Primary returns the first registered source, or nil if the registry is empty
+func (r *Registry) Primary() PriceSource {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.sources) == 0 {
+		return nil
+	}
+	return r.sources[0]
+}
+
+// Sources returns a snapshot of all registered sources in registration order
+func (r *Registry) Sources() []PriceSource {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sources := make([]PriceSource, len(r.sources))
+	copy(sources, r.sources)
+	return sources
+}
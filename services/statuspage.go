@@ -0,0 +1,65 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StatuspageClient reads incidents from public status pages hosted on
+// statuspage.io, which most exchanges use
+type StatuspageClient struct {
+	client *http.Client
+}
+
+// StatuspageIncident is one incident from a page's /api/v2/incidents.json.
+// StartedAt is missing on incidents created before statuspage tracked it
+type StatuspageIncident struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	Impact     string     `json:"impact"`
+	Shortlink  string     `json:"shortlink"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+}
+
+type StatuspageIncidentsResponse struct {
+	Incidents []StatuspageIncident `json:"incidents"`
+}
+
+func NewStatuspageClient() *StatuspageClient {
+	return &StatuspageClient{
+		client: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+	}
+}
+
+// Incidents returns the most recent incidents, resolved or not, of the status
+// page at pageURL, e.g. https://status.coinbase.com
+func (c *StatuspageClient) Incidents(pageURL string) ([]StatuspageIncident, error) {
+	url := strings.TrimSuffix(pageURL, "/") + "/api/v2/incidents.json"
+
+	resp, err := c.client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("status page returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result StatuspageIncidentsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result.Incidents, nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TELEGRAM_POLL_TIMEOUT is how long a getUpdates request waits for messages
+// before returning none
+const TELEGRAM_POLL_TIMEOUT = 30 * time.Second
+
+// TelegramUpdate is something that happened to a bot, only messages are read
+type TelegramUpdate struct {
+	UpdateID int64            `json:"update_id"`
+	Message  *TelegramMessage `json:"message"`
+}
+
+// TelegramMessage is a message sent to a bot and the chat it came from
+type TelegramMessage struct {
+	Text string `json:"text"`
+	Chat struct {
+		ID int64 `json:"id"`
+		// Type is private, group, supergroup or channel
+		Type string `json:"type"`
+	} `json:"chat"`
+}
+
+// TelegramBot long polls the Bot API for the messages sent to a bot. Only one
+// poller per bot gets updates, Telegram refuses the others
+type TelegramBot struct {
+	client *http.Client
+	token  string
+}
+
+func NewTelegramBot(token string) *TelegramBot {
+	return &TelegramBot{
+		client: &http.Client{Timeout: TELEGRAM_POLL_TIMEOUT + 10*time.Second},
+		token:  token,
+	}
+}
+
+// Updates waits up to TELEGRAM_POLL_TIMEOUT for the updates after offset, the
+// ID of the last update handled plus one. Updates before offset are dropped
+// by Telegram
+func (b *TelegramBot) Updates(ctx context.Context, offset int64) ([]TelegramUpdate, error) {
+	query := url.Values{}
+	query.Set("offset", strconv.FormatInt(offset, 10))
+	query.Set("timeout", strconv.Itoa(int(TELEGRAM_POLL_TIMEOUT/time.Second)))
+	query.Set("allowed_updates", `["message"]`)
+
+	endpoint := fmt.Sprintf("%s/bot%s/getUpdates?%s", TELEGRAM_API_URL, b.token, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, b.redact(err)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, b.redact(err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		OK          bool             `json:"ok"`
+		Description string           `json:"description"`
+		Result      []TelegramUpdate `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode telegram updates: %w", err)
+	}
+	if !body.OK {
+		return nil, fmt.Errorf("telegram returned status %d: %s", resp.StatusCode, body.Description)
+	}
+	return body.Result, nil
+}
+
+// redact keeps the token, part of the URL, out of logs
+func (b *TelegramBot) redact(err error) error {
+	return errors.New(strings.ReplaceAll(err.Error(), b.token, "<token>"))
+}
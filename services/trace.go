@@ -0,0 +1,107 @@
+package services
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/notblessy/dexlite/metrics"
+)
+
+// TraceTransports records connection reuse and DNS, connect, TLS and first
+// byte timings for every source in the registry that exposes its HTTP client
+func TraceTransports(registry *Registry) {
+	sources := registry.Sources()
+	if fallback := registry.Fallback(); fallback != nil {
+		sources = append(sources, fallback)
+	}
+
+	for _, source := range sources {
+		httpSource, ok := source.(HTTPSource)
+		if !ok {
+			continue
+		}
+
+		client := httpSource.HTTPClient()
+		base := client.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		client.Transport = &traceTransport{
+			source: source.Name(),
+			base:   base,
+		}
+	}
+}
+
+// traceTransport attaches an httptrace.ClientTrace to every request
+type traceTransport struct {
+	source string
+	base   http.RoundTripper
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Dial callbacks can run concurrently when several addresses are tried
+	var mu sync.Mutex
+	var dnsStart, connectStart, tlsStart, wroteAt time.Time
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			metrics.ExchangeConnectionsTotal.WithLabelValues(t.source, strconv.FormatBool(info.Reused)).Inc()
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mu.Lock()
+			dnsStart = time.Now()
+			mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			if !dnsStart.IsZero() {
+				metrics.ExchangeDNSDuration.WithLabelValues(t.source).Observe(time.Since(dnsStart).Seconds())
+			}
+		},
+		ConnectStart: func(string, string) {
+			mu.Lock()
+			connectStart = time.Now()
+			mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil && !connectStart.IsZero() {
+				metrics.ExchangeConnectDuration.WithLabelValues(t.source).Observe(time.Since(connectStart).Seconds())
+			}
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			tlsStart = time.Now()
+			mu.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil && !tlsStart.IsZero() {
+				metrics.ExchangeTLSDuration.WithLabelValues(t.source).Observe(time.Since(tlsStart).Seconds())
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			mu.Lock()
+			wroteAt = time.Now()
+			mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			mu.Lock()
+			defer mu.Unlock()
+			if !wroteAt.IsZero() {
+				metrics.ExchangeFirstByteDuration.WithLabelValues(t.source).Observe(time.Since(wroteAt).Seconds())
+			}
+		},
+	}
+
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WebhookClient posts JSON payloads to user-configured endpoints
+type WebhookClient struct {
+	client *http.Client
+}
+
+func NewWebhookClient() *WebhookClient {
+	return &WebhookClient{
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Send posts payload as JSON to url and fails on any non-2xx response
+func (c *WebhookClient) Send(url string, payload interface{}) error {
+	bodyBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, string(respBytes))
+	}
+
+	return nil
+}
+
+const TELEGRAM_API_URL = "https://api.telegram.org"
+
+// SendSlack posts text to a Slack incoming webhook
+func (c *WebhookClient) SendSlack(hookURL, text string) error {
+	return c.Send(hookURL, map[string]string{
+		"text": text,
+	})
+}
+
+// SendTelegram sends text to a Telegram chat through the Bot API
+func (c *WebhookClient) SendTelegram(token, chatID, text string) error {
+	err := c.Send(fmt.Sprintf("%s/bot%s/sendMessage", TELEGRAM_API_URL, token), map[string]string{
+		"chat_id": chatID,
+		"text":    text,
+	})
+	if err != nil {
+		// The token is part of the URL, keep it out of logs and API responses
+		return errors.New(strings.ReplaceAll(err.Error(), token, "<token>"))
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// shutdownStage is one step of the ordered shutdown. stop returns once the
+// stage is done or ctx, bounded by timeout, ends
+type shutdownStage struct {
+	name    string
+	timeout time.Duration
+	stop    func(ctx context.Context) error
+}
+
+// shutdown runs stages in order. A stage that fails or runs out of time is
+// logged and the next one starts anyway, so the process always exits
+func shutdown(stages []shutdownStage) {
+	for _, stage := range stages {
+		startedAt := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), stage.timeout)
+		err := stage.stop(ctx)
+		cancel()
+
+		if err != nil {
+			log.Warn().Err(err).Str("stage", stage.name).Dur("timeout", stage.timeout).Dur("duration", time.Since(startedAt)).Msg("Shutdown stage incomplete")
+			continue
+		}
+		log.Info().Str("stage", stage.name).Dur("duration", time.Since(startedAt)).Msg("Shutdown stage complete")
+	}
+}
+
+// componentGroup runs components that are stopped together by cancelling
+// the context they were started with
+type componentGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[string]int
+}
+
+func newComponentGroup(parent context.Context) *componentGroup {
+	ctx, cancel := context.WithCancel(parent)
+	return &componentGroup{
+		ctx:     ctx,
+		cancel:  cancel,
+		running: make(map[string]int),
+	}
+}
+
+// Go runs start in its own goroutine, named in the shutdown log if it
+// doesn't return in time
+func (g *componentGroup) Go(name string, start func(ctx context.Context)) {
+	g.mu.Lock()
+	g.running[name]++
+	g.mu.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer func() {
+			g.mu.Lock()
+			if g.running[name]--; g.running[name] == 0 {
+				delete(g.running, name)
+			}
+			g.mu.Unlock()
+		}()
+		start(g.ctx)
+	}()
+}
+
+// stop cancels the group's context and waits for its components to return,
+// reporting those still running when ctx ends
+func (g *componentGroup) stop(ctx context.Context) error {
+	g.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		names := make([]string, 0, len(g.running))
+		for name := range g.running {
+			names = append(names, name)
+		}
+		g.mu.Unlock()
+		sort.Strings(names)
+		return fmt.Errorf("still running: %s", strings.Join(names, ", "))
+	}
+}
+
+// waitFor polls until done reports true or ctx ends
+func waitFor(ctx context.Context, done func() bool) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for !done() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+)
+
+// DEFAULT_BACKFILL_BATCH is how many prices are read and written at a time
+const DEFAULT_BACKFILL_BATCH = 5000
+
+// BackfillOptions selects what history is copied
+type BackfillOptions struct {
+	// Since skips prices stored before it, zero copies the whole table
+	Since time.Time
+	// AfterID resumes an interrupted backfill after the last ID it reported
+	AfterID uint
+	// BatchSize is how many prices are copied at a time
+	BatchSize int
+	// Progress is called after every batch with the last ID copied
+	Progress func(lastID uint, copied int64)
+}
+
+// BackfillResult is what a backfill copied. UpToID is the newest price when
+// it started, later ones are left to the dual-write
+type BackfillResult struct {
+	Copied int64         `json:"copied"`
+	LastID uint          `json:"last_id"`
+	UpToID uint          `json:"up_to_id"`
+	Took   time.Duration `json:"took"`
+}
+
+// Backfill copies the prices in source to target in ID order. Enable the
+// dual-write first: prices stored after the backfill starts aren't read, and
+// those stored in between are written twice, which targets tolerate
+func Backfill(ctx context.Context, source *gorm.DB, target Target, opts BackfillOptions) (BackfillResult, error) {
+	startedAt := time.Now()
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DEFAULT_BACKFILL_BATCH
+	}
+
+	result := BackfillResult{LastID: opts.AfterID}
+	if err := source.WithContext(ctx).Model(&models.CoinPrice{}).Select("COALESCE(MAX(id), 0)").Scan(&result.UpToID).Error; err != nil {
+		return result, err
+	}
+
+	for result.LastID < result.UpToID {
+		query := source.WithContext(ctx).
+			Where("id > ? AND id <= ?", result.LastID, result.UpToID).
+			Order("id ASC").
+			Limit(opts.BatchSize)
+		if !opts.Since.IsZero() {
+			query = query.Where("created_at >= ?", opts.Since)
+		}
+
+		var batch []models.CoinPrice
+		if err := query.Find(&batch).Error; err != nil {
+			return result, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		if err := target.Write(ctx, batch); err != nil {
+			return result, err
+		}
+
+		result.Copied += int64(len(batch))
+		result.LastID = batch[len(batch)-1].ID
+		if opts.Progress != nil {
+			opts.Progress(result.LastID, result.Copied)
+		}
+	}
+
+	result.LastID = max(result.LastID, result.UpToID)
+	result.Took = time.Since(startedAt)
+	return result, nil
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/notblessy/dexlite/clickhouse"
+	"github.com/notblessy/dexlite/models"
+)
+
+// DEFAULT_CLICKHOUSE_TABLE is where prices are migrated to in ClickHouse,
+// apart from the streamed ticks table
+const DEFAULT_CLICKHOUSE_TABLE = "coin_prices"
+
+// clickHouseTime is the basic DateTime64 format, read as UTC
+const clickHouseTime = "2006-01-02 15:04:05.000"
+
+// priceRow is one row of the prices table
+type priceRow struct {
+	Coin       string   `json:"coin"`
+	Exchange   string   `json:"exchange"`
+	Region     string   `json:"region"`
+	Bucket     string   `json:"bucket"`
+	Price      float64  `json:"price"`
+	Confidence *float64 `json:"confidence"`
+	Labels     string   `json:"labels"`
+	SourceTime *string  `json:"source_time"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+// ClickHouseTarget stores prices in a ReplacingMergeTree keyed like the
+// unique index of the database, so a price copied twice collapses into one
+// on merge. Reads use FINAL to see it collapsed already
+type ClickHouseTarget struct {
+	client *clickhouse.Client
+	table  string
+}
+
+func NewClickHouseTarget(client *clickhouse.Client, table string) *ClickHouseTarget {
+	return &ClickHouseTarget{
+		client: client,
+		table:  table,
+	}
+}
+
+// Migrate creates the prices table if it doesn't exist
+func (t *ClickHouseTarget) Migrate(ctx context.Context) error {
+	return t.client.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	coin LowCardinality(String),
+	exchange LowCardinality(String),
+	region LowCardinality(String),
+	bucket DateTime64(3, 'UTC'),
+	price Float64,
+	confidence Nullable(Float64),
+	labels String,
+	source_time Nullable(DateTime64(3, 'UTC')),
+	created_at DateTime64(3, 'UTC')
+) ENGINE = ReplacingMergeTree(created_at)
+PARTITION BY toYYYYMM(bucket)
+ORDER BY (coin, exchange, region, bucket)`, t.table))
+}
+
+func (t *ClickHouseTarget) Write(ctx context.Context, prices []models.CoinPrice) error {
+	rows := make([]any, len(prices))
+	for i, price := range prices {
+		row := priceRow{
+			Coin:       price.Coin,
+			Exchange:   price.Exchange,
+			Region:     price.Region,
+			Bucket:     price.Bucket.UTC().Format(clickHouseTime),
+			Price:      price.Price,
+			Confidence: price.Confidence,
+			CreatedAt:  price.CreatedAt.UTC().Format(clickHouseTime),
+		}
+		if len(price.Labels) > 0 {
+			labels, err := json.Marshal(price.Labels)
+			if err != nil {
+				return err
+			}
+			row.Labels = string(labels)
+		}
+		if price.SourceTime != nil {
+			sourceTime := price.SourceTime.UTC().Format(clickHouseTime)
+			row.SourceTime = &sourceTime
+		}
+		rows[i] = row
+	}
+	return t.client.Insert(ctx, t.table, rows)
+}
+
+func (t *ClickHouseTarget) Summarize(ctx context.Context, from, to time.Time) (map[Series]Summary, error) {
+	query := fmt.Sprintf(`SELECT coin, exchange, region, count() AS row_count, sum(price) AS price_sum
+FROM %s FINAL
+WHERE created_at >= toDateTime64('%s', 3, 'UTC') AND created_at < toDateTime64('%s', 3, 'UTC')
+GROUP BY coin, exchange, region`, t.table, from.UTC().Format(clickHouseTime), to.UTC().Format(clickHouseTime))
+
+	summaries := make(map[Series]Summary)
+	err := t.client.Select(ctx, query, func(data []byte) error {
+		var row struct {
+			Series
+			RowCount int64   `json:"row_count"`
+			PriceSum float64 `json:"price_sum"`
+		}
+		if err := json.Unmarshal(data, &row); err != nil {
+			return err
+		}
+		summaries[row.Series] = Summary{Rows: row.RowCount, PriceSum: row.PriceSum}
+		return nil
+	})
+	return summaries, err
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/notblessy/dexlite/metrics"
+	"github.com/notblessy/dexlite/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DEFAULT_MIRROR_INTERVAL = 5 * time.Second
+	// MAX_MIRROR_PENDING caps the prices held while the target is unreachable,
+	// the oldest are dropped beyond it and left for a backfill to copy
+	MAX_MIRROR_PENDING = 200000
+	// mirrorBatchSize is how many prices go into one write to the target
+	mirrorBatchSize = 5000
+	// shutdownFlushTimeout bounds the last flush once the mirror is stopped
+	shutdownFlushTimeout = 10 * time.Second
+)
+
+// Mirror dual-writes the prices the persister stores to a target. Prices are
+// queued and written every interval so a slow or unreachable target never
+// holds up collection
+type Mirror struct {
+	target   Target
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending []models.CoinPrice
+}
+
+// NewMirror creates a mirror writing to target every interval
+func NewMirror(target Target, interval time.Duration) *Mirror {
+	return &Mirror{
+		target:   target,
+		interval: interval,
+	}
+}
+
+// Write queues prices for the next flush
+func (m *Mirror) Write(prices []models.CoinPrice) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pending = append(m.pending, prices...)
+	m.trim()
+}
+
+// Start flushes queued prices every interval until ctx is cancelled, then
+// flushes once more
+func (m *Mirror) Start(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+			m.flush(flushCtx)
+			cancel()
+			log.Info().Msg("Storage mirror shutting down")
+			return
+		case <-ticker.C:
+			m.flush(ctx)
+		}
+	}
+}
+
+// flush writes the queued prices in batches. A batch that fails is queued
+// again, with everything after it, for the next flush
+func (m *Mirror) flush(ctx context.Context) {
+	m.mu.Lock()
+	queued := m.pending
+	m.pending = nil
+	m.mu.Unlock()
+
+	for len(queued) > 0 {
+		batch := queued[:min(len(queued), mirrorBatchSize)]
+		if err := m.target.Write(ctx, batch); err != nil {
+			log.Error().Err(err).Int("rows", len(queued)).Msg("Error dual-writing prices to the storage target")
+			m.mu.Lock()
+			m.pending = append(queued, m.pending...)
+			m.trim()
+			m.mu.Unlock()
+			return
+		}
+		metrics.MirroredPricesTotal.WithLabelValues(metrics.TICKS_STORED).Add(float64(len(batch)))
+		queued = queued[len(batch):]
+	}
+}
+
+// trim drops the oldest queued prices beyond MAX_MIRROR_PENDING. Callers hold mu
+func (m *Mirror) trim() {
+	if over := len(m.pending) - MAX_MIRROR_PENDING; over > 0 {
+		m.pending = m.pending[over:]
+		metrics.MirroredPricesTotal.WithLabelValues(metrics.TICKS_DROPPED).Add(float64(over))
+	}
+}
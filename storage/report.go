@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// WriteText prints a summary followed by at most limit mismatches, all when
+// limit is 0 or less
+func (r *Report) WriteText(w io.Writer, limit int) error {
+	fmt.Fprintf(w, "Compared %d series from %s to %s in %s\n", r.Series,
+		r.From.UTC().Format(time.RFC3339), r.To.UTC().Format(time.RFC3339), r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(w, "  source rows: %d\n", r.SourceRows)
+	fmt.Fprintf(w, "  target rows: %d\n", r.TargetRows)
+	fmt.Fprintf(w, "  mismatches:  %d\n", len(r.Mismatches))
+
+	if len(r.Mismatches) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(w)
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "FROM\tCOIN\tEXCHANGE\tREGION\tSOURCE\tTARGET")
+	for i, m := range r.Mismatches {
+		if limit > 0 && i == limit {
+			fmt.Fprintf(table, "... %d more\n", len(r.Mismatches)-limit)
+			break
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%d rows, sum %g\t%d rows, sum %g\n",
+			m.From.UTC().Format(time.RFC3339), m.Coin, m.Exchange, m.Region, m.SourceRows, m.SourceSum, m.TargetRows, m.TargetSum)
+	}
+	return table.Flush()
+}
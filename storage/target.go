@@ -0,0 +1,105 @@
+// Package storage moves stored prices to a new backend without downtime:
+// prices are dual-written to the target while history is backfilled, and the
+// two sides are compared until it can take over
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/notblessy/dexlite/clickhouse"
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+)
+
+// TARGET_CLICKHOUSE selects a ClickHouse target, any other target is a
+// database driver. Timescale is a postgres target
+const TARGET_CLICKHOUSE = "clickhouse"
+
+// Target is a backend prices are migrated to. Writes replace any price a
+// venue already has in the same bucket, so copying a price twice is harmless
+type Target interface {
+	Write(ctx context.Context, prices []models.CoinPrice) error
+	// Summarize counts and sums the prices of each series stored in [from, to)
+	Summarize(ctx context.Context, from, to time.Time) (map[Series]Summary, error)
+}
+
+// Series identifies the prices of one coin from one venue and region
+type Series struct {
+	Coin     string `json:"coin"`
+	Exchange string `json:"exchange"`
+	Region   string `json:"region,omitempty"`
+}
+
+// Summary is what is compared between the two sides of a series
+type Summary struct {
+	Rows     int64
+	PriceSum float64
+}
+
+// Open connects to the target of kind and creates its tables
+func Open(ctx context.Context, kind, dsn, table string) (Target, error) {
+	if kind == TARGET_CLICKHOUSE {
+		client, err := clickhouse.NewClient(dsn)
+		if err != nil {
+			return nil, err
+		}
+		target := NewClickHouseTarget(client, table)
+		return target, target.Migrate(ctx)
+	}
+
+	database, err := gorm.Open(db.Open(kind, dsn), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Migrate(database); err != nil {
+		return nil, err
+	}
+	return NewDatabaseTarget(database), nil
+}
+
+// DatabaseTarget stores prices in a dexlite schema on any supported driver.
+// It also summarizes the source database for verification
+type DatabaseTarget struct {
+	db *gorm.DB
+}
+
+func NewDatabaseTarget(database *gorm.DB) *DatabaseTarget {
+	return &DatabaseTarget{db: database}
+}
+
+// Write stores copies of prices. IDs are left to the target, which hands out
+// its own
+func (t *DatabaseTarget) Write(ctx context.Context, prices []models.CoinPrice) error {
+	copies := make([]models.CoinPrice, len(prices))
+	for i, price := range prices {
+		price.ID = 0
+		copies[i] = price
+	}
+	return t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return db.UpsertPrices(tx, copies)
+	})
+}
+
+func (t *DatabaseTarget) Summarize(ctx context.Context, from, to time.Time) (map[Series]Summary, error) {
+	var rows []struct {
+		Series
+		RowCount int64
+		PriceSum float64
+	}
+	err := t.db.WithContext(ctx).Model(&models.CoinPrice{}).
+		Select("coin, exchange, region, COUNT(*) AS row_count, SUM(price) AS price_sum").
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Group("coin, exchange, region").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make(map[Series]Summary, len(rows))
+	for _, row := range rows {
+		summaries[row.Series] = Summary{Rows: row.RowCount, PriceSum: row.PriceSum}
+	}
+	return summaries, nil
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// VERIFY_WINDOW is the span compared at a time, so a mismatch points at a day
+const VERIFY_WINDOW = 24 * time.Hour
+
+// priceSumTolerance is the relative difference allowed between price sums,
+// databases store prices as decimals and ClickHouse as floats
+const priceSumTolerance = 1e-9
+
+// Mismatch is a series whose prices differ between source and target over
+// one window
+type Mismatch struct {
+	Series
+	From       time.Time `json:"from"`
+	SourceRows int64     `json:"source_rows"`
+	TargetRows int64     `json:"target_rows"`
+	SourceSum  float64   `json:"source_sum"`
+	TargetSum  float64   `json:"target_sum"`
+}
+
+// Report is the outcome of comparing source and target
+type Report struct {
+	From       time.Time     `json:"from"`
+	To         time.Time     `json:"to"`
+	Series     int           `json:"series"`
+	SourceRows int64         `json:"source_rows"`
+	TargetRows int64         `json:"target_rows"`
+	Mismatches []Mismatch    `json:"mismatches"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// Verify compares the prices stored in [from, to) on both sides, a window at
+// a time. Series are matched on row count and price sum
+func Verify(ctx context.Context, source, target Target, from, to time.Time) (*Report, error) {
+	startedAt := time.Now()
+	report := &Report{From: from, To: to, Mismatches: []Mismatch{}}
+	seen := make(map[Series]bool)
+
+	for windowStart := from; windowStart.Before(to); windowStart = windowStart.Add(VERIFY_WINDOW) {
+		windowEnd := windowStart.Add(VERIFY_WINDOW)
+		if windowEnd.After(to) {
+			windowEnd = to
+		}
+
+		sourceSummaries, err := source.Summarize(ctx, windowStart, windowEnd)
+		if err != nil {
+			return nil, fmt.Errorf("summarizing source: %w", err)
+		}
+		targetSummaries, err := target.Summarize(ctx, windowStart, windowEnd)
+		if err != nil {
+			return nil, fmt.Errorf("summarizing target: %w", err)
+		}
+
+		series := make(map[Series]bool)
+		for s, summary := range sourceSummaries {
+			series[s] = true
+			report.SourceRows += summary.Rows
+		}
+		for s, summary := range targetSummaries {
+			series[s] = true
+			report.TargetRows += summary.Rows
+		}
+
+		for s := range series {
+			seen[s] = true
+			sourceSummary, targetSummary := sourceSummaries[s], targetSummaries[s]
+			if sourceSummary.Rows == targetSummary.Rows && sumsMatch(sourceSummary.PriceSum, targetSummary.PriceSum) {
+				continue
+			}
+			report.Mismatches = append(report.Mismatches, Mismatch{
+				Series:     s,
+				From:       windowStart,
+				SourceRows: sourceSummary.Rows,
+				TargetRows: targetSummary.Rows,
+				SourceSum:  sourceSummary.PriceSum,
+				TargetSum:  targetSummary.PriceSum,
+			})
+		}
+	}
+
+	sort.Slice(report.Mismatches, func(i, j int) bool {
+		a, b := report.Mismatches[i], report.Mismatches[j]
+		if !a.From.Equal(b.From) {
+			return a.From.Before(b.From)
+		}
+		if a.Coin != b.Coin {
+			return a.Coin < b.Coin
+		}
+		if a.Exchange != b.Exchange {
+			return a.Exchange < b.Exchange
+		}
+		return a.Region < b.Region
+	})
+	report.Series = len(seen)
+	report.Duration = time.Since(startedAt)
+	return report, nil
+}
+
+func sumsMatch(a, b float64) bool {
+	return math.Abs(a-b) <= priceSumTolerance*math.Max(math.Abs(a), math.Abs(b))
+}
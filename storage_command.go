@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/notblessy/dexlite/config"
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/storage"
+	"github.com/spf13/cobra"
+)
+
+// storageBackfillFlags are the flags of `dexlite storage backfill`
+type storageBackfillFlags struct {
+	since   time.Duration
+	afterID uint
+	batch   int
+}
+
+// storageVerifyFlags are the flags of `dexlite storage verify`
+type storageVerifyFlags struct {
+	since  time.Duration
+	settle time.Duration
+	asJSON bool
+	limit  int
+}
+
+// newStorageCommand builds `dexlite storage backfill` and `dexlite storage
+// verify`, which work against storage_migration.target. Both exit 0 on
+// success and 2 on usage or storage errors, verify exits 1 when the two
+// sides differ
+func newStorageCommand(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:         "storage",
+		Short:       "backfill and verify a storage migration target",
+		Args:        cobra.NoArgs,
+		Annotations: persistent,
+		RunE:        groupOnly,
+	}
+
+	var backfillFlags storageBackfillFlags
+	backfill := &cobra.Command{
+		Use:   "backfill",
+		Short: "copy stored prices to the target",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exit(runStorageBackfill(cfg, backfillFlags))
+		},
+	}
+	backfill.Flags().DurationVar(&backfillFlags.since, "since", 0, "only copy prices stored in this window, e.g. 720h, all when 0")
+	backfill.Flags().UintVar(&backfillFlags.afterID, "after-id", 0, "resume after the last ID an interrupted backfill reported")
+	backfill.Flags().IntVar(&backfillFlags.batch, "batch", storage.DEFAULT_BACKFILL_BATCH, "prices copied at a time")
+
+	var verifyFlags storageVerifyFlags
+	verify := &cobra.Command{
+		Use:   "verify",
+		Short: "compare the prices stored on both sides",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exit(runStorageVerify(cfg, verifyFlags))
+		},
+	}
+	verify.Flags().DurationVar(&verifyFlags.since, "since", 24*time.Hour, "compare prices stored in this window")
+	verify.Flags().DurationVar(&verifyFlags.settle, "settle", time.Minute, "skip the newest prices, which may still be queued for the target")
+	verify.Flags().BoolVar(&verifyFlags.asJSON, "json", false, "print the report as JSON")
+	verify.Flags().IntVar(&verifyFlags.limit, "limit", 50, "mismatches listed in the text report, all when 0")
+
+	cmd.AddCommand(backfill, verify)
+	return cmd
+}
+
+// checkStorageTarget reports whether a storage migration target is set
+func checkStorageTarget(cfg *config.Config) bool {
+	if cfg.StorageMigration.Target == "" {
+		fmt.Fprintln(os.Stderr, "storage: storage_migration.target (STORAGE_TARGET) is not set")
+		return false
+	}
+	return true
+}
+
+func runStorageBackfill(cfg *config.Config, flags storageBackfillFlags) int {
+	if !checkStorageTarget(cfg) {
+		return 2
+	}
+	if flags.batch <= 0 {
+		fmt.Fprintln(os.Stderr, "storage: --batch must be positive")
+		return 2
+	}
+
+	ctx := context.Background()
+	target, err := storage.Open(ctx, cfg.StorageMigration.Target, cfg.StorageMigration.TargetDSN, cfg.StorageMigration.TargetTable)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "storage: opening target: %v\n", err)
+		return 2
+	}
+	if !cfg.StorageMigration.DualWrite {
+		fmt.Fprintln(os.Stderr, "storage: dual_write is off, prices stored from now on won't reach the target")
+	}
+
+	opts := storage.BackfillOptions{
+		AfterID:   flags.afterID,
+		BatchSize: flags.batch,
+		Progress: func(lastID uint, copied int64) {
+			fmt.Fprintf(os.Stderr, "copied %d prices, last id %d\n", copied, lastID)
+		},
+	}
+	if flags.since > 0 {
+		opts.Since = time.Now().Add(-flags.since)
+	}
+
+	source := db.New(cfg.Database.Driver, cfg.Database.DSN)
+	result, err := storage.Backfill(ctx, source, target, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "storage: backfill stopped after id %d, resume with --after-id %d: %v\n", result.LastID, result.LastID, err)
+		return 2
+	}
+
+	fmt.Printf("Copied %d prices up to id %d in %s\n", result.Copied, result.UpToID, result.Took.Round(time.Millisecond))
+	return 0
+}
+
+func runStorageVerify(cfg *config.Config, flags storageVerifyFlags) int {
+	if !checkStorageTarget(cfg) {
+		return 2
+	}
+	if flags.since <= 0 || flags.settle < 0 {
+		fmt.Fprintln(os.Stderr, "storage: --since must be positive and --settle not negative")
+		return 2
+	}
+
+	ctx := context.Background()
+	target, err := storage.Open(ctx, cfg.StorageMigration.Target, cfg.StorageMigration.TargetDSN, cfg.StorageMigration.TargetTable)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "storage: opening target: %v\n", err)
+		return 2
+	}
+	source := storage.NewDatabaseTarget(db.New(cfg.Database.Driver, cfg.Database.DSN))
+
+	to := time.Now().Add(-flags.settle)
+	report, err := storage.Verify(ctx, source, target, to.Add(-flags.since), to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "storage: %v\n", err)
+		return 2
+	}
+
+	if flags.asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = report.WriteText(os.Stdout, flags.limit)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "storage: %v\n", err)
+		return 2
+	}
+
+	if len(report.Mismatches) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,269 @@
+// Package stream fans stored prices and spread opportunities out to live
+// subscribers, such as clients connected to the WebSocket API
+package stream
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/notblessy/dexlite/metrics"
+	"github.com/notblessy/dexlite/models"
+)
+
+// REPLAY_SIZE is how many of the last published prices the hub keeps for
+// subscribers resuming after a disconnect
+const REPLAY_SIZE = 4096
+
+// Tick is a published price with its sequence number. Sequence numbers
+// increase by one per price and start from the hub's creation time in
+// microseconds, so they keep increasing across restarts
+type Tick struct {
+	Seq uint64
+	models.CoinPrice
+}
+
+// Hub delivers every published price to the subscribers watching its coin. It
+// is safe for concurrent use
+type Hub struct {
+	mu   sync.RWMutex
+	subs map[*Subscriber]struct{}
+
+	// seq is the sequence number of the last published price
+	seq uint64
+	// replay holds the last REPLAY_SIZE prices, oldest at replayStart once
+	// full
+	replay      []Tick
+	replayStart int
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subs:   make(map[*Subscriber]struct{}),
+		seq:    uint64(time.Now().UnixMicro()),
+		replay: make([]Tick, 0, REPLAY_SIZE),
+	}
+}
+
+// Subscribe registers a subscriber that can hold buffer undelivered prices
+// before it is dropped as too slow. It starts watching no coins
+func (h *Hub) Subscribe(buffer int) *Subscriber {
+	sub := &Subscriber{
+		c:         make(chan Tick, buffer),
+		coins:     make(map[string]struct{}),
+		delivered: make(map[series]float64),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe removes sub and closes its channel. It is a no-op for a
+// subscriber that was already dropped
+func (h *Hub) Unsubscribe(sub *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.drop(sub)
+}
+
+// Resume watches coins for sub and returns the prices of coins it watches
+// published after seq, within sub's band, so a reconnecting client misses
+// none. Prices published after Resume are delivered on sub's channel as
+// usual. complete is false when prices after seq are no longer kept, in which
+// case the ones still kept are returned
+func (h *Hub) Resume(sub *Subscriber, seq uint64, coins ...string) (missed []Tick, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub.Watch(coins...)
+	if seq > h.seq {
+		// Not a sequence number of this hub
+		return nil, false
+	}
+
+	// Every price after seq is kept if the oldest kept one follows it
+	complete = seq == h.seq || (len(h.replay) > 0 && h.replay[h.replayStart].Seq <= seq+1)
+	for i := range h.replay {
+		tick := h.replay[(h.replayStart+i)%len(h.replay)]
+		if tick.Seq <= seq || !sub.Watching(tick.Coin) || !sub.moved(tick.CoinPrice) {
+			continue
+		}
+		missed = append(missed, tick)
+	}
+	return missed, complete
+}
+
+// Len returns how many subscribers are registered
+func (h *Hub) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs)
+}
+
+// Publish delivers prices to every subscriber watching their coin, unless
+// they are within the subscriber's band. A subscriber whose buffer is full is
+// dropped rather than holding up the writer that stored the prices
+func (h *Hub) Publish(prices []models.CoinPrice) {
+	if len(prices) == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	published := make([]Tick, len(prices))
+	for i, price := range prices {
+		h.seq++
+		published[i] = Tick{Seq: h.seq, CoinPrice: price}
+		h.remember(published[i])
+	}
+
+	for sub := range h.subs {
+	deliver:
+		for _, tick := range published {
+			if !sub.Watching(tick.Coin) {
+				continue
+			}
+			if !sub.moved(tick.CoinPrice) {
+				metrics.StreamBandHeldTotal.Inc()
+				continue
+			}
+			select {
+			case sub.c <- tick:
+			default:
+				h.drop(sub)
+				break deliver
+			}
+		}
+	}
+}
+
+// remember keeps tick for Resume, replacing the oldest once the buffer is
+// full. The caller holds mu
+func (h *Hub) remember(tick Tick) {
+	if len(h.replay) < cap(h.replay) {
+		h.replay = append(h.replay, tick)
+		return
+	}
+	h.replay[h.replayStart] = tick
+	h.replayStart = (h.replayStart + 1) % len(h.replay)
+}
+
+// drop removes sub, the caller holds mu
+func (h *Hub) drop(sub *Subscriber) {
+	if _, ok := h.subs[sub]; !ok {
+		return
+	}
+	delete(h.subs, sub)
+	close(sub.c)
+}
+
+// series identifies one venue's prices of a coin as stored by one region
+type series struct {
+	coin     string
+	exchange string
+	region   string
+}
+
+// Subscriber receives the prices of the coins it watches
+type Subscriber struct {
+	c chan Tick
+
+	mu    sync.RWMutex
+	coins map[string]struct{}
+	// bandPct holds back prices within this many percent of the last one
+	// delivered of their series, 0 delivers every price
+	bandPct   float64
+	delivered map[series]float64
+}
+
+// C returns the channel prices are delivered on. It is closed when the
+// subscriber is unsubscribed or dropped for falling behind
+func (s *Subscriber) C() <-chan Tick {
+	return s.c
+}
+
+// Watch adds coins to the subscription. Their next prices are delivered
+// whatever the band
+func (s *Subscriber) Watch(coins ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, coin := range coins {
+		s.coins[coin] = struct{}{}
+		s.forget(coin)
+	}
+}
+
+// Unwatch removes coins from the subscription
+func (s *Subscriber) Unwatch(coins ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, coin := range coins {
+		delete(s.coins, coin)
+		s.forget(coin)
+	}
+}
+
+// forget drops the last delivered prices of coin, the caller holds mu
+func (s *Subscriber) forget(coin string) {
+	for key := range s.delivered {
+		if key.coin == coin {
+			delete(s.delivered, key)
+		}
+	}
+}
+
+// SetBand only delivers a price once it moved more than pct percent from the
+// last one delivered of its coin on its exchange and region. The first price
+// of each is always delivered, 0 delivers every price
+func (s *Subscriber) SetBand(pct float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bandPct = pct
+}
+
+// Band returns the band set with SetBand
+func (s *Subscriber) Band() float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.bandPct
+}
+
+// moved reports whether price is outside the band, recording it as the last
+// delivered of its series when it is
+func (s *Subscriber) moved(price models.CoinPrice) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bandPct <= 0 {
+		return true
+	}
+
+	key := series{coin: price.Coin, exchange: price.Exchange, region: price.Region}
+	last, ok := s.delivered[key]
+	if ok && last != 0 && math.Abs(price.Price-last)/last*100 <= s.bandPct {
+		return false
+	}
+	s.delivered[key] = price.Price
+	return true
+}
+
+// Watching reports whether coin is part of the subscription
+func (s *Subscriber) Watching(coin string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.coins[coin]
+	return ok
+}
+
+// Coins returns the watched coins in no particular order
+func (s *Subscriber) Coins() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	coins := make([]string, 0, len(s.coins))
+	for coin := range s.coins {
+		coins = append(coins, coin)
+	}
+	return coins
+}
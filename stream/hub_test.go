@@ -0,0 +1,199 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/notblessy/dexlite/models"
+)
+
+// publish publishes prices on hub and returns them as delivered to a
+// subscriber watching every coin
+func publish(t *testing.T, hub *Hub, prices ...models.CoinPrice) []Tick {
+	t.Helper()
+
+	probe := hub.Subscribe(len(prices))
+	defer hub.Unsubscribe(probe)
+	for _, price := range prices {
+		probe.Watch(price.Coin)
+	}
+
+	hub.Publish(prices)
+	ticks := make([]Tick, len(prices))
+	for i := range ticks {
+		ticks[i] = <-probe.C()
+	}
+	return ticks
+}
+
+// seqs returns the sequence numbers of ticks
+func seqs(ticks []Tick) []uint64 {
+	out := make([]uint64, len(ticks))
+	for i, tick := range ticks {
+		out[i] = tick.Seq
+	}
+	return out
+}
+
+func equalSeqs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPublishSeq(t *testing.T) {
+	hub := NewHub()
+	ticks := publish(t, hub,
+		models.CoinPrice{Coin: "BTC", Exchange: "binance", Price: 100},
+		models.CoinPrice{Coin: "ETH", Exchange: "binance", Price: 10},
+	)
+	ticks = append(ticks, publish(t, hub, models.CoinPrice{Coin: "BTC", Exchange: "binance", Price: 101})...)
+
+	for i := 1; i < len(ticks); i++ {
+		if ticks[i].Seq != ticks[i-1].Seq+1 {
+			t.Fatalf("seqs = %v, want one apart", seqs(ticks))
+		}
+	}
+
+	// A later hub, as after a restart, continues above the earlier one
+	if next := publish(t, NewHub(), models.CoinPrice{Coin: "BTC", Exchange: "binance", Price: 102}); next[0].Seq <= ticks[len(ticks)-1].Seq {
+		t.Fatalf("restarted hub seq = %d, want above %d", next[0].Seq, ticks[len(ticks)-1].Seq)
+	}
+}
+
+func TestResume(t *testing.T) {
+	hub := NewHub()
+	ticks := publish(t, hub,
+		models.CoinPrice{Coin: "BTC", Exchange: "binance", Price: 100},
+		models.CoinPrice{Coin: "ETH", Exchange: "binance", Price: 10},
+		models.CoinPrice{Coin: "BTC", Exchange: "binance", Price: 101},
+		models.CoinPrice{Coin: "BTC", Exchange: "binance", Price: 150},
+	)
+	first, last := ticks[0].Seq, ticks[len(ticks)-1].Seq
+
+	tests := []struct {
+		name         string
+		seq          uint64
+		coins        []string
+		band         float64
+		want         []uint64
+		wantComplete bool
+	}{
+		{
+			name:         "from the last",
+			seq:          last,
+			coins:        []string{"BTC"},
+			wantComplete: true,
+		},
+		{
+			name:         "from the middle",
+			seq:          first,
+			coins:        []string{"BTC"},
+			want:         []uint64{ticks[2].Seq, ticks[3].Seq},
+			wantComplete: true,
+		},
+		{
+			name:         "from before the first",
+			seq:          first - 1,
+			coins:        []string{"BTC", "ETH"},
+			want:         seqs(ticks),
+			wantComplete: true,
+		},
+		{
+			name:         "other coin",
+			seq:          first,
+			coins:        []string{"ETH"},
+			want:         []uint64{ticks[1].Seq},
+			wantComplete: true,
+		},
+		{
+			name:         "no coins",
+			seq:          first,
+			wantComplete: true,
+		},
+		{
+			name:         "within the band",
+			seq:          first - 1,
+			coins:        []string{"BTC"},
+			band:         10,
+			want:         []uint64{ticks[0].Seq, ticks[3].Seq},
+			wantComplete: true,
+		},
+		{
+			name:  "past the replay",
+			seq:   first - 2,
+			coins: []string{"BTC"},
+			want:  []uint64{ticks[0].Seq, ticks[2].Seq, ticks[3].Seq},
+		},
+		{
+			name:  "not of this hub",
+			seq:   last + 1,
+			coins: []string{"BTC"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := hub.Subscribe(1)
+			defer hub.Unsubscribe(sub)
+			sub.SetBand(tt.band)
+
+			missed, complete := hub.Resume(sub, tt.seq, tt.coins...)
+			if !equalSeqs(seqs(missed), tt.want) || complete != tt.wantComplete {
+				t.Fatalf("Resume(%d) = %v, %v, want %v, %v", tt.seq, seqs(missed), complete, tt.want, tt.wantComplete)
+			}
+		})
+	}
+}
+
+func TestResumeOverflow(t *testing.T) {
+	hub := NewHub()
+	prices := make([]models.CoinPrice, REPLAY_SIZE+10)
+	for i := range prices {
+		prices[i] = models.CoinPrice{Coin: "BTC", Exchange: "binance", Price: float64(100 + i)}
+	}
+	ticks := publish(t, hub, prices...)
+
+	sub := hub.Subscribe(1)
+	defer hub.Unsubscribe(sub)
+
+	// The first ten are no longer kept
+	missed, complete := hub.Resume(sub, ticks[0].Seq, "BTC")
+	if complete || len(missed) != REPLAY_SIZE || missed[0].Seq != ticks[10].Seq {
+		t.Fatalf("Resume = %d prices from %d, complete %v, want %d from %d, incomplete",
+			len(missed), missed[0].Seq, complete, REPLAY_SIZE, ticks[10].Seq)
+	}
+
+	// From the one just before the oldest kept, nothing is missing
+	missed, complete = hub.Resume(sub, ticks[9].Seq, "BTC")
+	if !complete || len(missed) != REPLAY_SIZE {
+		t.Fatalf("Resume = %d prices, complete %v, want %d, complete", len(missed), complete, REPLAY_SIZE)
+	}
+}
+
+func TestResumeThenDeliver(t *testing.T) {
+	hub := NewHub()
+	ticks := publish(t, hub, models.CoinPrice{Coin: "BTC", Exchange: "binance", Price: 100})
+
+	sub := hub.Subscribe(1)
+	defer hub.Unsubscribe(sub)
+	if missed, complete := hub.Resume(sub, ticks[0].Seq, "BTC"); len(missed) != 0 || !complete {
+		t.Fatalf("Resume = %v, %v, want none, complete", seqs(missed), complete)
+	}
+
+	// Prices published after Resume follow on the channel
+	hub.Publish([]models.CoinPrice{{Coin: "BTC", Exchange: "binance", Price: 101}})
+	select {
+	case tick := <-sub.C():
+		if tick.Seq != ticks[0].Seq+1 {
+			t.Fatalf("delivered seq = %d, want %d", tick.Seq, ticks[0].Seq+1)
+		}
+	default:
+		t.Fatal("nothing delivered after Resume")
+	}
+}
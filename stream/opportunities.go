@@ -0,0 +1,119 @@
+package stream
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/notblessy/dexlite/models"
+)
+
+// Opportunity events. A coin's opportunity opens when its spread crosses the
+// alert threshold, updates while it stays above and closes once it falls
+// back under or a venue goes stale
+const (
+	OPPORTUNITY_OPEN   = "open"
+	OPPORTUNITY_UPDATE = "update"
+	OPPORTUNITY_CLOSE  = "close"
+)
+
+// Opportunity is a change to a coin's cross-venue spread. A close carries the
+// last spread above the threshold
+type Opportunity struct {
+	Event string
+	Coin  string
+	models.VenueSpread
+	At time.Time
+}
+
+// Opportunities delivers spread opportunity events to every subscriber and
+// remembers which are open, so new subscribers start from the current state.
+// It is safe for concurrent use
+type Opportunities struct {
+	mu   sync.Mutex
+	subs map[*OpportunitySubscriber]struct{}
+	open map[string]Opportunity
+}
+
+func NewOpportunities() *Opportunities {
+	return &Opportunities{
+		subs: make(map[*OpportunitySubscriber]struct{}),
+		open: make(map[string]Opportunity),
+	}
+}
+
+// Subscribe registers a subscriber that can hold buffer undelivered events
+// before it is dropped as too slow, and returns the open opportunities by
+// coin. No event is missed between the two
+func (o *Opportunities) Subscribe(buffer int) (*OpportunitySubscriber, []Opportunity) {
+	sub := &OpportunitySubscriber{
+		c: make(chan Opportunity, buffer),
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.subs[sub] = struct{}{}
+
+	open := make([]Opportunity, 0, len(o.open))
+	for _, opportunity := range o.open {
+		open = append(open, opportunity)
+	}
+	sort.Slice(open, func(i, j int) bool { return open[i].Coin < open[j].Coin })
+	return sub, open
+}
+
+// Unsubscribe removes sub and closes its channel. It is a no-op for a
+// subscriber that was already dropped
+func (o *Opportunities) Unsubscribe(sub *OpportunitySubscriber) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.drop(sub)
+}
+
+// Len returns how many subscribers are registered
+func (o *Opportunities) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.subs)
+}
+
+// Publish records opportunity and delivers it to every subscriber, dropping
+// those whose buffer is full rather than holding up the scanner
+func (o *Opportunities) Publish(opportunity Opportunity) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if opportunity.Event == OPPORTUNITY_CLOSE {
+		delete(o.open, opportunity.Coin)
+	} else {
+		o.open[opportunity.Coin] = opportunity
+	}
+
+	for sub := range o.subs {
+		select {
+		case sub.c <- opportunity:
+		default:
+			o.drop(sub)
+		}
+	}
+}
+
+// drop removes sub, the caller holds mu
+func (o *Opportunities) drop(sub *OpportunitySubscriber) {
+	if _, ok := o.subs[sub]; !ok {
+		return
+	}
+	delete(o.subs, sub)
+	close(sub.c)
+}
+
+// OpportunitySubscriber receives every opportunity event
+type OpportunitySubscriber struct {
+	c chan Opportunity
+}
+
+// C returns the channel events are delivered on. It is closed when the
+// subscriber is unsubscribed or dropped for falling behind
+func (s *OpportunitySubscriber) C() <-chan Opportunity {
+	return s.c
+}
@@ -0,0 +1,116 @@
+package symbols
+
+import (
+	"strings"
+)
+
+// MAX_LENGTH is the longest symbol the coin columns hold
+const MAX_LENGTH = 32
+
+// THOUSAND_PREFIX marks coins quoted per 1000 units, following Hyperliquid's kPEPE naming
+const THOUSAND_PREFIX = "k"
+
+// DEX_SEPARATOR joins the dex of a builder-deployed market to its ticker,
+// following Hyperliquid's HIP-3 naming, e.g. xyz:TSLA
+const DEX_SEPARATOR = ":"
+
+// aliases maps alternative tickers to the canonical symbol
+var aliases = map[string]string{
+	"XBT": "BTC",
+}
+
+// thousandCoins lists coins that are commonly traded in 1000-unit contracts.
+// Only these accept the ambiguous "K" prefix in upper case, so KAVA stays KAVA
+var thousandCoins = map[string]bool{
+	"PEPE":  true,
+	"SHIB":  true,
+	"BONK":  true,
+	"FLOKI": true,
+	"LUNC":  true,
+	"DOGS":  true,
+	"NEIRO": true,
+}
+
+// Normalize returns the canonical symbol for a coin so that "btc", " BTC " and
+// "XBT" all resolve to "BTC", and "1000PEPE", "kPEPE" and "KPEPE" resolve to "kPEPE"
+func Normalize(coin string) string {
+	coin = strings.TrimSpace(coin)
+	if coin == "" {
+		return ""
+	}
+
+	// Dex names are lower case, the ticker is normalized as usual
+	if dex, ticker, ok := strings.Cut(coin, DEX_SEPARATOR); ok {
+		dex = strings.ToLower(strings.TrimSpace(dex))
+		ticker = Normalize(ticker)
+		if dex == "" || ticker == "" {
+			return ""
+		}
+		return dex + DEX_SEPARATOR + ticker
+	}
+
+	// A lower-case k followed by an upper-case ticker is Hyperliquid's
+	// thousand-unit naming, whereas "kava" is just a lower-cased KAVA
+	if base, ok := strings.CutPrefix(coin, THOUSAND_PREFIX); ok && base != "" {
+		upperBase := strings.ToUpper(base)
+		if base == upperBase || thousandCoins[upperBase] {
+			return THOUSAND_PREFIX + resolve(upperBase)
+		}
+	}
+
+	upper := strings.ToUpper(coin)
+
+	if base, ok := strings.CutPrefix(upper, "1000"); ok && base != "" {
+		return THOUSAND_PREFIX + resolve(base)
+	}
+
+	if base, ok := strings.CutPrefix(upper, "K"); ok && thousandCoins[base] {
+		return THOUSAND_PREFIX + base
+	}
+
+	return resolve(upper)
+}
+
+// NormalizeAll normalizes every coin, dropping empty entries and duplicates
+func NormalizeAll(coins []string) []string {
+	normalized := make([]string, 0, len(coins))
+	seen := make(map[string]bool, len(coins))
+
+	for _, coin := range coins {
+		coin = Normalize(coin)
+		if coin == "" || seen[coin] {
+			continue
+		}
+		seen[coin] = true
+		normalized = append(normalized, coin)
+	}
+
+	return normalized
+}
+
+// Scale splits a canonical symbol into the underlying asset and the number of
+// units one quote represents, e.g. kPEPE -> ("PEPE", 1000) and BTC -> ("BTC", 1).
+// Sources that only list the underlying multiply their price by the multiplier
+func Scale(coin string) (string, float64) {
+	if base, ok := strings.CutPrefix(coin, THOUSAND_PREFIX); ok && base != "" {
+		return base, 1000
+	}
+	return coin, 1
+}
+
+// SplitDex splits a builder-deployed market into its dex and ticker. Markets
+// on a venue's own universe have no dex
+func SplitDex(coin string) (string, string) {
+	if dex, ticker, ok := strings.Cut(coin, DEX_SEPARATOR); ok {
+		return dex, ticker
+	}
+	return "", coin
+}
+
+// resolve maps an upper-case symbol through the alias table
+func resolve(symbol string) string {
+	if canonical, exists := aliases[symbol]; exists {
+		return canonical
+	}
+	return symbol
+}
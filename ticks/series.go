@@ -0,0 +1,239 @@
+// Package ticks holds price ticks in memory compressed the way Facebook's
+// Gorilla paper describes: timestamps as delta-of-deltas and prices as the
+// XOR of consecutive values. Streams of sub-second ticks that barely move
+// shrink to a few bits per tick
+package ticks
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Tick is one observed price
+type Tick struct {
+	At    time.Time
+	Price float64
+}
+
+// Series is an append-only compressed run of ticks. Timestamps keep
+// millisecond precision. The zero value is an empty series ready to use, it
+// is not safe for concurrent use
+type Series struct {
+	buf bitWriter
+	n   int
+
+	first  int64
+	last   int64
+	delta  int64
+	value  uint64
+	lead   uint8
+	trail  uint8
+	latest Tick
+}
+
+// Append adds a tick. Ticks should arrive in time order, an older tick still
+// encodes but costs more bits
+func (s *Series) Append(tick Tick) {
+	ms := tick.At.UnixMilli()
+	value := math.Float64bits(tick.Price)
+
+	if s.n == 0 {
+		s.buf.writeBits(uint64(ms), 64)
+		s.buf.writeBits(value, 64)
+		s.first, s.last, s.value = ms, ms, value
+		// Force the first XOR to write its own window
+		s.lead = math.MaxUint8
+	} else {
+		delta := ms - s.last
+		s.writeDelta(delta - s.delta)
+		s.writeValue(value)
+		s.last, s.delta = ms, delta
+	}
+
+	s.n++
+	s.latest = Tick{At: time.UnixMilli(ms), Price: tick.Price}
+}
+
+// writeDelta encodes a delta-of-delta in the smallest of Gorilla's buckets
+func (s *Series) writeDelta(dod int64) {
+	switch {
+	case dod == 0:
+		s.buf.writeBit(false)
+	case -63 <= dod && dod <= 64:
+		s.buf.writeBits(0b10, 2)
+		s.buf.writeBits(uint64(dod), 7)
+	case -255 <= dod && dod <= 256:
+		s.buf.writeBits(0b110, 3)
+		s.buf.writeBits(uint64(dod), 9)
+	case -2047 <= dod && dod <= 2048:
+		s.buf.writeBits(0b1110, 4)
+		s.buf.writeBits(uint64(dod), 12)
+	default:
+		s.buf.writeBits(0b1111, 4)
+		s.buf.writeBits(uint64(dod), 64)
+	}
+}
+
+// writeValue encodes value as its XOR with the previous one, reusing the
+// previous meaningful bit window when the new XOR fits inside it
+func (s *Series) writeValue(value uint64) {
+	xor := value ^ s.value
+	s.value = value
+
+	if xor == 0 {
+		s.buf.writeBit(false)
+		return
+	}
+	s.buf.writeBit(true)
+
+	// Leading zeros are stored in 5 bits
+	lead := uint8(min(bits.LeadingZeros64(xor), 31))
+	trail := uint8(bits.TrailingZeros64(xor))
+
+	if s.lead != math.MaxUint8 && lead >= s.lead && trail >= s.trail {
+		s.buf.writeBit(false)
+		s.buf.writeBits(xor>>s.trail, 64-int(s.lead)-int(s.trail))
+		return
+	}
+
+	s.lead, s.trail = lead, trail
+	meaningful := 64 - int(lead) - int(trail)
+	s.buf.writeBit(true)
+	s.buf.writeBits(uint64(lead), 5)
+	// A 64 bit window doesn't fit in 6 bits, it is written as 0
+	s.buf.writeBits(uint64(meaningful), 6)
+	s.buf.writeBits(xor>>trail, meaningful)
+}
+
+// Len returns how many ticks the series holds
+func (s *Series) Len() int {
+	return s.n
+}
+
+// Size returns the compressed size in bytes
+func (s *Series) Size() int {
+	return len(s.buf.buf)
+}
+
+// First returns the time of the oldest tick, zero when empty
+func (s *Series) First() time.Time {
+	if s.n == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(s.first)
+}
+
+// Last returns the newest tick, zero when empty
+func (s *Series) Last() Tick {
+	return s.latest
+}
+
+// Ticks decodes every tick in the order they were appended
+func (s *Series) Ticks() []Tick {
+	ticks := make([]Tick, 0, s.n)
+	if s.n == 0 {
+		return ticks
+	}
+
+	r := bitReader{buf: s.buf.buf}
+	ms := int64(r.readBits(64))
+	value := r.readBits(64)
+	ticks = append(ticks, Tick{At: time.UnixMilli(ms), Price: math.Float64frombits(value)})
+
+	var delta int64
+	var lead, trail uint8
+	for i := 1; i < s.n; i++ {
+		delta += readDelta(&r)
+		ms += delta
+
+		if r.readBit() {
+			if r.readBit() {
+				lead = uint8(r.readBits(5))
+				meaningful := uint8(r.readBits(6))
+				if meaningful == 0 {
+					meaningful = 64
+				}
+				trail = 64 - lead - meaningful
+			}
+			value ^= r.readBits(64-int(lead)-int(trail)) << trail
+		}
+
+		ticks = append(ticks, Tick{At: time.UnixMilli(ms), Price: math.Float64frombits(value)})
+	}
+
+	return ticks
+}
+
+// readDelta decodes one delta-of-delta written by writeDelta
+func readDelta(r *bitReader) int64 {
+	var size int
+	switch {
+	case !r.readBit():
+		return 0
+	case !r.readBit():
+		size = 7
+	case !r.readBit():
+		size = 9
+	case !r.readBit():
+		size = 12
+	default:
+		size = 64
+	}
+
+	dod := int64(r.readBits(size))
+	// Sign extend from size bits
+	if size < 64 && dod > int64(1)<<(size-1) {
+		dod -= int64(1) << size
+	}
+	return dod
+}
+
+// bitWriter appends bits most significant first
+type bitWriter struct {
+	buf []byte
+	// free is how many low bits of the last byte are unused
+	free uint8
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.free == 0 {
+		w.buf = append(w.buf, 0)
+		w.free = 8
+	}
+	w.free--
+	if bit {
+		w.buf[len(w.buf)-1] |= 1 << w.free
+	}
+}
+
+// writeBits writes the low n bits of v
+func (w *bitWriter) writeBits(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.writeBit(v>>uint(i)&1 == 1)
+	}
+}
+
+// bitReader reads what a bitWriter wrote
+type bitReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *bitReader) readBit() bool {
+	bit := r.buf[r.pos/8]>>(7-uint(r.pos%8))&1 == 1
+	r.pos++
+	return bit
+}
+
+// readBits reads n bits into the low bits of the result
+func (r *bitReader) readBits(n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		v <<= 1
+		if r.readBit() {
+			v |= 1
+		}
+	}
+	return v
+}
@@ -0,0 +1,166 @@
+package ticks
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// roundTrip appends ticks to a series and checks Ticks decodes them unchanged
+func roundTrip(t *testing.T, ticks []Tick) {
+	t.Helper()
+
+	var s Series
+	for _, tick := range ticks {
+		s.Append(tick)
+	}
+	if s.Len() != len(ticks) {
+		t.Fatalf("Len() = %d, want %d", s.Len(), len(ticks))
+	}
+
+	decoded := s.Ticks()
+	if len(decoded) != len(ticks) {
+		t.Fatalf("decoded %d ticks, want %d", len(decoded), len(ticks))
+	}
+	for i, tick := range ticks {
+		got := decoded[i]
+		if !got.At.Equal(tick.At) {
+			t.Errorf("tick %d: At = %s, want %s", i, got.At, tick.At)
+		}
+		if math.Float64bits(got.Price) != math.Float64bits(tick.Price) {
+			t.Errorf("tick %d: Price = %v, want %v", i, got.Price, tick.Price)
+		}
+	}
+
+	if len(ticks) > 0 {
+		last := ticks[len(ticks)-1]
+		if !s.Last().At.Equal(last.At) || math.Float64bits(s.Last().Price) != math.Float64bits(last.Price) {
+			t.Errorf("Last() = %+v, want %+v", s.Last(), last)
+		}
+		if !s.First().Equal(ticks[0].At) {
+			t.Errorf("First() = %s, want %s", s.First(), ticks[0].At)
+		}
+	}
+}
+
+// at returns a time ms milliseconds after a fixed base
+func at(ms int64) time.Time {
+	return time.UnixMilli(1_790_000_000_000 + ms)
+}
+
+func TestSeriesEmpty(t *testing.T) {
+	var s Series
+	if s.Len() != 0 || s.Size() != 0 || len(s.Ticks()) != 0 || !s.First().IsZero() {
+		t.Fatalf("zero Series is not empty: len %d, size %d", s.Len(), s.Size())
+	}
+}
+
+func TestSeriesRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		ticks []Tick
+	}{
+		{
+			name:  "single tick",
+			ticks: []Tick{{At: at(0), Price: 64_123.5}},
+		},
+		{
+			name: "regular interval, unchanged price",
+			ticks: []Tick{
+				{At: at(0), Price: 100},
+				{At: at(250), Price: 100},
+				{At: at(500), Price: 100},
+				{At: at(750), Price: 100},
+			},
+		},
+		{
+			name: "every delta of delta bucket",
+			ticks: []Tick{
+				{At: at(0), Price: 1},
+				{At: at(1000), Price: 1.1},
+				// Delta of delta 64, -63, 256, -255, 2048, -2047 and past it
+				{At: at(2064), Price: 1.2},
+				{At: at(3065), Price: 1.3},
+				{At: at(4322), Price: 1.4},
+				{At: at(5324), Price: 1.5},
+				{At: at(8374), Price: 1.6},
+				{At: at(9377), Price: 1.7},
+				{At: at(100_000), Price: 1.8},
+			},
+		},
+		{
+			name: "negative deltas",
+			ticks: []Tick{
+				{At: at(10_000), Price: 3},
+				{At: at(9_000), Price: 2},
+				{At: at(8_999), Price: 1},
+				{At: at(-5_000_000), Price: 0},
+			},
+		},
+		{
+			name: "out of order timestamps",
+			ticks: []Tick{
+				{At: at(0), Price: 10},
+				{At: at(500), Price: 11},
+				{At: at(200), Price: 12},
+				{At: at(200), Price: 12},
+				{At: at(900), Price: 13},
+				{At: at(100), Price: 14},
+				{At: at(86_400_000), Price: 15},
+				{At: at(1), Price: 16},
+			},
+		},
+		{
+			name: "NaN and infinities",
+			ticks: []Tick{
+				{At: at(0), Price: math.NaN()},
+				{At: at(1), Price: 42},
+				{At: at(2), Price: math.NaN()},
+				{At: at(3), Price: math.NaN()},
+				{At: at(4), Price: math.Inf(1)},
+				{At: at(5), Price: math.Inf(-1)},
+				{At: at(6), Price: 0},
+			},
+		},
+		{
+			name: "sign changes and extremes",
+			ticks: []Tick{
+				{At: at(0), Price: -1.5},
+				{At: at(1), Price: 1.5},
+				{At: at(2), Price: math.Copysign(0, -1)},
+				{At: at(3), Price: math.MaxFloat64},
+				{At: at(4), Price: math.SmallestNonzeroFloat64},
+				{At: at(5), Price: 1e-12},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roundTrip(t, tt.ticks)
+		})
+	}
+}
+
+func TestSeriesTruncatesToMilliseconds(t *testing.T) {
+	var s Series
+	s.Append(Tick{At: at(0).Add(999 * time.Microsecond), Price: 1})
+
+	if got := s.Ticks()[0].At; !got.Equal(at(0)) {
+		t.Fatalf("At = %s, want %s", got, at(0))
+	}
+}
+
+func TestSeriesCompressesSteadyTicks(t *testing.T) {
+	var s Series
+	for i := int64(0); i < 1000; i++ {
+		s.Append(Tick{At: at(i * 100), Price: 100})
+	}
+	roundTrip(t, s.Ticks())
+
+	// 16 bytes for the first tick, a few for the first delta, then two bits
+	// per tick
+	if s.Size() > 16+4+1000*2/8 {
+		t.Fatalf("Size() = %d bytes for 1000 steady ticks", s.Size())
+	}
+}
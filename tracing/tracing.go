@@ -0,0 +1,108 @@
+// Package tracing exports OpenTelemetry spans for exchange fetches, database
+// queries and API requests over OTLP
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/notblessy/dexlite/services"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SERVICE_NAME identifies dexlite in the tracing backend
+const SERVICE_NAME = "dexlite"
+
+// Tracer is used for spans dexlite creates itself. It is a no-op until Setup
+// installs an exporter
+var Tracer = otel.Tracer("github.com/notblessy/dexlite")
+
+// Setup exports spans to the OTLP/HTTP endpoint, sampling sampleRatio of new
+// traces. The returned function flushes pending spans and should be called on
+// shutdown
+func Setup(ctx context.Context, endpoint string, sampleRatio float64) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(SERVICE_NAME))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// InstrumentTransports adds a client span to every request made by sources in
+// the registry that expose their HTTP client
+func InstrumentTransports(registry *services.Registry) {
+	sources := registry.Sources()
+	if fallback := registry.Fallback(); fallback != nil {
+		sources = append(sources, fallback)
+	}
+
+	for _, source := range sources {
+		httpSource, ok := source.(services.HTTPSource)
+		if !ok {
+			continue
+		}
+
+		client := httpSource.HTTPClient()
+		base := client.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		client.Transport = &spanTransport{
+			source: source.Name(),
+			base:   base,
+		}
+	}
+}
+
+// spanTransport wraps each exchange request in a client span and propagates
+// the trace context in the request headers
+type spanTransport struct {
+	source string
+	base   http.RoundTripper
+}
+
+func (t *spanTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Tracer.Start(req.Context(), "fetch "+t.source+" "+req.URL.Path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("exchange", t.source),
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", req.URL.Redacted()),
+		),
+	)
+	defer span.End()
+
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,70 @@
+package verify
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// WriteText prints a summary followed by at most limit issues, all when limit
+// is 0 or less
+func (r *Report) WriteText(w io.Writer, limit int) error {
+	counts := r.Counts()
+	fmt.Fprintf(w, "Scanned %d prices in %s\n", r.Scanned, r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(w, "  duplicates:   %d\n", counts[ISSUE_DUPLICATE])
+	fmt.Fprintf(w, "  out of order: %d\n", counts[ISSUE_OUT_OF_ORDER])
+	fmt.Fprintf(w, "  jumps:        %d\n", counts[ISSUE_JUMP])
+	fmt.Fprintf(w, "  gaps:         %d (%d during venue incidents)\n", counts[ISSUE_GAP], r.incidentGaps())
+	if r.Repaired {
+		fmt.Fprintf(w, "Repaired: deleted %d duplicate rows, backfilled %d ticks from dead letters\n", r.Deleted, r.Backfilled)
+	}
+
+	if len(r.Issues) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(w)
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "KIND\tCOIN\tEXCHANGE\tREGION\tAT\tDETAIL")
+	for i, issue := range r.Issues {
+		if limit > 0 && i == limit {
+			fmt.Fprintf(table, "... %d more\n", len(r.Issues)-limit)
+			break
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			issue.Kind, issue.Coin, issue.Exchange, issue.Region, issue.At.UTC().Format(time.RFC3339), issue.detail())
+	}
+	return table.Flush()
+}
+
+// incidentGaps counts the gaps overlapping a venue incident
+func (r *Report) incidentGaps() int {
+	var gaps int
+	for _, issue := range r.Issues {
+		if issue.Kind == ISSUE_GAP && len(issue.Incidents) > 0 {
+			gaps++
+		}
+	}
+	return gaps
+}
+
+// detail describes what is wrong with the tick
+func (i Issue) detail() string {
+	switch i.Kind {
+	case ISSUE_DUPLICATE:
+		return strconv.FormatInt(i.Count, 10) + " copies"
+	case ISSUE_GAP:
+		detail := "no ticks for " + i.At.Sub(i.PrevAt).Round(time.Second).String()
+		for _, incident := range i.Incidents {
+			detail += fmt.Sprintf(", venue incident %q (%s)", incident.Name, incident.Impact)
+		}
+		return detail
+	case ISSUE_JUMP:
+		return fmt.Sprintf("%g -> %g (%+.2f%%)", i.PrevPrice, i.Price, (i.Price-i.PrevPrice)/i.PrevPrice*100)
+	case ISSUE_OUT_OF_ORDER:
+		return fmt.Sprintf("venue time went backwards after %s", i.PrevAt.UTC().Format(time.RFC3339))
+	}
+	return ""
+}
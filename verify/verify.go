@@ -0,0 +1,309 @@
+// Package verify scans stored prices for integrity problems and optionally
+// repairs the ones that can be fixed from data already on hand
+package verify
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+)
+
+// Issue kinds
+const (
+	ISSUE_DUPLICATE    = "duplicate"
+	ISSUE_OUT_OF_ORDER = "out_of_order"
+	ISSUE_JUMP         = "jump"
+	ISSUE_GAP          = "gap"
+)
+
+// Options selects what is scanned and how strict the checks are
+type Options struct {
+	// Coin and Exchange narrow the scan, empty scans everything
+	Coin     string
+	Exchange string
+	// Since skips rows stored before it, zero scans the whole table
+	Since time.Time
+	// MaxGap is the longest expected spacing between two ticks of a series
+	MaxGap time.Duration
+	// JumpPct is the largest plausible move between two consecutive ticks
+	JumpPct float64
+	// Repair deletes duplicates and fills gaps from dead letters
+	Repair bool
+}
+
+// Issue is one problem found in a series, identified by coin, exchange and
+// region. PrevAt and PrevPrice describe the tick before the offending one
+type Issue struct {
+	Kind      string    `json:"kind"`
+	Coin      string    `json:"coin"`
+	Exchange  string    `json:"exchange"`
+	Region    string    `json:"region,omitempty"`
+	At        time.Time `json:"at"`
+	PrevAt    time.Time `json:"prev_at,omitempty"`
+	Price     float64   `json:"price,omitempty"`
+	PrevPrice float64   `json:"prev_price,omitempty"`
+	// Count is how many rows share the timestamp for duplicates
+	Count int64 `json:"count,omitempty"`
+	// Incidents are the exchange's status page incidents ongoing during a gap
+	Incidents []models.VenueIncident `json:"incidents,omitempty"`
+}
+
+// Report is the outcome of a scan
+type Report struct {
+	Scanned    int64         `json:"scanned"`
+	Issues     []Issue       `json:"issues"`
+	Repaired   bool          `json:"repaired"`
+	Deleted    int64         `json:"deleted"`
+	Backfilled int           `json:"backfilled"`
+	Duration   time.Duration `json:"duration"`
+	StartedAt  time.Time     `json:"started_at"`
+}
+
+// Counts returns the number of issues of each kind
+func (r *Report) Counts() map[string]int {
+	counts := map[string]int{
+		ISSUE_DUPLICATE:    0,
+		ISSUE_OUT_OF_ORDER: 0,
+		ISSUE_JUMP:         0,
+		ISSUE_GAP:          0,
+	}
+	for _, issue := range r.Issues {
+		counts[issue.Kind]++
+	}
+	return counts
+}
+
+// Verifier runs the checks against one database
+type Verifier struct {
+	db        *gorm.DB
+	persister *db.Persister
+}
+
+// NewVerifier creates a verifier. persister replays dead letters into gaps
+// when repairing
+func NewVerifier(database *gorm.DB, persister *db.Persister) *Verifier {
+	return &Verifier{
+		db:        database,
+		persister: persister,
+	}
+}
+
+// Run scans the prices selected by opts and repairs them if asked. Issues are
+// reported as found before any repair
+func (v *Verifier) Run(ctx context.Context, opts Options) (*Report, error) {
+	report := &Report{StartedAt: time.Now()}
+	database := v.db.WithContext(ctx)
+	where, args := opts.filter()
+
+	err := database.Model(&models.CoinPrice{}).Where(where, args...).Count(&report.Scanned).Error
+	if err != nil {
+		return nil, fmt.Errorf("counting prices: %w", err)
+	}
+
+	checks := []func(*gorm.DB, string, []interface{}, Options) ([]Issue, error){
+		duplicates,
+		outOfOrder,
+		jumpsAndGaps,
+	}
+	for _, check := range checks {
+		issues, err := check(database, where, args, opts)
+		if err != nil {
+			return nil, err
+		}
+		report.Issues = append(report.Issues, issues...)
+	}
+	if err := annotateGaps(database, report.Issues); err != nil {
+		return nil, fmt.Errorf("loading venue incidents: %w", err)
+	}
+
+	if opts.Repair {
+		report.Repaired = true
+		if report.Deleted, err = deleteDuplicates(database, where, args); err != nil {
+			return report, fmt.Errorf("deleting duplicates: %w", err)
+		}
+		if report.Backfilled, err = v.backfillGaps(database, report.Issues); err != nil {
+			return report, fmt.Errorf("backfilling gaps: %w", err)
+		}
+	}
+
+	report.Duration = time.Since(report.StartedAt)
+	return report, nil
+}
+
+// filter builds the WHERE clause shared by every check
+func (o Options) filter() (string, []interface{}) {
+	conditions := []string{"deleted_at IS NULL"}
+	var args []interface{}
+
+	if o.Coin != "" {
+		conditions = append(conditions, "coin = ?")
+		args = append(args, o.Coin)
+	}
+	if o.Exchange != "" {
+		conditions = append(conditions, "exchange = ?")
+		args = append(args, o.Exchange)
+	}
+	if !o.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, o.Since)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// duplicates finds ticks of one series stored more than once within the same
+// second, e.g. by two collectors sharing a region
+func duplicates(database *gorm.DB, where string, args []interface{}, _ Options) ([]Issue, error) {
+	var issues []Issue
+	err := database.Raw(`
+		SELECT '`+ISSUE_DUPLICATE+`' AS kind, coin, exchange, region, date_trunc('second', created_at) AS at, COUNT(*) AS count
+		FROM coin_prices
+		WHERE `+where+`
+		GROUP BY coin, exchange, region, date_trunc('second', created_at)
+		HAVING COUNT(*) > 1
+		ORDER BY coin, exchange, region, at`,
+		args...,
+	).Scan(&issues).Error
+	if err != nil {
+		return nil, fmt.Errorf("finding duplicates: %w", err)
+	}
+	return issues, nil
+}
+
+// outOfOrder finds ticks whose venue timestamp is older than the tick stored
+// before them, meaning the venue served a stale price after a newer one
+func outOfOrder(database *gorm.DB, where string, args []interface{}, _ Options) ([]Issue, error) {
+	var issues []Issue
+	err := database.Raw(`
+		SELECT '`+ISSUE_OUT_OF_ORDER+`' AS kind, coin, exchange, region, created_at AS at, prev_at, price, prev_price
+		FROM (
+			SELECT coin, exchange, region, created_at, price, source_time,
+				LAG(created_at) OVER w AS prev_at,
+				LAG(price) OVER w AS prev_price,
+				LAG(source_time) OVER w AS prev_source_time
+			FROM coin_prices
+			WHERE `+where+`
+			WINDOW w AS (PARTITION BY coin, exchange, region ORDER BY created_at, id)
+		) series
+		WHERE source_time < prev_source_time
+		ORDER BY coin, exchange, region, at`,
+		args...,
+	).Scan(&issues).Error
+	if err != nil {
+		return nil, fmt.Errorf("finding out-of-order ticks: %w", err)
+	}
+	return issues, nil
+}
+
+// jumpsAndGaps compares every tick with the one before it in its series,
+// flagging moves above JumpPct and spacing above MaxGap. A large move after a
+// gap is reported as the gap only
+func jumpsAndGaps(database *gorm.DB, where string, args []interface{}, opts Options) ([]Issue, error) {
+	var issues []Issue
+	err := database.Raw(`
+		SELECT CASE WHEN EXTRACT(EPOCH FROM created_at - prev_at) > ? THEN '`+ISSUE_GAP+`' ELSE '`+ISSUE_JUMP+`' END AS kind,
+			coin, exchange, region, created_at AS at, prev_at, price, prev_price
+		FROM (
+			SELECT coin, exchange, region, created_at, price,
+				LAG(created_at) OVER w AS prev_at,
+				LAG(price) OVER w AS prev_price
+			FROM coin_prices
+			WHERE `+where+`
+			WINDOW w AS (PARTITION BY coin, exchange, region ORDER BY created_at, id)
+		) series
+		WHERE prev_at IS NOT NULL
+			AND (EXTRACT(EPOCH FROM created_at - prev_at) > ? OR (prev_price > 0 AND ABS(price - prev_price) / prev_price * 100 > ?))
+		ORDER BY coin, exchange, region, at`,
+		append(append([]interface{}{opts.MaxGap.Seconds()}, args...), opts.MaxGap.Seconds(), opts.JumpPct)...,
+	).Scan(&issues).Error
+	if err != nil {
+		return nil, fmt.Errorf("finding jumps and gaps: %w", err)
+	}
+	return issues, nil
+}
+
+// annotateGaps attaches to every gap the venue incidents that overlap it, so
+// gaps the exchange caused can be told apart from collector outages
+func annotateGaps(database *gorm.DB, issues []Issue) error {
+	var exchanges []string
+	var from, to time.Time
+	for _, issue := range issues {
+		if issue.Kind != ISSUE_GAP {
+			continue
+		}
+		if !slices.Contains(exchanges, issue.Exchange) {
+			exchanges = append(exchanges, issue.Exchange)
+		}
+		if from.IsZero() || issue.PrevAt.Before(from) {
+			from = issue.PrevAt
+		}
+		if issue.At.After(to) {
+			to = issue.At
+		}
+	}
+	if len(exchanges) == 0 {
+		return nil
+	}
+
+	incidents, err := db.VenueIncidents(database, exchanges, from, to)
+	if err != nil {
+		return err
+	}
+	for i := range issues {
+		if issues[i].Kind != ISSUE_GAP {
+			continue
+		}
+		for _, incident := range incidents {
+			if incident.Exchange == issues[i].Exchange && incident.Overlaps(issues[i].PrevAt, issues[i].At) {
+				issues[i].Incidents = append(issues[i].Incidents, incident)
+			}
+		}
+	}
+	return nil
+}
+
+// deleteDuplicates soft deletes every copy of a duplicated tick but the first
+// stored, like the cleanup worker does
+func deleteDuplicates(database *gorm.DB, where string, args []interface{}) (int64, error) {
+	result := database.Where(`id IN (
+		SELECT id FROM (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY coin, exchange, region, date_trunc('second', created_at) ORDER BY id) AS copy
+			FROM coin_prices
+			WHERE `+where+`
+		) copies
+		WHERE copy > 1
+	)`, args...).Delete(&models.CoinPrice{})
+	return result.RowsAffected, result.Error
+}
+
+// backfillGaps replays dead letters whose tick falls inside a reported gap of
+// the same series. Gaps with nothing dead-lettered stay as they are
+func (v *Verifier) backfillGaps(database *gorm.DB, issues []Issue) (int, error) {
+	var ids []uint
+	for _, issue := range issues {
+		if issue.Kind != ISSUE_GAP {
+			continue
+		}
+
+		var letters []uint
+		err := database.Model(&models.DeadLetter{}).
+			Where("coin = ? AND exchange = ? AND region = ? AND tick_at > ? AND tick_at < ?",
+				issue.Coin, issue.Exchange, issue.Region, issue.PrevAt, issue.At).
+			Pluck("id", &letters).Error
+		if err != nil {
+			return 0, err
+		}
+		ids = append(ids, letters...)
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	return v.persister.Replay(ids)
+}
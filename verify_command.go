@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/notblessy/dexlite/config"
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/symbols"
+	"github.com/notblessy/dexlite/verify"
+	"github.com/spf13/cobra"
+)
+
+// verifyFlags are the flags of `dexlite verify`
+type verifyFlags struct {
+	coin     string
+	exchange string
+	since    time.Duration
+	maxGap   time.Duration
+	jumpPct  float64
+	repair   bool
+	asJSON   bool
+	limit    int
+}
+
+func newVerifyCommand(cfg *config.Config) *cobra.Command {
+	var flags verifyFlags
+	cmd := &cobra.Command{
+		Use:         "verify",
+		Short:       "check stored prices for gaps, duplicates and jumps",
+		Args:        cobra.NoArgs,
+		Annotations: persistent,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exit(runVerify(cfg, flags))
+		},
+	}
+	cmd.Flags().StringVar(&flags.coin, "coin", "", "only scan this coin")
+	cmd.Flags().StringVar(&flags.exchange, "exchange", "", "only scan this exchange")
+	cmd.Flags().DurationVar(&flags.since, "since", 0, "only scan prices stored in this window, e.g. 48h, all when 0")
+	cmd.Flags().DurationVar(&flags.maxGap, "max-gap", 2*cfg.Fetcher.Interval, "longest expected spacing between two ticks")
+	cmd.Flags().Float64Var(&flags.jumpPct, "jump-pct", cfg.Anomaly.JumpPct, "largest plausible move between two ticks in percent")
+	cmd.Flags().BoolVar(&flags.repair, "repair", false, "delete duplicates and backfill gaps from dead letters")
+	cmd.Flags().BoolVar(&flags.asJSON, "json", false, "print the report as JSON")
+	cmd.Flags().IntVar(&flags.limit, "limit", 50, "issues listed in the text report, all when 0")
+	return cmd
+}
+
+// runVerify implements `dexlite verify`. It exits 0 when the data is clean, 1
+// when issues were found and 2 when the scan itself failed
+func runVerify(cfg *config.Config, flags verifyFlags) int {
+	if flags.maxGap <= 0 || flags.jumpPct <= 0 {
+		fmt.Fprintln(os.Stderr, "verify: --max-gap and --jump-pct must be positive")
+		return 2
+	}
+
+	opts := verify.Options{
+		Coin:     symbols.Normalize(flags.coin),
+		Exchange: flags.exchange,
+		MaxGap:   flags.maxGap,
+		JumpPct:  flags.jumpPct,
+		Repair:   flags.repair,
+	}
+	if flags.since > 0 {
+		opts.Since = time.Now().Add(-flags.since)
+	}
+
+	// The checks lean on Postgres date functions
+	if cfg.Database.Driver != db.DRIVER_POSTGRES {
+		fmt.Fprintln(os.Stderr, "verify: only supported on Postgres")
+		return 2
+	}
+	database := db.NewPostgres(cfg.Database.DSN)
+	persister := db.NewPersister(database, cfg.Database.DeadLetterFile)
+	if cfg.Server.Region != "" {
+		persister.SetRegion(cfg.Server.Region)
+	}
+
+	report, err := verify.NewVerifier(database, persister).Run(context.Background(), opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify: %v\n", err)
+		return 2
+	}
+
+	if flags.asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = report.WriteText(os.Stdout, flags.limit)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify: %v\n", err)
+		return 2
+	}
+
+	if len(report.Issues) > 0 {
+		return 1
+	}
+	return 0
+}
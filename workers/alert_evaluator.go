@@ -0,0 +1,785 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/metrics"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/notifiers"
+	"github.com/notblessy/dexlite/stream"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+const DEFAULT_ALERT_INTERVAL = 1 * time.Minute
+
+// ALERT_TICK_BUFFER is how many stored prices the evaluator can fall behind
+// before the hub drops it. It then resumes from the prices the hub keeps
+const ALERT_TICK_BUFFER = 1024
+
+// ALERT_MARK_BUFFER is how many batches of stored marks can wait for the
+// evaluator before more are skipped
+const ALERT_MARK_BUFFER = 16
+
+// ALERT_HISTORY_STEP is how finely change alerts' price history is kept, one
+// price per venue per step. A change alert's reference can be up to a step
+// older than the newest price stored a window before the current one
+const ALERT_HISTORY_STEP = 10 * time.Second
+
+// Conditions checked against prices and against marks
+var (
+	priceConditions = []string{models.ALERT_ABOVE, models.ALERT_BELOW, models.ALERT_CHANGE}
+	markConditions  = []string{models.ALERT_MARK_DIVERGENCE}
+)
+
+// AlertEvaluator keeps the enabled price alerts in memory, indexed by coin and
+// condition, and checks a coin's alerts against every price and mark as it is
+// stored, without querying the database per alert or holding up the writer.
+// An alert posts to its webhook when its condition starts to hold. Fired
+// alerts are also sent to every added notifier, and to the users watching the
+// coin as their notification preferences allow
+type AlertEvaluator struct {
+	db        *gorm.DB
+	gate      *db.WriteGate
+	hub       *stream.Hub
+	runs      *RunRecorder
+	notifiers []notifiers.Notifier
+	smtp      *notifiers.SMTPServer
+	// telegramToken is the bot users' Telegram notifications are sent as
+	telegramToken string
+	// interval is how often a run is recorded and the alerts are checked for
+	// changes made by another process
+	interval time.Duration
+
+	// refresh is signalled when alerts are changed in this process
+	refresh chan struct{}
+	// marks receives marks as the mark tracker stores them
+	marks chan []models.MarkPrice
+
+	// The rest is only used by the Start goroutine
+	rules alertRules
+	state *alertState
+	// version is the alerts table as of the last reload, stale when that failed
+	version alertVersion
+	stale   bool
+	// seq is the sequence number of the last price evaluated
+	seq uint64
+	// fired and errs are what happened since the last recorded run
+	fired int64
+	errs  []error
+}
+
+func NewAlertEvaluator(database *gorm.DB, gate *db.WriteGate, hub *stream.Hub, interval time.Duration) *AlertEvaluator {
+	if interval <= 0 {
+		interval = DEFAULT_ALERT_INTERVAL
+	}
+
+	return &AlertEvaluator{
+		db:       database,
+		gate:     gate,
+		hub:      hub,
+		runs:     NewRunRecorder(database),
+		interval: interval,
+		refresh:  make(chan struct{}, 1),
+		marks:    make(chan []models.MarkPrice, ALERT_MARK_BUFFER),
+		rules:    make(alertRules),
+		state:    newAlertState(nil),
+	}
+}
+
+// AddNotifier sends every fired alert to notifier as well as the alert's own
+// webhook. Delivery to added notifiers is best effort and never retried
+func (ae *AlertEvaluator) AddNotifier(notifier notifiers.Notifier) {
+	ae.notifiers = append(ae.notifiers, notifier)
+}
+
+// Refresh has the evaluator reload the alerts after they were created,
+// changed or deleted. It doesn't wait for the reload
+func (ae *AlertEvaluator) Refresh() {
+	select {
+	case ae.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// ObserveMarks checks mark divergence alerts against marks once they are
+// stored. It never blocks, marks that find the evaluator backed up are
+// skipped and the next ones stored catch up
+func (ae *AlertEvaluator) ObserveMarks(marks []models.MarkPrice) {
+	select {
+	case ae.marks <- marks:
+	default:
+		log.Warn().Int("marks", len(marks)).Msg("Alert evaluator is behind, skipping marks")
+	}
+}
+
+func (ae *AlertEvaluator) Start(ctx context.Context) {
+	sub := ae.hub.Subscribe(ALERT_TICK_BUFFER)
+	defer func() { ae.hub.Unsubscribe(sub) }()
+
+	// Load the alerts and check them against the stored prices on start
+	ae.reload(sub)
+	runStartedAt := time.Now()
+
+	ticker := time.NewTicker(ae.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Alert evaluator shutting down")
+			return
+		case tick, ok := <-sub.C():
+			if !ok {
+				sub = ae.resume()
+				continue
+			}
+			ae.observePrices(drain(sub, tick))
+		case marks := <-ae.marks:
+			ae.observeMarks(marks)
+		case <-ae.refresh:
+			ae.reload(sub)
+		case <-ticker.C:
+			ae.record(runStartedAt)
+			runStartedAt = time.Now()
+			if ae.outdated() {
+				ae.reload(sub)
+			}
+		}
+	}
+}
+
+// drain returns first and the prices already waiting behind it, so a burst
+// is evaluated in one pass
+func drain(sub *stream.Subscriber, first stream.Tick) []stream.Tick {
+	ticks := []stream.Tick{first}
+	for len(ticks) < ALERT_TICK_BUFFER {
+		select {
+		case tick, ok := <-sub.C():
+			if !ok {
+				return ticks
+			}
+			ticks = append(ticks, tick)
+		default:
+			return ticks
+		}
+	}
+	return ticks
+}
+
+// resume subscribes again after the hub dropped the evaluator for falling
+// behind and evaluates the prices it missed. When some of them are no longer
+// kept, the prices are loaded from the database instead
+func (ae *AlertEvaluator) resume() *stream.Subscriber {
+	sub := ae.hub.Subscribe(ALERT_TICK_BUFFER)
+	missed, complete := ae.hub.Resume(sub, ae.seq, ae.rules.coins(append(priceConditions, markConditions...)...)...)
+	if !complete {
+		log.Warn().Msg("Alert evaluator fell behind the prices kept for it, reloading")
+		ae.state = newAlertState(nil)
+		ae.reload(sub)
+		return sub
+	}
+	if len(missed) > 0 {
+		ae.observePrices(missed)
+	}
+	return sub
+}
+
+// observePrices records stored prices and checks the alerts of their coins
+func (ae *AlertEvaluator) observePrices(ticks []stream.Tick) {
+	coins := make(map[string]struct{})
+	for _, tick := range ticks {
+		ae.state.observePrice(tick.CoinPrice)
+		coins[tick.Coin] = struct{}{}
+		ae.seq = max(ae.seq, tick.Seq)
+	}
+	ae.evaluateAll(slices.Sorted(maps.Keys(coins)), priceConditions)
+}
+
+// observeMarks records stored marks and checks the mark divergence alerts of
+// their coins
+func (ae *AlertEvaluator) observeMarks(marks []models.MarkPrice) {
+	coins := make(map[string]struct{})
+	for _, mark := range marks {
+		ae.state.observeMark(mark)
+		coins[mark.Coin] = struct{}{}
+	}
+	ae.evaluateAll(slices.Sorted(maps.Keys(coins)), markConditions)
+}
+
+// reload loads and indexes the enabled alerts, watches their coins on sub and
+// loads the prices and marks of the coins not held yet, then checks every
+// alert. A failure keeps the previous alerts until the next interval
+func (ae *AlertEvaluator) reload(sub *stream.Subscriber) {
+	now := time.Now()
+
+	version, err := ae.alertsVersion()
+	if err == nil {
+		var alerts []models.PriceAlert
+		err = ae.db.Where("enabled = ?", true).Order("id ASC").Find(&alerts).Error
+		if err == nil {
+			err = ae.index(sub, alerts, now)
+		}
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Error loading price alerts")
+		ae.errs = append(ae.errs, fmt.Errorf("loading alerts: %w", err))
+		ae.stale = true
+		return
+	}
+	ae.version = version
+	ae.stale = false
+
+	ae.evaluateAll(ae.rules.coins(priceConditions...), priceConditions)
+	ae.evaluateAll(ae.rules.coins(markConditions...), markConditions)
+}
+
+// index replaces the rules with alerts. Their coins are watched before their
+// prices are loaded so none stored in between is missed
+func (ae *AlertEvaluator) index(sub *stream.Subscriber, alerts []models.PriceAlert, now time.Time) error {
+	rules := indexAlerts(alerts)
+	coins := rules.coins(append(priceConditions, markConditions...)...)
+	sub.Watch(coins...)
+
+	state, err := ae.seed(rules, now)
+	if err != nil {
+		return err
+	}
+
+	for coin := range ae.rules {
+		if !slices.Contains(coins, coin) {
+			sub.Unwatch(coin)
+		}
+	}
+	ae.rules = rules
+	ae.state = state
+	return nil
+}
+
+// alertVersion tells whether the alerts changed: edits move the newest
+// updated_at and deletes the count. The evaluator's own bookkeeping leaves
+// updated_at alone
+type alertVersion struct {
+	count   int64
+	updated time.Time
+}
+
+func (v alertVersion) Equal(other alertVersion) bool {
+	return v.count == other.count && v.updated.Equal(other.updated)
+}
+
+func (ae *AlertEvaluator) alertsVersion() (alertVersion, error) {
+	var version alertVersion
+	if err := ae.db.Model(&models.PriceAlert{}).Count(&version.count).Error; err != nil {
+		return version, err
+	}
+
+	var newest models.PriceAlert
+	err := ae.db.Select("updated_at").Order("updated_at DESC").Take(&newest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return version, err
+	}
+	version.updated = newest.UpdatedAt
+	return version, nil
+}
+
+// outdated reports whether the alerts changed since the last reload, e.g.
+// through another process's API
+func (ae *AlertEvaluator) outdated() bool {
+	version, err := ae.alertsVersion()
+	if err != nil {
+		log.Error().Err(err).Msg("Error checking price alerts for changes")
+		return false
+	}
+	return ae.stale || !version.Equal(ae.version)
+}
+
+// record stores a run covering the evaluations since startedAt
+func (ae *AlertEvaluator) record(startedAt time.Time) {
+	ae.runs.Record(WORKER_ALERT_EVALUATOR, startedAt, ae.fired, errors.Join(ae.errs...))
+	ae.fired = 0
+	ae.errs = nil
+}
+
+// evaluateAll checks the alerts of coins with one of conditions and stores
+// the ones whose triggered state changed
+func (ae *AlertEvaluator) evaluateAll(coins []string, conditions []string) {
+	now := time.Now()
+
+	var fired, rearmed []uint
+	for _, coin := range coins {
+		for _, condition := range conditions {
+			for _, alert := range ae.rules[coin][condition] {
+				changed, err := ae.evaluate(alert, now)
+				if err != nil {
+					log.Error().Err(err).Uint("alert", alert.ID).Str("coin", alert.Coin).Msg("Error evaluating price alert")
+					ae.errs = append(ae.errs, fmt.Errorf("alert %d: %w", alert.ID, err))
+					continue
+				}
+				if !changed {
+					continue
+				}
+				if alert.Triggered {
+					fired = append(fired, alert.ID)
+				} else {
+					rearmed = append(rearmed, alert.ID)
+				}
+			}
+		}
+	}
+	if len(fired) == 0 && len(rearmed) == 0 {
+		return
+	}
+
+	// Only the writes hold off a migration, not delivering the alerts
+	ae.gate.Enter()
+	defer ae.gate.Leave()
+
+	// Alerts whose condition cleared are re-armed for the next crossing. The
+	// columns are updated without updated_at, which marks edits to the alert
+	if len(rearmed) > 0 {
+		err := ae.db.Model(&models.PriceAlert{}).Where("id IN ?", rearmed).UpdateColumn("triggered", false).Error
+		if err != nil {
+			ae.errs = append(ae.errs, fmt.Errorf("re-arming alerts: %w", err))
+		}
+	}
+	if len(fired) > 0 {
+		err := ae.db.Model(&models.PriceAlert{}).Where("id IN ?", fired).UpdateColumns(map[string]interface{}{
+			"triggered":     true,
+			"last_fired_at": now,
+		}).Error
+		if err != nil {
+			ae.errs = append(ae.errs, fmt.Errorf("marking alerts fired: %w", err))
+		}
+		ae.fired += int64(len(fired))
+	}
+}
+
+// alertRules indexes the enabled alerts by coin, then condition
+type alertRules map[string]map[string][]*models.PriceAlert
+
+func indexAlerts(alerts []models.PriceAlert) alertRules {
+	rules := make(alertRules)
+	for i := range alerts {
+		alert := &alerts[i]
+		if rules[alert.Coin] == nil {
+			rules[alert.Coin] = make(map[string][]*models.PriceAlert)
+		}
+		rules[alert.Coin][alert.Condition] = append(rules[alert.Coin][alert.Condition], alert)
+	}
+	return rules
+}
+
+// coins returns the coins with an alert of any of conditions
+func (r alertRules) coins(conditions ...string) []string {
+	var coins []string
+	for _, coin := range slices.Sorted(maps.Keys(r)) {
+		for _, condition := range conditions {
+			if len(r[coin][condition]) > 0 {
+				coins = append(coins, coin)
+				break
+			}
+		}
+	}
+	return coins
+}
+
+// alertState is what alerts are checked against: the newest price and mark
+// of every alerted coin on every exchange and, for coins with change alerts,
+// each exchange's recent prices, oldest first and one per ALERT_HISTORY_STEP
+type alertState struct {
+	prices  map[string]map[string]models.CoinPrice
+	marks   map[string]map[string]models.MarkPrice
+	history map[string]map[string][]models.CoinPrice
+	// windows is the longest change window of each coin, how far back its
+	// history reaches
+	windows map[string]time.Duration
+}
+
+func newAlertState(rules alertRules) *alertState {
+	state := &alertState{
+		prices:  make(map[string]map[string]models.CoinPrice),
+		marks:   make(map[string]map[string]models.MarkPrice),
+		history: make(map[string]map[string][]models.CoinPrice),
+		windows: make(map[string]time.Duration),
+	}
+	for coin, conditions := range rules {
+		for _, alert := range conditions[models.ALERT_CHANGE] {
+			state.windows[coin] = max(state.windows[coin], alert.Window())
+		}
+	}
+	return state
+}
+
+// seed returns the state rules are checked against. What the current state
+// holds of coins still alerted on is kept, the rest is loaded in one query
+// per kind: the newest prices and marks, and the history of change alerts
+func (ae *AlertEvaluator) seed(rules alertRules, now time.Time) (*alertState, error) {
+	state := newAlertState(rules)
+
+	var priceCoins, historyCoins, markCoins []string
+	var longest time.Duration
+	for _, coin := range rules.coins(priceConditions...) {
+		if venues, ok := ae.state.prices[coin]; ok {
+			state.prices[coin] = venues
+		} else {
+			priceCoins = append(priceCoins, coin)
+			state.prices[coin] = make(map[string]models.CoinPrice)
+		}
+	}
+	for coin, window := range state.windows {
+		if venues, ok := ae.state.history[coin]; ok && ae.state.windows[coin] >= window {
+			state.history[coin] = venues
+		} else {
+			historyCoins = append(historyCoins, coin)
+			state.history[coin] = make(map[string][]models.CoinPrice)
+			longest = max(longest, window)
+		}
+	}
+	for _, coin := range rules.coins(markConditions...) {
+		if venues, ok := ae.state.marks[coin]; ok {
+			state.marks[coin] = venues
+		} else {
+			markCoins = append(markCoins, coin)
+			state.marks[coin] = make(map[string]models.MarkPrice)
+		}
+	}
+
+	if len(priceCoins) > 0 {
+		query := ae.db.Model(&models.CoinPrice{}).Where("coin IN ? AND created_at <= ?", priceCoins, now)
+		var latest []models.CoinPrice
+		if err := db.LatestPer(query, "coin", "exchange").Find(&latest).Error; err != nil {
+			return nil, err
+		}
+		for _, price := range latest {
+			state.observePrice(price)
+		}
+	}
+
+	if len(historyCoins) > 0 {
+		// The history reaches back to the last price at or before the window
+		cutoff := now.Add(-longest)
+		var recent []models.CoinPrice
+		err := ae.db.Where("coin IN ? AND created_at > ? AND created_at <= ?", historyCoins, cutoff, now).
+			Order("created_at ASC").
+			Find(&recent).Error
+		if err != nil {
+			return nil, err
+		}
+		query := ae.db.Model(&models.CoinPrice{}).Where("coin IN ? AND created_at <= ?", historyCoins, cutoff)
+		var before []models.CoinPrice
+		if err := db.LatestPer(query, "coin", "exchange").Find(&before).Error; err != nil {
+			return nil, err
+		}
+		for _, price := range append(before, recent...) {
+			state.observePrice(price)
+		}
+	}
+
+	if len(markCoins) > 0 {
+		query := ae.db.Model(&models.MarkPrice{}).Where("coin IN ? AND created_at <= ?", markCoins, now)
+		var latest []models.MarkPrice
+		if err := db.LatestPer(query, "coin", "exchange").Find(&latest).Error; err != nil {
+			return nil, err
+		}
+		for _, mark := range latest {
+			state.observeMark(mark)
+		}
+	}
+
+	return state, nil
+}
+
+// observePrice keeps price as its venue's newest unless a newer one is held,
+// and adds it to the history of a coin with change alerts. Coins without
+// alerts are ignored
+func (s *alertState) observePrice(price models.CoinPrice) {
+	if venues, ok := s.prices[price.Coin]; ok {
+		if newest, ok := venues[price.Exchange]; !ok || !price.CreatedAt.Before(newest.CreatedAt) {
+			venues[price.Exchange] = price
+		}
+	}
+	if venues, ok := s.history[price.Coin]; ok {
+		venues[price.Exchange] = remember(venues[price.Exchange], price, s.windows[price.Coin])
+	}
+}
+
+// observeMark keeps mark as its venue's newest unless a newer one is held
+func (s *alertState) observeMark(mark models.MarkPrice) {
+	if venues, ok := s.marks[mark.Coin]; ok {
+		if newest, ok := venues[mark.Exchange]; !ok || !mark.CreatedAt.Before(newest.CreatedAt) {
+			venues[mark.Exchange] = mark
+		}
+	}
+}
+
+// remember adds price to history, a venue's prices oldest first, keeping the
+// newest of each ALERT_HISTORY_STEP. Prices older than the newest one needs
+// to look window back are dropped
+func remember(history []models.CoinPrice, price models.CoinPrice, window time.Duration) []models.CoinPrice {
+	step := price.CreatedAt.Truncate(ALERT_HISTORY_STEP)
+	i, found := slices.BinarySearchFunc(history, step, func(kept models.CoinPrice, step time.Time) int {
+		return kept.CreatedAt.Truncate(ALERT_HISTORY_STEP).Compare(step)
+	})
+	switch {
+	case !found:
+		history = slices.Insert(history, i, price)
+	case !price.CreatedAt.Before(history[i].CreatedAt):
+		history[i] = price
+	}
+
+	cutoff := history[len(history)-1].CreatedAt.Add(-window)
+	if reference := sort.Search(len(history), func(i int) bool { return history[i].CreatedAt.After(cutoff) }) - 1; reference > 0 {
+		history = slices.Delete(history, 0, reference)
+	}
+	return history
+}
+
+// referenceAt returns the newest price of coin on exchange kept at or before
+// at
+func (s *alertState) referenceAt(coin, exchange string, at time.Time) (models.CoinPrice, bool) {
+	history := s.history[coin][exchange]
+	i := sort.Search(len(history), func(i int) bool { return history[i].CreatedAt.After(at) })
+	if i == 0 {
+		return models.CoinPrice{}, false
+	}
+	return history[i-1], true
+}
+
+// price returns the alert's newest price, from its exchange or the newest of
+// any when it has none
+func (s *alertState) price(alert *models.PriceAlert) (models.CoinPrice, bool) {
+	var newest models.CoinPrice
+	found := false
+	for _, price := range s.prices[alert.Coin] {
+		if alert.Exchange != "" && price.Exchange != alert.Exchange {
+			continue
+		}
+		if !found || price.CreatedAt.After(newest.CreatedAt) {
+			newest = price
+			found = true
+		}
+	}
+	return newest, found
+}
+
+// mark returns the alert's newest mark price, like price
+func (s *alertState) mark(alert *models.PriceAlert) (models.MarkPrice, bool) {
+	var newest models.MarkPrice
+	found := false
+	for _, mark := range s.marks[alert.Coin] {
+		if alert.Exchange != "" && mark.Exchange != alert.Exchange {
+			continue
+		}
+		if !found || mark.CreatedAt.After(newest.CreatedAt) {
+			newest = mark
+			found = true
+		}
+	}
+	return newest, found
+}
+
+// evaluate checks one alert against the state and reports whether its
+// triggered state changed, updating alert. When no destination of a firing
+// alert could be reached it stays untriggered so delivery is retried on the
+// next price
+func (ae *AlertEvaluator) evaluate(alert *models.PriceAlert, now time.Time) (bool, error) {
+	event, found := ae.observe(alert, now)
+	if !found {
+		return false, nil
+	}
+
+	breached := alert.Breached(event.Price, event.Reference)
+	if breached == alert.Triggered {
+		return false, nil
+	}
+
+	// The condition cleared, re-arm the alert for the next crossing
+	if !breached {
+		alert.Triggered = false
+		return true, nil
+	}
+
+	if err := ae.deliver(alert, event); err != nil {
+		return false, err
+	}
+	metrics.PriceAlertsFiredTotal.WithLabelValues(alert.Coin, alert.Condition).Inc()
+
+	for _, notifier := range ae.notifiers {
+		if err := notifier.Notify(event); err != nil {
+			metrics.NotificationFailuresTotal.WithLabelValues(notifier.Name()).Inc()
+			log.Warn().Err(err).Uint("alert", alert.ID).Str("notifier", notifier.Name()).Msg("Failed to deliver price alert")
+		}
+	}
+	ae.notifyUsers(alert, event)
+
+	log.Info().
+		Uint("alert", alert.ID).
+		Str("coin", alert.Coin).
+		Str("condition", alert.Condition).
+		Float64("price", event.Price).
+		Msg("Price alert fired")
+
+	alert.Triggered = true
+	alert.LastFiredAt = &now
+	return true, nil
+}
+
+// observe takes what the alert's condition is checked against from the state
+// as the event it would fire. found is false until there is enough data to
+// evaluate it
+func (ae *AlertEvaluator) observe(alert *models.PriceAlert, now time.Time) (notifiers.Event, bool) {
+	event := notifiers.Event{
+		AlertID:       alert.ID,
+		Name:          alert.Name,
+		Coin:          alert.Coin,
+		Condition:     alert.Condition,
+		Severity:      alert.Severity,
+		Threshold:     alert.Threshold,
+		WindowMinutes: alert.WindowMinutes,
+		FiredAt:       now,
+	}
+
+	if alert.Condition == models.ALERT_MARK_DIVERGENCE {
+		mark, found := ae.state.mark(alert)
+		if !found {
+			return event, false
+		}
+		event.Exchange = mark.Exchange
+		event.Price = mark.Mark
+		event.Reference = mark.Oracle
+		event.ChangePct = mark.DivergenceBps / 100
+		event.PricedAt = mark.CreatedAt
+		return event, true
+	}
+
+	current, found := ae.state.price(alert)
+	if !found {
+		return event, false
+	}
+	event.Exchange = current.Exchange
+	event.Price = current.Price
+	event.PricedAt = current.CreatedAt
+
+	if alert.Condition == models.ALERT_CHANGE {
+		// The reference comes from the current price's venue, so an alert on
+		// any venue doesn't read the gap between two venues as a change
+		reference, found := ae.state.referenceAt(alert.Coin, current.Exchange, current.CreatedAt.Add(-alert.Window()))
+		if !found {
+			return event, false
+		}
+		event.Reference = reference.Price
+		event.ChangePct = percentChange(reference.Price, current.Price)
+	}
+
+	return event, true
+}
+
+// SetSMTPServer lets alerts be routed to email channels, mailed through server
+func (ae *AlertEvaluator) SetSMTPServer(server *notifiers.SMTPServer) {
+	ae.smtp = server
+}
+
+// SetTelegramBot lets users be notified on Telegram, by the bot with token
+func (ae *AlertEvaluator) SetTelegramBot(token string) {
+	ae.telegramToken = token
+}
+
+// notifyUsers sends event to the users with alert's coin on their watchlist,
+// by the channels they chose, unless its severity is below their threshold or
+// it fires in their quiet hours. Delivery is best effort and never retried
+func (ae *AlertEvaluator) notifyUsers(alert *models.PriceAlert, event notifiers.Event) {
+	watchers := ae.db.Model(&models.WatchlistCoin{}).Select("user_id").Where("coin = ?", alert.Coin)
+
+	var preferences []models.NotificationPreference
+	if err := ae.db.Preload("User").Where("user_id IN (?)", watchers).Find(&preferences).Error; err != nil {
+		log.Error().Err(err).Uint("alert", alert.ID).Msg("Error loading notification preferences")
+		return
+	}
+
+	for _, preference := range preferences {
+		if preference.User == nil || !preference.Allows(alert.Severity, event.FiredAt) {
+			continue
+		}
+		for _, notifier := range ae.userNotifiers(preference) {
+			if err := notifier.Notify(event); err != nil {
+				metrics.NotificationFailuresTotal.WithLabelValues(notifier.Name()).Inc()
+				log.Warn().Err(err).Uint("alert", alert.ID).Uint("user", preference.UserID).Str("notifier", notifier.Name()).Msg("Failed to notify user of price alert")
+			}
+		}
+	}
+}
+
+// userNotifiers returns the notifiers for the channels a user chose that the
+// server can deliver to. Only a confirmed address is mailed
+func (ae *AlertEvaluator) userNotifiers(preference models.NotificationPreference) []notifiers.Notifier {
+	var destinations []notifiers.Notifier
+	if preference.Email && preference.User.EmailConfirmedAt != nil && ae.smtp != nil {
+		email, err := notifiers.NewEmail(*ae.smtp, []string{preference.User.Email}, "", "")
+		if err != nil {
+			log.Warn().Err(err).Uint("user", preference.UserID).Msg("Can't email user")
+		} else {
+			destinations = append(destinations, email)
+		}
+	}
+	if preference.TelegramChatID != "" && ae.telegramToken != "" {
+		telegram, err := notifiers.NewTelegram(ae.telegramToken, preference.TelegramChatID, "")
+		if err != nil {
+			log.Warn().Err(err).Uint("user", preference.UserID).Msg("Can't message user on Telegram")
+		} else {
+			destinations = append(destinations, telegram)
+		}
+	}
+	return destinations
+}
+
+// deliver sends event to the alert's webhook and the channel it is routed to.
+// It only fails when every destination failed, so one that works is never
+// sent the same alert twice
+func (ae *AlertEvaluator) deliver(alert *models.PriceAlert, event notifiers.Event) error {
+	var destinations []notifiers.Notifier
+	if alert.WebhookURL != "" {
+		destinations = append(destinations, notifiers.NewWebhook(string(alert.WebhookURL)))
+	}
+	if alert.ChannelID != nil {
+		// The channel is read when the alert fires, so edits to it apply
+		// without reloading the alerts
+		var channel models.NotificationChannel
+		err := ae.db.Take(&channel, *alert.ChannelID).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil && channel.Enabled {
+			notifier, err := notifiers.ForChannel(channel, ae.smtp)
+			if err != nil {
+				return err
+			}
+			destinations = append(destinations, notifier)
+		}
+	}
+	if len(destinations) == 0 {
+		return fmt.Errorf("alert has no webhook and its channel is disabled or deleted")
+	}
+
+	var errs []error
+	for _, notifier := range destinations {
+		if err := notifier.Notify(event); err != nil {
+			metrics.NotificationFailuresTotal.WithLabelValues(notifier.Name()).Inc()
+			errs = append(errs, fmt.Errorf("%s: %w", notifier.Name(), err))
+		}
+	}
+	if len(errs) == len(destinations) {
+		return errors.Join(errs...)
+	}
+	for _, err := range errs {
+		log.Warn().Err(err).Uint("alert", alert.ID).Msg("Failed to deliver price alert")
+	}
+	return nil
+}
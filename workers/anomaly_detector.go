@@ -0,0 +1,199 @@
+package workers
+
+import (
+	"math"
+	"time"
+
+	"github.com/notblessy/dexlite/services"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	AnomalySourceDivergence = "source_divergence"
+	AnomalyFrozenFeed       = "frozen_feed"
+	AnomalyImpossibleJump   = "impossible_jump"
+	AnomalySchemaDrift      = "schema_drift"
+)
+
+// AnomalyEvent is a single data-quality finding sent to the anomaly webhook
+type AnomalyEvent struct {
+	Type       string    `json:"type"`
+	Coin       string    `json:"coin"`
+	Exchange   string    `json:"exchange,omitempty"`
+	Price      float64   `json:"price"`
+	Reference  float64   `json:"reference"`
+	ChangePct  float64   `json:"change_pct"`
+	Cycles     int       `json:"cycles,omitempty"`
+	DetectedAt time.Time `json:"detected_at"`
+
+	Schema *services.SchemaDrift `json:"schema,omitempty"`
+}
+
+type AnomalyPayload struct {
+	Events []AnomalyEvent `json:"events"`
+}
+
+type feedState struct {
+	price     float64
+	unchanged int
+}
+
+// AnomalyDetector inspects each fetch cycle for suspicious data and reports
+// findings to a webhook meant for ops/risk consumers rather than traders
+type AnomalyDetector struct {
+	webhook *services.WebhookClient
+	url     string
+
+	divergencePct float64
+	jumpPct       float64
+	frozenCycles  int
+	thresholds    *MoveThresholds
+
+	// Last seen price per exchange and coin
+	feeds map[string]map[string]*feedState
+}
+
+// NewAnomalyDetector creates a detector posting to url. A venue is reported
+// when it is divergencePct above the cheapest venue, moves jumpPct in one
+// cycle, or repeats the same price for frozenCycles cycles
+func NewAnomalyDetector(url string, divergencePct, jumpPct float64, frozenCycles int) *AnomalyDetector {
+	return &AnomalyDetector{
+		webhook:       services.NewWebhookClient(),
+		url:           url,
+		divergencePct: divergencePct,
+		jumpPct:       jumpPct,
+		frozenCycles:  frozenCycles,
+		feeds:         make(map[string]map[string]*feedState),
+	}
+}
+
+// SetThresholds makes jumps and divergences below a coin's minimum move count
+// as noise
+func (ad *AnomalyDetector) SetThresholds(thresholds *MoveThresholds) {
+	ad.thresholds = thresholds
+}
+
+// Check evaluates one cycle of prices keyed by exchange then coin and posts any
+// anomalies found
+func (ad *AnomalyDetector) Check(prices map[string]map[string]float64) {
+	now := time.Now()
+	events := append(ad.checkFeeds(prices, now), ad.checkDivergence(prices, now)...)
+	if len(events) == 0 {
+		return
+	}
+
+	if err := ad.webhook.Send(ad.url, AnomalyPayload{Events: events}); err != nil {
+		log.Error().Err(err).Int("events", len(events)).Msg("Error sending anomaly events")
+		return
+	}
+
+	log.Info().Int("events", len(events)).Msg("Sent anomaly events")
+}
+
+// ReportSchemaDrift sends a schema drift found by the services.SchemaMonitor
+func (ad *AnomalyDetector) ReportSchemaDrift(drift services.SchemaDrift) {
+	event := AnomalyEvent{
+		Type:       AnomalySchemaDrift,
+		Exchange:   drift.Source,
+		DetectedAt: drift.DetectedAt,
+		Schema:     &drift,
+	}
+
+	if err := ad.webhook.Send(ad.url, AnomalyPayload{Events: []AnomalyEvent{event}}); err != nil {
+		log.Error().Err(err).Str("exchange", drift.Source).Msg("Error sending schema drift event")
+	}
+}
+
+// checkFeeds compares each price against the previous cycle from the same venue
+func (ad *AnomalyDetector) checkFeeds(prices map[string]map[string]float64, now time.Time) []AnomalyEvent {
+	var events []AnomalyEvent
+
+	for exchange, coins := range prices {
+		if ad.feeds[exchange] == nil {
+			ad.feeds[exchange] = make(map[string]*feedState)
+		}
+
+		for coin, price := range coins {
+			state, exists := ad.feeds[exchange][coin]
+			if !exists {
+				ad.feeds[exchange][coin] = &feedState{price: price}
+				continue
+			}
+
+			changePct := percentChange(state.price, price)
+			if math.Abs(changePct) >= ad.jumpPct && ad.thresholds.Significant(coin, changePct) {
+				events = append(events, AnomalyEvent{
+					Type:       AnomalyImpossibleJump,
+					Coin:       coin,
+					Exchange:   exchange,
+					Price:      price,
+					Reference:  state.price,
+					ChangePct:  changePct,
+					DetectedAt: now,
+				})
+			}
+
+			if price == state.price {
+				state.unchanged++
+				// Report once when the threshold is reached, not on every cycle after
+				if state.unchanged == ad.frozenCycles {
+					events = append(events, AnomalyEvent{
+						Type:       AnomalyFrozenFeed,
+						Coin:       coin,
+						Exchange:   exchange,
+						Price:      price,
+						Reference:  state.price,
+						Cycles:     state.unchanged,
+						DetectedAt: now,
+					})
+				}
+			} else {
+				state.unchanged = 0
+			}
+
+			state.price = price
+		}
+	}
+
+	return events
+}
+
+// checkDivergence compares each venue against the cheapest venue for the same coin
+func (ad *AnomalyDetector) checkDivergence(prices map[string]map[string]float64, now time.Time) []AnomalyEvent {
+	lowest := make(map[string]float64)
+	for _, coins := range prices {
+		for coin, price := range coins {
+			if current, exists := lowest[coin]; !exists || price < current {
+				lowest[coin] = price
+			}
+		}
+	}
+
+	var events []AnomalyEvent
+	for exchange, coins := range prices {
+		for coin, price := range coins {
+			changePct := percentChange(lowest[coin], price)
+			if changePct >= ad.divergencePct && ad.thresholds.Significant(coin, changePct) {
+				events = append(events, AnomalyEvent{
+					Type:       AnomalySourceDivergence,
+					Coin:       coin,
+					Exchange:   exchange,
+					Price:      price,
+					Reference:  lowest[coin],
+					ChangePct:  changePct,
+					DetectedAt: now,
+				})
+			}
+		}
+	}
+
+	return events
+}
+
+// percentChange returns the change from before to after in percent
+func percentChange(before, after float64) float64 {
+	if before == 0 {
+		return 0
+	}
+	return (after - before) / before * 100
+}
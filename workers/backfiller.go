@@ -0,0 +1,220 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/services"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// DEFAULT_BACKFILL_INTERVAL is how often the backfiller looks for coins
+// without history
+const DEFAULT_BACKFILL_INTERVAL = 5 * time.Minute
+
+// ROLE_BACKFILL labels prices taken from a venue's candle history
+const ROLE_BACKFILL = "backfill"
+
+type backfillKey struct {
+	exchange string
+	coin     string
+}
+
+// Backfiller seeds the price history of newly tracked coins from the candles
+// of every HistorySource in the registry, so they don't start with an empty
+// comparison window. Each candle's close is stored as the price of the fetch
+// interval it closed in, intervals that already have a price keep it
+type Backfiller struct {
+	db        *gorm.DB
+	gate      *db.WriteGate
+	persister *db.Persister
+	runs      *RunRecorder
+	registry  *services.Registry
+	coins     func() []string
+	// bucket is the fetch interval, one price is stored per bucket
+	bucket   time.Duration
+	window   time.Duration
+	interval time.Duration
+	// candles is rebuilt over the backfilled window, nil to leave candles to
+	// the candle builder's own passes
+	candles *CandleBuilder
+
+	// seeded holds the series whose history is in place
+	seeded map[backfillKey]bool
+}
+
+// NewBackfiller creates a backfiller that seeds the coins returned by coins
+// with window of history, checking for new ones every interval. bucket is the
+// fetch interval. Prices are stored through persister, which tags their region
+func NewBackfiller(database *gorm.DB, gate *db.WriteGate, persister *db.Persister, registry *services.Registry, coins func() []string, bucket, window, interval time.Duration) *Backfiller {
+	if interval <= 0 {
+		interval = DEFAULT_BACKFILL_INTERVAL
+	}
+
+	return &Backfiller{
+		db:        database,
+		gate:      gate,
+		persister: persister,
+		runs:      NewRunRecorder(database),
+		registry:  registry,
+		coins:     coins,
+		bucket:    bucket,
+		window:    window,
+		interval:  interval,
+		seeded:    make(map[backfillKey]bool),
+	}
+}
+
+// SetCandleBuilder rebuilds candles over the window after a coin is seeded
+func (b *Backfiller) SetCandleBuilder(candles *CandleBuilder) {
+	b.candles = candles
+}
+
+func (b *Backfiller) Start(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		b.SeedNew()
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Backfiller shutting down")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SeedNew backfills the window for every coin a history source has no prices
+// of from the start of the window. A coin is seeded once per process, even
+// when the venue had less history than the window
+func (b *Backfiller) SeedNew() {
+	startedAt := time.Now()
+	from := startedAt.Add(-b.window)
+
+	rows, err := b.seedNew(from, startedAt)
+	b.gate.Enter()
+	b.runs.Record(WORKER_BACKFILLER, startedAt, rows, err)
+	b.gate.Leave()
+
+	if rows > 0 && b.candles != nil {
+		if _, err := b.candles.Rebuild(from); err != nil {
+			log.Error().Err(err).Msg("Error rebuilding candles after backfill")
+		}
+	}
+}
+
+func (b *Backfiller) seedNew(from, to time.Time) (int64, error) {
+	coins := b.coins()
+
+	var rows int64
+	var errs []error
+	for _, source := range b.registry.Sources() {
+		history, ok := source.(services.HistorySource)
+		if !ok {
+			continue
+		}
+
+		for _, coin := range coins {
+			key := backfillKey{exchange: source.Name(), coin: coin}
+			if b.seeded[key] {
+				continue
+			}
+
+			// A series reaching back to the start of the window has its history
+			var first models.CoinPrice
+			err := b.db.Where("coin = ? AND exchange = ? AND created_at <= ?", coin, source.Name(), from.Add(2*b.bucket)).
+				Limit(1).
+				Find(&first).Error
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s %s: %w", source.Name(), coin, err))
+				continue
+			}
+			if first.ID != 0 {
+				b.seeded[key] = true
+				continue
+			}
+
+			stored, err := b.backfill(source.Name(), history, coin, from, to)
+			rows += stored
+			if err != nil {
+				log.Warn().Err(err).Str("exchange", source.Name()).Str("coin", coin).Msg("Error backfilling price history")
+				errs = append(errs, fmt.Errorf("%s %s: %w", source.Name(), coin, err))
+				continue
+			}
+			log.Info().Str("exchange", source.Name()).Str("coin", coin).Int64("rows", stored).Msg("Backfilled price history")
+			b.seeded[key] = true
+		}
+	}
+
+	return rows, errors.Join(errs...)
+}
+
+// Backfill fills the intervals between from and to without a price with the
+// candle history of every history source, for each of coins. Coins a source
+// fails on are reported in the returned error
+func (b *Backfiller) Backfill(coins []string, from, to time.Time) (int64, error) {
+	var rows int64
+	var errs []error
+	for _, source := range b.registry.Sources() {
+		history, ok := source.(services.HistorySource)
+		if !ok {
+			continue
+		}
+
+		for _, coin := range coins {
+			stored, err := b.backfill(source.Name(), history, coin, from, to)
+			rows += stored
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s %s: %w", source.Name(), coin, err))
+			}
+		}
+	}
+	return rows, errors.Join(errs...)
+}
+
+// backfill stores the closes of coin's candles between from and to on one
+// venue
+func (b *Backfiller) backfill(exchange string, source services.HistorySource, coin string, from, to time.Time) (int64, error) {
+	candles, err := source.GetCandles(coin, b.bucket, from, to)
+	if err != nil || len(candles) == 0 {
+		return 0, err
+	}
+
+	prices := make([]models.CoinPrice, 0, len(candles))
+	for _, candle := range candles {
+		if candle.CloseAt.Before(from) || candle.CloseAt.After(to) {
+			continue
+		}
+		closedAt := candle.CloseAt
+		prices = append(prices, models.CoinPrice{
+			Coin:       coin,
+			Exchange:   exchange,
+			Price:      candle.Close,
+			Labels:     models.Labels{LABEL_ROLE: ROLE_BACKFILL},
+			SourceTime: &closedAt,
+			Bucket:     closedAt.Truncate(b.bucket),
+			CreatedAt:  closedAt,
+		})
+	}
+	if len(prices) == 0 {
+		return 0, nil
+	}
+
+	// Hold off while a migration is running. The candles are fetched
+	// outside the gate so a slow venue doesn't hold up a migration
+	b.gate.Enter()
+	defer b.gate.Leave()
+
+	stored, err := b.persister.InsertMissing(context.Background(), prices)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store prices: %w", err)
+	}
+	return stored, nil
+}
@@ -0,0 +1,147 @@
+package workers
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/metrics"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/symbols"
+	"gorm.io/gorm"
+)
+
+// Reasons a price fails the sanity check, as recorded in metrics.RejectedPricesTotal
+const (
+	REJECT_NOT_FINITE   = "not_finite"
+	REJECT_NON_POSITIVE = "non_positive"
+	REJECT_OUT_OF_RANGE = "out_of_range"
+	REJECT_IMPLAUSIBLE  = "implausible"
+	REJECT_UNSTORABLE   = "unstorable"
+)
+
+// Bound is an inclusive price range for a coin, a zero side is unbounded
+type Bound struct {
+	Min float64
+	Max float64
+}
+
+// PriceBounds rejects obviously corrupt prices before they are stored. Coins
+// with configured bounds are checked against them; every other coin is checked
+// against the last accepted price, which it may not exceed or undercut by more
+// than maxFactor times
+type PriceBounds struct {
+	configured map[string]Bound
+	maxFactor  float64
+
+	mu      sync.Mutex
+	learned map[string]float64
+}
+
+// NewPriceBounds creates bounds from configured ranges. A maxFactor of zero
+// disables the learned check
+func NewPriceBounds(configured map[string]Bound, maxFactor float64) *PriceBounds {
+	coins := make(map[string]Bound, len(configured))
+	for coin, bound := range configured {
+		coins[symbols.Normalize(coin)] = bound
+	}
+
+	return &PriceBounds{
+		configured: coins,
+		maxFactor:  maxFactor,
+		learned:    make(map[string]float64),
+	}
+}
+
+// Seed learns the latest stored price of every coin so the learned check
+// applies from the first cycle after a restart
+func (b *PriceBounds) Seed(database *gorm.DB) error {
+	var rows []models.CoinPrice
+	err := db.LatestPer(database.Model(&models.CoinPrice{}), "coin").Find(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, row := range rows {
+		b.learned[row.Coin] = row.Price
+	}
+	return nil
+}
+
+// Range returns the prices Check currently accepts for coin. ok is false when
+// nothing beyond positivity is enforced yet
+func (b *PriceBounds) Range(coin string) (minPrice, maxPrice float64, ok bool) {
+	if b == nil {
+		return 0, 0, false
+	}
+	if bound, exists := b.configured[coin]; exists {
+		return bound.Min, bound.Max, true
+	}
+	if b.maxFactor <= 0 {
+		return 0, 0, false
+	}
+
+	b.mu.Lock()
+	reference, exists := b.learned[coin]
+	b.mu.Unlock()
+	if !exists {
+		return 0, 0, false
+	}
+	return reference / b.maxFactor, reference * b.maxFactor, true
+}
+
+// Check returns an error if price is not a plausible value for coin, and counts
+// the rejection against exchange. Accepted prices update the learned reference.
+// A nil PriceBounds still rejects non-finite and non-positive prices
+func (b *PriceBounds) Check(exchange, coin string, price float64) error {
+	reason, err := b.check(coin, price)
+	if err != nil {
+		metrics.RejectedPricesTotal.WithLabelValues(exchange, reason).Inc()
+		return err
+	}
+
+	if b != nil {
+		b.mu.Lock()
+		b.learned[coin] = price
+		b.mu.Unlock()
+	}
+	return nil
+}
+
+func (b *PriceBounds) check(coin string, price float64) (string, error) {
+	if math.IsNaN(price) || math.IsInf(price, 0) {
+		return REJECT_NOT_FINITE, fmt.Errorf("%s: price %v is not finite", coin, price)
+	}
+	if price <= 0 {
+		return REJECT_NON_POSITIVE, fmt.Errorf("%s: price %v is not positive", coin, price)
+	}
+	if price >= models.MAX_PRICE {
+		return REJECT_UNSTORABLE, fmt.Errorf("%s: price %v is too large to store", coin, price)
+	}
+	if b == nil {
+		return "", nil
+	}
+
+	if bound, exists := b.configured[coin]; exists {
+		if (bound.Min > 0 && price < bound.Min) || (bound.Max > 0 && price > bound.Max) {
+			return REJECT_OUT_OF_RANGE, fmt.Errorf("%s: price %v is outside [%v, %v]", coin, price, bound.Min, bound.Max)
+		}
+		return "", nil
+	}
+
+	if b.maxFactor <= 0 {
+		return "", nil
+	}
+
+	b.mu.Lock()
+	reference, exists := b.learned[coin]
+	b.mu.Unlock()
+
+	if exists && (price > reference*b.maxFactor || price < reference/b.maxFactor) {
+		return REJECT_IMPLAUSIBLE, fmt.Errorf("%s: price %v is more than %vx away from last accepted %v", coin, price, b.maxFactor, reference)
+	}
+	return "", nil
+}
@@ -0,0 +1,317 @@
+package workers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/models"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const DEFAULT_CANDLE_BUILD_INTERVAL = 1 * time.Minute
+
+// SESSION_SOURCE_INTERVAL is the candle size session bars are rolled up from
+const SESSION_SOURCE_INTERVAL = "1h"
+
+type candleKey struct {
+	coin     string
+	exchange string
+	openTime time.Time
+}
+
+// CandleBuilder rolls raw CoinPrice rows into OHLC candles for every size in
+// models.CANDLE_INTERVALS, then rolls the hourly candles into the session bars
+// of models.SESSION_INTERVALS. Candles outlive the raw rows, which are removed
+// by the cleanup worker
+type CandleBuilder struct {
+	db       *gorm.DB
+	gate     *db.WriteGate
+	runs     *RunRecorder
+	sessions *models.Sessions
+	interval time.Duration
+	backfill time.Duration
+}
+
+// NewCandleBuilder creates a builder that runs every interval. On an empty
+// coin_candles table it builds candles from the last backfill of raw prices.
+// Session bars are anchored to sessions
+func NewCandleBuilder(database *gorm.DB, gate *db.WriteGate, sessions *models.Sessions, interval, backfill time.Duration) *CandleBuilder {
+	if interval <= 0 {
+		interval = DEFAULT_CANDLE_BUILD_INTERVAL
+	}
+
+	return &CandleBuilder{
+		db:       database,
+		gate:     gate,
+		runs:     NewRunRecorder(database),
+		sessions: sessions,
+		interval: interval,
+		backfill: backfill,
+	}
+}
+
+func (cb *CandleBuilder) Start(ctx context.Context) {
+	// Run immediately on start
+	cb.Build()
+
+	ticker := time.NewTicker(cb.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Candle builder shutting down")
+			return
+		case <-ticker.C:
+			cb.Build()
+		}
+	}
+}
+
+// Build updates every candle interval, rebuilding from the newest stored
+// candle so the candle still in progress picks up new prices
+func (cb *CandleBuilder) Build() {
+	// Hold off while a migration is running
+	cb.gate.Enter()
+	defer cb.gate.Leave()
+
+	startedAt := time.Now()
+
+	var rows int64
+	var errs []error
+	for name, size := range models.CANDLE_INTERVALS {
+		written, err := cb.build(name, size, startedAt)
+		rows += written
+		if err != nil {
+			log.Error().Err(err).Str("interval", name).Msg("Error building candles")
+			errs = append(errs, err)
+		}
+	}
+
+	// Session bars are rolled from the hourly candles, which are up to date now
+	for name := range models.SESSION_INTERVALS {
+		written, err := cb.buildSessions(name)
+		rows += written
+		if err != nil {
+			log.Error().Err(err).Str("interval", name).Msg("Error building session bars")
+			errs = append(errs, err)
+		}
+	}
+
+	cb.runs.Record(WORKER_CANDLE_BUILDER, startedAt, rows, errors.Join(errs...))
+}
+
+// Rebuild rebuilds every candle and session bar from the raw prices stored
+// since, replacing what is stored, e.g. after prices were imported or
+// repaired. Prices are read a day at a time, and only the writes of each day
+// hold off a migration
+func (cb *CandleBuilder) Rebuild(since time.Time) (int64, error) {
+	now := time.Now()
+	var rows int64
+	for name, size := range models.CANDLE_INTERVALS {
+		for from := since.Truncate(size); from.Before(now); from = from.Add(DOWNSAMPLE_WINDOW) {
+			var prices []models.CoinPrice
+			err := cb.db.Where("created_at >= ? AND created_at < ?", from, from.Add(DOWNSAMPLE_WINDOW)).
+				Order("created_at ASC").
+				Find(&prices).Error
+			if err != nil {
+				return rows, err
+			}
+
+			batch := rollPrices(prices, name, size)
+			if len(batch) == 0 {
+				continue
+			}
+			written, err := cb.upsert(batch)
+			rows += written
+			if err != nil {
+				return rows, err
+			}
+		}
+	}
+
+	// Session bars are rolled from the hourly candles, which are rebuilt now
+	for name := range models.SESSION_INTERVALS {
+		var hourly []models.CoinCandle
+		err := cb.db.Where("resolution = ? AND open_time >= ?", SESSION_SOURCE_INTERVAL, cb.sessions.Start(name, since)).
+			Order("open_time ASC").
+			Find(&hourly).Error
+		if err != nil {
+			return rows, err
+		}
+
+		batch := rollSessions(hourly, name, cb.sessions)
+		if len(batch) == 0 {
+			continue
+		}
+		written, err := cb.upsert(batch)
+		rows += written
+		if err != nil {
+			return rows, err
+		}
+	}
+	return rows, nil
+}
+
+// upsert stores a batch of rebuilt candles, holding off migrations meanwhile
+func (cb *CandleBuilder) upsert(batch []models.CoinCandle) (int64, error) {
+	cb.gate.Enter()
+	defer cb.gate.Leave()
+	return upsertCandles(cb.db, batch)
+}
+
+// build upserts the candles of one size from the last stored candle onwards
+func (cb *CandleBuilder) build(name string, size time.Duration, now time.Time) (int64, error) {
+	var latest sql.NullTime
+	err := cb.db.Model(&models.CoinCandle{}).
+		Select("MAX(open_time)").
+		Where("resolution = ?", name).
+		Row().Scan(&latest)
+	if err != nil {
+		return 0, err
+	}
+
+	from := now.Add(-cb.backfill).Truncate(size)
+	if latest.Valid {
+		from = latest.Time
+	}
+
+	var prices []models.CoinPrice
+	err = cb.db.Where("created_at >= ?", from).
+		Order("created_at ASC").
+		Find(&prices).Error
+	if err != nil {
+		return 0, err
+	}
+
+	batch := rollPrices(prices, name, size)
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	return upsertCandles(cb.db, batch)
+}
+
+// rollPrices rolls prices, in created_at order, into candles of one size
+func rollPrices(prices []models.CoinPrice, name string, size time.Duration) []models.CoinCandle {
+	candles := make(map[candleKey]*models.CoinCandle)
+	var order []candleKey
+	for _, price := range prices {
+		key := candleKey{
+			coin:     price.Coin,
+			exchange: price.Exchange,
+			openTime: price.CreatedAt.Truncate(size),
+		}
+
+		candle, exists := candles[key]
+		if !exists {
+			candle = &models.CoinCandle{
+				Coin:     price.Coin,
+				Exchange: price.Exchange,
+				Interval: name,
+				OpenTime: key.openTime,
+				Open:     price.Price,
+				High:     price.Price,
+				Low:      price.Price,
+			}
+			candles[key] = candle
+			order = append(order, key)
+		}
+
+		candle.High = max(candle.High, price.Price)
+		candle.Low = min(candle.Low, price.Price)
+		candle.Close = price.Price
+		candle.Count++
+	}
+
+	batch := make([]models.CoinCandle, len(order))
+	for i, key := range order {
+		batch[i] = *candles[key]
+	}
+	return batch
+}
+
+// buildSessions upserts the session bars of one interval from the hourly
+// candles, starting at the last stored bar. Hourly candles are placed whole, so
+// with a day boundary that isn't on the hour a candle counts towards the bar
+// its open time falls in
+func (cb *CandleBuilder) buildSessions(name string) (int64, error) {
+	var latest sql.NullTime
+	err := cb.db.Model(&models.CoinCandle{}).
+		Select("MAX(open_time)").
+		Where("resolution = ?", name).
+		Row().Scan(&latest)
+	if err != nil {
+		return 0, err
+	}
+
+	query := cb.db.Where("resolution = ?", SESSION_SOURCE_INTERVAL)
+	if latest.Valid {
+		query = query.Where("open_time >= ?", latest.Time)
+	}
+
+	var hourly []models.CoinCandle
+	if err := query.Order("open_time ASC").Find(&hourly).Error; err != nil {
+		return 0, err
+	}
+
+	batch := rollSessions(hourly, name, cb.sessions)
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	return upsertCandles(cb.db, batch)
+}
+
+// rollSessions rolls hourly candles, in open_time order, into the session
+// bars of one interval
+func rollSessions(hourly []models.CoinCandle, name string, sessions *models.Sessions) []models.CoinCandle {
+	bars := make(map[candleKey]*models.CoinCandle)
+	var order []candleKey
+	for _, candle := range hourly {
+		key := candleKey{
+			coin:     candle.Coin,
+			exchange: candle.Exchange,
+			openTime: sessions.Start(name, candle.OpenTime),
+		}
+
+		bar, exists := bars[key]
+		if !exists {
+			bar = &models.CoinCandle{
+				Coin:     candle.Coin,
+				Exchange: candle.Exchange,
+				Interval: name,
+				OpenTime: key.openTime,
+				Open:     candle.Open,
+				High:     candle.High,
+				Low:      candle.Low,
+			}
+			bars[key] = bar
+			order = append(order, key)
+		}
+
+		bar.High = max(bar.High, candle.High)
+		bar.Low = min(bar.Low, candle.Low)
+		bar.Close = candle.Close
+		bar.Count += candle.Count
+	}
+
+	batch := make([]models.CoinCandle, len(order))
+	for i, key := range order {
+		batch[i] = *bars[key]
+	}
+	return batch
+}
+
+// upsertCandles stores candles, replacing the values of buckets already stored
+func upsertCandles(database *gorm.DB, batch []models.CoinCandle) (int64, error) {
+	result := database.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "coin"}, {Name: "exchange"}, {Name: "resolution"}, {Name: "open_time"}},
+		DoUpdates: clause.AssignmentColumns([]string{"open", "high", "low", "close", "count", "updated_at"}),
+	}).CreateInBatches(&batch, 500)
+
+	return result.RowsAffected, result.Error
+}
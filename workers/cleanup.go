@@ -2,54 +2,336 @@ package workers
 
 import (
 	"context"
-	"log"
+	"slices"
 	"time"
 
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/metrics"
 	"github.com/notblessy/dexlite/models"
+	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 )
 
+const (
+	DEFAULT_CLEANUP_BATCH_SIZE = 10000
+	// MIN_CLEANUP_BATCH_SIZE is the smallest batch the worker shrinks to
+	MIN_CLEANUP_BATCH_SIZE = 500
+	// CLEANUP_BATCH_TARGET is how long one delete should take. Faster batches
+	// are grown and slower ones shrunk
+	CLEANUP_BATCH_TARGET = time.Second
+	// CLEANUP_RUN_BUDGET caps one run. Rows still expired when it runs out
+	// bring the next run forward
+	CLEANUP_RUN_BUDGET = time.Minute
+)
+
+// CleanupSchedule bounds how the cleanup worker adapts to the table. Equal
+// intervals fix the cadence
+type CleanupSchedule struct {
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	// MaxBatchSize caps the rows deleted by one statement
+	MaxBatchSize int
+	// MaxBloatPct is the share of dead rows above which the worker backs off
+	// to let autovacuum catch up, 0 to ignore bloat. Only Postgres reports it,
+	// InnoDB purges deleted rows by itself
+	MaxBloatPct float64
+}
+
 type CleanupWorker struct {
-	db *gorm.DB
+	db        *gorm.DB
+	gate      *db.WriteGate
+	runs      *RunRecorder
+	retention time.Duration
+	interval  time.Duration
+	schedule  CleanupSchedule
+	batchSize int
+	rules     []RetentionRule
+	sessions  *models.Sessions
 }
 
-func NewCleanupWorker(db *gorm.DB) *CleanupWorker {
+// tableStats are the live and dead rows of the prices table
+type tableStats struct {
+	Rows     int64
+	DeadRows int64
+}
+
+// NewCleanupWorker creates a worker that deletes prices older than retention,
+// first after interval. Without a schedule it keeps to interval, without
+// rules other series are kept forever
+func NewCleanupWorker(database *gorm.DB, gate *db.WriteGate, retention, interval time.Duration) *CleanupWorker {
 	return &CleanupWorker{
-		db: db,
+		db:        database,
+		gate:      gate,
+		runs:      NewRunRecorder(database),
+		retention: retention,
+		interval:  interval,
+		schedule: CleanupSchedule{
+			MinInterval:  interval,
+			MaxInterval:  interval,
+			MaxBatchSize: DEFAULT_CLEANUP_BATCH_SIZE,
+		},
+		batchSize: DEFAULT_CLEANUP_BATCH_SIZE,
 	}
 }
 
+// SetSchedule lets the worker adjust its interval and batch size within
+// schedule, from the table's row count, bloat and backlog
+func (cw *CleanupWorker) SetSchedule(schedule CleanupSchedule) {
+	cw.schedule = schedule
+	cw.interval = clampDuration(cw.interval, schedule.MinInterval, schedule.MaxInterval)
+	cw.batchSize = schedule.MaxBatchSize
+}
+
+// SetRules sets retention per coin and series. A rule overrides retention
+// for the rows it matches and any more specific rule overrides it in turn
+func (cw *CleanupWorker) SetRules(rules []RetentionRule) {
+	cw.rules = rules
+}
+
+// SetDownsampling rolls raw prices into hourly candles and the session bars of
+// sessions before they are deleted, so their history outlives them at a
+// coarser grain. Prices then expire by the hour
+func (cw *CleanupWorker) SetDownsampling(sessions *models.Sessions) {
+	cw.sessions = sessions
+}
+
 func (cw *CleanupWorker) Start(ctx context.Context) {
 	// Run immediately on start
-	cw.cleanup()
+	cw.Cleanup(ctx)
 
-	// Then run every hour (to keep data fresh)
-	ticker := time.NewTicker(1 * time.Hour)
-	defer ticker.Stop()
+	// Then again after an interval picked by the last run
+	timer := time.NewTimer(cw.interval)
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Cleanup worker shutting down...")
+			log.Info().Msg("Cleanup worker shutting down")
 			return
-		case <-ticker.C:
-			cw.cleanup()
+		case <-timer.C:
+			cw.Cleanup(ctx)
+			timer.Reset(cw.interval)
+		}
+	}
+}
+
+// Cleanup runs one pass, deleting what expired within the run budget
+func (cw *CleanupWorker) Cleanup(ctx context.Context) error {
+	// Hold off while a migration is running
+	cw.gate.Enter()
+	defer cw.gate.Leave()
+
+	log.Debug().Msg("Starting cleanup of expired rows")
+	startedAt := time.Now()
+
+	stats, err := cw.stats(ctx)
+	if err != nil {
+		// The schedule is left as is, the delete doesn't need the stats
+		log.Warn().Err(err).Msg("Cleanup could not read table stats")
+	}
+	metrics.CleanupTableRows.Set(float64(stats.Rows))
+	bloated := cw.bloated(stats)
+	if bloated {
+		cw.batchSize = max(cw.batchSize/2, MIN_CLEANUP_BATCH_SIZE)
+	}
+
+	// Delete rows past their retention, raw prices first as the schedule
+	// follows them
+	rules := cw.allRules()
+	var rows, rolled int64
+	backlog := false
+	for _, rule := range rules {
+		if rule.Keep <= 0 {
+			continue
+		}
+		cutoff := time.Now().Add(-rule.Keep)
+		if rule.Table == RETENTION_PRICES && cw.sessions != nil {
+			// Whole hours are rolled up and deleted together
+			var rolledTo time.Time
+			var written int64
+			rolledTo, written, err = cw.downsample(ctx, rule, rules, cutoff.Truncate(time.Hour), startedAt)
+			rolled += written
+			if err != nil {
+				break
+			}
+			backlog = rolledTo.Before(cutoff.Truncate(time.Hour))
+			cutoff = rolledTo
+		}
+
+		var deleted int64
+		var expiring bool
+		deleted, expiring, err = cw.expire(ctx, rule, rules, cutoff, startedAt)
+		rows += deleted
+		backlog = backlog || expiring
+		if err != nil || backlog {
+			break
+		}
+	}
+
+	cw.runs.Record(WORKER_CLEANUP, startedAt, rows, err)
+	if err != nil {
+		log.Error().Err(err).Dur("duration", time.Since(startedAt)).Msg("Error during cleanup")
+		return err
+	}
+
+	cw.reschedule(stats, bloated, backlog)
+	metrics.CleanupIntervalSeconds.Set(cw.interval.Seconds())
+	metrics.CleanupBatchSize.Set(float64(cw.batchSize))
+
+	log.Info().Int64("rows", rows).Int64("candles", rolled).Int("rules", len(rules)).Bool("backlog", backlog).Int("batch_size", cw.batchSize).
+		Dur("next_in", cw.interval).Dur("duration", time.Since(startedAt)).Msg("Cleanup completed")
+	return nil
+}
+
+// allRules returns the rules behind the one for raw prices, followed by the
+// default retention of operational tables no rule covers
+func (cw *CleanupWorker) allRules() []RetentionRule {
+	rules := append([]RetentionRule{{Table: RETENTION_PRICES, Keep: cw.retention}}, cw.rules...)
+	for _, fallback := range DEFAULT_RETENTION {
+		covered := slices.ContainsFunc(cw.rules, func(rule RetentionRule) bool {
+			return rule.Table == fallback.Table && rule.Coin == ""
+		})
+		if !covered {
+			rules = append(rules, fallback)
+		}
+	}
+	return rules
+}
+
+// Expiring is how many rows a retention rule would delete
+type Expiring struct {
+	Rule   RetentionRule
+	Cutoff time.Time
+	Rows   int64
+}
+
+// DryRun counts the rows each rule would delete if a pass ran now, without
+// the run budget. Rules keeping rows forever are left out
+func (cw *CleanupWorker) DryRun(ctx context.Context) ([]Expiring, error) {
+	rules := cw.allRules()
+	var expiring []Expiring
+	for _, rule := range rules {
+		if rule.Keep <= 0 {
+			continue
+		}
+		cutoff := time.Now().Add(-rule.Keep)
+		if rule.Table == RETENTION_PRICES && cw.sessions != nil {
+			cutoff = cutoff.Truncate(time.Hour)
+		}
+
+		table := retentionTables[rule.Table]
+		var rows int64
+		err := cw.db.WithContext(ctx).Unscoped().Model(table.model()).Where(table.timeColumn+" < ?", cutoff).
+			Scopes(rule.scope(rules)).Count(&rows).Error
+		if err != nil {
+			return expiring, err
+		}
+		expiring = append(expiring, Expiring{Rule: rule, Cutoff: cutoff, Rows: rows})
+	}
+	return expiring, nil
+}
+
+// expire deletes the rows rule applies to that are older than cutoff, a
+// batch at a time. It reports a backlog when the run started at startedAt
+// is out of budget before they are all gone
+func (cw *CleanupWorker) expire(ctx context.Context, rule RetentionRule, rules []RetentionRule, cutoff, startedAt time.Time) (int64, bool, error) {
+	table := retentionTables[rule.Table]
+
+	var rows int64
+	for {
+		batchStartedAt := time.Now()
+		// The batch is wrapped in a derived table, MySQL refuses a LIMIT
+		// directly in IN or a subquery on the table being updated. Unscoped
+		// so expired rows are deleted for good, soft-deleted ones included
+		batch := cw.db.Unscoped().Model(table.model()).Select("id").Where(table.timeColumn+" < ?", cutoff).
+			Scopes(rule.scope(rules)).Limit(cw.batchSize)
+		result := cw.db.WithContext(ctx).Unscoped().
+			Where("id IN (?)", cw.db.Table("(?) AS batch", batch).Select("id")).
+			Delete(table.model())
+		if result.Error != nil {
+			return rows, false, result.Error
+		}
+		rows += result.RowsAffected
+		metrics.RowsCleanedTotal.WithLabelValues(rule.Table).Add(float64(result.RowsAffected))
+
+		if result.RowsAffected < int64(cw.batchSize) {
+			return rows, false, nil
+		}
+		cw.resize(time.Since(batchStartedAt))
+		if time.Since(startedAt) >= CLEANUP_RUN_BUDGET || ctx.Err() != nil {
+			return rows, true, nil
 		}
 	}
 }
 
-func (cw *CleanupWorker) cleanup() {
-	log.Println("Starting cleanup of old coin prices...")
+// stats reads the row counts of the prices table. Postgres keeps estimates
+// including dead rows and MySQL estimates live rows, SQLite is counted.
+// Soft-deleted rows are no longer read, so they count as dead rather than live
+func (cw *CleanupWorker) stats(ctx context.Context) (tableStats, error) {
+	var stats tableStats
+	var deleted int64
+	err := cw.db.WithContext(ctx).Unscoped().Model(&models.CoinPrice{}).Where("deleted_at IS NOT NULL").Count(&deleted).Error
+	if err != nil {
+		return stats, err
+	}
 
-	// Delete records older than 2 days
-	cutoff := time.Now().AddDate(0, 0, -2)
-	
-	result := cw.db.Where("created_at < ?", cutoff).Delete(&models.CoinPrice{})
-	if result.Error != nil {
-		log.Printf("Error during cleanup: %v", result.Error)
-		return
+	table := models.CoinPrice{}.TableName()
+	switch {
+	case db.IsPostgres(cw.db):
+		err = cw.db.WithContext(ctx).
+			Raw("SELECT n_live_tup AS rows, n_dead_tup AS dead_rows FROM pg_stat_user_tables WHERE relname = ?", table).
+			Scan(&stats).Error
+		// The estimates count soft-deleted rows as live
+		stats.Rows = max(stats.Rows-deleted, 0)
+	case db.IsMySQL(cw.db):
+		err = cw.db.WithContext(ctx).
+			Raw("SELECT table_rows AS `rows` FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", table).
+			Scan(&stats).Error
+		stats.Rows = max(stats.Rows-deleted, 0)
+	default:
+		err = cw.db.WithContext(ctx).Unscoped().Model(&models.CoinPrice{}).Where("deleted_at IS NULL").Count(&stats.Rows).Error
 	}
+	stats.DeadRows += deleted
+	return stats, err
+}
 
-	log.Printf("Cleanup completed. Deleted %d records older than %s", result.RowsAffected, cutoff.Format(time.RFC3339))
+// bloated reports whether dead rows make up more of the table than allowed
+func (cw *CleanupWorker) bloated(stats tableStats) bool {
+	total := stats.Rows + stats.DeadRows
+	if cw.schedule.MaxBloatPct <= 0 || total == 0 {
+		return false
+	}
+	return float64(stats.DeadRows)/float64(total)*100 > cw.schedule.MaxBloatPct
 }
 
+// resize grows the batch while deletes are quick and shrinks it while slow
+func (cw *CleanupWorker) resize(took time.Duration) {
+	switch {
+	case took < CLEANUP_BATCH_TARGET/2:
+		cw.batchSize = min(cw.batchSize*2, cw.schedule.MaxBatchSize)
+	case took > CLEANUP_BATCH_TARGET:
+		cw.batchSize = max(cw.batchSize/2, MIN_CLEANUP_BATCH_SIZE)
+	}
+}
+
+// reschedule picks the next interval. A backlog runs again soon and bloat
+// backs off. Otherwise the interval is the time it takes about one batch of
+// rows to expire, which in a steady state is rows/retention per second
+func (cw *CleanupWorker) reschedule(stats tableStats, bloated, backlog bool) {
+	next := cw.interval
+	switch {
+	case backlog:
+		next = cw.schedule.MinInterval
+	case bloated:
+		next = cw.interval * 2
+	case stats.Rows > 0:
+		next = time.Duration(float64(cw.retention) * float64(cw.batchSize) / float64(stats.Rows))
+		// Move gradually so one odd count doesn't swing the cadence
+		next = clampDuration(next, cw.interval/2, cw.interval*2)
+	}
+	cw.interval = clampDuration(next, cw.schedule.MinInterval, cw.schedule.MaxInterval)
+}
+
+func clampDuration(d, lo, hi time.Duration) time.Duration {
+	return min(max(d, lo), hi)
+}
@@ -0,0 +1,157 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/notblessy/dexlite/models"
+)
+
+// DOWNSAMPLE_WINDOW is how much raw history is rolled up per query
+const DOWNSAMPLE_WINDOW = 24 * time.Hour
+
+// downsample rolls the raw prices rule is about to expire into hourly candles
+// and their session bars, a window at a time from the oldest. It returns the
+// time up to which prices are rolled up and may be deleted, which falls
+// short of cutoff when the run runs out of budget
+//
+// A candle is only replaced by one built from more rows, so buckets the
+// candle builder already covered, or whose rows an earlier run partly
+// deleted, keep what they have
+func (cw *CleanupWorker) downsample(ctx context.Context, rule RetentionRule, rules []RetentionRule, cutoff, startedAt time.Time) (time.Time, int64, error) {
+	// The oldest row rather than MIN, which SQLite returns as text
+	var oldest models.CoinPrice
+	result := cw.db.WithContext(ctx).
+		Select("created_at").
+		Where("created_at < ?", cutoff).
+		Scopes(rule.scope(rules)).
+		Order("created_at ASC").
+		Limit(1).
+		Find(&oldest)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return cutoff, 0, result.Error
+	}
+
+	var rows int64
+	for from := oldest.CreatedAt.Truncate(time.Hour); from.Before(cutoff); from = from.Add(DOWNSAMPLE_WINDOW) {
+		if time.Since(startedAt) >= CLEANUP_RUN_BUDGET || ctx.Err() != nil {
+			return from, rows, nil
+		}
+
+		to := from.Add(DOWNSAMPLE_WINDOW)
+		if to.After(cutoff) {
+			to = cutoff
+		}
+		var prices []models.CoinPrice
+		err := cw.db.WithContext(ctx).
+			Where("created_at >= ? AND created_at < ?", from, to).
+			Scopes(rule.scope(rules)).
+			Order("created_at ASC").
+			Find(&prices).Error
+		if err != nil {
+			return from, rows, err
+		}
+
+		hourly, err := cw.fuller(ctx, rollPrices(prices, SESSION_SOURCE_INTERVAL, time.Hour))
+		if err != nil {
+			return from, rows, err
+		}
+		written, err := cw.storeRollup(ctx, hourly)
+		rows += written
+		if err != nil {
+			return from, rows, err
+		}
+	}
+	return cutoff, rows, nil
+}
+
+// storeRollup stores hourly candles rolled from raw prices, then rebuilds the
+// session bars they fall in
+func (cw *CleanupWorker) storeRollup(ctx context.Context, hourly []models.CoinCandle) (int64, error) {
+	if len(hourly) == 0 {
+		return 0, nil
+	}
+	rows, err := upsertCandles(cw.db.WithContext(ctx), hourly)
+	if err != nil {
+		return rows, err
+	}
+
+	for name := range models.SESSION_INTERVALS {
+		seen := make(map[candleKey]bool)
+		for _, candle := range hourly {
+			key := candleKey{
+				coin:     candle.Coin,
+				exchange: candle.Exchange,
+				openTime: cw.sessions.Start(name, candle.OpenTime),
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			var candles []models.CoinCandle
+			err := cw.db.WithContext(ctx).
+				Where("coin = ? AND exchange = ? AND resolution = ?", key.coin, key.exchange, SESSION_SOURCE_INTERVAL).
+				Where("open_time >= ? AND open_time < ?", key.openTime, cw.sessions.End(name, key.openTime)).
+				Order("open_time ASC").
+				Find(&candles).Error
+			if err != nil {
+				return rows, err
+			}
+
+			bars, err := cw.fuller(ctx, rollSessions(candles, name, cw.sessions))
+			if err != nil {
+				return rows, err
+			}
+			if len(bars) > 0 {
+				written, err := upsertCandles(cw.db.WithContext(ctx), bars)
+				rows += written
+				if err != nil {
+					return rows, err
+				}
+			}
+		}
+	}
+	return rows, nil
+}
+
+// fuller keeps the candles built from more rows than the stored candle of
+// their bucket, or with none stored. The candles share one interval
+func (cw *CleanupWorker) fuller(ctx context.Context, candles []models.CoinCandle) ([]models.CoinCandle, error) {
+	if len(candles) == 0 {
+		return nil, nil
+	}
+
+	from, to := candles[0].OpenTime, candles[0].OpenTime
+	for _, candle := range candles {
+		if candle.OpenTime.Before(from) {
+			from = candle.OpenTime
+		}
+		if candle.OpenTime.After(to) {
+			to = candle.OpenTime
+		}
+	}
+
+	var stored []models.CoinCandle
+	err := cw.db.WithContext(ctx).
+		Select("coin", "exchange", "open_time", "count").
+		Where("resolution = ? AND open_time >= ? AND open_time <= ?", candles[0].Interval, from, to).
+		Find(&stored).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[candleKey]int64, len(stored))
+	for _, candle := range stored {
+		counts[candleKey{coin: candle.Coin, exchange: candle.Exchange, openTime: candle.OpenTime.UTC()}] = candle.Count
+	}
+
+	kept := candles[:0]
+	for _, candle := range candles {
+		count, ok := counts[candleKey{coin: candle.Coin, exchange: candle.Exchange, openTime: candle.OpenTime.UTC()}]
+		if !ok || candle.Count > count {
+			kept = append(kept, candle)
+		}
+	}
+	return kept, nil
+}
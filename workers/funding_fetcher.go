@@ -0,0 +1,147 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/services"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// Hyperliquid settles funding hourly, polling more often only repeats rates
+const DEFAULT_FUNDING_INTERVAL = 1 * time.Hour
+
+// FundingFetcher stores the funding rate of every tracked coin on each venue
+// in the registry that reports funding
+type FundingFetcher struct {
+	db       *gorm.DB
+	gate     *db.WriteGate
+	runs     *RunRecorder
+	registry *services.Registry
+	coins    func() []string
+	interval time.Duration
+
+	// changed is closed and replaced whenever rates are stored
+	mu      sync.Mutex
+	changed chan struct{}
+}
+
+// NewFundingFetcher creates a fetcher that runs every interval over the coins
+// returned by coins
+func NewFundingFetcher(database *gorm.DB, gate *db.WriteGate, registry *services.Registry, coins func() []string, interval time.Duration) *FundingFetcher {
+	if interval <= 0 {
+		interval = DEFAULT_FUNDING_INTERVAL
+	}
+
+	return &FundingFetcher{
+		db:       database,
+		gate:     gate,
+		runs:     NewRunRecorder(database),
+		registry: registry,
+		coins:    coins,
+		interval: interval,
+		changed:  make(chan struct{}),
+	}
+}
+
+func (ff *FundingFetcher) Start(ctx context.Context) {
+	// Run immediately on start
+	ff.FetchFunding()
+
+	ticker := time.NewTicker(ff.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Funding fetcher shutting down")
+			return
+		case <-ticker.C:
+			ff.FetchFunding()
+		}
+	}
+}
+
+// Changed returns a channel that is closed the next time rates are stored.
+// Take it before reading so a write in between isn't missed
+func (ff *FundingFetcher) Changed() <-chan struct{} {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	return ff.changed
+}
+
+// FetchFunding runs one pass over the funding sources
+func (ff *FundingFetcher) FetchFunding() {
+	startedAt := time.Now()
+	coins := ff.coins()
+
+	var rows int64
+	var errs []error
+	for _, source := range ff.registry.Sources() {
+		funding, ok := source.(services.FundingSource)
+		if !ok {
+			continue
+		}
+
+		stored, err := ff.fetch(source.Name(), funding, coins, startedAt)
+		rows += stored
+		if err != nil {
+			log.Error().Err(err).Str("exchange", source.Name()).Msg("Error fetching funding rates")
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name(), err))
+		}
+	}
+
+	if rows > 0 {
+		ff.notify()
+	}
+	ff.gate.Enter()
+	ff.runs.Record(WORKER_FUNDING_FETCHER, startedAt, rows, errors.Join(errs...))
+	ff.gate.Leave()
+}
+
+// fetch stores the rates one source returned, keeping whatever came back when
+// some coins failed
+func (ff *FundingFetcher) fetch(exchange string, source services.FundingSource, coins []string, now time.Time) (int64, error) {
+	rates, fetchErr := source.GetFundingRates(coins)
+	if len(rates) == 0 {
+		return 0, fetchErr
+	}
+
+	rows := make([]models.FundingRate, 0, len(rates))
+	for coin, funding := range rates {
+		rows = append(rows, models.FundingRate{
+			Coin:          coin,
+			Exchange:      exchange,
+			Rate:          funding.Rate,
+			Premium:       funding.Premium,
+			IntervalHours: funding.Interval.Hours(),
+			CreatedAt:     now,
+		})
+	}
+
+	// Hold off while a migration is running, the rates are fetched outside
+	// the gate
+	ff.gate.Enter()
+	defer ff.gate.Leave()
+
+	if err := ff.db.Create(&rows).Error; err != nil {
+		return 0, errors.Join(fetchErr, fmt.Errorf("failed to store funding rates: %w", err))
+	}
+
+	log.Info().Str("exchange", exchange).Int("coins", len(rows)).Msg("Stored funding rates")
+	return int64(len(rows)), fetchErr
+}
+
+// notify wakes everyone waiting on Changed
+func (ff *FundingFetcher) notify() {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	close(ff.changed)
+	ff.changed = make(chan struct{})
+}
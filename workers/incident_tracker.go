@@ -0,0 +1,125 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/services"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IncidentTracker copies the incidents exchanges post on their status pages
+// into venue_incidents, so gaps in their series can be put down to the venue
+type IncidentTracker struct {
+	db       *gorm.DB
+	gate     *db.WriteGate
+	runs     *RunRecorder
+	client   *services.StatuspageClient
+	pages    map[string]string
+	interval time.Duration
+}
+
+// NewIncidentTracker creates a tracker polling pages, status page URLs by
+// exchange, every interval
+func NewIncidentTracker(database *gorm.DB, gate *db.WriteGate, client *services.StatuspageClient, pages map[string]string, interval time.Duration) *IncidentTracker {
+	return &IncidentTracker{
+		db:       database,
+		gate:     gate,
+		runs:     NewRunRecorder(database),
+		client:   client,
+		pages:    pages,
+		interval: interval,
+	}
+}
+
+func (it *IncidentTracker) Start(ctx context.Context) {
+	// Run immediately on start
+	it.Track()
+
+	ticker := time.NewTicker(it.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Incident tracker shutting down")
+			return
+		case <-ticker.C:
+			it.Track()
+		}
+	}
+}
+
+// Track reads every status page once and stores new incidents and changes to
+// known ones
+func (it *IncidentTracker) Track() {
+	startedAt := time.Now()
+
+	exchanges := make([]string, 0, len(it.pages))
+	for exchange := range it.pages {
+		exchanges = append(exchanges, exchange)
+	}
+	sort.Strings(exchanges)
+
+	var rows int64
+	var errs []error
+	for _, exchange := range exchanges {
+		stored, err := it.track(exchange, it.pages[exchange])
+		rows += stored
+		if err != nil {
+			log.Warn().Err(err).Str("exchange", exchange).Msg("Error reading status page")
+			errs = append(errs, fmt.Errorf("%s: %w", exchange, err))
+		}
+	}
+
+	it.gate.Enter()
+	it.runs.Record(WORKER_INCIDENT_TRACKER, startedAt, rows, errors.Join(errs...))
+	it.gate.Leave()
+}
+
+// track upserts the incidents on one exchange's status page
+func (it *IncidentTracker) track(exchange, pageURL string) (int64, error) {
+	incidents, err := it.client.Incidents(pageURL)
+	if err != nil || len(incidents) == 0 {
+		return 0, err
+	}
+
+	rows := make([]models.VenueIncident, len(incidents))
+	for i, incident := range incidents {
+		startedAt := incident.CreatedAt
+		if incident.StartedAt != nil {
+			startedAt = *incident.StartedAt
+		}
+		rows[i] = models.VenueIncident{
+			Exchange:   exchange,
+			IncidentID: incident.ID,
+			Name:       incident.Name,
+			Status:     incident.Status,
+			Impact:     incident.Impact,
+			URL:        incident.Shortlink,
+			StartedAt:  startedAt,
+			ResolvedAt: incident.ResolvedAt,
+		}
+	}
+
+	// Hold off while a migration is running, the page is read outside the
+	// gate
+	it.gate.Enter()
+	defer it.gate.Leave()
+
+	result := it.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "exchange"}, {Name: "incident_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "status", "impact", "url", "started_at", "resolved_at", "updated_at"}),
+	}).Create(&rows)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to store incidents: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
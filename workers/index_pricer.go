@@ -0,0 +1,140 @@
+package workers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/notblessy/dexlite/metrics"
+	"github.com/notblessy/dexlite/models"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+const (
+	DEFAULT_INDEX_QUORUM  = 2
+	DEFAULT_INDEX_MAX_AGE = 2 * time.Hour
+)
+
+// IndexPricer stores a composite index price per coin, the median of every
+// venue's latest price no older than maxAge. When fewer than quorum venues are
+// fresh the index is stored marked degraded rather than passed off as a
+// consensus of one venue
+type IndexPricer struct {
+	db     *gorm.DB
+	quorum int
+	maxAge time.Duration
+
+	// Whether each coin's last index was degraded, so transitions are logged once
+	degraded map[string]bool
+}
+
+func NewIndexPricer(database *gorm.DB, quorum int, maxAge time.Duration) *IndexPricer {
+	if quorum < 1 {
+		quorum = DEFAULT_INDEX_QUORUM
+	}
+	if maxAge <= 0 {
+		maxAge = DEFAULT_INDEX_MAX_AGE
+	}
+
+	return &IndexPricer{
+		db:       database,
+		quorum:   quorum,
+		maxAge:   maxAge,
+		degraded: make(map[string]bool),
+	}
+}
+
+// Update computes and stores the index of every coin, returning the number of
+// rows written. Coins without any fresh price get no index
+func (ip *IndexPricer) Update(coins []string) (int64, error) {
+	now := time.Now()
+
+	var rows int64
+	var errs []error
+	for _, coin := range coins {
+		stored, err := ip.update(coin, now)
+		if err != nil {
+			log.Error().Err(err).Str("coin", coin).Msg("Error computing index price")
+			errs = append(errs, fmt.Errorf("index %s: %w", coin, err))
+			continue
+		}
+		if stored {
+			rows++
+		}
+	}
+
+	return rows, errors.Join(errs...)
+}
+
+// update stores the index for one coin and reports whether a row was written
+func (ip *IndexPricer) update(coin string, now time.Time) (bool, error) {
+	latest, err := latestPrices(ip.db, coin, ip.maxAge)
+	if err != nil {
+		return false, err
+	}
+
+	metrics.IndexSources.WithLabelValues(coin).Set(float64(len(latest)))
+	if len(latest) == 0 {
+		metrics.IndexDegraded.WithLabelValues(coin).Set(1)
+		ip.transition(coin, true, 0)
+		return false, nil
+	}
+
+	components := make(models.VenuePrices, len(latest))
+	prices := make([]float64, len(latest))
+	for i, price := range latest {
+		components[price.Exchange] = price.Price
+		prices[i] = price.Price
+	}
+
+	index := models.IndexPrice{
+		Coin:       coin,
+		Price:      medianPrice(prices),
+		Sources:    len(latest),
+		Quorum:     ip.quorum,
+		Degraded:   len(latest) < ip.quorum,
+		Components: components,
+		CreatedAt:  now,
+	}
+	if err := ip.db.Create(&index).Error; err != nil {
+		return false, err
+	}
+
+	if index.Degraded {
+		metrics.IndexDegraded.WithLabelValues(coin).Set(1)
+	} else {
+		metrics.IndexDegraded.WithLabelValues(coin).Set(0)
+	}
+	ip.transition(coin, index.Degraded, index.Sources)
+
+	return true, nil
+}
+
+// transition logs when a coin's index loses or regains quorum
+func (ip *IndexPricer) transition(coin string, degraded bool, sources int) {
+	was, seen := ip.degraded[coin]
+	ip.degraded[coin] = degraded
+	if seen && was == degraded || !seen && !degraded {
+		return
+	}
+
+	if degraded {
+		log.Warn().Str("coin", coin).Int("sources", sources).Int("quorum", ip.quorum).Msg("Index price degraded, quorum of fresh sources not met")
+	} else {
+		log.Info().Str("coin", coin).Int("sources", sources).Msg("Index price quorum restored")
+	}
+}
+
+// medianPrice returns the middle of prices, which must not be empty
+func medianPrice(prices []float64) float64 {
+	sorted := slices.Clone(prices)
+	slices.Sort(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
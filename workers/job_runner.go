@@ -0,0 +1,357 @@
+package workers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/notblessy/dexlite/access"
+	"github.com/notblessy/dexlite/analytics"
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/metrics"
+	"github.com/notblessy/dexlite/models"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DEFAULT_JOB_WORKERS       = 2
+	DEFAULT_JOB_TIMEOUT       = 10 * time.Minute
+	DEFAULT_JOB_RESULT_TTL    = 1 * time.Hour
+	DEFAULT_JOB_POLL_INTERVAL = 2 * time.Second
+)
+
+// ErrUnknownJobKind is returned for a job kind nothing is registered for
+var ErrUnknownJobKind = errors.New("unknown job kind")
+
+// JobKind runs one kind of job. Validate checks the params of a new job so
+// bad requests are turned away before being queued, and may rewrite them, e.g.
+// to fill in defaults. Run computes the result
+type JobKind struct {
+	Validate func(params []byte) ([]byte, error)
+	Run      func(ctx context.Context, params []byte) (any, error)
+}
+
+// JobRunner runs queued jobs in the background, a few at a time. Jobs live in
+// the database, so any instance can pick one up and any can answer a poll.
+// Results are kept for resultTTL and then deleted
+type JobRunner struct {
+	db           *gorm.DB
+	gate         *db.WriteGate
+	kinds        map[string]JobKind
+	timeout      time.Duration
+	resultTTL    time.Duration
+	pollInterval time.Duration
+
+	// slots holds a token per job being run
+	slots chan struct{}
+	wake  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewJobRunner creates a runner running up to workers jobs at once, each for
+// at most timeout, and checking for new jobs every pollInterval
+func NewJobRunner(database *gorm.DB, gate *db.WriteGate, workers int, timeout, resultTTL, pollInterval time.Duration) *JobRunner {
+	if workers < 1 {
+		workers = DEFAULT_JOB_WORKERS
+	}
+	if timeout <= 0 {
+		timeout = DEFAULT_JOB_TIMEOUT
+	}
+	if resultTTL <= 0 {
+		resultTTL = DEFAULT_JOB_RESULT_TTL
+	}
+	if pollInterval <= 0 {
+		pollInterval = DEFAULT_JOB_POLL_INTERVAL
+	}
+
+	return &JobRunner{
+		db:           database,
+		gate:         gate,
+		kinds:        make(map[string]JobKind),
+		timeout:      timeout,
+		resultTTL:    resultTTL,
+		pollInterval: pollInterval,
+		slots:        make(chan struct{}, workers),
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Register makes a kind of job available. Call it before Start
+func (jr *JobRunner) Register(kind string, job JobKind) {
+	jr.kinds[kind] = job
+}
+
+// Kinds returns the registered job kinds, sorted
+func (jr *JobRunner) Kinds() []string {
+	kinds := make([]string, 0, len(jr.kinds))
+	for kind := range jr.kinds {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+	return kinds
+}
+
+// ResultTTL returns how long finished jobs are kept
+func (jr *JobRunner) ResultTTL() time.Duration {
+	return jr.resultTTL
+}
+
+// Validate checks params for a job of kind and returns them as they will be
+// stored
+func (jr *JobRunner) Validate(kind string, params []byte) ([]byte, error) {
+	job, ok := jr.kinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownJobKind, kind)
+	}
+	return job.Validate(params)
+}
+
+// Submit queues a job with validated params and returns it. The job only
+// reads the coins ctx is scoped to
+func (jr *JobRunner) Submit(ctx context.Context, kind string, params []byte) (models.Job, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return models.Job{}, err
+	}
+
+	job := models.Job{
+		ID:     hex.EncodeToString(id),
+		Kind:   kind,
+		Status: models.JOB_PENDING,
+		Params: params,
+	}
+	if scope, ok := access.ScopeFrom(ctx); ok {
+		encoded, err := json.Marshal(scope.Coins())
+		if err != nil {
+			return models.Job{}, err
+		}
+		job.Scope = encoded
+	}
+	if err := jr.db.WithContext(ctx).Create(&job).Error; err != nil {
+		return models.Job{}, err
+	}
+
+	select {
+	case jr.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+func (jr *JobRunner) Start(ctx context.Context) {
+	ticker := time.NewTicker(jr.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Running jobs see the cancellation and are put back in the queue
+			jr.wg.Wait()
+			log.Info().Msg("Job runner shutting down")
+			return
+		case <-ticker.C:
+			jr.expire()
+		case <-jr.wake:
+		}
+		jr.dispatch(ctx)
+	}
+}
+
+// dispatch claims pending jobs while there are free slots
+func (jr *JobRunner) dispatch(ctx context.Context) {
+	for {
+		select {
+		case jr.slots <- struct{}{}:
+		default:
+			return
+		}
+
+		job, err := jr.claim()
+		if err != nil || job == nil {
+			<-jr.slots
+			if err != nil {
+				log.Error().Err(err).Msg("Error claiming job")
+			}
+			return
+		}
+
+		jr.wg.Add(1)
+		go func() {
+			defer jr.wg.Done()
+			jr.run(ctx, *job)
+			<-jr.slots
+			// A slot is free, look for the next job right away
+			select {
+			case jr.wake <- struct{}{}:
+			default:
+			}
+		}()
+	}
+}
+
+// claim marks the oldest pending job running and returns it, nil when none
+// is pending. Locked rows are skipped so instances don't claim the same job
+func (jr *JobRunner) claim() (*models.Job, error) {
+	jr.gate.Enter()
+	defer jr.gate.Leave()
+
+	var job models.Job
+	err := jr.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", models.JOB_PENDING).
+			Order("created_at ASC").
+			Take(&job).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		job.Status = models.JOB_RUNNING
+		job.StartedAt = &now
+		return tx.Model(&job).Updates(map[string]interface{}{
+			"status":     job.Status,
+			"started_at": now,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// run computes a claimed job and stores its outcome
+func (jr *JobRunner) run(ctx context.Context, job models.Job) {
+	runCtx, cancel := context.WithTimeout(ctx, jr.timeout)
+	defer cancel()
+	if job.Scope != nil {
+		var coins []string
+		if err := json.Unmarshal(job.Scope, &coins); err != nil {
+			log.Error().Err(err).Str("job", job.ID).Msg("Invalid job scope, running with no coins")
+		}
+		runCtx = access.WithScope(runCtx, access.NewScope(coins...))
+	}
+
+	startedAt := time.Now()
+	result, err := jr.compute(runCtx, job)
+
+	jr.gate.Enter()
+	defer jr.gate.Leave()
+
+	if ctx.Err() != nil {
+		// Shutting down, leave the job to the next instance to start
+		err := jr.db.Model(&job).Updates(map[string]interface{}{
+			"status":     models.JOB_PENDING,
+			"started_at": nil,
+		}).Error
+		if err != nil {
+			log.Error().Err(err).Str("job", job.ID).Msg("Error requeueing interrupted job")
+		}
+		return
+	}
+
+	finishedAt := time.Now()
+	updates := map[string]interface{}{
+		"status":      models.JOB_SUCCEEDED,
+		"finished_at": finishedAt,
+		"expires_at":  finishedAt.Add(jr.resultTTL),
+	}
+	if err == nil {
+		var encoded []byte
+		if encoded, err = json.Marshal(result); err == nil {
+			updates["result"] = models.RawJSON(encoded)
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", jr.timeout)
+	}
+	if err != nil {
+		updates["status"] = models.JOB_FAILED
+		updates["error"] = err.Error()
+	}
+
+	if err := jr.db.Model(&job).Updates(updates).Error; err != nil {
+		log.Error().Err(err).Str("job", job.ID).Msg("Error storing job result")
+		return
+	}
+
+	metrics.JobsTotal.WithLabelValues(job.Kind, updates["status"].(string)).Inc()
+	log.Info().Str("job", job.ID).Str("kind", job.Kind).Str("status", updates["status"].(string)).Dur("duration", time.Since(startedAt)).Msg("Job finished")
+}
+
+// compute runs the job's kind, turning a panic into a failure so one bad
+// job doesn't take the service down
+func (jr *JobRunner) compute(ctx context.Context, job models.Job) (result any, err error) {
+	kind, ok := jr.kinds[job.Kind]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownJobKind, job.Kind)
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("job panicked: %v", recovered)
+		}
+	}()
+	return kind.Run(ctx, job.Params)
+}
+
+// expire deletes jobs past their expiry and fails jobs left running by an
+// instance that went away
+func (jr *JobRunner) expire() {
+	jr.gate.Enter()
+	defer jr.gate.Leave()
+
+	now := time.Now()
+	if err := jr.db.Where("expires_at < ?", now).Delete(&models.Job{}).Error; err != nil {
+		log.Error().Err(err).Msg("Error deleting expired jobs")
+	}
+
+	// Give a live runner a poll interval past the timeout to record the job
+	abandoned := jr.db.Model(&models.Job{}).
+		Where("status = ? AND started_at < ?", models.JOB_RUNNING, now.Add(-jr.timeout-jr.pollInterval)).
+		Updates(map[string]interface{}{
+			"status":      models.JOB_FAILED,
+			"error":       "abandoned by the instance running it",
+			"finished_at": now,
+			"expires_at":  now.Add(jr.resultTTL),
+		})
+	if abandoned.Error != nil {
+		log.Error().Err(abandoned.Error).Msg("Error failing abandoned jobs")
+	} else if abandoned.RowsAffected > 0 {
+		log.Warn().Int64("jobs", abandoned.RowsAffected).Msg("Failed jobs abandoned while running")
+	}
+}
+
+// NewCorrelationJob correlates coins' returns over a window, by default the
+// last 30 days, far beyond what the synchronous API allows
+func NewCorrelationJob(database *gorm.DB) JobKind {
+	return JobKind{
+		Validate: func(params []byte) ([]byte, error) {
+			var correlation analytics.CorrelationParams
+			if err := json.Unmarshal(params, &correlation); err != nil {
+				return nil, fmt.Errorf("invalid correlation params: %w", err)
+			}
+			if err := correlation.Normalize(time.Now()); err != nil {
+				return nil, err
+			}
+			return json.Marshal(correlation)
+		},
+		Run: func(ctx context.Context, params []byte) (any, error) {
+			var correlation analytics.CorrelationParams
+			if err := json.Unmarshal(params, &correlation); err != nil {
+				return nil, err
+			}
+			return analytics.Correlation(ctx, database, correlation)
+		},
+	}
+}
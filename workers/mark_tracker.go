@@ -0,0 +1,118 @@
+package workers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/metrics"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/services"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+const DEFAULT_MARK_DIVERGENCE_BPS = 50
+
+// MarkTracker stores the mark and oracle price of every tracked coin on each
+// venue that reports them, and flags gaps of at least thresholdBps
+type MarkTracker struct {
+	db           *gorm.DB
+	gate         *db.WriteGate
+	registry     *services.Registry
+	thresholdBps float64
+	// alerts is told of every mark stored, nil when no evaluator is set
+	alerts *AlertEvaluator
+}
+
+func NewMarkTracker(database *gorm.DB, gate *db.WriteGate, registry *services.Registry, thresholdBps float64) *MarkTracker {
+	if thresholdBps <= 0 {
+		thresholdBps = DEFAULT_MARK_DIVERGENCE_BPS
+	}
+
+	return &MarkTracker{
+		db:           database,
+		gate:         gate,
+		registry:     registry,
+		thresholdBps: thresholdBps,
+	}
+}
+
+// SetAlertEvaluator checks mark divergence alerts against every mark stored
+// from now on
+func (mt *MarkTracker) SetAlertEvaluator(alerts *AlertEvaluator) {
+	mt.alerts = alerts
+}
+
+// Record fetches and stores marks for coins from every mark source, returning
+// the number of rows written
+func (mt *MarkTracker) Record(coins []string) (int64, error) {
+	now := time.Now()
+
+	var rows int64
+	var errs []error
+	for _, source := range mt.registry.Sources() {
+		marks, ok := source.(services.MarkSource)
+		if !ok {
+			continue
+		}
+
+		stored, err := mt.record(source.Name(), marks, coins, now)
+		rows += stored
+		if err != nil {
+			log.Error().Err(err).Str("exchange", source.Name()).Msg("Error recording mark prices")
+			errs = append(errs, fmt.Errorf("%s marks: %w", source.Name(), err))
+		}
+	}
+
+	return rows, errors.Join(errs...)
+}
+
+// record stores the marks one source returned, keeping whatever came back
+// when some coins failed
+func (mt *MarkTracker) record(exchange string, source services.MarkSource, coins []string, now time.Time) (int64, error) {
+	marks, fetchErr := source.GetMarkPrices(coins)
+	if len(marks) == 0 {
+		return 0, fetchErr
+	}
+
+	rows := make([]models.MarkPrice, 0, len(marks))
+	for coin, mark := range marks {
+		divergence := models.DivergenceBps(mark.Mark, mark.Oracle)
+		metrics.MarkDivergenceBps.WithLabelValues(coin, exchange).Set(divergence)
+
+		if math.Abs(divergence) >= mt.thresholdBps {
+			metrics.MarkDivergencesTotal.WithLabelValues(coin, exchange).Inc()
+			log.Warn().
+				Str("coin", coin).
+				Str("exchange", exchange).
+				Float64("mark", mark.Mark).
+				Float64("oracle", mark.Oracle).
+				Float64("divergence_bps", divergence).
+				Msg("Mark price diverged from oracle")
+		}
+
+		rows = append(rows, models.MarkPrice{
+			Coin:          coin,
+			Exchange:      exchange,
+			Mark:          mark.Mark,
+			Oracle:        mark.Oracle,
+			DivergenceBps: divergence,
+			CreatedAt:     now,
+		})
+	}
+
+	// Hold off while a migration is running
+	mt.gate.Enter()
+	defer mt.gate.Leave()
+
+	if err := mt.db.Create(&rows).Error; err != nil {
+		return 0, errors.Join(fetchErr, fmt.Errorf("failed to store mark prices: %w", err))
+	}
+	if mt.alerts != nil {
+		mt.alerts.ObserveMarks(rows)
+	}
+	return int64(len(rows)), fetchErr
+}
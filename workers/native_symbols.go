@@ -0,0 +1,97 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/notblessy/dexlite/services"
+	"github.com/rs/zerolog/log"
+)
+
+// NativeSymbols resolves the symbols exchanges list tracked coins under, such
+// as Binance's BTCUSDT or Hyperliquid's @107 spot index, to the coins. The
+// symbols are reloaded from every SymbolSource in the registry each interval
+type NativeSymbols struct {
+	registry *services.Registry
+	coins    func() []string
+	interval time.Duration
+
+	mu sync.RWMutex
+	// symbols holds each source's upper-cased symbols and their coin
+	symbols map[string]map[string]string
+}
+
+func NewNativeSymbols(registry *services.Registry, coins func() []string, interval time.Duration) *NativeSymbols {
+	return &NativeSymbols{
+		registry: registry,
+		coins:    coins,
+		interval: interval,
+		symbols:  make(map[string]map[string]string),
+	}
+}
+
+func (ns *NativeSymbols) Start(ctx context.Context) {
+	ticker := time.NewTicker(ns.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := ns.Refresh(); err != nil {
+			log.Warn().Err(err).Msg("Failed to load native symbols")
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Native symbol loader shutting down")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh reloads the symbols of every source. A source that fails keeps the
+// symbols it had
+func (ns *NativeSymbols) Refresh() error {
+	coins := ns.coins()
+
+	var errs []error
+	for _, source := range ns.registry.Sources() {
+		symbolSource, ok := source.(services.SymbolSource)
+		if !ok {
+			continue
+		}
+
+		natives, err := symbolSource.NativeSymbols(coins)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name(), err))
+			continue
+		}
+
+		symbols := make(map[string]string, len(natives))
+		for symbol, coin := range natives {
+			symbols[strings.ToUpper(symbol)] = coin
+		}
+		ns.mu.Lock()
+		ns.symbols[source.Name()] = symbols
+		ns.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// Resolve returns the coin symbol stands for on some exchange, ignoring case.
+// Sources are asked in priority order so the primary wins when two disagree
+func (ns *NativeSymbols) Resolve(symbol string) (string, bool) {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+	for _, source := range ns.registry.Sources() {
+		if coin, ok := ns.symbols[source.Name()][symbol]; ok {
+			return coin, true
+		}
+	}
+	return "", false
+}
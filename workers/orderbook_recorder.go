@@ -0,0 +1,139 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/services"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+const (
+	DEFAULT_ORDERBOOK_INTERVAL = 5 * time.Minute
+	DEFAULT_ORDERBOOK_LEVELS   = 20
+)
+
+// OrderbookRecorder snapshots the top levels of every tracked coin's book on
+// each venue in the registry that serves orderbooks
+type OrderbookRecorder struct {
+	db       *gorm.DB
+	gate     *db.WriteGate
+	runs     *RunRecorder
+	registry *services.Registry
+	coins    func() []string
+	levels   int
+	interval time.Duration
+}
+
+// NewOrderbookRecorder creates a recorder keeping levels levels per side that
+// runs every interval over the coins returned by coins
+func NewOrderbookRecorder(database *gorm.DB, gate *db.WriteGate, registry *services.Registry, coins func() []string, levels int, interval time.Duration) *OrderbookRecorder {
+	if levels <= 0 {
+		levels = DEFAULT_ORDERBOOK_LEVELS
+	}
+	if interval <= 0 {
+		interval = DEFAULT_ORDERBOOK_INTERVAL
+	}
+
+	return &OrderbookRecorder{
+		db:       database,
+		gate:     gate,
+		runs:     NewRunRecorder(database),
+		registry: registry,
+		coins:    coins,
+		levels:   levels,
+		interval: interval,
+	}
+}
+
+func (ob *OrderbookRecorder) Start(ctx context.Context) {
+	// Run immediately on start
+	ob.Snapshot()
+
+	ticker := time.NewTicker(ob.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Orderbook recorder shutting down")
+			return
+		case <-ticker.C:
+			ob.Snapshot()
+		}
+	}
+}
+
+// Snapshot runs one pass over the orderbook sources
+func (ob *OrderbookRecorder) Snapshot() {
+	startedAt := time.Now()
+	coins := ob.coins()
+
+	var snapshots []models.OrderbookSnapshot
+	var errs []error
+	for _, source := range ob.registry.Sources() {
+		books, ok := source.(services.OrderBookSource)
+		if !ok {
+			continue
+		}
+
+		for _, coin := range coins {
+			snapshot, err := ob.snapshot(source.Name(), books, coin, startedAt)
+			if err != nil {
+				log.Error().Err(err).Str("exchange", source.Name()).Str("coin", coin).Msg("Error fetching orderbook")
+				errs = append(errs, fmt.Errorf("%s %s: %w", source.Name(), coin, err))
+				continue
+			}
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+
+	// Hold off while a migration is running, the books are fetched outside
+	// the gate
+	ob.gate.Enter()
+	defer ob.gate.Leave()
+
+	var rows int64
+	if len(snapshots) > 0 {
+		if err := ob.db.Create(&snapshots).Error; err != nil {
+			errs = append(errs, fmt.Errorf("failed to store orderbook snapshots: %w", err))
+		} else {
+			rows = int64(len(snapshots))
+		}
+	}
+
+	ob.runs.Record(WORKER_ORDERBOOK_RECORDER, startedAt, rows, errors.Join(errs...))
+}
+
+// snapshot fetches one coin's book from source
+func (ob *OrderbookRecorder) snapshot(exchange string, source services.OrderBookSource, coin string, now time.Time) (models.OrderbookSnapshot, error) {
+	book, err := source.GetOrderBook(coin, ob.levels)
+	if err != nil {
+		return models.OrderbookSnapshot{}, err
+	}
+	if len(book.Bids) == 0 || len(book.Asks) == 0 {
+		return models.OrderbookSnapshot{}, errors.New("one side of the book is empty")
+	}
+
+	return models.OrderbookSnapshot{
+		Coin:      coin,
+		Exchange:  exchange,
+		Mid:       (book.Bids[0].Price + book.Asks[0].Price) / 2,
+		Bids:      bookLevels(book.Bids),
+		Asks:      bookLevels(book.Asks),
+		CreatedAt: now,
+	}, nil
+}
+
+func bookLevels(levels []services.BookLevel) models.BookLevels {
+	converted := make(models.BookLevels, len(levels))
+	for i, level := range levels {
+		converted[i] = models.BookLevel(level)
+	}
+	return converted
+}
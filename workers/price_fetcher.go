@@ -2,37 +2,138 @@ package workers
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/metrics"
 	"github.com/notblessy/dexlite/models"
 	"github.com/notblessy/dexlite/services"
+	"github.com/notblessy/dexlite/symbols"
+	"github.com/notblessy/dexlite/tracing"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 )
 
+const DEFAULT_FETCH_INTERVAL = 1 * time.Hour
+
+// The fetcher labels every stored price with the role of its source
+const (
+	LABEL_ROLE    = "role"
+	ROLE_PRIMARY  = "primary"
+	ROLE_FALLBACK = "fallback"
+)
+
+// DEFAULT_TRACKED_COINS is used when no coin list is configured
+var DEFAULT_TRACKED_COINS = []string{"BTC", "ETH", "SOL", "ARB", "AVAX"}
+
 type PriceFetcher struct {
-	db     *gorm.DB
-	client *services.HyperLiquidClient
-	coins  []string
+	db        *gorm.DB
+	registry  *services.Registry
+	coins     []string
+	anomalies *AnomalyDetector
+	clock     *services.ClockMonitor
+	breaker   *services.CircuitBreaker
+	bounds    *PriceBounds
+	index     *IndexPricer
+	marks     *MarkTracker
+	quality   *QualityScorer
+	sla       *SLATracker
+	runs      *RunRecorder
+	gate      *db.WriteGate
+	persister *db.Persister
+	interval  time.Duration
+	// maxWatched caps the watchlisted coins added to the tracked ones, zero
+	// adds none
+	maxWatched int
+
+	mu        sync.RWMutex
+	lastFetch time.Time
 }
 
-func NewPriceFetcher(db *gorm.DB) *PriceFetcher {
+// NewPriceFetcher creates a fetcher for coins that runs every interval. An empty
+// coin list or non-positive interval falls back to the defaults
+func NewPriceFetcher(database *gorm.DB, registry *services.Registry, gate *db.WriteGate, persister *db.Persister, coins []string, interval time.Duration) *PriceFetcher {
+	if len(coins) == 0 {
+		coins = DEFAULT_TRACKED_COINS
+	}
+	if interval <= 0 {
+		interval = DEFAULT_FETCH_INTERVAL
+	}
+
 	return &PriceFetcher{
-		db:     db,
-		client: services.NewHyperLiquidClient(),
-		coins:  []string{"BTC", "ETH", "SOL", "ARB", "AVAX"},
+		db:        database,
+		registry:  registry,
+		coins:     symbols.NormalizeAll(coins),
+		sla:       NewSLATracker(database),
+		runs:      NewRunRecorder(database),
+		gate:      gate,
+		persister: persister,
+		interval:  interval,
+		// Until SetMaxWatched every watchlisted coin is fetched
+		maxWatched: -1,
 	}
 }
 
+// SetAnomalyDetector enables anomaly reporting on every fetch cycle
+func (pf *PriceFetcher) SetAnomalyDetector(detector *AnomalyDetector) {
+	pf.anomalies = detector
+}
+
+// SetClockMonitor corrects venue-reported timestamps for each source's clock skew
+func (pf *PriceFetcher) SetClockMonitor(clock *services.ClockMonitor) {
+	pf.clock = clock
+}
+
+// SetCircuitBreaker skips sources whose breaker is open instead of waiting on
+// them every cycle
+func (pf *PriceFetcher) SetCircuitBreaker(breaker *services.CircuitBreaker) {
+	pf.breaker = breaker
+}
+
+// SetPriceBounds rejects implausible prices before they are stored. Without it
+// only non-finite and non-positive prices are rejected
+func (pf *PriceFetcher) SetPriceBounds(bounds *PriceBounds) {
+	pf.bounds = bounds
+}
+
+// SetIndexPricer stores a composite index price for every coin after each cycle
+func (pf *PriceFetcher) SetIndexPricer(index *IndexPricer) {
+	pf.index = index
+}
+
+// SetMarkTracker stores mark and oracle prices from perpetual venues after
+// each cycle
+func (pf *PriceFetcher) SetMarkTracker(marks *MarkTracker) {
+	pf.marks = marks
+}
+
+// SetQualityScorer scores every source on latency, uptime, staleness and
+// outliers after each cycle
+func (pf *PriceFetcher) SetQualityScorer(quality *QualityScorer) {
+	pf.quality = quality
+}
+
+// SetMaxWatched caps how many watchlisted coins are fetched on top of the
+// tracked ones, the most watched first, so user watchlists can't grow every
+// cycle without bound
+func (pf *PriceFetcher) SetMaxWatched(max int) {
+	pf.maxWatched = max
+}
+
 func (pf *PriceFetcher) Start(ctx context.Context) {
-	// Then run every hour
-	ticker := time.NewTicker(1 * time.Hour)
+	// Then run every interval
+	ticker := time.NewTicker(pf.interval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Price fetcher worker shutting down...")
+			log.Info().Msg("Price fetcher worker shutting down")
 			return
 		case <-ticker.C:
 			pf.FetchPrices()
@@ -40,33 +141,291 @@ func (pf *PriceFetcher) Start(ctx context.Context) {
 	}
 }
 
-// FetchPrices fetches and saves prices for all tracked coins
-func (pf *PriceFetcher) FetchPrices() {
-	pf.fetchPrices()
+// Coins returns the coins the fetcher tracked on its last cycle
+func (pf *PriceFetcher) Coins() []string {
+	pf.mu.RLock()
+	defer pf.mu.RUnlock()
+	return pf.coins
 }
 
-func (pf *PriceFetcher) fetchPrices() {
-	log.Println("Starting price fetch for tracked coins...")
+// loadCoins reads the tracked_coins table and every user's watchlist so coins
+// added or removed through the API apply on the next cycle. Watchlisted coins
+// are added most watched first up to the cap. The previous list is kept if the
+// tables can't be read or are empty
+func (pf *PriceFetcher) loadCoins() []string {
+	var tracked []string
+	if err := pf.db.Model(&models.TrackedCoin{}).Order("coin ASC").Pluck("coin", &tracked).Error; err != nil {
+		log.Error().Err(err).Msg("Error loading tracked coins, keeping previous list")
+		return pf.Coins()
+	}
 
-	for _, coin := range pf.coins {
-		price, err := pf.client.GetPrice(coin)
+	var watchlisted []string
+	query := pf.db.Model(&models.WatchlistCoin{}).
+		Where("coin NOT IN (?)", pf.db.Model(&models.TrackedCoin{}).Select("coin")).
+		Group("coin").
+		Order("COUNT(*) DESC, coin ASC")
+	if pf.maxWatched >= 0 {
+		// One past the cap tells whether any were dropped
+		query = query.Limit(pf.maxWatched + 1)
+	}
+	if err := query.Pluck("coin", &watchlisted).Error; err != nil {
+		log.Error().Err(err).Msg("Error loading watchlisted coins, keeping previous list")
+		return pf.Coins()
+	}
+	if pf.maxWatched >= 0 && len(watchlisted) > pf.maxWatched {
+		watchlisted = watchlisted[:pf.maxWatched]
+		log.Warn().Int("max", pf.maxWatched).Msg("Watchlisted coins past the cap are not fetched")
+	}
+
+	if len(tracked) == 0 && len(watchlisted) == 0 {
+		return pf.Coins()
+	}
+	coins := symbols.NormalizeAll(append(tracked, watchlisted...))
+
+	pf.mu.Lock()
+	pf.coins = coins
+	pf.mu.Unlock()
+
+	return coins
+}
+
+// Interval returns how often the fetcher runs
+func (pf *PriceFetcher) Interval() time.Duration {
+	return pf.interval
+}
+
+// LastFetchAt returns when the last fetch cycle completed, zero if none has
+func (pf *PriceFetcher) LastFetchAt() time.Time {
+	pf.mu.RLock()
+	defer pf.mu.RUnlock()
+	return pf.lastFetch
+}
+
+// FetchPrices fetches and saves prices for all tracked coins. The error joins
+// whatever went wrong, prices that could be fetched are saved regardless
+func (pf *PriceFetcher) FetchPrices() error {
+	startedAt := time.Now()
+	ctx, span := tracing.Tracer.Start(context.Background(), "fetch cycle")
+	rows, err := pf.fetchPrices(ctx)
+	span.SetAttributes(attribute.Int64("rows", rows))
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+
+	pf.gate.Enter()
+	pf.runs.Record(WORKER_PRICE_FETCHER, startedAt, rows, err)
+	pf.gate.Leave()
+
+	pf.mu.Lock()
+	pf.lastFetch = time.Now()
+	pf.mu.Unlock()
+
+	return err
+}
+
+// fetchPrices runs one cycle and returns the number of rows written along
+// with every error encountered
+func (pf *PriceFetcher) fetchPrices(ctx context.Context) (int64, error) {
+	log.Debug().Msg("Starting price fetch for tracked coins")
+	startedAt := time.Now()
+
+	coins := pf.loadCoins()
+
+	var rows int64
+	var errs []error
+
+	// Every price of the cycle is stored in one transaction at the end
+	var batch []models.CoinPrice
+
+	primary := pf.registry.Primary()
+	var missing []string
+
+	for _, source := range pf.registry.Sources() {
+		quotes, prices, err := pf.fetchFrom(ctx, source, coins, ROLE_PRIMARY)
+		batch = append(batch, prices...)
 		if err != nil {
-			log.Printf("Error fetching price for %s: %v", coin, err)
-			continue
+			errs = append(errs, err)
 		}
 
-		coinPrice := models.CoinPrice{
-			Coin:  coin,
-			Price: price,
+		if source == primary {
+			for _, coin := range coins {
+				if _, ok := quotes[coin]; !ok {
+					missing = append(missing, coin)
+				}
+			}
 		}
+	}
+
+	// Fill gaps left by the primary source so the history stays continuous
+	if fallback := pf.registry.Fallback(); fallback != nil && len(missing) > 0 {
+		log.Warn().Strs("coins", missing).Str("exchange", fallback.Name()).Msg("Primary source failed, using fallback")
+		_, prices, err := pf.fetchFrom(ctx, fallback, missing, ROLE_FALLBACK)
+		batch = append(batch, prices...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// Prices saved this cycle keyed by exchange then coin, left empty when
+	// the batch failed and was dead-lettered, and without the prices the
+	// database rejected
+	saved := make(map[string]map[string]float64)
+	fetchedAt := time.Now()
+	for i := range batch {
+		batch[i].CreatedAt = fetchedAt
+		batch[i].Bucket = fetchedAt.Truncate(pf.interval)
+	}
+
+	// Hold off while a migration is running. Only the writes hold the gate,
+	// so a slow venue doesn't hold up a migration
+	pf.gate.Enter()
+	err := pf.persister.SaveContext(ctx, batch)
+	if err != nil {
+		log.Error().Err(err).Int("prices", len(batch)).Msg("Error saving prices")
+		errs = append(errs, fmt.Errorf("saving %d prices: %w", len(batch), err))
+	}
+	if err == nil || errors.Is(err, db.ErrPricesRejected) {
+		for _, price := range batch {
+			// Rejected prices were dead-lettered without an ID
+			if price.ID == 0 {
+				continue
+			}
+			rows++
+			if saved[price.Exchange] == nil {
+				saved[price.Exchange] = make(map[string]float64)
+			}
+			saved[price.Exchange][price.Coin] = price.Price
+		}
+	}
+
+	if pf.index != nil {
+		written, err := pf.index.Update(coins)
+		rows += written
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if pf.quality != nil {
+		written, err := pf.quality.Record(saved, time.Now())
+		rows += written
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	pf.gate.Leave()
+
+	if pf.anomalies != nil {
+		pf.anomalies.Check(saved)
+	}
+
+	// Marks are fetched from the venues, the tracker holds the gate for its
+	// writes itself
+	if pf.marks != nil {
+		written, err := pf.marks.Record(coins)
+		rows += written
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	log.Info().Int64("rows", rows).Dur("duration", time.Since(startedAt)).Msg("Price fetch completed")
 
-		if err := pf.db.Create(&coinPrice).Error; err != nil {
-			log.Printf("Error saving price for %s: %v", coin, err)
+	return rows, errors.Join(errs...)
+}
+
+// fetchFrom fetches coins from one source and returns the quotes that were
+// fetched, the prices to store labelled with role and any fetch errors. A
+// source with an open circuit breaker is skipped and counts as a cycle with
+// nothing received
+func (pf *PriceFetcher) fetchFrom(ctx context.Context, source services.PriceSource, coins []string, role string) (map[string]services.Quote, []models.CoinPrice, error) {
+	var prices []models.CoinPrice
+	var errs []error
+
+	ctx, span := tracing.Tracer.Start(ctx, "fetch "+source.Name(), trace.WithAttributes(
+		attribute.String("exchange", source.Name()),
+		attribute.String("role", role),
+		attribute.Int("coins", len(coins)),
+	))
+	defer span.End()
+
+	if !pf.breaker.Allow(source.Name()) {
+		log.Warn().Str("exchange", source.Name()).Msg("Skipping source, circuit breaker is open")
+		span.SetAttributes(attribute.Bool("breaker_open", true))
+		pf.recordSLA(source.Name(), len(coins), 0)
+		if pf.quality != nil {
+			// A skipped source is scored as unreachable, not as instant
+			pf.quality.Observe(source.Name(), models.QUALITY_MAX_LATENCY, len(coins), 0, nil)
+		}
+		return nil, nil, nil
+	}
+
+	fetchStartedAt := time.Now()
+	quotes, err := services.FetchQuotes(source, coins)
+	metrics.ObserveFetch(source.Name(), fetchStartedAt, err)
+	fetchLatency := time.Since(fetchStartedAt)
+	// Only a fetch that returned nothing trips the breaker, a few missing coins don't
+	pf.breaker.Record(source.Name(), err == nil || len(quotes) > 0)
+	if err != nil {
+		// Partial results are still usable, only the failed coins are skipped
+		log.Error().Err(err).Str("exchange", source.Name()).Dur("duration", time.Since(fetchStartedAt)).Msg("Error fetching prices")
+		errs = append(errs, fmt.Errorf("%s: %w", source.Name(), err))
+		span.RecordError(err)
+	}
+	span.SetAttributes(attribute.Int("quotes", len(quotes)))
+
+	pf.recordSLA(source.Name(), len(coins), len(quotes))
+
+	var staleness []time.Duration
+	for _, coin := range coins {
+		quote, ok := quotes[coin]
+		if !ok {
+			continue
+		}
+		price := quote.Price
+
+		if err := pf.bounds.Check(source.Name(), coin, price); err != nil {
+			log.Warn().Err(err).Str("exchange", source.Name()).Str("coin", coin).Msg("Rejected implausible price")
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name(), err))
 			continue
 		}
 
-		log.Printf("Successfully saved %s price: %.8f", coin, price)
+		labels := models.Labels{LABEL_ROLE: role}
+		for key, value := range quote.Labels {
+			labels[key] = value
+		}
+
+		coinPrice := models.CoinPrice{
+			Coin:       coin,
+			Exchange:   source.Name(),
+			Price:      price,
+			Confidence: quote.Confidence,
+			Labels:     labels,
+		}
+		if !quote.Timestamp.IsZero() {
+			sourceTime := pf.clock.Correct(source.Name(), quote.Timestamp)
+			coinPrice.SourceTime = &sourceTime
+			staleness = append(staleness, fetchStartedAt.Add(fetchLatency).Sub(sourceTime))
+		}
+
+		prices = append(prices, coinPrice)
+
+		log.Debug().Str("exchange", source.Name()).Str("coin", coin).Float64("price", price).Msg("Fetched price")
+	}
+
+	if pf.quality != nil {
+		pf.quality.Observe(source.Name(), fetchLatency, len(coins), len(quotes), staleness)
 	}
 
-	log.Println("Price fetch completed")
+	return quotes, prices, errors.Join(errs...)
+}
+
+// recordSLA records how many of the requested coins a source returned,
+// holding the gate for the write
+func (pf *PriceFetcher) recordSLA(exchange string, requested, received int) {
+	pf.gate.Enter()
+	defer pf.gate.Leave()
+
+	pf.sla.Record(exchange, requested, received, time.Now())
 }
@@ -0,0 +1,202 @@
+package workers
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/metrics"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/services"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DEFAULT_OUTLIER_PCT    = 2.0
+	DEFAULT_QUALITY_WINDOW = 24 * time.Hour
+	// MIN_OUTLIER_VENUES is how many venues must price a coin for a median to
+	// single out an outlier, with two either could be the wrong one
+	MIN_OUTLIER_VENUES = 3
+)
+
+// QualityScorer keeps hourly quality counters per source: fetch latency,
+// cycles with every coin priced, how old timestamped prices were and how often
+// a price strayed more than outlierPct from the median of the other venues.
+// With promotion on, the best scoring source becomes the primary one
+type QualityScorer struct {
+	db         *gorm.DB
+	outlierPct float64
+
+	registry *services.Registry
+	window   time.Duration
+	margin   float64
+
+	mu      sync.Mutex
+	pending map[string]*models.SourceScore
+}
+
+// NewQualityScorer creates a scorer flagging prices more than outlierPct away
+// from the cross-venue median and ranking sources over the trailing window
+func NewQualityScorer(db *gorm.DB, outlierPct float64, window time.Duration) *QualityScorer {
+	if outlierPct <= 0 {
+		outlierPct = DEFAULT_OUTLIER_PCT
+	}
+	if window <= 0 {
+		window = DEFAULT_QUALITY_WINDOW
+	}
+	return &QualityScorer{
+		db:         db,
+		outlierPct: outlierPct,
+		window:     window,
+		pending:    make(map[string]*models.SourceScore),
+	}
+}
+
+// SetPromotion makes the best scoring source the primary source of registry,
+// and so the one the fallback fills in for, once it beats the current primary
+// by margin points
+func (qs *QualityScorer) SetPromotion(registry *services.Registry, margin float64) {
+	qs.registry = registry
+	qs.margin = margin
+}
+
+// Observe records one fetch from exchange during the current cycle.
+// staleness lists how old each venue-timestamped price was when it arrived
+func (qs *QualityScorer) Observe(exchange string, latency time.Duration, requested, received int, staleness []time.Duration) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	score := qs.score(exchange)
+	score.Cycles++
+	if requested > 0 && received == requested {
+		score.SuccessfulCycles++
+	}
+	score.LatencyMs += float64(latency.Milliseconds())
+	for _, age := range staleness {
+		score.StalenessSeconds += math.Max(age.Seconds(), 0)
+		score.StalenessSamples++
+	}
+}
+
+// Record checks the prices saved this cycle, keyed by exchange then coin,
+// for outliers and adds everything observed to the hour of at
+func (qs *QualityScorer) Record(saved map[string]map[string]float64, at time.Time) (int64, error) {
+	byCoin := make(map[string]map[string]float64)
+	for exchange, coins := range saved {
+		for coin, price := range coins {
+			if byCoin[coin] == nil {
+				byCoin[coin] = make(map[string]float64)
+			}
+			byCoin[coin][exchange] = price
+		}
+	}
+
+	qs.mu.Lock()
+	for _, venues := range byCoin {
+		if len(venues) < MIN_OUTLIER_VENUES {
+			continue
+		}
+		for exchange, price := range venues {
+			// Each venue is held against the others so it can't pull the
+			// median towards itself
+			others := make([]float64, 0, len(venues)-1)
+			for other, otherPrice := range venues {
+				if other != exchange {
+					others = append(others, otherPrice)
+				}
+			}
+			reference := medianPrice(others)
+
+			score := qs.score(exchange)
+			score.Compared++
+			if reference > 0 && math.Abs(price-reference)/reference*100 > qs.outlierPct {
+				score.Outliers++
+			}
+		}
+	}
+
+	batch := make([]models.SourceScore, 0, len(qs.pending))
+	hour := at.UTC().Truncate(time.Hour)
+	for _, score := range qs.pending {
+		score.Hour = hour
+		batch = append(batch, *score)
+	}
+	qs.pending = make(map[string]*models.SourceScore)
+	qs.mu.Unlock()
+
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	result := qs.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "exchange"}, {Name: "hour"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"cycles":            gorm.Expr("source_scores.cycles + " + db.Excluded(qs.db, "cycles")),
+			"successful_cycles": gorm.Expr("source_scores.successful_cycles + " + db.Excluded(qs.db, "successful_cycles")),
+			"latency_ms":        gorm.Expr("source_scores.latency_ms + " + db.Excluded(qs.db, "latency_ms")),
+			"staleness_seconds": gorm.Expr("source_scores.staleness_seconds + " + db.Excluded(qs.db, "staleness_seconds")),
+			"staleness_samples": gorm.Expr("source_scores.staleness_samples + " + db.Excluded(qs.db, "staleness_samples")),
+			"compared":          gorm.Expr("source_scores.compared + " + db.Excluded(qs.db, "compared")),
+			"outliers":          gorm.Expr("source_scores.outliers + " + db.Excluded(qs.db, "outliers")),
+			"updated_at":        gorm.Expr(db.Excluded(qs.db, "updated_at")),
+		}),
+	}).Create(&batch)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, qs.rank(at)
+}
+
+// rank publishes each source's score over the window and, with promotion on,
+// makes the best scoring polled source primary when it beats the current
+// primary by the margin
+func (qs *QualityScorer) rank(now time.Time) error {
+	var rows []models.SourceScore
+	if err := qs.db.Where("hour >= ?", now.Add(-qs.window).UTC().Truncate(time.Hour)).Find(&rows).Error; err != nil {
+		return err
+	}
+	ranking := models.RankSources(rows)
+
+	scores := make(map[string]float64, len(ranking))
+	for _, ranked := range ranking {
+		scores[ranked.Exchange] = ranked.Score
+		metrics.SourceQualityScore.WithLabelValues(ranked.Exchange).Set(ranked.Score)
+	}
+
+	if qs.registry == nil {
+		return nil
+	}
+	primary := qs.registry.Primary()
+	if primary == nil {
+		return nil
+	}
+
+	for _, ranked := range ranking {
+		// The fallback isn't polled on its own so it can't become primary
+		if _, polled := qs.registry.Get(ranked.Exchange); !polled {
+			continue
+		}
+		if ranked.Exchange != primary.Name() && ranked.Score >= scores[primary.Name()]+qs.margin {
+			qs.registry.Promote(ranked.Exchange)
+			log.Warn().Str("exchange", ranked.Exchange).Str("previous", primary.Name()).
+				Float64("score", ranked.Score).Float64("previous_score", scores[primary.Name()]).
+				Msg("Promoted best scoring source to primary")
+		}
+		return nil
+	}
+	return nil
+}
+
+// score returns the pending counters of exchange, the caller holds mu
+func (qs *QualityScorer) score(exchange string) *models.SourceScore {
+	score, ok := qs.pending[exchange]
+	if !ok {
+		score = &models.SourceScore{Exchange: exchange}
+		qs.pending[exchange] = score
+	}
+	return score
+}
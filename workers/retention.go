@@ -0,0 +1,113 @@
+package workers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/notblessy/dexlite/models"
+	"gorm.io/gorm"
+)
+
+// Series retention rules can be set for
+const (
+	RETENTION_PRICES       = "prices"
+	RETENTION_CANDLES      = "candles"
+	RETENTION_FUNDING      = "funding_rates"
+	RETENTION_INDEX        = "index_prices"
+	RETENTION_MARKS        = "mark_prices"
+	RETENTION_ORDERBOOKS   = "orderbook_snapshots"
+	RETENTION_RUNS         = "worker_runs"
+	RETENTION_DEAD_LETTERS = "dead_letters"
+	RETENTION_INCIDENTS    = "venue_incidents"
+)
+
+// DEFAULT_RETENTION keeps the operational tables bounded when no rule
+// covers them, in the order their rules are added
+var DEFAULT_RETENTION = []RetentionRule{
+	{Table: RETENTION_RUNS, Keep: 30 * 24 * time.Hour},
+	{Table: RETENTION_DEAD_LETTERS, Keep: 30 * 24 * time.Hour},
+	{Table: RETENTION_INCIDENTS, Keep: 365 * 24 * time.Hour},
+}
+
+// candleIntervalColumn holds CoinCandle.Interval
+const candleIntervalColumn = "resolution"
+
+// retentionTable is where a series is stored and the column its rows age by
+type retentionTable struct {
+	model      func() any
+	timeColumn string
+}
+
+var retentionTables = map[string]retentionTable{
+	RETENTION_PRICES:       {func() any { return &models.CoinPrice{} }, "created_at"},
+	RETENTION_CANDLES:      {func() any { return &models.CoinCandle{} }, "open_time"},
+	RETENTION_FUNDING:      {func() any { return &models.FundingRate{} }, "created_at"},
+	RETENTION_INDEX:        {func() any { return &models.IndexPrice{} }, "created_at"},
+	RETENTION_MARKS:        {func() any { return &models.MarkPrice{} }, "created_at"},
+	RETENTION_ORDERBOOKS:   {func() any { return &models.OrderbookSnapshot{} }, "created_at"},
+	RETENTION_RUNS:         {func() any { return &models.WorkerRun{} }, "started_at"},
+	RETENTION_DEAD_LETTERS: {func() any { return &models.DeadLetter{} }, "created_at"},
+	RETENTION_INCIDENTS:    {func() any { return &models.VenueIncident{} }, "started_at"},
+}
+
+// RetentionRule keeps rows of one series for Keep, forever when 0. Coin and,
+// for candles, Interval narrow it down
+type RetentionRule struct {
+	Table    string
+	Coin     string
+	Interval string
+	Keep     time.Duration
+}
+
+// specificity ranks rules matching the same row, a coin outranking an
+// interval
+func (r RetentionRule) specificity() int {
+	rank := 0
+	if r.Coin != "" {
+		rank += 2
+	}
+	if r.Interval != "" {
+		rank++
+	}
+	return rank
+}
+
+// overlaps reports whether some row could match both rules
+func (r RetentionRule) overlaps(other RetentionRule) bool {
+	return r.Table == other.Table &&
+		(r.Coin == "" || other.Coin == "" || r.Coin == other.Coin) &&
+		(r.Interval == "" || other.Interval == "" || r.Interval == other.Interval)
+}
+
+// condition selects the rows the rule names, empty when it names the whole
+// series
+func (r RetentionRule) condition() (string, []any) {
+	var conditions []string
+	var args []any
+	if r.Coin != "" {
+		conditions = append(conditions, "coin = ?")
+		args = append(args, r.Coin)
+	}
+	if r.Interval != "" {
+		conditions = append(conditions, candleIntervalColumn+" = ?")
+		args = append(args, r.Interval)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// scope narrows a query to the rows r applies to, leaving out those a more
+// specific rule in rules claims
+func (r RetentionRule) scope(rules []RetentionRule) func(*gorm.DB) *gorm.DB {
+	return func(query *gorm.DB) *gorm.DB {
+		if condition, args := r.condition(); condition != "" {
+			query = query.Where(condition, args...)
+		}
+		for _, other := range rules {
+			if other.specificity() > r.specificity() && r.overlaps(other) {
+				condition, args := other.condition()
+				query = query.Not(condition, args...)
+			}
+		}
+		return query
+	}
+}
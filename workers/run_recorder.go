@@ -0,0 +1,55 @@
+package workers
+
+import (
+	"time"
+
+	"github.com/notblessy/dexlite/models"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// Worker names as recorded in worker_runs
+const (
+	WORKER_PRICE_FETCHER      = "price_fetcher"
+	WORKER_CLEANUP            = "cleanup"
+	WORKER_CANDLE_BUILDER     = "candle_builder"
+	WORKER_SPREAD_MONITOR     = "spread_monitor"
+	WORKER_ALERT_EVALUATOR    = "alert_evaluator"
+	WORKER_FUNDING_FETCHER    = "funding_fetcher"
+	WORKER_SNAPSHOT_POSTER    = "snapshot_poster"
+	WORKER_ORDERBOOK_RECORDER = "orderbook_recorder"
+	WORKER_SLO_MONITOR        = "slo_monitor"
+	WORKER_INCIDENT_TRACKER   = "incident_tracker"
+	WORKER_BACKFILLER         = "backfiller"
+)
+
+// RunRecorder persists one WorkerRun per worker cycle
+type RunRecorder struct {
+	db *gorm.DB
+}
+
+func NewRunRecorder(db *gorm.DB) *RunRecorder {
+	return &RunRecorder{
+		db: db,
+	}
+}
+
+// Record stores a finished run. err may be nil
+func (rr *RunRecorder) Record(worker string, startedAt time.Time, rows int64, err error) {
+	finishedAt := time.Now()
+
+	run := models.WorkerRun{
+		Worker:      worker,
+		StartedAt:   startedAt,
+		FinishedAt:  finishedAt,
+		DurationMs:  finishedAt.Sub(startedAt).Milliseconds(),
+		RowsWritten: rows,
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	if err := rr.db.Create(&run).Error; err != nil {
+		log.Error().Err(err).Str("worker", worker).Msg("Error recording worker run")
+	}
+}
@@ -0,0 +1,74 @@
+package workers
+
+import (
+	"time"
+
+	"github.com/notblessy/dexlite/models"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// SLATracker persists per-source uptime and freshness counters for each month
+type SLATracker struct {
+	db *gorm.DB
+}
+
+func NewSLATracker(db *gorm.DB) *SLATracker {
+	return &SLATracker{
+		db: db,
+	}
+}
+
+// Record adds the outcome of one fetch cycle for a source. A cycle counts as
+// successful only if every requested coin was priced
+func (st *SLATracker) Record(exchange string, requested, received int, at time.Time) {
+	sla := models.SourceSLA{
+		Exchange: exchange,
+		Month:    models.SLAMonth(at),
+	}
+
+	result := st.db.Where(&sla).FirstOrCreate(&sla)
+	if result.Error != nil {
+		log.Error().Err(result.Error).Str("exchange", exchange).Msg("Error loading SLA stats")
+		return
+	}
+	if result.RowsAffected > 0 {
+		sla.LastSuccessAt = st.lastSuccess(exchange, sla.Month)
+	}
+
+	sla.Cycles++
+	sla.RequestedPrices += int64(requested)
+	sla.ReceivedPrices += int64(received)
+
+	if requested > 0 && received == requested {
+		sla.SuccessfulCycles++
+	}
+
+	if received > 0 {
+		if sla.LastSuccessAt != nil {
+			if gap := at.Sub(*sla.LastSuccessAt).Seconds(); gap > sla.MaxGapSeconds {
+				sla.MaxGapSeconds = gap
+			}
+		}
+		sla.LastSuccessAt = &at
+	}
+
+	if err := st.db.Save(&sla).Error; err != nil {
+		log.Error().Err(err).Str("exchange", exchange).Msg("Error saving SLA stats")
+	}
+}
+
+// lastSuccess returns when the source last succeeded in a month before month,
+// so a gap spanning the turn of a month is measured whole in the new month
+func (st *SLATracker) lastSuccess(exchange, month string) *time.Time {
+	var previous models.SourceSLA
+	err := st.db.Where("exchange = ? AND month < ? AND last_success_at IS NOT NULL", exchange, month).
+		Order("month DESC").
+		Limit(1).
+		Find(&previous).Error
+	if err != nil {
+		log.Warn().Err(err).Str("exchange", exchange).Msg("Error loading previous SLA stats")
+		return nil
+	}
+	return previous.LastSuccessAt
+}
@@ -0,0 +1,181 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/metrics"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/notifiers"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// MIN_SLO_REQUESTS is how many requests a burn alert's short window needs
+// before it can fire, so a single failure on a quiet route doesn't page
+const MIN_SLO_REQUESTS = 10
+
+// BurnAlert fires when an SLO burns its error budget Rate times faster than
+// sustainable over both windows. The long window keeps short spikes out,
+// the short one clears the alert soon after the burn stops
+type BurnAlert struct {
+	Long  time.Duration
+	Short time.Duration
+	Rate  float64
+}
+
+// sloAlertKey identifies one burn alert of one SLO
+type sloAlertKey struct {
+	slo   int
+	alert int
+}
+
+// SLOMonitor exports the burn rates of every SLO over the burn alert windows
+// and, with notifiers added, sends an alert when one starts burning. Like
+// price alerts, a burn alert fires once until it clears
+type SLOMonitor struct {
+	db        *gorm.DB
+	gate      *db.WriteGate
+	runs      *RunRecorder
+	tracker   *metrics.SLOTracker
+	alerts    []BurnAlert
+	interval  time.Duration
+	notifiers []notifiers.Notifier
+	channel   string
+	smtp      *notifiers.SMTPServer
+	firing    map[sloAlertKey]bool
+}
+
+func NewSLOMonitor(database *gorm.DB, gate *db.WriteGate, tracker *metrics.SLOTracker, alerts []BurnAlert, interval time.Duration) *SLOMonitor {
+	return &SLOMonitor{
+		db:       database,
+		gate:     gate,
+		runs:     NewRunRecorder(database),
+		tracker:  tracker,
+		alerts:   alerts,
+		interval: interval,
+		firing:   make(map[sloAlertKey]bool),
+	}
+}
+
+// AddNotifier sends every burn alert to notifier
+func (sm *SLOMonitor) AddNotifier(notifier notifiers.Notifier) {
+	sm.notifiers = append(sm.notifiers, notifier)
+}
+
+// SetChannel routes burn alerts to the notification channel named name as
+// well, mailed through smtp for email channels
+func (sm *SLOMonitor) SetChannel(name string, smtp *notifiers.SMTPServer) {
+	sm.channel = name
+	sm.smtp = smtp
+}
+
+func (sm *SLOMonitor) Start(ctx context.Context) {
+	ticker := time.NewTicker(sm.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("SLO monitor shutting down")
+			return
+		case <-ticker.C:
+			sm.Evaluate(time.Now())
+		}
+	}
+}
+
+// Evaluate updates the burn rate gauges and fires or clears burn alerts
+func (sm *SLOMonitor) Evaluate(now time.Time) {
+	notifying := len(sm.notifiers) > 0 || sm.channel != ""
+	var fired int64
+	var errs []error
+	for i, slo := range sm.tracker.SLOs() {
+		for j, alert := range sm.alerts {
+			long := sm.tracker.Window(i, alert.Long, now)
+			short := sm.tracker.Window(i, alert.Short, now)
+			metrics.SLOBurnRate.WithLabelValues(slo.Name, alert.Long.String()).Set(long.BurnRate)
+			metrics.SLOBurnRate.WithLabelValues(slo.Name, alert.Short.String()).Set(short.BurnRate)
+
+			key := sloAlertKey{slo: i, alert: j}
+			burning := long.BurnRate >= alert.Rate && short.BurnRate >= alert.Rate && short.Requests >= MIN_SLO_REQUESTS
+			if burning == sm.firing[key] {
+				continue
+			}
+			if !burning {
+				log.Info().Str("slo", slo.Name).Float64("burn_rate", long.BurnRate).Dur("window", alert.Long).Msg("SLO burn alert cleared")
+				sm.firing[key] = false
+				continue
+			}
+
+			log.Warn().Str("slo", slo.Name).Str("route", slo.Route).Float64("burn_rate", long.BurnRate).Dur("window", alert.Long).Msg("SLO burning its error budget")
+			if notifying {
+				if err := sm.notify(slo, alert, long, now); err != nil {
+					// Left unfired so delivery is retried on the next pass
+					errs = append(errs, fmt.Errorf("slo %s: %w", slo.Name, err))
+					continue
+				}
+				fired++
+			}
+			sm.firing[key] = true
+		}
+	}
+
+	// Only the run is written, the alerts are sent outside the gate
+	if notifying {
+		sm.gate.Enter()
+		sm.runs.Record(WORKER_SLO_MONITOR, now, fired, errors.Join(errs...))
+		sm.gate.Leave()
+	}
+}
+
+// notify sends a burn alert to every notifier and the channel. It only fails
+// when no destination could be reached
+func (sm *SLOMonitor) notify(slo metrics.SLO, alert BurnAlert, window metrics.SLOWindow, now time.Time) error {
+	destinations := sm.notifiers
+	if sm.channel != "" {
+		var channel models.NotificationChannel
+		err := sm.db.Where("name = ? AND enabled = ?", sm.channel, true).Take(&channel).Error
+		if err == nil {
+			var notifier notifiers.Notifier
+			notifier, err = notifiers.ForChannel(channel, sm.smtp)
+			destinations = append(destinations[:len(destinations):len(destinations)], notifier)
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("channel", sm.channel).Msg("SLO burn alert channel unavailable")
+		}
+	}
+	if len(destinations) == 0 {
+		return errors.New("no notifier or channel to send the burn alert to")
+	}
+
+	event := notifiers.Event{
+		Name:          slo.Name,
+		Condition:     notifiers.CONDITION_SLO_BURN,
+		Threshold:     alert.Rate,
+		WindowMinutes: int(alert.Long / time.Minute),
+		FiredAt:       now,
+		Route:         slo.Route,
+		Objective:     slo.Objective * 100,
+		BadPct:        float64(window.Bad) / float64(window.Requests) * 100,
+		BurnRate:      window.BurnRate,
+	}
+
+	var errs []error
+	for _, notifier := range destinations {
+		if err := notifier.Notify(event); err != nil {
+			metrics.NotificationFailuresTotal.WithLabelValues(notifier.Name()).Inc()
+			errs = append(errs, fmt.Errorf("%s: %w", notifier.Name(), err))
+		}
+	}
+	if len(errs) == len(destinations) {
+		return errors.Join(errs...)
+	}
+	for _, err := range errs {
+		log.Warn().Err(err).Str("slo", slo.Name).Msg("Failed to deliver SLO burn alert")
+	}
+	return nil
+}
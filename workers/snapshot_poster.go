@@ -0,0 +1,180 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/services"
+	"github.com/notblessy/dexlite/symbols"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// Snapshot is the payload posted to the snapshot webhook
+type Snapshot struct {
+	At    time.Time      `json:"at"`
+	Coins []CoinSnapshot `json:"coins"`
+}
+
+// CoinSnapshot is one coin's newest price with how far it moved over the last
+// 24 hours and since the previous snapshot. A change is left out when there is
+// no price to compare against
+type CoinSnapshot struct {
+	Coin           string    `json:"coin"`
+	Exchange       string    `json:"exchange"`
+	Price          float64   `json:"price"`
+	PricedAt       time.Time `json:"priced_at"`
+	Change24hPct   *float64  `json:"change_24h_pct,omitempty"`
+	ChangeSincePct *float64  `json:"change_since_last_pct,omitempty"`
+}
+
+// SnapshotPoster posts a Snapshot of a set of coins to a webhook at fixed
+// times of day in UTC
+type SnapshotPoster struct {
+	db       *gorm.DB
+	gate     *db.WriteGate
+	runs     *RunRecorder
+	client   *services.WebhookClient
+	url      string
+	schedule []time.Duration
+	coins    func() []string
+
+	// Prices of the previous snapshot, keyed by coin
+	previous map[string]float64
+}
+
+// NewSnapshotPoster creates a poster sending to url at each schedule offset
+// from midnight UTC. coins is read at every post
+func NewSnapshotPoster(database *gorm.DB, gate *db.WriteGate, url string, schedule []time.Duration, coins func() []string) *SnapshotPoster {
+	sorted := append([]time.Duration(nil), schedule...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return &SnapshotPoster{
+		db:       database,
+		gate:     gate,
+		runs:     NewRunRecorder(database),
+		client:   services.NewWebhookClient(),
+		url:      url,
+		schedule: sorted,
+		coins:    coins,
+		previous: make(map[string]float64),
+	}
+}
+
+func (sp *SnapshotPoster) Start(ctx context.Context) {
+	if len(sp.schedule) == 0 {
+		return
+	}
+
+	for {
+		at := sp.next(time.Now())
+		timer := time.NewTimer(time.Until(at))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Info().Msg("Snapshot poster shutting down")
+			return
+		case <-timer.C:
+			sp.Post(at)
+		}
+	}
+}
+
+// next returns the first scheduled time after now
+func (sp *SnapshotPoster) next(now time.Time) time.Time {
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	for _, offset := range sp.schedule {
+		if at := midnight.Add(offset); at.After(now) {
+			return at
+		}
+	}
+	return midnight.AddDate(0, 0, 1).Add(sp.schedule[0])
+}
+
+// Post builds the snapshot as of at and sends it to the webhook
+func (sp *SnapshotPoster) Post(at time.Time) {
+	startedAt := time.Now()
+
+	snapshot := Snapshot{At: at, Coins: []CoinSnapshot{}}
+	var errs []error
+	for _, coin := range symbols.NormalizeAll(sp.coins()) {
+		entry, found, err := sp.snapshot(coin, at)
+		if err != nil {
+			log.Error().Err(err).Str("coin", coin).Msg("Error building price snapshot")
+			errs = append(errs, fmt.Errorf("%s: %w", coin, err))
+			continue
+		}
+		if found {
+			snapshot.Coins = append(snapshot.Coins, entry)
+		}
+	}
+
+	if err := sp.client.Send(sp.url, snapshot); err != nil {
+		log.Error().Err(err).Msg("Error posting price snapshot")
+		sp.record(startedAt, errors.Join(append(errs, err)...))
+		return
+	}
+
+	for _, entry := range snapshot.Coins {
+		sp.previous[entry.Coin] = entry.Price
+	}
+
+	log.Info().Int("coins", len(snapshot.Coins)).Time("at", at).Msg("Price snapshot posted")
+	sp.record(startedAt, errors.Join(errs...))
+}
+
+// record stores the run, holding off migrations meanwhile. The snapshot is
+// posted outside the gate
+func (sp *SnapshotPoster) record(startedAt time.Time, err error) {
+	sp.gate.Enter()
+	defer sp.gate.Leave()
+	sp.runs.Record(WORKER_SNAPSHOT_POSTER, startedAt, 0, err)
+}
+
+// snapshot loads coin's newest price at or before at and compares it to the
+// same exchange's price 24 hours earlier
+func (sp *SnapshotPoster) snapshot(coin string, at time.Time) (CoinSnapshot, bool, error) {
+	var latest models.CoinPrice
+	err := sp.db.Where("coin = ? AND created_at <= ?", coin, at).
+		Order("created_at DESC").
+		Take(&latest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return CoinSnapshot{}, false, nil
+	}
+	if err != nil {
+		return CoinSnapshot{}, false, err
+	}
+
+	entry := CoinSnapshot{
+		Coin:     coin,
+		Exchange: latest.Exchange,
+		Price:    latest.Price,
+		PricedAt: latest.CreatedAt,
+	}
+
+	var dayAgo models.CoinPrice
+	err = sp.db.Where("coin = ? AND exchange = ? AND created_at <= ?", coin, latest.Exchange, at.Add(-24*time.Hour)).
+		Order("created_at DESC").
+		Take(&dayAgo).Error
+	switch {
+	case err == nil:
+		change := percentChange(dayAgo.Price, latest.Price)
+		entry.Change24hPct = &change
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return CoinSnapshot{}, false, err
+	}
+
+	if previous, ok := sp.previous[coin]; ok {
+		change := percentChange(previous, latest.Price)
+		entry.ChangeSincePct = &change
+	}
+
+	return entry, true, nil
+}
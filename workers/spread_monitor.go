@@ -0,0 +1,192 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/metrics"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/stream"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+const DEFAULT_SPREAD_INTERVAL = 1 * time.Minute
+
+// latestPrices loads the newest price per exchange for coin, ignoring venues
+// whose newest price is older than maxAge so a stale feed doesn't look like
+// an opportunity
+func latestPrices(database *gorm.DB, coin string, maxAge time.Duration) ([]models.CoinPrice, error) {
+	var latest []models.CoinPrice
+	query := database.Model(&models.CoinPrice{}).Where("coin = ? AND created_at >= ?", coin, time.Now().Add(-maxAge))
+	err := db.LatestPer(query, "exchange").Find(&latest).Error
+	return latest, err
+}
+
+// SpreadMonitor compares the latest price of every venue for each tracked coin
+// and flags spreads at or above a threshold as SpreadAlert rows
+type SpreadMonitor struct {
+	db           *gorm.DB
+	gate         *db.WriteGate
+	runs         *RunRecorder
+	coins        func() []string
+	thresholdBps float64
+	maxAge       time.Duration
+	interval     time.Duration
+
+	// Last flagged spread per coin, so an unchanged spread is flagged once.
+	// A coin stays flagged until its spread falls back under the threshold
+	flagged map[string]models.VenueSpread
+
+	opportunities *stream.Opportunities
+}
+
+// NewSpreadMonitor creates a monitor that runs every interval over the coins
+// returned by coins, flagging spreads of at least thresholdBps between prices
+// no older than maxAge
+func NewSpreadMonitor(database *gorm.DB, gate *db.WriteGate, coins func() []string, thresholdBps float64, maxAge, interval time.Duration) *SpreadMonitor {
+	if interval <= 0 {
+		interval = DEFAULT_SPREAD_INTERVAL
+	}
+
+	return &SpreadMonitor{
+		db:           database,
+		gate:         gate,
+		runs:         NewRunRecorder(database),
+		coins:        coins,
+		thresholdBps: thresholdBps,
+		maxAge:       maxAge,
+		interval:     interval,
+		flagged:      make(map[string]models.VenueSpread),
+	}
+}
+
+// SetOpportunities publishes every flagged spread, and its end, to
+// opportunities
+func (sm *SpreadMonitor) SetOpportunities(opportunities *stream.Opportunities) {
+	sm.opportunities = opportunities
+}
+
+func (sm *SpreadMonitor) Start(ctx context.Context) {
+	// Run immediately on start
+	sm.Check()
+
+	ticker := time.NewTicker(sm.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Spread monitor shutting down")
+			return
+		case <-ticker.C:
+			sm.Check()
+		}
+	}
+}
+
+// Check runs one pass over the tracked coins
+func (sm *SpreadMonitor) Check() {
+	// Hold off while a migration is running
+	sm.gate.Enter()
+	defer sm.gate.Leave()
+
+	startedAt := time.Now()
+
+	var rows int64
+	var errs []error
+	for _, coin := range sm.coins() {
+		flagged, err := sm.check(coin, startedAt)
+		if err != nil {
+			log.Error().Err(err).Str("coin", coin).Msg("Error checking spread")
+			errs = append(errs, fmt.Errorf("%s: %w", coin, err))
+			continue
+		}
+		if flagged {
+			rows++
+		}
+	}
+
+	sm.runs.Record(WORKER_SPREAD_MONITOR, startedAt, rows, errors.Join(errs...))
+}
+
+// check computes the spread for one coin and stores an alert if it crosses the
+// threshold. It reports whether an alert was stored
+func (sm *SpreadMonitor) check(coin string, now time.Time) (bool, error) {
+	latest, err := latestPrices(sm.db, coin, sm.maxAge)
+	if err != nil {
+		return false, err
+	}
+
+	spread, ok := models.WidestSpread(latest)
+	if !ok {
+		metrics.SpreadBps.DeleteLabelValues(coin)
+		sm.unflag(coin, now)
+		return false, nil
+	}
+	metrics.SpreadBps.WithLabelValues(coin).Set(spread.SpreadBps)
+
+	if spread.SpreadBps < sm.thresholdBps {
+		sm.unflag(coin, now)
+		return false, nil
+	}
+	previous, open := sm.flagged[coin]
+	if open && previous == spread {
+		return false, nil
+	}
+
+	alert := models.SpreadAlert{
+		Coin:         coin,
+		BuyExchange:  spread.BuyExchange,
+		BuyPrice:     spread.BuyPrice,
+		SellExchange: spread.SellExchange,
+		SellPrice:    spread.SellPrice,
+		SpreadBps:    spread.SpreadBps,
+		DetectedAt:   now,
+	}
+	if err := sm.db.Create(&alert).Error; err != nil {
+		return false, err
+	}
+	sm.flagged[coin] = spread
+	metrics.SpreadAlertsTotal.WithLabelValues(coin).Inc()
+
+	event := stream.OPPORTUNITY_OPEN
+	if open {
+		event = stream.OPPORTUNITY_UPDATE
+	}
+	sm.publish(event, coin, spread, now)
+
+	log.Warn().
+		Str("coin", coin).
+		Str("buy_exchange", spread.BuyExchange).
+		Str("sell_exchange", spread.SellExchange).
+		Float64("spread_bps", spread.SpreadBps).
+		Msg("Spread above threshold")
+
+	return true, nil
+}
+
+// unflag closes coin's opportunity once its spread is no longer flagged
+func (sm *SpreadMonitor) unflag(coin string, now time.Time) {
+	spread, open := sm.flagged[coin]
+	if !open {
+		return
+	}
+	delete(sm.flagged, coin)
+	sm.publish(stream.OPPORTUNITY_CLOSE, coin, spread, now)
+}
+
+func (sm *SpreadMonitor) publish(event, coin string, spread models.VenueSpread, now time.Time) {
+	if sm.opportunities == nil {
+		return
+	}
+	sm.opportunities.Publish(stream.Opportunity{
+		Event:       event,
+		Coin:        coin,
+		VenueSpread: spread,
+		At:          now,
+	})
+}
@@ -0,0 +1,124 @@
+package workers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/services"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// TELEGRAM_LINK_RETRY is how long the linker waits after a failed poll
+const TELEGRAM_LINK_RETRY = 5 * time.Second
+
+// Replies the bot sends to /start
+const (
+	TELEGRAM_LINKED  = "This chat now receives the dexlite price alerts of your watchlist."
+	TELEGRAM_UNKNOWN = "This link code is unknown or has expired. Ask dexlite for a new one and send /start with it."
+)
+
+// TelegramLinker links Telegram chats to user accounts. A user asks the API
+// for a link code and sends it to the bot as /start <code>, which proves they
+// are in the chat before the server messages it. Only private chats are
+// linked
+type TelegramLinker struct {
+	db     *gorm.DB
+	gate   *db.WriteGate
+	bot    *services.TelegramBot
+	client *services.WebhookClient
+	token  string
+	// offset is the ID of the next update to read
+	offset int64
+}
+
+// NewTelegramLinker creates a linker reading the messages sent to the bot
+// with token
+func NewTelegramLinker(database *gorm.DB, gate *db.WriteGate, token string) *TelegramLinker {
+	return &TelegramLinker{
+		db:     database,
+		gate:   gate,
+		bot:    services.NewTelegramBot(token),
+		client: services.NewWebhookClient(),
+		token:  token,
+	}
+}
+
+func (tl *TelegramLinker) Start(ctx context.Context) {
+	for {
+		updates, err := tl.bot.Updates(ctx, tl.offset)
+		if ctx.Err() != nil {
+			log.Info().Msg("Telegram linker shutting down")
+			return
+		}
+		if err != nil {
+			log.Warn().Err(err).Msg("Error reading Telegram updates")
+			select {
+			case <-ctx.Done():
+				log.Info().Msg("Telegram linker shutting down")
+				return
+			case <-time.After(TELEGRAM_LINK_RETRY):
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			tl.offset = update.UpdateID + 1
+			if update.Message != nil {
+				tl.handle(*update.Message)
+			}
+		}
+	}
+}
+
+// handle links the chat a /start message came from and tells it how it went
+func (tl *TelegramLinker) handle(message services.TelegramMessage) {
+	code, ok := strings.CutPrefix(strings.TrimSpace(message.Text), "/start")
+	if !ok || message.Chat.Type != "private" {
+		return
+	}
+	code = strings.TrimSpace(code)
+	chatID := strconv.FormatInt(message.Chat.ID, 10)
+
+	reply := TELEGRAM_UNKNOWN
+	if code != "" {
+		linked, err := tl.Link(chatID, code, time.Now())
+		if err != nil {
+			log.Error().Err(err).Msg("Error linking Telegram chat")
+			return
+		}
+		if linked {
+			reply = TELEGRAM_LINKED
+		}
+	}
+
+	if err := tl.client.SendTelegram(tl.token, chatID, reply); err != nil {
+		log.Warn().Err(err).Msg("Error replying to Telegram chat")
+	}
+}
+
+// Link sends a user's alerts to chatID if code is the user's pending link
+// code and hasn't expired, and reports whether it was
+func (tl *TelegramLinker) Link(chatID, code string, now time.Time) (bool, error) {
+	tl.gate.Enter()
+	defer tl.gate.Leave()
+
+	result := tl.db.Model(&models.NotificationPreference{}).
+		Where("telegram_link_code = ? AND telegram_link_expires_at > ?", models.TelegramLinkHash(code), now).
+		Updates(map[string]interface{}{
+			"telegram_chat_id":         chatID,
+			"telegram_link_code":       "",
+			"telegram_link_expires_at": nil,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Info().Msg("Linked a Telegram chat")
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,45 @@
+package workers
+
+import (
+	"math"
+
+	"github.com/notblessy/dexlite/symbols"
+)
+
+// MoveThresholds holds the smallest price move, in percent, that counts as a
+// real change for each coin. Moves below it are treated as noise so that
+// high-precision small-cap prices don't trigger on their last digit
+type MoveThresholds struct {
+	defaultPct float64
+	coins      map[string]float64
+}
+
+// NewMoveThresholds creates thresholds using defaultPct for any coin not
+// listed in perCoin
+func NewMoveThresholds(defaultPct float64, perCoin map[string]float64) *MoveThresholds {
+	coins := make(map[string]float64, len(perCoin))
+	for coin, pct := range perCoin {
+		coins[symbols.Normalize(coin)] = pct
+	}
+
+	return &MoveThresholds{
+		defaultPct: defaultPct,
+		coins:      coins,
+	}
+}
+
+// MinMovePct returns the threshold for coin. A nil MoveThresholds has none
+func (t *MoveThresholds) MinMovePct(coin string) float64 {
+	if t == nil {
+		return 0
+	}
+	if pct, exists := t.coins[coin]; exists {
+		return pct
+	}
+	return t.defaultPct
+}
+
+// Significant reports whether a change of changePct for coin clears its threshold
+func (t *MoveThresholds) Significant(coin string, changePct float64) bool {
+	return math.Abs(changePct) >= t.MinMovePct(coin)
+}
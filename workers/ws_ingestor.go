@@ -0,0 +1,322 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/notblessy/dexlite/clickhouse"
+	"github.com/notblessy/dexlite/db"
+	"github.com/notblessy/dexlite/metrics"
+	"github.com/notblessy/dexlite/models"
+	"github.com/notblessy/dexlite/services"
+	"github.com/notblessy/dexlite/ticks"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+const (
+	HYPERLIQUID_WS_URL = "wss://api.hyperliquid.xyz/ws"
+
+	wsMinBackoff   = 1 * time.Second
+	wsMaxBackoff   = 1 * time.Minute
+	wsPingInterval = 50 * time.Second
+	wsReadTimeout  = 2 * time.Minute
+)
+
+// wsMessage is the envelope Hyperliquid uses for subscription pushes
+type wsMessage struct {
+	Channel string          `json:"channel"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type wsAllMids struct {
+	Mids map[string]string `json:"mids"`
+}
+
+type lastTick struct {
+	price float64
+	at    time.Time
+}
+
+// WSIngestor streams Hyperliquid mids over WebSocket and stores a tick whenever
+// a tracked coin's price changes, rather than waiting for the hourly poll
+type WSIngestor struct {
+	db          *gorm.DB
+	gate        *db.WriteGate
+	persister   *db.Persister
+	url         string
+	coins       func() []string
+	minInterval time.Duration
+	bounds      *PriceBounds
+
+	// Last stored tick per coin, used to drop duplicates before insert
+	last map[string]lastTick
+
+	// Ticks waiting for the next flush, compressed per coin. Only used when
+	// flushInterval is set, otherwise every tick is stored as it arrives
+	pending       map[string]*ticks.Series
+	flushInterval time.Duration
+	flushedAt     time.Time
+
+	// Every accepted tick is copied here when set
+	sink *clickhouse.TickSink
+}
+
+// NewWSIngestor creates an ingestor for the coins returned by coins, which is
+// consulted on every message so tracking changes apply immediately. At most
+// one tick per coin is stored every minInterval, and only if the price moved
+func NewWSIngestor(database *gorm.DB, coins func() []string, gate *db.WriteGate, persister *db.Persister, minInterval time.Duration) *WSIngestor {
+	return &WSIngestor{
+		db:          database,
+		gate:        gate,
+		persister:   persister,
+		url:         HYPERLIQUID_WS_URL,
+		coins:       coins,
+		minInterval: minInterval,
+		last:        make(map[string]lastTick),
+	}
+}
+
+// SetPriceBounds rejects implausible streamed prices before they are stored
+func (wi *WSIngestor) SetPriceBounds(bounds *PriceBounds) {
+	wi.bounds = bounds
+}
+
+// SetFlushInterval buffers accepted ticks in memory, compressed, and stores
+// them in one insert every interval instead of one insert per message
+func (wi *WSIngestor) SetFlushInterval(interval time.Duration) {
+	wi.flushInterval = interval
+	wi.pending = make(map[string]*ticks.Series)
+}
+
+// SetTickSink copies every accepted tick to ClickHouse, where tick-level
+// history is kept longer than prices in the database
+func (wi *WSIngestor) SetTickSink(sink *clickhouse.TickSink) {
+	wi.sink = sink
+}
+
+// Start keeps a subscription open until ctx is cancelled, reconnecting with
+// exponential backoff whenever the connection drops
+func (wi *WSIngestor) Start(ctx context.Context) {
+	backoff := wsMinBackoff
+
+	for {
+		connectedAt := time.Now()
+		err := wi.run(ctx)
+
+		// Don't hold buffered ticks through a reconnect or shutdown
+		wi.flush()
+
+		if ctx.Err() != nil {
+			log.Info().Msg("WebSocket ingestor shutting down")
+			return
+		}
+
+		// A connection that stayed up for a while was healthy, start over
+		if time.Since(connectedAt) > wsMaxBackoff {
+			backoff = wsMinBackoff
+		}
+
+		log.Warn().Err(err).Dur("backoff", backoff).Msg("WebSocket ingestor disconnected, reconnecting")
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("WebSocket ingestor shutting down")
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > wsMaxBackoff {
+			backoff = wsMaxBackoff
+		}
+	}
+}
+
+// run holds one connection open and returns when it fails or ctx is cancelled
+func (wi *WSIngestor) run(ctx context.Context) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wi.url, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	subscribe := map[string]interface{}{
+		"method":       "subscribe",
+		"subscription": map[string]string{"type": "allMids"},
+	}
+	if err := conn.WriteJSON(subscribe); err != nil {
+		return err
+	}
+
+	log.Info().Msg("WebSocket ingestor subscribed to Hyperliquid allMids")
+
+	// Closing the connection unblocks ReadMessage on shutdown, the ticker keeps
+	// the server from dropping us as idle
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(wsPingInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := conn.WriteJSON(map[string]string{"method": "ping"}); err != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		var envelope wsMessage
+		if err := json.Unmarshal(message, &envelope); err != nil || envelope.Channel != "allMids" {
+			continue
+		}
+
+		var data wsAllMids
+		if err := json.Unmarshal(envelope.Data, &data); err != nil {
+			log.Error().Err(err).Msg("Error decoding allMids message")
+			continue
+		}
+
+		wi.ingest(data.Mids, time.Now())
+	}
+}
+
+// ingest stores ticks for tracked coins whose price changed since the last
+// stored tick, or buffers them when a flush interval is set
+func (wi *WSIngestor) ingest(mids map[string]string, now time.Time) {
+	var accepted []models.CoinPrice
+
+	for _, coin := range wi.coins() {
+		priceStr, exists := mids[coin]
+		if !exists {
+			continue
+		}
+
+		price, err := strconv.ParseFloat(priceStr, 64)
+		if err != nil {
+			continue
+		}
+
+		last, exists := wi.last[coin]
+		if exists && (last.price == price || now.Sub(last.at) < wi.minInterval) {
+			continue
+		}
+
+		if err := wi.bounds.Check(services.HYPERLIQUID_NAME, coin, price); err != nil {
+			log.Warn().Err(err).Str("exchange", services.HYPERLIQUID_NAME).Str("coin", coin).Msg("Rejected implausible streamed price")
+			continue
+		}
+
+		accepted = append(accepted, models.CoinPrice{
+			Coin:      coin,
+			Exchange:  services.HYPERLIQUID_NAME,
+			Price:     price,
+			CreatedAt: now,
+		})
+	}
+
+	if wi.sink != nil {
+		wi.sink.Write(accepted)
+	}
+
+	if wi.pending == nil {
+		wi.save(accepted)
+		return
+	}
+
+	for _, tick := range accepted {
+		series, exists := wi.pending[tick.Coin]
+		if !exists {
+			series = &ticks.Series{}
+			wi.pending[tick.Coin] = series
+		}
+		series.Append(ticks.Tick{At: now, Price: tick.Price})
+		// A buffered tick counts as stored for deduplication
+		wi.last[tick.Coin] = lastTick{price: tick.Price, at: now}
+	}
+
+	if now.Sub(wi.flushedAt) >= wi.flushInterval {
+		wi.flush()
+		return
+	}
+
+	var size int
+	for _, series := range wi.pending {
+		size += series.Size()
+	}
+	metrics.WSBufferBytes.WithLabelValues(metrics.BUFFER_PENDING).Set(float64(size))
+}
+
+// flush stores every buffered tick in one insert
+func (wi *WSIngestor) flush() {
+	if wi.pending == nil {
+		return
+	}
+	wi.flushedAt = time.Now()
+
+	var buffered []models.CoinPrice
+	for coin, series := range wi.pending {
+		for _, tick := range series.Ticks() {
+			buffered = append(buffered, models.CoinPrice{
+				Coin:      coin,
+				Exchange:  services.HYPERLIQUID_NAME,
+				Price:     tick.Price,
+				CreatedAt: tick.At,
+			})
+		}
+	}
+	clear(wi.pending)
+	metrics.WSBufferBytes.WithLabelValues(metrics.BUFFER_PENDING).Set(0)
+
+	// The persister dead-letters the batch if it can't be stored, so nothing
+	// is retried from here
+	wi.save(buffered)
+}
+
+// save stores ticks and records them as the last stored tick per coin
+func (wi *WSIngestor) save(prices []models.CoinPrice) {
+	if len(prices) == 0 {
+		return
+	}
+
+	wi.gate.Enter()
+	defer wi.gate.Leave()
+
+	if err := wi.persister.Save(prices); err != nil {
+		log.Error().Err(err).Int("rows", len(prices)).Msg("Error saving streamed ticks")
+		if !errors.Is(err, db.ErrPricesRejected) {
+			return
+		}
+	}
+
+	for _, tick := range prices {
+		// Rejected ticks were dead-lettered without an ID
+		if tick.ID == 0 {
+			continue
+		}
+		if last, exists := wi.last[tick.Coin]; !exists || !tick.CreatedAt.Before(last.at) {
+			wi.last[tick.Coin] = lastTick{price: tick.Price, at: tick.CreatedAt}
+		}
+	}
+}